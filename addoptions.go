@@ -0,0 +1,133 @@
+package queue
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// errDuplicate signals that an item with the same dedup key is already in
+// the queue; the ID returned along with it is the one of that item.
+var errDuplicate = errors.New("queue: duplicate item")
+
+// AddOption configures a single item added with AddWithOptions.
+type AddOption func(*addOptions)
+
+// WithDelay hides the item from consumers for d after it is added; see AddAt.
+func WithDelay(d time.Duration) AddOption {
+	return func(o *addOptions) { o.delay = d }
+}
+
+// WithPriority sets the priority of the item; items with a higher priority
+// are claimed first.
+func WithPriority(p int) AddOption {
+	return func(o *addOptions) { o.priority = p }
+}
+
+// WithHeaders attaches metadata to the item, returned in Item.Headers, e.g. a
+// content type or the ID of the request that produced it.
+func WithHeaders(h map[string]string) AddOption {
+	return func(o *addOptions) { o.headers = h }
+}
+
+// WithDedupKey makes the add a no-op while an item with the same key is in
+// the queue, whatever its state: AddWithOptions then returns the ID of that
+// item. The key is released once the item is acknowledged or deleted.
+func WithDedupKey(key string) AddOption {
+	return func(o *addOptions) { o.dedupKey = key }
+}
+
+// WithDeadline makes the item expire instead of being delivered if no
+// consumer claims it before t; see AddBefore.
+func WithDeadline(t time.Time) AddOption {
+	return func(o *addOptions) { o.expiresAt = t.UnixNano() }
+}
+
+// WithTags attaches tags to the item; see AddTagged.
+func WithTags(tags ...string) AddOption {
+	return func(o *addOptions) { o.tags = tags }
+}
+
+// WithTenant adds the item for a tenant; see AddForTenant.
+func WithTenant(tenant string) AddOption {
+	return func(o *addOptions) { o.tenant = tenant }
+}
+
+// AddWithOptions inserts a new item configured by opts and returns its ID,
+// combining what AddAt, AddBefore, AddForTenant and AddTagged do one at a
+// time, e.g.
+//
+//	id, err := q.AddWithOptions(data, queue.WithDelay(time.Minute), queue.WithPriority(10))
+//
+// The Add middleware and the overflow policy apply as for AddTagged; the ID
+// is 0 if the policy discarded the item.
+func (c *Queue) AddWithOptions(data []byte, opts ...AddOption) (int, error) {
+	return c.AddContext(c.ctx, data, opts...)
+}
+
+// AddContext is AddWithOptions on behalf of the caller's ctx: the item
+// carries the trace ID found in ctx to its consumer, see Tracer, and the Add
+// middleware receives ctx.
+func (c *Queue) AddContext(ctx context.Context, data []byte, opts ...AddOption) (int, error) {
+	o := &addOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.delay > 0 {
+		o.visibleAt = c.cfg.Clock.Now().Add(o.delay).UnixNano()
+	}
+
+	ctx = context.WithValue(ctx, addOptionsKey{}, o)
+	if err := c.enqueue(ctx, data, o.tags, c.cfg.Overflow); err != nil {
+		return 0, err
+	}
+	return o.id, nil
+}
+
+// addHeaderColumns adds the headers and dedup key columns, the latter unique
+// among the items that have one.
+func addHeaderColumns(tx *sql.Tx, t tables) error {
+	if err := addColumn(tx, t.items, "headers", "TEXT"); err != nil {
+		return err
+	}
+	if err := addColumn(tx, t.items, "dedup_key", "TEXT"); err != nil {
+		return err
+	}
+	_, err := tx.Exec("CREATE UNIQUE INDEX IF NOT EXISTS " + t.items + "_dedup_key ON " + t.items + "(dedup_key) WHERE dedup_key IS NOT NULL")
+	return err
+}
+
+// encodeHeaders encodes headers for the headers column, NULL when empty.
+func encodeHeaders(headers map[string]string) (any, error) {
+	if len(headers) == 0 {
+		return nil, nil
+	}
+	b, err := json.Marshal(headers)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// decodeHeaders decodes the headers column.
+func decodeHeaders(s string) (map[string]string, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var headers map[string]string
+	err := json.Unmarshal([]byte(s), &headers)
+	return headers, err
+}
+
+// findDuplicate returns the ID of the item holding the dedup key, or 0 if
+// there is none.
+func (c *Queue) findDuplicate(tx *sql.Tx, key string) (int, error) {
+	var id int
+	err := tx.QueryRow("SELECT id FROM "+c.tables.items+" WHERE dedup_key = ?", key).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	return id, err
+}
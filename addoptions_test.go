@@ -0,0 +1,75 @@
+package queue
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAddWithOptions(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1700000000, 0))
+	queue := setupQueue(t, Config{Clock: clock})
+	defer queue.Close()
+
+	deadline := clock.Now().Add(time.Hour)
+	id, err := queue.AddWithOptions(
+		[]byte("test data"),
+		WithDelay(time.Minute),
+		WithPriority(5),
+		WithHeaders(map[string]string{"content-type": "text/plain"}),
+		WithDeadline(deadline),
+		WithTags("mail"),
+		WithTenant("acme"),
+	)
+	if err != nil || id == 0 {
+		t.Fatalf("failed to add item to queue: %d, %v", id, err)
+	}
+
+	jobs, err := queue.ScheduledJobs(10)
+	if err != nil || len(jobs) != 1 || !jobs[0].RunAt.Equal(clock.Now().Add(time.Minute)) {
+		t.Fatalf("expected the item to be scheduled a minute later, got %+v, %v", jobs, err)
+	}
+
+	clock.Advance(time.Minute)
+	items, err := queue.Claim(1)
+	if err != nil || len(items) != 1 {
+		t.Fatalf("expected to claim the item, got %+v, %v", items, err)
+	}
+	item := items[0]
+	if item.ID != id || item.Priority != 5 || item.Tenant != "acme" || len(item.Tags) != 1 || item.Tags[0] != "mail" {
+		t.Fatalf("expected the options to be applied, got %+v", item)
+	}
+	if item.Headers["content-type"] != "text/plain" || !item.Deadline.Equal(deadline) {
+		t.Fatalf("expected the headers and the deadline to be stored, got %+v", item)
+	}
+}
+
+func TestAddWithOptionsDedupKey(t *testing.T) {
+	queue := setupQueue(t, Config{})
+	defer queue.Close()
+
+	first, err := queue.AddWithOptions([]byte("first"), WithDedupKey("order-1"))
+	if err != nil {
+		t.Fatalf("failed to add item to queue: %v", err)
+	}
+	second, err := queue.AddWithOptions([]byte("second"), WithDedupKey("order-1"))
+	if err != nil || second != first {
+		t.Fatalf("expected the duplicate to return ID %d, got %d, %v", first, second, err)
+	}
+	if _, err := queue.AddWithOptions([]byte("other"), WithDedupKey("order-2")); err != nil {
+		t.Fatalf("failed to add item to queue: %v", err)
+	}
+
+	items, err := queue.Get(10)
+	if err != nil || len(items) != 2 || string(items[0].Data) != "first" {
+		t.Fatalf("expected the duplicate to be skipped, got %+v, %v", items, err)
+	}
+
+	// The key is released once the item is gone.
+	if err := queue.Delete(first); err != nil {
+		t.Fatalf("failed to delete item: %v", err)
+	}
+	third, err := queue.AddWithOptions([]byte("third"), WithDedupKey("order-1"))
+	if err != nil || third == first {
+		t.Fatalf("expected a new item once the key was released, got %d, %v", third, err)
+	}
+}
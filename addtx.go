@@ -0,0 +1,61 @@
+package queue
+
+import "database/sql"
+
+// AddTx inserts a new item as part of tx, a transaction the application opened
+// on the queue's database, so the item exists if and only if tx commits. Open
+// the transaction on DB() or on another handle to the same SQLite file.
+//
+// Overflow policies cannot evict items or block inside the caller's
+// transaction, so AddTx returns ErrQueueFull whenever the limits are reached.
+// Listeners and ClaimWait pick the item up on their next poll after the
+// commit rather than right away. With a single pooled connection, tx holds
+// it, so no other method of the queue may be called before tx ends.
+func (c *Queue) AddTx(tx *sql.Tx, data []byte) error {
+	// The queue lock is not taken: a queue operation holding it could be
+	// waiting for the very connection tx is using.
+	if c.draining.Load() {
+		return ErrDraining
+	}
+	if err := c.validate(data); err != nil {
+		return err
+	}
+	p, err := c.preparePayload(data)
+	if err != nil {
+		return err
+	}
+	id, err := c.insertTx(tx, p)
+	if err != nil {
+		c.discardPayload(p)
+		return err
+	}
+	if err := c.queueMirror(tx, data, nil, addOptions{}); err != nil {
+		return err
+	}
+	if err := c.enforceTransition(tx, int(id), TransitionEnqueued, stateAbsent); err != nil {
+		return err
+	}
+	if err := c.snapshot(tx, int(id), TransitionEnqueued, nil); err != nil {
+		return err
+	}
+	return c.audit(tx, c.actor(), TransitionEnqueued, int(id))
+}
+
+// insertTx checks the limits and inserts the item row of AddTx along with the
+// parts of its payload stored elsewhere, returning its ID.
+func (c *Queue) insertTx(tx *sql.Tx, p storedPayload) (int64, error) {
+	if err := c.checkCapacity(tx, p.size()); err != nil {
+		return 0, err
+	}
+
+	res, err := tx.Exec("INSERT INTO "+c.tables.items+"(`data`, `tags`, `priority`, `checksum`, `key_id`) VALUES (?, ?, ?, ?, ?)", p.head, nil, 0, p.checksum, nullString(p.key))
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return id, c.storePayload(tx, id, p)
+}
@@ -0,0 +1,64 @@
+package queue
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestAddTx(t *testing.T) {
+	queue := setupQueue(t, Config{MaxItems: 1})
+	defer queue.Close()
+
+	db := queue.DB()
+	if _, err := db.Exec("CREATE TABLE orders (id INTEGER PRIMARY KEY)"); err != nil {
+		t.Fatalf("failed to create table: %v", err)
+	}
+
+	// A rolled back business transaction leaves no item behind.
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("failed to begin transaction: %v", err)
+	}
+	if _, err := tx.Exec("INSERT INTO orders (id) VALUES (1)"); err != nil {
+		t.Fatalf("failed to insert order: %v", err)
+	}
+	if err := queue.AddTx(tx, []byte("rolled back")); err != nil {
+		t.Fatalf("failed to add item: %v", err)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatalf("failed to roll back: %v", err)
+	}
+
+	items, err := queue.Get(10)
+	if err != nil {
+		t.Fatalf("failed to get items: %v", err)
+	}
+	if len(items) != 0 {
+		t.Fatalf("expected no items after rollback, got %d", len(items))
+	}
+
+	tx, err = db.Begin()
+	if err != nil {
+		t.Fatalf("failed to begin transaction: %v", err)
+	}
+	if _, err := tx.Exec("INSERT INTO orders (id) VALUES (2)"); err != nil {
+		t.Fatalf("failed to insert order: %v", err)
+	}
+	if err := queue.AddTx(tx, []byte("committed")); err != nil {
+		t.Fatalf("failed to add item: %v", err)
+	}
+	if err := queue.AddTx(tx, []byte("over the limit")); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("expected ErrQueueFull, got %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("failed to commit: %v", err)
+	}
+
+	items, err = queue.Get(10)
+	if err != nil {
+		t.Fatalf("failed to get items: %v", err)
+	}
+	if len(items) != 1 || string(items[0].Data) != "committed" {
+		t.Fatalf("unexpected items: %+v", items)
+	}
+}
@@ -0,0 +1,197 @@
+package queue
+
+import (
+	"context"
+	"database/sql"
+)
+
+// Admin groups operator-facing operations that inspect and edit the queue in
+// bulk or bypass the normal item lifecycle. It backs queuectl and queuedash.
+type Admin struct {
+	c     *Queue
+	actor string // Recorded in the audit log for the operations of this Admin.
+}
+
+// Admin returns the administrative interface of the queue. Its operations
+// are audited under Config.Actor; see As for naming another actor.
+func (c *Queue) Admin() *Admin {
+	return &Admin{c: c, actor: c.actor()}
+}
+
+// ListByState returns up to 'limit' items in the given state, oldest first,
+// starting after 'cursor'. Pass 0 for the first page and the returned cursor
+// for the following ones; the returned cursor is 0 after the last page.
+// StatePending lists the items that can be claimed now and StateScheduled
+// the ones hidden until a later time. The terminal states list nothing, as
+// done and failed items have left the queue.
+func (a *Admin) ListByState(state State, limit, cursor int) ([]Item, int, error) {
+	items, err := a.c.listByState(state, limit, cursor)
+	if err != nil || len(items) < limit {
+		return items, 0, err
+	}
+	return items, items[len(items)-1].ID, nil
+}
+
+// ResetAttempts sets the attempts counter of an item back to zero, giving it
+// a fresh set of attempts. It returns ErrItemNotFound if the item does not exist.
+func (a *Admin) ResetAttempts(id int) error {
+	return a.c.updateItem(id, a.actor, TransitionReset, "UPDATE "+a.c.tables.items+" SET attempts = 0 WHERE id = ?", id)
+}
+
+// Reprioritize changes the priority of an item. Items with a higher priority
+// are claimed first. It returns ErrItemNotFound if the item does not exist.
+func (a *Admin) Reprioritize(id, priority int) error {
+	return a.c.updateItem(id, a.actor, TransitionReprioritized, "UPDATE "+a.c.tables.items+" SET priority = ? WHERE id = ?", priority, id)
+}
+
+// RequeueAll moves every dead letter back to pending with its attempts reset
+// and returns the number of requeued items.
+func (a *Admin) RequeueAll() (int, error) {
+	c := a.c
+	c.mx.Lock() // Lock for exclusive access to the queue.
+	defer c.mx.Unlock()
+
+	requeued := 0
+	err := c.withTx(func(tx *sql.Tx) error {
+		ids, err := selectIDs(tx, "SELECT `id` FROM "+c.tables.items+" WHERE state = 'dead' ORDER BY id")
+		if err != nil {
+			return err
+		}
+
+		for _, id := range ids {
+			before, err := c.rowSnapshot(tx, id)
+			if err != nil {
+				return err
+			}
+			if _, err := c.execTransition(tx, id, TransitionRequeued, c.stmts.requeue, id); err != nil {
+				return err
+			}
+			if err := c.snapshot(tx, id, TransitionRequeued, before); err != nil {
+				return err
+			}
+			if err := c.audit(tx, a.actor, TransitionRequeued, id); err != nil {
+				return err
+			}
+		}
+		requeued = len(ids)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if requeued > 0 {
+		c.signalAdded()
+	}
+	return requeued, nil
+}
+
+// ReplayDeadLetters moves the dead letters matching filter back to pending;
+// see Queue.ReplayDeadLetters.
+func (a *Admin) ReplayDeadLetters(ctx context.Context, filter ReplayFilter, opts ReplayOptions) (int, error) {
+	return a.c.replay(ctx, a.actor, filter, opts)
+}
+
+// DeleteWhere deletes every item match reports true for and returns the
+// number of deleted items. All items, including in-flight ones and dead
+// letters, are passed to match.
+func (a *Admin) DeleteWhere(match func(item Item) bool) (int, error) {
+	c := a.c
+	c.mx.Lock() // Lock for exclusive access to the queue.
+	defer c.mx.Unlock()
+
+	deleted := 0
+	err := c.withTx(func(tx *sql.Tx) error {
+		// Collect the matches and close the rows before deleting, as the pool
+		// may only have a single connection.
+		ids, err := matchingIDs(tx, "SELECT "+itemColumns+" FROM "+c.tables.items+" ORDER BY id", match)
+		if err != nil {
+			return err
+		}
+
+		for _, id := range ids {
+			before, err := c.rowSnapshot(tx, id)
+			if err != nil {
+				return err
+			}
+			if _, err := c.execTransition(tx, id, TransitionDeleted, c.stmts.delete, id); err != nil {
+				return err
+			}
+			if err := c.snapshot(tx, id, TransitionDeleted, before); err != nil {
+				return err
+			}
+			if err := c.audit(tx, a.actor, TransitionDeleted, id); err != nil {
+				return err
+			}
+		}
+		deleted = len(ids)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if deleted > 0 {
+		c.signalFreed()
+	}
+	return deleted, nil
+}
+
+// matchingIDs returns the IDs of the items selected by query that match reports true for.
+func matchingIDs(tx *sql.Tx, query string, match func(item Item) bool) ([]int, error) {
+	rows, err := tx.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close() // Ensure rows are closed after processing.
+
+	var ids []int
+	for rows.Next() {
+		item, err := scanItem(rows)
+		if err != nil {
+			return nil, err
+		}
+		if match(item) {
+			ids = append(ids, item.ID)
+		}
+	}
+	return ids, rows.Err()
+}
+
+// updateItem runs an UPDATE of a single item, records the transition in debug
+// mode and audits it under actor. It returns ErrItemNotFound if no row was
+// updated.
+func (c *Queue) updateItem(id int, actor, transition, query string, args ...any) error {
+	c.mx.Lock() // Lock for exclusive access to the queue.
+	defer c.mx.Unlock()
+
+	return c.withTx(func(tx *sql.Tx) error {
+		before, err := c.rowSnapshot(tx, id)
+		if err != nil {
+			return err
+		}
+		from, err := c.itemState(tx, id)
+		if err != nil {
+			return err
+		}
+
+		res, err := tx.Exec(query, args...)
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return ErrItemNotFound
+		}
+		if err := c.enforceTransition(tx, id, transition, from); err != nil {
+			return err
+		}
+		if err := c.snapshot(tx, id, transition, before); err != nil {
+			return err
+		}
+		return c.audit(tx, actor, transition, id)
+	})
+}
@@ -0,0 +1,134 @@
+package queue
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestAdminReprioritize(t *testing.T) {
+	queue := setupQueue(t, Config{})
+	defer queue.Close()
+
+	for i := 0; i < 3; i++ {
+		if err := queue.Add([]byte("test data")); err != nil {
+			t.Fatalf("failed to add item to queue: %v", err)
+		}
+	}
+
+	if err := queue.Admin().Reprioritize(3, 10); err != nil {
+		t.Fatalf("failed to reprioritize item: %v", err)
+	}
+	if err := queue.Admin().Reprioritize(42, 10); !errors.Is(err, ErrItemNotFound) {
+		t.Fatalf("expected ErrItemNotFound, got %v", err)
+	}
+
+	items, err := queue.Claim(3)
+	if err != nil {
+		t.Fatalf("failed to claim items: %v", err)
+	}
+	var ids []int
+	for _, item := range items {
+		ids = append(ids, item.ID)
+	}
+	if !slices.Equal(ids, []int{3, 1, 2}) {
+		t.Fatalf("expected the reprioritized item first, got %v", ids)
+	}
+}
+
+func TestAdminRequeueAll(t *testing.T) {
+	queue := setupQueue(t, Config{MaxAttempts: 1})
+	defer queue.Close()
+
+	for i := 0; i < 2; i++ {
+		if err := queue.Add([]byte("test data")); err != nil {
+			t.Fatalf("failed to add item to queue: %v", err)
+		}
+	}
+
+	// Use up the single attempt, then let the next claim dead-letter the items.
+	items, err := queue.Claim(2)
+	if err != nil {
+		t.Fatalf("failed to claim items: %v", err)
+	}
+	for _, item := range items {
+		if err := queue.Release(item.ID); err != nil {
+			t.Fatalf("failed to release item: %v", err)
+		}
+	}
+	if _, err := queue.Claim(2); err != nil {
+		t.Fatalf("failed to claim items: %v", err)
+	}
+
+	dead, _, err := queue.Admin().ListByState(StateDead, 10, 0)
+	if err != nil || len(dead) != 2 {
+		t.Fatalf("expected 2 dead letters, got %d (err %v)", len(dead), err)
+	}
+
+	requeued, err := queue.Admin().RequeueAll()
+	if err != nil {
+		t.Fatalf("failed to requeue dead letters: %v", err)
+	}
+	if requeued != 2 {
+		t.Fatalf("expected 2 requeued items, got %d", requeued)
+	}
+
+	pending, _, err := queue.Admin().ListByState(StatePending, 10, 0)
+	if err != nil || len(pending) != 2 || pending[0].Attempts != 0 {
+		t.Fatalf("expected 2 fresh pending items, got %+v (err %v)", pending, err)
+	}
+}
+
+func TestAdminResetAttempts(t *testing.T) {
+	queue := setupQueue(t, Config{})
+	defer queue.Close()
+
+	if err := queue.Add([]byte("test data")); err != nil {
+		t.Fatalf("failed to add item to queue: %v", err)
+	}
+	items, err := queue.Claim(1)
+	if err != nil || len(items) != 1 {
+		t.Fatalf("failed to claim item: %v", err)
+	}
+
+	if err := queue.Admin().ResetAttempts(items[0].ID); err != nil {
+		t.Fatalf("failed to reset attempts: %v", err)
+	}
+
+	items, err = queue.Get(1)
+	if err != nil {
+		t.Fatalf("failed to get item: %v", err)
+	}
+	if items[0].Attempts != 0 {
+		t.Fatalf("expected attempts to be reset, got %d", items[0].Attempts)
+	}
+}
+
+func TestAdminDeleteWhere(t *testing.T) {
+	queue := setupQueue(t, Config{})
+	defer queue.Close()
+
+	for _, tag := range []string{"keep", "drop", "drop"} {
+		if err := queue.AddTagged([]byte("test data"), tag); err != nil {
+			t.Fatalf("failed to add item to queue: %v", err)
+		}
+	}
+
+	deleted, err := queue.Admin().DeleteWhere(func(item Item) bool {
+		return HasTag("drop")(item.Tags)
+	})
+	if err != nil {
+		t.Fatalf("failed to delete items: %v", err)
+	}
+	if deleted != 2 {
+		t.Fatalf("expected 2 deleted items, got %d", deleted)
+	}
+
+	items, err := queue.Get(10)
+	if err != nil {
+		t.Fatalf("failed to get items: %v", err)
+	}
+	if len(items) != 1 || items[0].Tags[0] != "keep" {
+		t.Fatalf("unexpected remaining items: %+v", items)
+	}
+}
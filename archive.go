@@ -0,0 +1,102 @@
+package queue
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Archive hands up to 'limit' dead letters that were dead-lettered before
+// 'before' to store, oldest first, and deletes them once store returns nil.
+// It returns the number of deleted items. Dead letters written before the
+// dead_at column existed have no timestamp and count as old.
+//
+// The queue is not locked while store runs, so slow uploads do not hold up
+// producers and consumers. Items requeued in the meantime stay in the queue
+// even though store already saw them.
+func (c *Queue) Archive(ctx context.Context, before time.Time, limit int, store func(ctx context.Context, records []Record) error) (int, error) {
+	rows, err := c.db.QueryContext(
+		ctx,
+		"SELECT "+itemColumns+", `visible_at`, `dedup_key` FROM "+c.tables.items+" WHERE state = 'dead' AND COALESCE(dead_at, 0) < ? ORDER BY id LIMIT ?",
+		before.UnixNano(), limit,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	var items []Item
+	var visibleAt []sql.NullInt64
+	var dedupKeys []sql.NullString
+	for rows.Next() {
+		var at sql.NullInt64
+		var key sql.NullString
+		item, err := scanItem(rows, &at, &key)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		items = append(items, item)
+		visibleAt = append(visibleAt, at)
+		dedupKeys = append(dedupKeys, key)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil || len(items) == 0 {
+		return 0, err
+	}
+	for i := range items {
+		if err := c.loadPayload(c.db, &items[i]); err != nil {
+			return 0, err
+		}
+	}
+
+	records := make([]Record, 0, len(items))
+	for i, item := range items {
+		records = append(records, newRecord(item, visibleAt[i], dedupKeys[i]))
+	}
+
+	if err := store(ctx, records); err != nil {
+		return 0, err
+	}
+
+	c.mx.Lock() // Lock for exclusive access to the queue.
+	defer c.mx.Unlock()
+
+	archived := 0
+	err = c.withTx(func(tx *sql.Tx) error {
+		for _, r := range records {
+			before, err := c.rowSnapshot(tx, r.ID)
+			if err != nil {
+				return err
+			}
+			from, err := c.itemState(tx, r.ID)
+			if err != nil {
+				return err
+			}
+
+			res, err := tx.Exec("DELETE FROM "+c.tables.items+" WHERE id = ? AND state = 'dead'", r.ID)
+			if err != nil {
+				return err
+			}
+			n, err := res.RowsAffected()
+			if err != nil {
+				return err
+			}
+			if n == 0 {
+				continue // Requeued while the archive was written.
+			}
+			if err := c.enforceTransition(tx, r.ID, TransitionArchived, from); err != nil {
+				return err
+			}
+
+			if err := c.snapshot(tx, r.ID, TransitionArchived, before); err != nil {
+				return err
+			}
+			archived++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return archived, nil
+}
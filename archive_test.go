@@ -0,0 +1,65 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestArchive(t *testing.T) {
+	queue := setupQueue(t, Config{MaxAttempts: 1, LeaseTimeout: time.Millisecond})
+	defer queue.Close()
+
+	for _, data := range []string{"first", "second"} {
+		if err := queue.Add([]byte(data)); err != nil {
+			t.Fatalf("failed to add item to queue: %v", err)
+		}
+	}
+
+	// Claim both items, let the leases expire and claim again to dead-letter them.
+	if _, err := queue.Claim(2); err != nil {
+		t.Fatalf("failed to claim items: %v", err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if _, err := queue.Claim(2); err != nil {
+		t.Fatalf("failed to claim items: %v", err)
+	}
+
+	ctx := context.Background()
+	var stored []Record
+	store := func(ctx context.Context, records []Record) error {
+		stored = append(stored, records...)
+		return nil
+	}
+
+	archived, err := queue.Archive(ctx, time.Now().Add(-time.Hour), 10, store)
+	if err != nil {
+		t.Fatalf("failed to archive: %v", err)
+	}
+	if archived != 0 || len(stored) != 0 {
+		t.Fatalf("expected recent dead letters to stay, archived %d", archived)
+	}
+
+	failure := errors.New("upload failed")
+	_, err = queue.Archive(ctx, time.Now().Add(time.Second), 10, func(context.Context, []Record) error { return failure })
+	if !errors.Is(err, failure) {
+		t.Fatalf("expected the store error, got %v", err)
+	}
+
+	archived, err = queue.Archive(ctx, time.Now().Add(time.Second), 1, store)
+	if err != nil {
+		t.Fatalf("failed to archive: %v", err)
+	}
+	if archived != 1 || len(stored) != 1 || string(stored[0].Data) != "first" || stored[0].State != StateDead {
+		t.Fatalf("unexpected archive: %d, %+v", archived, stored)
+	}
+
+	stats, err := queue.Stats()
+	if err != nil {
+		t.Fatalf("failed to read stats: %v", err)
+	}
+	if stats.Dead != 1 {
+		t.Fatalf("expected one dead letter left, got %+v", stats)
+	}
+}
@@ -0,0 +1,138 @@
+package queue
+
+import (
+	"database/sql"
+	"time"
+)
+
+// AuditEntry records an operation performed on an item; see Config.Audit.
+type AuditEntry struct {
+	Seq       int64     // Position in the audit log.
+	ItemID    int       // Item the operation was performed on.
+	Operation string    // Transition caused by the operation, e.g. TransitionDeleted.
+	Actor     string    // Who performed the operation; see Config.Actor and Admin.As.
+	At        time.Time // When the operation was performed.
+}
+
+// AuditFilter selects entries of the audit log. Zero fields match everything.
+type AuditFilter struct {
+	ItemID int       // Only entries of this item.
+	Actor  string    // Only entries of this actor.
+	Since  time.Time // Only entries recorded at or after this time.
+	Limit  int       // Maximum number of entries returned; 0 means 100.
+}
+
+// createAuditTable creates the audit log. Triggers reject updates and
+// deletes, so entries cannot be altered through SQL once written.
+func createAuditTable(tx *sql.Tx, t tables) error {
+	_, err := tx.Exec(`
+        CREATE TABLE IF NOT EXISTS ` + t.audit + ` (
+            seq INTEGER PRIMARY KEY AUTOINCREMENT,
+            item_id INTEGER NOT NULL,
+            operation TEXT NOT NULL,
+            actor TEXT NOT NULL,
+            at INTEGER NOT NULL
+        );
+        CREATE INDEX IF NOT EXISTS ` + t.audit + `_item ON ` + t.audit + ` (item_id);
+        CREATE TRIGGER IF NOT EXISTS ` + t.audit + `_no_update BEFORE UPDATE ON ` + t.audit + ` BEGIN
+            SELECT RAISE(ABORT, 'queue: the audit log is append-only');
+        END;
+        CREATE TRIGGER IF NOT EXISTS ` + t.audit + `_no_delete BEFORE DELETE ON ` + t.audit + ` BEGIN
+            SELECT RAISE(ABORT, 'queue: the audit log is append-only');
+        END;
+    `)
+	return err
+}
+
+// actor returns the actor recorded for operations of this instance.
+func (c *Queue) actor() string {
+	if c.cfg.Actor != "" {
+		return c.cfg.Actor
+	}
+	return c.owner
+}
+
+// audit appends an entry to the audit log in the transaction performing the
+// operation. It does nothing unless Config.Audit is set, or for operations
+// without an actor, such as listeners processing items.
+func (c *Queue) audit(tx *sql.Tx, actor, operation string, id int) error {
+	if !c.cfg.Audit || actor == "" {
+		return nil
+	}
+
+	_, err := tx.Exec(
+		"INSERT INTO "+c.tables.audit+"(`item_id`, `operation`, `actor`, `at`) VALUES (?, ?, ?, ?)",
+		id, operation, actor, c.cfg.Clock.Now().UnixNano(),
+	)
+	return err
+}
+
+// As returns an Admin recording actor in the audit log for the operations
+// performed through it, e.g. the name of the operator behind a dashboard.
+func (a *Admin) As(actor string) *Admin {
+	return &Admin{c: a.c, actor: actor}
+}
+
+// AuditLog returns the entries of the audit log matching the filter, oldest
+// first. The log is empty unless Config.Audit is set.
+func (a *Admin) AuditLog(filter AuditFilter) ([]AuditEntry, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = 100
+	}
+
+	query := "SELECT `seq`, `item_id`, `operation`, `actor`, `at` FROM " + a.c.tables.audit + " WHERE at >= ?"
+	args := []any{filter.Since.UnixNano()}
+	if filter.Since.IsZero() {
+		args[0] = 0
+	}
+	if filter.ItemID != 0 {
+		query += " AND item_id = ?"
+		args = append(args, filter.ItemID)
+	}
+	if filter.Actor != "" {
+		query += " AND actor = ?"
+		args = append(args, filter.Actor)
+	}
+	query += " ORDER BY seq LIMIT ?"
+	args = append(args, filter.Limit)
+
+	rows, err := a.c.db.QueryContext(a.c.ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close() // Ensure rows are closed after processing.
+
+	var entries []AuditEntry
+	for rows.Next() {
+		var entry AuditEntry
+		var at int64
+		if err := rows.Scan(&entry.Seq, &entry.ItemID, &entry.Operation, &entry.Actor, &at); err != nil {
+			return nil, err
+		}
+		entry.At = time.Unix(0, at)
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// Delete removes an item like Queue.Delete, recording the actor of a.
+func (a *Admin) Delete(id int) error {
+	return a.c.remove(id, AnyVersion, TransitionDeleted, a.actor)
+}
+
+// DeleteVersion removes an item like Queue.DeleteVersion, recording the
+// actor of a.
+func (a *Admin) DeleteVersion(id int, version int64) error {
+	return a.c.remove(id, version, TransitionDeleted, a.actor)
+}
+
+// Requeue moves a dead letter back to pending like Queue.Requeue, recording
+// the actor of a.
+func (a *Admin) Requeue(id int) error {
+	return a.c.requeue(id, a.actor)
+}
+
+// Purge deletes items like Queue.Purge, recording the actor of a.
+func (a *Admin) Purge(states ...State) (int, error) {
+	return a.c.purge(a.actor, states)
+}
@@ -0,0 +1,74 @@
+package queue
+
+import (
+	"testing"
+)
+
+func TestAuditLog(t *testing.T) {
+	queue := setupQueue(t, Config{Audit: true, Actor: "producer"})
+	defer queue.Close()
+
+	for _, data := range []string{"a", "b", "c"} {
+		if err := queue.Add([]byte(data)); err != nil {
+			t.Fatalf("failed to add item to queue: %v", err)
+		}
+	}
+	if err := queue.Delete(1); err != nil {
+		t.Fatalf("failed to delete item: %v", err)
+	}
+
+	admin := queue.Admin().As("alice")
+	if err := admin.Reprioritize(2, 5); err != nil {
+		t.Fatalf("failed to reprioritize item: %v", err)
+	}
+	if _, err := admin.Purge(); err != nil {
+		t.Fatalf("failed to purge queue: %v", err)
+	}
+
+	entries, err := queue.Admin().AuditLog(AuditFilter{})
+	if err != nil {
+		t.Fatalf("failed to read audit log: %v", err)
+	}
+	expected := []struct {
+		id        int
+		operation string
+		actor     string
+	}{
+		{1, TransitionEnqueued, "producer"},
+		{2, TransitionEnqueued, "producer"},
+		{3, TransitionEnqueued, "producer"},
+		{1, TransitionDeleted, "producer"},
+		{2, TransitionReprioritized, "alice"},
+		{2, TransitionDeleted, "alice"},
+		{3, TransitionDeleted, "alice"},
+	}
+	if len(entries) != len(expected) {
+		t.Fatalf("expected %d entries, got %+v", len(expected), entries)
+	}
+	for i, e := range expected {
+		if entries[i].ItemID != e.id || entries[i].Operation != e.operation || entries[i].Actor != e.actor {
+			t.Fatalf("unexpected entry %d: %+v, expected %+v", i, entries[i], e)
+		}
+	}
+
+	byAlice, _ := queue.Admin().AuditLog(AuditFilter{Actor: "alice", ItemID: 2})
+	if len(byAlice) != 2 {
+		t.Fatalf("expected two entries of alice for item 2, got %+v", byAlice)
+	}
+
+	if _, err := queue.db.Exec("DELETE FROM " + queue.tables.audit); err == nil {
+		t.Fatalf("expected the audit log to reject deletes")
+	}
+}
+
+func TestAuditLogDisabled(t *testing.T) {
+	queue := setupQueue(t, Config{})
+	defer queue.Close()
+
+	if err := queue.Add([]byte("a")); err != nil {
+		t.Fatalf("failed to add item to queue: %v", err)
+	}
+	if entries, err := queue.Admin().AuditLog(AuditFilter{}); err != nil || len(entries) != 0 {
+		t.Fatalf("expected an empty audit log, got %+v, %v", entries, err)
+	}
+}
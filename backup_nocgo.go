@@ -0,0 +1,16 @@
+//go:build !cgo
+
+package queue
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+// copyDatabase needs SQLite's online backup API, which the driver only offers
+// when built with CGO. Without it the package still compiles, so pure-Go
+// backends such as queuebolt can import its types.
+func copyDatabase(ctx context.Context, dest, src *sql.DB) error {
+	return errors.New("queue: backup requires a build with CGO enabled")
+}
@@ -0,0 +1,73 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestBackupAndRestore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "backup.db")
+
+	source := setupQueue(t, Config{})
+	defer source.Close()
+
+	for _, data := range []string{"first", "second"} {
+		if err := source.Add([]byte(data)); err != nil {
+			t.Fatalf("failed to add item to queue: %v", err)
+		}
+	}
+
+	if err := source.Backup(context.Background(), path); err != nil {
+		t.Fatalf("failed to back up queue: %v", err)
+	}
+
+	target := setupQueue(t, Config{})
+	defer target.Close()
+
+	if err := target.Add([]byte("replaced")); err != nil {
+		t.Fatalf("failed to add item to queue: %v", err)
+	}
+
+	if err := target.Restore(context.Background(), path); err != nil {
+		t.Fatalf("failed to restore queue: %v", err)
+	}
+
+	items, err := target.Get(10)
+	if err != nil {
+		t.Fatalf("failed to get items from queue: %v", err)
+	}
+	if len(items) != 2 || string(items[0].Data) != "first" || string(items[1].Data) != "second" {
+		t.Fatalf("unexpected items after restore: %+v", items)
+	}
+}
+
+func TestRestoreSharedDatabase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "backup.db")
+
+	manager, err := NewManager(Config{})
+	if err != nil {
+		t.Fatalf("failed to initialize manager: %v", err)
+	}
+	defer manager.Close()
+
+	emails, err := manager.Queue("emails")
+	if err != nil {
+		t.Fatalf("failed to open queue: %v", err)
+	}
+	reports, err := manager.Queue("reports")
+	if err != nil {
+		t.Fatalf("failed to open queue: %v", err)
+	}
+	if err := reports.Add([]byte("report")); err != nil {
+		t.Fatalf("failed to add item to queue: %v", err)
+	}
+	if err := emails.Backup(context.Background(), path); err != nil {
+		t.Fatalf("failed to back up queue: %v", err)
+	}
+
+	if err := emails.Restore(context.Background(), path); !errors.Is(err, ErrSharedDatabase) {
+		t.Fatalf("expected ErrSharedDatabase, got %v", err)
+	}
+}
@@ -0,0 +1,208 @@
+package queue
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// BatchHandler processes a batch of items. Returning nil acknowledges every
+// item, a *BatchError acknowledges all but the failed ones, and any other
+// error delivers the whole batch again.
+type BatchHandler func(items []Item) error
+
+// BatchError is returned by a BatchHandler that processed only part of a
+// batch. The failed items are delivered again and the rest are acknowledged.
+type BatchError struct {
+	Failed []int // IDs of the items that failed.
+	Err    error // Cause of the failures.
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("queue: %d items of the batch failed: %v", len(e.Failed), e.Err)
+}
+
+func (e *BatchError) Unwrap() error {
+	return e.Err
+}
+
+// batchListener is the callback registered with BatchListener.
+type batchListener struct {
+	size int
+	clb  BatchHandler
+}
+
+// BatchListener registers a callback that receives up to 'size' items at once,
+// for handlers writing to batch-friendly downstreams such as bulk inserts.
+// It takes the place of Listener: tag listeners still receive the items they
+// match one by one. Failed items are delivered again after
+// Config.BatchRetryDelay. Handle middleware does not apply to batches; Then,
+// SetResult and SetError work as in a single-item callback.
+func (c *Queue) BatchListener(size int, clb BatchHandler) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	c.batch = &batchListener{size: max(size, 1), clb: clb}
+	c.signalRegistered()
+}
+
+// dispatchBatch hands the claimed items to the batch listener, except those
+// a tag listener accepts, which are dispatched one by one.
+func (c *Queue) dispatchBatch(batch *batchListener, items []Item) {
+	var rest []Item
+	for _, item := range items {
+		c.mx.Lock()
+		single := c.route(item) != nil
+		c.mx.Unlock()
+
+		if single {
+			c.dispatch(item)
+		} else {
+			rest = append(rest, item)
+		}
+	}
+	if len(rest) == 0 {
+		return
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			c.mx.Lock()
+			for _, item := range rest {
+				delete(c.completions, item.ID) // The failed attempt must not commit what it recorded.
+			}
+			c.mx.Unlock()
+			for _, item := range rest {
+				c.abandon(item, r) // Let the items be delivered again after the loop restarts.
+			}
+			panic(r)
+		}
+	}()
+
+	start := c.cfg.Clock.Now()
+	err := batch.clb(rest)
+	c.observeProcessing(c.cfg.Clock.Now().Sub(start))
+
+	failed := make(map[int]bool)
+	var partial *BatchError
+	switch {
+	case errors.As(err, &partial):
+		for _, id := range partial.Failed {
+			failed[id] = true
+		}
+	case err != nil:
+		for _, item := range rest {
+			failed[item.ID] = true
+		}
+	}
+
+	if c.cfg.Delivery == AtMostOnce {
+		// The items were removed when they were claimed, whatever the outcome.
+		c.mx.Lock()
+		for _, item := range rest {
+			delete(c.completions, item.ID)
+		}
+		c.mx.Unlock()
+		if len(failed) > 0 {
+			c.cfg.Logger.Println("Batch processing failed, dropping items delivered at most once:", err)
+		}
+		c.count(MetricAcked, len(rest)-len(failed))
+		return
+	}
+
+	c.mx.Lock()
+	done := make(map[int]*completion, len(rest))
+	for _, item := range rest {
+		if !failed[item.ID] && (c.completions[item.ID] != nil || c.awaited[item.ID]) {
+			done[item.ID] = c.completions[item.ID]
+		}
+		delete(c.completions, item.ID)
+	}
+	c.mx.Unlock()
+
+	// Acknowledge the processed items before waiting to retry the failed ones.
+	var plain, retry []Item
+	for _, item := range rest {
+		switch d, ok := done[item.ID]; {
+		case failed[item.ID]:
+			retry = append(retry, item)
+		case ok:
+			if d == nil {
+				d = &completion{}
+			}
+			if err := c.ackWith(item.ID, *d); err != nil {
+				c.cfg.Logger.Println("Error acknowledging item:", err)
+			}
+		default:
+			plain = append(plain, item)
+		}
+	}
+	if err := c.ackBatch(plain); err != nil {
+		c.cfg.Logger.Println("Error acknowledging batch:", err)
+	}
+
+	if len(retry) == 0 {
+		return
+	}
+	c.cfg.Logger.Println("Batch processing failed:", err)
+	// Retry the batch at one time, so it is delivered together again.
+	now, retried := c.cfg.Clock.Now(), 0
+	for _, item := range retry {
+		delay := c.cfg.BatchRetryDelay
+		if c.cfg.RetryPolicy != nil {
+			var giveUp bool
+			if delay, giveUp = c.cfg.RetryPolicy.NextDelay(item.Attempts, err); giveUp {
+				c.giveUp(item)
+				continue
+			}
+		}
+		c.cfg.Hooks.failure(item, delay)
+		c.retryAt(item, now.Add(delay))
+		retried++
+	}
+	c.count(MetricRetried, retried)
+}
+
+// ackBatch acknowledges the deliveries of items claimed by this queue
+// instance in a single transaction. Items no longer held by this instance,
+// or claimed again since, are skipped.
+func (c *Queue) ackBatch(items []Item) error {
+	if len(items) == 0 {
+		return nil
+	}
+
+	c.mx.Lock() // Lock for exclusive access to the queue.
+	defer c.mx.Unlock()
+
+	acked := 0
+	err := c.withTx(func(tx *sql.Tx) error {
+		for _, item := range items {
+			id := item.ID
+			before, err := c.rowSnapshot(tx, id)
+			if err != nil {
+				return err
+			}
+
+			if err := c.recordHistory(tx, id, deliveryNonce(item)); err != nil {
+				return err
+			}
+			ok, err := c.execTransition(tx, id, TransitionAcked, c.stmts.ack, id, c.owner, deliveryNonce(item))
+			if err != nil {
+				return err
+			}
+			if !ok {
+				continue // The lease expired and another consumer took the item over.
+			}
+			if err := c.snapshot(tx, id, TransitionAcked, before); err != nil {
+				return err
+			}
+			acked++
+		}
+		c.signalFreed()
+		return nil
+	})
+	if err == nil {
+		c.count(MetricAcked, acked)
+	}
+	return err
+}
@@ -0,0 +1,141 @@
+package queue
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBatchListener(t *testing.T) {
+	queue := setupQueue(t, Config{})
+	defer queue.Close()
+
+	for _, data := range []string{"a", "b", "c", "d", "e"} {
+		if err := queue.Add([]byte(data)); err != nil {
+			t.Fatalf("failed to add item to queue: %v", err)
+		}
+	}
+
+	batches := make(chan []Item, 10)
+	queue.BatchListener(3, func(items []Item) error {
+		batches <- items
+		return nil
+	})
+
+	var got []string
+	for len(got) < 5 {
+		select {
+		case items := <-batches:
+			if len(items) > 3 {
+				t.Fatalf("expected at most 3 items per batch, got %d", len(items))
+			}
+			for _, item := range items {
+				got = append(got, string(item.Data))
+			}
+		case <-time.After(3 * time.Second):
+			t.Fatalf("timed out waiting for batches, got %v", got)
+		}
+	}
+	if got[0] != "a" || got[4] != "e" {
+		t.Fatalf("expected FIFO order, got %v", got)
+	}
+
+	waitForStats(t, queue, func(s Stats) bool { return s.Pending == 0 && s.InFlight == 0 })
+}
+
+func TestBatchListenerPartialFailure(t *testing.T) {
+	queue := setupQueue(t, Config{BatchRetryDelay: 10 * time.Millisecond})
+	defer queue.Close()
+
+	for _, data := range []string{"ok", "fail"} {
+		if err := queue.Add([]byte(data)); err != nil {
+			t.Fatalf("failed to add item to queue: %v", err)
+		}
+	}
+
+	deliveries := make(chan string, 10)
+	failures := 0
+	queue.BatchListener(10, func(items []Item) error {
+		var failed []int
+		for _, item := range items {
+			deliveries <- string(item.Data)
+			if string(item.Data) == "fail" && failures == 0 {
+				failures++
+				failed = append(failed, item.ID)
+			}
+		}
+		if len(failed) > 0 {
+			return &BatchError{Failed: failed, Err: errors.New("downstream rejected")}
+		}
+		return nil
+	})
+
+	var got []string
+	for len(got) < 3 {
+		select {
+		case data := <-deliveries:
+			got = append(got, data)
+		case <-time.After(3 * time.Second):
+			t.Fatalf("timed out waiting for deliveries, got %v", got)
+		}
+	}
+	if got[0] != "ok" || got[1] != "fail" || got[2] != "fail" {
+		t.Fatalf("expected only the failed item to be delivered again, got %v", got)
+	}
+
+	waitForStats(t, queue, func(s Stats) bool { return s.Pending == 0 && s.InFlight == 0 })
+}
+
+func TestBatchListenerFailure(t *testing.T) {
+	queue := setupQueue(t, Config{BatchRetryDelay: 10 * time.Millisecond})
+	defer queue.Close()
+
+	for _, data := range []string{"a", "b"} {
+		if err := queue.Add([]byte(data)); err != nil {
+			t.Fatalf("failed to add item to queue: %v", err)
+		}
+	}
+
+	sizes := make(chan int, 10)
+	calls := 0
+	queue.BatchListener(10, func(items []Item) error {
+		sizes <- len(items)
+		calls++
+		if calls == 1 {
+			return errors.New("downstream unavailable")
+		}
+		return nil
+	})
+
+	for i := 0; i < 2; i++ {
+		select {
+		case n := <-sizes:
+			if n != 2 {
+				t.Fatalf("expected the whole batch to be delivered, got %d items", n)
+			}
+		case <-time.After(3 * time.Second):
+			t.Fatalf("timed out waiting for batch %d", i+1)
+		}
+	}
+
+	waitForStats(t, queue, func(s Stats) bool { return s.Pending == 0 && s.InFlight == 0 })
+}
+
+// waitForStats polls the queue stats until ready reports true.
+func waitForStats(t *testing.T, queue *Queue, ready func(s Stats) bool) {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		stats, err := queue.Stats()
+		if err != nil {
+			t.Fatalf("failed to read stats: %v", err)
+		}
+		if ready(stats) {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for stats, got %+v", stats)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,147 @@
+//go:build cgo && sqlite_blob_io
+
+// Incremental blob I/O is opt-in, as the driver does not expose it: this file
+// reaches the handle of its connections through an unexported field, checked
+// on first use so a driver that changed it fails with a clear error instead of
+// crashing. Build with -tags sqlite_blob_io to use it.
+
+package queue
+
+/*
+#include <stdlib.h>
+
+typedef struct sqlite3 sqlite3;
+typedef struct sqlite3_blob sqlite3_blob;
+
+int sqlite3_blob_open(sqlite3*, const char*, const char*, const char*, long long, int, sqlite3_blob**);
+int sqlite3_blob_read(sqlite3_blob*, void*, int, int);
+int sqlite3_blob_write(sqlite3_blob*, const void*, int, int);
+int sqlite3_blob_close(sqlite3_blob*);
+const char *sqlite3_errmsg(sqlite3*);
+int sqlite3_extended_errcode(sqlite3*);
+*/
+import "C"
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"unsafe"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// blobIOSupported reports that withBlob is available, so AddFrom and
+// OpenPayload stream payloads through blob handles.
+const blobIOSupported = true
+
+// withBlob opens the blob in column of the row rowid of table through
+// SQLite's incremental blob I/O, on the connection of conn, and calls fn with
+// it. The blob can be written if write is set; its size is fixed when the
+// row is written. It returns ErrItemNotFound if there is no such row.
+func withBlob(conn *sql.Conn, table, column string, rowid int64, write bool, fn func(b blobIO) error) error {
+	return conn.Raw(func(driverConn any) error {
+		db, err := sqliteHandle(driverConn)
+		if err != nil {
+			return err
+		}
+
+		cMain, cTable, cColumn := C.CString("main"), C.CString(table), C.CString(column)
+		defer C.free(unsafe.Pointer(cMain))
+		defer C.free(unsafe.Pointer(cTable))
+		defer C.free(unsafe.Pointer(cColumn))
+
+		flags := C.int(0)
+		if write {
+			flags = 1
+		}
+		var handle *C.sqlite3_blob
+		if rc := C.sqlite3_blob_open(db, cMain, cTable, cColumn, C.longlong(rowid), flags, &handle); rc != 0 {
+			err := sqliteError(db, rc)
+			missing := strings.HasPrefix(C.GoString(C.sqlite3_errmsg(db)), "no such rowid")
+			if handle != nil {
+				C.sqlite3_blob_close(handle)
+			}
+			if missing {
+				return ErrItemNotFound
+			}
+			return err
+		}
+
+		b := &blob{db: db, handle: handle}
+		err = fn(b)
+		if rc := C.sqlite3_blob_close(handle); rc != 0 && err == nil {
+			err = sqliteError(db, rc)
+		}
+		return err
+	})
+}
+
+// handleField is the unexported field of sqlite3.SQLiteConn holding the
+// database handle.
+const handleField = "db"
+
+// checkHandleField verifies once that the driver still keeps the database
+// handle in handleField.
+var checkHandleField = sync.OnceValue(func() error {
+	// Each package has its own Go type for the C struct, so compare names.
+	want := reflect.TypeOf((*C.sqlite3)(nil)).Elem().Name()
+	field, ok := reflect.TypeOf(sqlite3.SQLiteConn{}).FieldByName(handleField)
+	if !ok || field.Type.Kind() != reflect.Pointer || field.Type.Elem().Name() != want {
+		return fmt.Errorf("queue: sqlite3.SQLiteConn has no %s field pointing to a %s; this driver version does not support the sqlite_blob_io build tag", handleField, want)
+	}
+	return nil
+})
+
+// sqliteHandle returns the database handle of a connection of the driver,
+// which does not expose incremental blob I/O itself.
+func sqliteHandle(driverConn any) (*C.sqlite3, error) {
+	if err := checkHandleField(); err != nil {
+		return nil, err
+	}
+	conn, ok := driverConn.(*sqlite3.SQLiteConn)
+	if !ok {
+		return nil, fmt.Errorf("queue: unexpected driver %T", driverConn)
+	}
+	field := reflect.ValueOf(conn).Elem().FieldByName(handleField)
+	if field.IsNil() {
+		return nil, errors.New("queue: connection of the driver is closed")
+	}
+	return (*C.sqlite3)(field.UnsafePointer()), nil
+}
+
+// sqliteError describes the failure of a call on db, wrapping a
+// sqlite3.Error with its result code.
+func sqliteError(db *C.sqlite3, rc C.int) error {
+	err := sqlite3.Error{Code: sqlite3.ErrNo(rc & 0xff), ExtendedCode: sqlite3.ErrNoExtended(C.sqlite3_extended_errcode(db))}
+	return fmt.Errorf("queue: %s: %w", C.GoString(C.sqlite3_errmsg(db)), err)
+}
+
+// blob is an open blob handle.
+type blob struct {
+	db     *C.sqlite3
+	handle *C.sqlite3_blob
+}
+
+func (b *blob) ReadAt(p []byte, off int64) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if rc := C.sqlite3_blob_read(b.handle, unsafe.Pointer(&p[0]), C.int(len(p)), C.int(off)); rc != 0 {
+		return 0, sqliteError(b.db, rc)
+	}
+	return len(p), nil
+}
+
+func (b *blob) WriteAt(p []byte, off int64) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if rc := C.sqlite3_blob_write(b.handle, unsafe.Pointer(&p[0]), C.int(len(p)), C.int(off)); rc != 0 {
+		return 0, sqliteError(b.db, rc)
+	}
+	return len(p), nil
+}
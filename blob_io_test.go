@@ -0,0 +1,11 @@
+//go:build cgo && sqlite_blob_io
+
+package queue
+
+import "testing"
+
+func TestBlobIOHandleField(t *testing.T) {
+	if err := checkHandleField(); err != nil {
+		t.Fatalf("expected the driver to keep its database handle where blob I/O reads it: %v", err)
+	}
+}
@@ -0,0 +1,18 @@
+//go:build !cgo || !sqlite_blob_io
+
+package queue
+
+import (
+	"database/sql"
+	"errors"
+)
+
+// blobIOSupported reports that withBlob is unavailable, so AddFrom and
+// OpenPayload store and read payloads with plain statements instead. Build
+// with CGO and -tags sqlite_blob_io to use incremental blob I/O.
+const blobIOSupported = false
+
+// withBlob is never called without blob I/O.
+func withBlob(conn *sql.Conn, table, column string, rowid int64, write bool, fn func(b blobIO) error) error {
+	return errors.New("queue: incremental blob I/O requires CGO and the sqlite_blob_io build tag")
+}
@@ -0,0 +1,127 @@
+package queue
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Cancellation describes a pending item that was withdrawn via Cancel.
+type Cancellation struct {
+	ItemID      int       // Identifier of the cancelled item.
+	Data        []byte    // Data the item carried when it was cancelled.
+	Reason      string    // Why the item was cancelled.
+	Actor       string    // Who or what cancelled the item.
+	CancelledAt time.Time // Time of the cancellation.
+}
+
+// createCancelTable creates the table recording cancelled items if it does not exist.
+func createCancelTable(tx *sql.Tx, t tables) error {
+	_, err := tx.Exec(`
+        CREATE TABLE IF NOT EXISTS ` + t.cancellations + ` (
+            item_id INTEGER PRIMARY KEY,
+            data BLOB NOT NULL,
+            reason TEXT NOT NULL,
+            actor TEXT NOT NULL,
+            cancelled_at INTEGER NOT NULL
+        );
+    `)
+	return err
+}
+
+// addCancelKeyIDColumn adds the column holding the ID of the key of
+// Config.Keyring the payload of a cancellation is sealed under; NULL for
+// payloads stored in clear.
+func addCancelKeyIDColumn(tx *sql.Tx, t tables) error {
+	return addColumn(tx, t.cancellations, "key_id", "TEXT")
+}
+
+// Cancel removes a pending item that has not been handed to the listener yet
+// and records who cancelled it and why. It returns ErrItemInProgress if the item
+// is currently being processed and ErrItemNotFound if it does not exist.
+func (c *Queue) Cancel(id int, reason, actor string) error {
+	c.mx.Lock() // Lock for exclusive access to the queue.
+	defer c.mx.Unlock()
+
+	return c.withTx(func(tx *sql.Tx) error {
+		item := Item{ID: id}
+		var leaseUntil sql.NullInt64
+		var blob, keyID sql.NullString
+		err := tx.QueryRow(
+			"SELECT `data`, `state`, `lease_until`, `chunks`, `blob`, `key_id` FROM "+c.tables.items+" WHERE id = ?",
+			id,
+		).Scan(&item.Data, &item.State, &leaseUntil, &item.chunks, &blob, &keyID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrItemNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		// Items held by a consumer whose lease is still valid cannot be cancelled.
+		if item.State == StateInFlight && leaseUntil.Int64 >= c.cfg.Clock.Now().UnixNano() {
+			return ErrItemInProgress
+		}
+
+		// Log the whole payload before the delete removes its chunks, still
+		// sealed under its key.
+		item.blob = blob.String
+		if err := c.completePayload(tx, &item); err != nil {
+			return err
+		}
+
+		before, err := c.rowSnapshot(tx, id)
+		if err != nil {
+			return err
+		}
+
+		if _, err := c.execTransition(tx, id, TransitionCancelled, c.stmts.delete, id); err != nil {
+			return err
+		}
+		c.signalFreed()
+
+		_, err = tx.Exec(
+			"INSERT INTO "+c.tables.cancellations+"(`item_id`, `data`, `reason`, `actor`, `cancelled_at`, `key_id`) VALUES (?, ?, ?, ?, ?, ?)",
+			id, item.Data, reason, actor, c.cfg.Clock.Now().UnixNano(), keyID,
+		)
+		if err != nil {
+			return err
+		}
+		if err := c.snapshot(tx, id, TransitionCancelled, before); err != nil {
+			return err
+		}
+		if actor == "" {
+			actor = c.actor()
+		}
+		return c.audit(tx, actor, TransitionCancelled, id)
+	})
+}
+
+// Cancellation returns the record of a cancelled item or ErrItemNotFound
+// if the item was never cancelled. The payload is kept sealed under its key
+// of Config.Keyring, and a *DecryptError is returned if it cannot be opened.
+func (c *Queue) Cancellation(id int) (Cancellation, error) {
+	var cancellation Cancellation
+	var cancelledAt int64
+	var keyID sql.NullString
+
+	err := c.db.QueryRowContext(
+		c.ctx,
+		"SELECT `item_id`, `data`, `reason`, `actor`, `cancelled_at`, `key_id` FROM "+c.tables.cancellations+" WHERE item_id = ?",
+		id,
+	).Scan(&cancellation.ItemID, &cancellation.Data, &cancellation.Reason, &cancellation.Actor, &cancelledAt, &keyID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Cancellation{}, ErrItemNotFound
+	}
+	if err != nil {
+		return Cancellation{}, err
+	}
+
+	item := Item{ID: id, Data: cancellation.Data, keyID: keyID.String}
+	if err := c.decrypt(&item); err != nil {
+		return Cancellation{}, err
+	}
+	cancellation.Data = item.Data
+	cancellation.CancelledAt = time.Unix(0, cancelledAt)
+	return cancellation, nil
+}
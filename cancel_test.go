@@ -0,0 +1,117 @@
+package queue
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCancel(t *testing.T) {
+	queue := setupQueue(t, Config{})
+	defer queue.Close()
+
+	if err := queue.Add([]byte("test data")); err != nil {
+		t.Fatalf("failed to add item to queue: %v", err)
+	}
+
+	items, err := queue.Get(1)
+	if err != nil || len(items) != 1 {
+		t.Fatalf("failed to get item from queue: %v", err)
+	}
+
+	if err := queue.Cancel(items[0].ID, "duplicate order", "admin"); err != nil {
+		t.Fatalf("failed to cancel item: %v", err)
+	}
+
+	// Verify the item is gone and the cancellation was recorded.
+	items, err = queue.Get(1)
+	if err != nil || len(items) != 0 {
+		t.Fatalf("expected queue to be empty, got %d", len(items))
+	}
+
+	cancellation, err := queue.Cancellation(1)
+	if err != nil {
+		t.Fatalf("failed to read cancellation: %v", err)
+	}
+	if cancellation.Reason != "duplicate order" || cancellation.Actor != "admin" || string(cancellation.Data) != "test data" {
+		t.Fatalf("unexpected cancellation: %+v", cancellation)
+	}
+
+	if err := queue.Cancel(1, "again", "admin"); !errors.Is(err, ErrItemNotFound) {
+		t.Fatalf("expected ErrItemNotFound, got %v", err)
+	}
+}
+
+func TestCancelInProgress(t *testing.T) {
+	queue := setupQueue(t, Config{})
+	defer queue.Close()
+
+	if err := queue.Add([]byte("test data")); err != nil {
+		t.Fatalf("failed to add item to queue: %v", err)
+	}
+
+	started := make(chan Item)
+	finish := make(chan struct{})
+	queue.Listener(func(item Item, delay func(sec time.Duration)) {
+		started <- item
+		<-finish
+	})
+
+	item := <-started
+	if err := queue.Cancel(item.ID, "too late", "admin"); !errors.Is(err, ErrItemInProgress) {
+		t.Fatalf("expected ErrItemInProgress, got %v", err)
+	}
+	close(finish)
+}
+
+func TestCancelEncrypted(t *testing.T) {
+	keyring, err := NewKeyring("k1", bytes.Repeat([]byte{1}, 32))
+	if err != nil {
+		t.Fatalf("failed to create keyring: %v", err)
+	}
+	queue := setupQueue(t, Config{Keyring: keyring, ManualStart: true})
+	defer queue.Close()
+
+	if err := queue.Add([]byte("secret order")); err != nil {
+		t.Fatalf("failed to add item to queue: %v", err)
+	}
+	if err := queue.Cancel(1, "duplicate order", "admin"); err != nil {
+		t.Fatalf("failed to cancel item: %v", err)
+	}
+
+	var stored []byte
+	var keyID string
+	if err := queue.db.QueryRow("SELECT `data`, `key_id` FROM "+queue.tables.cancellations).Scan(&stored, &keyID); err != nil {
+		t.Fatalf("failed to read the cancellation: %v", err)
+	}
+	if keyID != "k1" || bytes.Contains(stored, []byte("secret order")) {
+		t.Fatalf("expected the payload sealed under k1, got %q under %q", stored, keyID)
+	}
+
+	if err := queue.RotateKey(context.Background(), "k2", bytes.Repeat([]byte{2}, 32)); err != nil {
+		t.Fatalf("failed to rotate key: %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		pending, err := queue.KeyRotationPending()
+		if err != nil {
+			t.Fatalf("failed to count pending payloads: %v", err)
+		}
+		if pending == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the cancellation to be re-encrypted, %d left", pending)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Without k1, the cancellation is still readable.
+	delete(keyring.keys, "k1")
+	cancellation, err := queue.Cancellation(1)
+	if err != nil || string(cancellation.Data) != "secret order" {
+		t.Fatalf("expected the re-encrypted payload, got %+v, %v", cancellation, err)
+	}
+}
@@ -0,0 +1,128 @@
+package queue
+
+import "database/sql"
+
+// Followup is an item enqueued together with the acknowledgement of another,
+// e.g. the next step of a multi-step pipeline.
+type Followup struct {
+	Data []byte   // Payload of the new item.
+	Tags []string // Tags attached to the new item.
+}
+
+// completion holds what a listener recorded for an item while processing it,
+// committed together with the acknowledgement.
+type completion struct {
+	followups []Followup // Items to enqueue.
+	result    []byte     // Result to store; see SetResult.
+	errMsg    string     // Failure to store instead of a result; see SetError.
+	hasResult bool       // Whether a result or error was recorded, as both may be empty.
+	retry     error      // Failure to retry the item for instead of acknowledging it; see Retry.
+	receipt   string     // Nonce of the delivery to acknowledge; empty for any delivery to this instance.
+	settled   bool       // The handler already acknowledged the item or lost it; see ExactlyOnce.
+	skipRetry bool       // Dead-letter the item instead of retrying it; see ErrSkipRetry.
+}
+
+// AckThen acknowledges an item claimed by this queue instance and enqueues
+// the follow-up items in the same transaction, so the next steps exist if and
+// only if this one completed. If the queue has no room for the follow-ups,
+// nothing is committed, the item stays claimed and ErrQueueFull is returned;
+// only OverflowDropOldest may evict other items to make room. It returns
+// ErrItemNotFound if the item is not held by this instance.
+func (c *Queue) AckThen(id int, next ...Followup) error {
+	return c.ackWith(id, completion{followups: next})
+}
+
+// ackWith acknowledges an item claimed by this queue instance and commits the
+// completion in the same transaction.
+func (c *Queue) ackWith(id int, done completion) error {
+	// Dropping a follow-up would break the chain, so only eviction is allowed.
+	policy := OverflowReject
+	if c.cfg.Overflow == OverflowDropOldest {
+		policy = OverflowDropOldest
+	}
+
+	var enqueued []Item
+	c.mx.Lock() // Lock for exclusive access to the queue.
+	if c.awaited[id] {
+		done.hasResult = true // Do is waiting, so store a result even if none was recorded.
+	}
+	err := c.withTx(func(tx *sql.Tx) error {
+		before, err := c.rowSnapshot(tx, id)
+		if err != nil {
+			return err
+		}
+
+		if err := c.recordHistory(tx, id, nullString(done.receipt)); err != nil {
+			return err
+		}
+		acked, err := c.execTransition(tx, id, TransitionAcked, c.stmts.ack, id, c.owner, nullString(done.receipt))
+		if err != nil {
+			return err
+		}
+		if !acked {
+			return ErrItemNotFound
+		}
+		if err := c.snapshot(tx, id, TransitionAcked, before); err != nil {
+			return err
+		}
+
+		if done.hasResult {
+			if err := c.storeResult(tx, id, done.result, done.errMsg); err != nil {
+				return err
+			}
+		}
+
+		for _, f := range done.followups {
+			encoded, err := encodeTags(f.Tags)
+			if err != nil {
+				return err
+			}
+			itemID, err := c.insertItem(tx, f.Data, encoded, addOptions{}, policy)
+			if err != nil {
+				return err
+			}
+			enqueued = append(enqueued, Item{ID: itemID, Data: f.Data, Tags: f.Tags, State: StatePending})
+		}
+		return nil
+	})
+	if err == nil {
+		c.signalFreed()
+	}
+	c.mx.Unlock()
+	if err != nil {
+		return err
+	}
+
+	c.count(MetricAcked, 1)
+	for _, item := range enqueued {
+		c.cfg.Hooks.enqueued(item)
+	}
+	c.count(MetricEnqueued, len(enqueued))
+	return nil
+}
+
+// Then records a follow-up item from within a listener callback. It is
+// enqueued in the same transaction that acknowledges the item with the given
+// ID once the callback returns, and discarded if the callback asks for a
+// retry, so a redelivery does not enqueue it twice.
+func (c *Queue) Then(id int, data []byte, tags ...string) {
+	c.record(id, func(done *completion) {
+		done.followups = append(done.followups, Followup{Data: data, Tags: tags})
+	})
+}
+
+// record updates the completion of an item being processed by a listener.
+func (c *Queue) record(id int, update func(done *completion)) {
+	c.mx.Lock() // Lock for exclusive access to the queue.
+	defer c.mx.Unlock()
+
+	if c.completions == nil {
+		c.completions = make(map[int]*completion)
+	}
+	done := c.completions[id]
+	if done == nil {
+		done = &completion{}
+		c.completions[id] = done
+	}
+	update(done)
+}
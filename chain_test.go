@@ -0,0 +1,85 @@
+package queue
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestAckThen(t *testing.T) {
+	queue := setupQueue(t, Config{MaxItems: 2})
+	defer queue.Close()
+
+	if err := queue.Add([]byte("step 1")); err != nil {
+		t.Fatalf("failed to add item to queue: %v", err)
+	}
+	items, err := queue.Claim(1)
+	if err != nil || len(items) != 1 {
+		t.Fatalf("failed to claim item: %v", err)
+	}
+
+	// Three follow-ups do not fit, so the acknowledgement is rolled back.
+	err = queue.AckThen(items[0].ID, Followup{Data: []byte("a")}, Followup{Data: []byte("b")}, Followup{Data: []byte("c")})
+	if !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("expected ErrQueueFull, got %v", err)
+	}
+
+	if err := queue.AckThen(items[0].ID, Followup{Data: []byte("step 2"), Tags: []string{"pipeline"}}); err != nil {
+		t.Fatalf("failed to ack item: %v", err)
+	}
+	if err := queue.AckThen(items[0].ID); !errors.Is(err, ErrItemNotFound) {
+		t.Fatalf("expected ErrItemNotFound, got %v", err)
+	}
+
+	remaining, err := queue.Get(10)
+	if err != nil {
+		t.Fatalf("failed to get items: %v", err)
+	}
+	if len(remaining) != 1 || string(remaining[0].Data) != "step 2" || remaining[0].Tags[0] != "pipeline" {
+		t.Fatalf("unexpected items: %+v", remaining)
+	}
+}
+
+func TestThen(t *testing.T) {
+	queue := setupQueue(t, Config{})
+	defer queue.Close()
+
+	if err := queue.Add([]byte("step 1")); err != nil {
+		t.Fatalf("failed to add item to queue: %v", err)
+	}
+
+	seen := make(chan string, 10)
+	attempts := 0
+	queue.Listener(func(item Item, delay func(sec time.Duration)) {
+		seen <- string(item.Data)
+		if string(item.Data) != "step 1" {
+			return
+		}
+
+		queue.Then(item.ID, []byte("step 2"))
+		attempts++
+		if attempts == 1 {
+			delay(time.Millisecond) // The retry discards the follow-up of this attempt.
+		}
+	})
+
+	var got []string
+	for len(got) < 3 {
+		select {
+		case data := <-seen:
+			got = append(got, data)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out, got %v", got)
+		}
+	}
+	if got[0] != "step 1" || got[1] != "step 1" || got[2] != "step 2" {
+		t.Fatalf("unexpected deliveries: %v", got)
+	}
+
+	// No second "step 2" is delivered.
+	select {
+	case data := <-seen:
+		t.Fatalf("unexpected delivery %q", data)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
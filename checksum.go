@@ -0,0 +1,169 @@
+package queue
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// ErrCorrupted is matched by errors.Is for a *CorruptedPayloadError.
+var ErrCorrupted = errors.New("queue: payload corrupted")
+
+// CorruptedPayloadError is returned when a payload read from the queue does
+// not match the checksum stored when it was added.
+type CorruptedPayloadError struct {
+	ItemID   int    // Item whose payload is corrupted.
+	Expected uint32 // Checksum stored when the item was added.
+	Actual   uint32 // Checksum of the payload as read.
+}
+
+func (e *CorruptedPayloadError) Error() string {
+	return fmt.Sprintf("queue: payload of item %d is corrupted: checksum %08x, expected %08x", e.ItemID, e.Actual, e.Expected)
+}
+
+// Is reports whether target is ErrCorrupted.
+func (e *CorruptedPayloadError) Is(target error) bool {
+	return target == ErrCorrupted
+}
+
+// verifyBatchSize is the number of items VerifyAll reads per round trip.
+const verifyBatchSize = 100
+
+// crcTable uses the Castagnoli polynomial, which most CPUs compute in hardware.
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// checksum returns the checksum stored for a payload.
+func checksum(data []byte) uint32 {
+	return crc32.Checksum(data, crcTable)
+}
+
+// verifyChecksum returns a *CorruptedPayloadError if the payload of an item
+// does not match its stored checksum. Items added before checksums were
+// stored are not verified.
+func verifyChecksum(item Item) error {
+	if !item.checksum.Valid {
+		return nil
+	}
+	if sum := checksum(item.Data); sum != uint32(item.checksum.Int64) {
+		return &CorruptedPayloadError{ItemID: item.ID, Expected: uint32(item.checksum.Int64), Actual: sum}
+	}
+	return nil
+}
+
+// quarantineCorrupted sets an item with a corrupted payload aside so it is not
+// handed to listeners, unless a consumer other than owner holds it. It must
+// be called with the queue locked.
+func (c *Queue) quarantineCorrupted(id int, cause error, owner string) error {
+	return c.withTx(func(tx *sql.Tx) error {
+		before, err := c.rowSnapshot(tx, id)
+		if err != nil {
+			return err
+		}
+		from, err := c.itemState(tx, id)
+		if err != nil {
+			return err
+		}
+
+		res, err := tx.Exec(
+			"UPDATE "+c.tables.items+" SET state = 'quarantined', owner = NULL, lease_until = NULL, failure = ? WHERE id = ? AND state != 'quarantined' AND (state != 'in-flight' OR lease_until < ? OR owner = ?)",
+			cause.Error(), id, c.cfg.Clock.Now().UnixNano(), owner,
+		)
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		if err != nil || n == 0 {
+			return err
+		}
+		if err := c.enforceTransition(tx, id, TransitionQuarantined, from); err != nil {
+			return err
+		}
+		return c.snapshot(tx, id, TransitionQuarantined, before)
+	})
+}
+
+// VerifyAll reads every payload in the queue and checks it against its stored
+// checksum, e.g. periodically to find disk corruption before a listener
+// would. Corrupted items are quarantined unless a consumer holds them, and
+// their IDs are returned. The queue is only locked while a batch of items is
+// verified, so producers and consumers keep running.
+func (c *Queue) VerifyAll(ctx context.Context) ([]int, error) {
+	var corrupted []int
+	after := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return corrupted, err
+		}
+
+		ids, last, err := c.verifyBatch(ctx, after)
+		corrupted = append(corrupted, ids...)
+		if err != nil || last == after {
+			return corrupted, err
+		}
+		after = last
+	}
+}
+
+// verifyBatch verifies the next batch of items following the ID 'after' and
+// returns the IDs of the corrupted ones and the last ID verified.
+func (c *Queue) verifyBatch(ctx context.Context, after int) ([]int, int, error) {
+	c.mx.Lock() // Lock for exclusive access to the queue.
+	defer c.mx.Unlock()
+
+	// Read the batch and close the rows before loading the payloads, as the
+	// pool may only have a single connection.
+	rows, err := c.db.QueryContext(ctx, "SELECT "+itemColumns+" FROM "+c.tables.items+" WHERE id > ? ORDER BY id LIMIT ?", after, verifyBatchSize)
+	if err != nil {
+		return nil, after, err
+	}
+	var items []Item
+	for rows.Next() {
+		item, err := scanItem(rows)
+		if err != nil {
+			rows.Close()
+			return nil, after, err
+		}
+		items = append(items, item)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, after, err
+	}
+
+	var corrupted []int
+	for _, item := range items {
+		after = item.ID
+
+		err := c.verifyItem(item)
+		switch {
+		case errors.Is(err, ErrCorrupted):
+			corrupted = append(corrupted, item.ID)
+			if err := c.quarantineCorrupted(item.ID, err, ""); err != nil {
+				return corrupted, after, err
+			}
+		case errors.Is(err, ErrItemNotFound):
+			continue // Removed while verifying.
+		case err != nil:
+			return corrupted, after, err
+		}
+	}
+	return corrupted, after, nil
+}
+
+// verifyItem reads the whole payload of an item and checks it against its
+// stored checksum.
+func (c *Queue) verifyItem(item Item) error {
+	if !item.Streamed {
+		return c.loadPayload(c.db, &item)
+	}
+
+	r, err := c.OpenPayload(item.ID)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(io.Discard, r)
+	return err
+}
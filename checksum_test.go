@@ -0,0 +1,83 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestCorruptedPayloadIsQuarantined(t *testing.T) {
+	queue := setupQueue(t, Config{})
+	defer queue.Close()
+
+	for _, data := range []string{"intact", "corrupted"} {
+		if err := queue.Add([]byte(data)); err != nil {
+			t.Fatalf("failed to add item to queue: %v", err)
+		}
+	}
+	if _, err := queue.db.Exec("UPDATE " + queue.tables.items + " SET data = CAST('c0rrupted' AS BLOB) WHERE CAST(data AS TEXT) = 'corrupted'"); err != nil {
+		t.Fatalf("failed to corrupt payload: %v", err)
+	}
+
+	_, err := queue.Get(10)
+	var corrupted *CorruptedPayloadError
+	if !errors.Is(err, ErrCorrupted) || !errors.As(err, &corrupted) || corrupted.ItemID != 2 {
+		t.Fatalf("expected a *CorruptedPayloadError for item 2, got %v", err)
+	}
+
+	items, err := queue.Claim(10)
+	if err != nil || len(items) != 1 || string(items[0].Data) != "intact" {
+		t.Fatalf("expected only the intact item to be claimed, got %+v, %v", items, err)
+	}
+
+	quarantined, err := queue.Quarantined(10)
+	if err != nil || len(quarantined) != 1 || string(quarantined[0].Data) != "c0rrupted" {
+		t.Fatalf("expected the corrupted item to be quarantined, got %+v, %v", quarantined, err)
+	}
+	if !strings.Contains(quarantined[0].Failure, "corrupted") {
+		t.Fatalf("expected the checksum mismatch as failure, got %q", quarantined[0].Failure)
+	}
+}
+
+func TestVerifyAll(t *testing.T) {
+	queue := setupQueue(t, Config{ChunkSize: 4})
+	defer queue.Close()
+
+	if err := queue.Add([]byte("0123456789")); err != nil {
+		t.Fatalf("failed to add item to queue: %v", err)
+	}
+	streamed, err := queue.AddFrom(strings.NewReader("streamed payload"))
+	if err != nil {
+		t.Fatalf("failed to add item from reader: %v", err)
+	}
+	if err := queue.Add([]byte("ok")); err != nil {
+		t.Fatalf("failed to add item to queue: %v", err)
+	}
+
+	if ids, err := queue.VerifyAll(context.Background()); err != nil || len(ids) != 0 {
+		t.Fatalf("expected no corrupted items, got %v, %v", ids, err)
+	}
+
+	// Corrupt the first chunk of both the split and the streamed payload.
+	if _, err := queue.db.Exec("UPDATE " + queue.tables.chunks + " SET data = CAST('XXXX' AS BLOB) WHERE seq = 0"); err != nil {
+		t.Fatalf("failed to corrupt chunks: %v", err)
+	}
+
+	r, err := queue.OpenPayload(streamed)
+	if err != nil {
+		t.Fatalf("failed to open payload: %v", err)
+	}
+	if _, err := io.ReadAll(r); !errors.Is(err, ErrCorrupted) {
+		t.Fatalf("expected reading the streamed payload to fail with ErrCorrupted, got %v", err)
+	}
+
+	ids, err := queue.VerifyAll(context.Background())
+	if err != nil || len(ids) != 2 || ids[0] != 1 || ids[1] != streamed {
+		t.Fatalf("expected items 1 and %d to be corrupted, got %v, %v", streamed, ids, err)
+	}
+	if stats, _ := queue.Stats(); stats.Quarantined != 2 || stats.Pending != 1 {
+		t.Fatalf("expected the corrupted items to be quarantined, got %+v", stats)
+	}
+}
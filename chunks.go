@@ -0,0 +1,194 @@
+package queue
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// ErrPayloadTooLarge is matched by errors.Is for a *PayloadTooLargeError.
+var ErrPayloadTooLarge = errors.New("queue: payload too large")
+
+// PayloadTooLargeError is returned when a payload exceeds Config.MaxPayloadSize.
+type PayloadTooLargeError struct {
+	Size int // Size of the rejected payload in bytes.
+	Max  int // Configured maximum in bytes.
+}
+
+func (e *PayloadTooLargeError) Error() string {
+	return fmt.Sprintf("queue: payload of %d bytes exceeds the maximum of %d bytes", e.Size, e.Max)
+}
+
+// Is reports whether target is ErrPayloadTooLarge.
+func (e *PayloadTooLargeError) Is(target error) bool {
+	return target == ErrPayloadTooLarge
+}
+
+// createChunksTable creates the table holding the tails of chunked payloads
+// and the trigger removing them together with their item.
+func createChunksTable(tx *sql.Tx, t tables) error {
+	if err := addColumn(tx, t.items, "chunks", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+
+	_, err := tx.Exec(`
+        CREATE TABLE IF NOT EXISTS ` + t.chunks + ` (
+            item_id INTEGER NOT NULL,
+            seq INTEGER NOT NULL,
+            data BLOB NOT NULL,
+            PRIMARY KEY (item_id, seq)
+        );
+        CREATE TRIGGER IF NOT EXISTS ` + t.chunks + `_cleanup AFTER DELETE ON ` + t.items + ` BEGIN
+            DELETE FROM ` + t.chunks + ` WHERE item_id = OLD.id;
+        END;
+    `)
+	return err
+}
+
+// checkPayload returns a *PayloadTooLargeError if a payload of the given size
+// exceeds Config.MaxPayloadSize.
+func (c *Queue) checkPayload(size int) error {
+	if c.cfg.MaxPayloadSize > 0 && size > c.cfg.MaxPayloadSize {
+		return &PayloadTooLargeError{Size: size, Max: c.cfg.MaxPayloadSize}
+	}
+	return nil
+}
+
+// storedPayload describes how a payload is laid out in the database.
+type storedPayload struct {
+	head []byte // Part kept in the item row.
+	rest []byte // Part written to the chunks table; see Config.ChunkSize.
+	blob string // Key of the payload in Config.Offload if it was offloaded.
+	key  string // ID of the key of Config.Keyring the payload is sealed under; empty if stored in clear.
+
+	checksum int64 // Checksum of the whole payload.
+}
+
+// size returns the number of payload bytes taking room in the database.
+func (p storedPayload) size() int {
+	return len(p.head) + len(p.rest)
+}
+
+// preparePayload checks a payload against Config.MaxPayloadSize and decides
+// how it is stored: offloaded to Config.Offload, split by Config.ChunkSize, or
+// kept in the item row as a whole. Offloaded payloads are written right away
+// and must be discarded with discardPayload if the item is not inserted.
+func (c *Queue) preparePayload(data []byte) (storedPayload, error) {
+	if err := c.checkPayload(len(data)); err != nil {
+		return storedPayload{}, err
+	}
+	sum := int64(checksum(data))
+	data, key, err := c.encrypt(data)
+	if err != nil {
+		return storedPayload{}, err
+	}
+
+	if c.cfg.Offload != nil && len(data) > c.cfg.OffloadThreshold {
+		blob, err := c.offload(data)
+		return storedPayload{head: []byte{}, blob: blob, key: key, checksum: sum}, err // The data column is NOT NULL.
+	}
+	if c.cfg.ChunkSize <= 0 || len(data) <= c.cfg.ChunkSize {
+		return storedPayload{head: data, key: key, checksum: sum}, nil
+	}
+	return storedPayload{head: data[:c.cfg.ChunkSize], rest: data[c.cfg.ChunkSize:], key: key, checksum: sum}, nil
+}
+
+// storePayload records the parts of a payload kept outside the item row once
+// the row has been inserted.
+func (c *Queue) storePayload(tx *sql.Tx, id int64, p storedPayload) error {
+	if p.blob != "" {
+		_, err := tx.Exec("UPDATE "+c.tables.items+" SET blob = ? WHERE id = ?", p.blob, id)
+		return err
+	}
+	if len(p.rest) == 0 {
+		return nil
+	}
+	return c.storeChunks(tx, id, p.rest)
+}
+
+// storeChunks writes the rest of a split payload in chunks of
+// Config.ChunkSize and records their number on the item.
+func (c *Queue) storeChunks(tx *sql.Tx, id int64, rest []byte) error {
+	seq := 0
+	for ; len(rest) > 0; seq++ {
+		n := min(len(rest), c.cfg.ChunkSize)
+		if _, err := tx.Exec("INSERT INTO "+c.tables.chunks+"(`item_id`, `seq`, `data`) VALUES (?, ?, ?)", id, seq, rest[:n]); err != nil {
+			return err
+		}
+		rest = rest[n:]
+	}
+
+	_, err := tx.Exec("UPDATE "+c.tables.items+" SET chunks = ? WHERE id = ?", seq, id)
+	return err
+}
+
+// queryer runs queries on a database or inside a transaction.
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+// loadPayloads completes the payloads of items whose rows do not hold all of
+// it, except for streamed items, which are read with OpenPayload. The rows the
+// items were read from must be closed unless q is a transaction.
+func (c *Queue) loadPayloads(q queryer, items []Item) error {
+	for i := range items {
+		if items[i].Streamed {
+			continue
+		}
+		if err := c.loadPayload(q, &items[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadPayload completes the payload of a single item and verifies its
+// checksum. A corrupted payload is still loaded, along with a
+// *CorruptedPayloadError.
+func (c *Queue) loadPayload(q queryer, item *Item) error {
+	if err := c.completePayload(q, item); err != nil {
+		return err
+	}
+	if err := c.decrypt(item); err != nil {
+		return err
+	}
+	return verifyChecksum(*item)
+}
+
+// completePayload fetches the payload of an item from Config.Offload or
+// appends its stored chunks.
+func (c *Queue) completePayload(q queryer, item *Item) error {
+	if item.blob != "" {
+		data, err := c.fetchBlob(item.blob)
+		if err != nil {
+			return err
+		}
+		item.Data = data
+		return nil
+	}
+	if item.chunks == 0 {
+		return nil
+	}
+
+	rows, err := q.QueryContext(c.ctx, "SELECT `data` FROM "+c.tables.chunks+" WHERE item_id = ? ORDER BY seq", item.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close() // Ensure rows are closed after processing.
+
+	// Copy the head, as appending must not write into a shared buffer.
+	data := append([]byte(nil), item.Data...)
+	for rows.Next() {
+		var chunk []byte
+		if err := rows.Scan(&chunk); err != nil {
+			return err
+		}
+		data = append(data, chunk...)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	item.Data = data
+	return nil
+}
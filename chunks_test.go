@@ -0,0 +1,78 @@
+package queue
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestMaxPayloadSize(t *testing.T) {
+	queue := setupQueue(t, Config{MaxPayloadSize: 4})
+	defer queue.Close()
+
+	err := queue.Add([]byte("too large"))
+	if !errors.Is(err, ErrPayloadTooLarge) {
+		t.Fatalf("expected ErrPayloadTooLarge, got %v", err)
+	}
+	var tooLarge *PayloadTooLargeError
+	if !errors.As(err, &tooLarge) || tooLarge.Size != 9 || tooLarge.Max != 4 {
+		t.Fatalf("expected a *PayloadTooLargeError for 9 of 4 bytes, got %#v", err)
+	}
+
+	if err := queue.Add([]byte("fits")); err != nil {
+		t.Fatalf("failed to add item to queue: %v", err)
+	}
+	if items, _ := queue.Get(10); len(items) != 1 {
+		t.Fatalf("expected only the small item to be queued, got %+v", items)
+	}
+}
+
+func TestChunkedPayloads(t *testing.T) {
+	queue := setupQueue(t, Config{ChunkSize: 4, MaxAttempts: 1})
+	defer queue.Close()
+
+	payload := "0123456789"
+	if err := queue.Add([]byte(payload)); err != nil {
+		t.Fatalf("failed to add item to queue: %v", err)
+	}
+
+	var chunks int
+	queue.db.QueryRow("SELECT COUNT(*) FROM " + queue.tables.chunks).Scan(&chunks)
+	if chunks != 2 {
+		t.Fatalf("expected the payload to be split into two chunks after its head, got %d", chunks)
+	}
+
+	stats, err := queue.Stats()
+	if err != nil || stats.Bytes != int64(len(payload)) {
+		t.Fatalf("expected %d bytes, got %+v, %v", len(payload), stats, err)
+	}
+
+	items, err := queue.Get(1)
+	if err != nil || len(items) != 1 || string(items[0].Data) != payload {
+		t.Fatalf("expected the joined payload from Get, got %+v, %v", items, err)
+	}
+
+	items, err = queue.Claim(1)
+	if err != nil || len(items) != 1 || string(items[0].Data) != payload {
+		t.Fatalf("expected the joined payload from Claim, got %+v, %v", items, err)
+	}
+	if err := queue.Release(items[0].ID); err != nil {
+		t.Fatalf("failed to release item: %v", err)
+	}
+
+	// The next claim finds the attempts used up and dead-letters the item.
+	if items, err := queue.Claim(1); err != nil || len(items) != 0 {
+		t.Fatalf("expected the item to be dead-lettered, got %+v, %v", items, err)
+	}
+	dead, err := queue.DeadLetters(10)
+	if err != nil || len(dead) != 1 || string(dead[0].Data) != payload {
+		t.Fatalf("expected the joined payload from DeadLetters, got %+v, %v", dead, err)
+	}
+
+	if err := queue.Delete(dead[0].ID); err != nil {
+		t.Fatalf("failed to delete item: %v", err)
+	}
+	queue.db.QueryRow("SELECT COUNT(*) FROM " + queue.tables.chunks).Scan(&chunks)
+	if chunks != 0 {
+		t.Fatalf("expected the chunks to be deleted with their item, got %d", chunks)
+	}
+}
@@ -0,0 +1,285 @@
+package queue
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSharedFileConsumers(t *testing.T) {
+	config := Config{
+		LocalFile:   filepath.Join(t.TempDir(), "queue.db"),
+		JournalMode: "WAL",
+		BusyTimeout: 5 * time.Second,
+	}
+
+	producer := setupQueue(t, config)
+	defer producer.Close()
+
+	const total = 50
+	for i := 0; i < total; i++ {
+		if err := producer.Add([]byte("test data")); err != nil {
+			t.Fatalf("failed to add item to queue: %v", err)
+		}
+	}
+
+	var mx sync.Mutex
+	deliveries := make(map[int]int)
+	var wg sync.WaitGroup
+	wg.Add(total)
+
+	// Two independent instances play the role of two processes sharing the file.
+	for i := 0; i < 2; i++ {
+		consumer := setupQueue(t, config)
+		defer consumer.Close()
+
+		consumer.Listener(func(item Item, delay func(sec time.Duration)) {
+			mx.Lock()
+			deliveries[item.ID]++
+			mx.Unlock()
+			wg.Done()
+		})
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("timed out waiting for deliveries")
+	}
+
+	mx.Lock()
+	defer mx.Unlock()
+	for id, count := range deliveries {
+		if count != 1 {
+			t.Errorf("item %d delivered %d times", id, count)
+		}
+	}
+}
+
+func TestExpiredLeaseIsReclaimed(t *testing.T) {
+	config := Config{
+		LocalFile:    filepath.Join(t.TempDir(), "queue.db"),
+		LeaseTimeout: 50 * time.Millisecond,
+		ManualStart:  true, // Claim by hand, without a dispatcher.
+	}
+
+	crashed := setupQueue(t, config)
+	defer crashed.Close()
+
+	if err := crashed.Add([]byte("test data")); err != nil {
+		t.Fatalf("failed to add item to queue: %v", err)
+	}
+
+	// Claim and never acknowledge, as if the process died mid-delivery.
+	items, err := crashed.claim(1, nil)
+	if err != nil || len(items) != 1 {
+		t.Fatalf("failed to claim item: %+v, %v", items, err)
+	}
+
+	other := setupQueue(t, config)
+	defer other.Close()
+
+	if items, err := other.claim(1, nil); err != nil || len(items) != 0 {
+		t.Fatalf("expected the leased item to be unavailable, got %+v, %v", items, err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	if items, err := other.claim(1, nil); err != nil || len(items) != 1 {
+		t.Fatalf("expected the expired lease to be reclaimed, got %+v, %v", items, err)
+	}
+}
+
+func TestExpiredLeaseIsRedelivered(t *testing.T) {
+	config := Config{
+		LocalFile:    filepath.Join(t.TempDir(), "queue.db"),
+		LeaseTimeout: 300 * time.Millisecond,
+	}
+
+	crashed := setupQueue(t, config)
+	defer crashed.Close()
+
+	if err := crashed.Add([]byte("test data")); err != nil {
+		t.Fatalf("failed to add item to queue: %v", err)
+	}
+
+	// Claim the item and never acknowledge it, as if the process died.
+	start := time.Now()
+	if items, err := crashed.Claim(1); err != nil || len(items) != 1 {
+		t.Fatalf("failed to claim item: %+v, %v", items, err)
+	}
+
+	other := setupQueue(t, config)
+	defer other.Close()
+
+	delivered := make(chan time.Time, 1)
+	other.Listener(func(item Item, delay func(sec time.Duration)) {
+		select {
+		case delivered <- time.Now():
+		default:
+		}
+	})
+
+	select {
+	case at := <-delivered:
+		if at.Before(start.Add(config.LeaseTimeout)) {
+			t.Fatalf("item was redelivered before its lease expired")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected the listener to receive the item once its lease expired")
+	}
+}
+
+func TestAtomicClaim(t *testing.T) {
+	config := Config{
+		LocalFile:   filepath.Join(t.TempDir(), "queue.db"),
+		JournalMode: "WAL",
+		BusyTimeout: 5 * time.Second,
+		MaxAttempts: 1,
+	}
+
+	queue := setupQueue(t, config)
+	defer queue.Close()
+
+	const total = 200
+	for i := 0; i < total; i++ {
+		if err := queue.Add([]byte("test data")); err != nil {
+			t.Fatalf("failed to add item to queue: %v", err)
+		}
+	}
+	if err := queue.Add([]byte("urgent")); err != nil {
+		t.Fatalf("failed to add item to queue: %v", err)
+	}
+	if err := queue.Admin().Reprioritize(total+1, 1); err != nil {
+		t.Fatalf("failed to reprioritize item: %v", err)
+	}
+
+	// Each claim returns its items in claim order.
+	first, err := queue.Claim(3)
+	if err != nil || len(first) != 3 {
+		t.Fatalf("failed to claim items: %+v, %v", first, err)
+	}
+	if first[0].ID != total+1 || first[1].ID != 1 || first[2].ID != 2 || first[1].State != StateInFlight || first[1].Attempts != 1 {
+		t.Fatalf("expected the urgent item, then items 1 and 2, got %+v", first)
+	}
+
+	// Several instances claiming concurrently never get the same item.
+	var mx sync.Mutex
+	claimed := make(map[int]int)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		consumer := queue
+		if i > 0 {
+			consumer = setupQueue(t, config)
+			defer consumer.Close()
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				items, err := consumer.Claim(7)
+				if err != nil {
+					t.Errorf("failed to claim items: %v", err)
+					return
+				}
+				if len(items) == 0 {
+					return
+				}
+				mx.Lock()
+				for _, item := range items {
+					claimed[item.ID]++
+				}
+				mx.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(claimed) != total-2 {
+		t.Fatalf("expected %d items claimed, got %d", total-2, len(claimed))
+	}
+	for id, count := range claimed {
+		if count != 1 {
+			t.Errorf("item %d claimed %d times", id, count)
+		}
+	}
+
+	// A released item that used up its attempts is dead-lettered instead.
+	if err := queue.Release(first[1].ID); err != nil {
+		t.Fatalf("failed to release item: %v", err)
+	}
+	if items, err := queue.Claim(1); err != nil || len(items) != 0 {
+		t.Fatalf("expected nothing to claim, got %+v, %v", items, err)
+	}
+	if dead, err := queue.DeadLetters(10); err != nil || len(dead) != 1 || dead[0].ID != first[1].ID {
+		t.Fatalf("expected item %d dead-lettered, got %+v, %v", first[1].ID, dead, err)
+	}
+}
+
+func TestClaimBatchSize(t *testing.T) {
+	queue := setupQueue(t, Config{ClaimBatchSize: 10})
+	defer queue.Close()
+
+	for i := 0; i < 25; i++ {
+		if err := queue.Add([]byte("test data")); err != nil {
+			t.Fatalf("failed to add item to queue: %v", err)
+		}
+	}
+
+	release := make(chan struct{})
+	delivered := make(chan int, 25)
+	queue.Listener(func(item Item, delay func(sec time.Duration)) {
+		if item.ID == 1 {
+			<-release
+		}
+		delivered <- item.ID
+	})
+
+	// The first round trip claims a batch, handed out one by one.
+	waitForStats(t, queue, func(s Stats) bool { return s.InFlight == 10 })
+	close(release)
+
+	for i := 1; i <= 25; i++ {
+		select {
+		case id := <-delivered:
+			if id != i {
+				t.Fatalf("expected item %d, got %d", i, id)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for item %d", i)
+		}
+	}
+	waitForStats(t, queue, func(s Stats) bool { return s.Pending == 0 && s.InFlight == 0 })
+}
+
+func TestReleasePrefetched(t *testing.T) {
+	queue := setupQueue(t, Config{ClaimBatchSize: 10})
+	defer queue.Close()
+
+	for i := 0; i < 5; i++ {
+		if err := queue.Add([]byte("test data")); err != nil {
+			t.Fatalf("failed to add item to queue: %v", err)
+		}
+	}
+
+	items, err := queue.claimNext(nil)
+	if err != nil || len(items) != 1 || items[0].ID != 1 {
+		t.Fatalf("expected item 1, got %+v, %v", items, err)
+	}
+	if stats, err := queue.Stats(); err != nil || stats.InFlight != 5 {
+		t.Fatalf("expected 5 items claimed, got %+v, %v", stats, err)
+	}
+
+	// Items claimed ahead go back to the queue, the one handed out stays.
+	queue.releasePrefetched()
+	if stats, err := queue.Stats(); err != nil || stats.InFlight != 1 || stats.Pending != 4 {
+		t.Fatalf("expected 4 items released, got %+v, %v", stats, err)
+	}
+}
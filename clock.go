@@ -0,0 +1,161 @@
+package queue
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is the source of time of a queue: item timestamps, visibility,
+// leases, listener delays and the intervals of the background loops all go
+// through it. Set Config.Clock to a *FakeClock to advance time in tests
+// instead of sleeping.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+	NewTicker(d time.Duration) Ticker
+}
+
+// Ticker delivers ticks at intervals, like time.Ticker.
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// systemClock is the Clock backed by the time package.
+type systemClock struct{}
+
+func (systemClock) Now() time.Time                         { return time.Now() }
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+func (systemClock) NewTicker(d time.Duration) Ticker       { return systemTicker{time.NewTicker(d)} }
+
+// systemTicker adapts a *time.Ticker to the Ticker interface.
+type systemTicker struct {
+	t *time.Ticker
+}
+
+func (t systemTicker) C() <-chan time.Time { return t.t.C }
+func (t systemTicker) Stop()               { t.t.Stop() }
+
+// FakeClock is a Clock that only moves when Advance or Set is called, so
+// tests can expire leases, fire delays and run scheduled items instantly.
+// Timers and tickers fire from within Advance and Set. The zero value is not
+// usable; create one with NewFakeClock.
+type FakeClock struct {
+	mx      sync.Mutex
+	now     time.Time
+	waiters []*fakeWaiter // Pending timers and tickers.
+}
+
+// fakeWaiter is a timer or ticker of a FakeClock.
+type fakeWaiter struct {
+	at      time.Time      // When the waiter fires next.
+	period  time.Duration  // Interval of a ticker; 0 for a timer.
+	ch      chan time.Time // Receives the ticks, buffered so Advance never blocks.
+	stopped bool           // Set by Stop.
+	clock   *FakeClock     // Clock the waiter belongs to.
+}
+
+var _ Clock = (*FakeClock)(nil)
+
+// NewFakeClock returns a FakeClock set to start.
+func NewFakeClock(start time.Time) *FakeClock {
+	return &FakeClock{now: start}
+}
+
+// Now returns the current time of the clock.
+func (c *FakeClock) Now() time.Time {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	return c.now
+}
+
+// After returns a channel receiving the time once the clock has advanced by d.
+func (c *FakeClock) After(d time.Duration) <-chan time.Time {
+	return c.add(d, 0).ch
+}
+
+// NewTicker returns a ticker firing every d of advanced time. A single
+// Advance across several periods delivers one tick, as a slow receiver of a
+// time.Ticker would see.
+func (c *FakeClock) NewTicker(d time.Duration) Ticker {
+	return c.add(d, d)
+}
+
+// Advance moves the clock forward by d and fires the timers and tickers that
+// became due.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.Set(c.Now().Add(d))
+}
+
+// Set moves the clock to t and fires the timers and tickers that became due.
+// Moving the clock backwards fires nothing.
+func (c *FakeClock) Set(t time.Time) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	c.now = t
+	waiting := c.waiters[:0]
+	for _, w := range c.waiters {
+		if w.stopped {
+			continue
+		}
+		if w.at.After(t) {
+			waiting = append(waiting, w)
+			continue
+		}
+
+		select {
+		case w.ch <- t:
+		default: // The previous tick was not received yet.
+		}
+		if w.period > 0 {
+			for !w.at.After(t) {
+				w.at = w.at.Add(w.period)
+			}
+			waiting = append(waiting, w)
+		}
+	}
+	c.waiters = waiting
+}
+
+// Waiters returns the number of pending timers created by After, e.g. to
+// wait until a listener went to sleep on a delay before advancing the clock.
+// Tickers are not counted, as the background loops hold theirs for the
+// lifetime of the queue.
+func (c *FakeClock) Waiters() int {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	n := 0
+	for _, w := range c.waiters {
+		if !w.stopped && w.period == 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// add registers a waiter firing after d, and every period thereafter if
+// period is positive.
+func (c *FakeClock) add(d, period time.Duration) *fakeWaiter {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	w := &fakeWaiter{at: c.now.Add(d), period: period, ch: make(chan time.Time, 1), clock: c}
+	if d <= 0 && period == 0 {
+		w.ch <- c.now
+		return w
+	}
+	c.waiters = append(c.waiters, w)
+	return w
+}
+
+func (w *fakeWaiter) C() <-chan time.Time {
+	return w.ch
+}
+
+func (w *fakeWaiter) Stop() {
+	w.clock.mx.Lock()
+	defer w.clock.mx.Unlock()
+	w.stopped = true
+}
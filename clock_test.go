@@ -0,0 +1,94 @@
+package queue
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFakeClockScheduling(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1700000000, 0))
+	queue := setupQueue(t, Config{Clock: clock})
+	defer queue.Close()
+
+	if _, err := queue.AddAt(clock.Now().Add(time.Hour), []byte("later")); err != nil {
+		t.Fatalf("failed to add item to queue: %v", err)
+	}
+
+	items, err := queue.Claim(1)
+	if err != nil || len(items) != 0 {
+		t.Fatalf("expected the item to be hidden, got %+v, %v", items, err)
+	}
+
+	// An hour passes instantly.
+	clock.Advance(time.Hour)
+	items, err = queue.Claim(1)
+	if err != nil || len(items) != 1 {
+		t.Fatalf("expected the item to be visible, got %+v, %v", items, err)
+	}
+}
+
+func TestFakeClockLease(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1700000000, 0))
+	queue := setupQueue(t, Config{Clock: clock, LeaseTimeout: time.Minute})
+	defer queue.Close()
+
+	if err := queue.Add([]byte("data")); err != nil {
+		t.Fatalf("failed to add item to queue: %v", err)
+	}
+	if items, err := queue.Claim(1); err != nil || len(items) != 1 {
+		t.Fatalf("failed to claim item: %+v, %v", items, err)
+	}
+	if items, err := queue.Claim(1); err != nil || len(items) != 0 {
+		t.Fatalf("expected the lease to hold, got %+v, %v", items, err)
+	}
+
+	clock.Advance(time.Minute + time.Second)
+	if items, err := queue.Claim(1); err != nil || len(items) != 1 {
+		t.Fatalf("expected the expired lease to be reclaimed, got %+v, %v", items, err)
+	}
+}
+
+func TestFakeClockListenerDelay(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1700000000, 0))
+	queue := setupQueue(t, Config{Clock: clock})
+	defer queue.Close()
+
+	if err := queue.Add([]byte("data")); err != nil {
+		t.Fatalf("failed to add item to queue: %v", err)
+	}
+
+	calls := make(chan int, 2)
+	attempt := 0
+	queue.Listener(func(item Item, delay func(sec time.Duration)) {
+		attempt++
+		calls <- attempt
+		if attempt == 1 {
+			delay(time.Hour)
+		}
+	})
+
+	select {
+	case <-calls:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected the listener to be called")
+	}
+
+	// Wait for the queue to sleep on the delay, then skip it.
+	deadline := time.Now().Add(5 * time.Second)
+	for clock.Waiters() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the queue to wait for the delay")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	clock.Advance(time.Hour)
+
+	select {
+	case n := <-calls:
+		if n != 2 {
+			t.Fatalf("expected a second attempt, got %d", n)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected the item to be retried after the delay")
+	}
+}
@@ -0,0 +1,96 @@
+// Command queuebench measures the throughput and latency of a queue under a
+// configurable load; see package queuebench.
+//
+// Usage:
+//
+//	queuebench [-file queue.db] [-duration D | -items N] [-size B] [-producers N]
+//	           [-rate R] [-workers N] [-claim-batch N] [-work D] [-fail F] [-json]
+//
+// Without -file the queue is kept in memory. An existing file is reset first.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/elum-utils/queue"
+	"github.com/elum-utils/queue/queuebench"
+)
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if err := run(ctx, os.Args[1:], os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "queuebench:", err)
+		os.Exit(1)
+	}
+}
+
+// run parses the flags, runs the benchmark and prints its report.
+func run(ctx context.Context, args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("queuebench", flag.ContinueOnError)
+	file := flags.String("file", "", "path of the queue database file (default in memory)")
+	duration := flags.Duration("duration", 10*time.Second, "how long to add items")
+	items := flags.Int("items", 0, "number of items to add, instead of -duration")
+	size := flags.Int("size", 256, "payload size in bytes")
+	producers := flags.Int("producers", 1, "goroutines adding items")
+	rate := flags.Float64("rate", 0, "items added per second (default unlimited)")
+	workers := flags.Int("workers", 1, "goroutines delivering items to the listener")
+	claimBatch := flags.Int("claim-batch", 0, "items claimed per round trip")
+	work := flags.Duration("work", 0, "simulated processing time per item")
+	fail := flags.Float64("fail", 0, "fraction of deliveries that fail and are retried")
+	asJSON := flags.Bool("json", false, "print the report as JSON")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	config := queue.Config{
+		LocalFile:      *file,
+		Workers:        *workers,
+		ClaimBatchSize: *claimBatch,
+		RetryPolicy:    queue.ExponentialBackoff{Initial: time.Millisecond, Max: 100 * time.Millisecond},
+		Logger:         log.New(io.Discard, "", 0),
+	}
+	if *file != "" {
+		config.Reset = true
+		config.JournalMode = "WAL"
+	}
+	q, err := queue.New(config)
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+
+	cfg := queuebench.Config{
+		Items:       *items,
+		PayloadSize: *size,
+		Producers:   *producers,
+		Rate:        *rate,
+		Work:        *work,
+		FailureRate: *fail,
+	}
+	if *items <= 0 {
+		cfg.Duration = *duration
+	}
+
+	report, err := queuebench.Run(ctx, q, cfg)
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	}
+	_, err = fmt.Fprint(stdout, report)
+	return err
+}
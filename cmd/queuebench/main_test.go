@@ -0,0 +1,28 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/elum-utils/queue/queuebench"
+)
+
+func TestQueuebench(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "queue.db")
+	var stdout bytes.Buffer
+	err := run(context.Background(), []string{"-file", file, "-items", "50", "-workers", "2", "-claim-batch", "8", "-json"}, &stdout)
+	if err != nil {
+		t.Fatalf("queuebench: %v", err)
+	}
+
+	var report queuebench.Report
+	if err := json.Unmarshal(stdout.Bytes(), &report); err != nil {
+		t.Fatalf("failed to decode report %q: %v", stdout.String(), err)
+	}
+	if report.Produced != 50 || report.Consumed != 50 {
+		t.Fatalf("expected 50 items produced and consumed, got %+v", report)
+	}
+}
@@ -0,0 +1,276 @@
+// Command queuectl inspects and edits a queue stored in a SQLite file.
+//
+// Usage:
+//
+//	queuectl -file queue.db [-table queue] <command> [flags] [args]
+//
+// Commands:
+//
+//	list            [-limit N] [-state S]      show item metadata
+//	peek            [-limit N]                 print the payloads of the oldest items
+//	add             [-tag T]... [data]         enqueue data, or stdin if omitted
+//	delete          <id>...                    delete items
+//	requeue         [-all] <id>...             move dead letters back to pending
+//	reset-attempts  <id>...                    give items a fresh set of attempts
+//	reprioritize    -priority P <id>...        change the priority of items
+//	purge           [-state S]...              delete all items, or those in the given states
+//	stats                                      print item counts as JSON
+//	export          [-format jsonl|csv]        write every item to stdout
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/elum-utils/queue"
+)
+
+func main() {
+	if err := run(os.Args[1:], os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "queuectl:", err)
+		os.Exit(1)
+	}
+}
+
+// command implements a subcommand operating on an open queue.
+type command func(q *queue.Queue, args []string, stdin io.Reader, stdout io.Writer) error
+
+// commands maps subcommand names to their implementations.
+var commands = map[string]command{
+	"list":           list,
+	"peek":           peek,
+	"add":            add,
+	"delete":         deleteItems,
+	"requeue":        requeue,
+	"reset-attempts": resetAttempts,
+	"reprioritize":   reprioritize,
+	"purge":          purge,
+	"stats":          stats,
+	"export":         export,
+}
+
+// run parses the global flags, opens the queue and runs the subcommand.
+func run(args []string, stdin io.Reader, stdout io.Writer) error {
+	flags := flag.NewFlagSet("queuectl", flag.ContinueOnError)
+	file := flags.String("file", "", "path of the queue database file")
+	table := flags.String("table", "", "name of the queue table (default \"queue\")")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *file == "" {
+		return errors.New("missing -file")
+	}
+	if flags.NArg() == 0 {
+		return errors.New("missing command")
+	}
+
+	cmd, ok := commands[flags.Arg(0)]
+	if !ok {
+		return fmt.Errorf("unknown command %q", flags.Arg(0))
+	}
+
+	// Refuse to create a new database when the path is mistyped.
+	if _, err := os.Stat(*file); err != nil {
+		return err
+	}
+
+	q, err := queue.New(queue.Config{LocalFile: *file, Table: *table})
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+
+	return cmd(q, flags.Args()[1:], stdin, stdout)
+}
+
+func list(q *queue.Queue, args []string, stdin io.Reader, stdout io.Writer) error {
+	flags := flag.NewFlagSet("list", flag.ContinueOnError)
+	limit := flags.Int("limit", 100, "maximum number of items to show")
+	var state stateList
+	flags.Var(&state, "state", "only show items in this state")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	var items []queue.Item
+	var err error
+	if len(state) > 0 {
+		items, _, err = q.Admin().ListByState(state[len(state)-1], *limit, 0)
+	} else {
+		items, err = q.Get(*limit)
+	}
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tSTATE\tPRIORITY\tATTEMPTS\tBYTES\tTAGS")
+	for _, item := range items {
+		fmt.Fprintf(w, "%d\t%s\t%d\t%d\t%d\t%s\n", item.ID, item.State, item.Priority, item.Attempts, len(item.Data), strings.Join(item.Tags, ","))
+	}
+	return w.Flush()
+}
+
+func peek(q *queue.Queue, args []string, stdin io.Reader, stdout io.Writer) error {
+	flags := flag.NewFlagSet("peek", flag.ContinueOnError)
+	limit := flags.Int("limit", 1, "number of items to print")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	items, err := q.Get(*limit)
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		fmt.Fprintf(stdout, "%d\t%s\n", item.ID, item.Data)
+	}
+	return nil
+}
+
+func add(q *queue.Queue, args []string, stdin io.Reader, stdout io.Writer) error {
+	flags := flag.NewFlagSet("add", flag.ContinueOnError)
+	var tags tagList
+	flags.Var(&tags, "tag", "tag to attach to the item (repeatable)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	var data []byte
+	if flags.NArg() > 0 {
+		data = []byte(strings.Join(flags.Args(), " "))
+	} else {
+		var err error
+		if data, err = io.ReadAll(stdin); err != nil {
+			return err
+		}
+	}
+	return q.AddTagged(data, tags...)
+}
+
+func deleteItems(q *queue.Queue, args []string, stdin io.Reader, stdout io.Writer) error {
+	return forEachID(args, q.Delete)
+}
+
+func requeue(q *queue.Queue, args []string, stdin io.Reader, stdout io.Writer) error {
+	flags := flag.NewFlagSet("requeue", flag.ContinueOnError)
+	all := flags.Bool("all", false, "requeue every dead letter")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if !*all {
+		return forEachID(flags.Args(), q.Requeue)
+	}
+
+	requeued, err := q.Admin().RequeueAll()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "requeued %d items\n", requeued)
+	return nil
+}
+
+func resetAttempts(q *queue.Queue, args []string, stdin io.Reader, stdout io.Writer) error {
+	return forEachID(args, q.Admin().ResetAttempts)
+}
+
+func reprioritize(q *queue.Queue, args []string, stdin io.Reader, stdout io.Writer) error {
+	flags := flag.NewFlagSet("reprioritize", flag.ContinueOnError)
+	priority := flags.Int("priority", 0, "new priority of the items")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	return forEachID(flags.Args(), func(id int) error {
+		return q.Admin().Reprioritize(id, *priority)
+	})
+}
+
+func purge(q *queue.Queue, args []string, stdin io.Reader, stdout io.Writer) error {
+	flags := flag.NewFlagSet("purge", flag.ContinueOnError)
+	var states stateList
+	flags.Var(&states, "state", "only purge items in this state (repeatable)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	purged, err := q.Purge(states...)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "purged %d items\n", purged)
+	return nil
+}
+
+func stats(q *queue.Queue, args []string, stdin io.Reader, stdout io.Writer) error {
+	stats, err := q.Stats()
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(stats)
+}
+
+func export(q *queue.Queue, args []string, stdin io.Reader, stdout io.Writer) error {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := flags.String("format", string(queue.FormatJSONLines), "output format: jsonl or csv")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	return q.Export(context.Background(), stdout, queue.Format(*format))
+}
+
+// forEachID parses every argument as an item ID and calls fn with it.
+func forEachID(args []string, fn func(id int) error) error {
+	if len(args) == 0 {
+		return errors.New("missing item ID")
+	}
+
+	for _, arg := range args {
+		id, err := strconv.Atoi(arg)
+		if err != nil {
+			return fmt.Errorf("invalid item ID %q", arg)
+		}
+		if err := fn(id); err != nil {
+			return fmt.Errorf("item %d: %w", id, err)
+		}
+	}
+	return nil
+}
+
+// tagList collects repeated -tag flags.
+type tagList []string
+
+func (l *tagList) String() string { return strings.Join(*l, ",") }
+
+func (l *tagList) Set(tag string) error {
+	*l = append(*l, tag)
+	return nil
+}
+
+// stateList collects repeated -state flags.
+type stateList []queue.State
+
+func (l *stateList) String() string { return fmt.Sprint(*l) }
+
+func (l *stateList) Set(state string) error {
+	switch s := queue.State(state); s {
+	case queue.StatePending, queue.StateInFlight, queue.StateDead:
+		*l = append(*l, s)
+		return nil
+	default:
+		return fmt.Errorf("unknown state %q", state)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/elum-utils/queue"
+)
+
+func TestQueuectl(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "queue.db")
+	q, err := queue.New(queue.Config{LocalFile: file})
+	if err != nil {
+		t.Fatalf("failed to initialize queue: %v", err)
+	}
+	q.Close()
+
+	ctl := func(args ...string) string {
+		t.Helper()
+		var stdout bytes.Buffer
+		if err := run(append([]string{"-file", file}, args...), strings.NewReader("from stdin"), &stdout); err != nil {
+			t.Fatalf("queuectl %v: %v", args, err)
+		}
+		return stdout.String()
+	}
+
+	ctl("add", "-tag", "email", "hello")
+	ctl("add")
+
+	if out := ctl("peek", "-limit", "2"); out != "1\thello\n2\tfrom stdin\n" {
+		t.Fatalf("unexpected peek output: %q", out)
+	}
+	if out := ctl("list"); !strings.Contains(out, "pending") || !strings.Contains(out, "email") {
+		t.Fatalf("unexpected list output: %q", out)
+	}
+
+	ctl("delete", "1")
+	if out := ctl("stats"); !strings.Contains(out, `"pending": 1`) {
+		t.Fatalf("unexpected stats output: %q", out)
+	}
+
+	if out := ctl("purge"); out != "purged 1 items\n" {
+		t.Fatalf("unexpected purge output: %q", out)
+	}
+	if out := ctl("export"); out != "" {
+		t.Fatalf("expected an empty export, got %q", out)
+	}
+}
+
+func TestQueuectlMissingFile(t *testing.T) {
+	var stdout bytes.Buffer
+	err := run([]string{"-file", filepath.Join(t.TempDir(), "missing.db"), "stats"}, nil, &stdout)
+	if err == nil {
+		t.Fatalf("expected an error for a missing database file")
+	}
+}
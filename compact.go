@@ -0,0 +1,90 @@
+package queue
+
+import (
+	"context"
+	"database/sql"
+)
+
+// StorageInfo describes the size of the database and how much of it is unused.
+type StorageInfo struct {
+	PageSize      int64 // Size of a database page in bytes.
+	PageCount     int64 // Total number of pages in the database.
+	FreelistCount int64 // Number of unused pages that Compact can reclaim.
+	Incremental   bool  // Whether the database uses auto_vacuum=INCREMENTAL.
+}
+
+// Size returns the total size of the database in bytes.
+func (s StorageInfo) Size() int64 {
+	return s.PageSize * s.PageCount
+}
+
+// FreeBytes returns the number of bytes held by unused pages.
+func (s StorageInfo) FreeBytes() int64 {
+	return s.PageSize * s.FreelistCount
+}
+
+// Storage reports the current database size and freelist pages.
+func (c *Queue) Storage(ctx context.Context) (StorageInfo, error) {
+	c.mx.Lock() // Lock for exclusive access to the queue.
+	defer c.mx.Unlock()
+
+	return storageInfo(ctx, c.db)
+}
+
+// storageInfo reads the page statistics of the database.
+func storageInfo(ctx context.Context, db *sql.DB) (StorageInfo, error) {
+	var info StorageInfo
+	var autoVacuum int
+
+	pragmas := []struct {
+		name  string
+		value any
+	}{
+		{"page_size", &info.PageSize},
+		{"page_count", &info.PageCount},
+		{"freelist_count", &info.FreelistCount},
+		{"auto_vacuum", &autoVacuum},
+	}
+	for _, p := range pragmas {
+		if err := db.QueryRowContext(ctx, "PRAGMA "+p.name).Scan(p.value); err != nil {
+			return StorageInfo{}, err
+		}
+	}
+
+	info.Incremental = autoVacuum == 2 // 0 = NONE, 1 = FULL, 2 = INCREMENTAL.
+	return info, nil
+}
+
+// Compact returns unused pages to the file system. Databases created with
+// auto_vacuum=INCREMENTAL release their free pages in place, others are rebuilt
+// with VACUUM. The dispatcher and other operations wait while compaction runs.
+func (c *Queue) Compact(ctx context.Context) error {
+	c.mx.Lock() // Lock for exclusive access to the queue.
+	defer c.mx.Unlock()
+
+	return compactDatabase(ctx, c.db)
+}
+
+// compactDatabase reclaims the free pages of the database.
+func compactDatabase(ctx context.Context, db *sql.DB) error {
+	info, err := storageInfo(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	if info.Incremental {
+		// The pragma frees one page per step, so drain it as a query rather than executing it once.
+		rows, err := db.QueryContext(ctx, "PRAGMA incremental_vacuum")
+		if err != nil {
+			return err
+		}
+		defer rows.Close() // Ensure rows are closed after processing.
+
+		for rows.Next() {
+		}
+		return rows.Err()
+	}
+
+	_, err = db.ExecContext(ctx, "VACUUM")
+	return err
+}
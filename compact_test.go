@@ -0,0 +1,49 @@
+package queue
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+func TestCompact(t *testing.T) {
+	for _, autoVacuum := range []string{"", "INCREMENTAL"} {
+		queue := setupQueue(t, Config{
+			LocalFile:  filepath.Join(t.TempDir(), "queue.db"),
+			AutoVacuum: autoVacuum,
+		})
+
+		payload := make([]byte, 64*1024)
+		for i := 0; i < 20; i++ {
+			if err := queue.Add(payload); err != nil {
+				t.Fatalf("failed to add item to queue: %v", err)
+			}
+		}
+		for i := 1; i <= 20; i++ {
+			if err := queue.Delete(i); err != nil {
+				t.Fatalf("failed to delete item from queue: %v", err)
+			}
+		}
+
+		before, err := queue.Storage(context.Background())
+		if err != nil {
+			t.Fatalf("failed to read storage info: %v", err)
+		}
+		if before.FreelistCount == 0 || before.Incremental != (autoVacuum != "") {
+			t.Fatalf("unexpected storage info before compaction: %+v", before)
+		}
+
+		if err := queue.Compact(context.Background()); err != nil {
+			t.Fatalf("failed to compact queue: %v", err)
+		}
+
+		after, err := queue.Storage(context.Background())
+		if err != nil {
+			t.Fatalf("failed to read storage info: %v", err)
+		}
+		if after.FreelistCount != 0 || after.Size() >= before.Size() {
+			t.Fatalf("expected compaction to shrink the database: before %+v, after %+v", before, after)
+		}
+		queue.Close()
+	}
+}
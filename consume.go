@@ -0,0 +1,83 @@
+package queue
+
+import (
+	"context"
+	"time"
+)
+
+// Claim marks up to 'limit' pending items as in-flight for this queue instance
+// and returns them, for consumers that pull items instead of registering a
+// listener. The receipt of every claimed item must be passed to AckReceipt
+// once processed or to NackReceipt to hand it back; otherwise it is claimed
+// again when its lease expires.
+func (c *Queue) Claim(limit int) ([]Item, error) {
+	return c.claim(limit, nil)
+}
+
+// claimPollInterval is how often ClaimWait looks for items that arrived
+// without a signal, such as those committed through AddTx.
+const claimPollInterval = time.Second
+
+// ClaimWait claims up to 'limit' items like Claim, blocking until at least one
+// item is claimed or maxWait elapses. It returns no items and no error if the
+// wait times out, and the context error if ctx is done first.
+func (c *Queue) ClaimWait(ctx context.Context, limit int, maxWait time.Duration) ([]Item, error) {
+	timeout := c.cfg.Clock.After(maxWait)
+
+	ticker := c.cfg.Clock.NewTicker(claimPollInterval)
+	defer ticker.Stop()
+
+	for {
+		c.mx.Lock()
+		added := c.added
+		c.mx.Unlock()
+
+		items, err := c.claim(limit, nil)
+		if err != nil || len(items) > 0 {
+			return items, err
+		}
+
+		// Wait for a producer to add an item before trying again. Leases held
+		// by crashed consumers are picked up when the wait times out.
+		select {
+		case <-added:
+		case <-ticker.C():
+		case <-timeout:
+			return c.claim(limit, nil)
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Ack removes an item claimed by this queue instance once it has been processed.
+// It returns ErrItemNotFound if the item is not held by this instance, e.g.
+// because its lease expired and another consumer claimed it.
+//
+// Deprecated: Ack cannot tell a newer delivery to this same instance apart
+// and may remove an item another consumer is processing. Use AckReceipt.
+func (c *Queue) Ack(id int) error {
+	return c.ackWith(id, completion{})
+}
+
+// Release hands an item claimed by this queue instance back to the queue so it
+// can be claimed again. It returns ErrItemNotFound if the item is not held by
+// this instance.
+//
+// Deprecated: like Ack, Release may hand back a newer delivery of the item.
+// Use NackReceipt.
+func (c *Queue) Release(id int) error {
+	c.mx.Lock() // Lock for exclusive access to the queue.
+	defer c.mx.Unlock()
+
+	released, err := c.transition(id, TransitionReleased, "", c.stmts.release, id, c.owner, nil)
+	if err != nil {
+		return err
+	}
+	if !released {
+		return ErrItemNotFound
+	}
+
+	c.signalAdded()
+	return nil
+}
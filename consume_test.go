@@ -0,0 +1,67 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestClaimAckRelease(t *testing.T) {
+	queue := setupQueue(t, Config{})
+	defer queue.Close()
+
+	for i := 0; i < 2; i++ {
+		if err := queue.Add([]byte("test data")); err != nil {
+			t.Fatalf("failed to add item to queue: %v", err)
+		}
+	}
+
+	items, err := queue.Claim(10)
+	if err != nil {
+		t.Fatalf("failed to claim items: %v", err)
+	}
+	if len(items) != 2 || items[0].State != StateInFlight {
+		t.Fatalf("expected 2 in-flight items, got %+v", items)
+	}
+
+	// Claimed items are not handed out twice.
+	if again, err := queue.Claim(10); err != nil || len(again) != 0 {
+		t.Fatalf("expected no claimable items, got %d (err %v)", len(again), err)
+	}
+
+	if err := queue.Ack(items[0].ID); err != nil {
+		t.Fatalf("failed to ack item: %v", err)
+	}
+	if err := queue.Ack(items[0].ID); !errors.Is(err, ErrItemNotFound) {
+		t.Fatalf("expected ErrItemNotFound acking twice, got %v", err)
+	}
+
+	if err := queue.Release(items[1].ID); err != nil {
+		t.Fatalf("failed to release item: %v", err)
+	}
+	again, err := queue.Claim(10)
+	if err != nil || len(again) != 1 || again[0].ID != items[1].ID {
+		t.Fatalf("expected the released item to be claimable, got %+v (err %v)", again, err)
+	}
+}
+
+func TestClaimWait(t *testing.T) {
+	queue := setupQueue(t, Config{})
+	defer queue.Close()
+
+	items, err := queue.ClaimWait(context.Background(), 1, 50*time.Millisecond)
+	if err != nil || len(items) != 0 {
+		t.Fatalf("expected timeout with no items, got %d (err %v)", len(items), err)
+	}
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		queue.Add([]byte("late"))
+	}()
+
+	items, err = queue.ClaimWait(context.Background(), 1, 5*time.Second)
+	if err != nil || len(items) != 1 || string(items[0].Data) != "late" {
+		t.Fatalf("expected the late item, got %+v (err %v)", items, err)
+	}
+}
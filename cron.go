@@ -0,0 +1,222 @@
+package queue
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// cronPollInterval is how often the queue looks for recurring jobs that are due.
+const cronPollInterval = time.Second
+
+// CronJob is a recurring job registered with AddCron.
+type CronJob struct {
+	Name    string    // Unique name of the job.
+	Spec    string    // Cron expression, e.g. "*/5 * * * *" or "@hourly".
+	Data    []byte    // Payload of every enqueued item.
+	Tags    []string  // Tags of every enqueued item.
+	NextRun time.Time // When the job fires next.
+}
+
+// dueCronJob is a recurring job read while firing.
+type dueCronJob struct {
+	name    string
+	spec    string
+	data    []byte
+	tags    sql.NullString
+	nextRun int64
+}
+
+// createCronTable creates the table holding the recurring jobs.
+func createCronTable(tx *sql.Tx, t tables) error {
+	_, err := tx.Exec(`
+        CREATE TABLE IF NOT EXISTS ` + t.cron + ` (
+            name TEXT PRIMARY KEY,
+            spec TEXT NOT NULL,
+            data BLOB NOT NULL,
+            tags TEXT,
+            next_run INTEGER NOT NULL
+        );
+    `)
+	return err
+}
+
+// AddCron registers a recurring job enqueuing an item with the given data and
+// tags every time the cron expression fires, replacing any job with the same
+// name. The expression has the five standard fields or is a descriptor such
+// as "@daily" or "@every 10m"; times are local unless it starts with
+// "CRON_TZ=<zone>". Jobs are stored in the database, so they survive restarts,
+// and each firing is enqueued once even when several processes share the file.
+func (c *Queue) AddCron(name, spec string, data []byte, tags ...string) error {
+	schedule, err := cron.ParseStandard(spec)
+	if err != nil {
+		return fmt.Errorf("queue: invalid cron expression %q: %w", spec, err)
+	}
+
+	encoded, err := encodeTags(tags)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.db.ExecContext(
+		c.ctx,
+		"INSERT INTO "+c.tables.cron+"(`name`, `spec`, `data`, `tags`, `next_run`) VALUES (?, ?, ?, ?, ?)"+
+			" ON CONFLICT(`name`) DO UPDATE SET `spec` = excluded.`spec`, `data` = excluded.`data`, `tags` = excluded.`tags`, `next_run` = excluded.`next_run`",
+		name, spec, data, encoded, schedule.Next(c.cfg.Clock.Now()).UnixNano(),
+	)
+	return err
+}
+
+// RemoveCron unregisters a recurring job. Items it already enqueued stay in
+// the queue. It returns ErrCronNotFound if no job has the given name.
+func (c *Queue) RemoveCron(name string) error {
+	res, err := c.db.ExecContext(c.ctx, "DELETE FROM "+c.tables.cron+" WHERE name = ?", name)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrCronNotFound
+	}
+	return nil
+}
+
+// CronJobs returns the registered recurring jobs ordered by name.
+func (c *Queue) CronJobs() ([]CronJob, error) {
+	rows, err := c.db.QueryContext(c.ctx, "SELECT `name`, `spec`, `data`, `tags`, `next_run` FROM "+c.tables.cron+" ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close() // Ensure rows are closed after processing.
+
+	var jobs []CronJob
+	for rows.Next() {
+		var job CronJob
+		var tags sql.NullString
+		var nextRun int64
+		if err := rows.Scan(&job.Name, &job.Spec, &job.Data, &tags, &nextRun); err != nil {
+			return nil, err
+		}
+		if job.Tags, err = decodeTags(tags.String); err != nil {
+			return nil, err
+		}
+		job.NextRun = time.Unix(0, nextRun)
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+// runCron fires due recurring jobs until the queue is closed.
+func (c *Queue) runCron() {
+	ticker := c.cfg.Clock.NewTicker(cronPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C():
+			if c.draining.Load() {
+				continue // Draining queues accept no new items.
+			}
+			if err := c.fireCronJobs(c.cfg.Clock.Now()); err != nil && c.ctx.Err() == nil {
+				c.cfg.Logger.Println("Error firing cron jobs:", err)
+			}
+		}
+	}
+}
+
+// fireCronJobs enqueues an item for every recurring job due at 'now' and
+// moves the job to its next run. Firings missed while no process was running
+// are collapsed into one. Each job is advanced with a conditional UPDATE in
+// the same transaction as the insert, so a firing another process already
+// handled is skipped. If an item cannot be added, e.g. because the queue is
+// full, nothing is committed and the jobs are retried on the next poll.
+func (c *Queue) fireCronJobs(now time.Time) error {
+	var enqueued []Item
+	c.mx.Lock() // Lock for exclusive access to the queue.
+	err := c.withTx(func(tx *sql.Tx) error {
+		due, err := dueCronJobs(tx, c.tables.cron, now)
+		if err != nil {
+			return err
+		}
+
+		for _, job := range due {
+			schedule, err := cron.ParseStandard(job.spec)
+			if err != nil {
+				return fmt.Errorf("queue: cron job %q: %w", job.name, err)
+			}
+
+			res, err := tx.Exec(
+				"UPDATE "+c.tables.cron+" SET next_run = ? WHERE name = ? AND next_run = ?",
+				schedule.Next(now).UnixNano(), job.name, job.nextRun,
+			)
+			if err != nil {
+				return err
+			}
+			n, err := res.RowsAffected()
+			if err != nil {
+				return err
+			}
+			if n == 0 {
+				continue // Another process fired the job.
+			}
+
+			var encoded any
+			if job.tags.Valid {
+				encoded = job.tags.String
+			}
+			id, err := c.insertItem(tx, job.data, encoded, addOptions{}, c.cfg.Overflow)
+			switch {
+			case errors.Is(err, errDropped):
+				continue // The overflow policy discarded the item.
+			case err != nil:
+				return err
+			}
+
+			tags, err := decodeTags(job.tags.String)
+			if err != nil {
+				return err
+			}
+			enqueued = append(enqueued, Item{ID: id, Data: job.data, Tags: tags, State: StatePending})
+		}
+		return nil
+	})
+	c.mx.Unlock()
+	if err != nil {
+		return err
+	}
+
+	for _, item := range enqueued {
+		c.cfg.Hooks.enqueued(item)
+	}
+	c.count(MetricEnqueued, len(enqueued))
+	return nil
+}
+
+// dueCronJobs returns the recurring jobs due at 'now', closing the rows
+// before the caller issues further statements.
+func dueCronJobs(tx *sql.Tx, table string, now time.Time) ([]dueCronJob, error) {
+	rows, err := tx.Query("SELECT `name`, `spec`, `data`, `tags`, `next_run` FROM "+table+" WHERE next_run <= ?", now.UnixNano())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close() // Ensure rows are closed after processing.
+
+	var due []dueCronJob
+	for rows.Next() {
+		var job dueCronJob
+		if err := rows.Scan(&job.name, &job.spec, &job.data, &job.tags, &job.nextRun); err != nil {
+			return nil, err
+		}
+		due = append(due, job)
+	}
+	return due, rows.Err()
+}
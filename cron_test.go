@@ -0,0 +1,93 @@
+package queue
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCron(t *testing.T) {
+	queue := setupQueue(t, Config{})
+	defer queue.Close()
+
+	if err := queue.AddCron("report", "not a schedule", []byte("x")); err == nil {
+		t.Fatal("expected an invalid expression to be rejected")
+	}
+	if err := queue.AddCron("report", "@every 1h", []byte("build report"), "reports"); err != nil {
+		t.Fatalf("failed to add cron job: %v", err)
+	}
+
+	jobs, err := queue.CronJobs()
+	if err != nil {
+		t.Fatalf("failed to list cron jobs: %v", err)
+	}
+	if len(jobs) != 1 || jobs[0].Spec != "@every 1h" || jobs[0].Tags[0] != "reports" {
+		t.Fatalf("unexpected cron jobs: %+v", jobs)
+	}
+
+	// Nothing is due yet.
+	if err := queue.fireCronJobs(time.Now()); err != nil {
+		t.Fatalf("failed to fire cron jobs: %v", err)
+	}
+	if stats, _ := queue.Stats(); stats.Pending != 0 {
+		t.Fatalf("expected no items before the job is due, got %+v", stats)
+	}
+
+	// Fire as if two hours passed; the missed runs collapse into one item.
+	later := jobs[0].NextRun.Add(time.Hour)
+	if err := queue.fireCronJobs(later); err != nil {
+		t.Fatalf("failed to fire cron jobs: %v", err)
+	}
+	if err := queue.fireCronJobs(later); err != nil {
+		t.Fatalf("failed to fire cron jobs: %v", err)
+	}
+
+	items, err := queue.Get(10)
+	if err != nil {
+		t.Fatalf("failed to get items: %v", err)
+	}
+	if len(items) != 1 || string(items[0].Data) != "build report" || items[0].Tags[0] != "reports" {
+		t.Fatalf("unexpected items: %+v", items)
+	}
+
+	jobs, _ = queue.CronJobs()
+	if !jobs[0].NextRun.After(later) {
+		t.Fatalf("expected the next run after %v, got %v", later, jobs[0].NextRun)
+	}
+
+	if err := queue.RemoveCron("report"); err != nil {
+		t.Fatalf("failed to remove cron job: %v", err)
+	}
+	if err := queue.RemoveCron("report"); !errors.Is(err, ErrCronNotFound) {
+		t.Fatalf("expected ErrCronNotFound, got %v", err)
+	}
+}
+
+func TestCronSharedDatabase(t *testing.T) {
+	path := t.TempDir() + "/queue.db"
+	first := setupQueue(t, Config{LocalFile: path, JournalMode: "WAL"})
+	defer first.Close()
+	second := setupQueue(t, Config{LocalFile: path, JournalMode: "WAL"})
+	defer second.Close()
+
+	if err := first.AddCron("tick", "@every 1m", []byte("tick")); err != nil {
+		t.Fatalf("failed to add cron job: %v", err)
+	}
+
+	// Both processes see the job as due; only one of them enqueues it.
+	due := time.Now().Add(2 * time.Minute)
+	if err := first.fireCronJobs(due); err != nil {
+		t.Fatalf("failed to fire cron jobs: %v", err)
+	}
+	if err := second.fireCronJobs(due); err != nil {
+		t.Fatalf("failed to fire cron jobs: %v", err)
+	}
+
+	stats, err := first.Stats()
+	if err != nil {
+		t.Fatalf("failed to read stats: %v", err)
+	}
+	if stats.Pending != 1 {
+		t.Fatalf("expected a single item, got %+v", stats)
+	}
+}
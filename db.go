@@ -0,0 +1,39 @@
+package queue
+
+import (
+	"context"
+	"database/sql"
+)
+
+// DB returns the underlying database handle for ad-hoc queries, e.g. joining
+// the queue table with application tables for reporting. Statements run through
+// it bypass the queue lock; use WithTx for changes that must not interleave
+// with queue operations.
+func (c *Queue) DB() *sql.DB {
+	return c.db
+}
+
+// Table returns the name of the table holding the queued items.
+func (c *Queue) Table() string {
+	return c.tables.items
+}
+
+// WithTx runs fn inside a transaction while holding the queue lock, so no
+// Add, claim, or Delete interleaves with it. The transaction is committed if
+// fn returns nil and rolled back otherwise. fn must not call methods of the
+// queue, as the lock is not reentrant.
+func (c *Queue) WithTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	c.mx.Lock() // Lock for exclusive access to the queue.
+	defer c.mx.Unlock()
+
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,31 @@
+package queue
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+)
+
+func TestWithTx(t *testing.T) {
+	queue := setupQueue(t, Config{})
+	defer queue.Close()
+
+	if err := queue.Add([]byte("test data")); err != nil {
+		t.Fatalf("failed to add item to queue: %v", err)
+	}
+
+	if _, err := queue.DB().Exec("CREATE TABLE owners (item_id INTEGER, owner TEXT); INSERT INTO owners VALUES (1, 'alice')"); err != nil {
+		t.Fatalf("failed to create application table: %v", err)
+	}
+
+	var owner string
+	err := queue.WithTx(context.Background(), func(tx *sql.Tx) error {
+		return tx.QueryRow("SELECT o.owner FROM " + queue.Table() + " q JOIN owners o ON o.item_id = q.id").Scan(&owner)
+	})
+	if err != nil {
+		t.Fatalf("failed to run transaction: %v", err)
+	}
+	if owner != "alice" {
+		t.Fatalf("unexpected owner: %s", owner)
+	}
+}
@@ -0,0 +1,177 @@
+package queue
+
+import (
+	"context"
+	"database/sql"
+	"math"
+	"time"
+)
+
+// DeadLetters returns up to 'limit' items that used up their attempts, oldest first.
+func (c *Queue) DeadLetters(limit int) ([]Item, error) {
+	return c.listByState(StateDead, limit, 0)
+}
+
+// Requeue moves a dead letter back to pending with its attempts reset.
+// It returns ErrItemNotFound if there is no dead letter with the given ID.
+func (c *Queue) Requeue(id int) error {
+	return c.requeue(id, c.actor())
+}
+
+// requeue moves a dead letter back to pending and audits it under actor.
+func (c *Queue) requeue(id int, actor string) error {
+	c.mx.Lock() // Lock for exclusive access to the queue.
+	defer c.mx.Unlock()
+
+	requeued, err := c.transition(id, TransitionRequeued, actor, c.stmts.requeue, id)
+	if err != nil {
+		return err
+	}
+	if !requeued {
+		return ErrItemNotFound
+	}
+
+	c.signalAdded()
+	return nil
+}
+
+// ReplayFilter selects the dead letters moved back to pending by
+// ReplayDeadLetters. Zero fields match every dead letter.
+type ReplayFilter struct {
+	Tenant string               // Only dead letters of this tenant.
+	Since  time.Time            // Only items dead-lettered at or after this time.
+	Before time.Time            // Only items dead-lettered before this time.
+	Match  func(item Item) bool // Only items Match reports true for; like DeleteWhere, Data holds the first chunk of split payloads.
+	Limit  int                  // Maximum number of items replayed; 0 means all matches.
+}
+
+// ReplayOptions controls the pace of ReplayDeadLetters.
+type ReplayOptions struct {
+	BatchSize int     // Items requeued per transaction; 0 means 100.
+	Rate      float64 // Maximum items requeued per second, so listeners are not flooded; 0 means no limit.
+}
+
+// ReplayDeadLetters moves the dead letters matching filter back to pending
+// with their attempts reset, oldest first, e.g. to reprocess them after
+// fixing the bug that made them fail. Items are requeued in batches, each in
+// its own transaction, paced to opts.Rate. It returns the number of replayed
+// items, along with ctx.Err() if ctx is done before all matches are replayed.
+func (c *Queue) ReplayDeadLetters(ctx context.Context, filter ReplayFilter, opts ReplayOptions) (int, error) {
+	return c.replay(ctx, c.actor(), filter, opts)
+}
+
+// replay moves the dead letters matching filter back to pending and audits
+// it under actor.
+func (c *Queue) replay(ctx context.Context, actor string, filter ReplayFilter, opts ReplayOptions) (int, error) {
+	size := opts.BatchSize
+	if size <= 0 {
+		size = 100
+	}
+	if opts.Rate > 0 {
+		size = min(size, int(math.Ceil(opts.Rate))) // Keep bursts within a second.
+	}
+
+	replayed, after := 0, 0
+	for filter.Limit <= 0 || replayed < filter.Limit {
+		if err := ctx.Err(); err != nil {
+			return replayed, err
+		}
+
+		n := size
+		if filter.Limit > 0 {
+			n = min(n, filter.Limit-replayed)
+		}
+		requeued, last, err := c.replayBatch(actor, filter, after, n)
+		replayed += requeued
+		if err != nil || last == 0 {
+			return replayed, err
+		}
+		after = last
+
+		if opts.Rate > 0 && requeued > 0 {
+			select {
+			case <-c.cfg.Clock.After(time.Duration(float64(requeued) / opts.Rate * float64(time.Second))):
+			case <-ctx.Done():
+				return replayed, ctx.Err()
+			}
+		}
+	}
+	return replayed, nil
+}
+
+// replayBatch requeues up to n dead letters matching filter with IDs above
+// after. It returns the number of requeued items and the last ID it looked
+// at, which is 0 once no dead letters are left.
+func (c *Queue) replayBatch(actor string, filter ReplayFilter, after, n int) (int, int, error) {
+	query := "SELECT " + itemColumns + " FROM " + c.tables.items + " WHERE state = 'dead' AND id > ?"
+	args := []any{after}
+	if filter.Tenant != "" {
+		query += " AND tenant = ?"
+		args = append(args, filter.Tenant)
+	}
+	if !filter.Since.IsZero() {
+		query += " AND dead_at >= ?"
+		args = append(args, filter.Since.UnixNano())
+	}
+	if !filter.Before.IsZero() {
+		query += " AND COALESCE(dead_at, 0) < ?"
+		args = append(args, filter.Before.UnixNano())
+	}
+	query += " ORDER BY id LIMIT ?"
+	args = append(args, n)
+
+	c.mx.Lock() // Lock for exclusive access to the queue.
+	defer c.mx.Unlock()
+
+	requeued, last := 0, 0
+	err := c.withTx(func(tx *sql.Tx) error {
+		// Collect the matches and close the rows before requeueing, as the
+		// pool may only have a single connection.
+		rows, err := tx.Query(query, args...)
+		if err != nil {
+			return err
+		}
+		var ids []int
+		for rows.Next() {
+			item, err := scanItem(rows)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			last = item.ID
+			if filter.Match == nil || filter.Match(item) {
+				ids = append(ids, item.ID)
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, id := range ids {
+			before, err := c.rowSnapshot(tx, id)
+			if err != nil {
+				return err
+			}
+			if _, err := c.execTransition(tx, id, TransitionRequeued, c.stmts.requeue, id); err != nil {
+				return err
+			}
+			if err := c.snapshot(tx, id, TransitionRequeued, before); err != nil {
+				return err
+			}
+			if err := c.audit(tx, actor, TransitionRequeued, id); err != nil {
+				return err
+			}
+		}
+		requeued = len(ids)
+		return nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if requeued > 0 {
+		c.signalAdded()
+	}
+	return requeued, last, nil
+}
@@ -0,0 +1,130 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDeadLetters(t *testing.T) {
+	queue := setupQueue(t, Config{MaxAttempts: 2})
+	defer queue.Close()
+
+	if err := queue.Add([]byte("test data")); err != nil {
+		t.Fatalf("failed to add item to queue: %v", err)
+	}
+
+	// Every delivery asks for a retry, so the item uses up its attempts.
+	attempts := make(chan int, 10)
+	queue.Listener(func(item Item, delay func(sec time.Duration)) {
+		attempts <- item.Attempts
+		delay(time.Millisecond)
+	})
+
+	var dead []Item
+	for deadline := time.Now().Add(5 * time.Second); len(dead) == 0 && time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		var err error
+		if dead, err = queue.DeadLetters(10); err != nil {
+			t.Fatalf("failed to list dead letters: %v", err)
+		}
+	}
+	if len(dead) != 1 || dead[0].State != StateDead || dead[0].Attempts != 2 {
+		t.Fatalf("unexpected dead letters: %+v", dead)
+	}
+	if len(attempts) != 2 {
+		t.Fatalf("expected 2 deliveries, got %d", len(attempts))
+	}
+
+	stats, err := queue.Stats()
+	if err != nil {
+		t.Fatalf("failed to read stats: %v", err)
+	}
+	if stats.Dead != 1 || stats.Pending != 0 || stats.Bytes != int64(len("test data")) {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+
+	queue.Listener(func(item Item, delay func(sec time.Duration)) {})
+	if err := queue.Requeue(dead[0].ID); err != nil {
+		t.Fatalf("failed to requeue dead letter: %v", err)
+	}
+	if err := queue.Requeue(dead[0].ID); !errors.Is(err, ErrItemNotFound) {
+		t.Fatalf("expected ErrItemNotFound, got %v", err)
+	}
+}
+
+func TestReplayDeadLetters(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1700000000, 0))
+	queue := setupQueue(t, Config{MaxAttempts: 1, Clock: clock})
+	defer queue.Close()
+
+	for _, tag := range []string{"billing", "email", "billing", "billing"} {
+		if err := queue.AddTagged([]byte("test data"), tag); err != nil {
+			t.Fatalf("failed to add item to queue: %v", err)
+		}
+	}
+
+	// Use up the single attempt, then let the next claim dead-letter the items.
+	items, err := queue.Claim(4)
+	if err != nil {
+		t.Fatalf("failed to claim items: %v", err)
+	}
+	for _, item := range items {
+		if err := queue.Release(item.ID); err != nil {
+			t.Fatalf("failed to release item: %v", err)
+		}
+	}
+	if _, err := queue.Claim(4); err != nil {
+		t.Fatalf("failed to claim items: %v", err)
+	}
+
+	ctx := context.Background()
+	billing := ReplayFilter{Match: func(item Item) bool { return HasTag("billing")(item.Tags) }, Limit: 1}
+	if n, err := queue.ReplayDeadLetters(ctx, billing, ReplayOptions{}); err != nil || n != 1 {
+		t.Fatalf("expected 1 replayed item, got %d, %v", n, err)
+	}
+
+	// At one item per second, the second batch waits for the clock.
+	billing.Limit = 0
+	done := make(chan int)
+	go func() {
+		n, err := queue.ReplayDeadLetters(ctx, billing, ReplayOptions{Rate: 1})
+		if err != nil {
+			t.Errorf("failed to replay dead letters: %v", err)
+		}
+		done <- n
+	}()
+	for clock.Waiters() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case <-done:
+		t.Fatalf("expected the replay to be rate-limited")
+	default:
+	}
+	for n := 0; n == 0; {
+		clock.Advance(time.Second)
+		select {
+		case n = <-done:
+			if n != 2 {
+				t.Fatalf("expected 2 replayed items, got %d", n)
+			}
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	dead, err := queue.DeadLetters(10)
+	if err != nil || len(dead) != 1 || dead[0].Tags[0] != "email" {
+		t.Fatalf("expected the email item to stay dead, got %+v, %v", dead, err)
+	}
+	stats, err := queue.Stats()
+	if err != nil || stats.Pending != 3 {
+		t.Fatalf("expected 3 pending items, got %+v, %v", stats, err)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := queue.ReplayDeadLetters(cancelled, ReplayFilter{}, ReplayOptions{}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
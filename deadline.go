@@ -0,0 +1,61 @@
+package queue
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// AddBefore inserts a new item with the given tags that must be processed
+// before 'deadline', e.g. a notification that is pointless once late, and
+// returns its ID. If the deadline passes before a consumer claims the item,
+// the item expires instead of being delivered: it is removed, or moved to the
+// dead letters with the failure "expired" if Config.DeadLetterExpired is set.
+// A delivery that started in time is not interrupted, but an item whose lease
+// runs out after the deadline is not delivered again. The Add middleware and
+// the overflow policy apply as for AddTagged; the ID is 0 if the policy
+// discarded the item.
+func (c *Queue) AddBefore(deadline time.Time, data []byte, tags ...string) (int, error) {
+	opts := &addOptions{expiresAt: deadline.UnixNano()}
+	ctx := context.WithValue(c.ctx, addOptionsKey{}, opts)
+	if err := c.enqueue(ctx, data, tags, c.cfg.Overflow); err != nil {
+		return 0, err
+	}
+	return opts.id, nil
+}
+
+// expiredTransition returns the transition recorded for expired items.
+func (c *Queue) expiredTransition() string {
+	if c.cfg.DeadLetterExpired {
+		return TransitionDeadLettered
+	}
+	return TransitionExpired
+}
+
+// expire expires a claimable item whose deadline passed at 'now', given in
+// Unix nanoseconds, and reports whether it did. It must be called with the
+// queue locked.
+func (c *Queue) expire(id int, now int64) (bool, error) {
+	expired, err := c.transition(id, c.expiredTransition(), "", c.stmts.expire, now, id)
+	if expired {
+		c.count(MetricExpired, 1)
+		if !c.cfg.DeadLetterExpired {
+			c.signalFreed()
+		}
+	}
+	return expired, err
+}
+
+// recordExpired records the transitions of the items expired by the
+// expireAll statement. It must be called with the queue locked.
+func (c *Queue) recordExpired(tx *sql.Tx, items []Item) error {
+	for _, item := range items {
+		if err := c.snapshot(tx, item.ID, c.expiredTransition(), nil); err != nil {
+			return err
+		}
+	}
+	if len(items) > 0 && !c.cfg.DeadLetterExpired {
+		c.signalFreed()
+	}
+	return nil
+}
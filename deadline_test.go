@@ -0,0 +1,74 @@
+package queue
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAddBefore(t *testing.T) {
+	for name, config := range map[string]Config{
+		"atomic":   {},
+		"per item": {Debug: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			clock := NewFakeClock(time.Unix(1700000000, 0))
+			config.Clock = clock
+			queue := setupQueue(t, config)
+			defer queue.Close()
+
+			deadline := clock.Now().Add(time.Minute)
+			if _, err := queue.AddBefore(deadline, []byte("notification")); err != nil {
+				t.Fatalf("failed to add item to queue: %v", err)
+			}
+			if err := queue.Add([]byte("report")); err != nil {
+				t.Fatalf("failed to add item to queue: %v", err)
+			}
+
+			items, err := queue.Get(10)
+			if err != nil || len(items) != 2 || !items[0].Deadline.Equal(deadline) || !items[1].Deadline.IsZero() {
+				t.Fatalf("expected the deadline to be stored, got %+v, %v", items, err)
+			}
+
+			clock.Advance(2 * time.Minute)
+			items, err = queue.Claim(10)
+			if err != nil || len(items) != 1 || string(items[0].Data) != "report" {
+				t.Fatalf("expected only the item without a deadline, got %+v, %v", items, err)
+			}
+
+			stats, err := queue.Stats()
+			if err != nil || stats.Pending != 0 || stats.Dead != 0 {
+				t.Fatalf("expected the expired item to be removed, got %+v, %v", stats, err)
+			}
+		})
+	}
+}
+
+func TestAddBeforeDeadLetter(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1700000000, 0))
+	queue := setupQueue(t, Config{Clock: clock, DeadLetterExpired: true})
+	defer queue.Close()
+
+	id, err := queue.AddBefore(clock.Now().Add(time.Minute), []byte("notification"))
+	if err != nil {
+		t.Fatalf("failed to add item to queue: %v", err)
+	}
+
+	// Items claimed in time are delivered.
+	clock.Advance(30 * time.Second)
+	items, err := queue.Claim(1)
+	if err != nil || len(items) != 1 {
+		t.Fatalf("expected the item to be delivered before its deadline, got %+v, %v", items, err)
+	}
+	if err := queue.Release(id); err != nil {
+		t.Fatalf("failed to release item: %v", err)
+	}
+
+	clock.Advance(time.Minute)
+	if items, err := queue.Claim(1); err != nil || len(items) != 0 {
+		t.Fatalf("expected the expired item not to be delivered, got %+v, %v", items, err)
+	}
+	dead, err := queue.DeadLetters(10)
+	if err != nil || len(dead) != 1 || dead[0].ID != id {
+		t.Fatalf("expected the expired item in the dead letters, got %+v, %v", dead, err)
+	}
+}
@@ -0,0 +1,157 @@
+package queue
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// Transitions recorded in the debug snapshot table.
+const (
+	TransitionEnqueued      = "enqueued"      // The item was added to the queue.
+	TransitionAcked         = "acked"         // The item was processed by the listener and removed.
+	TransitionDeleted       = "deleted"       // The item was removed explicitly via Delete.
+	TransitionCancelled     = "cancelled"     // The item was withdrawn via Cancel before being processed.
+	TransitionEvicted       = "evicted"       // The item was dropped by OverflowDropOldest to make room.
+	TransitionClaimed       = "claimed"       // The item was handed to a listener.
+	TransitionReleased      = "released"      // The listener asked for a delay and the item went back to pending.
+	TransitionDeadLettered  = "dead-lettered" // The item used up its attempts and moved to the dead letters.
+	TransitionRequeued      = "requeued"      // A dead letter was moved back to pending.
+	TransitionReset         = "reset"         // The attempts counter was reset via Admin.
+	TransitionReprioritized = "reprioritized" // The priority was changed via Admin.
+	TransitionArchived      = "archived"      // The dead letter was handed to an archive and removed.
+	TransitionRescheduled   = "rescheduled"   // A scheduled item was moved to a different time.
+	TransitionQuarantined   = "quarantined"   // The item crashed or timed out too often, or its payload is corrupted, and was set aside.
+	TransitionUnquarantined = "unquarantined" // A quarantined item was moved back to pending.
+	TransitionErased        = "erased"        // The item was removed by Admin.Erase along with its history.
+	TransitionRedacted      = "redacted"      // The payload of the item was emptied by Admin.Erase.
+	TransitionUpdated       = "updated"       // The payload of the item was replaced with Update.
+	TransitionConsumed      = "consumed"      // The item was removed as it was claimed; see AtMostOnce.
+	TransitionExpired       = "expired"       // The deadline of the item passed before it was claimed, and it was removed; see AddBefore.
+)
+
+// Snapshot captures the state of an item row before and after a single transition.
+// Before is nil for items that did not exist yet, After is nil for removed items.
+type Snapshot struct {
+	ID         int             // Sequence number of the snapshot.
+	ItemID     int             // Identifier of the item the transition applies to.
+	Transition string          // Name of the transition, e.g. TransitionEnqueued.
+	Before     json.RawMessage // Row state before the transition, encoded as a JSON object.
+	After      json.RawMessage // Row state after the transition, encoded as a JSON object.
+	CreatedAt  time.Time       // Time the transition happened.
+}
+
+// createDebugTable creates the table holding transition snapshots if it does not exist.
+func createDebugTable(tx *sql.Tx, t tables) error {
+	_, err := tx.Exec(`
+        CREATE TABLE IF NOT EXISTS ` + t.debug + ` (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            item_id INTEGER NOT NULL,
+            transition TEXT NOT NULL,
+            before BLOB,
+            after BLOB,
+            created_at INTEGER NOT NULL
+        );
+    `)
+	return err
+}
+
+// rowSnapshot returns the current row of the item encoded as a JSON object.
+// It returns nil when debug mode is off or the item does not exist.
+func (c *Queue) rowSnapshot(tx *sql.Tx, id int) ([]byte, error) {
+	if !c.cfg.Debug {
+		return nil, nil
+	}
+
+	rows, err := tx.Query("SELECT * FROM "+c.tables.items+" WHERE id = ?", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close() // Ensure rows are closed after processing.
+
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	// Scan every column generically so new columns show up without changes here.
+	values := make([]any, len(columns))
+	pointers := make([]any, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	if err := rows.Scan(pointers...); err != nil {
+		return nil, err
+	}
+
+	row := make(map[string]any, len(columns))
+	for i, column := range columns {
+		row[column] = values[i]
+	}
+	return json.Marshal(row)
+}
+
+// snapshot records a transition of the item, reading its current row as the after state.
+// Old snapshots beyond the configured retention are pruned. The transition is
+// also appended to the change feed, as every transition passes through here.
+func (c *Queue) snapshot(tx *sql.Tx, id int, transition string, before []byte) error {
+	if err := c.recordEvent(tx, id, transition); err != nil {
+		return err
+	}
+	if !c.cfg.Debug {
+		return nil
+	}
+
+	after, err := c.rowSnapshot(tx, id)
+	if err != nil {
+		return err
+	}
+
+	res, err := tx.Exec(
+		"INSERT INTO "+c.tables.debug+"(`item_id`, `transition`, `before`, `after`, `created_at`) VALUES (?, ?, ?, ?, ?)",
+		id, transition, before, after, c.cfg.Clock.Now().UnixNano(),
+	)
+	if err != nil {
+		return err
+	}
+
+	last, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM "+c.tables.debug+" WHERE id <= ?", last-int64(c.cfg.DebugRetention))
+	return err
+}
+
+// Snapshots returns the recorded transitions of the item in the order they happened.
+// Snapshots are only recorded while the queue runs with Config.Debug enabled.
+func (c *Queue) Snapshots(id int) ([]Snapshot, error) {
+	rows, err := c.db.QueryContext(
+		c.ctx,
+		"SELECT `id`, `item_id`, `transition`, `before`, `after`, `created_at` FROM "+c.tables.debug+" WHERE item_id = ? ORDER BY id",
+		id,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close() // Ensure rows are closed after processing.
+
+	var snapshots []Snapshot
+	for rows.Next() {
+		var s Snapshot
+		var before, after []byte
+		var createdAt int64
+		if err := rows.Scan(&s.ID, &s.ItemID, &s.Transition, &before, &after, &createdAt); err != nil {
+			return nil, err
+		}
+		s.Before, s.After = before, after
+		s.CreatedAt = time.Unix(0, createdAt)
+		snapshots = append(snapshots, s)
+	}
+	return snapshots, rows.Err()
+}
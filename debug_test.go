@@ -0,0 +1,66 @@
+package queue
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestDebugSnapshots(t *testing.T) {
+	queue := setupQueue(t, Config{Debug: true})
+	defer queue.Close()
+
+	if err := queue.Add([]byte("test data")); err != nil {
+		t.Fatalf("failed to add item to queue: %v", err)
+	}
+
+	items, err := queue.Get(1)
+	if err != nil || len(items) != 1 {
+		t.Fatalf("failed to get item from queue: %v", err)
+	}
+	if err := queue.Delete(items[0].ID); err != nil {
+		t.Fatalf("failed to delete item from queue: %v", err)
+	}
+
+	snapshots, err := queue.Snapshots(items[0].ID)
+	if err != nil {
+		t.Fatalf("failed to read snapshots: %v", err)
+	}
+	if len(snapshots) != 2 {
+		t.Fatalf("expected 2 snapshots, got %d", len(snapshots))
+	}
+
+	if snapshots[0].Transition != TransitionEnqueued || snapshots[0].Before != nil || snapshots[0].After == nil {
+		t.Fatalf("unexpected enqueue snapshot: %+v", snapshots[0])
+	}
+	if snapshots[1].Transition != TransitionDeleted || snapshots[1].Before == nil || snapshots[1].After != nil {
+		t.Fatalf("unexpected delete snapshot: %+v", snapshots[1])
+	}
+
+	var row map[string]any
+	if err := json.Unmarshal(snapshots[1].Before, &row); err != nil {
+		t.Fatalf("failed to decode snapshot: %v", err)
+	}
+	if row["id"] != float64(items[0].ID) {
+		t.Fatalf("unexpected snapshot row: %v", row)
+	}
+}
+
+func TestDebugRetention(t *testing.T) {
+	queue := setupQueue(t, Config{Debug: true, DebugRetention: 2})
+	defer queue.Close()
+
+	for i := 0; i < 3; i++ {
+		if err := queue.Add([]byte("test data")); err != nil {
+			t.Fatalf("failed to add item to queue: %v", err)
+		}
+	}
+
+	// The first snapshot is pruned once the third is written.
+	snapshots, err := queue.Snapshots(1)
+	if err != nil {
+		t.Fatalf("failed to read snapshots: %v", err)
+	}
+	if len(snapshots) != 0 {
+		t.Fatalf("expected pruned snapshots, got %d", len(snapshots))
+	}
+}
@@ -0,0 +1,81 @@
+package queue
+
+import "database/sql"
+
+// DeliveryMode selects the guarantee the queue gives when a consumer fails
+// or its process dies while handling an item.
+type DeliveryMode int
+
+const (
+	// AtLeastOnce keeps a claimed item until it is acknowledged, so an item
+	// whose consumer failed, panicked or died is delivered again. An item may
+	// therefore be processed more than once, and handlers should be idempotent.
+	AtLeastOnce DeliveryMode = iota
+
+	// AtMostOnce deletes items as they are handed to a consumer, before the
+	// listener runs or Claim returns, so an item is never processed twice,
+	// at the price of losing it if its consumer fails, panics or dies. An
+	// item whose deletion did not commit is not handed out and is claimed
+	// again once its lease runs out. Retries, delays, results, follow-ups and quarantine do
+	// not apply, Ack and Release return ErrItemNotFound, Do never sees a
+	// result, and the payload of items added with AddFrom is gone before it
+	// can be opened.
+	AtMostOnce
+)
+
+// deliver hands out items claimed by this instance along with the error
+// claiming them, with the trace ID of their producer restored in their
+// context. In AtMostOnce mode it removes them first, in a single
+// transaction, and returns only those it removed.
+func (c *Queue) deliver(items []Item, err error) ([]Item, error) {
+	if c.cfg.Delivery == AtMostOnce && len(items) > 0 {
+		consumed, consumeErr := c.consume(items)
+		if err == nil {
+			err = consumeErr
+		}
+		items = consumed
+	}
+	for i := range items {
+		items[i].ctx = c.itemContext(items[i])
+	}
+	return items, err
+}
+
+// consume removes items claimed by this instance and returns those still
+// held by it.
+func (c *Queue) consume(items []Item) ([]Item, error) {
+	c.mx.Lock() // Lock for exclusive access to the queue.
+	defer c.mx.Unlock()
+
+	var consumed []Item
+	err := c.withTx(func(tx *sql.Tx) error {
+		consumed = consumed[:0]
+		for _, item := range items {
+			before, err := c.rowSnapshot(tx, item.ID)
+			if err != nil {
+				return err
+			}
+			nonce := deliveryNonce(item)
+			if err := c.recordHistory(tx, item.ID, nonce); err != nil {
+				return err
+			}
+			removed, err := c.execTransition(tx, item.ID, TransitionConsumed, c.stmts.ack, item.ID, c.owner, nonce)
+			if err != nil {
+				return err
+			}
+			if !removed {
+				continue // The lease ran out and the item was claimed again.
+			}
+			if err := c.snapshot(tx, item.ID, TransitionConsumed, before); err != nil {
+				return err
+			}
+			consumed = append(consumed, item)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	c.signalFreed()
+	return consumed, nil
+}
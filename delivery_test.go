@@ -0,0 +1,64 @@
+package queue
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAtMostOnceClaim(t *testing.T) {
+	queue := setupQueue(t, Config{Delivery: AtMostOnce})
+	defer queue.Close()
+
+	if err := queue.Add([]byte("test data")); err != nil {
+		t.Fatalf("failed to add item to queue: %v", err)
+	}
+	items, err := queue.Claim(10)
+	if err != nil || len(items) != 1 || string(items[0].Data) != "test data" {
+		t.Fatalf("expected the item to be claimed, got %+v, %v", items, err)
+	}
+
+	// The item is gone as soon as it is claimed.
+	stats, err := queue.Stats()
+	if err != nil || stats.Pending != 0 || stats.InFlight != 0 {
+		t.Fatalf("expected an empty queue, got %+v, %v", stats, err)
+	}
+	if err := queue.Ack(items[0].ID); !errors.Is(err, ErrItemNotFound) {
+		t.Fatalf("expected ErrItemNotFound, got %v", err)
+	}
+}
+
+func TestAtMostOnceListener(t *testing.T) {
+	queue := setupQueue(t, Config{Delivery: AtMostOnce, ClaimBatchSize: 4})
+	defer queue.Close()
+
+	for i := 0; i < 3; i++ {
+		if err := queue.Add([]byte("test data")); err != nil {
+			t.Fatalf("failed to add item to queue: %v", err)
+		}
+	}
+
+	var deliveries atomic.Int32
+	queue.Listener(func(item Item, delay func(sec time.Duration)) {
+		deliveries.Add(1)
+		delay(time.Millisecond) // Dropped instead of retried.
+	})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for deliveries.Load() < 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected 3 deliveries, got %d", deliveries.Load())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if n := deliveries.Load(); n != 3 {
+		t.Fatalf("expected failed items not to be delivered again, got %d deliveries", n)
+	}
+
+	stats, err := queue.Stats()
+	if err != nil || stats.Pending != 0 || stats.InFlight != 0 {
+		t.Fatalf("expected an empty queue, got %+v, %v", stats, err)
+	}
+}
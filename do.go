@@ -0,0 +1,80 @@
+package queue
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+// Do adds an item and blocks until it has been processed, returning the
+// result its handler stored with SetResult or AckResult, or a *HandlerError
+// if the handler called SetError. Items acknowledged without a result return
+// an empty result. It returns ErrDeadLettered if the item used up its
+// attempts, ErrNoResult if it left the queue otherwise, e.g. via Delete, and
+// the context error if ctx is done first; the item then stays queued.
+//
+// Completion is noticed right away when the item is processed by this queue
+// instance and within a second when another process sharing the database
+// file processes it.
+func (c *Queue) Do(ctx context.Context, data []byte, tags ...string) ([]byte, error) {
+	opts := &addOptions{awaited: true}
+	if err := c.enqueue(context.WithValue(ctx, addOptionsKey{}, opts), data, tags, c.cfg.Overflow); err != nil {
+		return nil, err
+	}
+	if opts.id == 0 {
+		return nil, ErrNoResult // The overflow policy discarded the item.
+	}
+
+	id := opts.id
+	defer func() {
+		c.mx.Lock()
+		delete(c.awaited, id)
+		c.mx.Unlock()
+	}()
+
+	ticker := c.cfg.Clock.NewTicker(claimPollInterval)
+	defer ticker.Stop()
+
+	for {
+		c.mx.Lock()
+		freed := c.freed
+		c.mx.Unlock()
+
+		result, err := c.Result(id)
+		if !errors.Is(err, ErrNoResult) {
+			return result, err
+		}
+
+		var state State
+		err = c.db.QueryRowContext(ctx, "SELECT `state` FROM "+c.tables.items+" WHERE id = ?", id).Scan(&state)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			// The item may have been acknowledged between the two reads.
+			if result, err := c.Result(id); !errors.Is(err, ErrNoResult) {
+				return result, err
+			}
+			return nil, ErrNoResult
+		case err != nil:
+			return nil, err
+		case state == StateDead:
+			return nil, ErrDeadLettered
+		}
+
+		select {
+		case <-freed:
+		case <-ticker.C():
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-c.ctx.Done():
+			return nil, ErrClosed
+		}
+	}
+}
+
+// isAwaited reports whether a Do call is waiting for the item.
+func (c *Queue) isAwaited(id int) bool {
+	c.mx.Lock() // Lock for exclusive access to the queue.
+	defer c.mx.Unlock()
+
+	return c.awaited[id]
+}
@@ -0,0 +1,75 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDo(t *testing.T) {
+	queue := setupQueue(t, Config{})
+	defer queue.Close()
+
+	queue.Listener(func(item Item, delay func(sec time.Duration)) {
+		switch string(item.Data) {
+		case "fail":
+			queue.SetError(item.ID, errors.New("boom"))
+		case "silent":
+		default:
+			queue.SetResult(item.ID, append([]byte("echo "), item.Data...))
+		}
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := queue.Do(ctx, []byte("hello"))
+	if err != nil || string(result) != "echo hello" {
+		t.Fatalf("unexpected result %q, %v", result, err)
+	}
+
+	_, err = queue.Do(ctx, []byte("fail"))
+	var handlerErr *HandlerError
+	if !errors.As(err, &handlerErr) || handlerErr.Message != "boom" {
+		t.Fatalf("expected a handler error, got %v", err)
+	}
+
+	result, err = queue.Do(ctx, []byte("silent"))
+	if err != nil || len(result) != 0 {
+		t.Fatalf("expected an empty result, got %q, %v", result, err)
+	}
+}
+
+func TestDoTimeout(t *testing.T) {
+	queue := setupQueue(t, Config{})
+	defer queue.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	if _, err := queue.Do(ctx, []byte("nobody listens")); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the context error, got %v", err)
+	}
+
+	// The item stays queued.
+	if stats, _ := queue.Stats(); stats.Pending != 1 {
+		t.Fatalf("expected the item to stay queued, got %+v", stats)
+	}
+}
+
+func TestDoDeadLettered(t *testing.T) {
+	queue := setupQueue(t, Config{MaxAttempts: 1})
+	defer queue.Close()
+
+	queue.Listener(func(item Item, delay func(sec time.Duration)) {
+		delay(time.Millisecond)
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, err := queue.Do(ctx, []byte("poison")); !errors.Is(err, ErrDeadLettered) {
+		t.Fatalf("expected ErrDeadLettered, got %v", err)
+	}
+}
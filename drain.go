@@ -0,0 +1,62 @@
+package queue
+
+import (
+	"context"
+	"time"
+)
+
+// drainPollInterval is how often Drain counts the remaining items when no
+// item leaves the queue in between, e.g. while they are processed by other
+// processes sharing the file.
+const drainPollInterval = time.Second
+
+// Drain stops the queue from accepting new items and waits until the items
+// already queued, including scheduled ones, have been processed, e.g. to cut
+// over a blue/green deployment. Once draining, Add, Import and the other ways
+// of adding items return ErrDraining, recurring jobs stop firing, and Health
+// fails its draining check so load balancers move traffic elsewhere; the
+// queue keeps draining until it is closed, even if ctx expires. Dead and
+// quarantined items do not count. Drain returns nil once no item is pending
+// or in flight, ctx.Err() if ctx is done first, and ErrClosed if the queue
+// is closed. Items are only processed while listeners or other consumers
+// run.
+func (c *Queue) Drain(ctx context.Context) error {
+	c.draining.Store(true)
+
+	ticker := c.cfg.Clock.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+
+	for {
+		// Take the channel before counting so an item leaving in between is not missed.
+		c.mx.Lock()
+		freed := c.freed
+		c.mx.Unlock()
+
+		var remaining int
+		err := c.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+c.tables.items+" WHERE state IN ('pending', 'in-flight')").Scan(&remaining)
+		switch {
+		case ctx.Err() != nil:
+			return ctx.Err()
+		case c.ctx.Err() != nil:
+			return ErrClosed
+		case err != nil:
+			return err
+		case remaining == 0:
+			return nil
+		}
+
+		select {
+		case <-freed:
+		case <-ticker.C():
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-c.ctx.Done():
+			return ErrClosed
+		}
+	}
+}
+
+// Draining reports whether Drain was called, so the queue accepts no new items.
+func (c *Queue) Draining() bool {
+	return c.draining.Load()
+}
@@ -0,0 +1,96 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDrain(t *testing.T) {
+	queue := setupQueue(t, Config{})
+	defer queue.Close()
+
+	for i := 0; i < 5; i++ {
+		if err := queue.Add([]byte("test data")); err != nil {
+			t.Fatalf("failed to add item to queue: %v", err)
+		}
+	}
+
+	release := make(chan struct{})
+	processed := 0
+	queue.Listener(func(item Item, delay func(sec time.Duration)) {
+		<-release
+		processed++
+	})
+
+	drained := make(chan error, 1)
+	go func() { drained <- queue.Drain(context.Background()) }()
+
+	// Adds are rejected as soon as the queue is draining.
+	deadline := time.Now().Add(5 * time.Second)
+	for !queue.Draining() {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the queue to be draining")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if err := queue.Add([]byte("late")); !errors.Is(err, ErrDraining) {
+		t.Fatalf("expected ErrDraining, got %v", err)
+	}
+	if err := queue.Health(context.Background()); err == nil {
+		t.Fatalf("expected the health check to fail while draining")
+	}
+
+	select {
+	case err := <-drained:
+		t.Fatalf("expected Drain to wait for the backlog, got %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	select {
+	case err := <-drained:
+		if err != nil {
+			t.Fatalf("failed to drain queue: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected Drain to return once the backlog was processed")
+	}
+	if processed != 5 {
+		t.Fatalf("expected 5 items processed, got %d", processed)
+	}
+}
+
+func TestDrainTimeout(t *testing.T) {
+	queue := setupQueue(t, Config{})
+	defer queue.Close()
+
+	if err := queue.Add([]byte("test data")); err != nil {
+		t.Fatalf("failed to add item to queue: %v", err)
+	}
+
+	// Without a listener nothing is processed.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := queue.Drain(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the deadline to be exceeded, got %v", err)
+	}
+}
+
+func TestImportWhileDraining(t *testing.T) {
+	queue := setupQueue(t, Config{})
+	defer queue.Close()
+
+	if err := queue.Drain(context.Background()); err != nil {
+		t.Fatalf("failed to drain queue: %v", err)
+	}
+	dump := `{"id":1,"state":"pending","data":"bGF0ZQ=="}` + "\n"
+	if _, err := queue.Import(context.Background(), strings.NewReader(dump), FormatJSONLines); !errors.Is(err, ErrDraining) {
+		t.Fatalf("expected ErrDraining, got %v", err)
+	}
+	if stats, err := queue.Stats(); err != nil || stats.Pending != 0 {
+		t.Fatalf("expected nothing to be imported, got %+v, %v", stats, err)
+	}
+}
@@ -0,0 +1,378 @@
+package queue
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// rotateBatchSize is the number of items RotateKey re-encrypts per transaction.
+const rotateBatchSize = 100
+
+// Keyring holds the AES keys encrypting payloads at rest, by key ID. New
+// payloads are sealed with AES-GCM under the current key, and the ID of the
+// key is stored with the item, so payloads written under older keys stay
+// readable as long as their key is in the keyring. Payloads added before
+// encryption was enabled are read as they are. The copies of payloads kept
+// in the history and by Cancel stay sealed under the key of their item.
+//
+// Only payloads are encrypted: tags, headers, results and the payloads of
+// AddFrom are stored in clear, FindByJSON does not match encrypted payloads,
+// and the predicates of the Admin operations and ReplayFilter.Match see the
+// payloads as stored.
+type Keyring struct {
+	mx      sync.RWMutex
+	current string                 // ID of the key sealing new payloads.
+	keys    map[string]cipher.AEAD // Every known key, by ID.
+}
+
+// NewKeyring returns a keyring encrypting with key, identified by id. The key
+// must be 16, 24 or 32 bytes long to select AES-128, AES-192 or AES-256.
+func NewKeyring(id string, key []byte) (*Keyring, error) {
+	k := &Keyring{keys: make(map[string]cipher.AEAD)}
+	if err := k.Add(id, key); err != nil {
+		return nil, err
+	}
+	k.current = id
+	return k, nil
+}
+
+// Add registers an older key, so payloads written under it can still be
+// read, or a newer one before it is rotated to; see Queue.RotateKey.
+func (k *Keyring) Add(id string, key []byte) error {
+	if id == "" {
+		return errors.New("queue: key ID must not be empty")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return fmt.Errorf("queue: invalid key %q: %w", id, err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return err
+	}
+
+	k.mx.Lock()
+	defer k.mx.Unlock()
+
+	k.keys[id] = aead
+	return nil
+}
+
+// Current returns the ID of the key sealing new payloads.
+func (k *Keyring) Current() string {
+	k.mx.RLock()
+	defer k.mx.RUnlock()
+
+	return k.current
+}
+
+// seal encrypts data under the current key, returning the ciphertext,
+// prefixed by its nonce, and the ID of the key.
+func (k *Keyring) seal(data []byte) ([]byte, string, error) {
+	k.mx.RLock()
+	id, aead := k.current, k.keys[k.current]
+	k.mx.RUnlock()
+
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(data)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, "", err
+	}
+	return aead.Seal(nonce, nonce, data, nil), id, nil
+}
+
+// open decrypts a payload sealed under the key with the given ID.
+func (k *Keyring) open(id string, sealed []byte) ([]byte, error) {
+	k.mx.RLock()
+	aead, ok := k.keys[id]
+	k.mx.RUnlock()
+
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, nil)
+}
+
+// DecryptError is returned for a payload that cannot be decrypted, because
+// its key is not in Config.Keyring or the ciphertext was altered. It matches
+// ErrCorrupted, so listeners and Claim set such items aside like corrupted
+// ones; they can be requeued once the missing key is added.
+type DecryptError struct {
+	ItemID int    // Identifier of the item.
+	KeyID  string // ID of the key the payload was sealed under.
+	Err    error  // ErrUnknownKey, or why the decryption failed.
+}
+
+func (e *DecryptError) Error() string {
+	return fmt.Sprintf("queue: payload of item %d under key %q cannot be decrypted: %v", e.ItemID, e.KeyID, e.Err)
+}
+
+func (e *DecryptError) Unwrap() error {
+	return e.Err
+}
+
+func (e *DecryptError) Is(target error) bool {
+	return target == ErrCorrupted
+}
+
+// addKeyIDColumn adds the column holding the ID of the key a payload is
+// sealed under; NULL for payloads stored in clear.
+func addKeyIDColumn(tx *sql.Tx, t tables) error {
+	return addColumn(tx, t.items, "key_id", "TEXT")
+}
+
+// encrypt seals a payload under the current key of Config.Keyring, returning
+// the ciphertext and the ID of the key, or the payload itself and an empty
+// ID if encryption is disabled.
+func (c *Queue) encrypt(data []byte) ([]byte, string, error) {
+	if c.cfg.Keyring == nil {
+		return data, "", nil
+	}
+	return c.cfg.Keyring.seal(data)
+}
+
+// decrypt replaces the complete, sealed payload of an item with its plaintext.
+func (c *Queue) decrypt(item *Item) error {
+	if item.keyID == "" {
+		return nil // Stored in clear.
+	}
+	if c.cfg.Keyring == nil {
+		return &DecryptError{ItemID: item.ID, KeyID: item.keyID, Err: ErrUnknownKey}
+	}
+	data, err := c.cfg.Keyring.open(item.keyID, item.Data)
+	if err != nil {
+		return &DecryptError{ItemID: item.ID, KeyID: item.keyID, Err: err}
+	}
+	item.Data = data
+	return nil
+}
+
+// RotateKey adds key to Config.Keyring under the given ID and makes it the
+// current key, so new payloads are sealed under it, then re-encrypts the
+// payloads stored under other keys, or in clear, in the background until
+// none is left or ctx is done, first those of the items and then the copies
+// kept in the history and the cancellations. KeyRotationPending reports the progress. Processes sharing
+// the database must Add the key to their keyring before the rotation starts,
+// and keep the older keys until it is done. Re-encrypted items get a new
+// Version. Payloads that cannot be read are skipped.
+func (c *Queue) RotateKey(ctx context.Context, id string, key []byte) error {
+	k := c.cfg.Keyring
+	if k == nil {
+		return ErrNoKeyring
+	}
+	if err := k.Add(id, key); err != nil {
+		return err
+	}
+	k.mx.Lock()
+	k.current = id
+	k.mx.Unlock()
+
+	// A newer rotation takes over from a running one.
+	ctx, cancel := context.WithCancel(ctx)
+	c.mx.Lock()
+	if c.rotation != nil {
+		c.rotation()
+	}
+	c.rotation = cancel
+	c.mx.Unlock()
+
+	go c.runRotation(ctx, id)
+	return nil
+}
+
+// KeyRotationPending returns the number of items, history entries and
+// cancellations whose payload is not sealed under the current key of
+// Config.Keyring, including those stored in clear. Older keys can be dropped
+// once it returns 0.
+func (c *Queue) KeyRotationPending() (int, error) {
+	if c.cfg.Keyring == nil {
+		return 0, ErrNoKeyring
+	}
+	query := "SELECT (SELECT COUNT(*) FROM " + c.tables.items + " WHERE (key_id IS NULL OR key_id != ?1) AND streamed = 0)"
+	for _, table := range c.sealedLogs() {
+		query += " + (SELECT COUNT(*) FROM " + table + " WHERE key_id IS NULL OR key_id != ?1)"
+	}
+	var pending int
+	err := c.db.QueryRowContext(c.ctx, query, c.cfg.Keyring.Current()).Scan(&pending)
+	return pending, err
+}
+
+// sealedLogs returns the tables besides the items that keep copies of
+// payloads sealed under the key of their item, along with its ID.
+func (c *Queue) sealedLogs() []string {
+	return []string{c.tables.history, c.tables.cancellations}
+}
+
+// runRotation re-encrypts the payloads not sealed under the key with the
+// given ID, one batch at a time.
+func (c *Queue) runRotation(ctx context.Context, id string) {
+	after := 0
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.ctx.Done():
+			return
+		default:
+		}
+
+		last, err := c.rotateBatch(id, after)
+		if err != nil {
+			if c.ctx.Err() == nil {
+				c.cfg.Logger.Println("Error rotating key:", err)
+			}
+			return
+		}
+		if last == after {
+			break // Every item was visited.
+		}
+		after = last
+	}
+
+	for _, table := range c.sealedLogs() {
+		if !c.rotateLog(ctx, table, id) {
+			return
+		}
+	}
+}
+
+// rotateLog re-encrypts the payloads of a table returned by sealedLogs that
+// are not sealed under the key with the given ID, one batch at a time. It
+// reports whether every row was visited.
+func (c *Queue) rotateLog(ctx context.Context, table, id string) bool {
+	after := int64(0)
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-c.ctx.Done():
+			return false
+		default:
+		}
+
+		last, err := c.rotateLogBatch(table, id, after)
+		if err != nil {
+			if c.ctx.Err() == nil {
+				c.cfg.Logger.Println("Error rotating key:", err)
+			}
+			return false
+		}
+		if last == after {
+			return true
+		}
+		after = last
+	}
+}
+
+// rotateLogBatch re-encrypts the next batch of payloads of table following
+// the row 'after' that are not sealed under the key with the given ID, and
+// returns the row of the last payload it visited.
+func (c *Queue) rotateLogBatch(table, id string, after int64) (int64, error) {
+	c.mx.Lock() // Lock for exclusive access to the queue.
+	defer c.mx.Unlock()
+
+	last := after
+	err := c.withTx(func(tx *sql.Tx) error {
+		rows, err := tx.Query(
+			"SELECT rowid, `item_id`, `data`, `key_id` FROM "+table+" WHERE rowid > ? AND (key_id IS NULL OR key_id != ?) ORDER BY rowid LIMIT ?",
+			after, id, rotateBatchSize,
+		)
+		if err != nil {
+			return err
+		}
+		type sealed struct {
+			row  int64
+			item Item
+		}
+		var batch []sealed
+		for rows.Next() {
+			var s sealed
+			var keyID sql.NullString
+			if err := rows.Scan(&s.row, &s.item.ID, &s.item.Data, &keyID); err != nil {
+				rows.Close()
+				return err
+			}
+			s.item.keyID = keyID.String
+			batch = append(batch, s)
+		}
+		rows.Close() // Release the rows before updating the table.
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, s := range batch {
+			last = s.row
+			if err := c.decrypt(&s.item); err != nil {
+				continue // Leave unreadable payloads as they are.
+			}
+			data, key, err := c.encrypt(s.item.Data)
+			if err != nil {
+				return err
+			}
+			if _, err := tx.Exec("UPDATE "+table+" SET data = ?, key_id = ? WHERE rowid = ?", data, nullString(key), s.row); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return after, err
+	}
+	return last, nil
+}
+
+// rotateBatch re-encrypts the next batch of payloads following the ID
+// 'after' that are not sealed under the key with the given ID, and returns
+// the ID of the last item it visited.
+func (c *Queue) rotateBatch(id string, after int) (int, error) {
+	c.mx.Lock() // Lock for exclusive access to the queue.
+	defer c.mx.Unlock()
+
+	last := after
+	var prepared []storedPayload // Offloaded payloads to discard if the batch fails.
+	err := c.withTx(func(tx *sql.Tx) error {
+		rows, err := tx.Query(
+			"SELECT "+itemColumns+" FROM "+c.tables.items+" WHERE id > ? AND (key_id IS NULL OR key_id != ?) AND streamed = 0 ORDER BY id LIMIT ?",
+			after, id, rotateBatchSize,
+		)
+		items, err := scanItems(rows, err)
+		if err != nil {
+			return err
+		}
+
+		for _, item := range items {
+			last = item.ID
+			if err := c.loadPayload(tx, &item); err != nil {
+				if errors.Is(err, ErrCorrupted) {
+					continue // Leave unreadable payloads as they are.
+				}
+				return err
+			}
+			p, err := c.preparePayload(item.Data)
+			if err != nil {
+				return err
+			}
+			prepared = append(prepared, p)
+			if _, err := c.replacePayload(tx, item.ID, p); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		for _, p := range prepared {
+			c.discardPayload(p)
+		}
+		return after, err
+	}
+	return last, nil
+}
@@ -0,0 +1,113 @@
+package queue
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestEncryption(t *testing.T) {
+	keyring, err := NewKeyring("k1", bytes.Repeat([]byte{1}, 32))
+	if err != nil {
+		t.Fatalf("failed to create keyring: %v", err)
+	}
+	queue := setupQueue(t, Config{Keyring: keyring, ChunkSize: 16})
+	defer queue.Close()
+
+	secret := []byte("a secret payload long enough to be split into chunks")
+	if err := queue.Add(secret); err != nil {
+		t.Fatalf("failed to add item to queue: %v", err)
+	}
+
+	var head []byte
+	var keyID string
+	if err := queue.db.QueryRow("SELECT `data`, `key_id` FROM "+queue.tables.items).Scan(&head, &keyID); err != nil {
+		t.Fatalf("failed to read the stored row: %v", err)
+	}
+	if bytes.Contains(secret, head) || keyID != "k1" {
+		t.Fatalf("expected the payload to be sealed under k1, got %q under %q", head, keyID)
+	}
+
+	items, err := queue.Get(10)
+	if err != nil || len(items) != 1 || !bytes.Equal(items[0].Data, secret) {
+		t.Fatalf("expected the decrypted payload, got %+v, %v", items, err)
+	}
+}
+
+func TestRotateKey(t *testing.T) {
+	keyring, err := NewKeyring("k1", bytes.Repeat([]byte{1}, 32))
+	if err != nil {
+		t.Fatalf("failed to create keyring: %v", err)
+	}
+	queue := setupQueue(t, Config{Keyring: keyring})
+	defer queue.Close()
+
+	for _, data := range []string{"first", "second", "third"} {
+		if err := queue.Add([]byte(data)); err != nil {
+			t.Fatalf("failed to add item to queue: %v", err)
+		}
+	}
+
+	if err := queue.RotateKey(context.Background(), "k2", bytes.Repeat([]byte{2}, 32)); err != nil {
+		t.Fatalf("failed to rotate key: %v", err)
+	}
+	if keyring.Current() != "k2" {
+		t.Fatalf("expected k2 to be current, got %q", keyring.Current())
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		pending, err := queue.KeyRotationPending()
+		if err != nil {
+			t.Fatalf("failed to count pending items: %v", err)
+		}
+		if pending == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the items to be re-encrypted, %d left", pending)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Without k1, the items are still readable.
+	delete(keyring.keys, "k1")
+	items, err := queue.Get(10)
+	if err != nil || len(items) != 3 || string(items[0].Data) != "first" || string(items[2].Data) != "third" {
+		t.Fatalf("expected the re-encrypted payloads, got %+v, %v", items, err)
+	}
+}
+
+func TestUnknownKey(t *testing.T) {
+	keyring, err := NewKeyring("k1", bytes.Repeat([]byte{1}, 16))
+	if err != nil {
+		t.Fatalf("failed to create keyring: %v", err)
+	}
+	queue := setupQueue(t, Config{Keyring: keyring})
+	defer queue.Close()
+
+	if err := queue.Add([]byte("test data")); err != nil {
+		t.Fatalf("failed to add item to queue: %v", err)
+	}
+	if _, err := queue.db.Exec("UPDATE " + queue.tables.items + " SET key_id = 'gone'"); err != nil {
+		t.Fatalf("failed to change the key of the item: %v", err)
+	}
+
+	_, err = queue.Get(10)
+	var decryptErr *DecryptError
+	if !errors.As(err, &decryptErr) || !errors.Is(err, ErrUnknownKey) || !errors.Is(err, ErrCorrupted) || decryptErr.KeyID != "gone" {
+		t.Fatalf("expected a DecryptError for the unknown key, got %v", err)
+	}
+
+	// Claiming sets the item aside instead of failing over and over.
+	items, err := queue.Claim(1)
+	if err != nil || len(items) != 0 {
+		t.Fatalf("expected no item to be claimed, got %+v, %v", items, err)
+	}
+	quarantined, err := queue.Quarantined(10)
+	if err != nil || len(quarantined) != 1 {
+		t.Fatalf("expected the item to be quarantined, got %+v, %v", quarantined, err)
+	}
+}
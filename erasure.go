@@ -0,0 +1,214 @@
+package queue
+
+import (
+	"database/sql"
+)
+
+// subjectPrefix marks the tags naming the data subject of an item.
+const subjectPrefix = "subject:"
+
+// SubjectHeader is the header naming the data subject of an item, for
+// producers that keep the subject out of the tags; Admin.Erase finds items
+// by either:
+//
+//	q.AddContext(ctx, data, queue.WithHeaders(map[string]string{queue.SubjectHeader: "user-42"}))
+const SubjectHeader = "subject"
+
+// SubjectTag returns the tag associating an item with a data subject, e.g.
+// the ID of the user whose personal data the payload holds. Items added with
+// it can later be erased along with their history via Admin.Erase:
+//
+//	q.AddTagged(data, "email", queue.SubjectTag("user-42"))
+func SubjectTag(subject string) string {
+	return subjectPrefix + subject
+}
+
+// ErasureMode selects what Admin.Erase does with the items of a subject.
+type ErasureMode int
+
+const (
+	EraseDelete ErasureMode = iota // Remove the items and every record of their payloads.
+	EraseRedact                    // Keep the items, e.g. for processing statistics, but empty their payloads.
+)
+
+// ErasureReport describes what Admin.Erase removed or redacted.
+type ErasureReport struct {
+	Subject       string // Subject whose data was erased.
+	Items         []int  // IDs of the items associated with the subject, including ones no longer in the queue.
+	Deleted       int    // Items removed from the queue, whatever their state.
+	Redacted      int    // Items whose payloads were emptied.
+	Snapshots     int    // Debug snapshots removed.
+	History       int    // Entries of the processing history removed.
+	Cancellations int    // Entries of the cancellation log removed or redacted.
+	Results       int    // Stored results removed or redacted.
+	Mirror        int    // Copies waiting in the mirror outbox removed or redacted.
+}
+
+// createSubjectsTable creates the index of items by data subject. Triggers
+// fill it from the subject tags of new items, and entries outlive the items,
+// so the history of removed items can still be found. Existing items are
+// indexed right away.
+func createSubjectsTable(tx *sql.Tx, t tables) error {
+	_, err := tx.Exec(`
+        CREATE TABLE IF NOT EXISTS ` + t.subjects + ` (
+            subject TEXT NOT NULL,
+            item_id INTEGER NOT NULL,
+            PRIMARY KEY (subject, item_id)
+        );
+        CREATE TRIGGER IF NOT EXISTS ` + t.subjects + `_index AFTER INSERT ON ` + t.items + ` WHEN NEW.tags IS NOT NULL BEGIN
+            INSERT OR IGNORE INTO ` + t.subjects + `(subject, item_id)
+            SELECT substr(value, 9), NEW.id FROM json_each(NEW.tags) WHERE substr(value, 1, 8) = 'subject:';
+        END;
+        INSERT OR IGNORE INTO ` + t.subjects + `(subject, item_id)
+        SELECT substr(j.value, 9), i.id FROM ` + t.items + ` i, json_each(i.tags) j
+        WHERE i.tags IS NOT NULL AND substr(j.value, 1, 8) = 'subject:';
+    `)
+	return err
+}
+
+// indexSubjectHeaders extends the index of items by data subject to the
+// SubjectHeader of their headers, for new and existing items.
+func indexSubjectHeaders(tx *sql.Tx, t tables) error {
+	_, err := tx.Exec(`
+        CREATE TRIGGER IF NOT EXISTS ` + t.subjects + `_index_headers AFTER INSERT ON ` + t.items + ` WHEN json_extract(NEW.headers, '$.` + SubjectHeader + `') IS NOT NULL BEGIN
+            INSERT OR IGNORE INTO ` + t.subjects + `(subject, item_id)
+            VALUES (json_extract(NEW.headers, '$.` + SubjectHeader + `'), NEW.id);
+        END;
+        INSERT OR IGNORE INTO ` + t.subjects + `(subject, item_id)
+        SELECT json_extract(headers, '$.` + SubjectHeader + `'), id FROM ` + t.items + `
+        WHERE json_extract(headers, '$.` + SubjectHeader + `') IS NOT NULL;
+    `)
+	return err
+}
+
+// Erase finds every item tagged with SubjectTag(subject) or naming subject
+// in its SubjectHeader, whether pending, in flight, dead or quarantined, and
+// deletes it or empties its payload depending on mode. The copies of the payloads kept elsewhere in the database
+// go as well: debug snapshots and the processing history are removed, and the
+// cancellation log, stored results and mirror outbox are removed or redacted
+// along with the items. Chunks go with the items, and offloaded payloads are
+// deleted from Config.Offload by the background sweeper. Everything happens
+// in one transaction, and the erasure is audited under the actor of a.
+//
+// Listeners holding an erased item keep the payload they were handed; their
+// acknowledgement fails once the item is deleted. The change feed and the
+// audit log only record item IDs and are kept. Copies outside the database,
+// such as archives written by Archive, must be erased separately; see
+// queuearchive.Archiver.Erase.
+func (a *Admin) Erase(subject string, mode ErasureMode) (ErasureReport, error) {
+	c := a.c
+	report := ErasureReport{Subject: subject}
+
+	c.mx.Lock() // Lock for exclusive access to the queue.
+	defer c.mx.Unlock()
+
+	err := c.withTx(func(tx *sql.Tx) error {
+		ids, err := selectIDs(tx, "SELECT `item_id` FROM "+c.tables.subjects+" WHERE subject = ? ORDER BY item_id", subject)
+		if err != nil {
+			return err
+		}
+		report.Items = ids
+		tag := SubjectTag(subject)
+
+		// Drop the snapshots before erasing, so no copy of the rows survives.
+		if report.Snapshots, err = execCount(tx, "DELETE FROM "+c.tables.debug+" WHERE item_id IN (SELECT `item_id` FROM "+c.tables.subjects+" WHERE subject = ?)", subject); err != nil {
+			return err
+		}
+
+		inSubject := " WHERE item_id IN (SELECT `item_id` FROM " + c.tables.subjects + " WHERE subject = ?)"
+		if report.History, err = execCount(tx, "DELETE FROM "+c.tables.history+inSubject, subject); err != nil {
+			return err
+		}
+		inOutbox := " WHERE (tags IS NOT NULL AND EXISTS (SELECT 1 FROM json_each(tags) WHERE value = ?1)) OR json_extract(headers, '$." + SubjectHeader + "') = ?2"
+		switch mode {
+		case EraseRedact:
+			if report.Cancellations, err = execCount(tx, "UPDATE "+c.tables.cancellations+" SET data = x'', key_id = NULL"+inSubject, subject); err != nil {
+				return err
+			}
+			if report.Results, err = execCount(tx, "UPDATE "+c.tables.results+" SET data = NULL"+inSubject, subject); err != nil {
+				return err
+			}
+			if report.Mirror, err = execCount(tx, "UPDATE "+c.tables.mirror+" SET data = x'', key_id = NULL"+inOutbox, tag, subject); err != nil {
+				return err
+			}
+		default:
+			if report.Cancellations, err = execCount(tx, "DELETE FROM "+c.tables.cancellations+inSubject, subject); err != nil {
+				return err
+			}
+			if report.Results, err = execCount(tx, "DELETE FROM "+c.tables.results+inSubject, subject); err != nil {
+				return err
+			}
+			if report.Mirror, err = execCount(tx, "DELETE FROM "+c.tables.mirror+inOutbox, tag, subject); err != nil {
+				return err
+			}
+		}
+
+		for _, id := range ids {
+			from, err := c.itemState(tx, id)
+			if err != nil {
+				return err
+			}
+			var n int
+			transition := TransitionErased
+			if mode == EraseRedact {
+				n, err = c.redactItem(tx, id)
+				transition = TransitionRedacted
+			} else {
+				n, err = execCount(tx, "DELETE FROM "+c.tables.items+" WHERE id = ?", id)
+			}
+			if err != nil {
+				return err
+			}
+			if n == 0 {
+				continue // Already removed; only its history was left.
+			}
+			if err := c.enforceTransition(tx, id, transition, from); err != nil {
+				return err
+			}
+
+			if mode == EraseRedact {
+				report.Redacted++
+			} else {
+				report.Deleted++
+			}
+			if err := c.snapshot(tx, id, transition, nil); err != nil {
+				return err
+			}
+			if err := c.audit(tx, a.actor, transition, id); err != nil {
+				return err
+			}
+		}
+
+		// Items that are gone for good need no index entry anymore.
+		if mode == EraseRedact {
+			_, err = tx.Exec("DELETE FROM "+c.tables.subjects+" WHERE subject = ? AND item_id NOT IN (SELECT `id` FROM "+c.tables.items+")", subject)
+		} else {
+			_, err = tx.Exec("DELETE FROM "+c.tables.subjects+" WHERE subject = ?", subject)
+		}
+		return err
+	})
+	if err != nil {
+		return ErasureReport{}, err
+	}
+
+	if report.Deleted > 0 {
+		c.signalFreed()
+	}
+	return report, nil
+}
+
+// redactItem empties the payload of an item, releasing its chunks and
+// offloaded payload. It returns 0 if the item does not exist.
+func (c *Queue) redactItem(tx *sql.Tx, id int) (int, error) {
+	return c.replacePayload(tx, id, storedPayload{head: []byte{}, checksum: int64(checksum(nil))})
+}
+
+// execCount runs a statement and returns the number of rows it changed.
+func execCount(tx *sql.Tx, query string, args ...any) (int, error) {
+	res, err := tx.Exec(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
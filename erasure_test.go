@@ -0,0 +1,121 @@
+package queue
+
+import (
+	"context"
+	"testing"
+)
+
+func TestEraseDeletesSubject(t *testing.T) {
+	queue := setupQueue(t, Config{Debug: true, Audit: true, MaxAttempts: 1})
+	defer queue.Close()
+
+	subject := SubjectTag("user-42")
+	for _, data := range []string{"a", "b", "c", "d"} {
+		tags := []string{"email", subject}
+		if data == "d" {
+			tags = []string{"email"}
+		}
+		if err := queue.AddTagged([]byte(data), tags...); err != nil {
+			t.Fatalf("failed to add item to queue: %v", err)
+		}
+	}
+
+	// One item of the subject is in flight and one was cancelled.
+	if _, err := queue.Claim(1); err != nil {
+		t.Fatalf("failed to claim item: %v", err)
+	}
+	if err := queue.Cancel(2, "duplicate", "admin"); err != nil {
+		t.Fatalf("failed to cancel item: %v", err)
+	}
+
+	report, err := queue.Admin().As("dpo").Erase("user-42", EraseDelete)
+	if err != nil {
+		t.Fatalf("failed to erase subject: %v", err)
+	}
+	if len(report.Items) != 3 || report.Deleted != 2 || report.Cancellations != 1 || report.Snapshots == 0 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+
+	items, err := queue.Get(10)
+	if err != nil || len(items) != 1 || string(items[0].Data) != "d" {
+		t.Fatalf("expected only the item of another subject to remain, got %+v, %v", items, err)
+	}
+	if _, err := queue.Cancellation(2); err == nil {
+		t.Fatalf("expected the cancellation log entry to be erased")
+	}
+	for _, id := range report.Items {
+		snapshots, err := queue.Snapshots(id)
+		if err != nil {
+			t.Fatalf("failed to read snapshots: %v", err)
+		}
+		for _, s := range snapshots {
+			if s.Transition != TransitionErased || s.Before != nil {
+				t.Fatalf("expected no snapshot holding the payload of item %d, got %+v", id, s)
+			}
+		}
+	}
+
+	entries, err := queue.Admin().AuditLog(AuditFilter{Actor: "dpo"})
+	if err != nil || len(entries) != 2 || entries[0].Operation != TransitionErased {
+		t.Fatalf("expected the erasure to be audited, got %+v, %v", entries, err)
+	}
+
+	// Nothing is left to erase.
+	if report, err := queue.Admin().Erase("user-42", EraseDelete); err != nil || len(report.Items) != 0 {
+		t.Fatalf("expected nothing left of the subject, got %+v, %v", report, err)
+	}
+}
+
+func TestEraseRedactsSubject(t *testing.T) {
+	queue := setupQueue(t, Config{ChunkSize: 4})
+	defer queue.Close()
+
+	if err := queue.AddTagged([]byte("a chunked payload"), SubjectTag("user-42")); err != nil {
+		t.Fatalf("failed to add item to queue: %v", err)
+	}
+
+	report, err := queue.Admin().Erase("user-42", EraseRedact)
+	if err != nil || report.Redacted != 1 {
+		t.Fatalf("expected the item to be redacted, got %+v, %v", report, err)
+	}
+
+	items, err := queue.Get(1)
+	if err != nil || len(items) != 1 || len(items[0].Data) != 0 {
+		t.Fatalf("expected the item to remain with an empty payload, got %+v, %v", items, err)
+	}
+	stats, err := queue.Stats()
+	if err != nil || stats.Bytes != 0 {
+		t.Fatalf("expected the chunks to be removed, got %+v, %v", stats, err)
+	}
+	if ids, err := queue.VerifyAll(queue.ctx); err != nil || len(ids) != 0 {
+		t.Fatalf("expected the redacted payload to verify, got %v, %v", ids, err)
+	}
+}
+
+func TestEraseSubjectHeader(t *testing.T) {
+	queue := setupQueue(t, Config{Mirror: failingQueuer{}})
+	defer queue.Close()
+
+	for _, subject := range []string{"user-42", "user-7"} {
+		_, err := queue.AddContext(context.Background(), []byte(subject), WithHeaders(map[string]string{SubjectHeader: subject}))
+		if err != nil {
+			t.Fatalf("failed to add item to queue: %v", err)
+		}
+	}
+
+	report, err := queue.Admin().Erase("user-42", EraseDelete)
+	if err != nil {
+		t.Fatalf("failed to erase subject: %v", err)
+	}
+	if len(report.Items) != 1 || report.Deleted != 1 || report.Mirror != 1 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+
+	items, err := queue.Get(10)
+	if err != nil || len(items) != 1 || string(items[0].Data) != "user-7" {
+		t.Fatalf("expected only the item of another subject to remain, got %+v, %v", items, err)
+	}
+	if lag, err := queue.MirrorLag(); err != nil || lag.Pending != 1 {
+		t.Fatalf("expected only the copy of another subject in the outbox, got %+v, %v", lag, err)
+	}
+}
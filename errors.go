@@ -0,0 +1,30 @@
+package queue
+
+import "errors"
+
+var (
+	ErrItemNotFound       = errors.New("queue: item not found")                // The item does not exist in the queue.
+	ErrItemInProgress     = errors.New("queue: item is being processed")       // The item has already been claimed by the listener.
+	ErrClosed             = errors.New("queue: closed")                        // The queue or manager has been closed.
+	ErrQueueFull          = errors.New("queue: queue is full")                 // Adding the item would exceed MaxItems or MaxBytes.
+	ErrCronNotFound       = errors.New("queue: cron job not found")            // No recurring job is registered under the name.
+	ErrNoResult           = errors.New("queue: no result")                     // The item has not completed, stored no result, or its result expired.
+	ErrDeadLettered       = errors.New("queue: item was dead-lettered")        // The item used up its attempts before completing.
+	ErrSubscribed         = errors.New("queue: subscriber is already running") // Subscribe was called twice for the same name.
+	ErrSubscriberNotFound = errors.New("queue: subscriber not found")          // No subscriber is registered under the name.
+	ErrTenantFull         = errors.New("queue: tenant backlog is full")        // Adding the item would exceed TenantLimits.MaxItems of its tenant.
+	ErrUnhealthy          = errors.New("queue: unhealthy")                     // A check of Health failed; see HealthError.
+	ErrIllegalTransition  = errors.New("queue: illegal state transition")      // An operation would move an item between states the lifecycle does not connect; see TransitionError.
+	ErrWindowNotFound     = errors.New("queue: pause window not found")        // No pause window is registered under the name.
+	ErrDraining           = errors.New("queue: draining")                      // Drain was called, so the queue accepts no new items.
+	ErrNoSnapshots        = errors.New("queue: snapshots require WAL mode")    // Snapshot needs JournalMode "WAL" and more than one connection, so readers do not block writers.
+	ErrVersionConflict    = errors.New("queue: item version conflict")         // The item changed since the version passed to Update or DeleteVersion was read; see VersionConflictError.
+	ErrInvalidReceipt     = errors.New("queue: invalid receipt")               // The receipt is malformed, was used up, or its delivery was superseded by a later claim.
+	ErrNoKeyring          = errors.New("queue: no keyring")                    // RotateKey needs Config.Keyring.
+	ErrUnknownKey         = errors.New("queue: unknown key")                   // The payload is sealed under a key that is not in Config.Keyring; see DecryptError.
+	ErrInvalidPayload     = errors.New("queue: invalid payload")               // The validator of the queue rejected the payload; see ValidationError.
+	ErrSkipRetry          = errors.New("queue: skip retry")                    // Wrapped in the error of a JobHandler, moves the item to the dead letters without retrying it.
+	ErrSchemaOutdated     = errors.New("queue: schema is outdated")            // OpenReadOnly found a database its owner has not migrated to the schema of this package yet.
+	ErrSharedDatabase     = errors.New("queue: database is shared")            // Restore would overwrite the topics of other queues opened by the same Manager.
+	ErrStreamValidation   = errors.New("queue: cannot validate stream")        // AddFrom was called on a queue with a validator, which needs the whole payload.
+)
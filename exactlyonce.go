@@ -0,0 +1,137 @@
+package queue
+
+import (
+	"database/sql"
+	"errors"
+	"strconv"
+	"time"
+)
+
+// TxHandler processes an item as part of tx, a transaction on the queue's
+// database that also acknowledges the item. Returning an error rolls back
+// everything written through tx and retries the item.
+type TxHandler func(tx *sql.Tx, item Item) error
+
+// createProcessedTable creates the table holding the keys of the items
+// processed with ExactlyOnce.
+func createProcessedTable(tx *sql.Tx, t tables) error {
+	_, err := tx.Exec(`
+        CREATE TABLE IF NOT EXISTS ` + t.processed + ` (
+            key TEXT PRIMARY KEY,
+            item_id INTEGER NOT NULL,
+            processed_at INTEGER NOT NULL
+        );
+        CREATE INDEX IF NOT EXISTS ` + t.processed + `_processed_at ON ` + t.processed + `(processed_at);
+    `)
+	return err
+}
+
+// ExactlyOnce wraps h into a Handler for Listener or TagListener that runs h
+// in a transaction on the queue's database, records the key of the item and
+// acknowledges it in that same transaction. Side effects h writes through
+// the transaction are thus committed exactly once per key:
+//
+//   - if h fails, or the process dies, nothing is committed and the item is
+//     retried as usual;
+//   - if the lease of the item ran out and it was delivered again, the late
+//     delivery cannot acknowledge it and is rolled back;
+//   - items whose key was processed before, e.g. added twice by a producer
+//     retrying Add, are acknowledged without calling h.
+//
+// key derives the idempotency key of an item, e.g. from its payload; nil
+// uses the item ID. Keys are kept until PruneProcessed removes them. Side
+// effects outside the database, such as HTTP calls, are not covered. With a
+// single pooled connection the transaction holds it while h runs.
+func (c *Queue) ExactlyOnce(key func(item Item) string, h TxHandler) Handler {
+	return func(item Item, delay func(sec time.Duration)) {
+		k := "id:" + strconv.Itoa(item.ID)
+		if key != nil {
+			k = key(item)
+		}
+
+		err := c.processOnce(item, k, h)
+		switch {
+		case err == nil:
+			c.record(item.ID, func(done *completion) { done.settled = true })
+		case errors.Is(err, ErrInvalidReceipt):
+			// Another delivery of the item owns it now; leave it alone.
+			c.cfg.Logger.Println("Processing outlasted the lease, rolled back:", item.ID)
+			c.record(item.ID, func(done *completion) { done.settled = true })
+		default:
+			c.Retry(item.ID, err)
+		}
+	}
+}
+
+// processOnce runs h on an item unless its key was processed before, and
+// records the key and acknowledges the delivery of the item in the same
+// transaction.
+func (c *Queue) processOnce(item Item, key string, h TxHandler) error {
+	// The queue lock is not taken, as in AddTx: h may run for long, and queue
+	// operations holding the lock could be waiting for the connection of tx.
+	tx, err := c.db.BeginTx(c.ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // Roll back unless committed.
+
+	res, err := tx.Exec(
+		"INSERT INTO "+c.tables.processed+"(`key`, `item_id`, `processed_at`) VALUES (?, ?, ?) ON CONFLICT(`key`) DO NOTHING",
+		key, item.ID, c.cfg.Clock.Now().UnixNano(),
+	)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n > 0 {
+		if err := h(tx, item); err != nil {
+			return err
+		}
+	}
+
+	var nonce string
+	if item.Receipt != "" {
+		if _, nonce, err = parseReceipt(item.Receipt); err != nil {
+			return err
+		}
+	}
+	before, err := c.rowSnapshot(tx, item.ID)
+	if err != nil {
+		return err
+	}
+	if err := c.recordHistory(tx, item.ID, nullString(nonce)); err != nil {
+		return err
+	}
+	acked, err := c.execTransition(tx, item.ID, TransitionAcked, c.stmts.ack, item.ID, c.owner, nullString(nonce))
+	if err != nil {
+		return err
+	}
+	if !acked {
+		return ErrInvalidReceipt
+	}
+	if err := c.snapshot(tx, item.ID, TransitionAcked, before); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	c.mx.Lock()
+	c.signalFreed()
+	c.mx.Unlock()
+	c.count(MetricAcked, 1)
+	return nil
+}
+
+// PruneProcessed forgets the keys processed with ExactlyOnce before the given
+// time, so the table does not grow forever, and returns how many it removed.
+// Items with a pruned key are processed again if they are added again.
+func (c *Queue) PruneProcessed(before time.Time) (int, error) {
+	res, err := c.db.ExecContext(c.ctx, "DELETE FROM "+c.tables.processed+" WHERE processed_at < ?", before.UnixNano())
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
@@ -0,0 +1,72 @@
+package queue
+
+import (
+	"database/sql"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestExactlyOnce(t *testing.T) {
+	queue := setupQueue(t, Config{RetryPolicy: ExponentialBackoff{Initial: time.Millisecond}})
+	defer queue.Close()
+
+	if _, err := queue.DB().Exec("CREATE TABLE ledger (entry TEXT NOT NULL)"); err != nil {
+		t.Fatalf("failed to create ledger: %v", err)
+	}
+	for _, data := range []string{"order-1", "order-1", "order-2"} {
+		if err := queue.Add([]byte(data)); err != nil {
+			t.Fatalf("failed to add item to queue: %v", err)
+		}
+	}
+
+	var mx sync.Mutex
+	calls := make(map[string]int)
+	key := func(item Item) string { return string(item.Data) }
+	queue.Listener(queue.ExactlyOnce(key, func(tx *sql.Tx, item Item) error {
+		if _, err := tx.Exec("INSERT INTO ledger (entry) VALUES (?)", string(item.Data)); err != nil {
+			return err
+		}
+		mx.Lock()
+		defer mx.Unlock()
+		calls[string(item.Data)]++
+		if string(item.Data) == "order-2" && calls["order-2"] == 1 {
+			return errors.New("downstream rejected") // Rolls back the ledger entry.
+		}
+		return nil
+	}))
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		stats, err := queue.Stats()
+		if err != nil {
+			t.Fatalf("failed to get stats: %v", err)
+		}
+		if stats.Pending == 0 && stats.InFlight == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected all items to be processed, got %+v", stats)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	mx.Lock()
+	if calls["order-1"] != 1 || calls["order-2"] != 2 {
+		t.Fatalf("expected the duplicate to be skipped and the failure retried, got %v", calls)
+	}
+	mx.Unlock()
+
+	var entries int
+	if err := queue.DB().QueryRow("SELECT COUNT(*) FROM ledger").Scan(&entries); err != nil {
+		t.Fatalf("failed to count ledger entries: %v", err)
+	}
+	if entries != 2 {
+		t.Fatalf("expected one ledger entry per order, got %d", entries)
+	}
+
+	if n, err := queue.PruneProcessed(time.Now().Add(time.Minute)); err != nil || n != 2 {
+		t.Fatalf("expected 2 processed keys pruned, got %d, %v", n, err)
+	}
+}
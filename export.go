@@ -0,0 +1,161 @@
+package queue
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// Format selects the encoding used by Export and Import.
+type Format string
+
+const (
+	FormatJSONLines Format = "jsonl" // One JSON object per line.
+	FormatCSV       Format = "csv"   // Comma-separated values with a header row.
+)
+
+// csvHeader lists the CSV columns written by Export, in order.
+var csvHeader = []string{"id", "state", "priority", "attempts", "tags", "tenant", "type", "headers", "dedup_key", "visible_at", "deadline", "data"}
+
+// Record is the exported form of an item together with its metadata.
+type Record struct {
+	ID        int               `json:"id"`                   // Identifier of the item in the exporting queue.
+	State     State             `json:"state"`                // State of the item at the time of the export.
+	Priority  int               `json:"priority,omitempty"`   // Priority of the item.
+	Attempts  int               `json:"attempts,omitempty"`   // Number of times the item was handed to a consumer; not restored by Import.
+	Tags      []string          `json:"tags,omitempty"`       // Tags attached to the item.
+	Tenant    string            `json:"tenant,omitempty"`     // Tenant of the item.
+	Type      string            `json:"type,omitempty"`       // Job type of the item.
+	Headers   map[string]string `json:"headers,omitempty"`    // Metadata attached with WithHeaders; a JSON object in FormatCSV.
+	DedupKey  string            `json:"dedup_key,omitempty"`  // Dedup key of the item; see WithDedupKey.
+	VisibleAt *time.Time        `json:"visible_at,omitempty"` // Time before which a delayed item is not delivered; nil if it was not delayed.
+	Deadline  *time.Time        `json:"deadline,omitempty"`   // Time the item expires at instead of being delivered; nil if it has none.
+	Data      []byte            `json:"data"`                 // Payload of the item, base64 encoded in both formats.
+}
+
+// newRecord returns the record of an item, visible at visibleAt in Unix
+// nanoseconds if valid, with its dedup key, if any.
+func newRecord(item Item, visibleAt sql.NullInt64, dedupKey sql.NullString) Record {
+	r := Record{ID: item.ID, State: item.State, Priority: item.Priority, Attempts: item.Attempts, Tags: item.Tags, Tenant: item.Tenant, Type: item.Type, Headers: item.Headers, DedupKey: dedupKey.String, Data: item.Data}
+	if visibleAt.Valid {
+		t := time.Unix(0, visibleAt.Int64).UTC()
+		r.VisibleAt = &t
+	}
+	if !item.Deadline.IsZero() {
+		t := item.Deadline.UTC()
+		r.Deadline = &t
+	}
+	return r
+}
+
+// Export streams every item in the queue to w in the given format, in FIFO
+// order. The items are read in a single transaction, so the export is a
+// consistent view even while producers and consumers keep working.
+func (c *Queue) Export(ctx context.Context, w io.Writer, format Format) error {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // The transaction is read-only.
+
+	return c.export(ctx, tx, w, format)
+}
+
+// export streams the items read through tx to w in the given format.
+func (c *Queue) export(ctx context.Context, tx *sql.Tx, w io.Writer, format Format) error {
+	encode, flush, err := newRecordEncoder(w, format)
+	if err != nil {
+		return err
+	}
+
+	rows, err := tx.QueryContext(ctx, "SELECT "+itemColumns+", `visible_at`, `dedup_key` FROM "+c.tables.items+" ORDER BY id")
+	if err != nil {
+		return err
+	}
+	defer rows.Close() // Ensure rows are closed after processing.
+
+	for rows.Next() {
+		var visibleAt sql.NullInt64
+		var dedupKey sql.NullString
+		item, err := scanItem(rows, &visibleAt, &dedupKey)
+		if err != nil {
+			return err
+		}
+		if err := c.loadPayload(tx, &item); err != nil {
+			return err
+		}
+
+		if err := encode(newRecord(item, visibleAt, dedupKey)); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	return flush()
+}
+
+// newRecordEncoder returns functions writing records to w in the given format
+// and flushing any buffered output.
+func newRecordEncoder(w io.Writer, format Format) (func(Record) error, func() error, error) {
+	switch format {
+	case FormatJSONLines:
+		encoder := json.NewEncoder(w)
+		return func(r Record) error { return encoder.Encode(r) }, func() error { return nil }, nil
+	case FormatCSV:
+		writer := csv.NewWriter(w)
+		if err := writer.Write(csvHeader); err != nil {
+			return nil, nil, err
+		}
+		encode := func(r Record) error {
+			var tags, headers []byte
+			var err error
+			if len(r.Tags) > 0 {
+				if tags, err = json.Marshal(r.Tags); err != nil {
+					return err
+				}
+			}
+			if len(r.Headers) > 0 {
+				if headers, err = json.Marshal(r.Headers); err != nil {
+					return err
+				}
+			}
+			return writer.Write([]string{
+				strconv.Itoa(r.ID),
+				string(r.State),
+				strconv.Itoa(r.Priority),
+				strconv.Itoa(r.Attempts),
+				string(tags),
+				r.Tenant,
+				r.Type,
+				string(headers),
+				r.DedupKey,
+				formatCSVTime(r.VisibleAt),
+				formatCSVTime(r.Deadline),
+				base64.StdEncoding.EncodeToString(r.Data),
+			})
+		}
+		flush := func() error {
+			writer.Flush()
+			return writer.Error()
+		}
+		return encode, flush, nil
+	default:
+		return nil, nil, fmt.Errorf("queue: unknown format %q", format)
+	}
+}
+
+// formatCSVTime formats an optional time of a record for FormatCSV, empty if
+// it is nil.
+func formatCSVTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(time.RFC3339Nano)
+}
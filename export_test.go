@@ -0,0 +1,79 @@
+package queue
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExport(t *testing.T) {
+	queue := setupQueue(t, Config{})
+	defer queue.Close()
+
+	if err := queue.AddTagged([]byte("first"), "email"); err != nil {
+		t.Fatalf("failed to add item to queue: %v", err)
+	}
+	if err := queue.Add([]byte("second")); err != nil {
+		t.Fatalf("failed to add item to queue: %v", err)
+	}
+
+	var jsonLines bytes.Buffer
+	if err := queue.Export(context.Background(), &jsonLines, FormatJSONLines); err != nil {
+		t.Fatalf("failed to export queue: %v", err)
+	}
+	expected := `{"id":1,"state":"pending","tags":["email"],"data":"Zmlyc3Q="}` + "\n" +
+		`{"id":2,"state":"pending","data":"c2Vjb25k"}` + "\n"
+	if jsonLines.String() != expected {
+		t.Fatalf("unexpected JSON Lines export:\n%s", jsonLines.String())
+	}
+
+	var csv bytes.Buffer
+	if err := queue.Export(context.Background(), &csv, FormatCSV); err != nil {
+		t.Fatalf("failed to export queue: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(csv.String()), "\n")
+	if len(lines) != 3 || lines[0] != "id,state,priority,attempts,tags,tenant,type,headers,dedup_key,visible_at,deadline,data" || lines[1] != `1,pending,0,0,"[""email""]",,,,,,,Zmlyc3Q=` {
+		t.Fatalf("unexpected CSV export:\n%s", csv.String())
+	}
+
+	if err := queue.Export(context.Background(), &csv, Format("xml")); err == nil {
+		t.Fatalf("expected an error for an unknown format")
+	}
+}
+
+func TestExportMetadata(t *testing.T) {
+	clock := NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	queue := setupQueue(t, Config{Clock: clock})
+	defer queue.Close()
+
+	deadline := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	_, err := queue.AddContext(
+		context.Background(), []byte("first"),
+		WithTenant("acme"), WithType("email"), WithHeaders(map[string]string{"trace": "abc"}),
+		WithDelay(time.Hour), WithDeadline(deadline),
+	)
+	if err != nil {
+		t.Fatalf("failed to add item to queue: %v", err)
+	}
+
+	var jsonLines bytes.Buffer
+	if err := queue.Export(context.Background(), &jsonLines, FormatJSONLines); err != nil {
+		t.Fatalf("failed to export queue: %v", err)
+	}
+	expected := `{"id":1,"state":"pending","tenant":"acme","type":"email","headers":{"trace":"abc"},` +
+		`"visible_at":"2024-01-01T01:00:00Z","deadline":"2024-01-02T00:00:00Z","data":"Zmlyc3Q="}` + "\n"
+	if jsonLines.String() != expected {
+		t.Fatalf("unexpected JSON Lines export:\n%s", jsonLines.String())
+	}
+
+	var csv bytes.Buffer
+	if err := queue.Export(context.Background(), &csv, FormatCSV); err != nil {
+		t.Fatalf("failed to export queue: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(csv.String()), "\n")
+	if len(lines) != 2 || lines[1] != `1,pending,0,0,,acme,email,"{""trace"":""abc""}",,2024-01-01T01:00:00Z,2024-01-02T00:00:00Z,Zmlyc3Q=` {
+		t.Fatalf("unexpected CSV export:\n%s", csv.String())
+	}
+}
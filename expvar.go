@@ -0,0 +1,204 @@
+package queue
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DebugInfo is a detailed view of a queue instance, served by DebugHandler.
+type DebugInfo struct {
+	Table   string        `json:"table"`   // Name of the items table.
+	Owner   string        `json:"owner"`   // ID of this instance on the items it claims.
+	Uptime  time.Duration `json:"uptime"`  // Time since the queue was opened.
+	Workers int           `json:"workers"` // Goroutines delivering items to the listeners.
+
+	Stats      Stats            `json:"stats"`      // Items in each state and processing latency.
+	Totals     map[string]int64 `json:"totals"`     // Counters reported to Config.Metrics by this instance, by metric name.
+	Throughput float64          `json:"throughput"` // Items acknowledged per second, on average since the queue was opened.
+
+	LastError   string    `json:"last_error,omitempty"`    // Last error of the background loops.
+	LastErrorAt time.Time `json:"last_error_at,omitempty"` // When LastError happened.
+
+	Listener      bool       `json:"listener"`       // Whether a listener is registered with Listener.
+	TagListeners  int        `json:"tag_listeners"`  // Listeners registered with TagListener.
+	BatchListener bool       `json:"batch_listener"` // Whether a BatchListener is registered.
+	Subscriptions []string   `json:"subscriptions"`  // Subscribers running in this instance.
+	CronJobs      []CronJob  `json:"cron_jobs"`      // Recurring jobs.
+	Mirror        *MirrorLag `json:"mirror,omitempty"`
+}
+
+// counters accumulates the counters reported by a queue instance, so they
+// are available without a metrics system.
+type counters struct {
+	mx     sync.Mutex
+	since  time.Time        // When the queue was opened.
+	totals map[string]int64 // By metric name.
+}
+
+// add adds n to a counter.
+func (c *counters) add(name string, n int) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	if c.totals == nil {
+		c.totals = make(map[string]int64)
+	}
+	c.totals[name] += int64(n)
+}
+
+// snapshot returns a copy of the counters.
+func (c *counters) snapshot() map[string]int64 {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	totals := make(map[string]int64, len(c.totals))
+	for name, n := range c.totals {
+		totals[name] = n
+	}
+	return totals
+}
+
+// errorLogger forwards to the configured Logger and remembers the last line
+// logged with an error, for Expvar and DebugHandler.
+type errorLogger struct {
+	Logger
+	clock Clock
+
+	mx   sync.Mutex
+	last string
+	at   time.Time
+}
+
+func (l *errorLogger) Println(v ...any) {
+	for _, arg := range v {
+		if _, ok := arg.(error); ok {
+			l.mx.Lock()
+			l.last = strings.TrimSuffix(fmt.Sprintln(v...), "\n")
+			l.at = l.clock.Now()
+			l.mx.Unlock()
+			break
+		}
+	}
+	l.Logger.Println(v...)
+}
+
+// lastError returns the last line logged with an error and when it was logged.
+func (l *errorLogger) lastError() (string, time.Time) {
+	l.mx.Lock()
+	defer l.mx.Unlock()
+	return l.last, l.at
+}
+
+// DebugInfo returns a detailed view of this queue instance.
+func (c *Queue) DebugInfo() (DebugInfo, error) {
+	stats, err := c.Stats()
+	if err != nil {
+		return DebugInfo{}, err
+	}
+	jobs, err := c.CronJobs()
+	if err != nil {
+		return DebugInfo{}, err
+	}
+
+	uptime := c.cfg.Clock.Now().Sub(c.counters.since)
+	totals := c.counters.snapshot()
+	info := DebugInfo{
+		Table:      c.cfg.Table,
+		Owner:      c.owner,
+		Uptime:     uptime,
+		Workers:    c.cfg.Workers,
+		Stats:      stats,
+		Totals:     totals,
+		Throughput: throughput(totals[MetricAcked], uptime),
+		CronJobs:   jobs,
+	}
+	info.LastError, info.LastErrorAt = c.errLog.lastError()
+
+	if c.cfg.Mirror != nil {
+		lag, err := c.MirrorLag()
+		if err != nil {
+			return DebugInfo{}, err
+		}
+		info.Mirror = &lag
+	}
+
+	c.mx.Lock()
+	info.Listener = c.clb != nil
+	info.TagListeners = len(c.tagged)
+	info.BatchListener = c.batch != nil
+	for name := range c.subscriptions {
+		info.Subscriptions = append(info.Subscriptions, name)
+	}
+	c.mx.Unlock()
+	sort.Strings(info.Subscriptions)
+
+	return info, nil
+}
+
+// DebugHandler returns an HTTP handler serving DebugInfo as JSON, e.g. to be
+// mounted next to net/http/pprof on a debug port.
+func (c *Queue) DebugHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		info, err := c.DebugInfo()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(info)
+	})
+}
+
+// Expvar returns an expvar.Var reporting the depth, in-flight count,
+// throughput and last error of the queue, for publishing under a name of
+// the caller's choice:
+//
+//	expvar.Publish("jobs", q.Expvar())
+//
+// The values are read when /debug/vars is served.
+func (c *Queue) Expvar() expvar.Var {
+	return expvar.Func(func() any {
+		uptime := c.cfg.Clock.Now().Sub(c.counters.since)
+		totals := c.counters.snapshot()
+		vars := map[string]any{
+			"enqueued":   totals[MetricEnqueued],
+			"acked":      totals[MetricAcked],
+			"throughput": throughput(totals[MetricAcked], uptime),
+		}
+		if last, _ := c.errLog.lastError(); last != "" {
+			vars["last_error"] = last
+		}
+
+		stats, err := c.Stats()
+		if err != nil {
+			vars["error"] = err.Error()
+			return vars
+		}
+		vars["depth"] = stats.Pending
+		vars["in_flight"] = stats.InFlight
+		vars["dead"] = stats.Dead
+		return vars
+	})
+}
+
+// PublishExpvar publishes Expvar under name. Like expvar.Publish, it panics
+// if the name is already in use.
+func (c *Queue) PublishExpvar(name string) {
+	expvar.Publish(name, c.Expvar())
+}
+
+// throughput returns the rate of n events over d, per second.
+func throughput(n int64, d time.Duration) float64 {
+	if d <= 0 {
+		return 0
+	}
+	return float64(n) / d.Seconds()
+}
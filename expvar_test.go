@@ -0,0 +1,67 @@
+package queue
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDebugHandler(t *testing.T) {
+	queue := setupQueue(t, Config{Table: "jobs", Logger: &recordingLogger{}})
+	defer queue.Close()
+
+	if err := queue.Add([]byte("data")); err != nil {
+		t.Fatalf("failed to add item to queue: %v", err)
+	}
+	if err := queue.Subscribe("audit", func(msg Message) error { return nil }); err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+	queue.errLog.Println("Error retrieving item:", errors.New("disk I/O error"))
+
+	rec := httptest.NewRecorder()
+	queue.DebugHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/debug/queue", nil))
+
+	var info DebugInfo
+	if err := json.Unmarshal(rec.Body.Bytes(), &info); err != nil {
+		t.Fatalf("failed to decode debug info: %v", err)
+	}
+	if info.Table != "jobs" || info.Stats.Pending != 1 || info.Totals[MetricEnqueued] != 1 {
+		t.Fatalf("unexpected debug info: %+v", info)
+	}
+	if len(info.Subscriptions) != 1 || info.Subscriptions[0] != "audit" {
+		t.Fatalf("expected the subscription to be listed, got %v", info.Subscriptions)
+	}
+	if info.LastError != "Error retrieving item: disk I/O error" || info.LastErrorAt.IsZero() {
+		t.Fatalf("expected the last error, got %q at %v", info.LastError, info.LastErrorAt)
+	}
+}
+
+func TestExpvar(t *testing.T) {
+	queue := setupQueue(t, Config{})
+	defer queue.Close()
+
+	for i := 0; i < 2; i++ {
+		if err := queue.Add([]byte("data")); err != nil {
+			t.Fatalf("failed to add item to queue: %v", err)
+		}
+	}
+	items, err := queue.Claim(1)
+	if err != nil || len(items) != 1 {
+		t.Fatalf("failed to claim item: %+v, %v", items, err)
+	}
+	if err := queue.Ack(items[0].ID); err != nil {
+		t.Fatalf("failed to ack item: %v", err)
+	}
+
+	var vars map[string]any
+	if err := json.Unmarshal([]byte(queue.Expvar().String()), &vars); err != nil {
+		t.Fatalf("failed to decode expvar: %v", err)
+	}
+	if vars["depth"] != 1.0 || vars["in_flight"] != 0.0 || vars["enqueued"] != 2.0 || vars["acked"] != 1.0 {
+		t.Fatalf("unexpected vars: %v", vars)
+	}
+	if _, ok := vars["last_error"]; ok {
+		t.Fatalf("expected no last error, got %v", vars["last_error"])
+	}
+}
@@ -0,0 +1,129 @@
+package queue
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// feedPollInterval is how often TailEvents looks for new events once it has
+// caught up with the feed.
+const feedPollInterval = 250 * time.Millisecond
+
+// Event is an entry of the change feed. Type is one of the Transition
+// constants: TransitionEnqueued, TransitionClaimed, TransitionAcked,
+// TransitionReleased for failed deliveries, TransitionDeadLettered and so on.
+type Event struct {
+	Seq       int64     `json:"seq"`        // Position in the feed; increases with every event.
+	ItemID    int       `json:"item_id"`    // Identifier of the item the event applies to.
+	Type      string    `json:"type"`       // Name of the transition.
+	CreatedAt time.Time `json:"created_at"` // Time the transition happened.
+}
+
+// createEventsTable creates the table holding the change feed.
+func createEventsTable(tx *sql.Tx, t tables) error {
+	_, err := tx.Exec(`
+        CREATE TABLE IF NOT EXISTS ` + t.events + ` (
+            seq INTEGER PRIMARY KEY AUTOINCREMENT,
+            item_id INTEGER NOT NULL,
+            type TEXT NOT NULL,
+            created_at INTEGER NOT NULL
+        );
+    `)
+	return err
+}
+
+// recordEvent appends a transition to the change feed in the transaction that
+// performs it, so the feed never disagrees with the items table. It does
+// nothing unless Config.ChangeFeed is set.
+func (c *Queue) recordEvent(tx *sql.Tx, id int, transition string) error {
+	if !c.cfg.ChangeFeed {
+		return nil
+	}
+
+	_, err := tx.Exec(
+		"INSERT INTO "+c.tables.events+"(`item_id`, `type`, `created_at`) VALUES (?, ?, ?)",
+		id, transition, c.cfg.Clock.Now().UnixNano(),
+	)
+	return err
+}
+
+// Events returns up to 'limit' events of the change feed with a sequence
+// number greater than 'after', in order. Pass 0 to read from the start and
+// the Seq of the last event received to continue. Events are recorded only
+// while the queue runs with Config.ChangeFeed enabled and are kept until
+// removed with TrimEvents.
+func (c *Queue) Events(after int64, limit int) ([]Event, error) {
+	return c.events(c.ctx, after, limit)
+}
+
+// events reads a page of the change feed.
+func (c *Queue) events(ctx context.Context, after int64, limit int) ([]Event, error) {
+	rows, err := c.db.QueryContext(
+		ctx,
+		"SELECT `seq`, `item_id`, `type`, `created_at` FROM "+c.tables.events+" WHERE seq > ? ORDER BY seq LIMIT ?",
+		after, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close() // Ensure rows are closed after processing.
+
+	var events []Event
+	for rows.Next() {
+		var e Event
+		var createdAt int64
+		if err := rows.Scan(&e.Seq, &e.ItemID, &e.Type, &createdAt); err != nil {
+			return nil, err
+		}
+		e.CreatedAt = time.Unix(0, createdAt)
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// TailEvents calls fn for every event with a sequence number greater than
+// 'after', in order, and keeps following the feed until ctx is done or fn
+// returns an error, which TailEvents then returns. Consumers that persist the
+// Seq of the last handled event can resume from it after a restart.
+func (c *Queue) TailEvents(ctx context.Context, after int64, fn func(Event) error) error {
+	ticker := c.cfg.Clock.NewTicker(feedPollInterval)
+	defer ticker.Stop()
+
+	for {
+		events, err := c.events(ctx, after, 100)
+		if err != nil {
+			return err
+		}
+		for _, e := range events {
+			if err := fn(e); err != nil {
+				return err
+			}
+			after = e.Seq
+		}
+		if len(events) > 0 {
+			continue // There may be more events waiting.
+		}
+
+		select {
+		case <-ticker.C():
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-c.ctx.Done():
+			return c.ctx.Err()
+		}
+	}
+}
+
+// TrimEvents removes the events with a sequence number up to and including
+// 'through', e.g. once every consumer of the feed has handled them, and
+// returns the number of removed events.
+func (c *Queue) TrimEvents(through int64) (int, error) {
+	res, err := c.db.ExecContext(c.ctx, "DELETE FROM "+c.tables.events+" WHERE seq <= ?", through)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := res.RowsAffected()
+	return int(n), err
+}
@@ -0,0 +1,100 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestEvents(t *testing.T) {
+	queue := setupQueue(t, Config{ChangeFeed: true})
+	defer queue.Close()
+
+	if err := queue.Add([]byte("first")); err != nil {
+		t.Fatalf("failed to add item to queue: %v", err)
+	}
+	if err := queue.Add([]byte("second")); err != nil {
+		t.Fatalf("failed to add item to queue: %v", err)
+	}
+
+	items, err := queue.Claim(2)
+	if err != nil || len(items) != 2 {
+		t.Fatalf("failed to claim items: %v", err)
+	}
+	if err := queue.Ack(items[0].ID); err != nil {
+		t.Fatalf("failed to ack item: %v", err)
+	}
+	if err := queue.Release(items[1].ID); err != nil {
+		t.Fatalf("failed to release item: %v", err)
+	}
+
+	events, err := queue.Events(0, 100)
+	if err != nil {
+		t.Fatalf("failed to read events: %v", err)
+	}
+
+	expected := []string{TransitionEnqueued, TransitionEnqueued, TransitionClaimed, TransitionClaimed, TransitionAcked, TransitionReleased}
+	if len(events) != len(expected) {
+		t.Fatalf("expected %d events, got %+v", len(expected), events)
+	}
+	for i, e := range events {
+		if e.Type != expected[i] {
+			t.Fatalf("event %d: expected %s, got %s", i, expected[i], e.Type)
+		}
+		if i > 0 && e.Seq <= events[i-1].Seq {
+			t.Fatalf("sequence numbers are not increasing: %+v", events)
+		}
+	}
+
+	// Reading after a sequence number resumes from there.
+	rest, err := queue.Events(events[3].Seq, 100)
+	if err != nil || len(rest) != 2 || rest[0].ItemID != items[0].ID {
+		t.Fatalf("unexpected events after %d: %+v, %v", events[3].Seq, rest, err)
+	}
+
+	trimmed, err := queue.TrimEvents(events[3].Seq)
+	if err != nil || trimmed != 4 {
+		t.Fatalf("expected 4 trimmed events, got %d, %v", trimmed, err)
+	}
+}
+
+func TestEventsDisabled(t *testing.T) {
+	queue := setupQueue(t, Config{})
+	defer queue.Close()
+
+	if err := queue.Add([]byte("test data")); err != nil {
+		t.Fatalf("failed to add item to queue: %v", err)
+	}
+
+	events, err := queue.Events(0, 100)
+	if err != nil {
+		t.Fatalf("failed to read events: %v", err)
+	}
+	if len(events) != 0 {
+		t.Fatalf("expected no events without ChangeFeed, got %+v", events)
+	}
+}
+
+func TestTailEvents(t *testing.T) {
+	queue := setupQueue(t, Config{ChangeFeed: true})
+	defer queue.Close()
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		queue.Add([]byte("late"))
+	}()
+
+	stop := errors.New("stop")
+	var received []Event
+	err := queue.TailEvents(context.Background(), 0, func(e Event) error {
+		received = append(received, e)
+		return stop
+	})
+	if !errors.Is(err, stop) {
+		t.Fatalf("expected the callback error, got %v", err)
+	}
+	if len(received) != 1 || received[0].Type != TransitionEnqueued {
+		t.Fatalf("unexpected events: %+v", received)
+	}
+}
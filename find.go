@@ -0,0 +1,42 @@
+package queue
+
+import "strings"
+
+// Find returns up to 'limit' queued items whose JSON payload holds 'value' at 'jsonPath'.
+// The path uses SQLite JSON path syntax, e.g. "$.customer.id"; a path without
+// the leading "$" is treated as relative to the document root. Items whose
+// payload is not valid JSON are skipped, as are payloads split by
+// Config.ChunkSize, whose rows only hold the first chunk.
+func (c *Queue) Find(jsonPath string, value any, limit int) ([]Item, error) {
+	if !strings.HasPrefix(jsonPath, "$") {
+		jsonPath = "$." + jsonPath
+	}
+
+	c.mx.Lock() // Lock for exclusive access to the queue.
+	defer c.mx.Unlock()
+
+	// Payloads are stored as BLOBs, which SQLite would read as JSONB, so cast them to text first.
+	rows, err := c.db.QueryContext(
+		c.ctx,
+		"SELECT "+itemColumns+" FROM "+c.tables.items+" WHERE json_valid(CAST(data AS TEXT)) AND json_extract(CAST(data AS TEXT), ?) = ? ORDER BY id LIMIT ?",
+		jsonPath, value, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close() // Ensure rows are closed after processing.
+
+	var items []Item
+	for rows.Next() {
+		item, err := scanItem(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item) // Collect items into a slice.
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close() // Release the connection before loading the payloads.
+	return items, c.loadPayloads(c.db, items)
+}
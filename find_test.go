@@ -0,0 +1,36 @@
+package queue
+
+import "testing"
+
+func TestFind(t *testing.T) {
+	queue := setupQueue(t, Config{})
+	defer queue.Close()
+
+	payloads := []string{
+		`{"customer": {"id": 7}, "job": "invoice"}`,
+		`{"customer": {"id": 8}, "job": "invoice"}`,
+		`not json`,
+		`{"customer": {"id": 7}, "job": "refund"}`,
+	}
+	for _, payload := range payloads {
+		if err := queue.Add([]byte(payload)); err != nil {
+			t.Fatalf("failed to add item to queue: %v", err)
+		}
+	}
+
+	items, err := queue.Find("$.customer.id", 7, 10)
+	if err != nil {
+		t.Fatalf("failed to find items: %v", err)
+	}
+	if len(items) != 2 || items[0].ID != 1 || items[1].ID != 4 {
+		t.Fatalf("unexpected items: %+v", items)
+	}
+
+	items, err = queue.Find("job", "refund", 10)
+	if err != nil {
+		t.Fatalf("failed to find items: %v", err)
+	}
+	if len(items) != 1 || items[0].ID != 4 {
+		t.Fatalf("unexpected items: %+v", items)
+	}
+}
@@ -0,0 +1,184 @@
+package queue
+
+import (
+	"database/sql"
+	"sync"
+)
+
+// groupState collects the Adds waiting for the flusher of a queue with
+// Config.GroupCommitSize.
+type groupState struct {
+	wake chan struct{} // Signalled when a group starts or fills up.
+
+	mx      sync.Mutex    // Guards the fields below.
+	pending []*pendingAdd // Adds waiting for the next group, in arrival order.
+	stopped bool          // Set once the flusher has returned; Adds commit on their own.
+}
+
+// pendingAdd is an Add handed to the flusher.
+type pendingAdd struct {
+	data    []byte
+	encoded any
+	opts    addOptions
+	policy  OverflowPolicy
+
+	id    int           // ID of the item; set along with err.
+	freed chan struct{} // Closed once an item leaves the queue, for Adds that did not fit.
+	err   error
+	done  chan struct{} // Closed once the group of the Add is committed or rolled back.
+}
+
+// commitAdd inserts an item in a transaction of its own or, with
+// Config.GroupCommitSize, in the next group committed by the flusher. It
+// returns the ID of the item and a channel closed once an item leaves the
+// queue, to wait on if the item did not fit.
+func (c *Queue) commitAdd(data []byte, encoded any, opts addOptions, policy OverflowPolicy) (int, chan struct{}, error) {
+	if c.cfg.GroupCommitSize > 1 {
+		req := &pendingAdd{data: data, encoded: encoded, opts: opts, policy: policy, done: make(chan struct{})}
+		if c.submitAdd(req) {
+			<-req.done
+			return req.id, req.freed, req.err
+		}
+	}
+
+	c.mx.Lock() // Lock for exclusive access to the queue.
+	defer c.mx.Unlock()
+
+	freed := c.freed
+	var id int
+	err := c.withTx(func(tx *sql.Tx) error {
+		var err error
+		id, err = c.insertItem(tx, data, encoded, opts, policy)
+		return err
+	})
+	if err == nil && opts.awaited {
+		// Mark the item before the lock is released, so it cannot be
+		// acknowledged without a result.
+		c.awaited[id] = true
+	}
+	return id, freed, err
+}
+
+// submitAdd queues an Add for the flusher. It returns false once the
+// flusher has stopped, and the caller commits the Add itself.
+func (c *Queue) submitAdd(req *pendingAdd) bool {
+	c.group.mx.Lock()
+	defer c.group.mx.Unlock()
+
+	if c.group.stopped {
+		return false
+	}
+	c.group.pending = append(c.group.pending, req)
+	if n := len(c.group.pending); n == 1 || n >= c.cfg.GroupCommitSize {
+		// Wake the flusher without blocking if it is already awake.
+		select {
+		case c.group.wake <- struct{}{}:
+		default:
+		}
+	}
+	return true
+}
+
+// runGroupCommit commits the Adds of concurrent producers in groups of up
+// to Config.GroupCommitSize until the queue is closed. A group is committed
+// once it is full or Config.GroupCommitInterval after it started; with no
+// interval, it holds the Adds that arrived while the last group committed.
+func (c *Queue) runGroupCommit() {
+	for {
+		select {
+		case <-c.ctx.Done():
+			// Answer the Adds still waiting; they fail as the queue is closed.
+			c.group.mx.Lock()
+			c.group.stopped = true
+			group := c.group.pending
+			c.group.pending = nil
+			c.group.mx.Unlock()
+			c.commitGroup(group)
+			return
+		case <-c.group.wake:
+		}
+
+		if c.cfg.GroupCommitInterval > 0 {
+			timeout := c.cfg.Clock.After(c.cfg.GroupCommitInterval)
+		wait:
+			for !c.groupFull() {
+				select {
+				case <-c.group.wake:
+				case <-timeout:
+					break wait
+				case <-c.ctx.Done():
+					break wait
+				}
+			}
+		}
+		c.commitGroup(c.takeGroup())
+	}
+}
+
+// groupFull reports whether enough Adds are waiting to fill a group.
+func (c *Queue) groupFull() bool {
+	c.group.mx.Lock()
+	defer c.group.mx.Unlock()
+
+	return len(c.group.pending) >= c.cfg.GroupCommitSize
+}
+
+// takeGroup removes the next group from the waiting Adds.
+func (c *Queue) takeGroup() []*pendingAdd {
+	c.group.mx.Lock()
+	defer c.group.mx.Unlock()
+
+	n := min(len(c.group.pending), c.cfg.GroupCommitSize)
+	group := c.group.pending[:n:n]
+	c.group.pending = c.group.pending[n:]
+	if len(c.group.pending) > 0 {
+		// Come back for the rest right away.
+		select {
+		case c.group.wake <- struct{}{}:
+		default:
+		}
+	}
+	return group
+}
+
+// commitGroup inserts a group of Adds in one transaction. Each insert runs
+// in a savepoint, so an Add that fails, e.g. with ErrQueueFull, leaves the
+// rest of the group unaffected; if the commit fails, every Add fails with it.
+func (c *Queue) commitGroup(group []*pendingAdd) {
+	if len(group) == 0 {
+		return
+	}
+
+	c.mx.Lock() // Lock for exclusive access to the queue.
+	defer c.mx.Unlock()
+
+	freed := c.freed
+	err := c.withTx(func(tx *sql.Tx) error {
+		for _, req := range group {
+			if _, err := tx.Exec("SAVEPOINT add_item"); err != nil {
+				return err
+			}
+			req.id, req.err = c.insertItem(tx, req.data, req.encoded, req.opts, req.policy)
+			if req.err != nil {
+				if _, err := tx.Exec("ROLLBACK TO add_item"); err != nil {
+					return err
+				}
+			}
+			if _, err := tx.Exec("RELEASE add_item"); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	for _, req := range group {
+		switch {
+		case err != nil:
+			req.err = err
+		case req.err == nil && req.opts.awaited:
+			c.awaited[req.id] = true
+		}
+		req.freed = freed
+		close(req.done)
+	}
+}
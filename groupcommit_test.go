@@ -0,0 +1,120 @@
+package queue
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestGroupCommit(t *testing.T) {
+	queue := setupQueue(t, Config{GroupCommitSize: 16, GroupCommitInterval: time.Millisecond})
+	defer queue.Close()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 100)
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs <- queue.Add([]byte(fmt.Sprintf("item %d", i)))
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("failed to add item to queue: %v", err)
+		}
+	}
+
+	items, err := queue.Get(200)
+	if err != nil || len(items) != 100 {
+		t.Fatalf("expected every item to be committed, got %d, %v", len(items), err)
+	}
+}
+
+func TestGroupCommitPartialFailure(t *testing.T) {
+	// The group only commits once full, so the Adds share a transaction.
+	queue := setupQueue(t, Config{GroupCommitSize: 4, GroupCommitInterval: time.Hour, MaxItems: 2})
+	defer queue.Close()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 4)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- queue.Add([]byte("test data"))
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	added, full := 0, 0
+	for err := range errs {
+		switch {
+		case err == nil:
+			added++
+		case errors.Is(err, ErrQueueFull):
+			full++
+		default:
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if added != 2 || full != 2 {
+		t.Fatalf("expected 2 items added and 2 rejected, got %d and %d", added, full)
+	}
+
+	items, err := queue.Get(10)
+	if err != nil || len(items) != 2 {
+		t.Fatalf("expected the items that fit to be committed, got %+v, %v", items, err)
+	}
+}
+
+func TestGroupCommitClose(t *testing.T) {
+	queue := setupQueue(t, Config{GroupCommitSize: 4, GroupCommitInterval: time.Hour})
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- queue.Add([]byte("test data"))
+	}()
+	time.Sleep(50 * time.Millisecond)
+	queue.Close()
+
+	select {
+	case err := <-errs:
+		if err == nil {
+			t.Fatalf("expected the waiting Add to fail once the queue is closed")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected Close to answer the waiting Add")
+	}
+	if err := queue.Add([]byte("test data")); err == nil {
+		t.Fatalf("expected Add to fail after Close")
+	}
+}
+
+func BenchmarkGroupCommit(b *testing.B) {
+	for _, size := range []int{0, 64} {
+		b.Run(fmt.Sprintf("size=%d", size), func(b *testing.B) {
+			queue, err := New(Config{LocalFile: b.TempDir() + "/queue.db", JournalMode: "WAL", Synchronous: "FULL", GroupCommitSize: size})
+			if err != nil {
+				b.Fatalf("failed to initialize queue: %v", err)
+			}
+			defer queue.Close()
+
+			data := []byte("benchmark data")
+			b.SetParallelism(16)
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					if err := queue.Add(data); err != nil {
+						b.Errorf("failed to add item to queue: %v", err)
+						return
+					}
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,225 @@
+package queue
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// createDeliveriesTable creates the table tracking the messages consumer
+// groups are working on.
+func createDeliveriesTable(tx *sql.Tx, t tables) error {
+	_, err := tx.Exec(`
+        CREATE TABLE IF NOT EXISTS ` + t.deliveries + ` (
+            grp TEXT NOT NULL,
+            seq INTEGER NOT NULL,
+            owner TEXT,
+            lease_until INTEGER,
+            done INTEGER NOT NULL DEFAULT 0,
+            PRIMARY KEY (grp, seq)
+        );
+    `)
+	return err
+}
+
+// ClaimGroup claims up to 'limit' published messages for a consumer group.
+// Every group receives each message published after it was first used, and
+// the consumers of a group, in this or other processes sharing the database,
+// split its messages between them. Each claimed message must be passed to
+// AckGroup once handled; otherwise it is claimed again when its lease, of
+// Config.LeaseTimeout, expires. Groups share their names with the subscribers
+// of Subscribe and are removed with Unsubscribe.
+func (c *Queue) ClaimGroup(group string, limit int) ([]Message, error) {
+	c.mx.Lock() // Lock for exclusive access to the queue.
+	defer c.mx.Unlock()
+
+	var messages []Message
+	err := c.withTx(func(tx *sql.Tx) error {
+		// New groups start at the end of the log.
+		_, err := tx.Exec(
+			"INSERT OR IGNORE INTO "+c.tables.subscribers+"(`name`, `cursor`) SELECT ?, COALESCE(MAX(seq), 0) FROM "+c.tables.messages,
+			group,
+		)
+		if err != nil {
+			return err
+		}
+
+		now := c.cfg.Clock.Now().UnixNano()
+		if messages, err = c.claimableMessages(tx, group, now, limit); err != nil {
+			return err
+		}
+
+		for _, msg := range messages {
+			_, err := tx.Exec(
+				"INSERT OR REPLACE INTO "+c.tables.deliveries+"(`grp`, `seq`, `owner`, `lease_until`, `done`) VALUES (?, ?, ?, ?, 0)",
+				group, msg.Seq, c.owner, now+c.cfg.LeaseTimeout.Nanoseconds(),
+			)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// claimableMessages returns the messages past the offset of a group that no
+// consumer of the group has handled or holds a live lease on, closing the
+// rows before the caller issues further statements.
+func (c *Queue) claimableMessages(tx *sql.Tx, group string, now int64, limit int) ([]Message, error) {
+	rows, err := tx.Query(
+		"SELECT m.`seq`, m.`data`, m.`tags`, m.`published_at` FROM "+c.tables.messages+" m, "+c.tables.subscribers+" s"+
+			" WHERE s.name = ?1 AND m.seq > s.cursor AND NOT EXISTS ("+
+			"SELECT 1 FROM "+c.tables.deliveries+" d WHERE d.grp = ?1 AND d.seq = m.seq AND (d.done = 1 OR d.lease_until >= ?2)"+
+			") ORDER BY m.seq LIMIT ?3",
+		group, now, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close() // Ensure rows are closed after processing.
+
+	var messages []Message
+	for rows.Next() {
+		var msg Message
+		var tags sql.NullString
+		var publishedAt int64
+		if err := rows.Scan(&msg.Seq, &msg.Data, &tags, &publishedAt); err != nil {
+			return nil, err
+		}
+		if msg.Tags, err = decodeTags(tags.String); err != nil {
+			return nil, err
+		}
+		msg.PublishedAt = time.Unix(0, publishedAt)
+		messages = append(messages, msg)
+	}
+	return messages, rows.Err()
+}
+
+// AckGroup marks a message claimed with ClaimGroup as handled by the group
+// and moves the offset of the group past every message handled so far.
+// It returns ErrItemNotFound if this instance does not hold the message,
+// e.g. because its lease expired and another consumer claimed it.
+func (c *Queue) AckGroup(group string, seq int64) error {
+	c.mx.Lock() // Lock for exclusive access to the queue.
+	defer c.mx.Unlock()
+
+	return c.withTx(func(tx *sql.Tx) error {
+		res, err := tx.Exec(
+			"UPDATE "+c.tables.deliveries+" SET done = 1, owner = NULL, lease_until = NULL WHERE grp = ? AND seq = ? AND owner = ? AND done = 0",
+			group, seq, c.owner,
+		)
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return ErrItemNotFound
+		}
+
+		// The offset stops before the oldest message not handled yet, so
+		// messages acknowledged out of order are not skipped.
+		_, err = tx.Exec(
+			"UPDATE "+c.tables.subscribers+" SET cursor = COALESCE("+
+				"(SELECT MIN(m.seq) - 1 FROM "+c.tables.messages+" m WHERE m.seq > cursor AND NOT EXISTS ("+
+				"SELECT 1 FROM "+c.tables.deliveries+" d WHERE d.grp = ?1 AND d.seq = m.seq AND d.done = 1)),"+
+				"(SELECT MAX(seq) FROM "+c.tables.messages+")) WHERE name = ?1",
+			group,
+		)
+		if err != nil {
+			return err
+		}
+
+		// Bookkeeping behind the offset is no longer needed.
+		_, err = tx.Exec(
+			"DELETE FROM "+c.tables.deliveries+" WHERE grp = ?1 AND seq <= (SELECT cursor FROM "+c.tables.subscribers+" WHERE name = ?1)",
+			group,
+		)
+		if err != nil {
+			return err
+		}
+		return c.pruneMessages(tx)
+	})
+}
+
+// releaseGroup hands a message claimed by this instance back to its group.
+func (c *Queue) releaseGroup(group string, seq int64) error {
+	c.mx.Lock() // Lock for exclusive access to the queue.
+	defer c.mx.Unlock()
+
+	_, err := c.db.ExecContext(
+		c.ctx,
+		"DELETE FROM "+c.tables.deliveries+" WHERE grp = ? AND seq = ? AND owner = ? AND done = 0",
+		group, seq, c.owner,
+	)
+	return err
+}
+
+// GroupListener starts a consumer of a group that hands messages to clb one
+// at a time until the queue is closed. Register several to process the
+// messages of a group in parallel. A message clb returns an error or panics
+// for is handed to a consumer of the group again after the delay of
+// Config.RetryPolicy, or acknowledged if the policy gives up.
+func (c *Queue) GroupListener(group string, clb func(msg Message) error) {
+	go c.runGroupConsumer(c.ctx, group, clb)
+}
+
+// runGroupConsumer claims and handles the messages of a group until ctx is done.
+func (c *Queue) runGroupConsumer(ctx context.Context, group string, clb func(msg Message) error) {
+	ticker := c.cfg.Clock.NewTicker(feedPollInterval)
+	defer ticker.Stop()
+
+	var failures attempts
+	for {
+		c.mx.Lock()
+		published := c.published
+		c.mx.Unlock()
+
+		messages, err := c.ClaimGroup(group, 1)
+		if err != nil && ctx.Err() == nil {
+			c.cfg.Logger.Println("Error claiming messages:", err)
+		}
+
+		for _, msg := range messages {
+			if !c.acquireSlot(ctx) {
+				return
+			}
+			err := c.deliverMessage(msg, clb)
+			if err != nil {
+				delay, giveUp := c.retryPolicy().NextDelay(failures.next(msg.Seq), err)
+				if !giveUp {
+					c.cfg.Logger.Println("Consumer of group", group, "failed, retrying:", err)
+					select {
+					case <-c.cfg.Clock.After(delay):
+					case <-ctx.Done():
+						return
+					}
+					if err := c.releaseGroup(group, msg.Seq); err != nil && ctx.Err() == nil {
+						c.cfg.Logger.Println("Error releasing message:", err)
+					}
+					continue
+				}
+				c.cfg.Logger.Println("Consumer of group", group, "failed, skipping message:", err)
+			}
+			if err := c.AckGroup(group, msg.Seq); err != nil && ctx.Err() == nil {
+				c.cfg.Logger.Println("Error acknowledging message:", err)
+			}
+		}
+		if len(messages) > 0 {
+			continue // There may be more messages waiting.
+		}
+
+		select {
+		case <-published:
+		case <-ticker.C():
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package queue
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestConsumerGroups(t *testing.T) {
+	queue := setupQueue(t, Config{})
+	defer queue.Close()
+
+	// Using a group registers it, so it receives everything published afterwards.
+	for _, group := range []string{"billing", "emails"} {
+		if _, err := queue.ClaimGroup(group, 1); err != nil {
+			t.Fatalf("failed to join group %s: %v", group, err)
+		}
+	}
+	for _, data := range []string{"one", "two", "three"} {
+		if _, err := queue.Publish([]byte(data)); err != nil {
+			t.Fatalf("failed to publish: %v", err)
+		}
+	}
+
+	// Consumers of one group split the messages.
+	first, err := queue.ClaimGroup("billing", 2)
+	if err != nil || len(first) != 2 {
+		t.Fatalf("failed to claim messages: %v, %+v", err, first)
+	}
+	second, err := queue.ClaimGroup("billing", 2)
+	if err != nil || len(second) != 1 || string(second[0].Data) != "three" {
+		t.Fatalf("expected the remaining message, got %+v, %v", second, err)
+	}
+
+	// Another group still receives every message.
+	emails, err := queue.ClaimGroup("emails", 10)
+	if err != nil || len(emails) != 3 {
+		t.Fatalf("expected every message for the second group, got %+v, %v", emails, err)
+	}
+
+	// Acknowledging out of order keeps the offset before unhandled messages.
+	if err := queue.AckGroup("billing", second[0].Seq); err != nil {
+		t.Fatalf("failed to ack message: %v", err)
+	}
+	for _, msg := range first {
+		if err := queue.AckGroup("billing", msg.Seq); err != nil {
+			t.Fatalf("failed to ack message: %v", err)
+		}
+	}
+	if err := queue.AckGroup("billing", first[0].Seq); !errors.Is(err, ErrItemNotFound) {
+		t.Fatalf("expected ErrItemNotFound for a second ack, got %v", err)
+	}
+	if msgs, err := queue.ClaimGroup("billing", 10); err != nil || len(msgs) != 0 {
+		t.Fatalf("expected nothing left for the group, got %+v, %v", msgs, err)
+	}
+}
+
+func TestConsumerGroupLeaseExpires(t *testing.T) {
+	queue := setupQueue(t, Config{LeaseTimeout: time.Millisecond})
+	defer queue.Close()
+
+	if _, err := queue.ClaimGroup("workers", 1); err != nil {
+		t.Fatalf("failed to join group: %v", err)
+	}
+	if _, err := queue.Publish([]byte("job")); err != nil {
+		t.Fatalf("failed to publish: %v", err)
+	}
+
+	if msgs, err := queue.ClaimGroup("workers", 1); err != nil || len(msgs) != 1 {
+		t.Fatalf("failed to claim message: %+v, %v", msgs, err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if msgs, err := queue.ClaimGroup("workers", 1); err != nil || len(msgs) != 1 {
+		t.Fatalf("expected the message to be claimed again, got %+v, %v", msgs, err)
+	}
+}
+
+func TestGroupListener(t *testing.T) {
+	queue := setupQueue(t, Config{})
+	defer queue.Close()
+
+	if _, err := queue.ClaimGroup("workers", 1); err != nil {
+		t.Fatalf("failed to join group: %v", err)
+	}
+
+	var mx sync.Mutex
+	seen := make(map[string]int)
+	done := make(chan struct{}, 10)
+	for i := 0; i < 2; i++ {
+		queue.GroupListener("workers", func(msg Message) error {
+			mx.Lock()
+			seen[string(msg.Data)]++
+			mx.Unlock()
+			done <- struct{}{}
+			return nil
+		})
+	}
+
+	for _, data := range []string{"a", "b", "c"} {
+		if _, err := queue.Publish([]byte(data)); err != nil {
+			t.Fatalf("failed to publish: %v", err)
+		}
+	}
+
+	for i := 0; i < 3; i++ {
+		select {
+		case <-done:
+		case <-time.After(3 * time.Second):
+			t.Fatalf("timed out waiting for message %d", i+1)
+		}
+	}
+
+	mx.Lock()
+	defer mx.Unlock()
+	for _, data := range []string{"a", "b", "c"} {
+		if seen[data] != 1 {
+			t.Fatalf("expected %q to be handled once by the group, got %v", data, seen)
+		}
+	}
+}
+
+func TestGroupListenerPanic(t *testing.T) {
+	// A single slot, so the retry only runs if the panic gave it back.
+	queue := setupQueue(t, Config{MaxInFlight: 1, Logger: &recordingLogger{}})
+	defer queue.Close()
+
+	if _, err := queue.ClaimGroup("workers", 1); err != nil {
+		t.Fatalf("failed to join group: %v", err)
+	}
+
+	got := make(chan string, 10)
+	panicked := false
+	queue.GroupListener("workers", func(msg Message) error {
+		if !panicked {
+			panicked = true
+			panic("boom")
+		}
+		got <- string(msg.Data)
+		return nil
+	})
+
+	if _, err := queue.Publish([]byte("retried")); err != nil {
+		t.Fatalf("failed to publish: %v", err)
+	}
+
+	select {
+	case data := <-got:
+		if data != "retried" {
+			t.Fatalf("unexpected message %q", data)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatalf("timed out waiting for the message to be delivered again")
+	}
+}
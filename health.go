@@ -0,0 +1,82 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Checks reported in HealthError.Check.
+const (
+	HealthDatabase   = "database"   // The database did not answer a ping.
+	HealthDispatcher = "dispatcher" // The listener loops went without a heartbeat for longer than Config.StallTimeout.
+	HealthBacklog    = "backlog"    // More than Config.MaxBacklog items are pending.
+	HealthDraining   = "draining"   // Drain was called, so the queue accepts no new items.
+)
+
+// HealthError describes a failed check of Health. When several checks fail,
+// the errors are joined with errors.Join, and errors.As yields the first.
+type HealthError struct {
+	Check  string // Failed check, e.g. HealthBacklog.
+	Reason string // What the check found.
+}
+
+func (e *HealthError) Error() string {
+	return fmt.Sprintf("queue: unhealthy %s: %s", e.Check, e.Reason)
+}
+
+// Is reports whether target is ErrUnhealthy.
+func (e *HealthError) Is(target error) bool {
+	return target == ErrUnhealthy
+}
+
+// Health reports whether the queue is able to serve, for readiness probes:
+// it pings the database, checks that the queue is not draining, that the
+// listener loops started an iteration within Config.StallTimeout, and that
+// no more than Config.MaxBacklog items are pending. It returns nil if all checks pass,
+// ErrClosed if the queue is closed, and otherwise one *HealthError per
+// failed check, matched by ErrUnhealthy.
+//
+// The listener loops beat between items and at least every two seconds when
+// idle, so a listener taking longer than StallTimeout for a single item
+// makes the dispatcher check fail.
+func (c *Queue) Health(ctx context.Context) error {
+	if c.ctx.Err() != nil {
+		return ErrClosed
+	}
+
+	if err := c.db.PingContext(ctx); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		// Without the database the other checks cannot run.
+		return &HealthError{Check: HealthDatabase, Reason: err.Error()}
+	}
+
+	var errs []error
+	if c.draining.Load() {
+		errs = append(errs, &HealthError{Check: HealthDraining, Reason: "not accepting new items"})
+	}
+	// Workers that are not started, stopped or wait for a listener have no heartbeat.
+	c.mx.Lock()
+	silent := c.cfg.Clock.Now().Sub(c.heartbeat)
+	dispatching := c.started.Load() && !c.stopped.Load() && c.listening()
+	c.mx.Unlock()
+	if dispatching && silent > c.cfg.StallTimeout {
+		errs = append(errs, &HealthError{Check: HealthDispatcher, Reason: fmt.Sprintf("no heartbeat for %v", silent)})
+	}
+
+	if c.cfg.MaxBacklog > 0 {
+		var pending int
+		err := c.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+c.tables.items+" WHERE state = 'pending'").Scan(&pending)
+		switch {
+		case err != nil && ctx.Err() != nil:
+			return ctx.Err()
+		case err != nil:
+			errs = append(errs, &HealthError{Check: HealthDatabase, Reason: err.Error()})
+		case pending > c.cfg.MaxBacklog:
+			errs = append(errs, &HealthError{Check: HealthBacklog, Reason: fmt.Sprintf("%d items pending, more than %d", pending, c.cfg.MaxBacklog)})
+		}
+	}
+	return errors.Join(errs...)
+}
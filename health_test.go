@@ -0,0 +1,51 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestHealth(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1700000000, 0))
+	queue := setupQueue(t, Config{Clock: clock, MaxBacklog: 1, StallTimeout: time.Minute})
+	defer queue.Close()
+
+	ctx := context.Background()
+	if err := queue.Health(ctx); err != nil {
+		t.Fatalf("expected a new queue to be healthy, got %v", err)
+	}
+
+	// The listener loop gets stuck on the first item, two more are pending.
+	entered, unblock := make(chan struct{}), make(chan struct{})
+	queue.Listener(func(item Item, delay func(sec time.Duration)) {
+		entered <- struct{}{}
+		<-unblock
+	})
+	defer close(unblock)
+	for i := 0; i < 3; i++ {
+		if err := queue.Add([]byte("data")); err != nil {
+			t.Fatalf("failed to add item to queue: %v", err)
+		}
+	}
+	<-entered
+
+	var healthErr *HealthError
+	err := queue.Health(ctx)
+	if !errors.Is(err, ErrUnhealthy) || !errors.As(err, &healthErr) || healthErr.Check != HealthBacklog {
+		t.Fatalf("expected the backlog check to fail, got %v", err)
+	}
+
+	clock.Advance(time.Hour)
+	err = queue.Health(ctx)
+	joined, ok := err.(interface{ Unwrap() []error })
+	if !ok || len(joined.Unwrap()) != 2 || !errors.As(err, &healthErr) || healthErr.Check != HealthDispatcher {
+		t.Fatalf("expected the dispatcher and backlog checks to fail, got %v", err)
+	}
+
+	queue.Close()
+	if err := queue.Health(ctx); !errors.Is(err, ErrClosed) {
+		t.Fatalf("expected ErrClosed, got %v", err)
+	}
+}
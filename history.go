@@ -0,0 +1,172 @@
+package queue
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// replayPageSize is the number of history entries read per round trip by Replay.
+const replayPageSize = 100
+
+// createHistoryTable creates the history of processed items kept with
+// Config.History.
+func createHistoryTable(tx *sql.Tx, t tables) error {
+	_, err := tx.Exec(`
+        CREATE TABLE IF NOT EXISTS ` + t.history + ` (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            item_id INTEGER NOT NULL,
+            data BLOB NOT NULL,
+            tags TEXT,
+            priority INTEGER NOT NULL DEFAULT 0,
+            tenant TEXT,
+            headers TEXT,
+            job_type TEXT,
+            checksum INTEGER,
+            key_id TEXT,
+            processed_at INTEGER NOT NULL
+        );
+        CREATE INDEX IF NOT EXISTS ` + t.history + `_processed_at ON ` + t.history + `(processed_at);
+        CREATE INDEX IF NOT EXISTS ` + t.history + `_item_id ON ` + t.history + `(item_id);
+    `)
+	return err
+}
+
+// recordHistory copies an item claimed by this instance to the history
+// before it is removed as processed, with its whole payload, still sealed
+// under its key, and trims the history to Config.HistoryRetention and
+// Config.HistoryMaxItems. It does nothing unless Config.History is set or
+// if the item is no longer held by this instance under the delivery nonce,
+// if not nil.
+func (c *Queue) recordHistory(tx *sql.Tx, id int, nonce any) error {
+	if !c.cfg.History {
+		return nil
+	}
+
+	rows, err := tx.Query(
+		"SELECT "+itemColumns+" FROM "+c.tables.items+" WHERE id = ?1 AND owner = ?2 AND state = 'in-flight' AND (?3 IS NULL OR receipt = ?3)",
+		id, c.owner, nonce,
+	)
+	if err != nil {
+		return err
+	}
+	if !rows.Next() {
+		rows.Close()
+		return rows.Err()
+	}
+	item, err := scanItem(rows)
+	rows.Close() // Release the rows before reading the chunks.
+	if err != nil {
+		return err
+	}
+	if err := c.completePayload(tx, &item); err != nil {
+		return err
+	}
+
+	tags, err := encodeTags(item.Tags)
+	if err != nil {
+		return err
+	}
+	headers, err := encodeHeaders(item.Headers)
+	if err != nil {
+		return err
+	}
+	now := c.cfg.Clock.Now()
+	res, err := tx.Exec(
+		"INSERT INTO "+c.tables.history+"(`item_id`, `data`, `tags`, `priority`, `tenant`, `headers`, `job_type`, `checksum`, `key_id`, `processed_at`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		item.ID, item.Data, tags, item.Priority, nullString(item.Tenant), headers, nullString(item.Type), item.checksum, nullString(item.keyID), now.UnixNano(),
+	)
+	if err != nil {
+		return err
+	}
+
+	if c.cfg.HistoryMaxItems > 0 {
+		last, err := res.LastInsertId()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec("DELETE FROM "+c.tables.history+" WHERE id <= ?", last-int64(c.cfg.HistoryMaxItems)); err != nil {
+			return err
+		}
+	}
+	if c.cfg.HistoryRetention > 0 {
+		if _, err := tx.Exec("DELETE FROM "+c.tables.history+" WHERE processed_at < ?", now.Add(-c.cfg.HistoryRetention).UnixNano()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Replay adds the items processed between from, inclusive, and to,
+// exclusive, to target again, in the order they were processed, e.g. after
+// a handler bug corrupted the data written downstream during that time. A
+// nil target replays into this queue. The items are added as new items with
+// their tags, priority, tenant, headers and job type, through the Add
+// middleware and the overflow policy of target. Only items acknowledged or
+// consumed while Config.History was set are replayed, as long as the history
+// still holds them. Replay returns the number of items added, which is short
+// of the window if ctx is done or an Add fails.
+func (c *Queue) Replay(ctx context.Context, from, to time.Time, target *Queue) (int, error) {
+	if target == nil {
+		target = c
+	}
+
+	replayed, cursor := 0, int64(0)
+	for {
+		items, last, err := c.historyPage(ctx, from, to, cursor)
+		if err != nil {
+			return replayed, err
+		}
+		for _, item := range items {
+			opts := []AddOption{WithTags(item.Tags...), WithPriority(item.Priority), WithTenant(item.Tenant), WithHeaders(item.Headers), WithType(item.Type)}
+			if _, err := target.AddContext(ctx, item.Data, opts...); err != nil {
+				return replayed, err
+			}
+			replayed++
+		}
+		if len(items) < replayPageSize {
+			return replayed, nil
+		}
+		cursor = last
+	}
+}
+
+// historyPage reads the next page of history entries processed between from
+// and to after the entry 'cursor', with their payloads opened and verified.
+// It returns the ID of the last entry read.
+func (c *Queue) historyPage(ctx context.Context, from, to time.Time, cursor int64) ([]Item, int64, error) {
+	rows, err := c.db.QueryContext(
+		ctx,
+		"SELECT `id`, `item_id`, `data`, `tags`, `priority`, `tenant`, `headers`, `job_type`, `checksum`, `key_id` FROM "+c.tables.history+
+			" WHERE processed_at >= ? AND processed_at < ? AND id > ? ORDER BY id LIMIT ?",
+		from.UnixNano(), to.UnixNano(), cursor, replayPageSize,
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close() // Ensure rows are closed after processing.
+
+	var items []Item
+	for rows.Next() {
+		var item Item
+		var tags, tenant, headers, jobType, keyID sql.NullString
+		if err := rows.Scan(&cursor, &item.ID, &item.Data, &tags, &item.Priority, &tenant, &headers, &jobType, &item.checksum, &keyID); err != nil {
+			return nil, 0, err
+		}
+		if item.Tags, err = decodeTags(tags.String); err != nil {
+			return nil, 0, err
+		}
+		if item.Headers, err = decodeHeaders(headers.String); err != nil {
+			return nil, 0, err
+		}
+		item.Tenant, item.Type, item.keyID = tenant.String, jobType.String, keyID.String
+		if err := c.decrypt(&item); err != nil {
+			return nil, 0, err
+		}
+		if err := verifyChecksum(item); err != nil {
+			return nil, 0, err
+		}
+		items = append(items, item)
+	}
+	return items, cursor, rows.Err()
+}
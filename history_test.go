@@ -0,0 +1,165 @@
+package queue
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+)
+
+// processNext claims and acknowledges the next item of a queue without listeners.
+func processNext(t *testing.T, queue *Queue) {
+	t.Helper()
+	items, err := queue.Claim(1)
+	if err != nil || len(items) != 1 {
+		t.Fatalf("failed to claim item: %+v, %v", items, err)
+	}
+	if err := queue.Ack(items[0].ID); err != nil {
+		t.Fatalf("failed to acknowledge item: %v", err)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(start)
+	queue := setupQueue(t, Config{History: true, Clock: clock, ChunkSize: 4, ManualStart: true})
+	defer queue.Close()
+	target := setupQueue(t, Config{ManualStart: true})
+	defer target.Close()
+
+	if _, err := queue.AddWithOptions([]byte("before the bug"), WithTags("a")); err != nil {
+		t.Fatalf("failed to add item to queue: %v", err)
+	}
+	processNext(t, queue)
+
+	clock.Advance(time.Hour)
+	if _, err := queue.AddWithOptions([]byte("during the bug"), WithTags("b"), WithPriority(3), WithType("email.send")); err != nil {
+		t.Fatalf("failed to add item to queue: %v", err)
+	}
+	processNext(t, queue)
+
+	clock.Advance(time.Hour)
+	if err := queue.Add([]byte("after the bug")); err != nil {
+		t.Fatalf("failed to add item to queue: %v", err)
+	}
+	processNext(t, queue)
+
+	n, err := queue.Replay(context.Background(), start.Add(30*time.Minute), start.Add(90*time.Minute), target)
+	if err != nil || n != 1 {
+		t.Fatalf("expected 1 item replayed, got %d, %v", n, err)
+	}
+	items, err := target.Get(10)
+	if err != nil || len(items) != 1 {
+		t.Fatalf("expected the replayed item in the target, got %+v, %v", items, err)
+	}
+	item := items[0]
+	if string(item.Data) != "during the bug" || len(item.Tags) != 1 || item.Tags[0] != "b" || item.Priority != 3 || item.Type != "email.send" {
+		t.Fatalf("expected the item as it was processed, got %+v", item)
+	}
+
+	// Without a target, the items are added to the queue itself.
+	if n, err := queue.Replay(context.Background(), start, start.Add(3*time.Hour), nil); err != nil || n != 3 {
+		t.Fatalf("expected 3 items replayed, got %d, %v", n, err)
+	}
+	if stats, err := queue.Stats(); err != nil || stats.Pending != 3 {
+		t.Fatalf("expected 3 pending items, got %+v, %v", stats, err)
+	}
+}
+
+func TestHistoryRetention(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(start)
+	queue := setupQueue(t, Config{History: true, HistoryRetention: 90 * time.Minute, HistoryMaxItems: 2, Clock: clock, ManualStart: true})
+	defer queue.Close()
+
+	for i := 0; i < 4; i++ {
+		if err := queue.Add([]byte("test data")); err != nil {
+			t.Fatalf("failed to add item to queue: %v", err)
+		}
+		processNext(t, queue)
+		clock.Advance(time.Hour)
+	}
+
+	var kept int
+	if err := queue.db.QueryRow("SELECT COUNT(*) FROM " + queue.tables.history).Scan(&kept); err != nil {
+		t.Fatalf("failed to count the history: %v", err)
+	}
+	if kept != 2 {
+		t.Fatalf("expected 2 items kept by HistoryMaxItems, got %d", kept)
+	}
+
+	// The previous item was processed 2 hours before the next one.
+	clock.Advance(time.Hour)
+	if err := queue.Add([]byte("test data")); err != nil {
+		t.Fatalf("failed to add item to queue: %v", err)
+	}
+	processNext(t, queue)
+	if err := queue.db.QueryRow("SELECT COUNT(*) FROM " + queue.tables.history).Scan(&kept); err != nil {
+		t.Fatalf("failed to count the history: %v", err)
+	}
+	if kept != 1 {
+		t.Fatalf("expected items older than HistoryRetention to be dropped, got %d", kept)
+	}
+}
+
+func TestEraseHistory(t *testing.T) {
+	queue := setupQueue(t, Config{History: true, ManualStart: true})
+	defer queue.Close()
+
+	if err := queue.AddTagged([]byte("personal data"), SubjectTag("user-42")); err != nil {
+		t.Fatalf("failed to add item to queue: %v", err)
+	}
+	processNext(t, queue)
+
+	report, err := queue.Admin().Erase("user-42", EraseDelete)
+	if err != nil || report.History != 1 {
+		t.Fatalf("expected the history entry to be erased, got %+v, %v", report, err)
+	}
+	if n, err := queue.Replay(context.Background(), time.Unix(0, 0), time.Now().Add(time.Hour), nil); err != nil || n != 0 {
+		t.Fatalf("expected nothing left to replay, got %d, %v", n, err)
+	}
+}
+
+func TestReplayAfterKeyRotation(t *testing.T) {
+	keyring, err := NewKeyring("k1", bytes.Repeat([]byte{1}, 32))
+	if err != nil {
+		t.Fatalf("failed to create keyring: %v", err)
+	}
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(start)
+	queue := setupQueue(t, Config{History: true, Keyring: keyring, Clock: clock, ManualStart: true})
+	defer queue.Close()
+
+	if err := queue.Add([]byte("sealed under k1")); err != nil {
+		t.Fatalf("failed to add item to queue: %v", err)
+	}
+	processNext(t, queue)
+
+	if err := queue.RotateKey(context.Background(), "k2", bytes.Repeat([]byte{2}, 32)); err != nil {
+		t.Fatalf("failed to rotate key: %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		pending, err := queue.KeyRotationPending()
+		if err != nil {
+			t.Fatalf("failed to count pending payloads: %v", err)
+		}
+		if pending == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the history to be re-encrypted, %d left", pending)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Without k1, the history is still readable.
+	delete(keyring.keys, "k1")
+	if n, err := queue.Replay(context.Background(), start, start.Add(time.Hour), nil); err != nil || n != 1 {
+		t.Fatalf("expected 1 item replayed, got %d, %v", n, err)
+	}
+	items, err := queue.Get(10)
+	if err != nil || len(items) != 1 || string(items[0].Data) != "sealed under k1" {
+		t.Fatalf("expected the replayed payload, got %+v, %v", items, err)
+	}
+}
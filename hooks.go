@@ -0,0 +1,54 @@
+package queue
+
+import "time"
+
+// Hooks are callbacks fired as items move through the queue, so applications
+// can react to state changes, e.g. scale workers or alert when the queue
+// drains, without polling Stats. Any of them may be nil. They run
+// synchronously on the goroutine causing the event, outside the queue lock,
+// so they may call queue methods but should return quickly.
+type Hooks struct {
+	// OnEnqueued is called after Add, AddTagged, AddWait or a cron job
+	// committed an item. Items added through AddTx or Import do not trigger it.
+	OnEnqueued func(item Item)
+
+	// OnEmpty is called when the listener loop finds nothing left to deliver
+	// after delivering at least one item.
+	OnEmpty func()
+
+	// OnFailure is called when a listener asks for an item to be retried
+	// after the given delay.
+	OnFailure func(item Item, delay time.Duration)
+
+	// OnDeadLetter is called when an item used up its attempts and moved to
+	// the dead letters.
+	OnDeadLetter func(item Item)
+}
+
+// enqueued fires Hooks.OnEnqueued.
+func (h Hooks) enqueued(item Item) {
+	if h.OnEnqueued != nil {
+		h.OnEnqueued(item)
+	}
+}
+
+// empty fires Hooks.OnEmpty.
+func (h Hooks) empty() {
+	if h.OnEmpty != nil {
+		h.OnEmpty()
+	}
+}
+
+// failure fires Hooks.OnFailure.
+func (h Hooks) failure(item Item, delay time.Duration) {
+	if h.OnFailure != nil {
+		h.OnFailure(item, delay)
+	}
+}
+
+// deadLetter fires Hooks.OnDeadLetter.
+func (h Hooks) deadLetter(item Item) {
+	if h.OnDeadLetter != nil {
+		h.OnDeadLetter(item)
+	}
+}
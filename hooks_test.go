@@ -0,0 +1,42 @@
+package queue
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHooks(t *testing.T) {
+	events := make(chan string, 10)
+	queue := setupQueue(t, Config{
+		MaxAttempts: 2,
+		Hooks: Hooks{
+			OnEnqueued:   func(item Item) { events <- "enqueued " + string(item.Data) },
+			OnEmpty:      func() { events <- "empty" },
+			OnFailure:    func(item Item, delay time.Duration) { events <- "failure" },
+			OnDeadLetter: func(item Item) { events <- "dead " + string(item.State) },
+		},
+	})
+	defer queue.Close()
+
+	if err := queue.Add([]byte("test data")); err != nil {
+		t.Fatalf("failed to add item to queue: %v", err)
+	}
+
+	// Every delivery asks for a retry, so the item uses up its attempts. While
+	// the item waits for its retry, there is nothing to deliver.
+	queue.Listener(func(item Item, delay func(sec time.Duration)) {
+		delay(50 * time.Millisecond)
+	})
+
+	expected := []string{"enqueued test data", "failure", "empty", "failure", "empty", "dead dead"}
+	for _, want := range expected {
+		select {
+		case got := <-events:
+			if got != want {
+				t.Fatalf("expected %q, got %q", want, got)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for %q", want)
+		}
+	}
+}
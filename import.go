@@ -0,0 +1,208 @@
+package queue
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// importBatchSize is the number of records inserted per transaction by Import.
+const importBatchSize = 500
+
+// Import bulk-loads items from a dump written by Export in the given format and
+// returns the number of items added. Items receive new IDs and are added as
+// pending in the order they appear, keeping their priority, tags, tenant,
+// job type, headers, dedup key, visibility and deadline. Records are checked
+// like Adds: they are validated, a record whose dedup key is already queued
+// is skipped, and the overflow policy applies. Records are inserted in
+// transactions of importBatchSize, so on error the batches committed before
+// it stay imported.
+func (c *Queue) Import(ctx context.Context, r io.Reader, format Format) (int, error) {
+	next, err := newRecordDecoder(r, format)
+	if err != nil {
+		return 0, err
+	}
+
+	imported := 0
+	for done := false; !done; {
+		var batch []Record
+		for len(batch) < importBatchSize {
+			record, err := next()
+			if errors.Is(err, io.EOF) {
+				done = true
+				break
+			}
+			if err != nil {
+				return imported, err
+			}
+			batch = append(batch, record)
+		}
+
+		n, err := c.importBatch(ctx, batch)
+		imported += n
+		if err != nil {
+			return imported, err
+		}
+	}
+	return imported, nil
+}
+
+// importBatch inserts the records in a single transaction and returns how
+// many were added. Every record goes through insertItem like an Add, so it is
+// validated, deduplicated by its key and subject to the overflow policy.
+func (c *Queue) importBatch(ctx context.Context, batch []Record) (int, error) {
+	if len(batch) == 0 {
+		return 0, nil
+	}
+
+	c.mx.Lock() // Lock for exclusive access to the queue.
+	defer c.mx.Unlock()
+
+	added := 0
+	err := c.withTx(func(tx *sql.Tx) error {
+		for _, record := range batch {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			tags, err := encodeTags(record.Tags)
+			if err != nil {
+				return err
+			}
+
+			_, err = c.insertItem(tx, record.Data, tags, record.addOptions(), c.cfg.Overflow)
+			switch {
+			case errors.Is(err, errDropped), errors.Is(err, errDuplicate):
+				continue // The overflow policy discarded the record, or it is already queued.
+			case err != nil:
+				return err
+			}
+			added++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return added, nil
+}
+
+// addOptions returns the options adding the record as a pending item with
+// its metadata.
+func (r Record) addOptions() addOptions {
+	opts := addOptions{priority: r.Priority, tenant: r.Tenant, headers: r.Headers, dedupKey: r.DedupKey, jobType: r.Type}
+	if r.VisibleAt != nil {
+		opts.visibleAt = r.VisibleAt.UnixNano()
+	}
+	if r.Deadline != nil {
+		opts.expiresAt = r.Deadline.UnixNano()
+	}
+	return opts
+}
+
+// newRecordDecoder returns a function reading the next record from r in the
+// given format. It returns io.EOF once all records have been read.
+func newRecordDecoder(r io.Reader, format Format) (func() (Record, error), error) {
+	switch format {
+	case FormatJSONLines:
+		decoder := json.NewDecoder(r)
+		return func() (Record, error) {
+			var record Record
+			err := decoder.Decode(&record)
+			return record, err
+		}, nil
+	case FormatCSV:
+		reader := csv.NewReader(r)
+		header, err := reader.Read()
+		if err != nil {
+			return nil, err
+		}
+
+		// Locate the columns by name so their order does not matter.
+		columns := make(map[string]int, len(header))
+		for i, name := range header {
+			columns[name] = i
+		}
+		if _, ok := columns["data"]; !ok {
+			return nil, fmt.Errorf("queue: CSV header lacks a data column")
+		}
+
+		return func() (Record, error) {
+			row, err := reader.Read()
+			if err != nil {
+				return Record{}, err
+			}
+			return decodeCSVRecord(row, columns)
+		}, nil
+	default:
+		return nil, fmt.Errorf("queue: unknown format %q", format)
+	}
+}
+
+// decodeCSVRecord converts a CSV row into a record using the column positions from the header.
+func decodeCSVRecord(row []string, columns map[string]int) (Record, error) {
+	field := func(name string) string {
+		if i, ok := columns[name]; ok && i < len(row) {
+			return row[i]
+		}
+		return ""
+	}
+
+	var record Record
+	var err error
+
+	if id := field("id"); id != "" {
+		if record.ID, err = strconv.Atoi(id); err != nil {
+			return Record{}, err
+		}
+	}
+	record.State = State(field("state"))
+	record.Tenant = field("tenant")
+	record.Type = field("type")
+	record.DedupKey = field("dedup_key")
+	if priority := field("priority"); priority != "" {
+		if record.Priority, err = strconv.Atoi(priority); err != nil {
+			return Record{}, err
+		}
+	}
+	if attempts := field("attempts"); attempts != "" {
+		if record.Attempts, err = strconv.Atoi(attempts); err != nil {
+			return Record{}, err
+		}
+	}
+
+	if record.Tags, err = decodeTags(field("tags")); err != nil {
+		return Record{}, err
+	}
+	if record.Headers, err = decodeHeaders(field("headers")); err != nil {
+		return Record{}, err
+	}
+	if record.VisibleAt, err = parseCSVTime(field("visible_at")); err != nil {
+		return Record{}, err
+	}
+	if record.Deadline, err = parseCSVTime(field("deadline")); err != nil {
+		return Record{}, err
+	}
+	if record.Data, err = base64.StdEncoding.DecodeString(field("data")); err != nil {
+		return Record{}, err
+	}
+	return record, nil
+}
+
+// parseCSVTime parses an optional time written by formatCSVTime.
+func parseCSVTime(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
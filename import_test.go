@@ -0,0 +1,110 @@
+package queue
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestImportRoundTrip(t *testing.T) {
+	for _, format := range []Format{FormatJSONLines, FormatCSV} {
+		source := setupQueue(t, Config{})
+
+		if err := source.AddTagged([]byte("first"), "email", "urgent"); err != nil {
+			t.Fatalf("failed to add item to queue: %v", err)
+		}
+		if err := source.Add([]byte("second")); err != nil {
+			t.Fatalf("failed to add item to queue: %v", err)
+		}
+
+		var dump bytes.Buffer
+		if err := source.Export(context.Background(), &dump, format); err != nil {
+			t.Fatalf("failed to export queue: %v", err)
+		}
+		source.Close()
+
+		target := setupQueue(t, Config{})
+
+		imported, err := target.Import(context.Background(), &dump, format)
+		if err != nil {
+			t.Fatalf("failed to import %s dump: %v", format, err)
+		}
+		if imported != 2 {
+			t.Fatalf("expected 2 imported items, got %d", imported)
+		}
+
+		items, err := target.Get(10)
+		if err != nil {
+			t.Fatalf("failed to get items from queue: %v", err)
+		}
+		if len(items) != 2 || string(items[0].Data) != "first" || len(items[0].Tags) != 2 || string(items[1].Data) != "second" {
+			t.Fatalf("unexpected items after %s import: %+v", format, items)
+		}
+		target.Close()
+	}
+}
+
+func TestImportMetadata(t *testing.T) {
+	for _, format := range []Format{FormatJSONLines, FormatCSV} {
+		clock := NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+		source := setupQueue(t, Config{Clock: clock})
+
+		deadline := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+		_, err := source.AddContext(
+			context.Background(), []byte("first"),
+			WithTenant("acme"), WithType("email"), WithHeaders(map[string]string{"trace": "abc"}),
+			WithDedupKey("order-1"), WithDelay(time.Hour), WithDeadline(deadline),
+		)
+		if err != nil {
+			t.Fatalf("failed to add item to queue: %v", err)
+		}
+		var dump bytes.Buffer
+		if err := source.Export(context.Background(), &dump, format); err != nil {
+			t.Fatalf("failed to export queue: %v", err)
+		}
+		source.Close()
+
+		target := setupQueue(t, Config{Clock: clock})
+		if imported, err := target.Import(context.Background(), bytes.NewReader(dump.Bytes()), format); err != nil || imported != 1 {
+			t.Fatalf("expected 1 imported item from the %s dump, got %d, %v", format, imported, err)
+		}
+		items, err := target.Get(10)
+		if err != nil || len(items) != 1 {
+			t.Fatalf("failed to get items from queue: %+v, %v", items, err)
+		}
+		item := items[0]
+		if item.Tenant != "acme" || item.Type != "email" || item.Headers["trace"] != "abc" || !item.Deadline.Equal(deadline) {
+			t.Fatalf("expected the metadata to survive the %s import, got %+v", format, item)
+		}
+		if claimed, err := target.Claim(1); err != nil || len(claimed) != 0 {
+			t.Fatalf("expected the delayed item to stay hidden, got %+v, %v", claimed, err)
+		}
+
+		// The dedup key is still queued, so importing the dump again adds nothing.
+		if imported, err := target.Import(context.Background(), bytes.NewReader(dump.Bytes()), format); err != nil || imported != 0 {
+			t.Fatalf("expected the duplicate to be skipped, got %d, %v", imported, err)
+		}
+		target.Close()
+	}
+}
+
+func TestImportValidates(t *testing.T) {
+	queue := setupQueue(t, Config{Validator: ValidatorFunc(func(data []byte) error {
+		if string(data) == "bad" {
+			return errors.New("rejected")
+		}
+		return nil
+	})})
+	defer queue.Close()
+
+	dump := `{"id":1,"state":"pending","data":"Z29vZA=="}` + "\n" + `{"id":2,"state":"pending","data":"YmFk"}` + "\n"
+	if _, err := queue.Import(context.Background(), strings.NewReader(dump), FormatJSONLines); !errors.Is(err, ErrInvalidPayload) {
+		t.Fatalf("expected the invalid record to be rejected, got %v", err)
+	}
+	if stats, err := queue.Stats(); err != nil || stats.Pending != 0 {
+		t.Fatalf("expected the batch to be rolled back, got %+v, %v", stats, err)
+	}
+}
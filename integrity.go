@@ -0,0 +1,354 @@
+package queue
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// IntegrityCheck selects the check run on the database when it is opened.
+type IntegrityCheck int
+
+const (
+	IntegrityCheckOff   IntegrityCheck = iota // Open the database without checking it.
+	IntegrityCheckQuick                       // PRAGMA quick_check: verifies the pages, but not the index contents.
+	IntegrityCheckFull                        // PRAGMA integrity_check: also verifies that the indexes match their tables.
+)
+
+// ErrDatabaseCorrupt is matched by errors.Is for an *IntegrityError.
+var ErrDatabaseCorrupt = errors.New("queue: database corrupt")
+
+// IntegrityError is returned when the database fails the check selected by
+// Config.IntegrityCheck and could not be salvaged.
+type IntegrityError struct {
+	Problems []string // Problems reported by SQLite.
+}
+
+func (e *IntegrityError) Error() string {
+	return fmt.Sprintf("queue: database failed the integrity check: %s", strings.Join(e.Problems, "; "))
+}
+
+// Is reports whether target is ErrDatabaseCorrupt.
+func (e *IntegrityError) Is(target error) bool {
+	return target == ErrDatabaseCorrupt
+}
+
+// RecoveryReport describes a database salvaged on open; see Config.Salvage.
+type RecoveryReport struct {
+	Problems []string        // Problems found by the integrity check.
+	Damaged  string          // Path the damaged file was moved to.
+	Tables   []TableRecovery // What was recovered from every table.
+}
+
+// TableRecovery describes what was recovered from a table.
+type TableRecovery struct {
+	Table     string     // Name of the table.
+	Recovered int        // Rows copied to the fresh file.
+	Lost      []RowRange // Row IDs that could not be read; rows may or may not have existed there.
+	Errors    []string   // Read errors that caused the gaps.
+}
+
+// RowRange is an inclusive range of row IDs, e.g. item IDs.
+type RowRange struct {
+	From, To int64
+}
+
+// openChecked opens the database and runs the check selected by
+// Config.IntegrityCheck. A damaged file is salvaged if Config.Salvage is set,
+// in which case a report of the recovery is returned along with the database.
+func openChecked(cfg Config) (*sql.DB, *RecoveryReport, error) {
+	db, err := open(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	problems := checkIntegrity(db, cfg.IntegrityCheck)
+	if len(problems) == 0 {
+		return db, nil, nil
+	}
+	failed := &IntegrityError{Problems: problems}
+	if !cfg.Salvage {
+		db.Close()
+		return nil, nil, failed
+	}
+
+	report, err := salvage(context.Background(), db, cfg.LocalFile)
+	db.Close()
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w; salvage failed: %v", failed, err)
+	}
+	report.Problems = problems
+
+	if err := replaceDamaged(cfg.LocalFile, report); err != nil {
+		return nil, nil, err
+	}
+	cfg.Logger.Println(fmt.Sprintf("Salvaged damaged database %s; the original was moved to %s", cfg.LocalFile, report.Damaged))
+
+	db, err = open(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	return db, report, nil
+}
+
+// checkIntegrity runs the selected integrity check and returns the problems
+// it found. A check that cannot complete counts as a problem.
+func checkIntegrity(db *sql.DB, check IntegrityCheck) []string {
+	var pragma string
+	switch check {
+	case IntegrityCheckQuick:
+		pragma = "PRAGMA quick_check"
+	case IntegrityCheckFull:
+		pragma = "PRAGMA integrity_check"
+	default:
+		return nil
+	}
+
+	rows, err := db.Query(pragma)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	defer rows.Close() // Ensure rows are closed after processing.
+
+	var problems []string
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err != nil {
+			return append(problems, err.Error())
+		}
+		if line != "ok" {
+			problems = append(problems, line)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		problems = append(problems, err.Error())
+	}
+	return problems
+}
+
+// salvagePath returns the path of the fresh file the rows of path are
+// recovered into.
+func salvagePath(path string) string {
+	return path + ".salvage"
+}
+
+// salvage copies the schema and every readable row of the damaged database
+// to a fresh file next to path.
+func salvage(ctx context.Context, src *sql.DB, path string) (*RecoveryReport, error) {
+	if path == "" || strings.HasPrefix(path, "file:") || strings.Contains(path, "?") {
+		return nil, fmt.Errorf("queue: salvage needs a plain file path, not %q", path)
+	}
+
+	fresh := salvagePath(path)
+	if err := os.Remove(fresh); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	dest, err := sql.Open("sqlite3", fresh)
+	if err != nil {
+		return nil, err
+	}
+	defer dest.Close()
+
+	// The schema is needed to recover anything; tables come first so the
+	// indexes and triggers are only built once the rows are in.
+	rows, err := src.QueryContext(ctx, "SELECT `type`, `name`, `sql` FROM sqlite_master WHERE `sql` IS NOT NULL AND `name` NOT LIKE 'sqlite_%' ORDER BY `type` != 'table'")
+	if err != nil {
+		return nil, fmt.Errorf("queue: reading the schema: %w", err)
+	}
+	type object struct{ kind, name, sql string }
+	var objects []object
+	for rows.Next() {
+		var o object
+		if err := rows.Scan(&o.kind, &o.name, &o.sql); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("queue: reading the schema: %w", err)
+		}
+		objects = append(objects, o)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("queue: reading the schema: %w", err)
+	}
+
+	report := &RecoveryReport{}
+	for _, o := range objects {
+		if o.kind != "table" {
+			continue
+		}
+		if _, err := dest.ExecContext(ctx, o.sql); err != nil {
+			return nil, err
+		}
+		recovered, err := salvageTable(ctx, src, dest, o.name)
+		if err != nil {
+			return nil, err
+		}
+		report.Tables = append(report.Tables, recovered)
+	}
+	for _, o := range objects {
+		if o.kind == "table" {
+			continue
+		}
+		if _, err := dest.ExecContext(ctx, o.sql); err != nil {
+			return nil, err
+		}
+	}
+	return report, nil
+}
+
+// salvageTable copies the readable rows of a table from src to dest in row ID
+// order, skipping over the row IDs it cannot read.
+func salvageTable(ctx context.Context, src, dest *sql.DB, table string) (TableRecovery, error) {
+	recovered := TableRecovery{Table: table}
+
+	// Both ends of the table are found without reading the pages in between.
+	var first, last sql.NullInt64
+	if err := src.QueryRowContext(ctx, "SELECT MIN(rowid), MAX(rowid) FROM "+quoteName(table)).Scan(&first, &last); err != nil {
+		recovered.Errors = append(recovered.Errors, err.Error())
+		return recovered, nil // Without the row ID range there is no telling where to look.
+	}
+	if !last.Valid {
+		return recovered, nil // The table is empty.
+	}
+
+	next := first.Int64
+	for {
+		copied, lastCopied, readErr, err := copyRows(ctx, src, dest, table, next)
+		recovered.Recovered += copied
+		if err != nil || readErr == nil {
+			return recovered, err
+		}
+		recovered.Errors = append(recovered.Errors, readErr.Error())
+
+		bad := next
+		if copied > 0 {
+			bad = lastCopied + 1
+		}
+		resume, ok := nextReadable(ctx, src, table, bad, last.Int64)
+		if !ok {
+			recovered.Lost = append(recovered.Lost, RowRange{From: bad, To: last.Int64})
+			return recovered, nil
+		}
+		recovered.Lost = append(recovered.Lost, RowRange{From: bad, To: resume - 1})
+		next = resume
+	}
+}
+
+// copyRows copies the rows of a table with a row ID of at least 'from' until
+// the end of the table or the first read error, which it returns separately
+// from write errors. It also returns the row ID of the last copied row.
+func copyRows(ctx context.Context, src, dest *sql.DB, table string, from int64) (int, int64, error, error) {
+	rows, err := src.QueryContext(ctx, "SELECT rowid, * FROM "+quoteName(table)+" WHERE rowid >= ? ORDER BY rowid", from)
+	if err != nil {
+		return 0, 0, err, nil
+	}
+	defer rows.Close() // Ensure rows are closed after processing.
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return 0, 0, err, nil
+	}
+	names := make([]string, len(columns)-1)
+	for i, name := range columns[1:] {
+		names[i] = quoteName(name)
+	}
+	insert, err := dest.PrepareContext(
+		ctx,
+		"INSERT INTO "+quoteName(table)+"("+strings.Join(names, ", ")+") VALUES (?"+strings.Repeat(", ?", len(names)-1)+")",
+	)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	defer insert.Close()
+
+	copied := 0
+	var rowid int64
+	values := make([]any, len(columns))
+	pointers := make([]any, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(pointers...); err != nil {
+			return copied, rowid, err, nil
+		}
+		if _, err := insert.ExecContext(ctx, values[1:]...); err != nil {
+			return copied, rowid, nil, err
+		}
+		rowid = values[0].(int64)
+		copied++
+	}
+	return copied, rowid, rows.Err(), nil
+}
+
+// nextReadable returns the lowest row ID above 'bad' from which the table can
+// be read again, probing with growing steps and then narrowing down on the
+// first readable probe.
+func nextReadable(ctx context.Context, src *sql.DB, table string, bad, last int64) (int64, bool) {
+	readable := func(from int64) (int64, bool) {
+		var rowid int64
+		row := src.QueryRowContext(ctx, "SELECT rowid FROM "+quoteName(table)+" WHERE rowid >= ? ORDER BY rowid LIMIT 1", from)
+		if err := row.Scan(&rowid); err != nil {
+			return 0, false
+		}
+		return rowid, true
+	}
+
+	lo := bad
+	for step := int64(1); step <= last-bad; step *= 2 {
+		hi := bad + step
+		found, ok := readable(hi)
+		if !ok {
+			lo = hi
+			continue
+		}
+
+		// Narrow down between the last unreadable and the first readable probe.
+		for lo+1 < hi {
+			mid := lo + (hi-lo)/2
+			if rowid, ok := readable(mid); ok {
+				hi, found = mid, rowid
+			} else {
+				lo = mid
+			}
+		}
+		return found, true
+	}
+	return 0, false
+}
+
+// replaceDamaged moves the damaged file aside and the salvaged one in its place.
+func replaceDamaged(path string, report *RecoveryReport) error {
+	report.Damaged = fmt.Sprintf("%s.corrupt-%d", path, time.Now().Unix())
+	if err := os.Rename(path, report.Damaged); err != nil {
+		return err
+	}
+
+	// Keep the journals with the damaged file; they belong to it.
+	for _, suffix := range []string{"-wal", "-shm", "-journal"} {
+		if err := os.Rename(path+suffix, report.Damaged+suffix); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return os.Rename(salvagePath(path), path)
+}
+
+// quoteName quotes an identifier for use in SQL statements.
+func quoteName(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// Recovery returns the report of the salvage New performed because the
+// database failed its integrity check, or nil if it was not salvaged.
+func (c *Queue) Recovery() *RecoveryReport {
+	return c.recovery
+}
+
+// Recovery returns the report of the salvage NewManager performed because the
+// database failed its integrity check, or nil if it was not salvaged.
+func (m *Manager) Recovery() *RecoveryReport {
+	return m.recovery
+}
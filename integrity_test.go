@@ -0,0 +1,91 @@
+package queue
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// corruptedDatabase writes a queue file with 'n' items and overwrites one of
+// the pages holding them with garbage.
+func corruptedDatabase(t *testing.T, n int) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "queue.db")
+
+	queue := setupQueue(t, Config{LocalFile: path})
+	for i := 0; i < n; i++ {
+		if err := queue.Add([]byte(fmt.Sprintf("%04d%s", i, bytes.Repeat([]byte("x"), 500)))); err != nil {
+			t.Fatalf("failed to add item to queue: %v", err)
+		}
+	}
+	queue.Close()
+
+	// Wipe the page holding the item in the middle.
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read database file: %v", err)
+	}
+	offset := bytes.Index(data, []byte(fmt.Sprintf("%04dxxx", n/2)))
+	if offset < 0 {
+		t.Fatalf("item %d not found in the database file", n/2)
+	}
+	page := offset / 4096 * 4096
+	copy(data[page:page+4096], bytes.Repeat([]byte{0xff}, 4096))
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatalf("failed to corrupt database file: %v", err)
+	}
+	return path
+}
+
+func TestIntegrityCheckOnOpen(t *testing.T) {
+	path := corruptedDatabase(t, 200)
+
+	_, err := New(Config{LocalFile: path, IntegrityCheck: IntegrityCheckQuick})
+	var integrity *IntegrityError
+	if !errors.Is(err, ErrDatabaseCorrupt) || !errors.As(err, &integrity) || len(integrity.Problems) == 0 {
+		t.Fatalf("expected an *IntegrityError, got %v", err)
+	}
+}
+
+func TestSalvageOnOpen(t *testing.T) {
+	path := corruptedDatabase(t, 200)
+
+	queue := setupQueue(t, Config{LocalFile: path, IntegrityCheck: IntegrityCheckFull, Salvage: true})
+	defer queue.Close()
+
+	report := queue.Recovery()
+	if report == nil || len(report.Problems) == 0 {
+		t.Fatalf("expected a recovery report, got %+v", report)
+	}
+	if _, err := os.Stat(report.Damaged); err != nil {
+		t.Fatalf("expected the damaged file to be kept: %v", err)
+	}
+
+	var items TableRecovery
+	for _, table := range report.Tables {
+		if table.Table == queue.tables.items {
+			items = table
+		}
+	}
+	if items.Recovered == 0 || items.Recovered >= 200 || len(items.Lost) == 0 {
+		t.Fatalf("expected part of the items to be recovered, got %+v", items)
+	}
+
+	lost := 0
+	for _, r := range items.Lost {
+		lost += int(r.To - r.From + 1)
+	}
+	stats, err := queue.Stats()
+	if err != nil || stats.Pending != items.Recovered || items.Recovered+lost != 200 {
+		t.Fatalf("expected %d recovered and %d lost items to add up, got %+v, %v", items.Recovered, lost, stats, err)
+	}
+	if problems := checkIntegrity(queue.db, IntegrityCheckFull); len(problems) != 0 {
+		t.Fatalf("expected the salvaged database to be intact, got %v", problems)
+	}
+	if err := queue.Add([]byte("after salvage")); err != nil {
+		t.Fatalf("failed to add item to salvaged queue: %v", err)
+	}
+}
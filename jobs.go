@@ -0,0 +1,76 @@
+package queue
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// JobHandler processes the items of a job type registered with Handle.
+// Returning an error retries the item as Retry does, unless the error wraps
+// ErrSkipRetry. ctx is Item.Context.
+type JobHandler func(ctx context.Context, item Item) error
+
+// addJobTypeColumn adds the column holding the job type of an item.
+func addJobTypeColumn(tx *sql.Tx, t tables) error {
+	return addColumn(tx, t.items, "job_type", "TEXT")
+}
+
+// WithType sets the job type of the item, which selects the handler
+// registered for it with Handle.
+func WithType(jobType string) AddOption {
+	return func(o *addOptions) { o.jobType = jobType }
+}
+
+// Enqueue adds a job of the given type with payload encoded as JSON, for the
+// handler registered with Handle, and returns its ID. It is AddContext with
+// WithType, so the other options apply as well.
+func (c *Queue) Enqueue(ctx context.Context, jobType string, payload any, opts ...AddOption) (int, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return 0, fmt.Errorf("queue: encoding %s payload: %w", jobType, err)
+	}
+	return c.AddContext(ctx, data, append(opts, WithType(jobType))...)
+}
+
+// Handle registers the handler of a job type, replacing any handler
+// registered for it before. Items of the type go to it before the tag
+// listeners and the catch-all Listener are consulted; items of types without
+// a handler go to those, or stay in the queue until a handler is registered.
+//
+//	q.Handle("email.send", queue.Decode(func(ctx context.Context, email Email) error {
+//		return mailer.Send(ctx, email)
+//	}))
+func (c *Queue) Handle(jobType string, h JobHandler) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	if c.handlers == nil {
+		c.handlers = make(map[string]Handler)
+	}
+	c.handlers[jobType] = func(item Item, delay func(sec time.Duration)) {
+		if err := h(item.Context(), item); err != nil {
+			c.record(item.ID, func(done *completion) {
+				done.retry = err
+				done.skipRetry = errors.Is(err, ErrSkipRetry)
+			})
+		}
+	}
+	c.signalRegistered()
+}
+
+// Decode returns a JobHandler decoding the JSON payload of an item into a T
+// before calling fn. An item whose payload does not decode is moved to the
+// dead letters without being retried.
+func Decode[T any](fn func(ctx context.Context, payload T) error) JobHandler {
+	return func(ctx context.Context, item Item) error {
+		var payload T
+		if err := json.Unmarshal(item.Data, &payload); err != nil {
+			return fmt.Errorf("queue: decoding %s payload: %w: %w", item.Type, ErrSkipRetry, err)
+		}
+		return fn(ctx, payload)
+	}
+}
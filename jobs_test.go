@@ -0,0 +1,80 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+type email struct {
+	To      string `json:"to"`
+	Subject string `json:"subject"`
+}
+
+func TestHandle(t *testing.T) {
+	queue := setupQueue(t, Config{RetryPolicy: ExponentialBackoff{Initial: time.Millisecond}})
+	defer queue.Close()
+
+	sent := make(chan email, 2)
+	attempts := 0
+	queue.Handle("email.send", Decode(func(ctx context.Context, e email) error {
+		attempts++
+		if attempts == 1 {
+			return errors.New("smtp unavailable")
+		}
+		sent <- e
+		return nil
+	}))
+	other := make(chan Item, 1)
+	queue.Listener(func(item Item, delay func(sec time.Duration)) {
+		other <- item
+	})
+
+	if _, err := queue.Enqueue(context.Background(), "email.send", email{To: "a@example.com", Subject: "hi"}); err != nil {
+		t.Fatalf("failed to enqueue job: %v", err)
+	}
+	if err := queue.Add([]byte("untyped")); err != nil {
+		t.Fatalf("failed to add item to queue: %v", err)
+	}
+
+	select {
+	case e := <-sent:
+		if e.To != "a@example.com" || e.Subject != "hi" || attempts != 2 {
+			t.Fatalf("expected the decoded job after a retry, got %+v after %d attempts", e, attempts)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected the job to be handled")
+	}
+	select {
+	case item := <-other:
+		if string(item.Data) != "untyped" || item.Type != "" {
+			t.Fatalf("expected the untyped item to go to the listener, got %+v", item)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected the untyped item to be delivered")
+	}
+}
+
+func TestHandleSkipRetry(t *testing.T) {
+	dead := make(chan Item, 1)
+	queue := setupQueue(t, Config{Hooks: Hooks{OnDeadLetter: func(item Item) { dead <- item }}})
+	defer queue.Close()
+
+	queue.Handle("email.send", Decode(func(ctx context.Context, e email) error {
+		t.Errorf("expected the malformed payload not to reach the handler, got %+v", e)
+		return nil
+	}))
+	if _, err := queue.AddWithOptions([]byte("not json"), WithType("email.send")); err != nil {
+		t.Fatalf("failed to add item to queue: %v", err)
+	}
+
+	select {
+	case item := <-dead:
+		if item.Attempts != 1 || item.Type != "email.send" {
+			t.Fatalf("expected the item to be dead-lettered after its first attempt, got %+v", item)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected the malformed job to be dead-lettered")
+	}
+}
@@ -0,0 +1,430 @@
+package queue
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// annotations lists the schema keywords that do not constrain values and
+// are ignored by JSONSchema.
+var annotations = []string{
+	"$schema", "$id", "$comment", "$defs", "definitions", "title", "description", "default",
+	"examples", "format", "readOnly", "writeOnly", "deprecated", "contentMediaType", "contentEncoding",
+}
+
+// jsonTypes lists the values of the type keyword.
+var jsonTypes = []string{"null", "boolean", "object", "array", "number", "integer", "string"}
+
+// schema is a compiled JSON Schema. Unset constraints are nil.
+type schema struct {
+	always *bool // Result of the boolean schemas true and false.
+
+	types    []string
+	enum     []any
+	constant []any // Holds the value of const, if set.
+
+	properties    map[string]*schema
+	required      []string
+	additional    *schema // Schema of the properties not in properties; nil allows any.
+	minProperties *int
+	maxProperties *int
+
+	items       *schema
+	minItems    *int
+	maxItems    *int
+	uniqueItems bool
+
+	minimum          *float64
+	maximum          *float64
+	exclusiveMinimum *float64
+	exclusiveMaximum *float64
+	multipleOf       *float64
+
+	minLength *int
+	maxLength *int
+	pattern   *regexp.Regexp
+
+	allOf []*schema
+	anyOf []*schema
+	oneOf []*schema
+	not   *schema
+}
+
+// JSONSchema compiles a JSON Schema into a Validator accepting the payloads
+// that are JSON documents matching it, for Config.Validator. It supports the
+// keywords most payload schemas need: type, enum, const, properties,
+// required, additionalProperties, minProperties, maxProperties, items,
+// minItems, maxItems, uniqueItems, minimum, maximum, exclusiveMinimum,
+// exclusiveMaximum, multipleOf, minLength, maxLength, pattern, allOf, anyOf,
+// oneOf and not. Annotations such as title, description and format are
+// ignored. Schemas using other keywords, such as $ref, are rejected, so a
+// compiled schema never accepts more than it says.
+func JSONSchema(definition []byte) (Validator, error) {
+	var v any
+	if err := json.Unmarshal(definition, &v); err != nil {
+		return nil, fmt.Errorf("queue: invalid schema: %w", err)
+	}
+	s, err := compileSchema(v, "")
+	if err != nil {
+		return nil, err
+	}
+	return ValidatorFunc(func(data []byte) error {
+		var value any
+		if err := json.Unmarshal(data, &value); err != nil {
+			return &ValidationError{Err: fmt.Errorf("not a JSON document: %w", err)}
+		}
+		return s.validate(value, "")
+	}), nil
+}
+
+// compileSchema compiles the schema found at the JSON Pointer 'at' of the
+// definition.
+func compileSchema(v any, at string) (*schema, error) {
+	invalid := func(keyword, reason string) error {
+		return fmt.Errorf("queue: invalid schema at %s/%s: %s", at, keyword, reason)
+	}
+
+	if b, ok := v.(bool); ok {
+		return &schema{always: &b}, nil
+	}
+	obj, ok := v.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("queue: invalid schema at %s: must be an object or a boolean", at)
+	}
+
+	s := &schema{}
+	var err error
+	for keyword, value := range obj {
+		switch keyword {
+		case "type":
+			switch t := value.(type) {
+			case string:
+				s.types = []string{t}
+			case []any:
+				for _, e := range t {
+					name, ok := e.(string)
+					if !ok {
+						return nil, invalid(keyword, "must be a string or an array of strings")
+					}
+					s.types = append(s.types, name)
+				}
+			default:
+				return nil, invalid(keyword, "must be a string or an array of strings")
+			}
+			for _, t := range s.types {
+				if !slices.Contains(jsonTypes, t) {
+					return nil, invalid(keyword, fmt.Sprintf("unknown type %q", t))
+				}
+			}
+		case "enum":
+			values, ok := value.([]any)
+			if !ok {
+				return nil, invalid(keyword, "must be an array")
+			}
+			s.enum = values
+		case "const":
+			s.constant = []any{value}
+		case "properties":
+			props, ok := value.(map[string]any)
+			if !ok {
+				return nil, invalid(keyword, "must be an object")
+			}
+			s.properties = make(map[string]*schema, len(props))
+			for name, prop := range props {
+				if s.properties[name], err = compileSchema(prop, at+"/properties/"+escapePointer(name)); err != nil {
+					return nil, err
+				}
+			}
+		case "required":
+			names, ok := value.([]any)
+			if !ok {
+				return nil, invalid(keyword, "must be an array of strings")
+			}
+			for _, e := range names {
+				name, ok := e.(string)
+				if !ok {
+					return nil, invalid(keyword, "must be an array of strings")
+				}
+				s.required = append(s.required, name)
+			}
+		case "additionalProperties":
+			if s.additional, err = compileSchema(value, at+"/"+keyword); err != nil {
+				return nil, err
+			}
+		case "items":
+			if s.items, err = compileSchema(value, at+"/"+keyword); err != nil {
+				return nil, err
+			}
+		case "uniqueItems":
+			unique, ok := value.(bool)
+			if !ok {
+				return nil, invalid(keyword, "must be a boolean")
+			}
+			s.uniqueItems = unique
+		case "minProperties", "maxProperties", "minItems", "maxItems", "minLength", "maxLength":
+			n, ok := value.(float64)
+			if !ok || n < 0 || n != math.Trunc(n) {
+				return nil, invalid(keyword, "must be a non-negative integer")
+			}
+			count := int(n)
+			switch keyword {
+			case "minProperties":
+				s.minProperties = &count
+			case "maxProperties":
+				s.maxProperties = &count
+			case "minItems":
+				s.minItems = &count
+			case "maxItems":
+				s.maxItems = &count
+			case "minLength":
+				s.minLength = &count
+			case "maxLength":
+				s.maxLength = &count
+			}
+		case "minimum", "maximum", "exclusiveMinimum", "exclusiveMaximum", "multipleOf":
+			n, ok := value.(float64)
+			if !ok {
+				return nil, invalid(keyword, "must be a number")
+			}
+			switch keyword {
+			case "minimum":
+				s.minimum = &n
+			case "maximum":
+				s.maximum = &n
+			case "exclusiveMinimum":
+				s.exclusiveMinimum = &n
+			case "exclusiveMaximum":
+				s.exclusiveMaximum = &n
+			case "multipleOf":
+				if n <= 0 {
+					return nil, invalid(keyword, "must be greater than 0")
+				}
+				s.multipleOf = &n
+			}
+		case "pattern":
+			expr, ok := value.(string)
+			if !ok {
+				return nil, invalid(keyword, "must be a string")
+			}
+			if s.pattern, err = regexp.Compile(expr); err != nil {
+				return nil, invalid(keyword, err.Error())
+			}
+		case "allOf", "anyOf", "oneOf":
+			list, ok := value.([]any)
+			if !ok || len(list) == 0 {
+				return nil, invalid(keyword, "must be a non-empty array")
+			}
+			compiled := make([]*schema, len(list))
+			for i, sub := range list {
+				if compiled[i], err = compileSchema(sub, at+"/"+keyword+"/"+strconv.Itoa(i)); err != nil {
+					return nil, err
+				}
+			}
+			switch keyword {
+			case "allOf":
+				s.allOf = compiled
+			case "anyOf":
+				s.anyOf = compiled
+			case "oneOf":
+				s.oneOf = compiled
+			}
+		case "not":
+			if s.not, err = compileSchema(value, at+"/"+keyword); err != nil {
+				return nil, err
+			}
+		default:
+			if !slices.Contains(annotations, keyword) {
+				return nil, invalid(keyword, "keyword not supported")
+			}
+		}
+	}
+	return s, nil
+}
+
+// validate checks a decoded JSON value found at the JSON Pointer 'at' of
+// the payload.
+func (s *schema) validate(v any, at string) error {
+	fail := func(format string, args ...any) error {
+		return &ValidationError{Path: at, Err: fmt.Errorf(format, args...)}
+	}
+
+	if s.always != nil {
+		if !*s.always {
+			return fail("no value is allowed")
+		}
+		return nil
+	}
+
+	if len(s.types) > 0 && !slices.ContainsFunc(s.types, func(t string) bool { return isType(v, t) }) {
+		return fail("must be of type %s", strings.Join(s.types, " or "))
+	}
+	if s.enum != nil && !slices.ContainsFunc(s.enum, func(e any) bool { return reflect.DeepEqual(e, v) }) {
+		return fail("must be one of the values of enum")
+	}
+	if s.constant != nil && !reflect.DeepEqual(s.constant[0], v) {
+		return fail("must be equal to const")
+	}
+
+	switch v := v.(type) {
+	case map[string]any:
+		if err := s.validateObject(v, at); err != nil {
+			return err
+		}
+	case []any:
+		if err := s.validateArray(v, at); err != nil {
+			return err
+		}
+	case float64:
+		switch {
+		case s.minimum != nil && v < *s.minimum:
+			return fail("must be at least %v", *s.minimum)
+		case s.maximum != nil && v > *s.maximum:
+			return fail("must be at most %v", *s.maximum)
+		case s.exclusiveMinimum != nil && v <= *s.exclusiveMinimum:
+			return fail("must be greater than %v", *s.exclusiveMinimum)
+		case s.exclusiveMaximum != nil && v >= *s.exclusiveMaximum:
+			return fail("must be less than %v", *s.exclusiveMaximum)
+		case s.multipleOf != nil && !isMultiple(v, *s.multipleOf):
+			return fail("must be a multiple of %v", *s.multipleOf)
+		}
+	case string:
+		n := utf8.RuneCountInString(v)
+		switch {
+		case s.minLength != nil && n < *s.minLength:
+			return fail("must be at least %d characters long", *s.minLength)
+		case s.maxLength != nil && n > *s.maxLength:
+			return fail("must be at most %d characters long", *s.maxLength)
+		case s.pattern != nil && !s.pattern.MatchString(v):
+			return fail("must match the pattern %q", s.pattern)
+		}
+	}
+
+	for _, sub := range s.allOf {
+		if err := sub.validate(v, at); err != nil {
+			return err
+		}
+	}
+	if s.anyOf != nil && !slices.ContainsFunc(s.anyOf, func(sub *schema) bool { return sub.validate(v, at) == nil }) {
+		return fail("must match at least one schema of anyOf")
+	}
+	if s.oneOf != nil {
+		matched := 0
+		for _, sub := range s.oneOf {
+			if sub.validate(v, at) == nil {
+				matched++
+			}
+		}
+		if matched != 1 {
+			return fail("must match exactly one schema of oneOf, matched %d", matched)
+		}
+	}
+	if s.not != nil && s.not.validate(v, at) == nil {
+		return fail("must not match the schema of not")
+	}
+	return nil
+}
+
+// validateObject checks the object constraints of the schema.
+func (s *schema) validateObject(obj map[string]any, at string) error {
+	for _, name := range s.required {
+		if _, ok := obj[name]; !ok {
+			return &ValidationError{Path: at, Err: fmt.Errorf("missing required property %q", name)}
+		}
+	}
+	if s.minProperties != nil && len(obj) < *s.minProperties {
+		return &ValidationError{Path: at, Err: fmt.Errorf("must have at least %d properties", *s.minProperties)}
+	}
+	if s.maxProperties != nil && len(obj) > *s.maxProperties {
+		return &ValidationError{Path: at, Err: fmt.Errorf("must have at most %d properties", *s.maxProperties)}
+	}
+
+	// Check the properties in a stable order, so the same payload always
+	// reports the same error.
+	names := make([]string, 0, len(obj))
+	for name := range obj {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		sub, ok := s.properties[name]
+		if !ok {
+			sub = s.additional
+		}
+		if sub == nil {
+			continue
+		}
+		if err := sub.validate(obj[name], at+"/"+escapePointer(name)); err != nil {
+			if sub.always != nil && !ok {
+				return &ValidationError{Path: at + "/" + escapePointer(name), Err: errors.New("property not allowed")}
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// validateArray checks the array constraints of the schema.
+func (s *schema) validateArray(list []any, at string) error {
+	if s.minItems != nil && len(list) < *s.minItems {
+		return &ValidationError{Path: at, Err: fmt.Errorf("must have at least %d items", *s.minItems)}
+	}
+	if s.maxItems != nil && len(list) > *s.maxItems {
+		return &ValidationError{Path: at, Err: fmt.Errorf("must have at most %d items", *s.maxItems)}
+	}
+	if s.uniqueItems {
+		for i := range list {
+			for j := i + 1; j < len(list); j++ {
+				if reflect.DeepEqual(list[i], list[j]) {
+					return &ValidationError{Path: at, Err: fmt.Errorf("items %d and %d must not be equal", i, j)}
+				}
+			}
+		}
+	}
+	if s.items != nil {
+		for i, item := range list {
+			if err := s.items.validate(item, at+"/"+strconv.Itoa(i)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// isType reports whether a decoded JSON value is of the given JSON Schema type.
+func isType(v any, t string) bool {
+	switch v := v.(type) {
+	case nil:
+		return t == "null"
+	case bool:
+		return t == "boolean"
+	case map[string]any:
+		return t == "object"
+	case []any:
+		return t == "array"
+	case float64:
+		return t == "number" || t == "integer" && v == math.Trunc(v)
+	case string:
+		return t == "string"
+	}
+	return false
+}
+
+// isMultiple reports whether v is a multiple of m, allowing for the rounding
+// of decimal fractions such as 0.1.
+func isMultiple(v, m float64) bool {
+	q := v / m
+	return math.Abs(q-math.Round(q)) < 1e-9
+}
+
+// escapePointer escapes a property name for use in a JSON Pointer.
+func escapePointer(name string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(name)
+}
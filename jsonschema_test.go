@@ -0,0 +1,91 @@
+package queue
+
+import (
+	"errors"
+	"testing"
+)
+
+const orderSchema = `{
+	"$schema": "https://json-schema.org/draft/2020-12/schema",
+	"title": "Order",
+	"type": "object",
+	"required": ["id", "items"],
+	"additionalProperties": false,
+	"properties": {
+		"id": {"type": "string", "pattern": "^ord-[0-9]+$"},
+		"priority": {"enum": ["low", "high"]},
+		"items": {
+			"type": "array",
+			"minItems": 1,
+			"items": {
+				"type": "object",
+				"required": ["sku", "quantity"],
+				"properties": {
+					"sku": {"type": "string", "minLength": 1},
+					"quantity": {"type": "integer", "minimum": 1}
+				}
+			}
+		}
+	}
+}`
+
+func TestJSONSchema(t *testing.T) {
+	validator, err := JSONSchema([]byte(orderSchema))
+	if err != nil {
+		t.Fatalf("failed to compile schema: %v", err)
+	}
+
+	tests := []struct {
+		payload string
+		path    string // Expected path of the error; "-" for a valid payload.
+	}{
+		{`{"id": "ord-1", "items": [{"sku": "a", "quantity": 2}]}`, "-"},
+		{`{"id": "ord-1", "priority": "high", "items": [{"sku": "a", "quantity": 1}]}`, "-"},
+		{`not json`, ""},
+		{`[]`, ""},
+		{`{"items": [{"sku": "a", "quantity": 1}]}`, ""},
+		{`{"id": "order-1", "items": [{"sku": "a", "quantity": 1}]}`, "/id"},
+		{`{"id": "ord-1", "priority": "urgent", "items": [{"sku": "a", "quantity": 1}]}`, "/priority"},
+		{`{"id": "ord-1", "items": []}`, "/items"},
+		{`{"id": "ord-1", "items": [{"sku": "a", "quantity": 1.5}]}`, "/items/0/quantity"},
+		{`{"id": "ord-1", "items": [{"sku": "a", "quantity": 1}, {"sku": ""}]}`, "/items/1"},
+		{`{"id": "ord-1", "items": [{"sku": "a", "quantity": 1}], "note": "x"}`, "/note"},
+	}
+	for _, test := range tests {
+		err := validator.Validate([]byte(test.payload))
+		if test.path == "-" {
+			if err != nil {
+				t.Fatalf("expected %s to be valid, got %v", test.payload, err)
+			}
+			continue
+		}
+		var invalid *ValidationError
+		if !errors.As(err, &invalid) || invalid.Path != test.path {
+			t.Fatalf("expected %s to be invalid at %q, got %v", test.payload, test.path, err)
+		}
+	}
+}
+
+func TestJSONSchemaCombinators(t *testing.T) {
+	validator, err := JSONSchema([]byte(`{
+		"oneOf": [{"type": "integer", "multipleOf": 5}, {"type": "string", "maxLength": 3}],
+		"not": {"const": 10}
+	}`))
+	if err != nil {
+		t.Fatalf("failed to compile schema: %v", err)
+	}
+	for payload, valid := range map[string]bool{`15`: true, `"abc"`: true, `7`: false, `"abcd"`: false, `10`: false, `null`: false} {
+		if err := validator.Validate([]byte(payload)); (err == nil) != valid {
+			t.Fatalf("expected %s valid=%v, got %v", payload, valid, err)
+		}
+	}
+}
+
+func TestJSONSchemaUnsupported(t *testing.T) {
+	if _, err := JSONSchema([]byte(`{"properties": {"a": {"$ref": "#/$defs/a"}}}`)); err == nil {
+		t.Fatalf("expected $ref to be rejected")
+	}
+	if _, err := JSONSchema([]byte(`{"type": "float"}`)); err == nil {
+		t.Fatalf("expected an unknown type to be rejected")
+	}
+}
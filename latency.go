@@ -0,0 +1,154 @@
+package queue
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Latency summarizes how long listeners took to process items.
+type Latency struct {
+	Count int64         `json:"count"` // Number of items processed.
+	Mean  time.Duration `json:"mean"`  // Average processing time.
+	Max   time.Duration `json:"max"`   // Longest processing time.
+
+	// Windows summarize the items processed in the last minute, five
+	// minutes and fifteen minutes, in that order.
+	Windows []LatencyWindow `json:"windows"`
+}
+
+// LatencyWindow summarizes the processing times within a sliding window.
+// Percentiles are accurate to within 19%, and never exceed Max.
+type LatencyWindow struct {
+	Window time.Duration `json:"window"` // Length of the window, ending now.
+	Count  int64         `json:"count"`  // Number of items processed within the window.
+	P50    time.Duration `json:"p50"`    // Median processing time.
+	P95    time.Duration `json:"p95"`    // 95th percentile.
+	P99    time.Duration `json:"p99"`    // 99th percentile.
+	Max    time.Duration `json:"max"`    // Longest processing time.
+}
+
+// latencyWindows are the windows reported in Latency.Windows.
+var latencyWindows = []time.Duration{time.Minute, 5 * time.Minute, 15 * time.Minute}
+
+// Processing times are counted in histograms per latencySlot of time, so a
+// window is summarized by merging the slots it covers. The buckets of the
+// histograms grow by a factor of 2^(1/latencySteps) from latencyMin, which
+// bounds the error of the percentiles.
+const (
+	latencySlot    = 10 * time.Second
+	latencySlots   = 90 // 15 minutes, the longest window.
+	latencyMin     = time.Microsecond
+	latencySteps   = 4
+	latencyBuckets = 36 * latencySteps // Up to 2^36 µs, about 19 hours.
+)
+
+// latencyTracker accumulates processing times of the items dispatched by this instance.
+type latencyTracker struct {
+	mx    sync.Mutex
+	count int64
+	total time.Duration
+	max   time.Duration
+	slots []latencyHistogram // Ring of the histograms of the last latencySlots slots.
+}
+
+// latencyHistogram counts the processing times observed within a slot.
+type latencyHistogram struct {
+	slot    int64 // Number of the slot since the epoch; the histogram is stale if it is not current.
+	count   int64
+	max     time.Duration
+	buckets [latencyBuckets]int64
+}
+
+// observe records the processing time of one item finished at now.
+func (l *latencyTracker) observe(now time.Time, d time.Duration) {
+	l.mx.Lock()
+	defer l.mx.Unlock()
+
+	l.count++
+	l.total += d
+	l.max = max(l.max, d)
+
+	if l.slots == nil {
+		l.slots = make([]latencyHistogram, latencySlots)
+	}
+	slot := now.UnixNano() / int64(latencySlot)
+	h := &l.slots[slot%latencySlots]
+	if h.slot != slot {
+		*h = latencyHistogram{slot: slot} // Reuse the histogram of a slot that left the longest window.
+	}
+	h.count++
+	h.max = max(h.max, d)
+	h.buckets[latencyBucket(d)]++
+}
+
+// summary returns the processing times observed so far, and within each of
+// latencyWindows ending at now.
+func (l *latencyTracker) summary(now time.Time) Latency {
+	l.mx.Lock()
+	defer l.mx.Unlock()
+
+	latency := Latency{Count: l.count, Max: l.max}
+	if l.count > 0 {
+		latency.Mean = l.total / time.Duration(l.count)
+	}
+
+	current := now.UnixNano() / int64(latencySlot)
+	for _, window := range latencyWindows {
+		var merged latencyHistogram
+		first := current - int64(window/latencySlot) + 1
+		for i := range l.slots {
+			h := &l.slots[i]
+			if h.count == 0 || h.slot < first || h.slot > current {
+				continue
+			}
+			merged.count += h.count
+			merged.max = max(merged.max, h.max)
+			for b, n := range h.buckets {
+				merged.buckets[b] += n
+			}
+		}
+
+		latency.Windows = append(latency.Windows, LatencyWindow{
+			Window: window,
+			Count:  merged.count,
+			P50:    merged.percentile(0.50),
+			P95:    merged.percentile(0.95),
+			P99:    merged.percentile(0.99),
+			Max:    merged.max,
+		})
+	}
+	return latency
+}
+
+// percentile returns the upper bound of the bucket holding the q-th
+// quantile, capped at the longest observation.
+func (h *latencyHistogram) percentile(q float64) time.Duration {
+	if h.count == 0 {
+		return 0
+	}
+
+	rank := int64(math.Ceil(q * float64(h.count)))
+	var seen int64
+	for b, n := range h.buckets {
+		seen += n
+		if seen >= rank {
+			return min(latencyBound(b), h.max)
+		}
+	}
+	return h.max
+}
+
+// latencyBucket returns the bucket counting processing time d.
+func latencyBucket(d time.Duration) int {
+	if d <= latencyMin {
+		return 0
+	}
+	b := int(math.Ceil(latencySteps * math.Log2(float64(d)/float64(latencyMin))))
+	return min(b, latencyBuckets-1)
+}
+
+// latencyBound returns the upper bound of bucket b.
+func latencyBound(b int) time.Duration {
+	return time.Duration(float64(latencyMin) * math.Exp2(float64(b)/latencySteps))
+}
@@ -0,0 +1,112 @@
+package queue
+
+import (
+	"database/sql"
+	"errors"
+)
+
+// OverflowPolicy selects what Add does when the queue has reached its size limit.
+type OverflowPolicy int
+
+const (
+	OverflowReject     OverflowPolicy = iota // Return ErrQueueFull to the producer.
+	OverflowDropNewest                       // Silently discard the item being added.
+	OverflowDropOldest                       // Evict the oldest pending items to make room.
+	OverflowBlock                            // Block the producer until space frees up.
+)
+
+// errDropped signals that the overflow policy discarded the item being added.
+var errDropped = errors.New("queue: item dropped")
+
+// checkCapacity returns ErrQueueFull if adding a payload of the given size
+// would exceed the configured MaxItems or MaxBytes limits.
+func (c *Queue) checkCapacity(tx *sql.Tx, size int) error {
+	if c.cfg.MaxItems <= 0 && c.cfg.MaxBytes <= 0 {
+		return nil // The queue is unbounded.
+	}
+
+	count, bytes, err := c.usage(tx)
+	if err != nil {
+		return err
+	}
+
+	if c.cfg.MaxItems > 0 && count+1 > int64(c.cfg.MaxItems) {
+		return ErrQueueFull
+	}
+	if c.cfg.MaxBytes > 0 && bytes+int64(size) > c.cfg.MaxBytes {
+		return ErrQueueFull
+	}
+	return nil
+}
+
+// usage returns the number of queued items and the size of their payloads.
+func (c *Queue) usage(tx *sql.Tx) (count, bytes int64, err error) {
+	// Chunked payloads are only partly stored in the item rows.
+	err = tx.QueryRow(
+		"SELECT COUNT(*), COALESCE(SUM(LENGTH(data)), 0) + (SELECT COALESCE(SUM(LENGTH(data)), 0) FROM "+c.tables.chunks+") FROM "+c.tables.items,
+	).Scan(&count, &bytes)
+	return count, bytes, err
+}
+
+// makeRoom applies the overflow policy so a payload of the given size can be added.
+// It returns ErrQueueFull or errDropped when the item must not be inserted.
+func (c *Queue) makeRoom(tx *sql.Tx, size int, policy OverflowPolicy) error {
+	for {
+		err := c.checkCapacity(tx, size)
+		if !errors.Is(err, ErrQueueFull) {
+			return err
+		}
+
+		switch policy {
+		case OverflowDropNewest:
+			return errDropped
+		case OverflowDropOldest:
+			if !c.fits(size) {
+				return ErrQueueFull // Evicting everything would still not make enough room.
+			}
+
+			evicted, err := c.evictOldest(tx)
+			if err != nil {
+				return err
+			}
+			if !evicted {
+				return ErrQueueFull // Only in-flight items are left.
+			}
+		default:
+			return ErrQueueFull
+		}
+	}
+}
+
+// fits reports whether a payload of the given size fits into an empty queue.
+func (c *Queue) fits(size int) bool {
+	return c.cfg.MaxBytes <= 0 || int64(size) <= c.cfg.MaxBytes
+}
+
+// evictOldest removes the oldest item that is not being processed.
+// It reports false if there was no such item.
+func (c *Queue) evictOldest(tx *sql.Tx) (bool, error) {
+	var id int
+	err := tx.QueryRow("SELECT `id` FROM " + c.tables.items + " WHERE state = 'pending' ORDER BY id LIMIT 1").Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	before, err := c.rowSnapshot(tx, id)
+	if err != nil {
+		return false, err
+	}
+	if _, err := c.execTransition(tx, id, TransitionEvicted, c.stmts.delete, id); err != nil {
+		return false, err
+	}
+	return true, c.snapshot(tx, id, TransitionEvicted, before)
+}
+
+// signalFreed wakes producers waiting for space. It must be called with the queue locked.
+func (c *Queue) signalFreed() {
+	close(c.freed)
+	c.freed = make(chan struct{})
+}
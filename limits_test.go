@@ -0,0 +1,142 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMaxItems(t *testing.T) {
+	queue := setupQueue(t, Config{MaxItems: 2})
+	defer queue.Close()
+
+	for i := 0; i < 2; i++ {
+		if err := queue.Add([]byte("test data")); err != nil {
+			t.Fatalf("failed to add item to queue: %v", err)
+		}
+	}
+
+	if err := queue.Add([]byte("test data")); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("expected ErrQueueFull, got %v", err)
+	}
+
+	// Freeing a slot lets producers add again.
+	if err := queue.Delete(1); err != nil {
+		t.Fatalf("failed to delete item from queue: %v", err)
+	}
+	if err := queue.Add([]byte("test data")); err != nil {
+		t.Fatalf("failed to add item to queue: %v", err)
+	}
+}
+
+func TestMaxBytes(t *testing.T) {
+	queue := setupQueue(t, Config{MaxBytes: 10})
+	defer queue.Close()
+
+	if err := queue.Add([]byte("12345678")); err != nil {
+		t.Fatalf("failed to add item to queue: %v", err)
+	}
+	if err := queue.Add([]byte("123")); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("expected ErrQueueFull, got %v", err)
+	}
+	if err := queue.Add([]byte("12")); err != nil {
+		t.Fatalf("failed to add item to queue: %v", err)
+	}
+}
+
+func TestOverflowDropNewest(t *testing.T) {
+	queue := setupQueue(t, Config{MaxItems: 1, Overflow: OverflowDropNewest})
+	defer queue.Close()
+
+	for _, data := range []string{"first", "second"} {
+		if err := queue.Add([]byte(data)); err != nil {
+			t.Fatalf("failed to add item to queue: %v", err)
+		}
+	}
+
+	items, err := queue.Get(10)
+	if err != nil {
+		t.Fatalf("failed to get items from queue: %v", err)
+	}
+	if len(items) != 1 || string(items[0].Data) != "first" {
+		t.Fatalf("unexpected items: %+v", items)
+	}
+}
+
+func TestOverflowDropOldest(t *testing.T) {
+	queue := setupQueue(t, Config{MaxItems: 2, Overflow: OverflowDropOldest})
+	defer queue.Close()
+
+	for _, data := range []string{"first", "second", "third"} {
+		if err := queue.Add([]byte(data)); err != nil {
+			t.Fatalf("failed to add item to queue: %v", err)
+		}
+	}
+
+	items, err := queue.Get(10)
+	if err != nil {
+		t.Fatalf("failed to get items from queue: %v", err)
+	}
+	if len(items) != 2 || string(items[0].Data) != "second" || string(items[1].Data) != "third" {
+		t.Fatalf("unexpected items: %+v", items)
+	}
+}
+
+func TestOverflowBlock(t *testing.T) {
+	queue := setupQueue(t, Config{MaxItems: 1, Overflow: OverflowBlock})
+	defer queue.Close()
+
+	if err := queue.Add([]byte("first")); err != nil {
+		t.Fatalf("failed to add item to queue: %v", err)
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- queue.Add([]byte("second"))
+	}()
+
+	select {
+	case err := <-done:
+		t.Fatalf("expected Add to block, returned %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if err := queue.Delete(1); err != nil {
+		t.Fatalf("failed to delete item from queue: %v", err)
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("failed to add item to queue: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Add did not unblock after space freed up")
+	}
+}
+
+func TestAddWait(t *testing.T) {
+	queue := setupQueue(t, Config{MaxItems: 1})
+	defer queue.Close()
+
+	if err := queue.AddWait(context.Background(), []byte("first")); err != nil {
+		t.Fatalf("failed to add item to queue: %v", err)
+	}
+
+	// The queue stays full, so the wait ends with the context.
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := queue.AddWait(ctx, []byte("second")); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+	}
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		queue.Delete(1)
+	}()
+
+	if err := queue.AddWait(context.Background(), []byte("third")); err != nil {
+		t.Fatalf("failed to add item to queue: %v", err)
+	}
+}
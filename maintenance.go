@@ -0,0 +1,76 @@
+package queue
+
+import (
+	"context"
+	"database/sql"
+)
+
+// maintain periodically compacts the database and refreshes query planner
+// statistics until ctx is done. Compaction runs while idle reports true, or as
+// soon as the number of free pages reaches Config.CompactFreePages. Every pass
+// holds the locks acquired by lock, which returns the matching unlock function.
+func maintain(ctx context.Context, db *sql.DB, cfg Config, idle func() (bool, error), lock func() func()) {
+	ticker := cfg.Clock.NewTicker(cfg.MaintenanceInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+			if err := runMaintenance(ctx, db, cfg, idle, lock); err != nil {
+				cfg.Logger.Println("Error running maintenance:", err)
+			}
+		}
+	}
+}
+
+// runMaintenance performs a single maintenance pass.
+func runMaintenance(ctx context.Context, db *sql.DB, cfg Config, idle func() (bool, error), lock func() func()) error {
+	isIdle, err := idle()
+	if err != nil {
+		return err
+	}
+
+	unlock := lock()
+	defer unlock()
+
+	info, err := storageInfo(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	threshold := cfg.CompactFreePages > 0 && info.FreelistCount >= cfg.CompactFreePages
+	if info.FreelistCount > 0 && (isIdle || threshold) {
+		if err := compactDatabase(ctx, db); err != nil {
+			return err
+		}
+	}
+
+	if !isIdle {
+		return nil
+	}
+
+	// Let SQLite run ANALYZE on the tables whose statistics are stale.
+	_, err = db.ExecContext(ctx, "PRAGMA optimize")
+	return err
+}
+
+// lock acquires the queue mutex and returns the function releasing it.
+func (c *Queue) lock() func() {
+	c.mx.Lock()
+	return c.mx.Unlock
+}
+
+// idle reports whether the queue has nothing left to process. Dead letters
+// wait for an operator and do not keep the queue busy.
+func (c *Queue) idle() (bool, error) {
+	c.mx.Lock() // Lock for exclusive access to the queue.
+	defer c.mx.Unlock()
+
+	var exists bool
+	if err := c.db.QueryRowContext(c.ctx, "SELECT EXISTS (SELECT 1 FROM "+c.tables.items+" WHERE state != 'dead')").Scan(&exists); err != nil {
+		return false, err
+	}
+	return !exists, nil
+}
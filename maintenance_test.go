@@ -0,0 +1,39 @@
+package queue
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMaintenanceCompactsWhenIdle(t *testing.T) {
+	queue := setupQueue(t, Config{
+		LocalFile:           filepath.Join(t.TempDir(), "queue.db"),
+		MaintenanceInterval: 20 * time.Millisecond,
+	})
+	defer queue.Close()
+
+	payload := make([]byte, 64*1024)
+	for i := 0; i < 10; i++ {
+		if err := queue.Add(payload); err != nil {
+			t.Fatalf("failed to add item to queue: %v", err)
+		}
+	}
+	for i := 1; i <= 10; i++ {
+		if err := queue.Delete(i); err != nil {
+			t.Fatalf("failed to delete item from queue: %v", err)
+		}
+	}
+
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+		info, err := queue.Storage(context.Background())
+		if err != nil {
+			t.Fatalf("failed to read storage info: %v", err)
+		}
+		if info.FreelistCount == 0 {
+			return
+		}
+	}
+	t.Fatalf("expected maintenance to compact the idle queue")
+}
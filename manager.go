@@ -0,0 +1,165 @@
+package queue
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"sync"
+)
+
+// Manager hosts several named queues in one database, sharing a single
+// connection pool and maintenance scheduler between them.
+type Manager struct {
+	db         *sql.DB            // The SQL database connection shared by the queues.
+	cfg        Config             // Configuration applied to every queue.
+	ctx        context.Context    // Context for stopping background work.
+	cancelFunc context.CancelFunc // Cancellation function for the context.
+	queues     map[string]*Queue  // Queues handed out so far, by name.
+	closed     bool               // Whether Close has been called.
+	sched      scheduler          // Shares the workers started with Run between the served queues.
+	recovery   *RecoveryReport    // Set if NewManager salvaged a damaged database; see Recovery.
+	slots      chan struct{}      // Holds a token per callback running in any of the queues when Config.MaxInFlight is set; nil otherwise.
+
+	mx sync.Mutex // Mutex to ensure thread-safe access to the queues.
+}
+
+// NewManager opens the database described by the configuration. Config.Table
+// is ignored; every queue is stored in the table named after it.
+func NewManager(options ...Option) (*Manager, error) {
+	cfg, err := newConfig(options) // Retrieve the configuration with defaults.
+	if err != nil {
+		return nil, err
+	}
+
+	db, recovery, err := openChecked(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancelFunc := context.WithCancel(context.Background())
+
+	m := &Manager{
+		db:         db,
+		cfg:        cfg,
+		ctx:        ctx,
+		cancelFunc: cancelFunc,
+		queues:     make(map[string]*Queue),
+		recovery:   recovery,
+	}
+	if cfg.MaxInFlight > 0 {
+		m.slots = make(chan struct{}, cfg.MaxInFlight)
+	}
+
+	if cfg.MaintenanceInterval > 0 {
+		go maintain(m.ctx, m.db, m.cfg, m.idle, m.lock)
+	}
+
+	return m, nil
+}
+
+// Queue returns the queue with the given name, creating its tables on first use.
+// The name must be a valid table name. Repeated calls return the same instance.
+func (m *Manager) Queue(name string) (*Queue, error) {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	if m.closed {
+		return nil, ErrClosed
+	}
+	if q, ok := m.queues[name]; ok {
+		return q, nil
+	}
+
+	cfg := m.cfg
+	cfg.Table = name
+	cfg.MaintenanceInterval = 0 // Maintenance runs once for the whole database.
+
+	q, err := newQueue(m.db, cfg, m.slots)
+	if err != nil {
+		return nil, err
+	}
+	q.onClose = func() { m.forget(name, q) }
+	m.queues[name] = q
+	return q, nil
+}
+
+// Names returns the names of the queues handed out so far, sorted.
+func (m *Manager) Names() []string {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	return m.names()
+}
+
+// names returns the sorted queue names. It must be called with the manager locked.
+func (m *Manager) names() []string {
+	names := make([]string, 0, len(m.queues))
+	for name := range m.queues {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// forget drops a closed queue so the next call to Queue opens a fresh instance.
+func (m *Manager) forget(name string, q *Queue) {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	if m.queues[name] == q {
+		delete(m.queues, name)
+	}
+}
+
+// Close stops every queue and closes the shared database connection.
+func (m *Manager) Close() error {
+	queues := m.snapshotQueues()
+
+	m.mx.Lock()
+	m.closed = true
+	m.mx.Unlock()
+
+	m.cancelFunc()
+	for _, q := range queues {
+		q.Close()
+	}
+	return m.db.Close()
+}
+
+// snapshotQueues returns the queues handed out so far, ordered by name.
+func (m *Manager) snapshotQueues() []*Queue {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	names := m.names()
+	queues := make([]*Queue, len(names))
+	for i, name := range names {
+		queues[i] = m.queues[name]
+	}
+	return queues
+}
+
+// idle reports whether every queue is idle.
+func (m *Manager) idle() (bool, error) {
+	for _, q := range m.snapshotQueues() {
+		idle, err := q.idle()
+		if err != nil || !idle {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// lock acquires the mutex of every queue, in name order to avoid deadlocks,
+// and returns the function releasing them.
+func (m *Manager) lock() func() {
+	queues := m.snapshotQueues()
+	for _, q := range queues {
+		q.mx.Lock()
+	}
+	return func() {
+		for _, q := range queues {
+			q.mx.Unlock()
+		}
+	}
+}
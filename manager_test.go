@@ -0,0 +1,56 @@
+package queue
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestManager(t *testing.T) {
+	manager, err := NewManager(Config{})
+	if err != nil {
+		t.Fatalf("failed to initialize manager: %v", err)
+	}
+
+	emails, err := manager.Queue("emails")
+	if err != nil {
+		t.Fatalf("failed to open queue: %v", err)
+	}
+	reports, err := manager.Queue("reports")
+	if err != nil {
+		t.Fatalf("failed to open queue: %v", err)
+	}
+
+	if again, _ := manager.Queue("emails"); again != emails {
+		t.Fatalf("expected the same queue instance for the same name")
+	}
+
+	if err := emails.Add([]byte("email")); err != nil {
+		t.Fatalf("failed to add item to queue: %v", err)
+	}
+
+	items, err := reports.Get(10)
+	if err != nil || len(items) != 0 {
+		t.Fatalf("expected reports to be empty, got %+v, %v", items, err)
+	}
+	items, err = emails.Get(10)
+	if err != nil || len(items) != 1 {
+		t.Fatalf("expected one email, got %+v, %v", items, err)
+	}
+
+	// Closing a managed queue keeps the shared connection usable.
+	reports.Close()
+	if err := emails.Add([]byte("email")); err != nil {
+		t.Fatalf("failed to add item after closing a sibling queue: %v", err)
+	}
+
+	if names := manager.Names(); len(names) != 1 || names[0] != "emails" {
+		t.Fatalf("unexpected queue names: %v", names)
+	}
+
+	if err := manager.Close(); err != nil {
+		t.Fatalf("failed to close manager: %v", err)
+	}
+	if _, err := manager.Queue("emails"); !errors.Is(err, ErrClosed) {
+		t.Fatalf("expected ErrClosed, got %v", err)
+	}
+}
@@ -0,0 +1,93 @@
+package queue
+
+import "time"
+
+// Names of the metrics reported to Config.Metrics. Every measurement carries
+// the label "queue" set to Config.Table, so the queues of a Manager can be
+// told apart.
+const (
+	MetricEnqueued     = "queue_enqueued_total"      // Counter of added items.
+	MetricClaimed      = "queue_claimed_total"       // Counter of items claimed by listeners or Claim.
+	MetricAcked        = "queue_acked_total"         // Counter of items acknowledged after processing.
+	MetricRetried      = "queue_retried_total"       // Counter of deliveries a listener asked to retry.
+	MetricDeadLettered = "queue_dead_lettered_total" // Counter of items moved to the dead letters.
+	MetricExpired      = "queue_expired_total"       // Counter of items whose deadline passed before they were claimed.
+	MetricProcessing   = "queue_processing_seconds"  // Histogram of the time listeners took per item.
+	MetricPending      = "queue_pending_items"       // Gauge of items waiting to be delivered.
+	MetricInFlight     = "queue_in_flight_items"     // Gauge of items being processed.
+	MetricDead         = "queue_dead_items"          // Gauge of dead-lettered items.
+	MetricBytes        = "queue_bytes"               // Gauge of the total payload size.
+)
+
+// gaugeInterval is how often the listener loops refresh the gauges, as each
+// refresh counts the items in the database.
+const gaugeInterval = 10 * time.Second
+
+// Label is a name and value qualifying a measurement.
+type Label struct {
+	Name  string
+	Value string
+}
+
+// Metrics receives the measurements of a queue, so it can be wired to any
+// metrics system; queueprom and queueotel adapt Prometheus and OpenTelemetry.
+// The methods are called from the hot paths, concurrently, and should return
+// quickly. A metric is always reported with the same kind and label names.
+type Metrics interface {
+	// Counter adds delta to a monotonic counter.
+	Counter(name string, delta float64, labels ...Label)
+	// Gauge sets a value that can go up and down.
+	Gauge(name string, value float64, labels ...Label)
+	// Histogram records one observation of a distribution, e.g. a duration
+	// in seconds.
+	Histogram(name string, value float64, labels ...Label)
+}
+
+// NopMetrics discards all measurements; it is the default Config.Metrics.
+type NopMetrics struct{}
+
+func (NopMetrics) Counter(string, float64, ...Label)   {}
+func (NopMetrics) Gauge(string, float64, ...Label)     {}
+func (NopMetrics) Histogram(string, float64, ...Label) {}
+
+// count adds n to a counter of the queue.
+func (c *Queue) count(name string, n int) {
+	if n > 0 {
+		c.counters.add(name, n)
+		c.cfg.Metrics.Counter(name, float64(n), c.labels...)
+	}
+}
+
+// observeProcessing records how long a listener took for an item.
+func (c *Queue) observeProcessing(d time.Duration) {
+	c.latency.observe(c.cfg.Clock.Now(), d)
+	c.cfg.Metrics.Histogram(MetricProcessing, d.Seconds(), c.labels...)
+}
+
+// reportGauges sets the gauges from Stats, at most once per gaugeInterval.
+func (c *Queue) reportGauges() {
+	if _, nop := c.cfg.Metrics.(NopMetrics); nop {
+		return
+	}
+
+	now := c.cfg.Clock.Now()
+	c.mx.Lock()
+	due := now.Sub(c.gaugesAt) >= gaugeInterval
+	if due {
+		c.gaugesAt = now
+	}
+	c.mx.Unlock()
+	if !due {
+		return
+	}
+
+	stats, err := c.Stats()
+	if err != nil {
+		c.cfg.Logger.Println("Error reporting metrics:", err)
+		return
+	}
+	c.cfg.Metrics.Gauge(MetricPending, float64(stats.Pending), c.labels...)
+	c.cfg.Metrics.Gauge(MetricInFlight, float64(stats.InFlight), c.labels...)
+	c.cfg.Metrics.Gauge(MetricDead, float64(stats.Dead), c.labels...)
+	c.cfg.Metrics.Gauge(MetricBytes, float64(stats.Bytes), c.labels...)
+}
@@ -0,0 +1,109 @@
+package queue
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingMetrics sums the counters and histograms reported for each metric
+// name, and keeps every value of the gauges.
+type recordingMetrics struct {
+	mx     sync.Mutex
+	values map[string]float64
+	counts map[string]int
+	gauges map[string][]float64
+	labels []Label
+}
+
+func newRecordingMetrics() *recordingMetrics {
+	return &recordingMetrics{values: make(map[string]float64), counts: make(map[string]int), gauges: make(map[string][]float64)}
+}
+
+func (m *recordingMetrics) Counter(name string, delta float64, labels ...Label) {
+	m.record(name, delta, labels)
+}
+
+func (m *recordingMetrics) Gauge(name string, value float64, labels ...Label) {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+	m.gauges[name] = append(m.gauges[name], value)
+}
+
+func (m *recordingMetrics) Histogram(name string, value float64, labels ...Label) {
+	m.record(name, value, labels)
+}
+
+func (m *recordingMetrics) record(name string, value float64, labels []Label) {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+	m.values[name] += value
+	m.counts[name]++
+	m.labels = labels
+}
+
+func (m *recordingMetrics) get(name string) (float64, int) {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+	return m.values[name], m.counts[name]
+}
+
+func TestMetrics(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1700000000, 0))
+	metrics := newRecordingMetrics()
+	queue := setupQueue(t, Config{Table: "jobs", Clock: clock, Metrics: metrics})
+	defer queue.Close()
+
+	for _, data := range []string{"a", "b"} {
+		if err := queue.Add([]byte(data)); err != nil {
+			t.Fatalf("failed to add item to queue: %v", err)
+		}
+	}
+
+	done := make(chan struct{}, 3)
+	retried := false
+	queue.Listener(func(item Item, delay func(sec time.Duration)) {
+		if !retried {
+			retried = true
+			delay(time.Minute)
+		}
+		done <- struct{}{}
+	})
+
+	// The first item is retried after a minute, then both are processed.
+	<-done
+	for clock.Waiters() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	clock.Advance(time.Minute)
+	for i := 0; i < 2; i++ {
+		<-done
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if acked, _ := metrics.get(MetricAcked); acked == 2 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	expected := map[string]float64{MetricEnqueued: 2, MetricClaimed: 3, MetricRetried: 1, MetricAcked: 2}
+	for name, value := range expected {
+		if got, _ := metrics.get(name); got != value {
+			t.Errorf("expected %s = %v, got %v", name, value, got)
+		}
+	}
+	if _, n := metrics.get(MetricProcessing); n != 3 {
+		t.Errorf("expected 3 processing times, got %d", n)
+	}
+
+	metrics.mx.Lock()
+	defer metrics.mx.Unlock()
+	if pending := metrics.gauges[MetricPending]; len(pending) == 0 || pending[0] != 2 {
+		t.Errorf("expected the pending gauge to start at 2 items, got %v", pending)
+	}
+	if len(metrics.labels) != 1 || metrics.labels[0] != (Label{Name: "queue", Value: "jobs"}) {
+		t.Errorf("unexpected labels: %+v", metrics.labels)
+	}
+}
@@ -0,0 +1,64 @@
+package queue
+
+import (
+	"context"
+	"time"
+)
+
+// Handler processes an item. It has the signature of the callbacks passed to
+// Listener and TagListener.
+type Handler func(item Item, delay func(sec time.Duration))
+
+// AddFunc inserts an item into the queue.
+type AddFunc func(ctx context.Context, data []byte, tags []string) error
+
+// Middleware wraps enqueueing and processing with cross-cutting behaviour
+// such as logging, metrics, payload validation or tracing. Either field may
+// be nil to wrap only one side.
+type Middleware struct {
+	// Add wraps Add, AddTagged and AddWait. Returning an error without calling
+	// next rejects the item.
+	Add func(next AddFunc) AddFunc
+
+	// Handle wraps every listener callback. The item is acknowledged or
+	// released after the outermost handler returns, as without middleware.
+	Handle func(next Handler) Handler
+}
+
+// Use appends middleware to the queue. Middleware registered first runs
+// outermost, like a stack of HTTP middleware. It applies to items added and
+// dispatched after the call.
+func (c *Queue) Use(middleware ...Middleware) {
+	c.mx.Lock() // Lock for exclusive access to the queue.
+	defer c.mx.Unlock()
+
+	c.middleware = append(c.middleware, middleware...)
+}
+
+// enqueue passes an item through the Add middleware and inserts it with add.
+func (c *Queue) enqueue(ctx context.Context, data []byte, tags []string, policy OverflowPolicy) error {
+	c.mx.Lock()
+	middleware := c.middleware
+	c.mx.Unlock()
+
+	next := AddFunc(func(ctx context.Context, data []byte, tags []string) error {
+		return c.add(ctx, data, tags, policy)
+	})
+	for i := len(middleware) - 1; i >= 0; i-- {
+		if middleware[i].Add != nil {
+			next = middleware[i].Add(next)
+		}
+	}
+	return next(ctx, data, tags)
+}
+
+// wrapHandler wraps a listener callback in the Handle middleware. It must be
+// called with the queue locked.
+func (c *Queue) wrapHandler(clb Handler) Handler {
+	for i := len(c.middleware) - 1; i >= 0; i-- {
+		if c.middleware[i].Handle != nil {
+			clb = c.middleware[i].Handle(clb)
+		}
+	}
+	return clb
+}
@@ -0,0 +1,92 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMiddleware(t *testing.T) {
+	queue := setupQueue(t, Config{})
+	defer queue.Close()
+
+	var calls []string
+	trace := func(name string) Middleware {
+		return Middleware{
+			Add: func(next AddFunc) AddFunc {
+				return func(ctx context.Context, data []byte, tags []string) error {
+					calls = append(calls, name+" add")
+					return next(ctx, data, tags)
+				}
+			},
+			Handle: func(next Handler) Handler {
+				return func(item Item, delay func(sec time.Duration)) {
+					calls = append(calls, name+" handle")
+					next(item, delay)
+				}
+			},
+		}
+	}
+	queue.Use(trace("outer"), trace("inner"))
+
+	if err := queue.AddTagged([]byte("test data"), "email"); err != nil {
+		t.Fatalf("failed to add item to queue: %v", err)
+	}
+
+	done := make(chan Item, 1)
+	queue.Listener(func(item Item, delay func(sec time.Duration)) {
+		done <- item
+	})
+
+	select {
+	case item := <-done:
+		if string(item.Data) != "test data" {
+			t.Fatalf("unexpected item: %+v", item)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the listener was not called")
+	}
+
+	expected := []string{"outer add", "inner add", "outer handle", "inner handle"}
+	if len(calls) != len(expected) {
+		t.Fatalf("expected calls %v, got %v", expected, calls)
+	}
+	for i := range expected {
+		if calls[i] != expected[i] {
+			t.Fatalf("expected calls %v, got %v", expected, calls)
+		}
+	}
+}
+
+func TestMiddlewareRejects(t *testing.T) {
+	queue := setupQueue(t, Config{})
+	defer queue.Close()
+
+	invalid := errors.New("empty payload")
+	queue.Use(Middleware{
+		Add: func(next AddFunc) AddFunc {
+			return func(ctx context.Context, data []byte, tags []string) error {
+				if len(data) == 0 {
+					return invalid
+				}
+				return next(ctx, data, tags)
+			}
+		},
+	})
+
+	if err := queue.Add(nil); !errors.Is(err, invalid) {
+		t.Fatalf("expected the middleware error, got %v", err)
+	}
+	if err := queue.Add([]byte("valid")); err != nil {
+		t.Fatalf("failed to add item to queue: %v", err)
+	}
+
+	stats, err := queue.Stats()
+	if err != nil {
+		t.Fatalf("failed to read stats: %v", err)
+	}
+	if stats.Pending != 1 {
+		t.Fatalf("expected only the valid item, got %+v", stats)
+	}
+}
@@ -0,0 +1,276 @@
+package queue
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// mirrorBatchSize is the number of outbox rows copied to the mirror per round trip.
+const mirrorBatchSize = 100
+
+// mirrorRetryDelay is how long copying pauses after the mirror returned an error.
+const mirrorRetryDelay = time.Second
+
+// MirrorLag describes how far the mirror queue is behind this queue.
+type MirrorLag struct {
+	Pending   int           // Items added here but not yet copied to the mirror.
+	Age       time.Duration // How long the oldest of those items has been waiting.
+	Copied    int64         // Items copied by this instance since it was opened.
+	LastError error         // Error returned by the last failed copy, nil after a success.
+}
+
+// mirrorState tracks the copying goroutine of a queue with a mirror.
+type mirrorState struct {
+	wake chan struct{} // Signalled when items are written to the outbox.
+
+	mx        sync.Mutex // Guards the fields below.
+	copied    int64
+	lastError error
+}
+
+// createMirrorTable creates the outbox of items waiting to be copied to the mirror.
+func createMirrorTable(tx *sql.Tx, t tables) error {
+	_, err := tx.Exec(`
+        CREATE TABLE IF NOT EXISTS ` + t.mirror + ` (
+            seq INTEGER PRIMARY KEY AUTOINCREMENT,
+            data BLOB NOT NULL,
+            tags TEXT,
+            created_at INTEGER NOT NULL
+        );
+    `)
+	return err
+}
+
+// addMirrorOptionColumns adds the columns holding the options an item was
+// added with to the outbox, so the mirror receives the item as it was added.
+func addMirrorOptionColumns(tx *sql.Tx, t tables) error {
+	columns := []struct{ name, definition string }{
+		{"priority", "INTEGER NOT NULL DEFAULT 0"},
+		{"visible_at", "INTEGER"},
+		{"expires_at", "INTEGER"},
+		{"headers", "TEXT"},
+		{"tenant", "TEXT"},
+		{"job_type", "TEXT"},
+		{"dedup_key", "TEXT"},
+	}
+	for _, column := range columns {
+		if err := addColumn(tx, t.mirror, column.name, column.definition); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addMirrorKeyIDColumn adds the column holding the ID of the key of
+// Config.Keyring a copy in the outbox is sealed under; NULL for copies
+// stored in clear.
+func addMirrorKeyIDColumn(tx *sql.Tx, t tables) error {
+	return addColumn(tx, t.mirror, "key_id", "TEXT")
+}
+
+// optionAdder is implemented by mirrors that take the options of an added
+// item, such as a *Queue.
+type optionAdder interface {
+	AddContext(ctx context.Context, data []byte, opts ...AddOption) (int, error)
+}
+
+// queueMirror writes a copy of an added item, with the options it was added
+// with, to the outbox in the same transaction as the insert, so no item is
+// lost if the process stops before it reaches the mirror. With
+// Config.Keyring the copy is sealed like the item itself. It does nothing
+// unless Config.Mirror is set.
+func (c *Queue) queueMirror(tx *sql.Tx, data []byte, tags any, opts addOptions) error {
+	if c.cfg.Mirror == nil {
+		return nil
+	}
+
+	sealed, keyID, err := c.encrypt(data)
+	if err != nil {
+		return err
+	}
+
+	var visible, expires any
+	if opts.visibleAt > 0 {
+		visible = opts.visibleAt
+	}
+	if opts.expiresAt > 0 {
+		expires = opts.expiresAt
+	}
+	headers, err := encodeHeaders(opts.headers)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(
+		"INSERT INTO "+c.tables.mirror+"(`data`, `key_id`, `tags`, `priority`, `visible_at`, `expires_at`, `headers`, `tenant`, `job_type`, `dedup_key`, `created_at`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		sealed, nullString(keyID), tags, opts.priority, visible, expires, headers, nullString(opts.tenant), nullString(opts.jobType), nullString(opts.dedupKey), c.cfg.Clock.Now().UnixNano(),
+	)
+	if err != nil {
+		return err
+	}
+
+	// Wake the copying goroutine without blocking if it is already awake.
+	select {
+	case c.mirror.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// runMirror copies items from the outbox to the mirror until the queue is closed.
+func (c *Queue) runMirror() {
+	ticker := c.cfg.Clock.NewTicker(mirrorRetryDelay)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-c.mirror.wake:
+		case <-ticker.C(): // Retry after errors and pick up rows left by earlier runs.
+		}
+
+		for {
+			copied, err := c.copyToMirror()
+			c.mirror.mx.Lock()
+			c.mirror.copied += int64(copied)
+			c.mirror.lastError = err
+			c.mirror.mx.Unlock()
+
+			if err != nil {
+				if c.ctx.Err() == nil {
+					c.cfg.Logger.Println("Error mirroring items:", err)
+				}
+				break
+			}
+			if copied < mirrorBatchSize {
+				break // The outbox is drained.
+			}
+		}
+	}
+}
+
+// copyToMirror copies the next batch of outbox rows to the mirror in order and
+// returns how many were copied. Every row is removed right after the mirror
+// accepted it, so a failure repeats at most the item that failed. Mirrors
+// taking add options, such as a *Queue, receive the items with the options
+// they were added with; others only with their tags. Sealed copies are
+// opened first and handed over in clear, for the mirror to seal under its
+// own keyring.
+func (c *Queue) copyToMirror() (int, error) {
+	type entry struct {
+		seq  int64
+		data []byte
+		tags []string
+		opts []AddOption
+	}
+
+	// Read the batch and close the rows before writing, as the pool may only
+	// have a single connection.
+	rows, err := c.db.QueryContext(
+		c.ctx,
+		"SELECT `seq`, `data`, `key_id`, `tags`, `priority`, `visible_at`, `expires_at`, `headers`, `tenant`, `job_type`, `dedup_key` FROM "+c.tables.mirror+" ORDER BY seq LIMIT ?",
+		mirrorBatchSize,
+	)
+	if err != nil {
+		return 0, err
+	}
+	now := c.cfg.Clock.Now()
+	var batch []entry
+	for rows.Next() {
+		var e entry
+		var priority int
+		var visibleAt, expiresAt sql.NullInt64
+		var keyID, tags, headers, tenant, jobType, dedupKey sql.NullString
+		if err := rows.Scan(&e.seq, &e.data, &keyID, &tags, &priority, &visibleAt, &expiresAt, &headers, &tenant, &jobType, &dedupKey); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		if e.data, err = c.openMirrored(e.data, keyID.String); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		if e.tags, err = decodeTags(tags.String); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		h, err := decodeHeaders(headers.String)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+
+		e.opts = []AddOption{WithTags(e.tags...), WithPriority(priority), WithHeaders(h), WithTenant(tenant.String), WithType(jobType.String)}
+		if visibleAt.Valid {
+			// The mirror hides the item until the same time, however late it is copied.
+			e.opts = append(e.opts, WithDelay(time.Unix(0, visibleAt.Int64).Sub(now)))
+		}
+		if expiresAt.Valid {
+			e.opts = append(e.opts, WithDeadline(time.Unix(0, expiresAt.Int64)))
+		}
+		if dedupKey.Valid {
+			e.opts = append(e.opts, WithDedupKey(dedupKey.String))
+		}
+		batch = append(batch, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	adder, withOptions := c.cfg.Mirror.(optionAdder)
+	for i, e := range batch {
+		if withOptions {
+			_, err = adder.AddContext(c.ctx, e.data, e.opts...)
+		} else {
+			err = c.cfg.Mirror.AddTagged(e.data, e.tags...)
+		}
+		if err != nil {
+			return i, err
+		}
+		if _, err := c.db.ExecContext(c.ctx, "DELETE FROM "+c.tables.mirror+" WHERE seq = ?", e.seq); err != nil {
+			return i + 1, err
+		}
+	}
+	return len(batch), nil
+}
+
+// openMirrored returns the plaintext of a copy in the outbox sealed under
+// the key keyID of Config.Keyring, or the copy itself if keyID is empty.
+func (c *Queue) openMirrored(data []byte, keyID string) ([]byte, error) {
+	if keyID == "" {
+		return data, nil // Stored in clear.
+	}
+	if c.cfg.Keyring == nil {
+		return nil, fmt.Errorf("queue: mirrored copy under key %q: %w", keyID, ErrUnknownKey)
+	}
+	data, err := c.cfg.Keyring.open(keyID, data)
+	if err != nil {
+		return nil, fmt.Errorf("queue: mirrored copy under key %q: %w", keyID, err)
+	}
+	return data, nil
+}
+
+// MirrorLag reports how far Config.Mirror is behind this queue.
+func (c *Queue) MirrorLag() (MirrorLag, error) {
+	var pending int
+	var oldest sql.NullInt64
+	err := c.db.QueryRowContext(
+		c.ctx,
+		"SELECT COUNT(*), MIN(created_at) FROM "+c.tables.mirror,
+	).Scan(&pending, &oldest)
+	if err != nil {
+		return MirrorLag{}, err
+	}
+
+	c.mirror.mx.Lock()
+	lag := MirrorLag{Pending: pending, Copied: c.mirror.copied, LastError: c.mirror.lastError}
+	c.mirror.mx.Unlock()
+
+	if oldest.Valid {
+		lag.Age = c.cfg.Clock.Now().Sub(time.Unix(0, oldest.Int64))
+	}
+	return lag, nil
+}
@@ -0,0 +1,171 @@
+package queue
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// failingQueuer is a mirror rejecting every item.
+type failingQueuer struct {
+	Queuer
+}
+
+func (failingQueuer) AddTagged(data []byte, tags ...string) error {
+	return errors.New("mirror unavailable")
+}
+
+func TestMirror(t *testing.T) {
+	mirror := setupQueue(t, Config{})
+	defer mirror.Close()
+
+	queue := setupQueue(t, Config{Mirror: mirror})
+	defer queue.Close()
+
+	if err := queue.AddTagged([]byte("first"), "email"); err != nil {
+		t.Fatalf("failed to add item to queue: %v", err)
+	}
+	if err := queue.Add([]byte("second")); err != nil {
+		t.Fatalf("failed to add item to queue: %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		lag, err := queue.MirrorLag()
+		if err != nil {
+			t.Fatalf("failed to read mirror lag: %v", err)
+		}
+		if lag.Pending == 0 && lag.Copied == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for the mirror, lag %+v", lag)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	items, err := mirror.Get(10)
+	if err != nil {
+		t.Fatalf("failed to get mirrored items: %v", err)
+	}
+	if len(items) != 2 || string(items[0].Data) != "first" || items[0].Tags[0] != "email" || string(items[1].Data) != "second" {
+		t.Fatalf("unexpected mirrored items: %+v", items)
+	}
+}
+
+func TestMirrorFailure(t *testing.T) {
+	queue := setupQueue(t, Config{Mirror: failingQueuer{}})
+	defer queue.Close()
+
+	if err := queue.Add([]byte("test data")); err != nil {
+		t.Fatalf("failed to add item to queue: %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		lag, err := queue.MirrorLag()
+		if err != nil {
+			t.Fatalf("failed to read mirror lag: %v", err)
+		}
+		if lag.LastError != nil {
+			if lag.Pending != 1 || lag.Age <= 0 {
+				t.Fatalf("expected the item to wait in the outbox, lag %+v", lag)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for the mirror error")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestMirrorAddOptions(t *testing.T) {
+	mirror := setupQueue(t, Config{})
+	defer mirror.Close()
+
+	queue := setupQueue(t, Config{Mirror: mirror})
+	defer queue.Close()
+
+	deadline := time.Now().Add(24 * time.Hour).Round(0)
+	_, err := queue.AddContext(
+		context.Background(), []byte("first"),
+		WithTags("email"), WithPriority(5), WithTenant("acme"), WithType("send"),
+		WithHeaders(map[string]string{"trace": "abc"}), WithDelay(time.Hour), WithDeadline(deadline),
+	)
+	if err != nil {
+		t.Fatalf("failed to add item to queue: %v", err)
+	}
+	waitForMirror(t, queue, 1)
+
+	items, err := mirror.Get(10)
+	if err != nil || len(items) != 1 {
+		t.Fatalf("failed to get mirrored items: %+v, %v", items, err)
+	}
+	item := items[0]
+	if item.Priority != 5 || item.Tenant != "acme" || item.Type != "send" || item.Headers["trace"] != "abc" || !item.Deadline.Equal(deadline) {
+		t.Fatalf("expected the add options to be mirrored, got %+v", item)
+	}
+	if claimed, err := mirror.Claim(1); err != nil || len(claimed) != 0 {
+		t.Fatalf("expected the delayed item to stay hidden in the mirror, got %+v, %v", claimed, err)
+	}
+}
+
+func TestMirrorEncryption(t *testing.T) {
+	keyring, err := NewKeyring("k1", bytes.Repeat([]byte{1}, 32))
+	if err != nil {
+		t.Fatalf("failed to create keyring: %v", err)
+	}
+	secret := []byte("a secret payload")
+
+	// The copy waits in the outbox sealed under the key of the item.
+	pending := setupQueue(t, Config{Keyring: keyring, Mirror: failingQueuer{}})
+	defer pending.Close()
+	if err := pending.Add(secret); err != nil {
+		t.Fatalf("failed to add item to queue: %v", err)
+	}
+	var data []byte
+	var keyID string
+	if err := pending.db.QueryRow("SELECT `data`, `key_id` FROM "+pending.tables.mirror).Scan(&data, &keyID); err != nil {
+		t.Fatalf("failed to read the outbox row: %v", err)
+	}
+	if bytes.Contains(data, secret) || keyID != "k1" {
+		t.Fatalf("expected the outbox payload to be sealed under k1, got %q under %q", data, keyID)
+	}
+
+	// The mirror receives the opened payload.
+	mirror := setupQueue(t, Config{})
+	defer mirror.Close()
+	queue := setupQueue(t, Config{Keyring: keyring, Mirror: mirror})
+	defer queue.Close()
+	if err := queue.Add(secret); err != nil {
+		t.Fatalf("failed to add item to queue: %v", err)
+	}
+	waitForMirror(t, queue, 1)
+
+	items, err := mirror.Get(10)
+	if err != nil || len(items) != 1 || !bytes.Equal(items[0].Data, secret) {
+		t.Fatalf("expected the mirror to receive the plaintext, got %+v, %v", items, err)
+	}
+}
+
+// waitForMirror waits until the queue copied n items to its mirror.
+func waitForMirror(t *testing.T, queue *Queue, n int64) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		lag, err := queue.MirrorLag()
+		if err != nil {
+			t.Fatalf("failed to read mirror lag: %v", err)
+		}
+		if lag.Pending == 0 && lag.Copied == n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for the mirror, lag %+v", lag)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,198 @@
+package queue
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// blobSweepBatchSize is the number of released payloads deleted from
+// Config.Offload per round trip.
+const blobSweepBatchSize = 100
+
+// blobSweepInterval is how often payloads of removed items are deleted from
+// Config.Offload.
+const blobSweepInterval = 10 * time.Second
+
+// BlobStore keeps payloads offloaded from the queue rows; see Config.Offload.
+// Put must return only once the payload is durably stored, as the item
+// referencing it is committed right after.
+type BlobStore interface {
+	Put(ctx context.Context, key string, data []byte) error
+	Get(ctx context.Context, key string) ([]byte, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// DirStore is a BlobStore keeping every payload in a file of its own in a
+// directory, e.g. on a volume separate from the queue file.
+type DirStore struct {
+	dir string
+}
+
+// NewDirStore returns a DirStore writing to dir, creating it if needed.
+func NewDirStore(dir string) (*DirStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &DirStore{dir: dir}, nil
+}
+
+// Put writes the payload to a temporary file and renames it into place, so
+// readers never see a partial payload.
+func (s *DirStore) Put(ctx context.Context, key string, data []byte) error {
+	f, err := os.CreateTemp(s.dir, key+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name()) // Fails harmlessly once the file was renamed.
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), filepath.Join(s.dir, key))
+}
+
+// Get reads the payload stored under key.
+func (s *DirStore) Get(ctx context.Context, key string) ([]byte, error) {
+	return os.ReadFile(filepath.Join(s.dir, key))
+}
+
+// Delete removes the payload stored under key. Missing payloads are ignored.
+func (s *DirStore) Delete(ctx context.Context, key string) error {
+	err := os.Remove(filepath.Join(s.dir, key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// createBlobsTable adds the column referencing offloaded payloads and the
+// table collecting the payloads of removed items until they are deleted from
+// the store.
+func createBlobsTable(tx *sql.Tx, t tables) error {
+	if err := addColumn(tx, t.items, "blob", "TEXT"); err != nil {
+		return err
+	}
+
+	_, err := tx.Exec(`
+        CREATE TABLE IF NOT EXISTS ` + t.blobs + ` (
+            key TEXT PRIMARY KEY
+        );
+        CREATE TRIGGER IF NOT EXISTS ` + t.blobs + `_release AFTER DELETE ON ` + t.items + ` WHEN OLD.blob IS NOT NULL BEGIN
+            INSERT OR IGNORE INTO ` + t.blobs + `(key) VALUES (OLD.blob);
+        END;
+    `)
+	return err
+}
+
+// offload writes a payload to Config.Offload under a new key and returns the key.
+func (c *Queue) offload(data []byte) (string, error) {
+	var key [16]byte
+	rand.Read(key[:])
+
+	encoded := hex.EncodeToString(key[:])
+	if err := c.cfg.Offload.Put(c.ctx, encoded, data); err != nil {
+		return "", fmt.Errorf("queue: offloading payload: %w", err)
+	}
+	return encoded, nil
+}
+
+// discardPayload deletes an offloaded payload whose item was not inserted.
+func (c *Queue) discardPayload(p storedPayload) {
+	if p.blob == "" {
+		return
+	}
+	if err := c.cfg.Offload.Delete(c.ctx, p.blob); err != nil {
+		c.cfg.Logger.Println("Error deleting offloaded payload:", err)
+	}
+}
+
+// fetchBlob reads an offloaded payload from Config.Offload.
+func (c *Queue) fetchBlob(key string) ([]byte, error) {
+	if c.cfg.Offload == nil {
+		return nil, fmt.Errorf("queue: payload %s is offloaded but Config.Offload is not set", key)
+	}
+
+	data, err := c.cfg.Offload.Get(c.ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("queue: fetching offloaded payload %s: %w", key, err)
+	}
+	return data, nil
+}
+
+// runBlobSweeper deletes the payloads of removed items from Config.Offload
+// until the queue is closed.
+func (c *Queue) runBlobSweeper() {
+	ticker := c.cfg.Clock.NewTicker(blobSweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C():
+		}
+
+		for {
+			swept, err := c.sweepBlobs()
+			if err != nil {
+				if c.ctx.Err() == nil {
+					c.cfg.Logger.Println("Error deleting offloaded payloads:", err)
+				}
+				break
+			}
+			if swept < blobSweepBatchSize {
+				break // Every released payload is deleted.
+			}
+		}
+	}
+}
+
+// sweepBlobs deletes the next batch of released payloads from Config.Offload
+// and returns how many were deleted.
+func (c *Queue) sweepBlobs() (int, error) {
+	// Read the batch and close the rows before writing, as the pool may only
+	// have a single connection.
+	rows, err := c.db.QueryContext(c.ctx, "SELECT `key` FROM "+c.tables.blobs+" LIMIT ?", blobSweepBatchSize)
+	if err != nil {
+		return 0, err
+	}
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		keys = append(keys, key)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for i, key := range keys {
+		if err := c.cfg.Offload.Delete(c.ctx, key); err != nil {
+			return i, err
+		}
+		if _, err := c.db.ExecContext(c.ctx, "DELETE FROM "+c.tables.blobs+" WHERE key = ?", key); err != nil {
+			return i + 1, err
+		}
+	}
+	return len(keys), nil
+}
@@ -0,0 +1,47 @@
+package queue
+
+import (
+	"os"
+	"testing"
+)
+
+func TestOffloadLargePayloads(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewDirStore(dir)
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+
+	queue := setupQueue(t, Config{Offload: store, OffloadThreshold: 4})
+	defer queue.Close()
+
+	for _, data := range []string{"tiny", "a large payload"} {
+		if err := queue.Add([]byte(data)); err != nil {
+			t.Fatalf("failed to add item to queue: %v", err)
+		}
+	}
+
+	files, _ := os.ReadDir(dir)
+	if len(files) != 1 {
+		t.Fatalf("expected only the large payload to be offloaded, got %d files", len(files))
+	}
+	stats, err := queue.Stats()
+	if err != nil || stats.Bytes != 4 {
+		t.Fatalf("expected only the small payload to take room in the database, got %+v, %v", stats, err)
+	}
+
+	items, err := queue.Claim(2)
+	if err != nil || len(items) != 2 || string(items[1].Data) != "a large payload" {
+		t.Fatalf("expected the offloaded payload to be fetched, got %+v, %v", items, err)
+	}
+
+	if err := queue.Ack(items[1].ID); err != nil {
+		t.Fatalf("failed to acknowledge item: %v", err)
+	}
+	if n, err := queue.sweepBlobs(); err != nil || n != 1 {
+		t.Fatalf("expected one payload to be deleted, got %d, %v", n, err)
+	}
+	if files, _ := os.ReadDir(dir); len(files) != 0 {
+		t.Fatalf("expected the offloaded payload to be deleted, got %d files", len(files))
+	}
+}
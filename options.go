@@ -2,13 +2,105 @@ package queue
 
 import (
 	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 )
 
 // Config represents configuration options for setting up a Queue or database.
 type Config struct {
 	LocalFile string // The path to the local file or in-memory database identifier.
 	Reset     bool   // Flag to indicate whether the database should be reset.
+	Table     string // Name of the items table; auxiliary tables use it as their prefix.
+	Immutable bool   // OpenReadOnly reads the file without any locking, for files nobody writes to anymore, such as backups.
+
+	Debug          bool // Record before/after row snapshots for every item state transition.
+	DebugRetention int  // Maximum number of snapshots kept in the debug table.
+
+	ChangeFeed bool // Record every item state transition in the change feed; see Queue.Events.
+
+	History          bool          // Keep a copy of every processed item, so it can be added again with Queue.Replay.
+	HistoryRetention time.Duration // How long processed items stay in the history; 0 keeps them until HistoryMaxItems is reached.
+	HistoryMaxItems  int           // Most processed items kept in the history, oldest dropped first; 0 means unlimited.
+
+	ResultTTL time.Duration // How long results stored with SetResult or AckResult are kept.
+
+	MaxItems int   // Maximum number of queued items; 0 means unlimited.
+	MaxBytes int64 // Maximum total size of queued payloads in bytes; 0 means unlimited.
+
+	Overflow OverflowPolicy // What Add does when MaxItems or MaxBytes would be exceeded.
+	Delivery DeliveryMode   // AtLeastOnce, the default, or AtMostOnce; see DeliveryMode for the trade-off.
+
+	DeadLetterExpired bool // Move items whose deadline passed to the dead letters, with the failure "expired", instead of deleting them; see AddBefore.
+
+	Tenants        map[string]TenantLimits // Limits of the tenants named with AddForTenant, by tenant ID.
+	TenantDefaults TenantLimits            // Limits of the tenants missing from Tenants.
+
+	MaxPayloadSize int // Largest accepted payload in bytes; 0 means unlimited.
+	ChunkSize      int // Payloads larger than this are split across rows; 0 disables chunking.
+
+	// Offload receives payloads larger than OffloadThreshold bytes, and only
+	// a reference is kept in the database, so the file stays small and
+	// checkpoints stay short. Offloaded payloads do not count toward MaxBytes
+	// and Stats.Bytes. A payload whose add is rolled back after it was
+	// written may be left behind in the store. nil keeps every payload in
+	// the database.
+	Offload          BlobStore
+	OffloadThreshold int // Payloads up to this size stay in the database when Offload is set.
+
+	LeaseTimeout time.Duration // How long a claimed item stays reserved before another consumer may take it over.
+	MaxAttempts  int           // Deliveries before an item moves to the dead letters; 0 means unlimited.
+
+	PoisonThreshold int // Listener panics or lease timeouts before an item is quarantined; 0 disables quarantine.
+
+	BatchRetryDelay time.Duration // How long the batch listener waits before failed items are delivered again; ignored if RetryPolicy is set.
+	RetryPolicy     RetryPolicy   // Decides when failed deliveries are retried; nil uses DefaultRetryPolicy. See Queue.Retry.
+
+	JournalMode string        // SQLite journal_mode, e.g. "WAL"; empty keeps the driver default.
+	Synchronous string        // SQLite synchronous level, e.g. "NORMAL"; empty keeps the driver default.
+	BusyTimeout time.Duration // How long a connection waits on a locked database; 0 keeps the driver default.
+	CacheSize   int           // SQLite cache_size (pages, or KiB if negative); 0 keeps the driver default.
+	ForeignKeys bool          // Enable foreign key enforcement.
+	AutoVacuum  string        // SQLite auto_vacuum mode for new databases, e.g. "INCREMENTAL"; empty keeps the driver default.
+
+	MaxOpenConns    int           // Maximum open connections; 0 picks 1 outside WAL mode, negative means unlimited.
+	MaxIdleConns    int           // Maximum idle connections; 0 keeps the database/sql default.
+	ConnMaxLifetime time.Duration // Maximum connection lifetime; 0 keeps connections forever.
+
+	DisableAutoIndex bool // Skip creating and migrating indexes on open; see Queue.CreateIndexes.
+
+	IntegrityCheck IntegrityCheck // Check the database file on open; off by default, as a full check reads the whole file.
+	Salvage        bool           // Recover the readable rows of a file failing IntegrityCheck into a fresh one; see Queue.Recovery.
+
+	MaintenanceInterval time.Duration // How often background maintenance runs; 0 disables it.
+	CompactFreePages    int64         // Free pages that trigger compaction even while busy; 0 compacts only when idle.
+
+	MaxBacklog   int           // Pending items above which Health reports the queue unhealthy; 0 disables the check.
+	StallTimeout time.Duration // How long the listener loops may go without a heartbeat before Health reports them stalled; 0 means LeaseTimeout.
+
+	Hooks   Hooks   // Callbacks fired as items are enqueued, fail, or are dead-lettered.
+	Metrics Metrics // Receives counters, gauges and histograms of the queue; nil discards them. See queueprom and queueotel.
+
+	Workers        int    // Goroutines delivering items to the listeners at once; 0 means 1.
+	ManualStart    bool   // New does not start the workers; call Start once the listeners are registered.
+	MaxInFlight    int    // Callbacks of listeners, subscribers and group consumers running at once, across all workers and, with a Manager, all of its queues; 0 means unlimited.
+	ClaimBatchSize int    // Items the workers claim per database round trip and then take from memory; 0 or 1 claims one at a time.
+	Logger         Logger // Receives the errors of the background loops; nil prints them to stdout.
+	Clock          Clock  // Source of time for timestamps, leases, delays and polling; nil uses the system clock. See FakeClock.
+	Tracer         Tracer // Carries trace or correlation IDs from the producers to Item.Context; nil uses ContextWithTraceID. See queueotel.
+
+	GroupCommitSize     int           // Adds from concurrent producers committed in one transaction; 0 or 1 commits every Add on its own. See Queue.Add.
+	GroupCommitInterval time.Duration // How long a group waits for more Adds before it is committed; 0 commits the Adds that queued up meanwhile right away.
+
+	Audit bool   // Record who added, deleted, requeued or edited items in the audit log; see Admin.AuditLog.
+	Actor string // Recorded in the audit log for operations of this instance; defaults to its owner ID.
+
+	Keyring   *Keyring  // Encrypts payloads at rest; nil stores them in clear. See RotateKey.
+	Validator Validator // Checks every payload added or published; nil accepts any. See JSONSchema and SetValidator.
+
+	Mirror Queuer // Secondary queue receiving a copy of every added item for warm standby, with its add options if it is a *Queue; removals are not mirrored. nil disables mirroring.
 }
 
 var (
@@ -30,8 +122,19 @@ func getNextLocalFile() string {
 // It assigns a unique in-memory LocalFile and sets the default Reset flag.
 func configDefault(config ...Config) Config {
 	var defaultValue = Config{
-		LocalFile: getNextLocalFile(), // Set a default LocalFile to a new unique in-memory database.
-		Reset:     false,              // Default Reset flag is false.
+		LocalFile:       getNextLocalFile(), // Set a default LocalFile to a new unique in-memory database.
+		Reset:           false,              // Default Reset flag is false.
+		Table:           "queue",            // Default table name.
+		DebugRetention:  1000,               // Keep the last 1000 snapshots by default.
+		MaxOpenConns:    1,                  // A single connection outside WAL mode.
+		LeaseTimeout:    5 * time.Minute,    // Reclaim items of crashed consumers after five minutes.
+		ResultTTL:       24 * time.Hour,     // Keep results for a day.
+		BatchRetryDelay: time.Second,        // Retry failed batch items after a second.
+		Workers:         1,                  // Deliver one item at a time.
+		Logger:          stdoutLogger{},     // Print errors to stdout.
+		Clock:           systemClock{},      // Tell the real time.
+		Tracer:          contextTracer{},    // Carry IDs set with ContextWithTraceID.
+		Metrics:         NopMetrics{},       // Discard metrics.
 	}
 
 	// Return default configuration if no custom config is provided.
@@ -46,5 +149,272 @@ func configDefault(config ...Config) Config {
 		cfg.LocalFile = defaultValue.LocalFile
 	}
 
+	// Apply default Table if it's not specified in the provided config.
+	if cfg.Table == "" {
+		cfg.Table = defaultValue.Table
+	}
+
+	// Apply default LeaseTimeout if it's not specified in the provided config.
+	if cfg.LeaseTimeout <= 0 {
+		cfg.LeaseTimeout = defaultValue.LeaseTimeout
+	}
+
+	// Apply default ResultTTL if it's not specified in the provided config.
+	if cfg.ResultTTL <= 0 {
+		cfg.ResultTTL = defaultValue.ResultTTL
+	}
+
+	// A listener loop handling an item longer than its lease is in trouble anyway.
+	if cfg.StallTimeout <= 0 {
+		cfg.StallTimeout = cfg.LeaseTimeout
+	}
+
+	// Apply default BatchRetryDelay if it's not specified in the provided config.
+	if cfg.BatchRetryDelay <= 0 {
+		cfg.BatchRetryDelay = defaultValue.BatchRetryDelay
+	}
+
+	// Apply default DebugRetention if it's not specified in the provided config.
+	if cfg.DebugRetention <= 0 {
+		cfg.DebugRetention = defaultValue.DebugRetention
+	}
+
+	// Apply default Workers if it's not specified in the provided config.
+	if cfg.Workers <= 0 {
+		cfg.Workers = defaultValue.Workers
+	}
+
+	// Apply default Logger if it's not specified in the provided config.
+	if cfg.Logger == nil {
+		cfg.Logger = defaultValue.Logger
+	}
+
+	// Apply default Clock if it's not specified in the provided config.
+	if cfg.Clock == nil {
+		cfg.Clock = defaultValue.Clock
+	}
+
+	// Apply default Tracer if it's not specified in the provided config.
+	if cfg.Tracer == nil {
+		cfg.Tracer = defaultValue.Tracer
+	}
+
+	// Apply default Metrics if it's not specified in the provided config.
+	if cfg.Metrics == nil {
+		cfg.Metrics = defaultValue.Metrics
+	}
+
+	// SQLite allows a single writer outside WAL mode, so extra connections only add lock contention.
+	if cfg.MaxOpenConns == 0 && !strings.EqualFold(cfg.JournalMode, "WAL") {
+		cfg.MaxOpenConns = 1
+	}
+
 	return cfg
 }
+
+// dataSourceName builds the driver DSN for the configuration, passing the PRAGMA
+// settings as connection parameters so every pooled connection applies them.
+func dataSourceName(cfg Config) string {
+	params := url.Values{}
+	if cfg.JournalMode != "" {
+		params.Set("_journal_mode", cfg.JournalMode)
+	}
+	if cfg.Synchronous != "" {
+		params.Set("_synchronous", cfg.Synchronous)
+	}
+	if cfg.BusyTimeout > 0 {
+		params.Set("_busy_timeout", strconv.FormatInt(cfg.BusyTimeout.Milliseconds(), 10))
+	}
+	if cfg.CacheSize != 0 {
+		params.Set("_cache_size", strconv.Itoa(cfg.CacheSize))
+	}
+	if cfg.ForeignKeys {
+		params.Set("_foreign_keys", "1")
+	}
+	if cfg.AutoVacuum != "" {
+		params.Set("_auto_vacuum", strings.ToLower(cfg.AutoVacuum))
+	}
+
+	if len(params) == 0 {
+		return cfg.LocalFile
+	}
+
+	// Append to existing parameters, such as those of in-memory URIs.
+	separator := "?"
+	if strings.Contains(cfg.LocalFile, "?") {
+		separator = "&"
+	}
+	return cfg.LocalFile + separator + params.Encode()
+}
+
+// Logger receives the errors the background loops cannot return to a caller.
+// *log.Logger satisfies it.
+type Logger interface {
+	Println(v ...any)
+}
+
+// stdoutLogger prints to stdout, as the queue did before Config.Logger.
+type stdoutLogger struct{}
+
+func (stdoutLogger) Println(v ...any) {
+	fmt.Println(v...)
+}
+
+// Logger returns the logger of the queue, which prints to Config.Logger and
+// reports the last error in DebugInfo.
+func (c *Queue) Logger() Logger {
+	return c.errLog
+}
+
+// LoggerOf returns the logger of q if it has one, such as a *Queue, and the
+// default printing to stdout otherwise, for packages wrapping any Queuer.
+func LoggerOf(q any) Logger {
+	if q, ok := q.(interface{ Logger() Logger }); ok {
+		if logger := q.Logger(); logger != nil {
+			return logger
+		}
+	}
+	return stdoutLogger{}
+}
+
+// Option configures a queue or manager in New, NewWithDB and NewManager. A
+// Config is itself an Option replacing every setting made by the options
+// before it, so both styles can be mixed:
+//
+//	q, err := queue.New(queue.WithFile("jobs.db"), queue.WithWorkers(4))
+//	q, err := queue.New(queue.Config{LocalFile: "jobs.db"}, queue.WithLogger(logger))
+//
+// Settings without an option of their own are reached through WithConfig.
+type Option interface {
+	apply(cfg *Config)
+}
+
+// apply replaces the whole configuration with c.
+func (c Config) apply(cfg *Config) {
+	*cfg = c
+}
+
+// optionFunc adapts a function to the Option interface.
+type optionFunc func(cfg *Config)
+
+func (f optionFunc) apply(cfg *Config) {
+	f(cfg)
+}
+
+// newConfig applies the options in order, validates the result and fills in
+// the defaults.
+func newConfig(options []Option) (Config, error) {
+	var cfg Config
+	for _, option := range options {
+		option.apply(&cfg)
+	}
+	if err := validateConfig(cfg); err != nil {
+		return Config{}, err
+	}
+	return configDefault(cfg), nil
+}
+
+// WithConfig edits the settings made so far, e.g. to set a field of Config
+// that has no option of its own.
+func WithConfig(edit func(cfg *Config)) Option {
+	return optionFunc(edit)
+}
+
+// WithFile stores the queue in the SQLite file at path; see Config.LocalFile.
+func WithFile(path string) Option {
+	return optionFunc(func(cfg *Config) { cfg.LocalFile = path })
+}
+
+// WithReset deletes the database file before opening it; see Config.Reset.
+func WithReset() Option {
+	return optionFunc(func(cfg *Config) { cfg.Reset = true })
+}
+
+// WithTable names the items table; see Config.Table.
+func WithTable(name string) Option {
+	return optionFunc(func(cfg *Config) { cfg.Table = name })
+}
+
+// WithWorkers delivers up to n items to the listeners at once; see Config.Workers.
+func WithWorkers(n int) Option {
+	return optionFunc(func(cfg *Config) { cfg.Workers = n })
+}
+
+// WithLogger sends the errors of the background loops to l; see Config.Logger.
+func WithLogger(l Logger) Option {
+	return optionFunc(func(cfg *Config) { cfg.Logger = l })
+}
+
+// WithMetrics reports the metrics of the queue to m; see Config.Metrics.
+func WithMetrics(m Metrics) Option {
+	return optionFunc(func(cfg *Config) { cfg.Metrics = m })
+}
+
+// WithClock makes the queue tell time with clock, e.g. a *FakeClock in tests; see Config.Clock.
+func WithClock(clock Clock) Option {
+	return optionFunc(func(cfg *Config) { cfg.Clock = clock })
+}
+
+// WithHooks sets the callbacks fired as items move through the queue; see Config.Hooks.
+func WithHooks(hooks Hooks) Option {
+	return optionFunc(func(cfg *Config) { cfg.Hooks = hooks })
+}
+
+// WithDelivery selects the delivery guarantee; see Config.Delivery.
+func WithDelivery(mode DeliveryMode) Option {
+	return optionFunc(func(cfg *Config) { cfg.Delivery = mode })
+}
+
+// WithLeaseTimeout sets how long a claimed item stays reserved; see Config.LeaseTimeout.
+func WithLeaseTimeout(d time.Duration) Option {
+	return optionFunc(func(cfg *Config) { cfg.LeaseTimeout = d })
+}
+
+// WithMaxAttempts dead-letters items after n deliveries; see Config.MaxAttempts.
+func WithMaxAttempts(n int) Option {
+	return optionFunc(func(cfg *Config) { cfg.MaxAttempts = n })
+}
+
+// WithRetryPolicy sets how failed deliveries are retried; see Config.RetryPolicy.
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return optionFunc(func(cfg *Config) { cfg.RetryPolicy = policy })
+}
+
+// WithLimits bounds the queue to maxItems items and maxBytes bytes of
+// payloads, applying policy when they are reached; see Config.MaxItems.
+func WithLimits(maxItems int, maxBytes int64, policy OverflowPolicy) Option {
+	return optionFunc(func(cfg *Config) {
+		cfg.MaxItems, cfg.MaxBytes, cfg.Overflow = maxItems, maxBytes, policy
+	})
+}
+
+// WithJournalMode sets the SQLite journal mode, e.g. "WAL"; see Config.JournalMode.
+func WithJournalMode(mode string) Option {
+	return optionFunc(func(cfg *Config) { cfg.JournalMode = mode })
+}
+
+// WithBusyTimeout sets how long a connection waits on a locked database; see Config.BusyTimeout.
+func WithBusyTimeout(d time.Duration) Option {
+	return optionFunc(func(cfg *Config) { cfg.BusyTimeout = d })
+}
+
+// WithDebug records transition snapshots; see Config.Debug.
+func WithDebug() Option {
+	return optionFunc(func(cfg *Config) { cfg.Debug = true })
+}
+
+// WithAudit records operations in the audit log under actor; see Config.Audit.
+func WithAudit(actor string) Option {
+	return optionFunc(func(cfg *Config) { cfg.Audit, cfg.Actor = true, actor })
+}
+
+// WithGroupCommit commits up to size concurrent Adds in one transaction,
+// waiting up to interval for a group to fill; see Config.GroupCommitSize.
+func WithGroupCommit(size int, interval time.Duration) Option {
+	return optionFunc(func(cfg *Config) { cfg.GroupCommitSize, cfg.GroupCommitInterval = size, interval })
+}
+
+// WithMaintenance runs background maintenance every interval; see Config.MaintenanceInterval.
+func WithMaintenance(interval time.Duration) Option {
+	return optionFunc(func(cfg *Config) { cfg.MaintenanceInterval = interval })
+}
@@ -0,0 +1,185 @@
+package queue
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPragmaConfig(t *testing.T) {
+	queue := setupQueue(t, Config{
+		LocalFile:   filepath.Join(t.TempDir(), "queue.db"),
+		JournalMode: "WAL",
+		Synchronous: "NORMAL",
+		BusyTimeout: 3 * time.Second,
+		CacheSize:   -4000,
+		ForeignKeys: true,
+	})
+	defer queue.Close()
+
+	pragmas := map[string]int64{"synchronous": 1, "busy_timeout": 3000, "cache_size": -4000, "foreign_keys": 1}
+	for pragma, expected := range pragmas {
+		var value int64
+		if err := queue.db.QueryRow("PRAGMA " + pragma).Scan(&value); err != nil {
+			t.Fatalf("failed to read %s: %v", pragma, err)
+		}
+		if value != expected {
+			t.Errorf("expected %s = %d, got %d", pragma, expected, value)
+		}
+	}
+
+	var mode string
+	if err := queue.db.QueryRow("PRAGMA journal_mode").Scan(&mode); err != nil {
+		t.Fatalf("failed to read journal_mode: %v", err)
+	}
+	if mode != "wal" {
+		t.Errorf("expected journal_mode wal, got %s", mode)
+	}
+}
+
+func TestPoolDefaults(t *testing.T) {
+	if cfg := configDefault(Config{}); cfg.MaxOpenConns != 1 {
+		t.Errorf("expected 1 open connection outside WAL mode, got %d", cfg.MaxOpenConns)
+	}
+	if cfg := configDefault(Config{JournalMode: "wal"}); cfg.MaxOpenConns != 0 {
+		t.Errorf("expected unlimited open connections in WAL mode, got %d", cfg.MaxOpenConns)
+	}
+	if cfg := configDefault(Config{MaxOpenConns: 4}); cfg.MaxOpenConns != 4 {
+		t.Errorf("expected explicit MaxOpenConns to be kept, got %d", cfg.MaxOpenConns)
+	}
+
+	queue := setupQueue(t, Config{MaxOpenConns: 3, MaxIdleConns: 2})
+	defer queue.Close()
+
+	if stats := queue.db.Stats(); stats.MaxOpenConnections != 3 {
+		t.Errorf("expected pool limit 3, got %d", stats.MaxOpenConnections)
+	}
+}
+
+// recordingLogger collects the lines logged by the queue.
+type recordingLogger struct {
+	mx    sync.Mutex
+	lines []string
+}
+
+func (l *recordingLogger) Println(v ...any) {
+	l.mx.Lock()
+	defer l.mx.Unlock()
+	l.lines = append(l.lines, fmt.Sprintln(v...))
+}
+
+func TestFunctionalOptions(t *testing.T) {
+	logger := &recordingLogger{}
+	queue, err := New(
+		Config{MaxAttempts: 7, Workers: 2},
+		WithFile(filepath.Join(t.TempDir(), "queue.db")),
+		WithTable("jobs"),
+		WithWorkers(4),
+		WithLogger(logger),
+	)
+	if err != nil {
+		t.Fatalf("failed to initialize queue: %v", err)
+	}
+
+	cfg := queue.cfg
+	if cfg.Table != "jobs" || cfg.Workers != 4 || cfg.MaxAttempts != 7 || queue.errLog.Logger != logger || cfg.LeaseTimeout != 5*time.Minute {
+		t.Fatalf("unexpected configuration: %+v", cfg)
+	}
+
+	queue.Close()
+	time.Sleep(50 * time.Millisecond)
+	logger.mx.Lock()
+	defer logger.mx.Unlock()
+	if len(logger.lines) != 4 {
+		t.Fatalf("expected every worker to log its shutdown, got %q", logger.lines)
+	}
+}
+
+func TestWorkers(t *testing.T) {
+	queue := setupQueue(t, Config{Workers: 3})
+	defer queue.Close()
+
+	for i := 0; i < 3; i++ {
+		if err := queue.Add([]byte("test data")); err != nil {
+			t.Fatalf("failed to add item to queue: %v", err)
+		}
+	}
+
+	// Every item blocks its worker until all three are being handled at once.
+	var wg sync.WaitGroup
+	wg.Add(3)
+	done := make(chan struct{})
+	queue.Listener(func(item Item, delay func(sec time.Duration)) {
+		wg.Done()
+		<-done
+	})
+
+	waited := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(waited)
+	}()
+	select {
+	case <-waited:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected three items to be handled concurrently")
+	}
+	close(done)
+}
+
+func TestMaxInFlight(t *testing.T) {
+	queue := setupQueue(t, Config{Workers: 4, MaxInFlight: 2})
+	defer queue.Close()
+
+	for i := 0; i < 6; i++ {
+		if err := queue.Add([]byte("test data")); err != nil {
+			t.Fatalf("failed to add item to queue: %v", err)
+		}
+	}
+
+	// Listeners and subscribers share the slots.
+	var mx sync.Mutex
+	running, peak, handled := 0, 0, 0
+	enter := func() {
+		mx.Lock()
+		running++
+		peak = max(peak, running)
+		mx.Unlock()
+
+		time.Sleep(20 * time.Millisecond)
+
+		mx.Lock()
+		running--
+		handled++
+		mx.Unlock()
+	}
+	queue.Listener(func(item Item, delay func(sec time.Duration)) { enter() })
+	if err := queue.Subscribe("audit", func(msg Message) error { enter(); return nil }); err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+	if _, err := queue.Publish([]byte("message")); err != nil {
+		t.Fatalf("failed to publish message: %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		mx.Lock()
+		done := handled == 7
+		mx.Unlock()
+		if done {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected every item and message to be handled")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	mx.Lock()
+	defer mx.Unlock()
+	if peak != 2 {
+		t.Fatalf("expected at most 2 callbacks at once, saw %d", peak)
+	}
+}
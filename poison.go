@@ -0,0 +1,191 @@
+package queue
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"time"
+)
+
+// QuarantinedItem is an item set aside after crashing or timing out its
+// listener Config.PoisonThreshold times, or because its payload is corrupted.
+type QuarantinedItem struct {
+	Item
+	Crashes int    // Number of panics and lease timeouts recorded.
+	Failure string // Last panic value with its stack trace, the lease timeout, or the checksum mismatch.
+}
+
+// Quarantined returns up to 'limit' quarantined items, oldest first.
+func (c *Queue) Quarantined(limit int) ([]QuarantinedItem, error) {
+	rows, err := c.db.QueryContext(
+		c.ctx,
+		"SELECT "+itemColumns+", `crashes`, `failure` FROM "+c.tables.items+" WHERE state = 'quarantined' ORDER BY id LIMIT ?",
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close() // Ensure rows are closed after processing.
+
+	var items []QuarantinedItem
+	for rows.Next() {
+		var q QuarantinedItem
+		var tags, blob, tenant, headers, keyID, jobType, failure sql.NullString
+		var expiresAt sql.NullInt64
+		if err := rows.Scan(&q.ID, &q.Data, &tags, &q.State, &q.Attempts, &q.Priority, &q.chunks, &blob, &q.Streamed, &q.checksum, &tenant, &q.Version, &expiresAt, &headers, &keyID, &jobType, &q.Crashes, &failure); err != nil {
+			return nil, err
+		}
+		q.Type = jobType.String
+		q.keyID = keyID.String
+		if q.Headers, err = decodeHeaders(headers.String); err != nil {
+			return nil, err
+		}
+		if expiresAt.Valid {
+			q.Deadline = time.Unix(0, expiresAt.Int64)
+		}
+		q.blob = blob.String
+		q.Tenant = tenant.String
+		if q.Tags, err = decodeTags(tags.String); err != nil {
+			return nil, err
+		}
+		q.Failure = failure.String
+		items = append(items, q)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close() // Release the connection before loading the payloads.
+
+	for i := range items {
+		if items[i].Streamed {
+			continue // Read with OpenPayload instead.
+		}
+		// Corrupted payloads are returned as read for the operator to inspect.
+		if err := c.loadPayload(c.db, &items[i].Item); err != nil && !errors.Is(err, ErrCorrupted) {
+			return nil, err
+		}
+	}
+	return items, nil
+}
+
+// Unquarantine moves a quarantined item back to pending with its crash count
+// reset, e.g. once the listener bug it triggered is fixed. It returns
+// ErrItemNotFound if there is no quarantined item with the given ID.
+func (c *Queue) Unquarantine(id int) error {
+	err := c.updateItem(
+		id, c.actor(), TransitionUnquarantined,
+		"UPDATE "+c.tables.items+" SET state = 'pending', crashes = 0, failure = NULL WHERE id = ? AND state = 'quarantined'",
+		id,
+	)
+	if err != nil {
+		return err
+	}
+
+	c.mx.Lock()
+	c.signalAdded()
+	c.mx.Unlock()
+	return nil
+}
+
+// abandon hands back an item whose listener panicked with r, counting the
+// crash when quarantine is enabled.
+func (c *Queue) abandon(item Item, r any) {
+	if c.cfg.Delivery == AtMostOnce {
+		return // The item was removed when it was claimed.
+	}
+	if c.cfg.PoisonThreshold <= 0 {
+		c.release(item)
+		return
+	}
+	if err := c.crashed(item, fmt.Sprintf("panic: %v\n\n%s", r, debug.Stack())); err != nil {
+		c.cfg.Logger.Println("Error recording crash:", err)
+	}
+}
+
+// crashed records that the listener panicked on the delivery of an item
+// claimed by this instance and either quarantines the item or hands it back
+// for another try.
+func (c *Queue) crashed(item Item, failure string) error {
+	c.mx.Lock() // Lock for exclusive access to the queue.
+	defer c.mx.Unlock()
+
+	id, nonce := item.ID, deliveryNonce(item)
+	err := c.withTx(func(tx *sql.Tx) error {
+		updated, quarantined, err := c.recordCrash(tx, id, failure, "owner = ? AND state = 'in-flight' AND (? IS NULL OR receipt = ?)", c.owner, nonce, nonce)
+		if err != nil || !updated || quarantined {
+			return err
+		}
+
+		before, err := c.rowSnapshot(tx, id)
+		if err != nil {
+			return err
+		}
+		if _, err := c.execTransition(tx, id, TransitionReleased, c.stmts.release, id, c.owner, nonce); err != nil {
+			return err
+		}
+		return c.snapshot(tx, id, TransitionReleased, before)
+	})
+	if err == nil {
+		c.signalAdded()
+	}
+	return err
+}
+
+// timedOut records that the lease of an item expired before it was
+// acknowledged, e.g. because the listener hung or the process died on it. It
+// reports whether the item was quarantined and must not be claimed again.
+// It must be called with the queue locked.
+func (c *Queue) timedOut(id int, now int64) (bool, error) {
+	quarantined := false
+	err := c.withTx(func(tx *sql.Tx) error {
+		var err error
+		failure := fmt.Sprintf("lease expired after %s", c.cfg.LeaseTimeout)
+		_, quarantined, err = c.recordCrash(tx, id, failure, "state = 'in-flight' AND lease_until < ?", now)
+		return err
+	})
+	return quarantined, err
+}
+
+// recordCrash counts a crash of an item matching cond, stores the failure and
+// quarantines the item once it reached Config.PoisonThreshold crashes. It
+// reports whether the item matched and whether it was quarantined.
+func (c *Queue) recordCrash(tx *sql.Tx, id int, failure, cond string, args ...any) (updated, quarantined bool, err error) {
+	before, err := c.rowSnapshot(tx, id)
+	if err != nil {
+		return false, false, err
+	}
+
+	res, err := tx.Exec(
+		"UPDATE "+c.tables.items+" SET crashes = crashes + 1, failure = ? WHERE id = ? AND "+cond,
+		append([]any{failure, id}, args...)...,
+	)
+	if err != nil {
+		return false, false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil || n == 0 {
+		return false, false, err // Another consumer took the item over.
+	}
+
+	var crashes int
+	if err := tx.QueryRow("SELECT `crashes` FROM "+c.tables.items+" WHERE id = ?", id).Scan(&crashes); err != nil {
+		return false, false, err
+	}
+	if crashes < c.cfg.PoisonThreshold {
+		return true, false, nil
+	}
+
+	from, err := c.itemState(tx, id)
+	if err != nil {
+		return false, false, err
+	}
+	_, err = tx.Exec("UPDATE "+c.tables.items+" SET state = 'quarantined', owner = NULL, lease_until = NULL WHERE id = ?", id)
+	if err != nil {
+		return false, false, err
+	}
+	if err := c.enforceTransition(tx, id, TransitionQuarantined, from); err != nil {
+		return false, false, err
+	}
+	return true, true, c.snapshot(tx, id, TransitionQuarantined, before)
+}
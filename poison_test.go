@@ -0,0 +1,87 @@
+package queue
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestQuarantinePanics(t *testing.T) {
+	queue := setupQueue(t, Config{PoisonThreshold: 2})
+	defer queue.Close()
+
+	for _, data := range []string{"bad", "good"} {
+		if err := queue.Add([]byte(data)); err != nil {
+			t.Fatalf("failed to add item to queue: %v", err)
+		}
+	}
+
+	processed := make(chan string, 10)
+	queue.Listener(func(item Item, delay func(sec time.Duration)) {
+		if string(item.Data) == "bad" {
+			panic("boom")
+		}
+		processed <- string(item.Data)
+	})
+
+	select {
+	case data := <-processed:
+		if data != "good" {
+			t.Fatalf("unexpected item %q", data)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatalf("the poison item wedged processing")
+	}
+
+	quarantined, err := queue.Quarantined(10)
+	if err != nil || len(quarantined) != 1 {
+		t.Fatalf("expected one quarantined item, got %+v, %v", quarantined, err)
+	}
+	q := quarantined[0]
+	if string(q.Data) != "bad" || q.Crashes != 2 || q.State != StateQuarantined {
+		t.Fatalf("unexpected quarantined item %+v", q)
+	}
+	if !strings.Contains(q.Failure, "panic: boom") || !strings.Contains(q.Failure, "poison_test.go") {
+		t.Fatalf("expected the panic and its stack to be stored, got %q", q.Failure)
+	}
+}
+
+func TestQuarantineTimeouts(t *testing.T) {
+	queue := setupQueue(t, Config{PoisonThreshold: 2, LeaseTimeout: time.Millisecond})
+	defer queue.Close()
+
+	if err := queue.Add([]byte("slow")); err != nil {
+		t.Fatalf("failed to add item to queue: %v", err)
+	}
+
+	// Let the lease expire twice; the second expiry reaches the threshold.
+	for i := 0; i < 2; i++ {
+		if items, err := queue.Claim(1); err != nil || len(items) != 1 {
+			t.Fatalf("failed to claim item: %+v, %v", items, err)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if items, err := queue.Claim(1); err != nil || len(items) != 0 {
+		t.Fatalf("expected the item to be quarantined, got %+v, %v", items, err)
+	}
+
+	stats, err := queue.Stats()
+	if err != nil || stats.Quarantined != 1 {
+		t.Fatalf("expected one quarantined item, got %+v, %v", stats, err)
+	}
+	quarantined, _ := queue.Quarantined(10)
+	if len(quarantined) != 1 || !strings.Contains(quarantined[0].Failure, "lease expired") {
+		t.Fatalf("unexpected quarantined items %+v", quarantined)
+	}
+
+	if err := queue.Unquarantine(quarantined[0].ID); err != nil {
+		t.Fatalf("failed to unquarantine item: %v", err)
+	}
+	if err := queue.Unquarantine(quarantined[0].ID); !errors.Is(err, ErrItemNotFound) {
+		t.Fatalf("expected ErrItemNotFound, got %v", err)
+	}
+	if items, err := queue.Claim(1); err != nil || len(items) != 1 {
+		t.Fatalf("expected the released item to be claimable, got %+v, %v", items, err)
+	}
+}
@@ -0,0 +1,103 @@
+package queue
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Progress is the latest progress reported for an in-flight item.
+type Progress struct {
+	ItemID    int       `json:"item_id"`    // Identifier of the item.
+	Percent   int       `json:"percent"`    // Completion between 0 and 100.
+	Message   string    `json:"message"`    // What the handler is doing, e.g. "resizing image 3 of 10".
+	UpdatedAt time.Time `json:"updated_at"` // When the progress was reported.
+}
+
+// progressColumns lists the columns scanned by scanProgress, in order.
+const progressColumns = "`id`, `progress`, `progress_message`, `progress_at`"
+
+// SetProgress records how far the processing of an item claimed by this
+// queue instance has come, so long jobs can be followed with Progress and
+// Admin.InProgress. Percent is clamped to 0..100. Unlike SetResult it is
+// written immediately, and it is cleared when the item is claimed again.
+// It returns ErrItemNotFound if the item is not held by this instance.
+func (c *Queue) SetProgress(id, percent int, message string) error {
+	percent = min(max(percent, 0), 100)
+
+	c.mx.Lock() // Lock for exclusive access to the queue.
+	defer c.mx.Unlock()
+
+	res, err := c.db.ExecContext(
+		c.ctx,
+		"UPDATE "+c.tables.items+" SET progress = ?, progress_message = ?, progress_at = ? WHERE id = ? AND owner = ? AND state = 'in-flight'",
+		percent, message, c.cfg.Clock.Now().UnixNano(), id, c.owner,
+	)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrItemNotFound
+	}
+	return nil
+}
+
+// Progress returns the latest progress reported for an item. It returns
+// ErrItemNotFound if the item does not exist or has not reported progress
+// since it was last claimed.
+func (c *Queue) Progress(id int) (Progress, error) {
+	row := c.db.QueryRowContext(
+		c.ctx,
+		"SELECT "+progressColumns+" FROM "+c.tables.items+" WHERE id = ? AND progress IS NOT NULL",
+		id,
+	)
+
+	p, err := scanProgress(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Progress{}, ErrItemNotFound
+	}
+	return p, err
+}
+
+// InProgress returns the progress of up to 'limit' in-flight items that
+// reported any, most recently updated first.
+func (a *Admin) InProgress(limit int) ([]Progress, error) {
+	c := a.c
+	rows, err := c.db.QueryContext(
+		c.ctx,
+		"SELECT "+progressColumns+" FROM "+c.tables.items+" WHERE state = 'in-flight' AND progress IS NOT NULL ORDER BY progress_at DESC LIMIT ?",
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close() // Ensure rows are closed after processing.
+
+	var list []Progress
+	for rows.Next() {
+		p, err := scanProgress(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, p)
+	}
+	return list, rows.Err()
+}
+
+// scanProgress reads a row selected with progressColumns.
+func scanProgress(row interface{ Scan(dest ...any) error }) (Progress, error) {
+	var p Progress
+	var message sql.NullString
+	var at int64
+	if err := row.Scan(&p.ItemID, &p.Percent, &message, &at); err != nil {
+		return Progress{}, err
+	}
+	p.Message = message.String
+	p.UpdatedAt = time.Unix(0, at)
+	return p, nil
+}
@@ -0,0 +1,51 @@
+package queue
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestProgress(t *testing.T) {
+	queue := setupQueue(t, Config{LeaseTimeout: time.Millisecond})
+	defer queue.Close()
+
+	if err := queue.Add([]byte("long job")); err != nil {
+		t.Fatalf("failed to add item to queue: %v", err)
+	}
+	items, err := queue.Claim(1)
+	if err != nil || len(items) != 1 {
+		t.Fatalf("failed to claim item: %v", err)
+	}
+	id := items[0].ID
+
+	if _, err := queue.Progress(id); !errors.Is(err, ErrItemNotFound) {
+		t.Fatalf("expected no progress before reporting, got %v", err)
+	}
+
+	if err := queue.SetProgress(id, 150, "almost there"); err != nil {
+		t.Fatalf("failed to set progress: %v", err)
+	}
+	p, err := queue.Progress(id)
+	if err != nil || p.Percent != 100 || p.Message != "almost there" || p.UpdatedAt.IsZero() {
+		t.Fatalf("unexpected progress %+v, %v", p, err)
+	}
+
+	list, err := queue.Admin().InProgress(10)
+	if err != nil || len(list) != 1 || list[0].ItemID != id {
+		t.Fatalf("unexpected progress list %+v, %v", list, err)
+	}
+
+	// Claiming the item again after its lease expired starts from scratch.
+	time.Sleep(5 * time.Millisecond)
+	if items, err := queue.Claim(1); err != nil || len(items) != 1 {
+		t.Fatalf("failed to claim item again: %v", err)
+	}
+	if _, err := queue.Progress(id); !errors.Is(err, ErrItemNotFound) {
+		t.Fatalf("expected the progress to be cleared, got %v", err)
+	}
+
+	if err := queue.SetProgress(id+1, 50, ""); !errors.Is(err, ErrItemNotFound) {
+		t.Fatalf("expected ErrItemNotFound for an unclaimed item, got %v", err)
+	}
+}
@@ -0,0 +1,262 @@
+package queue
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Message is an entry published with Publish. Every subscriber receives its
+// own copy.
+type Message struct {
+	Seq         int64     `json:"seq"`          // Position in the log; increases with every message.
+	Data        []byte    `json:"data"`         // Payload of the message.
+	Tags        []string  `json:"tags"`         // Tags attached on publish.
+	PublishedAt time.Time `json:"published_at"` // Time the message was published.
+}
+
+// createPubSubTables creates the message log and the subscriber cursors.
+func createPubSubTables(tx *sql.Tx, t tables) error {
+	_, err := tx.Exec(`
+        CREATE TABLE IF NOT EXISTS ` + t.messages + ` (
+            seq INTEGER PRIMARY KEY AUTOINCREMENT,
+            data BLOB NOT NULL,
+            tags TEXT,
+            published_at INTEGER NOT NULL
+        );
+        CREATE TABLE IF NOT EXISTS ` + t.subscribers + ` (
+            name TEXT PRIMARY KEY,
+            cursor INTEGER NOT NULL
+        );
+    `)
+	return err
+}
+
+// Publish appends a message that every subscriber receives a copy of, and
+// returns its sequence number. Messages are kept until every subscriber has
+// handled them; with no subscribers they are dropped.
+func (c *Queue) Publish(data []byte, tags ...string) (int64, error) {
+	if err := c.validate(data); err != nil {
+		return 0, err
+	}
+	encoded, err := encodeTags(tags)
+	if err != nil {
+		return 0, err
+	}
+
+	c.mx.Lock() // Lock for exclusive access to the queue.
+	defer c.mx.Unlock()
+
+	var seq int64
+	err = c.withTx(func(tx *sql.Tx) error {
+		res, err := tx.Exec(
+			"INSERT INTO "+c.tables.messages+"(`data`, `tags`, `published_at`) VALUES (?, ?, ?)",
+			data, encoded, c.cfg.Clock.Now().UnixNano(),
+		)
+		if err != nil {
+			return err
+		}
+		if seq, err = res.LastInsertId(); err != nil {
+			return err
+		}
+		return c.pruneMessages(tx)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	close(c.published) // Wake the subscribers.
+	c.published = make(chan struct{})
+	return seq, nil
+}
+
+// Subscribe registers a durable subscriber that receives every message
+// published from now on, in order, and starts delivering them to clb in the
+// background. A message is handed to clb again after an error or a panic,
+// after the delay of Config.RetryPolicy, until clb returns nil or the policy
+// gives up and the message is skipped. The position of the subscriber is stored in the database, so
+// after a restart Subscribe with the same name resumes where it left off.
+// A name must be subscribed by one queue instance at a time; Subscribe
+// returns ErrSubscribed if this instance already runs it.
+func (c *Queue) Subscribe(name string, clb func(msg Message) error) error {
+	c.mx.Lock() // Lock for exclusive access to the queue.
+	defer c.mx.Unlock()
+
+	if _, ok := c.subscriptions[name]; ok {
+		return ErrSubscribed
+	}
+
+	// New subscribers start at the end of the log; existing ones keep their cursor.
+	_, err := c.db.ExecContext(
+		c.ctx,
+		"INSERT OR IGNORE INTO "+c.tables.subscribers+"(`name`, `cursor`) SELECT ?, COALESCE(MAX(seq), 0) FROM "+c.tables.messages,
+		name,
+	)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(c.ctx)
+	if c.subscriptions == nil {
+		c.subscriptions = make(map[string]context.CancelFunc)
+	}
+	c.subscriptions[name] = cancel
+
+	go c.runSubscriber(ctx, name, clb)
+	return nil
+}
+
+// Unsubscribe stops a subscriber, or removes a consumer group, and deletes
+// its cursor, releasing the messages it has not handled yet. It returns
+// ErrSubscriberNotFound if no subscriber or group has the given name.
+func (c *Queue) Unsubscribe(name string) error {
+	c.mx.Lock() // Lock for exclusive access to the queue.
+	defer c.mx.Unlock()
+
+	if cancel, ok := c.subscriptions[name]; ok {
+		cancel()
+		delete(c.subscriptions, name)
+	}
+
+	return c.withTx(func(tx *sql.Tx) error {
+		res, err := tx.Exec("DELETE FROM "+c.tables.subscribers+" WHERE name = ?", name)
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return ErrSubscriberNotFound
+		}
+		if _, err := tx.Exec("DELETE FROM "+c.tables.deliveries+" WHERE grp = ?", name); err != nil {
+			return err
+		}
+		return c.pruneMessages(tx)
+	})
+}
+
+// runSubscriber delivers messages to a subscriber until ctx is done.
+func (c *Queue) runSubscriber(ctx context.Context, name string, clb func(msg Message) error) {
+	ticker := c.cfg.Clock.NewTicker(feedPollInterval)
+	defer ticker.Stop()
+
+	var failures attempts
+	for {
+		c.mx.Lock()
+		published := c.published
+		c.mx.Unlock()
+
+		messages, err := c.pendingMessages(ctx, name)
+		if err != nil && ctx.Err() == nil {
+			c.cfg.Logger.Println("Error reading messages:", err)
+		}
+
+		for _, msg := range messages {
+			if !c.acquireSlot(ctx) {
+				return
+			}
+			err := c.deliverMessage(msg, clb)
+			if err != nil {
+				delay, giveUp := c.retryPolicy().NextDelay(failures.next(msg.Seq), err)
+				if !giveUp {
+					c.cfg.Logger.Println("Subscriber", name, "failed, retrying:", err)
+					select {
+					case <-c.cfg.Clock.After(delay):
+					case <-ctx.Done():
+						return
+					}
+					break // Read the message again.
+				}
+				c.cfg.Logger.Println("Subscriber", name, "failed, skipping message:", err)
+			}
+			if err := c.advanceCursor(name, msg.Seq); err != nil {
+				if ctx.Err() == nil {
+					c.cfg.Logger.Println("Error advancing subscriber:", err)
+				}
+				break
+			}
+		}
+		if len(messages) > 0 {
+			continue // There may be more messages waiting.
+		}
+
+		select {
+		case <-published:
+		case <-ticker.C():
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// deliverMessage passes a message to clb in the in-flight slot taken for it
+// and gives the slot back. A panic in clb is logged, as in the listener loop,
+// and returned as an error, so the message is retried like a failed one
+// instead of bringing the process down.
+func (c *Queue) deliverMessage(msg Message, clb func(msg Message) error) (err error) {
+	defer func() {
+		c.releaseSlot()
+		if r := recover(); r != nil {
+			c.cfg.Logger.Println("Recovered from panic:", r)
+			err = fmt.Errorf("queue: panic: %v", r)
+		}
+	}()
+
+	return clb(msg)
+}
+
+// pendingMessages returns the next page of messages a subscriber has not handled.
+func (c *Queue) pendingMessages(ctx context.Context, name string) ([]Message, error) {
+	rows, err := c.db.QueryContext(
+		ctx,
+		"SELECT m.`seq`, m.`data`, m.`tags`, m.`published_at` FROM "+c.tables.messages+" m, "+c.tables.subscribers+" s"+
+			" WHERE s.name = ? AND m.seq > s.cursor ORDER BY m.seq LIMIT 100",
+		name,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close() // Ensure rows are closed after processing.
+
+	var messages []Message
+	for rows.Next() {
+		var msg Message
+		var tags sql.NullString
+		var publishedAt int64
+		if err := rows.Scan(&msg.Seq, &msg.Data, &tags, &publishedAt); err != nil {
+			return nil, err
+		}
+		if msg.Tags, err = decodeTags(tags.String); err != nil {
+			return nil, err
+		}
+		msg.PublishedAt = time.Unix(0, publishedAt)
+		messages = append(messages, msg)
+	}
+	return messages, rows.Err()
+}
+
+// advanceCursor records that a subscriber handled every message up to and
+// including seq and drops the messages no subscriber needs anymore.
+func (c *Queue) advanceCursor(name string, seq int64) error {
+	c.mx.Lock() // Lock for exclusive access to the queue.
+	defer c.mx.Unlock()
+
+	return c.withTx(func(tx *sql.Tx) error {
+		if _, err := tx.Exec("UPDATE "+c.tables.subscribers+" SET cursor = ? WHERE name = ?", seq, name); err != nil {
+			return err
+		}
+		return c.pruneMessages(tx)
+	})
+}
+
+// pruneMessages deletes the messages every subscriber has handled, or all of
+// them if there are no subscribers.
+func (c *Queue) pruneMessages(tx *sql.Tx) error {
+	_, err := tx.Exec(
+		"DELETE FROM " + c.tables.messages + " WHERE seq <= COALESCE((SELECT MIN(cursor) FROM " + c.tables.subscribers + "), (SELECT MAX(seq) FROM " + c.tables.messages + "))",
+	)
+	return err
+}
@@ -0,0 +1,152 @@
+package queue
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPubSub(t *testing.T) {
+	queue := setupQueue(t, Config{})
+	defer queue.Close()
+
+	// Messages published without subscribers are dropped.
+	if _, err := queue.Publish([]byte("nobody listens")); err != nil {
+		t.Fatalf("failed to publish: %v", err)
+	}
+
+	first := make(chan Message, 10)
+	second := make(chan Message, 10)
+	if err := queue.Subscribe("first", func(msg Message) error { first <- msg; return nil }); err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+	if err := queue.Subscribe("second", func(msg Message) error { second <- msg; return nil }); err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+	if err := queue.Subscribe("first", func(Message) error { return nil }); !errors.Is(err, ErrSubscribed) {
+		t.Fatalf("expected ErrSubscribed, got %v", err)
+	}
+
+	for _, data := range []string{"one", "two"} {
+		if _, err := queue.Publish([]byte(data), "event"); err != nil {
+			t.Fatalf("failed to publish: %v", err)
+		}
+	}
+
+	for _, ch := range []chan Message{first, second} {
+		for _, want := range []string{"one", "two"} {
+			select {
+			case msg := <-ch:
+				if string(msg.Data) != want || len(msg.Tags) != 1 {
+					t.Fatalf("expected %q, got %+v", want, msg)
+				}
+			case <-time.After(3 * time.Second):
+				t.Fatalf("timed out waiting for %q", want)
+			}
+		}
+	}
+
+	if err := queue.Unsubscribe("first"); err != nil {
+		t.Fatalf("failed to unsubscribe: %v", err)
+	}
+	if err := queue.Unsubscribe("first"); !errors.Is(err, ErrSubscriberNotFound) {
+		t.Fatalf("expected ErrSubscriberNotFound, got %v", err)
+	}
+}
+
+func TestPubSubRetry(t *testing.T) {
+	queue := setupQueue(t, Config{})
+	defer queue.Close()
+
+	got := make(chan string, 10)
+	failed := false
+	err := queue.Subscribe("flaky", func(msg Message) error {
+		if !failed {
+			failed = true
+			return errors.New("not ready")
+		}
+		got <- string(msg.Data)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+
+	if _, err := queue.Publish([]byte("retried")); err != nil {
+		t.Fatalf("failed to publish: %v", err)
+	}
+
+	select {
+	case data := <-got:
+		if data != "retried" {
+			t.Fatalf("unexpected message %q", data)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatalf("timed out waiting for the retried message")
+	}
+}
+
+func TestPubSubPanic(t *testing.T) {
+	// A single slot, so the retry only runs if the panic gave it back.
+	queue := setupQueue(t, Config{MaxInFlight: 1, Logger: &recordingLogger{}})
+	defer queue.Close()
+
+	got := make(chan string, 10)
+	panicked := false
+	err := queue.Subscribe("crashy", func(msg Message) error {
+		if !panicked {
+			panicked = true
+			panic("boom")
+		}
+		got <- string(msg.Data)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+
+	if _, err := queue.Publish([]byte("retried")); err != nil {
+		t.Fatalf("failed to publish: %v", err)
+	}
+
+	select {
+	case data := <-got:
+		if data != "retried" {
+			t.Fatalf("unexpected message %q", data)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatalf("timed out waiting for the message to be delivered again")
+	}
+}
+
+func TestPubSubResume(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "pubsub.db")
+
+	queue := setupQueue(t, Config{LocalFile: file})
+	if err := queue.Subscribe("durable", func(Message) error { return nil }); err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+	queue.Close()
+
+	// Messages published while the subscriber is offline wait for it.
+	queue = setupQueue(t, Config{LocalFile: file})
+	defer queue.Close()
+	if _, err := queue.Publish([]byte("while offline")); err != nil {
+		t.Fatalf("failed to publish: %v", err)
+	}
+
+	got := make(chan string, 1)
+	if err := queue.Subscribe("durable", func(msg Message) error { got <- string(msg.Data); return nil }); err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+
+	select {
+	case data := <-got:
+		if data != "while offline" {
+			t.Fatalf("unexpected message %q", data)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatalf("timed out waiting for the message published while offline")
+	}
+}
@@ -0,0 +1,83 @@
+package queue
+
+import "database/sql"
+
+// Purge deletes every item in the given states, or every item in the queue if
+// no state is given, and returns the number of deleted items.
+func (c *Queue) Purge(states ...State) (int, error) {
+	return c.purge(c.actor(), states)
+}
+
+// purge deletes the items in the given states and audits it under actor.
+func (c *Queue) purge(actor string, states []State) (int, error) {
+	c.mx.Lock() // Lock for exclusive access to the queue.
+	defer c.mx.Unlock()
+
+	query := "SELECT `id` FROM " + c.tables.items
+	args := make([]any, len(states))
+	for i, state := range states {
+		if i == 0 {
+			query += " WHERE state IN (?"
+		} else {
+			query += ", ?"
+		}
+		args[i] = state
+	}
+	if len(states) > 0 {
+		query += ")"
+	}
+
+	purged := 0
+	err := c.withTx(func(tx *sql.Tx) error {
+		ids, err := selectIDs(tx, query, args...)
+		if err != nil {
+			return err
+		}
+
+		for _, id := range ids {
+			before, err := c.rowSnapshot(tx, id)
+			if err != nil {
+				return err
+			}
+			if _, err := c.execTransition(tx, id, TransitionDeleted, c.stmts.delete, id); err != nil {
+				return err
+			}
+			if err := c.snapshot(tx, id, TransitionDeleted, before); err != nil {
+				return err
+			}
+			if err := c.audit(tx, actor, TransitionDeleted, id); err != nil {
+				return err
+			}
+		}
+		purged = len(ids)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if purged > 0 {
+		c.signalFreed()
+	}
+	return purged, nil
+}
+
+// selectIDs runs a query returning item IDs and collects them, closing the
+// rows before the caller issues further statements.
+func selectIDs(tx *sql.Tx, query string, args ...any) ([]int, error) {
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close() // Ensure rows are closed after processing.
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
@@ -0,0 +1,41 @@
+package queue
+
+import "testing"
+
+func TestPurge(t *testing.T) {
+	queue := setupQueue(t, Config{})
+	defer queue.Close()
+
+	for i := 0; i < 3; i++ {
+		if err := queue.Add([]byte("test data")); err != nil {
+			t.Fatalf("failed to add item to queue: %v", err)
+		}
+	}
+	if _, err := queue.Claim(1); err != nil {
+		t.Fatalf("failed to claim item: %v", err)
+	}
+
+	purged, err := queue.Purge(StatePending)
+	if err != nil {
+		t.Fatalf("failed to purge pending items: %v", err)
+	}
+	if purged != 2 {
+		t.Fatalf("expected 2 purged items, got %d", purged)
+	}
+
+	purged, err = queue.Purge()
+	if err != nil {
+		t.Fatalf("failed to purge queue: %v", err)
+	}
+	if purged != 1 {
+		t.Fatalf("expected the in-flight item to be purged, got %d", purged)
+	}
+
+	items, err := queue.Get(10)
+	if err != nil {
+		t.Fatalf("failed to get items: %v", err)
+	}
+	if len(items) != 0 {
+		t.Fatalf("expected an empty queue, got %d items", len(items))
+	}
+}
@@ -1,12 +1,16 @@
 package queue
 
 import (
+	"cmp"
 	"context"
 	"database/sql"
-	"fmt"
+	"errors"
+	"math"
 	"os"
+	"slices"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	_ "github.com/mattn/go-sqlite3"
@@ -14,25 +18,137 @@ import (
 
 // Item represents a queue item with an ID, data, and a creation timestamp.
 type Item struct {
-	ID   int    // Unique identifier for the item.
-	Data []byte // Data of the item, stored as a byte slice.
+	ID       int               // Unique identifier for the item.
+	Data     []byte            // Data of the item, stored as a byte slice.
+	Tags     []string          // Tags attached to the item on enqueue.
+	State    State             // Lifecycle state of the item when it was read.
+	Attempts int               // Number of times the item has been handed to a listener.
+	Priority int               // Items with a higher priority are claimed first.
+	Streamed bool              // Added with AddFrom; Data is empty and the payload is read with OpenPayload.
+	Tenant   string            // Tenant the item was added for with AddForTenant; empty for unscoped items.
+	Version  int64             // Changes with every change to the item; pass it to Update or DeleteVersion to detect concurrent changes.
+	Receipt  string            // Proof of the delivery for items returned by a claim; pass it to AckReceipt, NackReceipt or Touch.
+	Deadline time.Time         // Time after which the item expires instead of being delivered; zero if it has none. See AddBefore.
+	Headers  map[string]string // Metadata attached with WithHeaders.
+	Type     string            // Job type selecting the handler registered with Handle; see Enqueue.
+
+	chunks   int             // Number of rows holding the rest of a payload split by Config.ChunkSize.
+	blob     string          // Key of the payload in Config.Offload; empty if it is stored in the database.
+	checksum sql.NullInt64   // Checksum of the payload; NULL for items added before checksums were stored.
+	keyID    string          // ID of the key of Config.Keyring the payload is sealed under; empty if stored in clear.
+	ctx      context.Context // Returned by Context; set for items handed to consumers.
 }
 
+// itemColumns lists the columns scanned by scanItem, in order.
+const itemColumns = "`id`, `data`, `tags`, `state`, `attempts`, `priority`, `chunks`, `blob`, `streamed`, `checksum`, `tenant`, `version`, `expires_at`, `headers`, `key_id`, `job_type`"
+
 // Queue provides a FIFO queue backed by a SQLite database.
 type Queue struct {
-	db         *sql.DB            // The SQL database connection used by the queue.
-	ctx        context.Context    // Context for managing request-scoped values and cancellation signals.
-	cancelFunc context.CancelFunc // Cancellation function for the context
-	clb        func(item Item, delay func(sec time.Duration))
+	db          *sql.DB            // The SQL database connection used by the queue.
+	ownsDB      bool               // Whether Close also closes db; false for queues handed out by a Manager.
+	onClose     func()             // Called by Close, e.g. to unregister the queue from its Manager.
+	stmts       *statements        // Prepared hot-path statements.
+	tables      tables             // Names of the tables backing the queue.
+	cfg         Config             // Configuration the queue was created with.
+	ctx         context.Context    // Context for managing request-scoped values and cancellation signals.
+	cancelFunc  context.CancelFunc // Cancellation function for the context
+	clb         func(item Item, delay func(sec time.Duration))
+	tagged      []listener               // Listeners receiving only items that match their tag predicate.
+	handlers    map[string]Handler       // Handlers registered with Handle, by job type.
+	batch       *batchListener           // Listener receiving items in batches instead of clb; see BatchListener.
+	middleware  []Middleware             // Wrappers around enqueueing and processing, outermost first.
+	completions map[int]*completion      // What listeners recorded for the items they are processing, by item ID.
+	awaited     map[int]bool             // Items a Do call is waiting for; they always store a result.
+	owner       string                   // Identifies this instance on the items it claims.
+	freed       chan struct{}            // Closed and replaced whenever an item leaves the queue.
+	added       chan struct{}            // Closed and replaced whenever an item enters the queue.
+	registered  chan struct{}            // Closed and replaced whenever a listener is registered.
+	started     atomic.Bool              // Set by Start once the workers run.
+	stopped     atomic.Bool              // Set by StopProcessing; the workers do not claim items.
+	resumed     chan struct{}            // Closed and replaced by StartProcessing.
+	running     sync.RWMutex             // Read-locked by the workers while they claim and deliver items; see StopProcessing.
+	published   chan struct{}            // Closed and replaced whenever a message is published.
+	latency     latencyTracker           // Processing times of the items handed to listeners.
+	mirror      mirrorState              // Progress of copying items to Config.Mirror.
+	buckets     map[string]*tenantBucket // Claim rate of the tenants limited by TenantLimits.Rate, by tenant ID.
+	labels      []Label                  // Labels of the metrics reported to Config.Metrics.
+	gaugesAt    time.Time                // When the gauges were last reported.
+	counters    counters                 // Totals of the counters reported to Config.Metrics.
+	errLog      *errorLogger             // Wraps Config.Logger to remember the last error; see DebugInfo.
+	heartbeat   time.Time                // When a listener loop last started an iteration; see Health.
+	retries     []time.Time              // When the items delayed by the listeners of this instance become visible.
+	slots       chan struct{}            // Holds a token per running callback when Config.MaxInFlight is set; nil otherwise.
+	prefetched  []prefetched             // Items claimed ahead by Config.ClaimBatchSize, waiting for a worker.
+	windows     windowState              // Pause windows gating dispatch; see AddPauseWindow.
+	draining    atomic.Bool              // Set by Drain; new items are rejected.
+	rotation    context.CancelFunc       // Stops the running RotateKey, if any.
+	group       groupState               // Adds waiting to be committed together; see Config.GroupCommitSize.
+
+	subscriptions map[string]context.CancelFunc // Stops the subscribers running in this instance, by name.
+	recovery      *RecoveryReport               // Set if New salvaged a damaged database; see Recovery.
+	validator     atomic.Pointer[Validator]     // Checks the payloads of new items; see SetValidator.
 
 	mx sync.Mutex // Mutex to ensure thread-safe operations on the queue.
 }
 
 // New initializes a new Queue instance and sets up the database connection.
-// It optionally resets the database if specified in the configuration.
-func New(config ...Config) (*Queue, error) {
-	cfg := configDefault(config...) // Retrieve the configuration with defaults.
+// It optionally resets the database if specified in the configuration, which
+// is given as a Config, functional options such as WithFile, or both.
+func New(options ...Option) (*Queue, error) {
+	cfg, err := newConfig(options) // Retrieve the configuration with defaults.
+	if err != nil {
+		return nil, err
+	}
+
+	db, recovery, err := openChecked(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := newQueue(db, cfg, nil)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	c.ownsDB = true
+	c.recovery = recovery
+
+	if cfg.MaintenanceInterval > 0 {
+		go maintain(c.ctx, c.db, c.cfg, c.idle, c.lock)
+	}
+
+	return c, nil
+}
+
+// NewWithDB creates a queue inside an existing SQLite connection pool, for
+// applications that manage the database themselves. The pool settings and
+// LocalFile of the configuration are ignored and Close leaves db open. A
+// database failing Config.IntegrityCheck is never salvaged, as it belongs to
+// the application.
+func NewWithDB(db *sql.DB, options ...Option) (*Queue, error) {
+	cfg, err := newConfig(options) // Retrieve the configuration with defaults.
+	if err != nil {
+		return nil, err
+	}
+
+	if problems := checkIntegrity(db, cfg.IntegrityCheck); len(problems) > 0 {
+		return nil, &IntegrityError{Problems: problems}
+	}
+
+	c, err := newQueue(db, cfg, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.MaintenanceInterval > 0 {
+		go maintain(c.ctx, c.db, c.cfg, c.idle, c.lock)
+	}
+
+	return c, nil
+}
 
+// open resets the database if requested and opens a connection pool for it.
+func open(cfg Config) (*sql.DB, error) {
 	inMemory := strings.HasPrefix(cfg.LocalFile, "file::memory_")
 	if cfg.Reset && !inMemory {
 		// Remove the database file if reset is requested and it's not an in-memory database.
@@ -43,47 +159,222 @@ func New(config ...Config) (*Queue, error) {
 	}
 
 	// Initialize SQLite database connection.
-	db, err := sql.Open("sqlite3", cfg.LocalFile)
+	db, err := sql.Open("sqlite3", dataSourceName(cfg))
 	if err != nil {
 		return nil, err
 	}
 
-	// Create the queue table if it does not exist.
-	_, err = db.Exec(`
-        CREATE TABLE IF NOT EXISTS queue (
-            id INTEGER PRIMARY KEY AUTOINCREMENT,
-            data BLOB NOT NULL
-        );
-    `)
+	// Tune the connection pool.
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	if cfg.MaxIdleConns != 0 {
+		db.SetMaxIdleConns(cfg.MaxIdleConns)
+	}
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+
+	return db, nil
+}
+
+// newQueue sets up the tables of a queue in db and starts its dispatcher.
+// The queue takes its Config.MaxInFlight slots from slots, shared with the
+// other queues of a Manager, or from a pool of its own if slots is nil.
+func newQueue(db *sql.DB, cfg Config, slots chan struct{}) (*Queue, error) {
+	if !validTableName.MatchString(cfg.Table) {
+		return nil, &ConfigError{Field: "Table", Value: cfg.Table, Reason: "want letters, digits and underscores"}
+	}
+
+	// Create or upgrade the tables and indexes.
+	if err := initSchema(db, cfg); err != nil {
+		return nil, err
+	}
+
+	// Prepare the hot-path statements once for reuse.
+	stmts, err := prepareStatements(db, newTables(cfg.Table), cfg.DeadLetterExpired)
 	if err != nil {
 		return nil, err
 	}
 
 	ctx, cancelFunc := context.WithCancel(context.Background())
 
+	errs := &errorLogger{Logger: cfg.Logger, clock: cfg.Clock}
+	cfg.Logger = errs
+
 	c := &Queue{
 		db:         db,
+		stmts:      stmts,
+		tables:     newTables(cfg.Table),
+		cfg:        cfg,
 		ctx:        ctx,
 		cancelFunc: cancelFunc,
-		clb:        func(item Item, delay func(sec time.Duration)) {},
+		owner:      newOwnerID(),
+		freed:      make(chan struct{}),
+		added:      make(chan struct{}),
+		registered: make(chan struct{}),
+		resumed:    make(chan struct{}),
+		awaited:    make(map[int]bool),
+		published:  make(chan struct{}),
+		labels:     []Label{{Name: "queue", Value: cfg.Table}},
+		counters:   counters{since: cfg.Clock.Now()},
+		errLog:     errs,
+		heartbeat:  cfg.Clock.Now(),
 	}
+	if c.slots = slots; c.slots == nil && cfg.MaxInFlight > 0 {
+		c.slots = make(chan struct{}, cfg.MaxInFlight)
+	}
+	c.SetValidator(cfg.Validator)
 
-	go c.process()
+	if !cfg.ManualStart {
+		c.Start()
+	}
+	go c.runCron()
+	if cfg.Mirror != nil {
+		c.mirror.wake = make(chan struct{}, 1)
+		go c.runMirror()
+	}
+	if cfg.Offload != nil {
+		go c.runBlobSweeper()
+	}
+	if cfg.GroupCommitSize > 1 {
+		c.group.wake = make(chan struct{}, 1)
+		go c.runGroupCommit()
+	}
 
 	return c, nil
 }
 
 // Add inserts a new item with the specified data into the queue.
+// If the queue is full, the configured OverflowPolicy decides the outcome.
+// With Config.GroupCommitSize, Adds of concurrent producers share a
+// transaction, and Add returns once the group of the item is committed.
 func (c *Queue) Add(data []byte) error {
-	c.mx.Lock() // Lock for exclusive access to the queue.
-	defer c.mx.Unlock()
+	return c.enqueue(c.ctx, data, nil, c.cfg.Overflow)
+}
+
+// AddWait inserts a new item, blocking while the queue is full until space
+// frees up or ctx is done, regardless of the configured OverflowPolicy.
+func (c *Queue) AddWait(ctx context.Context, data []byte) error {
+	return c.enqueue(ctx, data, nil, OverflowBlock)
+}
+
+// add inserts a new item with the specified data and tags into the queue,
+// applying the given overflow policy when the queue is full. With OverflowBlock
+// it waits for space to free up until ctx is done.
+func (c *Queue) add(ctx context.Context, data []byte, tags []string, policy OverflowPolicy) error {
+	encoded, err := encodeTags(tags)
+	if err != nil {
+		return err
+	}
+
+	// Options of AddAt travel through the middleware in the context.
+	opts, _ := ctx.Value(addOptionsKey{}).(*addOptions)
+	if opts == nil {
+		opts = &addOptions{}
+	}
+	c.captureTrace(ctx, opts)
+
+	for {
+		id, freed, err := c.commitAdd(data, encoded, *opts, policy)
+		switch {
+		case err == nil:
+			opts.id = id
+			c.cfg.Hooks.enqueued(Item{ID: id, Data: data, Tags: tags, State: StatePending, Priority: opts.priority, Tenant: opts.tenant, Headers: opts.headers, Type: opts.jobType})
+			c.count(MetricEnqueued, 1)
+			return nil
+		case errors.Is(err, errDropped):
+			return nil // The overflow policy discarded the new item.
+		case errors.Is(err, errDuplicate):
+			opts.id = id // An item with the same dedup key is already queued.
+			return nil
+		case !errors.Is(err, ErrQueueFull) || policy != OverflowBlock || !c.fits(len(data)):
+			return err
+		}
+
+		// Wait for an item to leave the queue before trying again.
+		select {
+		case <-freed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// insertItem applies the overflow policy and inserts an item with tags
+// encoded by encodeTags with the tenant, visibility and deadline given by
+// opts, returning its ID. It must be called with the queue locked; waiting
+// consumers are woken up right away.
+func (c *Queue) insertItem(tx *sql.Tx, data []byte, encoded any, opts addOptions, policy OverflowPolicy) (int, error) {
+	if c.draining.Load() {
+		return 0, ErrDraining
+	}
+	if err := c.validate(data); err != nil {
+		return 0, err
+	}
+	if opts.dedupKey != "" {
+		id, err := c.findDuplicate(tx, opts.dedupKey)
+		if err != nil {
+			return 0, err
+		}
+		if id != 0 {
+			return id, errDuplicate
+		}
+	}
+	p, err := c.preparePayload(data)
+	if err != nil {
+		return 0, err
+	}
+	id, err := c.insertPayload(tx, p, encoded, opts, policy)
+	if err != nil {
+		c.discardPayload(p)
+		return 0, err
+	}
+	if err := c.queueMirror(tx, data, encoded, opts); err != nil {
+		return 0, err
+	}
+	if err := c.enforceTransition(tx, int(id), TransitionEnqueued, stateAbsent); err != nil {
+		return 0, err
+	}
+	c.signalAdded()
+	if err := c.snapshot(tx, int(id), TransitionEnqueued, nil); err != nil {
+		return 0, err
+	}
+	return int(id), c.audit(tx, c.actor(), TransitionEnqueued, int(id))
+}
+
+// insertPayload applies the tenant limits and the overflow policy and inserts
+// the item row along with the parts of its payload stored elsewhere,
+// returning its ID.
+func (c *Queue) insertPayload(tx *sql.Tx, p storedPayload, encoded any, opts addOptions, policy OverflowPolicy) (int64, error) {
+	if err := c.checkTenant(tx, opts.tenant); err != nil {
+		return 0, err
+	}
+	if err := c.makeRoom(tx, p.size(), policy); err != nil {
+		return 0, err
+	}
+
+	var visible, expires any
+	if opts.visibleAt > 0 {
+		visible = opts.visibleAt
+	}
+	if opts.expiresAt > 0 {
+		expires = opts.expiresAt
+	}
+	headers, err := encodeHeaders(opts.headers)
+	if err != nil {
+		return 0, err
+	}
 
-	_, err := c.db.ExecContext(
+	res, err := tx.StmtContext(c.ctx, c.stmts.insert).ExecContext(
 		c.ctx,
-		"INSERT INTO queue(`data`) VALUES (?)",
-		data,
+		p.head, encoded, opts.priority, visible, p.checksum, nullString(opts.tenant), expires, headers, nullString(opts.dedupKey), nullString(p.key), nullString(opts.jobType),
 	)
-	return err
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return id, c.storePayload(tx, id, p)
 }
 
 // Get retrieves up to 'limit' items from the queue.
@@ -92,10 +383,12 @@ func (c *Queue) Get(limit int) ([]Item, error) {
 	c.mx.Lock() // Lock for exclusive access to the queue.
 	defer c.mx.Unlock()
 
-	rows, err := c.db.Query(
-		"SELECT `id`, `data` FROM queue LIMIT ?",
-		limit,
-	)
+	return c.get(limit)
+}
+
+// get retrieves up to 'limit' items. It must be called with the queue locked.
+func (c *Queue) get(limit int) ([]Item, error) {
+	rows, err := c.stmts.get.Query(limit)
 	if err != nil {
 		return nil, err
 	}
@@ -103,71 +396,812 @@ func (c *Queue) Get(limit int) ([]Item, error) {
 
 	var items []Item
 	for rows.Next() {
-		var item Item
-		if err := rows.Scan(&item.ID, &item.Data); err != nil {
+		item, err := scanItem(rows)
+		if err != nil {
 			return nil, err
 		}
 		items = append(items, item) // Collect items into a slice.
 	}
-	return items, nil
+	rows.Close() // Release the connection before loading the payloads.
+	return items, c.loadPayloads(c.db, items)
+}
+
+// scanItem reads an item from a row selected with itemColumns, followed by
+// the columns scanned into extra, if any.
+func scanItem(rows *sql.Rows, extra ...any) (Item, error) {
+	var item Item
+	var tags, blob, tenant, headers, keyID, jobType sql.NullString
+	var expiresAt sql.NullInt64
+	dest := []any{&item.ID, &item.Data, &tags, &item.State, &item.Attempts, &item.Priority, &item.chunks, &blob, &item.Streamed, &item.checksum, &tenant, &item.Version, &expiresAt, &headers, &keyID, &jobType}
+	if err := rows.Scan(append(dest, extra...)...); err != nil {
+		return Item{}, err
+	}
+	item.Type = jobType.String
+	item.blob = blob.String
+	item.keyID = keyID.String
+	item.Tenant = tenant.String
+	if expiresAt.Valid {
+		item.Deadline = time.Unix(0, expiresAt.Int64)
+	}
+
+	var err error
+	if item.Headers, err = decodeHeaders(headers.String); err != nil {
+		return Item{}, err
+	}
+	item.Tags, err = decodeTags(tags.String)
+	return item, err
 }
 
 // Delete removes an item with the specified ID from the queue.
 func (c *Queue) Delete(id int) error {
+	return c.remove(id, AnyVersion, TransitionDeleted, c.actor())
+}
+
+// remove deletes an item, records the transition that caused it and audits
+// it under actor, if any. Unless version is AnyVersion, the item must still
+// be at that version.
+func (c *Queue) remove(id int, version int64, transition, actor string) error {
+	c.mx.Lock() // Lock for exclusive access to the queue.
+	defer c.mx.Unlock()
+
+	return c.withTx(func(tx *sql.Tx) error {
+		if err := c.checkVersion(tx, id, version); err != nil {
+			return err
+		}
+		before, err := c.rowSnapshot(tx, id)
+		if err != nil {
+			return err
+		}
+
+		if _, err := c.execTransition(tx, id, transition, c.stmts.delete, id); err != nil {
+			return err
+		}
+		c.signalFreed()
+		if err := c.snapshot(tx, id, transition, before); err != nil {
+			return err
+		}
+		return c.audit(tx, actor, transition, id)
+	})
+}
+
+// claimPageSize is the number of candidate rows read per round trip while claiming.
+const claimPageSize = 100
+
+// claim claims items with claimItems and hands them out to a consumer; see deliver.
+func (c *Queue) claim(limit int, accept func(item Item) bool) ([]Item, error) {
+	return c.deliver(c.claimItems(limit, accept))
+}
+
+// claimItems retrieves up to 'limit' pending items, highest priority first, that accept reports true for,
+// or any pending items if accept is nil, and marks them as in-flight for this
+// queue instance. Items are claimed with conditional UPDATEs, so when several
+// processes share the database file every item is handed to exactly one of
+// them. Items whose lease expired, because the process holding them crashed,
+// are claimed again.
+func (c *Queue) claimItems(limit int, accept func(item Item) bool) ([]Item, error) {
+	// Fire the hooks of dead-lettered items once the lock below is released.
+	var dead []Item
+	defer func() {
+		for _, item := range dead {
+			c.cfg.Hooks.deadLetter(item)
+		}
+		c.count(MetricDeadLettered, len(dead))
+	}()
+
+	c.mx.Lock() // Lock for exclusive access to the queue.
+	defer c.mx.Unlock()
+
+	if accept == nil && c.claimsAtomically() {
+		items, moved, err := c.claimAtomic(limit)
+		dead = moved
+		c.count(MetricClaimed, len(items))
+		return items, err
+	}
+
+	var items []Item
+	nonce := newReceiptNonce()
+	after := Item{Priority: math.MaxInt64} // Cursor at the head of the queue.
+	for len(items) < limit {
+		now := c.cfg.Clock.Now().UnixNano()
+
+		// Read a page of candidates and close the rows before updating, as the
+		// pool may only have a single connection.
+		candidates, err := c.claimCandidates(now, after)
+		if err != nil || len(candidates) == 0 {
+			return items, err
+		}
+		after = candidates[len(candidates)-1]
+
+		for _, item := range candidates {
+			if len(items) == limit {
+				break
+			}
+
+			// Items whose deadline passed expire instead of being delivered late.
+			if !item.Deadline.IsZero() && item.Deadline.UnixNano() <= now {
+				expired, err := c.expire(item.ID, now)
+				if err != nil {
+					return items, err
+				}
+				if expired && c.cfg.DeadLetterExpired {
+					item.State = StateDead
+					dead = append(dead, item)
+				}
+				continue
+			}
+
+			if accept != nil && !accept(item) {
+				continue // Skip items the caller cannot handle.
+			}
+			if !c.tenantAllowed(item.Tenant, time.Unix(0, now)) {
+				continue // The tenant used up its claim rate for now.
+			}
+
+			// An expired lease means the listener hung or its process died on
+			// the item, which counts as a crash when quarantine is enabled.
+			if c.cfg.PoisonThreshold > 0 && item.State == StateInFlight {
+				quarantined, err := c.timedOut(item.ID, now)
+				if err != nil {
+					return items, err
+				}
+				if quarantined {
+					continue
+				}
+			}
+
+			// Hand out complete payloads only and set corrupted ones aside.
+			if !item.Streamed {
+				err := c.loadPayload(c.db, &item)
+				if errors.Is(err, ErrCorrupted) {
+					if err := c.quarantineCorrupted(item.ID, err, ""); err != nil {
+						return items, err
+					}
+					continue
+				}
+				if err != nil {
+					return items, err
+				}
+			}
+
+			// Items that used up their attempts go to the dead letters instead.
+			if c.cfg.MaxAttempts > 0 && item.Attempts >= c.cfg.MaxAttempts {
+				moved, err := c.transition(item.ID, TransitionDeadLettered, "", c.stmts.deadLetter, item.ID, now)
+				if err != nil {
+					return items, err
+				}
+				if moved {
+					item.State = StateDead
+					dead = append(dead, item)
+				}
+				continue
+			}
+
+			claimed, err := c.transition(item.ID, TransitionClaimed, "", c.stmts.claimOne, c.owner, now+c.cfg.LeaseTimeout.Nanoseconds(), item.ID, now, nonce)
+			if err != nil {
+				return items, err
+			}
+			if !claimed {
+				continue // Another consumer claimed the item first.
+			}
+			c.tenantClaimed(item.Tenant)
+			item.State = StateInFlight
+			item.Attempts++
+			item.Version++
+			item.Receipt = formatReceipt(item.ID, nonce)
+			items = append(items, item)
+		}
+	}
+	c.count(MetricClaimed, len(items))
+	return items, nil
+}
+
+// prefetched is an item claimed ahead for the workers.
+type prefetched struct {
+	item  Item
+	until time.Time // When its lease runs out, after which another consumer may hold it.
+}
+
+// claimNext claims a single item for a worker. With Config.ClaimBatchSize it
+// claims a batch per round trip and hands out the rest of it to the following
+// calls from memory, skipping items whose lease ran out meanwhile.
+func (c *Queue) claimNext(accept func(item Item) bool) ([]Item, error) {
+	if c.cfg.ClaimBatchSize <= 1 {
+		return c.claim(1, accept)
+	}
+
+	now := c.cfg.Clock.Now()
+	c.mx.Lock()
+	for len(c.prefetched) > 0 {
+		next := c.prefetched[0]
+		c.prefetched = c.prefetched[1:]
+		if now.Before(next.until) {
+			c.mx.Unlock()
+			return c.deliver([]Item{next.item}, nil)
+		}
+	}
+	c.mx.Unlock()
+
+	// The items claimed ahead are only handed out, and thus consumed in
+	// AtMostOnce mode, one at a time.
+	items, err := c.claimItems(c.cfg.ClaimBatchSize, accept)
+	if len(items) <= 1 {
+		return c.deliver(items, err)
+	}
+
+	until := now.Add(c.cfg.LeaseTimeout)
+	c.mx.Lock()
+	for _, item := range items[1:] {
+		c.prefetched = append(c.prefetched, prefetched{item: item, until: until})
+	}
+	c.mx.Unlock()
+	return c.deliver(items[:1], err)
+}
+
+// releasePrefetched hands the items claimed ahead back to the queue, so other
+// consumers need not wait for their leases to run out.
+func (c *Queue) releasePrefetched() {
+	c.mx.Lock()
+	held := c.prefetched
+	c.prefetched = nil
+	c.mx.Unlock()
+
+	for _, p := range held {
+		c.release(p.item)
+	}
+}
+
+// claimsAtomically reports whether claim can take items with a single
+// statement, as no per-item decision applies: crashed leases are not counted
+// for quarantine, no tenant is rate-limited, and no debug snapshots are taken.
+func (c *Queue) claimsAtomically() bool {
+	if c.cfg.PoisonThreshold > 0 || c.cfg.Debug || c.cfg.TenantDefaults.Rate > 0 {
+		return false
+	}
+	for _, limits := range c.cfg.Tenants {
+		if limits.Rate > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// claimAtomic claims up to 'limit' items in claim order with a single
+// UPDATE ... RETURNING, so no other worker or process can take an item
+// between it being chosen and marked in flight. Claimable items that used up
+// their attempts are moved to the dead letters in the same transaction and
+// returned separately, along with expired items if they are dead-lettered.
+func (c *Queue) claimAtomic(limit int) ([]Item, []Item, error) {
+	now := c.cfg.Clock.Now().UnixNano()
+	maxAttempts := math.MaxInt64
+	if c.cfg.MaxAttempts > 0 {
+		maxAttempts = c.cfg.MaxAttempts
+	}
+
+	var items, dead, expired []Item
+	nonce := newReceiptNonce()
+	err := c.withTx(func(tx *sql.Tx) error {
+		var err error
+		if expired, err = scanItems(tx.Stmt(c.stmts.expireAll).Query(now)); err != nil {
+			return err
+		}
+		if err := c.enforceOutcome(tx, c.expiredTransition(), expired); err != nil {
+			return err
+		}
+		if err := c.recordExpired(tx, expired); err != nil {
+			return err
+		}
+		if c.cfg.MaxAttempts > 0 {
+			if dead, err = scanItems(tx.Stmt(c.stmts.deadLetterAll).Query(now, maxAttempts)); err != nil {
+				return err
+			}
+			if err := c.enforceOutcome(tx, TransitionDeadLettered, dead); err != nil {
+				return err
+			}
+		}
+		items, err = scanItems(tx.Stmt(c.stmts.claimAll).Query(c.owner, now+c.cfg.LeaseTimeout.Nanoseconds(), now, maxAttempts, limit, nonce))
+		if err != nil {
+			return err
+		}
+		if err := c.enforceOutcome(tx, TransitionClaimed, items); err != nil {
+			return err
+		}
+
+		// RETURNING yields the rows in no particular order.
+		slices.SortFunc(items, func(a, b Item) int {
+			if a.Priority != b.Priority {
+				return cmp.Compare(b.Priority, a.Priority)
+			}
+			return cmp.Compare(a.ID, b.ID)
+		})
+		for _, item := range dead {
+			if err := c.snapshot(tx, item.ID, TransitionDeadLettered, nil); err != nil {
+				return err
+			}
+		}
+		for i, item := range items {
+			items[i].Receipt = formatReceipt(item.ID, nonce)
+			if err := c.snapshot(tx, item.ID, TransitionClaimed, nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	c.count(MetricExpired, len(expired))
+	if c.cfg.DeadLetterExpired {
+		dead = append(expired, dead...)
+	}
+
+	for i := range dead {
+		if err := c.loadPayload(c.db, &dead[i]); err != nil && !errors.Is(err, ErrCorrupted) {
+			return nil, dead, err
+		}
+	}
+
+	// Hand out complete payloads only and set corrupted ones aside.
+	claimed := items[:0]
+	for _, item := range items {
+		if !item.Streamed {
+			err := c.loadPayload(c.db, &item)
+			if errors.Is(err, ErrCorrupted) {
+				if err := c.quarantineCorrupted(item.ID, err, c.owner); err != nil {
+					return claimed, dead, err
+				}
+				continue
+			}
+			if err != nil {
+				return claimed, dead, err
+			}
+		}
+		claimed = append(claimed, item)
+	}
+	return claimed, dead, nil
+}
+
+// scanItems collects the items of rows returned along with err, closing the rows.
+func scanItems(rows *sql.Rows, err error) ([]Item, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close() // Ensure rows are closed after processing.
+
+	var items []Item
+	for rows.Next() {
+		item, err := scanItem(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// claimCandidates returns the next page of claimable items following 'after'
+// in claim order: highest priority first, then FIFO.
+func (c *Queue) claimCandidates(now int64, after Item) ([]Item, error) {
+	rows, err := c.stmts.claim.Query(now, after.Priority, after.ID, claimPageSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close() // Ensure rows are closed after processing.
+
+	var items []Item
+	for rows.Next() {
+		item, err := scanItem(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// release returns an item claimed by this queue instance to the pending
+// state, unless its delivery was superseded by a later claim.
+func (c *Queue) release(item Item) {
+	if err := c.NackReceipt(item.Receipt, 0); err != nil && !errors.Is(err, ErrInvalidReceipt) {
+		c.cfg.Logger.Println("Error releasing item:", err)
+	}
+}
+
+// acquireSlot waits until fewer than Config.MaxInFlight callbacks run and
+// takes a slot, which releaseSlot gives back. It returns false if ctx is
+// done first. Without MaxInFlight it returns true at once.
+func (c *Queue) acquireSlot(ctx context.Context) bool {
+	if c.slots == nil {
+		return true
+	}
+	select {
+	case c.slots <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// tryAcquireSlot takes a slot if one is free, without waiting.
+func (c *Queue) tryAcquireSlot() bool {
+	if c.slots == nil {
+		return true
+	}
+	select {
+	case c.slots <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// releaseSlot gives back a slot taken by acquireSlot.
+func (c *Queue) releaseSlot() {
+	if c.slots != nil {
+		<-c.slots
+	}
+}
+
+// retryLater returns an item claimed by this instance to pending, hidden
+// until delay has passed, so the listener loops carry on with other items
+// meanwhile.
+func (c *Queue) retryLater(item Item, delay time.Duration) {
+	c.retryAt(item, c.cfg.Clock.Now().Add(delay))
+}
+
+// retryAt returns an item claimed by this instance to pending, hidden until
+// at, unless its delivery was superseded by a later claim.
+func (c *Queue) retryAt(item Item, at time.Time) {
 	c.mx.Lock() // Lock for exclusive access to the queue.
+	_, err := c.transition(item.ID, TransitionReleased, "", c.stmts.retry, item.ID, c.owner, at.UnixNano(), deliveryNonce(item))
+	if err == nil {
+		c.retries = append(c.retries, at)
+	}
+	c.mx.Unlock()
+
+	if err != nil {
+		c.cfg.Logger.Println("Error rescheduling item:", err)
+	}
+}
+
+// idleWait returns how long an idle listener loop waits for an item to be
+// added before looking again, which picks up expired leases, items added by
+// other processes and scheduled items. It wakes up early for the next item
+// delayed by a listener of this instance.
+func (c *Queue) idleWait() time.Duration {
+	c.mx.Lock()
 	defer c.mx.Unlock()
 
-	_, err := c.db.Exec("DELETE FROM queue WHERE id = ?", id)
-	return err
+	now := c.cfg.Clock.Now()
+	wait := 2 * time.Second
+	pending := c.retries[:0]
+	for _, at := range c.retries {
+		if d := at.Sub(now); d > 0 {
+			wait = min(wait, d)
+			pending = append(pending, at)
+		} else {
+			wait = 0 // Due, so the next claim picks the item up.
+		}
+	}
+	c.retries = pending
+	return wait
+}
+
+// routable reports whether a registered listener accepts the item.
+// It must be called with the queue locked.
+func (c *Queue) routable(item Item) bool {
+	return c.route(item) != nil || c.batch != nil
+}
+
+// transition runs a conditional UPDATE of a single item, records the
+// transition in debug mode and audits it under actor, if any. It reports
+// whether the item was updated.
+func (c *Queue) transition(id int, transition, actor string, stmt *sql.Stmt, args ...any) (bool, error) {
+	updated := false
+	err := c.withTx(func(tx *sql.Tx) error {
+		before, err := c.rowSnapshot(tx, id)
+		if err != nil {
+			return err
+		}
+
+		if updated, err = c.execTransition(tx, id, transition, stmt, args...); err != nil || !updated {
+			return err
+		}
+		if err := c.snapshot(tx, id, transition, before); err != nil {
+			return err
+		}
+		return c.audit(tx, actor, transition, id)
+	})
+	return updated, err
+}
+
+// withTx runs fn inside a transaction, committing on success and rolling back otherwise.
+func (c *Queue) withTx(fn func(tx *sql.Tx) error) error {
+	tx, err := c.db.BeginTx(c.ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// withConnTx is withTx on a connection of its own, which fn can also use
+// outside the statements of tx, e.g. for incremental blob I/O.
+func (c *Queue) withConnTx(fn func(conn *sql.Conn, tx *sql.Tx) error) error {
+	conn, err := c.db.Conn(c.ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close() // Return the connection to the pool.
+
+	tx, err := conn.BeginTx(c.ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(conn, tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
 }
 
+// Listener registers the callback invoked by the background loop for every item.
+// When a delivered item leaves the queue depends on Config.Delivery; see DeliveryMode.
+// It is safe to call while the workers run; they wait for a listener before claiming.
 func (c *Queue) Listener(clb func(item Item, delay func(sec time.Duration))) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
 	c.clb = clb
+	c.signalRegistered()
 }
 
+// Close stops the background loop and closes the database connection.
+// Queues obtained from a Manager leave the shared connection open.
 func (c *Queue) Close() error {
+	c.releasePrefetched()
 	c.cancelFunc()
+	err := c.stmts.close()
+	if c.onClose != nil {
+		c.onClose()
+	}
+	if !c.ownsDB {
+		return err
+	}
 	return c.db.Close()
 }
 
 func (c *Queue) process() {
+	held := false  // Whether this loop holds an in-flight slot.
+	gated := false // Whether this loop holds c.running.
 
 	defer func() {
 		if r := recover(); r != nil {
-			fmt.Println("Recovered from panic:", r)
+			if held {
+				c.releaseSlot()
+			}
+			if gated {
+				c.running.RUnlock()
+			}
+			c.cfg.Logger.Println("Recovered from panic:", r)
 			c.process() // Restart subscription on panic
 		}
 	}()
 
+	busy := false // Whether items were delivered since the queue was last found empty.
 	for {
 		select {
 		case <-c.ctx.Done():
-			fmt.Println("Shutting down process loop")
+			c.cfg.Logger.Println("Shutting down process loop")
 			return
 		default:
-			items, err := c.Get(1) // Try to get one item
+			// Take the channel before claiming so an item added in between is not missed.
+			c.mx.Lock()
+			added := c.added
+			registered := c.registered
+			resumed := c.resumed
+			stopped := c.stopped.Load()
+			batch := c.batch
+			selective := len(c.tagged) > 0 || len(c.handlers) > 0
+			listening := c.listening()
+			c.heartbeat = c.cfg.Clock.Now()
+			c.mx.Unlock()
+
+			if stopped {
+				// Processing is halted until StartProcessing.
+				select {
+				case <-resumed:
+				case <-c.ctx.Done():
+				}
+				continue
+			}
+			if !listening {
+				// Nothing to deliver to until a listener is registered.
+				select {
+				case <-registered:
+				case <-c.ctx.Done():
+				}
+				continue
+			}
+
+			limit := 1
+			if batch != nil {
+				limit = batch.size
+			}
+
+			c.reportGauges()
+
+			if wait := c.dispatchWait(); wait > 0 {
+				select {
+				case <-c.cfg.Clock.After(wait): // A pause window is active.
+				case <-c.ctx.Done():
+				}
+				continue
+			}
+
+			// Take the slot before claiming, so leases do not run out while
+			// waiting for other callbacks to finish.
+			if held = c.acquireSlot(c.ctx); !held {
+				continue
+			}
+			// StopProcessing waits for the items claimed from here on to be delivered.
+			c.running.RLock()
+			gated = true
+			if c.stopped.Load() {
+				c.running.RUnlock()
+				gated = false
+				c.releaseSlot()
+				held = false
+				continue
+			}
+			accept := c.routable
+			if !selective {
+				accept = nil // Every item goes to the catch-all or batch listener.
+			}
+			var items []Item
+			var err error
+			if batch != nil {
+				items, err = c.claim(limit, accept) // Try to claim a batch
+			} else {
+				items, err = c.claimNext(accept) // Try to claim a single item
+			}
 			if err != nil {
-				fmt.Println("Error retrieving item:", err)
+				c.running.RUnlock()
+				gated = false
+				c.releaseSlot()
+				held = false
+				c.cfg.Logger.Println("Error retrieving item:", err)
 				continue
 			}
 
 			if len(items) > 0 {
-				for _, item := range items {
-					var delay time.Duration
-					broken := func(sec time.Duration) {
-						delay = sec
+				busy = true
+				if batch != nil {
+					c.dispatchBatch(batch, items)
+				} else {
+					for _, item := range items {
+						c.dispatch(item)
 					}
+				}
+				c.running.RUnlock()
+				gated = false
+				c.releaseSlot()
+				held = false
+			} else {
+				c.running.RUnlock()
+				gated = false
+				c.releaseSlot()
+				held = false
 
-					c.clb(item, broken)
+				if busy {
+					busy = false
+					c.cfg.Hooks.empty()
+				}
 
-					if delay > 0 {
-						fmt.Println("Processing broke, sleeping for 30 seconds")
-						time.Sleep(delay)
-					}
+				// Wake up as soon as an item is added, or an item delayed by
+				// a listener is due; see idleWait.
+				select {
+				case <-added:
+				case <-c.cfg.Clock.After(c.idleWait()):
+				case <-c.ctx.Done():
 				}
-			} else {
-				time.Sleep(2 * time.Second)
 			}
 		}
 	}
 }
+
+// dispatch hands a claimed item to the listener and acknowledges it afterwards.
+func (c *Queue) dispatch(item Item) {
+	c.mx.Lock()
+	clb := c.route(item)
+	c.mx.Unlock()
+
+	c.handle(item, clb)
+}
+
+// handle passes a claimed item to clb, wrapped in the Handle middleware, and
+// acknowledges or releases it afterwards.
+func (c *Queue) handle(item Item, clb Handler) {
+	defer func() {
+		if r := recover(); r != nil {
+			c.mx.Lock()
+			delete(c.completions, item.ID) // The failed attempt must not commit what it recorded.
+			c.mx.Unlock()
+			c.abandon(item, r) // Let the item be delivered again after the loop restarts.
+			panic(r)
+		}
+	}()
+
+	var delay time.Duration
+	broken := func(sec time.Duration) {
+		delay = sec
+	}
+
+	c.mx.Lock()
+	clb = c.wrapHandler(clb)
+	c.mx.Unlock()
+
+	start := c.cfg.Clock.Now()
+	clb(item, broken)
+	c.observeProcessing(c.cfg.Clock.Now().Sub(start))
+
+	c.mx.Lock()
+	done := c.completions[item.ID]
+	delete(c.completions, item.ID)
+	c.mx.Unlock()
+
+	if done != nil && done.settled {
+		return // Acknowledged in the transaction of the handler, or delivered again.
+	}
+
+	if c.cfg.Delivery == AtMostOnce {
+		// The item was removed when it was claimed, whatever the outcome.
+		if delay > 0 || (done != nil && done.retry != nil) {
+			c.cfg.Logger.Println("Processing broke, dropping item delivered at most once:", item.ID)
+			return
+		}
+		c.count(MetricAcked, 1)
+		return
+	}
+
+	retry := delay > 0
+	if !retry && done != nil && done.retry != nil {
+		giveUp := done.skipRetry
+		if !giveUp {
+			delay, giveUp = c.retryPolicy().NextDelay(item.Attempts, done.retry)
+		}
+		if giveUp {
+			c.cfg.Logger.Println("Processing failed, giving up:", done.retry)
+			c.giveUp(item)
+			return
+		}
+		retry = true
+	}
+
+	if retry {
+		c.cfg.Hooks.failure(item, delay)
+		c.count(MetricRetried, 1)
+		c.cfg.Logger.Println("Processing broke, retrying in", delay)
+		c.retryLater(item, delay)
+		return
+	}
+
+	// Acknowledge only this delivery: once the lease expired and the item was
+	// claimed again, the newer delivery must not be removed under its consumer.
+	if done == nil {
+		done = &completion{}
+	}
+	if nonce, ok := deliveryNonce(item).(string); ok {
+		done.receipt = nonce
+	}
+	switch err := c.ackWith(item.ID, *done); {
+	case errors.Is(err, ErrItemNotFound):
+		c.cfg.Logger.Println("Lease expired before the item was acknowledged:", item.ID)
+	case err != nil:
+		c.cfg.Logger.Println("Error acknowledging item:", err)
+	}
+}
@@ -1,6 +1,8 @@
 package queue
 
 import (
+	"database/sql"
+	"path/filepath"
 	"testing"
 	"time"
 )
@@ -139,19 +141,15 @@ func TestCallbackInvocation(t *testing.T) {
 		callbackInvocations <- item
 	})
 
-	// Give some time for the processing goroutine to execute
-	time.Sleep(5 * time.Second) // Adjust the sleep time as necessary for your environment
-
-	close(callbackInvocations)
-
-	// Verify that each item was processed
+	// Wait for both callbacks instead of sleeping a fixed time
 	processedItems := []string{}
-	for item := range callbackInvocations {
-		processedItems = append(processedItems, string(item.Data))
-	}
-
-	if len(processedItems) != 2 {
-		t.Fatalf("expected 2 callbacks, got %d", len(processedItems))
+	for len(processedItems) < 2 {
+		select {
+		case item := <-callbackInvocations:
+			processedItems = append(processedItems, string(item.Data))
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expected 2 callbacks, got %d", len(processedItems))
+		}
 	}
 
 	expectedItems := []string{"test data 1", "test data 2"}
@@ -161,3 +159,101 @@ func TestCallbackInvocation(t *testing.T) {
 		}
 	}
 }
+
+func BenchmarkQueue_Add(b *testing.B) {
+	queue, err := New(Config{})
+	if err != nil {
+		b.Fatalf("failed to initialize queue: %v", err)
+	}
+	defer queue.Close()
+
+	data := []byte("benchmark data")
+	for i := 0; i < b.N; i++ {
+		if err := queue.Add(data); err != nil {
+			b.Fatalf("failed to add item to queue: %v", err)
+		}
+	}
+}
+
+func BenchmarkQueue_AddGetDelete(b *testing.B) {
+	queue, err := New(Config{})
+	if err != nil {
+		b.Fatalf("failed to initialize queue: %v", err)
+	}
+	defer queue.Close()
+
+	data := []byte("benchmark data")
+	for i := 0; i < b.N; i++ {
+		if err := queue.Add(data); err != nil {
+			b.Fatalf("failed to add item to queue: %v", err)
+		}
+		items, err := queue.Get(1)
+		if err != nil || len(items) != 1 {
+			b.Fatalf("failed to get item from queue: %v", err)
+		}
+		if err := queue.Delete(items[0].ID); err != nil {
+			b.Fatalf("failed to delete item from queue: %v", err)
+		}
+	}
+}
+
+func TestNewWithDB(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "app.db"))
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	queue, err := NewWithDB(db, Config{Table: "jobs"})
+	if err != nil {
+		t.Fatalf("failed to initialize queue: %v", err)
+	}
+
+	if err := queue.Add([]byte("test data")); err != nil {
+		t.Fatalf("failed to add item to queue: %v", err)
+	}
+	queue.Close()
+
+	// The application's connection stays open and sees the queue table.
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM jobs").Scan(&count); err != nil {
+		t.Fatalf("failed to query queue table: %v", err)
+	}
+	if count != 1 {
+		t.Fatalf("expected 1 item, got %d", count)
+	}
+}
+
+func TestDelayDoesNotBlock(t *testing.T) {
+	queue := setupQueue(t, Config{})
+	defer queue.Close()
+
+	for _, data := range []string{"slow", "fast"} {
+		if err := queue.Add([]byte(data)); err != nil {
+			t.Fatalf("failed to add item to queue: %v", err)
+		}
+	}
+
+	processed := make(chan string, 2)
+	queue.Listener(func(item Item, delay func(sec time.Duration)) {
+		if string(item.Data) == "slow" {
+			delay(time.Hour)
+			return
+		}
+		processed <- string(item.Data)
+	})
+
+	select {
+	case data := <-processed:
+		if data != "fast" {
+			t.Fatalf("expected the fast item, got %s", data)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected the delayed item not to hold back the next one")
+	}
+
+	jobs, err := queue.ScheduledJobs(10)
+	if err != nil || len(jobs) != 1 || string(jobs[0].Data) != "slow" {
+		t.Fatalf("expected the delayed item to wait for its retry, got %+v, %v", jobs, err)
+	}
+}
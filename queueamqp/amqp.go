@@ -0,0 +1,95 @@
+// Package queueamqp forwards queue items to a RabbitMQ exchange using publisher
+// confirms. Run the Sink with queuebridge.Forwarder: an item is acknowledged,
+// and so deleted locally, only after the broker confirmed the message, which
+// turns the queue into a reliable outbound buffer.
+package queueamqp
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/elum-utils/queue"
+	"github.com/elum-utils/queue/queuebridge"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// TagsHeader is the AMQP header carrying the tags of an item as an array.
+const TagsHeader = "queue-tags"
+
+// ErrNacked is returned when the broker refused to take responsibility for a message.
+var ErrNacked = errors.New("queueamqp: message nacked by broker")
+
+// Config represents configuration options for a Sink.
+type Config struct {
+	Exchange    string // Exchange the items are published to; empty selects the default exchange.
+	RoutingKey  string // Routing key of the published messages, e.g. a queue name for the default exchange.
+	Mandatory   bool   // Ask the broker to return messages that cannot be routed.
+	ContentType string // Content type of the published messages.
+
+	// MessageIDPrefix sets the message ID to MessageIDPrefix + item ID so
+	// consumers can detect items published again after a lost confirmation.
+	MessageIDPrefix string
+}
+
+// publishFunc publishes a message and returns a function waiting for its confirmation.
+type publishFunc func(ctx context.Context, exchange, key string, mandatory bool, msg amqp.Publishing) (func(ctx context.Context) (bool, error), error)
+
+// Sink publishes items to RabbitMQ and waits for each publisher confirm.
+type Sink struct {
+	publish publishFunc
+	cfg     Config
+}
+
+var _ queuebridge.Publisher = (*Sink)(nil)
+
+// NewSink puts ch into confirm mode and returns a Sink publishing through it.
+// The channel must not be used for other publishing while the sink uses it.
+func NewSink(ch *amqp.Channel, config Config) (*Sink, error) {
+	if err := ch.Confirm(false); err != nil {
+		return nil, err
+	}
+
+	publish := func(ctx context.Context, exchange, key string, mandatory bool, msg amqp.Publishing) (func(ctx context.Context) (bool, error), error) {
+		confirmation, err := ch.PublishWithDeferredConfirmWithContext(ctx, exchange, key, mandatory, false, msg)
+		if err != nil {
+			return nil, err
+		}
+		return confirmation.WaitContext, nil
+	}
+	return &Sink{publish: publish, cfg: config}, nil
+}
+
+// Publish sends the item as a persistent message and waits until the broker
+// confirms it. It returns ErrNacked if the broker rejects the message.
+func (s *Sink) Publish(ctx context.Context, item queue.Item) error {
+	msg := amqp.Publishing{
+		DeliveryMode: amqp.Persistent,
+		ContentType:  s.cfg.ContentType,
+		Body:         item.Data,
+	}
+	if len(item.Tags) > 0 {
+		tags := make([]any, len(item.Tags))
+		for i, tag := range item.Tags {
+			tags[i] = tag
+		}
+		msg.Headers = amqp.Table{TagsHeader: tags}
+	}
+	if s.cfg.MessageIDPrefix != "" {
+		msg.MessageId = s.cfg.MessageIDPrefix + strconv.Itoa(item.ID)
+	}
+
+	wait, err := s.publish(ctx, s.cfg.Exchange, s.cfg.RoutingKey, s.cfg.Mandatory, msg)
+	if err != nil {
+		return err
+	}
+
+	acked, err := wait(ctx)
+	if err != nil {
+		return err
+	}
+	if !acked {
+		return ErrNacked
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package queueamqp
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/elum-utils/queue"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// fakeBroker records published messages and confirms them with ack.
+func fakeBroker(ack bool, published *[]amqp.Publishing) publishFunc {
+	return func(ctx context.Context, exchange, key string, mandatory bool, msg amqp.Publishing) (func(ctx context.Context) (bool, error), error) {
+		*published = append(*published, msg)
+		return func(ctx context.Context) (bool, error) { return ack, nil }, nil
+	}
+}
+
+func TestPublish(t *testing.T) {
+	var published []amqp.Publishing
+	sink := &Sink{publish: fakeBroker(true, &published), cfg: Config{MessageIDPrefix: "orders/"}}
+
+	item := queue.Item{ID: 3, Data: []byte("hello"), Tags: []string{"email"}}
+	if err := sink.Publish(context.Background(), item); err != nil {
+		t.Fatalf("failed to publish: %v", err)
+	}
+
+	msg := published[0]
+	if string(msg.Body) != "hello" || msg.MessageId != "orders/3" || msg.DeliveryMode != amqp.Persistent {
+		t.Fatalf("unexpected message: %+v", msg)
+	}
+	if tags, ok := msg.Headers[TagsHeader].([]any); !ok || tags[0] != "email" {
+		t.Fatalf("unexpected tags header: %v", msg.Headers)
+	}
+}
+
+func TestPublishNacked(t *testing.T) {
+	var published []amqp.Publishing
+	sink := &Sink{publish: fakeBroker(false, &published)}
+
+	err := sink.Publish(context.Background(), queue.Item{ID: 1, Data: []byte("hello")})
+	if !errors.Is(err, ErrNacked) {
+		t.Fatalf("expected ErrNacked, got %v", err)
+	}
+}
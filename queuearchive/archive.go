@@ -0,0 +1,226 @@
+// Package queuearchive keeps queue files small while retaining history. An
+// Archiver periodically uploads dead letters older than a retention period to
+// object storage as gzip-compressed JSON Lines, one queue.Record per line, and
+// deletes them from the queue once the upload succeeded.
+//
+// S3Store writes the archives to Amazon S3 or any S3-compatible service such
+// as MinIO; other destinations only need to implement Store.
+package queuearchive
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/elum-utils/queue"
+)
+
+// Store writes archive objects. Put must return only once the object is
+// durably stored, as the archived items are deleted right after.
+type Store interface {
+	Put(ctx context.Context, key string, body []byte) error
+}
+
+// ErasableStore is a Store that can also read back and delete its objects,
+// which Archiver.Erase needs to rewrite them.
+type ErasableStore interface {
+	Store
+	List(ctx context.Context, prefix string) ([]string, error)
+	Get(ctx context.Context, key string) ([]byte, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// Config represents configuration options for an Archiver.
+type Config struct {
+	Prefix    string        // Prepended to every object key, e.g. "queues/emails/".
+	OlderThan time.Duration // How long dead letters stay in the queue before they are archived.
+	Interval  time.Duration // Pause between archive passes in Run.
+	BatchSize int           // Items per archive object.
+	Logger    queue.Logger  // Receives the errors of Run; nil uses Queue.Logger.
+}
+
+// configDefault fills in the settings left empty in the provided configuration.
+func configDefault(config ...Config) Config {
+	cfg := Config{}
+	if len(config) > 0 {
+		cfg = config[0]
+	}
+
+	if cfg.OlderThan <= 0 {
+		cfg.OlderThan = 30 * 24 * time.Hour
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = time.Hour
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 1000
+	}
+	return cfg
+}
+
+// Archiver moves old dead letters from a queue to a Store.
+type Archiver struct {
+	queue *queue.Queue
+	store Store
+	cfg   Config
+}
+
+// New returns an Archiver moving the old dead letters of q to store.
+func New(q *queue.Queue, store Store, config ...Config) *Archiver {
+	cfg := configDefault(config...)
+	if cfg.Logger == nil {
+		cfg.Logger = q.Logger()
+	}
+	return &Archiver{queue: q, store: store, cfg: cfg}
+}
+
+// Run archives old dead letters right away and then every Config.Interval
+// until ctx is done. Failed passes are logged and retried on the next tick.
+func (a *Archiver) Run(ctx context.Context) error {
+	ticker := time.NewTicker(a.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := a.ArchiveOnce(ctx); err != nil && ctx.Err() == nil {
+			a.cfg.Logger.Println("Error archiving dead letters:", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// ArchiveOnce archives every dead letter older than Config.OlderThan, writing
+// one object per Config.BatchSize items, and returns the number of archived
+// items.
+func (a *Archiver) ArchiveOnce(ctx context.Context) (int, error) {
+	before := time.Now().Add(-a.cfg.OlderThan)
+
+	total := 0
+	for {
+		n, err := a.queue.Archive(ctx, before, a.cfg.BatchSize, a.put)
+		total += n
+		if err != nil || n < a.cfg.BatchSize {
+			return total, err
+		}
+	}
+}
+
+// put compresses the records and writes them to the store. The key is derived
+// from the item IDs, so retrying a batch whose deletion failed overwrites the
+// earlier object instead of duplicating it.
+func (a *Archiver) put(ctx context.Context, records []queue.Record) error {
+	body, err := encode(records)
+	if err != nil {
+		return err
+	}
+
+	key := fmt.Sprintf("%s%s/%020d-%020d.jsonl.gz",
+		a.cfg.Prefix, time.Now().UTC().Format("2006/01/02"), records[0].ID, records[len(records)-1].ID)
+	return a.store.Put(ctx, key, body)
+}
+
+// encode returns the records as gzip-compressed JSON Lines.
+func encode(records []queue.Record) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+
+	encoder := json.NewEncoder(zw)
+	for _, r := range records {
+		if err := encoder.Encode(r); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Erase rewrites the archive objects under Config.Prefix without the records
+// tagged with queue.SubjectTag(subject) or naming subject in their
+// queue.SubjectHeader, or with their payloads emptied if mode is
+// queue.EraseRedact, and returns the number of records erased. Objects left
+// without records are deleted. Use it along with queue.Admin.Erase, which
+// only reaches the items still in the queue. The store must implement
+// ErasableStore.
+func (a *Archiver) Erase(ctx context.Context, subject string, mode queue.ErasureMode) (int, error) {
+	store, ok := a.store.(ErasableStore)
+	if !ok {
+		return 0, fmt.Errorf("queuearchive: %T cannot read back objects to erase them", a.store)
+	}
+
+	keys, err := store.List(ctx, a.cfg.Prefix)
+	if err != nil {
+		return 0, err
+	}
+
+	tag := queue.SubjectTag(subject)
+	erased := 0
+	for _, key := range keys {
+		body, err := store.Get(ctx, key)
+		if err != nil {
+			return erased, err
+		}
+		records, err := decode(body)
+		if err != nil {
+			return erased, fmt.Errorf("queuearchive: reading %s: %w", key, err)
+		}
+
+		kept := records[:0]
+		n := 0
+		for _, r := range records {
+			if !slices.Contains(r.Tags, tag) && r.Headers[queue.SubjectHeader] != subject {
+				kept = append(kept, r)
+				continue
+			}
+			n++
+			if mode == queue.EraseRedact {
+				r.Data = []byte{}
+				kept = append(kept, r)
+			}
+		}
+		if n == 0 {
+			continue
+		}
+
+		if len(kept) == 0 {
+			err = store.Delete(ctx, key)
+		} else if body, err = encode(kept); err == nil {
+			err = store.Put(ctx, key, body)
+		}
+		if err != nil {
+			return erased, err
+		}
+		erased += n
+	}
+	return erased, nil
+}
+
+// decode returns the records of an archive object written by encode.
+func decode(body []byte) ([]queue.Record, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	var records []queue.Record
+	scanner := bufio.NewScanner(zr)
+	scanner.Buffer(nil, 64<<20) // Records hold whole payloads.
+	for scanner.Scan() {
+		var r queue.Record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			return nil, err
+		}
+		records = append(records, r)
+	}
+	return records, scanner.Err()
+}
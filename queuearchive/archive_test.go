@@ -0,0 +1,221 @@
+package queuearchive
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/elum-utils/queue"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// memoryStore keeps the archive objects in memory.
+type memoryStore struct {
+	mx      sync.Mutex
+	objects map[string][]byte
+}
+
+func (s *memoryStore) Put(ctx context.Context, key string, body []byte) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	s.objects[key] = body
+	return nil
+}
+
+func (s *memoryStore) List(ctx context.Context, prefix string) ([]string, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	var keys []string
+	for key := range s.objects {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+func (s *memoryStore) Get(ctx context.Context, key string) ([]byte, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	return s.objects[key], nil
+}
+
+func (s *memoryStore) Delete(ctx context.Context, key string) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	delete(s.objects, key)
+	return nil
+}
+
+// setupQueue returns a queue holding the given number of dead letters.
+func setupQueue(t *testing.T, dead int) *queue.Queue {
+	t.Helper()
+	q, err := queue.New(queue.Config{MaxAttempts: 1, LeaseTimeout: time.Millisecond})
+	if err != nil {
+		t.Fatalf("failed to initialize queue: %v", err)
+	}
+	t.Cleanup(func() { q.Close() })
+
+	for i := 0; i < dead; i++ {
+		if err := q.AddTagged([]byte("payload"), "email"); err != nil {
+			t.Fatalf("failed to add item: %v", err)
+		}
+	}
+
+	// Claim the items, let the leases expire and claim again to dead-letter them.
+	if _, err := q.Claim(dead); err != nil {
+		t.Fatalf("failed to claim items: %v", err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if _, err := q.Claim(dead); err != nil {
+		t.Fatalf("failed to claim items: %v", err)
+	}
+	return q
+}
+
+// decodeObject returns the records of an archive object.
+func decodeObject(t *testing.T, body []byte) []queue.Record {
+	t.Helper()
+	records, err := decode(body)
+	if err != nil {
+		t.Fatalf("failed to decode archive: %v", err)
+	}
+	return records
+}
+
+func TestArchiveOnce(t *testing.T) {
+	q := setupQueue(t, 5)
+	store := &memoryStore{objects: map[string][]byte{}}
+
+	// A long retention keeps the fresh dead letters in the queue.
+	archived, err := New(q, store).ArchiveOnce(context.Background())
+	if err != nil || archived != 0 {
+		t.Fatalf("expected nothing to archive, got %d, %v", archived, err)
+	}
+
+	archiver := New(q, store, Config{Prefix: "emails/", OlderThan: time.Nanosecond, BatchSize: 2})
+	archived, err = archiver.ArchiveOnce(context.Background())
+	if err != nil {
+		t.Fatalf("failed to archive: %v", err)
+	}
+	if archived != 5 || len(store.objects) != 3 {
+		t.Fatalf("expected 5 items in 3 objects, got %d in %d", archived, len(store.objects))
+	}
+
+	total := 0
+	for key, body := range store.objects {
+		if !strings.HasPrefix(key, "emails/") || !strings.HasSuffix(key, ".jsonl.gz") {
+			t.Fatalf("unexpected key %q", key)
+		}
+		for _, r := range decodeObject(t, body) {
+			if string(r.Data) != "payload" || r.Tags[0] != "email" || r.State != queue.StateDead {
+				t.Fatalf("unexpected record: %+v", r)
+			}
+			total++
+		}
+	}
+	if total != 5 {
+		t.Fatalf("expected 5 archived records, got %d", total)
+	}
+
+	stats, err := q.Stats()
+	if err != nil {
+		t.Fatalf("failed to read stats: %v", err)
+	}
+	if stats.Dead != 0 {
+		t.Fatalf("expected the dead letters to be pruned, got %+v", stats)
+	}
+}
+
+func TestS3Store(t *testing.T) {
+	var mx sync.Mutex
+	uploads := map[string][]byte{}
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		mx.Lock()
+		uploads[r.URL.Path] = body
+		mx.Unlock()
+		w.Header().Set("ETag", `"etag"`)
+	}))
+	defer server.Close()
+
+	client, err := minio.New(strings.TrimPrefix(server.URL, "https://"), &minio.Options{
+		Creds:     credentials.NewStaticV4("access", "secret", ""),
+		Region:    "us-east-1",
+		Secure:    true,
+		Transport: server.Client().Transport,
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	q := setupQueue(t, 1)
+	archived, err := New(q, NewS3Store(client, "archive"), Config{OlderThan: time.Nanosecond}).ArchiveOnce(context.Background())
+	if err != nil || archived != 1 {
+		t.Fatalf("expected 1 archived item, got %d, %v", archived, err)
+	}
+
+	mx.Lock()
+	defer mx.Unlock()
+	if len(uploads) != 1 {
+		t.Fatalf("expected 1 upload, got %d", len(uploads))
+	}
+	for path, body := range uploads {
+		if !strings.HasPrefix(path, "/archive/") {
+			t.Fatalf("unexpected object path %q", path)
+		}
+		if records := decodeObject(t, body); len(records) != 1 {
+			t.Fatalf("unexpected records: %+v", records)
+		}
+	}
+}
+
+func TestErase(t *testing.T) {
+	q := setupQueue(t, 0)
+	subject := queue.SubjectTag("user-42")
+	store := &memoryStore{objects: map[string][]byte{}}
+	for key, records := range map[string][]queue.Record{
+		"emails/1.jsonl.gz": {{ID: 1, Headers: map[string]string{queue.SubjectHeader: "user-42"}, Data: []byte("a")}},
+		"emails/2.jsonl.gz": {{ID: 2, Tags: []string{subject}, Data: []byte("b")}, {ID: 3, Tags: []string{"email"}, Data: []byte("c")}},
+		"emails/3.jsonl.gz": {{ID: 4, Tags: []string{"email"}, Data: []byte("d")}},
+	} {
+		body, err := encode(records)
+		if err != nil {
+			t.Fatalf("failed to encode records: %v", err)
+		}
+		store.objects[key] = body
+	}
+
+	archiver := New(q, store, Config{Prefix: "emails/"})
+	erased, err := archiver.Erase(context.Background(), "user-42", queue.EraseDelete)
+	if err != nil || erased != 2 {
+		t.Fatalf("expected 2 erased records, got %d, %v", erased, err)
+	}
+	if len(store.objects) != 2 {
+		t.Fatalf("expected the emptied object to be deleted, got %d objects", len(store.objects))
+	}
+	if records := decodeObject(t, store.objects["emails/2.jsonl.gz"]); len(records) != 1 || records[0].ID != 3 {
+		t.Fatalf("expected only the record of another subject to remain, got %+v", records)
+	}
+
+	if _, err := New(q, storeFunc(nil)).Erase(context.Background(), "user-42", queue.EraseDelete); err == nil {
+		t.Fatalf("expected an error for a store that cannot be read back")
+	}
+}
+
+// storeFunc is a Store that can only write.
+type storeFunc func(ctx context.Context, key string, body []byte) error
+
+func (f storeFunc) Put(ctx context.Context, key string, body []byte) error {
+	return f(ctx, key, body)
+}
@@ -0,0 +1,63 @@
+package queuearchive
+
+import (
+	"bytes"
+	"context"
+	"io"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// S3Store writes archive objects to a bucket of Amazon S3 or an S3-compatible
+// service.
+type S3Store struct {
+	client *minio.Client
+	bucket string
+}
+
+var _ ErasableStore = (*S3Store)(nil)
+
+// NewS3Store returns a Store writing to the bucket through client, e.g.
+//
+//	client, err := minio.New("s3.amazonaws.com", &minio.Options{
+//		Creds:  credentials.NewStaticV4(accessKey, secretKey, ""),
+//		Secure: true,
+//	})
+func NewS3Store(client *minio.Client, bucket string) *S3Store {
+	return &S3Store{client: client, bucket: bucket}
+}
+
+// Put uploads the object to the bucket.
+func (s *S3Store) Put(ctx context.Context, key string, body []byte) error {
+	_, err := s.client.PutObject(ctx, s.bucket, key, bytes.NewReader(body), int64(len(body)), minio.PutObjectOptions{
+		ContentType: "application/gzip",
+	})
+	return err
+}
+
+// List returns the keys of the objects in the bucket starting with prefix.
+func (s *S3Store) List(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	for object := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if object.Err != nil {
+			return nil, object.Err
+		}
+		keys = append(keys, object.Key)
+	}
+	return keys, nil
+}
+
+// Get downloads the object from the bucket.
+func (s *S3Store) Get(ctx context.Context, key string) ([]byte, error) {
+	object, err := s.client.GetObject(ctx, s.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	defer object.Close()
+	return io.ReadAll(object)
+}
+
+// Delete removes the object from the bucket.
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+	return s.client.RemoveObject(ctx, s.bucket, key, minio.RemoveObjectOptions{})
+}
@@ -0,0 +1,63 @@
+package queueauth
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"testing"
+)
+
+func TestAuthorizeToken(t *testing.T) {
+	auth := New(Config{Tokens: map[string]Permission{
+		"producer": PermEnqueue,
+		"operator": PermAll,
+	}})
+
+	if err := auth.Authorize("producer", nil, PermEnqueue); err != nil {
+		t.Fatalf("expected producer to enqueue, got %v", err)
+	}
+	if err := auth.Authorize("producer", nil, PermAdmin); !errors.Is(err, ErrPermissionDenied) {
+		t.Fatalf("expected ErrPermissionDenied, got %v", err)
+	}
+	if err := auth.Authorize("operator", nil, PermAdmin|PermRead); err != nil {
+		t.Fatalf("expected operator to administer, got %v", err)
+	}
+	if err := auth.Authorize("guess", nil, PermRead); !errors.Is(err, ErrUnauthenticated) {
+		t.Fatalf("expected ErrUnauthenticated, got %v", err)
+	}
+
+	var disabled *Authenticator
+	if err := disabled.Authorize("", nil, PermAll); err != nil {
+		t.Fatalf("expected a nil authenticator to allow everything, got %v", err)
+	}
+}
+
+func TestAuthorizeClientCert(t *testing.T) {
+	auth := New(Config{ClientCerts: map[string]Permission{"worker": PermConsume}})
+
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "worker"}}
+	verified := &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+	if err := auth.Authorize("", verified, PermConsume); err != nil {
+		t.Fatalf("expected worker to consume, got %v", err)
+	}
+
+	// Certificates that were presented but not verified do not count.
+	unverified := &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+	if err := auth.Authorize("", unverified, PermConsume); !errors.Is(err, ErrUnauthenticated) {
+		t.Fatalf("expected ErrUnauthenticated, got %v", err)
+	}
+}
+
+func TestBearerToken(t *testing.T) {
+	for header, want := range map[string]string{
+		"Bearer secret": "secret",
+		"bearer secret": "secret",
+		"Basic secret":  "",
+		"":              "",
+	} {
+		if got := BearerToken(header); got != want {
+			t.Fatalf("BearerToken(%q) = %q, want %q", header, got, want)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package queueauth
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"os"
+)
+
+// TLSConfig builds the TLS configuration of a network listener. Base is
+// cloned when set; otherwise a configuration requiring TLS 1.2 is created.
+// The certificate and key files are loaded when given. Client certificates
+// signed by the CAs in clientCAFile are verified if presented, so they can be
+// used with Config.ClientCerts while token-only clients keep working.
+func TLSConfig(base *tls.Config, certFile, keyFile, clientCAFile string) (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if base != nil {
+		cfg = base.Clone()
+	}
+
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Certificates = append(cfg.Certificates, cert)
+	}
+
+	if clientCAFile != "" {
+		pem, err := os.ReadFile(clientCAFile)
+		if err != nil {
+			return nil, err
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("queueauth: no certificates found in " + clientCAFile)
+		}
+		cfg.ClientCAs = pool
+		if cfg.ClientAuth == tls.NoClientCert {
+			cfg.ClientAuth = tls.VerifyClientCertIfGiven
+		}
+	}
+
+	if len(cfg.Certificates) == 0 && cfg.GetCertificate == nil && cfg.GetConfigForClient == nil {
+		return nil, errors.New("queueauth: TLS configuration has no server certificate")
+	}
+	return cfg, nil
+}
@@ -0,0 +1,75 @@
+package queueauth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeCert writes a self-signed certificate and its key to dir.
+func writeCert(t *testing.T, dir string) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "queue"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("failed to marshal key: %v", err)
+	}
+
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600)
+	return certFile, keyFile
+}
+
+func TestTLSConfig(t *testing.T) {
+	certFile, keyFile := writeCert(t, t.TempDir())
+
+	cfg, err := TLSConfig(nil, certFile, keyFile, certFile)
+	if err != nil {
+		t.Fatalf("failed to build TLS config: %v", err)
+	}
+	if len(cfg.Certificates) != 1 || cfg.ClientCAs == nil || cfg.ClientAuth != tls.VerifyClientCertIfGiven {
+		t.Fatalf("unexpected TLS config: %+v", cfg)
+	}
+
+	// A stricter client policy set on the base configuration is kept.
+	base := &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert}
+	cfg, err = TLSConfig(base, certFile, keyFile, certFile)
+	if err != nil {
+		t.Fatalf("failed to build TLS config: %v", err)
+	}
+	if cfg.ClientAuth != tls.RequireAndVerifyClientCert || len(base.Certificates) != 0 {
+		t.Fatalf("expected the base config to be cloned and kept")
+	}
+
+	if _, err := TLSConfig(&tls.Config{}, "", "", ""); err == nil {
+		t.Fatalf("expected an error without a server certificate")
+	}
+}
@@ -0,0 +1,272 @@
+// Package queuebench drives a configurable producer and consumer load
+// against a queue and reports the throughput and latency distributions it
+// achieved, so the performance of releases can be compared. The queuebench
+// command runs it from the command line.
+//
+// Run registers the catch-all Listener of the queue it is given, so the
+// queue should be dedicated to the benchmark. How the queue consumes, such as
+// Workers, ClaimBatchSize and RetryPolicy, is configured on the queue itself.
+package queuebench
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/elum-utils/queue"
+)
+
+// errInjected is the failure reported to the queue for deliveries picked by
+// Config.FailureRate.
+var errInjected = errors.New("queuebench: injected failure")
+
+// Config describes the load of a benchmark.
+type Config struct {
+	Duration    time.Duration // How long the producers add items; 0 means ten seconds, unless Items is set.
+	Items       int           // Number of items to add, instead of adding them for Duration.
+	PayloadSize int           // Bytes per payload, at least the 8 bytes holding the enqueue time; 0 means 256.
+	Producers   int           // Goroutines adding items at once; 0 means 1.
+	Rate        float64       // Items added per second across all producers; 0 means as fast as possible.
+	Work        time.Duration // Simulated processing time per delivery.
+	FailureRate float64       // Fraction of deliveries, from 0 to 1, that fail and are retried with queue.Retry.
+	Drain       time.Duration // How long to wait for the consumers to catch up once producing stopped; 0 means 30 seconds.
+}
+
+// Report summarizes a benchmark run.
+type Report struct {
+	Produced int64         `json:"produced"` // Items added.
+	Consumed int64         `json:"consumed"` // Items processed successfully.
+	Failed   int64         `json:"failed"`   // Deliveries that failed on purpose.
+	Elapsed  time.Duration `json:"elapsed"`  // Time from the first item added to the last one processed.
+
+	ProduceRate float64 `json:"produce_rate"` // Items added per second.
+	ConsumeRate float64 `json:"consume_rate"` // Items processed per second.
+
+	Enqueue  Distribution `json:"enqueue"`    // Time taken by Add.
+	EndToEnd Distribution `json:"end_to_end"` // Time from Add to the successful delivery, including retries.
+}
+
+// Distribution summarizes a set of durations.
+type Distribution struct {
+	Count int64         `json:"count"`
+	Mean  time.Duration `json:"mean"`
+	P50   time.Duration `json:"p50"`
+	P90   time.Duration `json:"p90"`
+	P99   time.Duration `json:"p99"`
+	Max   time.Duration `json:"max"`
+}
+
+// String formats the distribution on a single line.
+func (d Distribution) String() string {
+	return fmt.Sprintf("n=%d mean=%v p50=%v p90=%v p99=%v max=%v", d.Count, d.Mean, d.P50, d.P90, d.P99, d.Max)
+}
+
+// String formats the report for a terminal.
+func (r Report) String() string {
+	return fmt.Sprintf(
+		"produced  %d items, %.1f/s\nconsumed  %d items, %.1f/s, %d failed deliveries\nelapsed   %v\nenqueue   %v\nend2end   %v\n",
+		r.Produced, r.ProduceRate, r.Consumed, r.ConsumeRate, r.Failed, r.Elapsed, r.Enqueue, r.EndToEnd,
+	)
+}
+
+// configDefault fills in the defaults of a Config.
+func configDefault(cfg Config) Config {
+	if cfg.Duration <= 0 && cfg.Items <= 0 {
+		cfg.Duration = 10 * time.Second
+	}
+	if cfg.PayloadSize <= 0 {
+		cfg.PayloadSize = 256
+	}
+	cfg.PayloadSize = max(cfg.PayloadSize, 8)
+	if cfg.Producers <= 0 {
+		cfg.Producers = 1
+	}
+	if cfg.Drain <= 0 {
+		cfg.Drain = 30 * time.Second
+	}
+	return cfg
+}
+
+// samples collects durations from several goroutines.
+type samples struct {
+	mx     sync.Mutex
+	values []time.Duration
+}
+
+func (s *samples) add(d time.Duration) {
+	s.mx.Lock()
+	s.values = append(s.values, d)
+	s.mx.Unlock()
+}
+
+// distribution summarizes the collected durations.
+func (s *samples) distribution() Distribution {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	if len(s.values) == 0 {
+		return Distribution{}
+	}
+	slices.Sort(s.values)
+
+	var total time.Duration
+	for _, v := range s.values {
+		total += v
+	}
+	n := len(s.values)
+	at := func(q float64) time.Duration {
+		return s.values[min(int(q*float64(n)), n-1)]
+	}
+	return Distribution{
+		Count: int64(n),
+		Mean:  total / time.Duration(n),
+		P50:   at(0.50),
+		P90:   at(0.90),
+		P99:   at(0.99),
+		Max:   s.values[n-1],
+	}
+}
+
+// Run adds items to q as described by cfg while consuming them with a
+// listener, until the producers are done and the consumers caught up, the
+// drain period passed, or ctx is done. It returns the report of the run along
+// with ctx.Err() if ctx ended it early.
+func Run(ctx context.Context, q *queue.Queue, cfg Config) (Report, error) {
+	cfg = configDefault(cfg)
+
+	var produced, consumed, failed atomic.Int64
+	var enqueue, endToEnd samples
+	var last atomic.Int64 // Unix nanoseconds of the last successful delivery.
+	caughtUp := make(chan struct{}, 1)
+	producing := atomic.Bool{}
+	producing.Store(true)
+
+	q.Listener(func(item queue.Item, delay func(sec time.Duration)) {
+		if cfg.Work > 0 {
+			time.Sleep(cfg.Work)
+		}
+		if cfg.FailureRate > 0 && rand.Float64() < cfg.FailureRate {
+			failed.Add(1)
+			q.Retry(item.ID, errInjected)
+			return
+		}
+
+		now := time.Now()
+		if len(item.Data) >= 8 {
+			endToEnd.add(now.Sub(time.Unix(0, int64(binary.BigEndian.Uint64(item.Data)))))
+		}
+		last.Store(now.UnixNano())
+		if consumed.Add(1) >= produced.Load() && !producing.Load() {
+			select {
+			case caughtUp <- struct{}{}:
+			default:
+			}
+		}
+	})
+
+	start := time.Now()
+	produceCtx, stop := context.WithCancel(ctx)
+	defer stop()
+	if cfg.Duration > 0 && cfg.Items <= 0 {
+		produceCtx, stop = context.WithTimeout(ctx, cfg.Duration)
+		defer stop()
+	}
+
+	// The producers share a budget of items and a pace.
+	var budget atomic.Int64
+	budget.Store(int64(cfg.Items))
+	var interval time.Duration
+	if cfg.Rate > 0 {
+		interval = time.Duration(float64(time.Second) / cfg.Rate)
+	}
+	var next atomic.Int64 // Unix nanoseconds at which the next item is due.
+	next.Store(start.UnixNano())
+
+	var wg sync.WaitGroup
+	var produceErr error
+	var errOnce sync.Once
+	for i := 0; i < cfg.Producers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			payload := make([]byte, cfg.PayloadSize)
+			for produceCtx.Err() == nil {
+				if cfg.Items > 0 && budget.Add(-1) < 0 {
+					return
+				}
+				if interval > 0 {
+					due := time.Unix(0, next.Add(int64(interval))-int64(interval))
+					if wait := time.Until(due); wait > 0 {
+						select {
+						case <-time.After(wait):
+						case <-produceCtx.Done():
+							return
+						}
+					}
+				}
+
+				at := time.Now()
+				binary.BigEndian.PutUint64(payload, uint64(at.UnixNano()))
+				if err := q.Add(payload); err != nil {
+					if produceCtx.Err() == nil {
+						errOnce.Do(func() { produceErr = err })
+						stop()
+					}
+					return
+				}
+				enqueue.add(time.Since(at))
+				produced.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	producing.Store(false)
+	producedAt := time.Now()
+
+	if produceErr != nil {
+		return report(start, producedAt, &produced, &consumed, &failed, &last, &enqueue, &endToEnd), produceErr
+	}
+
+	// Wait for the consumers to process what was added.
+	var err error
+	if consumed.Load() < produced.Load() {
+		select {
+		case <-caughtUp:
+		case <-time.After(cfg.Drain):
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+	}
+	return report(start, producedAt, &produced, &consumed, &failed, &last, &enqueue, &endToEnd), err
+}
+
+// report assembles the Report of a run that started at start and stopped
+// producing at producedAt.
+func report(start, producedAt time.Time, produced, consumed, failed, last *atomic.Int64, enqueue, endToEnd *samples) Report {
+	r := Report{
+		Produced: produced.Load(),
+		Consumed: consumed.Load(),
+		Failed:   failed.Load(),
+		Enqueue:  enqueue.distribution(),
+		EndToEnd: endToEnd.distribution(),
+	}
+
+	end := producedAt
+	if at := last.Load(); at > 0 {
+		end = time.Unix(0, at)
+	}
+	r.Elapsed = end.Sub(start)
+	if d := producedAt.Sub(start).Seconds(); d > 0 {
+		r.ProduceRate = float64(r.Produced) / d
+	}
+	if d := r.Elapsed.Seconds(); d > 0 {
+		r.ConsumeRate = float64(r.Consumed) / d
+	}
+	return r
+}
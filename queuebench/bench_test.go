@@ -0,0 +1,61 @@
+package queuebench
+
+import (
+	"context"
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/elum-utils/queue"
+)
+
+func TestRun(t *testing.T) {
+	q, err := queue.New(queue.Config{
+		Workers:     4,
+		Logger:      log.New(io.Discard, "", 0),
+		RetryPolicy: queue.ExponentialBackoff{Initial: time.Millisecond, Max: time.Millisecond},
+	})
+	if err != nil {
+		t.Fatalf("failed to initialize queue: %v", err)
+	}
+	defer q.Close()
+
+	report, err := Run(context.Background(), q, Config{
+		Items:       200,
+		PayloadSize: 64,
+		Producers:   2,
+		FailureRate: 0.1,
+		Drain:       10 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("failed to run benchmark: %v", err)
+	}
+
+	if report.Produced != 200 || report.Consumed != 200 {
+		t.Fatalf("expected 200 items produced and consumed, got %+v", report)
+	}
+	if report.Enqueue.Count != 200 || report.EndToEnd.Count != 200 {
+		t.Fatalf("expected 200 samples per distribution, got %+v", report)
+	}
+	if report.EndToEnd.P50 > report.EndToEnd.P99 || report.EndToEnd.P99 > report.EndToEnd.Max || report.ConsumeRate <= 0 {
+		t.Fatalf("inconsistent report: %+v", report)
+	}
+}
+
+func TestRunRate(t *testing.T) {
+	q, err := queue.New(queue.Config{Logger: log.New(io.Discard, "", 0)})
+	if err != nil {
+		t.Fatalf("failed to initialize queue: %v", err)
+	}
+	defer q.Close()
+
+	// Ten items at 50 per second take about 180ms to add.
+	report, err := Run(context.Background(), q, Config{Items: 10, Rate: 50})
+	if err != nil {
+		t.Fatalf("failed to run benchmark: %v", err)
+	}
+	if report.Produced != 10 || report.ProduceRate > 60 {
+		t.Fatalf("expected 10 items at most 50 per second, got %+v", report)
+	}
+}
@@ -0,0 +1,463 @@
+// Package queuebolt implements queue.Queuer on bbolt, a pure-Go embedded
+// key-value store, for deployments where neither CGO nor an SQL database is
+// wanted. Items are kept in a single file, every write is committed with an
+// fsync before it returns, and items are claimed in FIFO order just like the
+// SQLite-backed queue.
+//
+// bbolt locks the file for the lifetime of the handle, so a queue file can be
+// opened by one process at a time.
+package queuebolt
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elum-utils/queue"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Buckets holding the items, keyed by their big-endian identifier. Each item
+// lives in the bucket of its state, so claiming walks pending items in order
+// without looking at the others.
+var (
+	bucketPending  = []byte("pending")
+	bucketInFlight = []byte("in-flight")
+	bucketDead     = []byte("dead")
+)
+
+// Config represents configuration options for a bbolt-backed queue.
+type Config struct {
+	LeaseTimeout time.Duration // How long a claimed item stays reserved before it may be claimed again.
+	MaxAttempts  int           // Deliveries before an item moves to the dead letters; 0 means unlimited.
+	PollInterval time.Duration // How often ClaimWait looks for items whose lease expired.
+	OpenTimeout  time.Duration // How long New waits for another process to release the file lock.
+}
+
+// configDefault fills in the settings left empty in the provided configuration.
+func configDefault(config ...Config) Config {
+	cfg := Config{}
+	if len(config) > 0 {
+		cfg = config[0]
+	}
+
+	if cfg.LeaseTimeout <= 0 {
+		cfg.LeaseTimeout = 5 * time.Minute
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = time.Second
+	}
+	if cfg.OpenTimeout <= 0 {
+		cfg.OpenTimeout = time.Second
+	}
+	return cfg
+}
+
+// record is the stored form of an item.
+type record struct {
+	Data       []byte   `json:"data"`
+	Tags       []string `json:"tags,omitempty"`
+	Attempts   int      `json:"attempts,omitempty"`
+	LeaseUntil int64    `json:"lease_until,omitempty"` // Unix nanoseconds; only set while in flight.
+	VisibleAt  int64    `json:"visible_at,omitempty"`  // Unix nanoseconds before which a pending item is not claimed.
+}
+
+// Queue is a queue.Queuer stored in a bbolt file.
+type Queue struct {
+	db  *bolt.DB
+	cfg Config
+
+	ctx        context.Context
+	cancelFunc context.CancelFunc
+
+	added chan struct{} // Closed and replaced whenever an item enters the pending bucket.
+	mx    sync.Mutex    // Guards added.
+}
+
+var _ queue.Queuer = (*Queue)(nil)
+
+// New opens or creates the queue file at path. Close closes the file.
+func New(path string, config ...Config) (*Queue, error) {
+	cfg := configDefault(config...)
+
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: cfg.OpenTimeout})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{bucketPending, bucketInFlight, bucketDead} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	return &Queue{
+		db:         db,
+		cfg:        cfg,
+		ctx:        ctx,
+		cancelFunc: cancelFunc,
+		added:      make(chan struct{}),
+	}, nil
+}
+
+// Add inserts a new item into the queue.
+func (q *Queue) Add(data []byte) error {
+	return q.AddTagged(data)
+}
+
+// AddTagged inserts a new item with the given tags into the queue.
+func (q *Queue) AddTagged(data []byte, tags ...string) error {
+	err := q.db.Update(func(tx *bolt.Tx) error {
+		pending := tx.Bucket(bucketPending)
+
+		// The sequence is shared by all buckets through the pending bucket,
+		// so identifiers stay unique and increasing across state changes.
+		id, err := pending.NextSequence()
+		if err != nil {
+			return err
+		}
+		return put(pending, id, record{Data: data, Tags: tags})
+	})
+	if err != nil {
+		return err
+	}
+
+	q.signalAdded()
+	return nil
+}
+
+// Claim marks up to 'limit' pending items as in-flight and returns them in
+// FIFO order. Items whose lease expired are claimed again; items that used up
+// MaxAttempts move to the dead letters.
+func (q *Queue) Claim(limit int) ([]queue.Item, error) {
+	if limit <= 0 {
+		return nil, nil
+	}
+
+	var items []queue.Item
+	err := q.db.Update(func(tx *bolt.Tx) error {
+		pending := tx.Bucket(bucketPending)
+		inFlight := tx.Bucket(bucketInFlight)
+		dead := tx.Bucket(bucketDead)
+		now := time.Now().UnixNano()
+
+		// Expired leases are merged with the pending items by identifier, so
+		// a redelivered item keeps its place in the order.
+		expired, err := candidates(inFlight, limit, func(r record) bool { return r.LeaseUntil < now })
+		if err != nil {
+			return err
+		}
+		fresh, err := candidates(pending, limit, func(r record) bool { return r.VisibleAt <= now })
+		if err != nil {
+			return err
+		}
+
+		for len(items) < limit && (len(expired) > 0 || len(fresh) > 0) {
+			var c candidate
+			var from *bolt.Bucket
+			if len(fresh) == 0 || (len(expired) > 0 && expired[0].id < fresh[0].id) {
+				c, expired, from = expired[0], expired[1:], inFlight
+			} else {
+				c, fresh, from = fresh[0], fresh[1:], pending
+			}
+
+			if err := from.Delete(key(c.id)); err != nil {
+				return err
+			}
+
+			if q.cfg.MaxAttempts > 0 && c.record.Attempts >= q.cfg.MaxAttempts {
+				c.record.LeaseUntil = 0
+				if err := put(dead, c.id, c.record); err != nil {
+					return err
+				}
+				continue
+			}
+
+			c.record.Attempts++
+			c.record.LeaseUntil = now + q.cfg.LeaseTimeout.Nanoseconds()
+			c.record.VisibleAt = 0
+			if err := put(inFlight, c.id, c.record); err != nil {
+				return err
+			}
+			items = append(items, c.item(queue.StateInFlight))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// ClaimWait claims up to 'limit' items like Claim, waiting until at least one
+// item is claimed or maxWait elapses. It wakes up as soon as an item is added
+// or released, and every Config.PollInterval to pick up expired leases. It
+// returns no items and no error if the wait times out, and the context error
+// if ctx is done first.
+func (q *Queue) ClaimWait(ctx context.Context, limit int, maxWait time.Duration) ([]queue.Item, error) {
+	timer := time.NewTimer(maxWait)
+	defer timer.Stop()
+
+	ticker := time.NewTicker(q.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		// Take the channel before claiming so an item added in between is not missed.
+		q.mx.Lock()
+		added := q.added
+		q.mx.Unlock()
+
+		items, err := q.Claim(limit)
+		if err != nil || len(items) > 0 {
+			return items, err
+		}
+
+		select {
+		case <-added:
+		case <-ticker.C:
+		case <-timer.C:
+			return q.Claim(limit)
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-q.ctx.Done():
+			return nil, q.ctx.Err()
+		}
+	}
+}
+
+// AckReceipt removes a claimed item once it has been processed. It returns
+// queue.ErrInvalidReceipt unless the receipt belongs to the current delivery
+// of the item.
+func (q *Queue) AckReceipt(receipt string) error {
+	id, attempt, err := parseReceipt(receipt)
+	if err != nil {
+		return err
+	}
+	return q.db.Update(func(tx *bolt.Tx) error {
+		inFlight := tx.Bucket(bucketInFlight)
+		if _, err := delivered(inFlight, id, attempt); err != nil {
+			return err
+		}
+		return inFlight.Delete(key(id))
+	})
+}
+
+// NackReceipt hands a claimed item back to the queue, hidden until delay has
+// passed. It returns queue.ErrInvalidReceipt unless the receipt belongs to
+// the current delivery of the item.
+func (q *Queue) NackReceipt(receipt string, delay time.Duration) error {
+	id, attempt, err := parseReceipt(receipt)
+	if err != nil {
+		return err
+	}
+	err = q.db.Update(func(tx *bolt.Tx) error {
+		inFlight := tx.Bucket(bucketInFlight)
+		r, err := delivered(inFlight, id, attempt)
+		if err != nil {
+			return err
+		}
+		r.LeaseUntil = 0
+		if delay > 0 {
+			r.VisibleAt = time.Now().Add(delay).UnixNano()
+		}
+
+		if err := inFlight.Delete(key(id)); err != nil {
+			return err
+		}
+		return put(tx.Bucket(bucketPending), id, r)
+	})
+	if err != nil {
+		return err
+	}
+
+	q.signalAdded()
+	return nil
+}
+
+// Ack removes a claimed item once it has been processed. It returns
+// queue.ErrItemNotFound if the item is not in flight.
+//
+// Deprecated: use AckReceipt.
+func (q *Queue) Ack(id int) error {
+	return q.db.Update(func(tx *bolt.Tx) error {
+		inFlight := tx.Bucket(bucketInFlight)
+		if inFlight.Get(key(uint64(id))) == nil {
+			return queue.ErrItemNotFound
+		}
+		return inFlight.Delete(key(uint64(id)))
+	})
+}
+
+// Release hands a claimed item back to the queue. It returns
+// queue.ErrItemNotFound if the item is not in flight.
+//
+// Deprecated: use NackReceipt.
+func (q *Queue) Release(id int) error {
+	err := q.db.Update(func(tx *bolt.Tx) error {
+		inFlight := tx.Bucket(bucketInFlight)
+		value := inFlight.Get(key(uint64(id)))
+		if value == nil {
+			return queue.ErrItemNotFound
+		}
+
+		var r record
+		if err := json.Unmarshal(value, &r); err != nil {
+			return err
+		}
+		r.LeaseUntil = 0
+
+		if err := inFlight.Delete(key(uint64(id))); err != nil {
+			return err
+		}
+		return put(tx.Bucket(bucketPending), uint64(id), r)
+	})
+	if err != nil {
+		return err
+	}
+
+	q.signalAdded()
+	return nil
+}
+
+// Stats returns the number of items in each state and the total payload size.
+func (q *Queue) Stats() (queue.Stats, error) {
+	var stats queue.Stats
+	err := q.db.View(func(tx *bolt.Tx) error {
+		counts := map[string]*int{
+			string(bucketPending):  &stats.Pending,
+			string(bucketInFlight): &stats.InFlight,
+			string(bucketDead):     &stats.Dead,
+		}
+		for name, count := range counts {
+			err := tx.Bucket([]byte(name)).ForEach(func(_, value []byte) error {
+				var r record
+				if err := json.Unmarshal(value, &r); err != nil {
+					return err
+				}
+				*count++
+				stats.Bytes += int64(len(r.Data))
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return stats, err
+}
+
+// Close cancels pending waits and closes the queue file.
+func (q *Queue) Close() error {
+	q.cancelFunc()
+	return q.db.Close()
+}
+
+// signalAdded wakes up the consumers waiting in ClaimWait.
+func (q *Queue) signalAdded() {
+	q.mx.Lock()
+	defer q.mx.Unlock()
+
+	close(q.added)
+	q.added = make(chan struct{})
+}
+
+// candidate is an item read from a bucket during a claim.
+type candidate struct {
+	id     uint64
+	record record
+}
+
+// item converts the candidate into a queue.Item in the given state.
+func (c candidate) item(state queue.State) queue.Item {
+	return queue.Item{
+		ID:       int(c.id),
+		Data:     c.record.Data,
+		Tags:     c.record.Tags,
+		State:    state,
+		Attempts: c.record.Attempts,
+		Receipt:  strconv.FormatUint(c.id, 10) + "." + strconv.Itoa(c.record.Attempts),
+	}
+}
+
+// parseReceipt splits a receipt into the item identifier and the attempt it
+// was issued for. Every claim counts an attempt, so the receipts of earlier
+// deliveries stop matching.
+func parseReceipt(receipt string) (uint64, int, error) {
+	id, attempt, ok := strings.Cut(receipt, ".")
+	if !ok {
+		return 0, 0, queue.ErrInvalidReceipt
+	}
+	n, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return 0, 0, queue.ErrInvalidReceipt
+	}
+	a, err := strconv.Atoi(attempt)
+	if err != nil {
+		return 0, 0, queue.ErrInvalidReceipt
+	}
+	return n, a, nil
+}
+
+// delivered returns the in-flight record of an item, or
+// queue.ErrInvalidReceipt unless it is still at the given attempt.
+func delivered(inFlight *bolt.Bucket, id uint64, attempt int) (record, error) {
+	var r record
+	value := inFlight.Get(key(id))
+	if value == nil {
+		return r, queue.ErrInvalidReceipt
+	}
+	if err := json.Unmarshal(value, &r); err != nil {
+		return r, err
+	}
+	if r.Attempts != attempt {
+		return r, queue.ErrInvalidReceipt
+	}
+	return r, nil
+}
+
+// candidates returns up to 'limit' items of the bucket accepted by match, in
+// identifier order.
+func candidates(b *bolt.Bucket, limit int, match func(record) bool) ([]candidate, error) {
+	var found []candidate
+	cursor := b.Cursor()
+	for k, v := cursor.First(); k != nil && len(found) < limit; k, v = cursor.Next() {
+		// Decoding copies the payload, so it outlives the transaction.
+		var r record
+		if err := json.Unmarshal(v, &r); err != nil {
+			return nil, err
+		}
+		if match(r) {
+			found = append(found, candidate{id: binary.BigEndian.Uint64(k), record: r})
+		}
+	}
+	return found, nil
+}
+
+// put stores the record under the identifier.
+func put(b *bolt.Bucket, id uint64, r record) error {
+	value, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return b.Put(key(id), value)
+}
+
+// key encodes the identifier so that keys sort in FIFO order.
+func key(id uint64) []byte {
+	k := make([]byte, 8)
+	binary.BigEndian.PutUint64(k, id)
+	return k
+}
@@ -0,0 +1,195 @@
+package queuebolt
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/elum-utils/queue"
+)
+
+// setupQueue opens a queue in a temporary file and closes it when the test ends.
+func setupQueue(t *testing.T, config Config) (*Queue, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "queue.db")
+
+	q, err := New(path, config)
+	if err != nil {
+		t.Fatalf("failed to initialize queue: %v", err)
+	}
+	t.Cleanup(func() { q.Close() })
+	return q, path
+}
+
+func TestClaimAck(t *testing.T) {
+	q, _ := setupQueue(t, Config{})
+
+	if err := q.AddTagged([]byte("hello"), "email"); err != nil {
+		t.Fatalf("failed to add item: %v", err)
+	}
+
+	items, err := q.Claim(10)
+	if err != nil {
+		t.Fatalf("failed to claim items: %v", err)
+	}
+	if len(items) != 1 || string(items[0].Data) != "hello" || items[0].Tags[0] != "email" || items[0].Attempts != 1 {
+		t.Fatalf("unexpected items: %+v", items)
+	}
+
+	if err := q.Ack(items[0].ID); err != nil {
+		t.Fatalf("failed to ack item: %v", err)
+	}
+	if err := q.Ack(items[0].ID); !errors.Is(err, queue.ErrItemNotFound) {
+		t.Fatalf("expected ErrItemNotFound, got %v", err)
+	}
+
+	stats, err := q.Stats()
+	if err != nil {
+		t.Fatalf("failed to get stats: %v", err)
+	}
+	if stats.Pending != 0 || stats.InFlight != 0 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestFIFOAcrossReopen(t *testing.T) {
+	q, path := setupQueue(t, Config{})
+
+	for _, data := range []string{"a", "b", "c"} {
+		if err := q.Add([]byte(data)); err != nil {
+			t.Fatalf("failed to add item: %v", err)
+		}
+	}
+	if err := q.Close(); err != nil {
+		t.Fatalf("failed to close queue: %v", err)
+	}
+
+	q, err := New(path)
+	if err != nil {
+		t.Fatalf("failed to reopen queue: %v", err)
+	}
+	defer q.Close()
+
+	if err := q.Add([]byte("d")); err != nil {
+		t.Fatalf("failed to add item: %v", err)
+	}
+
+	items, err := q.Claim(10)
+	if err != nil {
+		t.Fatalf("failed to claim items: %v", err)
+	}
+
+	var got string
+	for _, item := range items {
+		got += string(item.Data)
+	}
+	if got != "abcd" {
+		t.Fatalf("expected items in FIFO order, got %q", got)
+	}
+}
+
+func TestReleaseKeepsOrder(t *testing.T) {
+	q, _ := setupQueue(t, Config{})
+
+	q.Add([]byte("first"))
+	q.Add([]byte("second"))
+
+	items, _ := q.Claim(1)
+	if err := q.Release(items[0].ID); err != nil {
+		t.Fatalf("failed to release item: %v", err)
+	}
+
+	items, err := q.Claim(2)
+	if err != nil {
+		t.Fatalf("failed to claim items: %v", err)
+	}
+	if len(items) != 2 || string(items[0].Data) != "first" || items[0].Attempts != 2 {
+		t.Fatalf("unexpected items: %+v", items)
+	}
+}
+
+func TestLeaseExpiryAndDeadLetters(t *testing.T) {
+	q, _ := setupQueue(t, Config{LeaseTimeout: time.Millisecond, MaxAttempts: 2})
+
+	q.Add([]byte("flaky"))
+
+	for attempt := 1; attempt <= 2; attempt++ {
+		items, err := q.Claim(1)
+		if err != nil {
+			t.Fatalf("failed to claim items: %v", err)
+		}
+		if len(items) != 1 || items[0].Attempts != attempt {
+			t.Fatalf("attempt %d: unexpected items: %+v", attempt, items)
+		}
+		time.Sleep(5 * time.Millisecond) // Let the lease expire.
+	}
+
+	items, err := q.Claim(1)
+	if err != nil {
+		t.Fatalf("failed to claim items: %v", err)
+	}
+	if len(items) != 0 {
+		t.Fatalf("expected no items, got %+v", items)
+	}
+
+	stats, _ := q.Stats()
+	if stats.Dead != 1 || stats.Bytes != int64(len("flaky")) {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestClaimWait(t *testing.T) {
+	q, _ := setupQueue(t, Config{})
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		q.Add([]byte("late"))
+	}()
+
+	items, err := q.ClaimWait(context.Background(), 1, 5*time.Second)
+	if err != nil {
+		t.Fatalf("failed to claim items: %v", err)
+	}
+	if len(items) != 1 || string(items[0].Data) != "late" {
+		t.Fatalf("unexpected items: %+v", items)
+	}
+
+	items, err = q.ClaimWait(context.Background(), 1, 10*time.Millisecond)
+	if err != nil || len(items) != 0 {
+		t.Fatalf("expected an empty timeout, got %+v, %v", items, err)
+	}
+}
+
+func TestReceipts(t *testing.T) {
+	q, _ := setupQueue(t, Config{LeaseTimeout: 10 * time.Millisecond})
+
+	if err := q.Add([]byte("hello")); err != nil {
+		t.Fatalf("failed to add item: %v", err)
+	}
+	first, err := q.Claim(1)
+	if err != nil || len(first) != 1 {
+		t.Fatalf("failed to claim item: %+v, %v", first, err)
+	}
+
+	// The lease runs out and the item is delivered again.
+	time.Sleep(20 * time.Millisecond)
+	second, err := q.Claim(1)
+	if err != nil || len(second) != 1 || second[0].Receipt == first[0].Receipt {
+		t.Fatalf("expected the item to be redelivered with a new receipt, got %+v, %v", second, err)
+	}
+	if err := q.AckReceipt(first[0].Receipt); !errors.Is(err, queue.ErrInvalidReceipt) {
+		t.Fatalf("expected the stale receipt to be rejected, got %v", err)
+	}
+
+	if err := q.NackReceipt(second[0].Receipt, time.Hour); err != nil {
+		t.Fatalf("failed to release item: %v", err)
+	}
+	if items, err := q.Claim(1); err != nil || len(items) != 0 {
+		t.Fatalf("expected the released item to stay hidden, got %+v, %v", items, err)
+	}
+	if err := q.AckReceipt(second[0].Receipt); !errors.Is(err, queue.ErrInvalidReceipt) {
+		t.Fatalf("expected the receipt to be used up, got %v", err)
+	}
+}
@@ -0,0 +1,159 @@
+// Package queuebridge connects a queue to external message systems. A
+// Forwarder drains the queue into a Publisher, acknowledging each item only
+// after the publisher accepted it, so the queue acts as a durable local buffer
+// while the remote system is unreachable. Ingest does the opposite and
+// enqueues the messages received from a Source.
+//
+// Adapters for specific systems live in their own packages, e.g. queuekafka.
+package queuebridge
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/elum-utils/queue"
+)
+
+// Publisher delivers items to an external system. Publish must return only
+// once the system has durably accepted the item.
+type Publisher interface {
+	Publish(ctx context.Context, item queue.Item) error
+}
+
+// Message is a message received from an external system.
+type Message struct {
+	Data []byte   // Payload of the message.
+	Tags []string // Tags attached to the enqueued item.
+
+	// Commit acknowledges the message to the external system once it has been
+	// enqueued. It may be nil if the system needs no acknowledgement.
+	Commit func(ctx context.Context) error
+}
+
+// Source receives messages from an external system.
+type Source interface {
+	// Receive blocks until a message is available or ctx is done.
+	Receive(ctx context.Context) (Message, error)
+}
+
+// Config represents configuration options for a Forwarder.
+type Config struct {
+	BatchSize  int           // Items claimed per round trip to the queue.
+	PollWait   time.Duration // Longest time a claim waits for new items.
+	MinBackoff time.Duration // Pause after the first failed publish.
+	MaxBackoff time.Duration // Longest pause between retries while publishing keeps failing.
+	Logger     queue.Logger  // Receives the errors Run cannot return; nil uses the logger of the queue.
+}
+
+// configDefault fills in the settings left empty in the provided configuration.
+func configDefault(config ...Config) Config {
+	cfg := Config{}
+	if len(config) > 0 {
+		cfg = config[0]
+	}
+
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 10
+	}
+	if cfg.PollWait <= 0 {
+		cfg.PollWait = 5 * time.Second
+	}
+	if cfg.MinBackoff <= 0 {
+		cfg.MinBackoff = 100 * time.Millisecond
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = 30 * time.Second
+	}
+	return cfg
+}
+
+// Forwarder drains a queue into a Publisher.
+type Forwarder struct {
+	queue     queue.Queuer
+	publisher Publisher
+	cfg       Config
+}
+
+// NewForwarder returns a Forwarder publishing the items of q.
+func NewForwarder(q queue.Queuer, publisher Publisher, config ...Config) *Forwarder {
+	cfg := configDefault(config...)
+	if cfg.Logger == nil {
+		cfg.Logger = queue.LoggerOf(q)
+	}
+	return &Forwarder{queue: q, publisher: publisher, cfg: cfg}
+}
+
+// Run forwards items until ctx is done and returns the context error. Items
+// are claimed in FIFO order and acknowledged once published. When publishing
+// fails, the failed item and the rest of its batch are released and the
+// forwarder backs off exponentially, so a long outage does not spin.
+func (f *Forwarder) Run(ctx context.Context) error {
+	backoff := time.Duration(0)
+	for {
+		items, err := f.queue.ClaimWait(ctx, f.cfg.BatchSize, f.cfg.PollWait)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err == nil {
+			err = f.forward(ctx, items)
+		}
+
+		if err == nil {
+			backoff = 0
+			continue
+		}
+
+		f.cfg.Logger.Println("Error forwarding items:", err)
+		backoff = min(max(2*backoff, f.cfg.MinBackoff), f.cfg.MaxBackoff)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+	}
+}
+
+// forward publishes the claimed items in order and acknowledges each one.
+// Items left unpublished after an error are released.
+func (f *Forwarder) forward(ctx context.Context, items []queue.Item) error {
+	for i, item := range items {
+		if err := f.publisher.Publish(ctx, item); err != nil {
+			for _, unpublished := range items[i:] {
+				if releaseErr := f.queue.NackReceipt(unpublished.Receipt, 0); releaseErr != nil {
+					err = errors.Join(err, releaseErr)
+				}
+			}
+			return err
+		}
+
+		if err := f.queue.AckReceipt(item.Receipt); err != nil {
+			// The lease expired and the item may be published again; at-least-once
+			// delivery means consumers of the external system must tolerate that.
+			f.cfg.Logger.Println("Error acknowledging forwarded item:", err)
+		}
+	}
+	return nil
+}
+
+// Ingest enqueues the messages received from src into q until ctx is done,
+// committing each message after it was added. It returns the first error
+// from the source, the queue or a commit; uncommitted messages are expected
+// to be redelivered by the source.
+func Ingest(ctx context.Context, q queue.Queuer, src Source) error {
+	for {
+		msg, err := src.Receive(ctx)
+		if err != nil {
+			return err
+		}
+
+		if err := q.AddTagged(msg.Data, msg.Tags...); err != nil {
+			return err
+		}
+		if msg.Commit != nil {
+			if err := msg.Commit(ctx); err != nil {
+				return err
+			}
+		}
+	}
+}
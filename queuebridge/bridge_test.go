@@ -0,0 +1,146 @@
+package queuebridge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/elum-utils/queue"
+)
+
+// flakyPublisher fails the first 'failures' publishes and records the rest.
+type flakyPublisher struct {
+	mx        sync.Mutex
+	failures  int
+	published []string
+}
+
+func (p *flakyPublisher) Publish(ctx context.Context, item queue.Item) error {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+
+	if p.failures > 0 {
+		p.failures--
+		return errors.New("broker unavailable")
+	}
+	p.published = append(p.published, string(item.Data))
+	return nil
+}
+
+// recordingLogger collects the lines logged by a forwarder.
+type recordingLogger struct {
+	mx    sync.Mutex
+	lines []string
+}
+
+func (l *recordingLogger) Println(v ...any) {
+	l.mx.Lock()
+	defer l.mx.Unlock()
+	l.lines = append(l.lines, fmt.Sprintln(v...))
+}
+
+func TestForwarder(t *testing.T) {
+	logger := &recordingLogger{}
+	q, err := queue.New(queue.Config{Logger: logger})
+	if err != nil {
+		t.Fatalf("failed to initialize queue: %v", err)
+	}
+	defer q.Close()
+
+	for _, data := range []string{"first", "second", "third"} {
+		if err := q.Add([]byte(data)); err != nil {
+			t.Fatalf("failed to add item to queue: %v", err)
+		}
+	}
+
+	publisher := &flakyPublisher{failures: 2}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- NewForwarder(q, publisher, Config{PollWait: 50 * time.Millisecond, MinBackoff: time.Millisecond}).Run(ctx)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		stats, err := q.Stats()
+		if err != nil {
+			t.Fatalf("failed to read stats: %v", err)
+		}
+		if stats.Pending == 0 && stats.InFlight == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out forwarding items, stats %+v", stats)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+
+	publisher.mx.Lock()
+	defer publisher.mx.Unlock()
+	if len(publisher.published) != 3 || publisher.published[0] != "first" || publisher.published[2] != "third" {
+		t.Fatalf("expected all items published in order, got %v", publisher.published)
+	}
+
+	logger.mx.Lock()
+	defer logger.mx.Unlock()
+	if len(logger.lines) != 2 || !strings.HasPrefix(logger.lines[0], "Error forwarding items:") {
+		t.Fatalf("expected both failures logged to the logger of the queue, got %q", logger.lines)
+	}
+}
+
+// sliceSource returns its messages and then reports io.EOF-like exhaustion.
+type sliceSource struct {
+	messages  []Message
+	committed int
+}
+
+var errExhausted = errors.New("no more messages")
+
+func (s *sliceSource) Receive(ctx context.Context) (Message, error) {
+	if len(s.messages) == 0 {
+		return Message{}, errExhausted
+	}
+	msg := s.messages[0]
+	s.messages = s.messages[1:]
+	msg.Commit = func(ctx context.Context) error {
+		s.committed++
+		return nil
+	}
+	return msg, nil
+}
+
+func TestIngest(t *testing.T) {
+	q, err := queue.New(queue.Config{})
+	if err != nil {
+		t.Fatalf("failed to initialize queue: %v", err)
+	}
+	defer q.Close()
+
+	src := &sliceSource{messages: []Message{
+		{Data: []byte("first"), Tags: []string{"email"}},
+		{Data: []byte("second")},
+	}}
+	if err := Ingest(context.Background(), q, src); !errors.Is(err, errExhausted) {
+		t.Fatalf("expected the source error, got %v", err)
+	}
+	if src.committed != 2 {
+		t.Fatalf("expected 2 committed messages, got %d", src.committed)
+	}
+
+	items, err := q.Get(10)
+	if err != nil {
+		t.Fatalf("failed to get items: %v", err)
+	}
+	if len(items) != 2 || items[0].Tags[0] != "email" || string(items[1].Data) != "second" {
+		t.Fatalf("unexpected items: %+v", items)
+	}
+}
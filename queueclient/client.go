@@ -0,0 +1,255 @@
+// Package queueclient talks to a queue node served by queuehttp. Client
+// implements queue.Queuer, so code written against the interface works with
+// both an embedded queue and a remote one; Open picks between them based on
+// the configuration.
+package queueclient
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/elum-utils/queue"
+	"github.com/elum-utils/queue/queueauth"
+	"github.com/elum-utils/queue/queuehttp"
+)
+
+// Config represents configuration options for the client.
+type Config struct {
+	URL   string      // Base URL of the queuehttp handler, e.g. "https://queue.internal:8080/".
+	Token string      // API token sent as a bearer token, if the server requires one.
+	TLS   *tls.Config // TLS settings, e.g. root CAs or a client certificate.
+
+	Timeout    time.Duration // Timeout of requests that do not wait for items.
+	HTTPClient *http.Client  // Client used for requests; built from TLS and Timeout if nil.
+
+	// Local configures the embedded queue opened by Open when URL is empty.
+	Local queue.Config
+}
+
+// configDefault fills in the settings left empty in the provided configuration.
+func configDefault(config ...Config) Config {
+	cfg := Config{}
+	if len(config) > 0 {
+		cfg = config[0]
+	}
+
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 30 * time.Second
+	}
+	if cfg.HTTPClient == nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = cfg.TLS
+		cfg.HTTPClient = &http.Client{Transport: transport}
+	}
+	cfg.URL = strings.TrimSuffix(cfg.URL, "/")
+	return cfg
+}
+
+// Open returns a client for the remote queue at Config.URL, or opens the
+// embedded queue described by Config.Local if no URL is set.
+func Open(config ...Config) (queue.Queuer, error) {
+	cfg := configDefault(config...)
+	if cfg.URL == "" {
+		return queue.New(cfg.Local)
+	}
+	return New(cfg), nil
+}
+
+// Client is a queue.Queuer backed by a remote queue node.
+type Client struct {
+	cfg Config
+}
+
+var _ queue.Queuer = (*Client)(nil)
+
+// New returns a client for the queue node at Config.URL.
+func New(config ...Config) *Client {
+	return &Client{cfg: configDefault(config...)}
+}
+
+// Add inserts a new item into the remote queue.
+func (c *Client) Add(data []byte) error {
+	return c.AddTagged(data)
+}
+
+// AddTagged inserts a new item with the given tags into the remote queue.
+func (c *Client) AddTagged(data []byte, tags ...string) error {
+	query := url.Values{"tag": tags}
+	return c.do(context.Background(), http.MethodPost, "/items?"+query.Encode(), data, nil)
+}
+
+// Claim marks up to 'limit' pending items as in-flight and returns them.
+func (c *Client) Claim(limit int) ([]queue.Item, error) {
+	return c.claim(context.Background(), limit, 0)
+}
+
+// ClaimWait claims up to 'limit' items, waiting up to maxWait for one.
+// The server may cap the wait.
+func (c *Client) ClaimWait(ctx context.Context, limit int, maxWait time.Duration) ([]queue.Item, error) {
+	return c.claim(ctx, limit, maxWait)
+}
+
+// claim requests a claim of up to 'limit' items, waiting up to maxWait if positive.
+func (c *Client) claim(ctx context.Context, limit int, maxWait time.Duration) ([]queue.Item, error) {
+	query := url.Values{"limit": {strconv.Itoa(limit)}}
+	if maxWait > 0 {
+		query.Set("wait", maxWait.String())
+	}
+
+	var records []queuehttp.Item
+	if err := c.do(ctx, http.MethodPost, "/claim?"+query.Encode(), nil, &records); err != nil {
+		return nil, err
+	}
+	return items(records), nil
+}
+
+// AckReceipt removes a claimed item once it has been processed, unless the
+// delivery the receipt was issued for was superseded.
+func (c *Client) AckReceipt(receipt string) error {
+	return c.do(context.Background(), http.MethodPost, "/receipts/"+url.PathEscape(receipt)+"/ack", nil, nil)
+}
+
+// NackReceipt hands a claimed item back to the queue, hidden until delay has
+// passed, unless the delivery the receipt was issued for was superseded.
+func (c *Client) NackReceipt(receipt string, delay time.Duration) error {
+	query := url.Values{}
+	if delay > 0 {
+		query.Set("delay", delay.String())
+	}
+	return c.do(context.Background(), http.MethodPost, "/receipts/"+url.PathEscape(receipt)+"/nack?"+query.Encode(), nil, nil)
+}
+
+// Ack removes a claimed item once it has been processed.
+//
+// Deprecated: use AckReceipt.
+func (c *Client) Ack(id int) error {
+	return c.do(context.Background(), http.MethodPost, "/items/"+strconv.Itoa(id)+"/ack", nil, nil)
+}
+
+// Release hands a claimed item back to the queue.
+//
+// Deprecated: use NackReceipt.
+func (c *Client) Release(id int) error {
+	return c.do(context.Background(), http.MethodPost, "/items/"+strconv.Itoa(id)+"/release", nil, nil)
+}
+
+// Get retrieves up to 'limit' items without claiming them.
+func (c *Client) Get(limit int) ([]queue.Item, error) {
+	var records []queuehttp.Item
+	if err := c.do(context.Background(), http.MethodGet, "/items?limit="+strconv.Itoa(limit), nil, &records); err != nil {
+		return nil, err
+	}
+	return items(records), nil
+}
+
+// Delete removes an item from the remote queue.
+func (c *Client) Delete(id int) error {
+	return c.do(context.Background(), http.MethodDelete, "/items/"+strconv.Itoa(id), nil, nil)
+}
+
+// DeadLetters returns up to 'limit' dead letters, oldest first.
+func (c *Client) DeadLetters(limit int) ([]queue.Item, error) {
+	var records []queuehttp.Item
+	if err := c.do(context.Background(), http.MethodGet, "/dead?limit="+strconv.Itoa(limit), nil, &records); err != nil {
+		return nil, err
+	}
+	return items(records), nil
+}
+
+// Requeue moves a dead letter back to pending.
+func (c *Client) Requeue(id int) error {
+	return c.do(context.Background(), http.MethodPost, "/dead/"+strconv.Itoa(id)+"/requeue", nil, nil)
+}
+
+// Stats returns the number of items in each state of the remote queue.
+func (c *Client) Stats() (queue.Stats, error) {
+	var stats queue.Stats
+	err := c.do(context.Background(), http.MethodGet, "/stats", nil, &stats)
+	return stats, err
+}
+
+// Close releases idle connections to the server.
+func (c *Client) Close() error {
+	c.cfg.HTTPClient.CloseIdleConnections()
+	return nil
+}
+
+// do sends a request and decodes the JSON response into out unless it is nil.
+// Requests without a deadline of their own are bounded by Config.Timeout.
+func (c *Client) do(ctx context.Context, method, path string, body []byte, out any) error {
+	if _, ok := ctx.Deadline(); !ok && !strings.HasPrefix(path, "/claim?") {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.cfg.Timeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.cfg.URL+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if c.cfg.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.cfg.Token)
+	}
+
+	resp, err := c.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return responseError(resp)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// responseError maps an error response back to the errors the local queue returns.
+func responseError(resp *http.Response) error {
+	var body struct {
+		Error string `json:"error"`
+	}
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<16))
+	if json.Unmarshal(data, &body) != nil || body.Error == "" {
+		body.Error = strings.TrimSpace(string(data))
+	}
+
+	var sentinel error
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+		sentinel = queue.ErrItemNotFound
+	case http.StatusConflict:
+		sentinel = queue.ErrItemInProgress
+	case http.StatusGone:
+		sentinel = queue.ErrInvalidReceipt
+	case http.StatusServiceUnavailable:
+		sentinel = queue.ErrQueueFull
+	case http.StatusUnauthorized:
+		sentinel = queueauth.ErrUnauthenticated
+	case http.StatusForbidden:
+		sentinel = queueauth.ErrPermissionDenied
+	default:
+		return fmt.Errorf("queueclient: %s: %s", resp.Status, body.Error)
+	}
+	return fmt.Errorf("queueclient: %w", sentinel)
+}
+
+// items converts records received from the server to items.
+func items(records []queuehttp.Item) []queue.Item {
+	out := make([]queue.Item, len(records))
+	for i, r := range records {
+		out[i] = queue.Item{ID: r.ID, Data: r.Data, Tags: r.Tags, State: r.State, Attempts: r.Attempts, Priority: r.Priority, Receipt: r.Receipt}
+	}
+	return out
+}
@@ -0,0 +1,110 @@
+package queueclient
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/elum-utils/queue"
+	"github.com/elum-utils/queue/queueauth"
+	"github.com/elum-utils/queue/queuehttp"
+)
+
+func setupClient(t *testing.T, config Config, handlerConfig ...queuehttp.Config) *Client {
+	t.Helper()
+	q, err := queue.New(queue.Config{})
+	if err != nil {
+		t.Fatalf("failed to initialize queue: %v", err)
+	}
+	server := httptest.NewServer(queuehttp.NewHandler(q, handlerConfig...))
+	t.Cleanup(func() {
+		server.Close()
+		q.Close()
+	})
+
+	config.URL = server.URL
+	return New(config)
+}
+
+func TestClient(t *testing.T) {
+	client := setupClient(t, Config{})
+	defer client.Close()
+
+	if err := client.AddTagged([]byte("hello"), "email"); err != nil {
+		t.Fatalf("failed to add item: %v", err)
+	}
+
+	items, err := client.ClaimWait(context.Background(), 10, time.Second)
+	if err != nil {
+		t.Fatalf("failed to claim items: %v", err)
+	}
+	if len(items) != 1 || string(items[0].Data) != "hello" || items[0].Tags[0] != "email" || items[0].Attempts != 1 {
+		t.Fatalf("unexpected items: %+v", items)
+	}
+
+	if err := client.Ack(items[0].ID); err != nil {
+		t.Fatalf("failed to ack item: %v", err)
+	}
+	if err := client.Ack(items[0].ID); !errors.Is(err, queue.ErrItemNotFound) {
+		t.Fatalf("expected ErrItemNotFound acking twice, got %v", err)
+	}
+
+	stats, err := client.Stats()
+	if err != nil {
+		t.Fatalf("failed to read stats: %v", err)
+	}
+	if stats.Pending != 0 || stats.InFlight != 0 {
+		t.Fatalf("expected an empty queue, got %+v", stats)
+	}
+}
+
+func TestClientReceipts(t *testing.T) {
+	client := setupClient(t, Config{})
+	defer client.Close()
+
+	if err := client.Add([]byte("hello")); err != nil {
+		t.Fatalf("failed to add item: %v", err)
+	}
+	items, err := client.Claim(1)
+	if err != nil || len(items) != 1 || items[0].Receipt == "" {
+		t.Fatalf("expected a claimed item with a receipt, got %+v, %v", items, err)
+	}
+
+	if err := client.NackReceipt(items[0].Receipt, time.Hour); err != nil {
+		t.Fatalf("failed to release item: %v", err)
+	}
+	if err := client.AckReceipt(items[0].Receipt); !errors.Is(err, queue.ErrInvalidReceipt) {
+		t.Fatalf("expected the receipt to be used up, got %v", err)
+	}
+	if items, err := client.Claim(1); err != nil || len(items) != 0 {
+		t.Fatalf("expected the released item to stay hidden, got %+v, %v", items, err)
+	}
+}
+
+func TestClientToken(t *testing.T) {
+	auth := queueauth.New(queueauth.Config{Tokens: map[string]queueauth.Permission{"secret": queueauth.PermAll}})
+
+	anonymous := setupClient(t, Config{}, queuehttp.Config{Auth: auth})
+	if err := anonymous.Add([]byte("hello")); !errors.Is(err, queueauth.ErrUnauthenticated) {
+		t.Fatalf("expected ErrUnauthenticated, got %v", err)
+	}
+
+	client := setupClient(t, Config{Token: "secret"}, queuehttp.Config{Auth: auth})
+	if err := client.Add([]byte("hello")); err != nil {
+		t.Fatalf("failed to add item with a token: %v", err)
+	}
+}
+
+func TestOpenLocal(t *testing.T) {
+	q, err := Open(Config{})
+	if err != nil {
+		t.Fatalf("failed to open local queue: %v", err)
+	}
+	defer q.Close()
+
+	if _, ok := q.(*queue.Queue); !ok {
+		t.Fatalf("expected an embedded queue without a URL, got %T", q)
+	}
+}
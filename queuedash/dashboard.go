@@ -0,0 +1,239 @@
+// Package queuedash serves a small web dashboard for a queue, showing its depth
+// over time, in-flight items, dead letters and processing latency, with buttons
+// to requeue and delete items. Mount it on an existing mux:
+//
+//	dash := queuedash.New(q)
+//	defer dash.Close()
+//	mux.Handle("/queue/", http.StripPrefix("/queue", dash))
+package queuedash
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/elum-utils/queue"
+)
+
+//go:embed index.html
+var indexHTML []byte
+
+// Config represents configuration options for the dashboard.
+type Config struct {
+	SampleInterval time.Duration // How often the queue depth is sampled.
+	History        int           // Number of samples kept for the depth chart.
+	ListLimit      int           // Maximum number of items shown per list.
+	Logger         queue.Logger  // Receives the errors of sampling; nil uses Queue.Logger.
+}
+
+// configDefault fills in the settings left empty in the provided configuration.
+func configDefault(config ...Config) Config {
+	cfg := Config{}
+	if len(config) > 0 {
+		cfg = config[0]
+	}
+
+	if cfg.SampleInterval <= 0 {
+		cfg.SampleInterval = 5 * time.Second
+	}
+	if cfg.History <= 0 {
+		cfg.History = 360 // 30 minutes at the default interval.
+	}
+	if cfg.ListLimit <= 0 {
+		cfg.ListLimit = 50
+	}
+	return cfg
+}
+
+// Sample is the state of the queue at one point in time.
+type Sample struct {
+	Time     time.Time `json:"time"`
+	Pending  int       `json:"pending"`
+	InFlight int       `json:"in_flight"`
+	Dead     int       `json:"dead"`
+}
+
+// Dashboard is an http.Handler serving the dashboard page and its JSON API.
+type Dashboard struct {
+	queue      *queue.Queue
+	cfg        Config
+	mux        *http.ServeMux
+	cancelFunc context.CancelFunc
+
+	samples []Sample   // Depth history, oldest first.
+	mx      sync.Mutex // Guards samples.
+}
+
+// New returns a dashboard for q and starts sampling its depth.
+// Call Close to stop sampling.
+func New(q *queue.Queue, config ...Config) *Dashboard {
+	ctx, cancelFunc := context.WithCancel(context.Background())
+
+	cfg := configDefault(config...)
+	if cfg.Logger == nil {
+		cfg.Logger = q.Logger()
+	}
+	d := &Dashboard{
+		queue:      q,
+		cfg:        cfg,
+		mux:        http.NewServeMux(),
+		cancelFunc: cancelFunc,
+	}
+
+	d.mux.HandleFunc("GET /{$}", d.index)
+	d.mux.HandleFunc("GET /api/stats", d.stats)
+	d.mux.HandleFunc("GET /api/items", d.items)
+	d.mux.HandleFunc("POST /api/items/{id}/delete", d.delete)
+	d.mux.HandleFunc("POST /api/items/{id}/requeue", d.requeue)
+	d.mux.HandleFunc("POST /api/dead/requeue", d.requeueAll)
+
+	d.sample()
+	go d.run(ctx)
+
+	return d
+}
+
+// Close stops sampling the queue depth.
+func (d *Dashboard) Close() {
+	d.cancelFunc()
+}
+
+// ServeHTTP implements http.Handler.
+func (d *Dashboard) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	d.mux.ServeHTTP(w, r)
+}
+
+// run samples the queue depth until ctx is done.
+func (d *Dashboard) run(ctx context.Context) {
+	ticker := time.NewTicker(d.cfg.SampleInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			d.sample()
+		}
+	}
+}
+
+// sample appends the current queue depth to the history.
+func (d *Dashboard) sample() {
+	stats, err := d.queue.Stats()
+	if err != nil {
+		d.cfg.Logger.Println("Error sampling queue stats:", err)
+		return
+	}
+
+	d.mx.Lock()
+	defer d.mx.Unlock()
+
+	d.samples = append(d.samples, Sample{
+		Time:     time.Now(),
+		Pending:  stats.Pending,
+		InFlight: stats.InFlight,
+		Dead:     stats.Dead,
+	})
+	if len(d.samples) > d.cfg.History {
+		d.samples = d.samples[len(d.samples)-d.cfg.History:]
+	}
+}
+
+func (d *Dashboard) index(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(indexHTML)
+}
+
+func (d *Dashboard) stats(w http.ResponseWriter, r *http.Request) {
+	stats, err := d.queue.Stats()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	d.mx.Lock()
+	history := append([]Sample(nil), d.samples...)
+	d.mx.Unlock()
+
+	writeJSON(w, http.StatusOK, struct {
+		queue.Stats
+		History []Sample `json:"history"`
+	}{stats, history})
+}
+
+// items lists the items in the state given by the state query parameter.
+func (d *Dashboard) items(w http.ResponseWriter, r *http.Request) {
+	state := queue.State(r.URL.Query().Get("state"))
+	switch state {
+	case queue.StatePending, queue.StateScheduled, queue.StateInFlight, queue.StateDead:
+	default:
+		writeError(w, http.StatusBadRequest, fmt.Errorf("unknown state %q", state))
+		return
+	}
+
+	items, _, err := d.queue.Admin().ListByState(state, d.cfg.ListLimit, 0)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	records := make([]queue.Record, len(items))
+	for i, item := range items {
+		records[i] = queue.Record{ID: item.ID, State: item.State, Priority: item.Priority, Attempts: item.Attempts, Tags: item.Tags, Tenant: item.Tenant, Data: item.Data}
+	}
+	writeJSON(w, http.StatusOK, records)
+}
+
+func (d *Dashboard) delete(w http.ResponseWriter, r *http.Request) {
+	d.update(w, r, d.queue.Delete)
+}
+
+func (d *Dashboard) requeue(w http.ResponseWriter, r *http.Request) {
+	d.update(w, r, d.queue.Requeue)
+}
+
+func (d *Dashboard) requeueAll(w http.ResponseWriter, r *http.Request) {
+	requeued, err := d.queue.Admin().RequeueAll()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]int{"requeued": requeued})
+}
+
+// update applies fn to the item named in the path.
+func (d *Dashboard) update(w http.ResponseWriter, r *http.Request, fn func(id int) error) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	switch err := fn(id); {
+	case errors.Is(err, queue.ErrItemNotFound):
+		writeError(w, http.StatusNotFound, err)
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, err)
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// writeError responds with the error message as a JSON object.
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// writeJSON responds with v encoded as JSON.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
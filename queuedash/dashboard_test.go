@@ -0,0 +1,74 @@
+package queuedash
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/elum-utils/queue"
+)
+
+func TestDashboard(t *testing.T) {
+	q, err := queue.New(queue.Config{})
+	if err != nil {
+		t.Fatalf("failed to initialize queue: %v", err)
+	}
+	defer q.Close()
+
+	if err := q.Add([]byte("test data")); err != nil {
+		t.Fatalf("failed to add item to queue: %v", err)
+	}
+
+	dash := New(q)
+	defer dash.Close()
+
+	mux := http.NewServeMux()
+	mux.Handle("/queue/", http.StripPrefix("/queue", dash))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/queue/")
+	if err != nil {
+		t.Fatalf("failed to load the page: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html") {
+		t.Fatalf("unexpected page response: %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	resp, err = http.Get(server.URL + "/queue/api/stats")
+	if err != nil {
+		t.Fatalf("failed to read stats: %v", err)
+	}
+	var stats struct {
+		Pending int      `json:"pending"`
+		History []Sample `json:"history"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&stats); err != nil {
+		t.Fatalf("failed to decode stats: %v", err)
+	}
+	resp.Body.Close()
+	if stats.Pending != 1 || len(stats.History) != 1 || stats.History[0].Pending != 1 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+
+	resp, err = http.Post(server.URL+"/queue/api/items/1/delete", "", nil)
+	if err != nil {
+		t.Fatalf("failed to delete item: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", resp.StatusCode)
+	}
+
+	resp, err = http.Post(server.URL+"/queue/api/items/1/requeue", "", nil)
+	if err != nil {
+		t.Fatalf("failed to requeue item: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404 requeueing a deleted item, got %d", resp.StatusCode)
+	}
+}
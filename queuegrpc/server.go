@@ -0,0 +1,245 @@
+// Package queuegrpc exposes a queue as a gRPC service, so remote consumers and
+// strongly-typed clients in other languages can produce and consume items.
+// The service is defined in queue.proto; regenerate the Go code after changing it.
+//
+// Set Config.Auth to require an API token (sent as "authorization: Bearer
+// <token>" metadata) or a verified TLS client certificate granting the
+// permission of each method.
+package queuegrpc
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative queue.proto
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/elum-utils/queue"
+	"github.com/elum-utils/queue/queueauth"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// Config represents configuration options for the gRPC server.
+type Config struct {
+	PollInterval time.Duration // Longest time Dequeue waits between claims while the queue is empty.
+	MaxBatchSize int           // Upper bound for DequeueRequest.batch_size.
+
+	// Auth authenticates callers; nil leaves every method open.
+	Auth *queueauth.Authenticator
+
+	// TLS settings used by ListenAndServe. TLS is enabled when TLS or CertFile
+	// is set; ClientCAFile enables verification of client certificates.
+	TLS          *tls.Config
+	CertFile     string
+	KeyFile      string
+	ClientCAFile string
+}
+
+// configDefault fills in the settings left empty in the provided configuration.
+func configDefault(config ...Config) Config {
+	cfg := Config{}
+	if len(config) > 0 {
+		cfg = config[0]
+	}
+
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = time.Second
+	}
+	if cfg.MaxBatchSize <= 0 {
+		cfg.MaxBatchSize = 100
+	}
+	return cfg
+}
+
+// Server implements QueueServer on top of a queue. Register it with
+// RegisterQueueServer.
+type Server struct {
+	UnimplementedQueueServer
+
+	queue *queue.Queue
+	cfg   Config
+}
+
+// NewServer returns a gRPC service backed by q. Items streamed by Dequeue are
+// claimed by q, so they must be acknowledged through the same server.
+func NewServer(q *queue.Queue, config ...Config) *Server {
+	return &Server{queue: q, cfg: configDefault(config...)}
+}
+
+// ListenAndServe serves the service on addr, over TLS if configured, until ctx
+// is done. It then stops the server, ending open Dequeue streams. The options are passed to
+// grpc.NewServer, e.g. to add interceptors.
+func (s *Server) ListenAndServe(ctx context.Context, addr string, opts ...grpc.ServerOption) error {
+	if s.cfg.TLS != nil || s.cfg.CertFile != "" {
+		tlsConfig, err := queueauth.TLSConfig(s.cfg.TLS, s.cfg.CertFile, s.cfg.KeyFile, s.cfg.ClientCAFile)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	server := grpc.NewServer(opts...)
+	RegisterQueueServer(server, s)
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- server.Serve(listener)
+	}()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+		// Dequeue streams never end on their own, so a graceful stop would hang.
+		server.Stop()
+		return nil
+	}
+}
+
+// Enqueue adds an item to the queue.
+func (s *Server) Enqueue(ctx context.Context, req *EnqueueRequest) (*EnqueueResponse, error) {
+	if err := s.authorize(ctx, queueauth.PermEnqueue); err != nil {
+		return nil, err
+	}
+	if err := s.queue.AddTagged(req.GetData(), req.GetTags()...); err != nil {
+		return nil, toStatus(err)
+	}
+	return &EnqueueResponse{}, nil
+}
+
+// Dequeue claims items and streams them until the call is cancelled.
+func (s *Server) Dequeue(req *DequeueRequest, stream Queue_DequeueServer) error {
+	if err := s.authorize(stream.Context(), queueauth.PermConsume); err != nil {
+		return err
+	}
+
+	batch := int(req.GetBatchSize())
+	if batch <= 0 {
+		batch = 1
+	}
+	batch = min(batch, s.cfg.MaxBatchSize)
+
+	ctx := stream.Context()
+	for {
+		items, err := s.queue.ClaimWait(ctx, batch, s.cfg.PollInterval)
+		if err != nil {
+			return toStatus(err)
+		}
+
+		for i, item := range items {
+			err := stream.Send(&Item{
+				Id:       int64(item.ID),
+				Data:     item.Data,
+				Tags:     item.Tags,
+				Attempts: int32(item.Attempts),
+				Receipt:  item.Receipt,
+			})
+			if err != nil {
+				// Hand back the items the client never received.
+				for _, unsent := range items[i:] {
+					s.queue.NackReceipt(unsent.Receipt, 0)
+				}
+				return err
+			}
+		}
+	}
+}
+
+// Ack removes an item received from Dequeue, only for the delivery named by
+// the receipt of the request. Requests from older clients without a receipt
+// acknowledge the item by ID.
+func (s *Server) Ack(ctx context.Context, req *AckRequest) (*AckResponse, error) {
+	if err := s.authorize(ctx, queueauth.PermConsume); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if receipt := req.GetReceipt(); receipt != "" {
+		err = s.queue.AckReceipt(receipt)
+	} else {
+		err = s.queue.Ack(int(req.GetId()))
+	}
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &AckResponse{}, nil
+}
+
+// Stats returns the number of items in each state.
+func (s *Server) Stats(ctx context.Context, req *StatsRequest) (*StatsResponse, error) {
+	if err := s.authorize(ctx, queueauth.PermRead); err != nil {
+		return nil, err
+	}
+	stats, err := s.queue.Stats()
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &StatsResponse{
+		Pending:  int64(stats.Pending),
+		InFlight: int64(stats.InFlight),
+		Dead:     int64(stats.Dead),
+		Bytes:    stats.Bytes,
+	}, nil
+}
+
+// authorize checks that the caller of the RPC holds the permission, using the
+// bearer token in the metadata and the TLS state of the connection.
+func (s *Server) authorize(ctx context.Context, need queueauth.Permission) error {
+	if s.cfg.Auth == nil {
+		return nil
+	}
+
+	var token string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("authorization"); len(values) > 0 {
+			token = queueauth.BearerToken(values[0])
+		}
+	}
+
+	var state *tls.ConnectionState
+	if p, ok := peer.FromContext(ctx); ok {
+		if info, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+			state = &info.State
+		}
+	}
+
+	return toStatus(s.cfg.Auth.Authorize(token, state, need))
+}
+
+// toStatus maps errors returned by the queue to gRPC status codes.
+func toStatus(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, queueauth.ErrUnauthenticated):
+		return status.Error(codes.Unauthenticated, err.Error())
+	case errors.Is(err, queueauth.ErrPermissionDenied):
+		return status.Error(codes.PermissionDenied, err.Error())
+	case errors.Is(err, queue.ErrItemNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, queue.ErrInvalidReceipt):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, queue.ErrQueueFull):
+		return status.Error(codes.ResourceExhausted, err.Error())
+	case errors.Is(err, queue.ErrClosed):
+		return status.Error(codes.Unavailable, err.Error())
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
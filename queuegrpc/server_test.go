@@ -0,0 +1,138 @@
+package queuegrpc
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/elum-utils/queue"
+	"github.com/elum-utils/queue/queueauth"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func setupClient(t *testing.T, config ...Config) QueueClient {
+	t.Helper()
+	q, err := queue.New(queue.Config{})
+	if err != nil {
+		t.Fatalf("failed to initialize queue: %v", err)
+	}
+
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	cfg := Config{PollInterval: 50 * time.Millisecond}
+	if len(config) > 0 {
+		cfg = config[0]
+	}
+	RegisterQueueServer(server, NewServer(q, cfg))
+	go server.Serve(listener)
+
+	conn, err := grpc.NewClient(
+		"passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("failed to dial server: %v", err)
+	}
+
+	t.Cleanup(func() {
+		conn.Close()
+		server.Stop()
+		q.Close()
+	})
+	return NewQueueClient(conn)
+}
+
+func TestEnqueueDequeueAck(t *testing.T) {
+	client := setupClient(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := client.Enqueue(ctx, &EnqueueRequest{Data: []byte("hello"), Tags: []string{"email"}}); err != nil {
+		t.Fatalf("failed to enqueue: %v", err)
+	}
+
+	stream, err := client.Dequeue(ctx, &DequeueRequest{})
+	if err != nil {
+		t.Fatalf("failed to dequeue: %v", err)
+	}
+	item, err := stream.Recv()
+	if err != nil {
+		t.Fatalf("failed to receive item: %v", err)
+	}
+	if string(item.GetData()) != "hello" || item.GetTags()[0] != "email" {
+		t.Fatalf("unexpected item: %v", item)
+	}
+
+	stats, err := client.Stats(ctx, &StatsRequest{})
+	if err != nil {
+		t.Fatalf("failed to read stats: %v", err)
+	}
+	if stats.GetInFlight() != 1 {
+		t.Fatalf("expected 1 in-flight item, got %v", stats)
+	}
+
+	if _, err := client.Ack(ctx, &AckRequest{Id: item.GetId()}); err != nil {
+		t.Fatalf("failed to ack: %v", err)
+	}
+	_, err = client.Ack(ctx, &AckRequest{Id: item.GetId()})
+	if status.Code(err) != codes.NotFound {
+		t.Fatalf("expected NotFound acking twice, got %v", err)
+	}
+}
+
+func TestAckReceipt(t *testing.T) {
+	client := setupClient(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := client.Enqueue(ctx, &EnqueueRequest{Data: []byte("hello")}); err != nil {
+		t.Fatalf("failed to enqueue: %v", err)
+	}
+	stream, err := client.Dequeue(ctx, &DequeueRequest{})
+	if err != nil {
+		t.Fatalf("failed to dequeue: %v", err)
+	}
+	item, err := stream.Recv()
+	if err != nil || item.GetReceipt() == "" {
+		t.Fatalf("expected an item with a receipt, got %v, %v", item, err)
+	}
+
+	if _, err := client.Ack(ctx, &AckRequest{Receipt: item.GetReceipt()}); err != nil {
+		t.Fatalf("failed to ack: %v", err)
+	}
+	_, err = client.Ack(ctx, &AckRequest{Receipt: item.GetReceipt()})
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("expected FailedPrecondition acking twice, got %v", err)
+	}
+}
+
+func TestAuthentication(t *testing.T) {
+	auth := queueauth.New(queueauth.Config{Tokens: map[string]queueauth.Permission{
+		"producer": queueauth.PermEnqueue,
+	}})
+	client := setupClient(t, Config{Auth: auth})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := client.Enqueue(ctx, &EnqueueRequest{Data: []byte("hello")})
+	if status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("expected Unauthenticated without a token, got %v", err)
+	}
+
+	ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer producer")
+	if _, err := client.Enqueue(ctx, &EnqueueRequest{Data: []byte("hello")}); err != nil {
+		t.Fatalf("expected the producer token to enqueue, got %v", err)
+	}
+	if _, err := client.Stats(ctx, &StatsRequest{}); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("expected PermissionDenied for an enqueue-only token, got %v", err)
+	}
+}
@@ -0,0 +1,353 @@
+// Package queuehttp exposes a queue over HTTP with JSON responses, so producers
+// written in other languages, cron scripts, and other services can push work
+// into it and operators can inspect it.
+//
+// Routes:
+//
+//	POST   /items                           enqueue the request body; ?tag= may be repeated
+//	GET    /items?limit=N                   peek at up to N items
+//	DELETE /items/{id}                      delete an item
+//	POST   /claim?limit=N&wait=D            claim up to N items, waiting up to D for one
+//	POST   /receipts/{receipt}/ack          acknowledge a claimed item
+//	POST   /receipts/{receipt}/nack?delay=D hand a claimed item back, hidden for D
+//	POST   /items/{id}/ack                  deprecated: acknowledge a claimed item by ID
+//	POST   /items/{id}/release              deprecated: hand a claimed item back by ID
+//	GET    /stats                           item counts per state and total payload size
+//	GET    /dead?limit=N                    list dead letters
+//	POST   /dead/{id}/requeue               move a dead letter back to pending
+//
+// Items are claimed by the queue behind the handler, so claimed items must be
+// acknowledged or released through the same handler, with the receipt
+// returned by the claim. The receipt only matches the delivery it was issued
+// for, so a consumer whose lease expired cannot acknowledge the item once
+// another consumer claimed it; the by-ID routes cannot tell them apart.
+//
+// Set Config.Auth to require an API token ("Authorization: Bearer <token>") or
+// a verified TLS client certificate granting the permission of each route.
+package queuehttp
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/elum-utils/queue"
+	"github.com/elum-utils/queue/queueauth"
+)
+
+// Config represents configuration options for the HTTP handler.
+type Config struct {
+	MaxBodyBytes int64         // Largest accepted payload in bytes.
+	DefaultLimit int           // Number of items listed when the request has no limit.
+	MaxWait      time.Duration // Longest time a claim request may wait for items.
+
+	// Auth authenticates callers; nil leaves every route open.
+	Auth *queueauth.Authenticator
+
+	// TLS settings used by ListenAndServe. TLS is enabled when TLS or CertFile
+	// is set; ClientCAFile enables verification of client certificates.
+	TLS          *tls.Config
+	CertFile     string
+	KeyFile      string
+	ClientCAFile string
+}
+
+// configDefault fills in the settings left empty in the provided configuration.
+func configDefault(config ...Config) Config {
+	cfg := Config{}
+	if len(config) > 0 {
+		cfg = config[0]
+	}
+
+	if cfg.MaxBodyBytes <= 0 {
+		cfg.MaxBodyBytes = 1 << 20 // 1 MiB.
+	}
+	if cfg.DefaultLimit <= 0 {
+		cfg.DefaultLimit = 100
+	}
+	if cfg.MaxWait <= 0 {
+		cfg.MaxWait = 30 * time.Second
+	}
+	return cfg
+}
+
+// Handler serves the HTTP API of a single queue.
+type Handler struct {
+	queue *queue.Queue
+	cfg   Config
+	mux   *http.ServeMux
+}
+
+// NewHandler returns an http.Handler exposing q. Mount it under a prefix with
+// http.StripPrefix to serve it next to other routes.
+func NewHandler(q *queue.Queue, config ...Config) *Handler {
+	h := &Handler{
+		queue: q,
+		cfg:   configDefault(config...),
+		mux:   http.NewServeMux(),
+	}
+
+	h.handle("POST /items", queueauth.PermEnqueue, h.enqueue)
+	h.handle("GET /items", queueauth.PermRead, h.peek)
+	h.handle("DELETE /items/{id}", queueauth.PermAdmin, h.update(h.queue.Delete))
+	h.handle("POST /claim", queueauth.PermConsume, h.claim)
+	h.handle("POST /receipts/{receipt}/ack", queueauth.PermConsume, h.ackReceipt)
+	h.handle("POST /receipts/{receipt}/nack", queueauth.PermConsume, h.nackReceipt)
+	h.handle("POST /items/{id}/ack", queueauth.PermConsume, h.update(h.queue.Ack))
+	h.handle("POST /items/{id}/release", queueauth.PermConsume, h.update(h.queue.Release))
+	h.handle("GET /stats", queueauth.PermRead, h.stats)
+	h.handle("GET /dead", queueauth.PermRead, h.deadLetters)
+	h.handle("POST /dead/{id}/requeue", queueauth.PermAdmin, h.update(h.queue.Requeue))
+
+	return h
+}
+
+// handle registers a route that requires the given permission.
+func (h *Handler) handle(pattern string, need queueauth.Permission, fn http.HandlerFunc) {
+	h.mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+		token := queueauth.BearerToken(r.Header.Get("Authorization"))
+		switch err := h.cfg.Auth.Authorize(token, r.TLS, need); {
+		case errors.Is(err, queueauth.ErrUnauthenticated):
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, err)
+		case err != nil:
+			writeError(w, http.StatusForbidden, err)
+		default:
+			fn(w, r)
+		}
+	})
+}
+
+// ServeHTTP implements http.Handler.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+func (h *Handler) enqueue(w http.ResponseWriter, r *http.Request) {
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, h.cfg.MaxBodyBytes))
+	if err != nil {
+		writeError(w, http.StatusRequestEntityTooLarge, err)
+		return
+	}
+
+	if err := h.queue.AddTagged(data, r.URL.Query()["tag"]...); err != nil {
+		writeQueueError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (h *Handler) peek(w http.ResponseWriter, r *http.Request) {
+	limit, err := h.limit(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	items, err := h.queue.Get(limit)
+	if err != nil {
+		writeQueueError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, records(items))
+}
+
+func (h *Handler) claim(w http.ResponseWriter, r *http.Request) {
+	limit, err := h.limit(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var wait time.Duration
+	if value := r.URL.Query().Get("wait"); value != "" {
+		if wait, err = time.ParseDuration(value); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		wait = min(wait, h.cfg.MaxWait)
+	}
+
+	var items []queue.Item
+	if wait > 0 {
+		items, err = h.queue.ClaimWait(r.Context(), limit, wait)
+	} else {
+		items, err = h.queue.Claim(limit)
+	}
+	if err != nil {
+		writeQueueError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, records(items))
+}
+
+// update returns a handler applying fn to the item named in the path.
+func (h *Handler) update(fn func(id int) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		if err := fn(id); err != nil {
+			writeQueueError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (h *Handler) ackReceipt(w http.ResponseWriter, r *http.Request) {
+	if err := h.queue.AckReceipt(r.PathValue("receipt")); err != nil {
+		writeQueueError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) nackReceipt(w http.ResponseWriter, r *http.Request) {
+	var delay time.Duration
+	if value := r.URL.Query().Get("delay"); value != "" {
+		var err error
+		if delay, err = time.ParseDuration(value); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	if err := h.queue.NackReceipt(r.PathValue("receipt"), delay); err != nil {
+		writeQueueError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) stats(w http.ResponseWriter, r *http.Request) {
+	stats, err := h.queue.Stats()
+	if err != nil {
+		writeQueueError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, stats)
+}
+
+func (h *Handler) deadLetters(w http.ResponseWriter, r *http.Request) {
+	limit, err := h.limit(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	items, err := h.queue.DeadLetters(limit)
+	if err != nil {
+		writeQueueError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, records(items))
+}
+
+// ListenAndServe serves the handler on addr, over TLS if configured, until
+// ctx is done. It then shuts the server down gracefully.
+func (h *Handler) ListenAndServe(ctx context.Context, addr string) error {
+	server := &http.Server{Addr: addr, Handler: h}
+
+	if h.cfg.TLS != nil || h.cfg.CertFile != "" {
+		tlsConfig, err := queueauth.TLSConfig(h.cfg.TLS, h.cfg.CertFile, h.cfg.KeyFile, h.cfg.ClientCAFile)
+		if err != nil {
+			return err
+		}
+		server.TLSConfig = tlsConfig
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		if server.TLSConfig != nil {
+			errc <- server.ServeTLS(listener, "", "")
+		} else {
+			errc <- server.Serve(listener)
+		}
+	}()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+		return server.Shutdown(context.Background())
+	}
+}
+
+// limit parses the limit query parameter, falling back to the configured default.
+func (h *Handler) limit(r *http.Request) (int, error) {
+	value := r.URL.Query().Get("limit")
+	if value == "" {
+		return h.cfg.DefaultLimit, nil
+	}
+
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit < 1 {
+		return 0, errors.New("limit must be a positive integer")
+	}
+	return limit, nil
+}
+
+// Item is the JSON representation of an item in the responses of the
+// handler.
+type Item struct {
+	ID       int         `json:"id"`                 // Identifier of the item.
+	State    queue.State `json:"state"`              // State of the item.
+	Priority int         `json:"priority,omitempty"` // Priority of the item.
+	Attempts int         `json:"attempts,omitempty"` // Number of times the item was handed to a consumer.
+	Tags     []string    `json:"tags,omitempty"`     // Tags attached to the item.
+	Tenant   string      `json:"tenant,omitempty"`   // Tenant of the item.
+	Receipt  string      `json:"receipt,omitempty"`  // Receipt of the delivery, for the items of a claim.
+	Data     []byte      `json:"data"`               // Payload of the item, base64 encoded.
+}
+
+// records converts items to their JSON representation.
+func records(items []queue.Item) []Item {
+	out := make([]Item, len(items))
+	for i, item := range items {
+		out[i] = Item{ID: item.ID, State: item.State, Priority: item.Priority, Attempts: item.Attempts, Tags: item.Tags, Tenant: item.Tenant, Receipt: item.Receipt, Data: item.Data}
+	}
+	return out
+}
+
+// writeQueueError maps errors returned by the queue to HTTP status codes.
+func writeQueueError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, queue.ErrItemNotFound):
+		writeError(w, http.StatusNotFound, err)
+	case errors.Is(err, queue.ErrQueueFull):
+		writeError(w, http.StatusServiceUnavailable, err)
+	case errors.Is(err, queue.ErrItemInProgress):
+		writeError(w, http.StatusConflict, err)
+	case errors.Is(err, queue.ErrInvalidReceipt):
+		writeError(w, http.StatusGone, err)
+	default:
+		writeError(w, http.StatusInternalServerError, err)
+	}
+}
+
+// writeError responds with the error message as a JSON object.
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// writeJSON responds with v encoded as JSON.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
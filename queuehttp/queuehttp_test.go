@@ -0,0 +1,230 @@
+package queuehttp
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/elum-utils/queue"
+	"github.com/elum-utils/queue/queueauth"
+)
+
+func setupServer(t *testing.T, config ...Config) (*queue.Queue, *httptest.Server) {
+	t.Helper()
+	q, err := queue.New(queue.Config{})
+	if err != nil {
+		t.Fatalf("failed to initialize queue: %v", err)
+	}
+	server := httptest.NewServer(NewHandler(q, config...))
+	t.Cleanup(func() {
+		server.Close()
+		q.Close()
+	})
+	return q, server
+}
+
+func TestEnqueueClaimAck(t *testing.T) {
+	_, server := setupServer(t)
+
+	resp, err := http.Post(server.URL+"/items?tag=email", "application/octet-stream", strings.NewReader("hello"))
+	if err != nil {
+		t.Fatalf("failed to enqueue: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d", resp.StatusCode)
+	}
+
+	resp, err = http.Get(server.URL + "/items?limit=10")
+	if err != nil {
+		t.Fatalf("failed to peek: %v", err)
+	}
+	var records []Item
+	if err := json.NewDecoder(resp.Body).Decode(&records); err != nil {
+		t.Fatalf("failed to decode items: %v", err)
+	}
+	resp.Body.Close()
+	if len(records) != 1 || string(records[0].Data) != "hello" || records[0].Tags[0] != "email" {
+		t.Fatalf("unexpected items: %+v", records)
+	}
+
+	resp, err = http.Post(server.URL+"/claim?limit=1", "", nil)
+	if err != nil {
+		t.Fatalf("failed to claim: %v", err)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&records); err != nil {
+		t.Fatalf("failed to decode claimed items: %v", err)
+	}
+	resp.Body.Close()
+	if len(records) != 1 || records[0].State != queue.StateInFlight || records[0].Attempts != 1 {
+		t.Fatalf("unexpected claimed items: %+v", records)
+	}
+
+	resp, err = http.Post(server.URL+"/items/1/ack", "", nil)
+	if err != nil {
+		t.Fatalf("failed to ack: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", resp.StatusCode)
+	}
+
+	resp, err = http.Get(server.URL + "/stats")
+	if err != nil {
+		t.Fatalf("failed to read stats: %v", err)
+	}
+	var stats queue.Stats
+	if err := json.NewDecoder(resp.Body).Decode(&stats); err != nil {
+		t.Fatalf("failed to decode stats: %v", err)
+	}
+	resp.Body.Close()
+	if stats.Pending != 0 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestAckReceipt(t *testing.T) {
+	q, server := setupServer(t)
+
+	if err := q.Add([]byte("hello")); err != nil {
+		t.Fatalf("failed to add item: %v", err)
+	}
+	resp, err := http.Post(server.URL+"/claim?limit=1", "", nil)
+	if err != nil {
+		t.Fatalf("failed to claim: %v", err)
+	}
+	var records []Item
+	if err := json.NewDecoder(resp.Body).Decode(&records); err != nil {
+		t.Fatalf("failed to decode claimed items: %v", err)
+	}
+	resp.Body.Close()
+	if len(records) != 1 || records[0].Receipt == "" {
+		t.Fatalf("expected a claimed item with a receipt, got %+v", records)
+	}
+
+	for _, want := range []int{http.StatusNoContent, http.StatusGone} {
+		resp, err = http.Post(server.URL+"/receipts/"+records[0].Receipt+"/ack", "", nil)
+		if err != nil {
+			t.Fatalf("failed to ack: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Fatalf("expected %d, got %d", want, resp.StatusCode)
+		}
+	}
+}
+
+func TestRequeueMissingDeadLetter(t *testing.T) {
+	_, server := setupServer(t)
+
+	resp, err := http.Post(server.URL+"/dead/42/requeue", "", nil)
+	if err != nil {
+		t.Fatalf("failed to requeue: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", resp.StatusCode)
+	}
+
+	resp, err = http.Get(server.URL + "/items?limit=zero")
+	if err != nil {
+		t.Fatalf("failed to peek: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", resp.StatusCode)
+	}
+}
+
+func TestAuthentication(t *testing.T) {
+	auth := queueauth.New(queueauth.Config{Tokens: map[string]queueauth.Permission{
+		"producer": queueauth.PermEnqueue,
+	}})
+	_, server := setupServer(t, Config{Auth: auth})
+
+	enqueue := func(token string) int {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodPost, server.URL+"/items", strings.NewReader("hello"))
+		if err != nil {
+			t.Fatalf("failed to build request: %v", err)
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("failed to enqueue: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if status := enqueue(""); status != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without a token, got %d", status)
+	}
+	if status := enqueue("producer"); status != http.StatusAccepted {
+		t.Fatalf("expected 202 with the producer token, got %d", status)
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, server.URL+"/dead/1/requeue", nil)
+	req.Header.Set("Authorization", "Bearer producer")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("failed to requeue: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected 403 for an enqueue-only token, got %d", resp.StatusCode)
+	}
+}
+
+func TestListenAndServeTLS(t *testing.T) {
+	// Borrow the test certificate of httptest, which its client trusts.
+	certServer := httptest.NewTLSServer(http.NotFoundHandler())
+	defer certServer.Close()
+
+	q, err := queue.New(queue.Config{})
+	if err != nil {
+		t.Fatalf("failed to initialize queue: %v", err)
+	}
+	defer q.Close()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to pick a port: %v", err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	handler := NewHandler(q, Config{TLS: &tls.Config{Certificates: certServer.TLS.Certificates}})
+	done := make(chan error, 1)
+	go func() { done <- handler.ListenAndServe(ctx, addr) }()
+
+	client := certServer.Client()
+	var resp *http.Response
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		if resp, err = client.Get("https://" + addr + "/stats"); err == nil || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("failed to query over TLS: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.TLS == nil {
+		t.Fatalf("expected a TLS response, got %d", resp.StatusCode)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("unexpected shutdown error: %v", err)
+	}
+}
@@ -0,0 +1,86 @@
+// Package queuekafka bridges a queue and Kafka using segmentio/kafka-go.
+// Sink publishes forwarded items to a topic and Source consumes a topic into
+// the queue; run them with queuebridge.Forwarder and queuebridge.Ingest.
+package queuekafka
+
+import (
+	"context"
+
+	"github.com/elum-utils/queue"
+	"github.com/elum-utils/queue/queuebridge"
+	"github.com/segmentio/kafka-go"
+)
+
+// TagHeader is the Kafka header carrying the tags of an item, one header per tag.
+const TagHeader = "queue-tag"
+
+// Writer is the part of *kafka.Writer used by Sink.
+type Writer interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+}
+
+// Reader is the part of *kafka.Reader used by Source. The reader must belong
+// to a consumer group so offsets are committed explicitly.
+type Reader interface {
+	FetchMessage(ctx context.Context) (kafka.Message, error)
+	CommitMessages(ctx context.Context, msgs ...kafka.Message) error
+}
+
+// Sink publishes items to Kafka. Configure the writer with RequiredAcks set to
+// kafka.RequireAll so an item is acknowledged locally only after the brokers
+// stored it durably.
+type Sink struct {
+	writer Writer
+}
+
+var _ queuebridge.Publisher = (*Sink)(nil)
+
+// NewSink returns a Sink writing to w, typically a *kafka.Writer with a Topic.
+func NewSink(w Writer) *Sink {
+	return &Sink{writer: w}
+}
+
+// Publish writes the item as a single message and waits for the write to complete.
+func (s *Sink) Publish(ctx context.Context, item queue.Item) error {
+	msg := kafka.Message{Value: item.Data}
+	for _, tag := range item.Tags {
+		msg.Headers = append(msg.Headers, kafka.Header{Key: TagHeader, Value: []byte(tag)})
+	}
+	return s.writer.WriteMessages(ctx, msg)
+}
+
+// Source consumes messages from Kafka. Offsets are committed only after the
+// message was added to the queue, so nothing is lost if the process stops.
+type Source struct {
+	reader Reader
+}
+
+var _ queuebridge.Source = (*Source)(nil)
+
+// NewSource returns a Source reading from r, typically a *kafka.Reader with a GroupID.
+func NewSource(r Reader) *Source {
+	return &Source{reader: r}
+}
+
+// Receive fetches the next message. Its TagHeader headers become the item tags.
+func (s *Source) Receive(ctx context.Context) (queuebridge.Message, error) {
+	msg, err := s.reader.FetchMessage(ctx)
+	if err != nil {
+		return queuebridge.Message{}, err
+	}
+
+	var tags []string
+	for _, header := range msg.Headers {
+		if header.Key == TagHeader {
+			tags = append(tags, string(header.Value))
+		}
+	}
+
+	return queuebridge.Message{
+		Data: msg.Value,
+		Tags: tags,
+		Commit: func(ctx context.Context) error {
+			return s.reader.CommitMessages(ctx, msg)
+		},
+	}, nil
+}
@@ -0,0 +1,67 @@
+package queuekafka
+
+import (
+	"context"
+	"testing"
+
+	"github.com/elum-utils/queue"
+	"github.com/segmentio/kafka-go"
+)
+
+// fakeBroker records written messages and serves them back to the reader.
+type fakeBroker struct {
+	messages  []kafka.Message
+	committed []kafka.Message
+}
+
+func (b *fakeBroker) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	b.messages = append(b.messages, msgs...)
+	return nil
+}
+
+func (b *fakeBroker) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	if len(b.messages) == 0 {
+		<-ctx.Done()
+		return kafka.Message{}, ctx.Err()
+	}
+	msg := b.messages[0]
+	b.messages = b.messages[1:]
+	return msg, nil
+}
+
+func (b *fakeBroker) CommitMessages(ctx context.Context, msgs ...kafka.Message) error {
+	b.committed = append(b.committed, msgs...)
+	return nil
+}
+
+var (
+	_ Writer = (*kafka.Writer)(nil)
+	_ Reader = (*kafka.Reader)(nil)
+)
+
+func TestRoundTrip(t *testing.T) {
+	broker := &fakeBroker{}
+
+	item := queue.Item{ID: 1, Data: []byte("hello"), Tags: []string{"email", "urgent"}}
+	if err := NewSink(broker).Publish(context.Background(), item); err != nil {
+		t.Fatalf("failed to publish: %v", err)
+	}
+
+	msg, err := NewSource(broker).Receive(context.Background())
+	if err != nil {
+		t.Fatalf("failed to receive: %v", err)
+	}
+	if string(msg.Data) != "hello" || len(msg.Tags) != 2 || msg.Tags[1] != "urgent" {
+		t.Fatalf("unexpected message: %+v", msg)
+	}
+
+	if len(broker.committed) != 0 {
+		t.Fatalf("expected no commit before the message is enqueued")
+	}
+	if err := msg.Commit(context.Background()); err != nil {
+		t.Fatalf("failed to commit: %v", err)
+	}
+	if len(broker.committed) != 1 {
+		t.Fatalf("expected the message to be committed")
+	}
+}
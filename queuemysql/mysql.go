@@ -0,0 +1,366 @@
+// Package queuemysql implements queue.Queuer on MySQL or MariaDB, for teams
+// that distribute work across instances through a shared MySQL server instead
+// of a SQLite file. Items are claimed with SELECT ... FOR UPDATE SKIP LOCKED,
+// so concurrent consumers never wait for each other's rows.
+//
+// Open the database with a MySQL driver such as github.com/go-sql-driver/mysql.
+package queuemysql
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/elum-utils/queue"
+)
+
+// Config represents configuration options for a MySQL-backed queue.
+type Config struct {
+	Table        string        // Name of the items table.
+	LeaseTimeout time.Duration // How long a claimed item stays reserved before another consumer may take it over.
+	MaxAttempts  int           // Deliveries before an item moves to the dead letters; 0 means unlimited.
+	PollInterval time.Duration // How often ClaimWait looks for new items.
+
+	// DisableSkipLocked claims with a plain FOR UPDATE for servers without
+	// SKIP LOCKED support (MySQL before 8.0, MariaDB before 10.6). Consumers
+	// then wait for each other while claiming.
+	DisableSkipLocked bool
+}
+
+// configDefault fills in the settings left empty in the provided configuration.
+func configDefault(config ...Config) Config {
+	cfg := Config{}
+	if len(config) > 0 {
+		cfg = config[0]
+	}
+
+	if cfg.Table == "" {
+		cfg.Table = "queue"
+	}
+	if cfg.LeaseTimeout <= 0 {
+		cfg.LeaseTimeout = 5 * time.Minute
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = time.Second
+	}
+	return cfg
+}
+
+// validTableName matches names that are safe to splice into SQL statements.
+var validTableName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Queue is a queue.Queuer stored in a MySQL table.
+type Queue struct {
+	db    *sql.DB
+	cfg   Config
+	owner string // Identifies this instance on the items it claims.
+
+	ctx        context.Context
+	cancelFunc context.CancelFunc
+}
+
+var _ queue.Queuer = (*Queue)(nil)
+
+// New creates the items table in db if needed and returns a queue stored in
+// it. Close leaves db open.
+func New(db *sql.DB, config ...Config) (*Queue, error) {
+	cfg := configDefault(config...)
+	if !validTableName.MatchString(cfg.Table) {
+		return nil, fmt.Errorf("queuemysql: invalid table name %q", cfg.Table)
+	}
+
+	_, err := db.Exec(`
+        CREATE TABLE IF NOT EXISTS ` + cfg.Table + ` (
+            id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+            data LONGBLOB NOT NULL,
+            tags JSON NULL,
+            state VARCHAR(16) NOT NULL DEFAULT 'pending',
+            owner VARCHAR(255) NULL,
+            lease_until BIGINT NULL,
+            attempts INT NOT NULL DEFAULT 0,
+            priority INT NOT NULL DEFAULT 0,
+            KEY ` + cfg.Table + `_state_priority_id (state, priority, id)
+        )
+    `)
+	if err != nil {
+		return nil, err
+	}
+
+	var suffix [8]byte
+	rand.Read(suffix[:])
+
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	return &Queue{
+		db:         db,
+		cfg:        cfg,
+		owner:      hex.EncodeToString(suffix[:]),
+		ctx:        ctx,
+		cancelFunc: cancelFunc,
+	}, nil
+}
+
+// Add inserts a new item into the queue.
+func (q *Queue) Add(data []byte) error {
+	return q.AddTagged(data)
+}
+
+// AddTagged inserts a new item with the given tags into the queue.
+func (q *Queue) AddTagged(data []byte, tags ...string) error {
+	var encoded any
+	if len(tags) > 0 {
+		b, err := json.Marshal(tags)
+		if err != nil {
+			return err
+		}
+		encoded = string(b)
+	}
+
+	_, err := q.db.ExecContext(q.ctx, "INSERT INTO "+q.cfg.Table+" (data, tags) VALUES (?, ?)", data, encoded)
+	return err
+}
+
+// Claim marks up to 'limit' pending items as in-flight for this instance and
+// returns them, highest priority first, then FIFO. Items whose lease expired
+// are claimed again; items that used up MaxAttempts move to the dead letters.
+func (q *Queue) Claim(limit int) ([]queue.Item, error) {
+	tx, err := q.db.BeginTx(q.ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback() // No-op after a successful commit.
+
+	now := time.Now().UnixNano()
+	lock := "FOR UPDATE SKIP LOCKED"
+	if q.cfg.DisableSkipLocked {
+		lock = "FOR UPDATE"
+	}
+
+	rows, err := tx.QueryContext(
+		q.ctx,
+		"SELECT id, data, tags, attempts, priority FROM "+q.cfg.Table+
+			" WHERE state = 'pending' OR (state = 'in-flight' AND lease_until < ?)"+
+			" ORDER BY priority DESC, id LIMIT ? "+lock,
+		now, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []queue.Item
+	var dead []any
+	for rows.Next() {
+		var item queue.Item
+		var tags sql.NullString
+		if err := rows.Scan(&item.ID, &item.Data, &tags, &item.Attempts, &item.Priority); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if tags.Valid {
+			if err := json.Unmarshal([]byte(tags.String), &item.Tags); err != nil {
+				rows.Close()
+				return nil, err
+			}
+		}
+
+		if q.cfg.MaxAttempts > 0 && item.Attempts >= q.cfg.MaxAttempts {
+			dead = append(dead, item.ID)
+			continue
+		}
+		item.State = queue.StateInFlight
+		item.Attempts++
+		item.Receipt = strconv.Itoa(item.ID) + "." + strconv.Itoa(item.Attempts)
+		items = append(items, item)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(dead) > 0 {
+		_, err := tx.ExecContext(q.ctx, "UPDATE "+q.cfg.Table+" SET state = 'dead', owner = NULL, lease_until = NULL WHERE id IN ("+placeholders(len(dead))+")", dead...)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(items) > 0 {
+		args := []any{q.owner, now + q.cfg.LeaseTimeout.Nanoseconds()}
+		for _, item := range items {
+			args = append(args, item.ID)
+		}
+		_, err := tx.ExecContext(q.ctx, "UPDATE "+q.cfg.Table+" SET state = 'in-flight', owner = ?, lease_until = ?, attempts = attempts + 1 WHERE id IN ("+placeholders(len(items))+")", args...)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return items, tx.Commit()
+}
+
+// ClaimWait claims up to 'limit' items like Claim, polling every
+// Config.PollInterval until at least one item is claimed or maxWait elapses.
+// It returns no items and no error if the wait times out, and the context
+// error if ctx is done first.
+func (q *Queue) ClaimWait(ctx context.Context, limit int, maxWait time.Duration) ([]queue.Item, error) {
+	timer := time.NewTimer(maxWait)
+	defer timer.Stop()
+
+	ticker := time.NewTicker(q.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		items, err := q.Claim(limit)
+		if err != nil || len(items) > 0 {
+			return items, err
+		}
+
+		select {
+		case <-ticker.C:
+		case <-timer.C:
+			return nil, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// AckReceipt removes an item claimed by this instance. It returns
+// queue.ErrInvalidReceipt unless the receipt belongs to the current delivery
+// of the item.
+func (q *Queue) AckReceipt(receipt string) error {
+	id, attempt, err := parseReceipt(receipt)
+	if err != nil {
+		return err
+	}
+	err = q.exec("DELETE FROM "+q.cfg.Table+" WHERE id = ? AND owner = ? AND state = 'in-flight' AND attempts = ?", id, q.owner, attempt)
+	if errors.Is(err, queue.ErrItemNotFound) {
+		return queue.ErrInvalidReceipt
+	}
+	return err
+}
+
+// NackReceipt hands an item claimed by this instance back to the queue. It
+// returns queue.ErrInvalidReceipt unless the receipt belongs to the current
+// delivery of the item. With a positive delay the item keeps its lease,
+// without an owner, until the delay has passed, so it counts as in flight
+// meanwhile.
+func (q *Queue) NackReceipt(receipt string, delay time.Duration) error {
+	id, attempt, err := parseReceipt(receipt)
+	if err != nil {
+		return err
+	}
+	if delay > 0 {
+		err = q.exec(
+			"UPDATE "+q.cfg.Table+" SET owner = NULL, lease_until = ? WHERE id = ? AND owner = ? AND state = 'in-flight' AND attempts = ?",
+			time.Now().Add(delay).UnixNano(), id, q.owner, attempt,
+		)
+	} else {
+		err = q.exec("UPDATE "+q.cfg.Table+" SET state = 'pending', owner = NULL, lease_until = NULL WHERE id = ? AND owner = ? AND state = 'in-flight' AND attempts = ?", id, q.owner, attempt)
+	}
+	if errors.Is(err, queue.ErrItemNotFound) {
+		return queue.ErrInvalidReceipt
+	}
+	return err
+}
+
+// Ack removes an item claimed by this instance. It returns
+// queue.ErrItemNotFound if the item is not held by this instance.
+//
+// Deprecated: use AckReceipt.
+func (q *Queue) Ack(id int) error {
+	return q.exec("DELETE FROM "+q.cfg.Table+" WHERE id = ? AND owner = ? AND state = 'in-flight'", id, q.owner)
+}
+
+// Release hands an item claimed by this instance back to the queue. It
+// returns queue.ErrItemNotFound if the item is not held by this instance.
+//
+// Deprecated: use NackReceipt.
+func (q *Queue) Release(id int) error {
+	return q.exec("UPDATE "+q.cfg.Table+" SET state = 'pending', owner = NULL, lease_until = NULL WHERE id = ? AND owner = ? AND state = 'in-flight'", id, q.owner)
+}
+
+// Stats returns the number of items in each state and the total payload size.
+func (q *Queue) Stats() (queue.Stats, error) {
+	rows, err := q.db.QueryContext(q.ctx, "SELECT state, COUNT(*), COALESCE(SUM(LENGTH(data)), 0) FROM "+q.cfg.Table+" GROUP BY state")
+	if err != nil {
+		return queue.Stats{}, err
+	}
+	defer rows.Close() // Ensure rows are closed after processing.
+
+	var stats queue.Stats
+	for rows.Next() {
+		var state queue.State
+		var count int
+		var bytes int64
+		if err := rows.Scan(&state, &count, &bytes); err != nil {
+			return queue.Stats{}, err
+		}
+
+		switch state {
+		case queue.StatePending:
+			stats.Pending = count
+		case queue.StateInFlight:
+			stats.InFlight = count
+		case queue.StateDead:
+			stats.Dead = count
+		}
+		stats.Bytes += bytes
+	}
+	return stats, rows.Err()
+}
+
+// Close cancels pending operations. The database handle stays open.
+func (q *Queue) Close() error {
+	q.cancelFunc()
+	return nil
+}
+
+// exec runs a statement affecting a single item and returns
+// queue.ErrItemNotFound if no row was affected.
+func (q *Queue) exec(query string, args ...any) error {
+	res, err := q.db.ExecContext(q.ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return queue.ErrItemNotFound
+	}
+	return nil
+}
+
+// placeholders returns n comma-separated parameter placeholders.
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// parseReceipt splits a receipt into the item ID and the attempt it was
+// issued for. Every claim counts an attempt, so the receipts of earlier
+// deliveries stop matching.
+func parseReceipt(receipt string) (int, int, error) {
+	id, attempt, ok := strings.Cut(receipt, ".")
+	if !ok {
+		return 0, 0, queue.ErrInvalidReceipt
+	}
+	n, err := strconv.Atoi(id)
+	if err != nil {
+		return 0, 0, queue.ErrInvalidReceipt
+	}
+	a, err := strconv.Atoi(attempt)
+	if err != nil {
+		return 0, 0, queue.ErrInvalidReceipt
+	}
+	return n, a, nil
+}
@@ -0,0 +1,145 @@
+package queuemysql
+
+import (
+	"database/sql"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/elum-utils/queue"
+	_ "github.com/go-sql-driver/mysql"
+)
+
+// setupQueue connects to the server named by QUEUE_MYSQL_DSN, skipping the
+// test if it is not set, and returns a queue in a fresh table.
+func setupQueue(t *testing.T, config Config) (*Queue, *sql.DB) {
+	t.Helper()
+	dsn := os.Getenv("QUEUE_MYSQL_DSN")
+	if dsn == "" {
+		t.Skip("QUEUE_MYSQL_DSN not set")
+	}
+
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	if config.Table == "" {
+		config.Table = "queue_test"
+	}
+	if _, err := db.Exec("DROP TABLE IF EXISTS " + config.Table); err != nil {
+		t.Fatalf("failed to drop table: %v", err)
+	}
+
+	q, err := New(db, config)
+	if err != nil {
+		t.Fatalf("failed to initialize queue: %v", err)
+	}
+	t.Cleanup(func() {
+		q.Close()
+		db.Close()
+	})
+	return q, db
+}
+
+func TestClaimAck(t *testing.T) {
+	q, _ := setupQueue(t, Config{})
+
+	if err := q.AddTagged([]byte("hello"), "email"); err != nil {
+		t.Fatalf("failed to add item: %v", err)
+	}
+
+	items, err := q.Claim(10)
+	if err != nil {
+		t.Fatalf("failed to claim items: %v", err)
+	}
+	if len(items) != 1 || string(items[0].Data) != "hello" || items[0].Tags[0] != "email" {
+		t.Fatalf("unexpected items: %+v", items)
+	}
+
+	if err := q.Ack(items[0].ID); err != nil {
+		t.Fatalf("failed to ack item: %v", err)
+	}
+	if err := q.Ack(items[0].ID); !errors.Is(err, queue.ErrItemNotFound) {
+		t.Fatalf("expected ErrItemNotFound acking twice, got %v", err)
+	}
+}
+
+func TestConcurrentConsumers(t *testing.T) {
+	producer, db := setupQueue(t, Config{})
+
+	const total = 50
+	for i := 0; i < total; i++ {
+		if err := producer.Add([]byte("test data")); err != nil {
+			t.Fatalf("failed to add item: %v", err)
+		}
+	}
+
+	var mx sync.Mutex
+	deliveries := make(map[int]int)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		consumer, err := New(db, Config{Table: "queue_test"})
+		if err != nil {
+			t.Fatalf("failed to initialize consumer: %v", err)
+		}
+		defer consumer.Close()
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				items, err := consumer.Claim(5)
+				if err != nil {
+					t.Errorf("failed to claim items: %v", err)
+					return
+				}
+				if len(items) == 0 {
+					return
+				}
+				for _, item := range items {
+					mx.Lock()
+					deliveries[item.ID]++
+					mx.Unlock()
+					consumer.Ack(item.ID)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(deliveries) != total {
+		t.Fatalf("expected %d delivered items, got %d", total, len(deliveries))
+	}
+	for id, count := range deliveries {
+		if count != 1 {
+			t.Fatalf("item %d delivered %d times", id, count)
+		}
+	}
+}
+
+func TestReceipts(t *testing.T) {
+	q, _ := setupQueue(t, Config{LeaseTimeout: 10 * time.Millisecond})
+
+	if err := q.Add([]byte("hello")); err != nil {
+		t.Fatalf("failed to add item: %v", err)
+	}
+	first, err := q.Claim(1)
+	if err != nil || len(first) != 1 {
+		t.Fatalf("failed to claim item: %+v, %v", first, err)
+	}
+
+	// The lease runs out and the item is delivered again.
+	time.Sleep(20 * time.Millisecond)
+	second, err := q.Claim(1)
+	if err != nil || len(second) != 1 || second[0].Receipt == first[0].Receipt {
+		t.Fatalf("expected the item to be redelivered with a new receipt, got %+v, %v", second, err)
+	}
+	if err := q.AckReceipt(first[0].Receipt); !errors.Is(err, queue.ErrInvalidReceipt) {
+		t.Fatalf("expected the stale receipt to be rejected, got %v", err)
+	}
+	if err := q.AckReceipt(second[0].Receipt); err != nil {
+		t.Fatalf("failed to ack item: %v", err)
+	}
+}
@@ -0,0 +1,115 @@
+// Package queuenats bridges a queue and NATS JetStream, e.g. for edge devices
+// that buffer items locally and sync them once connectivity returns. Sink
+// publishes forwarded items to a subject and Source ingests from a consumer;
+// run them with queuebridge.Forwarder and queuebridge.Ingest, which retry with
+// backoff while the server is unreachable.
+package queuenats
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/elum-utils/queue"
+	"github.com/elum-utils/queue/queuebridge"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// TagHeader is the NATS header carrying the tags of an item, one value per tag.
+const TagHeader = "Queue-Tag"
+
+// Publisher is the part of jetstream.JetStream used by Sink.
+type Publisher interface {
+	PublishMsg(ctx context.Context, msg *nats.Msg, opts ...jetstream.PublishOpt) (*jetstream.PubAck, error)
+}
+
+// Consumer is the part of jetstream.Consumer used by Source.
+type Consumer interface {
+	Next(opts ...jetstream.FetchOpt) (jetstream.Msg, error)
+}
+
+// Config represents configuration options for a Sink.
+type Config struct {
+	Subject string // Subject the items are published to.
+
+	// MsgIDPrefix enables JetStream deduplication: items are published with
+	// the message ID MsgIDPrefix + item ID, so an item published again after
+	// a lost acknowledgement is dropped by the server. Use a prefix unique to
+	// the queue.
+	MsgIDPrefix string
+}
+
+// Sink publishes items to a JetStream stream. Publish waits for the server
+// to acknowledge that the stream stored the message, which throttles the
+// forwarder to the pace of the server.
+type Sink struct {
+	js  Publisher
+	cfg Config
+}
+
+var _ queuebridge.Publisher = (*Sink)(nil)
+
+// NewSink returns a Sink publishing through js.
+func NewSink(js Publisher, config Config) *Sink {
+	return &Sink{js: js, cfg: config}
+}
+
+// Publish sends the item and waits for the stream acknowledgement.
+func (s *Sink) Publish(ctx context.Context, item queue.Item) error {
+	msg := nats.NewMsg(s.cfg.Subject)
+	msg.Data = item.Data
+	for _, tag := range item.Tags {
+		msg.Header.Add(TagHeader, tag)
+	}
+
+	var opts []jetstream.PublishOpt
+	if s.cfg.MsgIDPrefix != "" {
+		opts = append(opts, jetstream.WithMsgID(s.cfg.MsgIDPrefix+strconv.Itoa(item.ID)))
+	}
+
+	_, err := s.js.PublishMsg(ctx, msg, opts...)
+	return err
+}
+
+// Source ingests messages from a JetStream pull consumer with explicit acks.
+// Messages are acknowledged after they were added to the queue; unacknowledged
+// messages are redelivered by the server.
+type Source struct {
+	consumer Consumer
+	maxWait  time.Duration
+}
+
+var _ queuebridge.Source = (*Source)(nil)
+
+// NewSource returns a Source fetching from consumer.
+func NewSource(consumer Consumer) *Source {
+	return &Source{consumer: consumer, maxWait: 5 * time.Second}
+}
+
+// Receive fetches the next message, waiting until one arrives or ctx is done.
+// The TagHeader values become the item tags.
+func (s *Source) Receive(ctx context.Context) (queuebridge.Message, error) {
+	for {
+		if err := ctx.Err(); err != nil {
+			return queuebridge.Message{}, err
+		}
+
+		msg, err := s.consumer.Next(jetstream.FetchMaxWait(s.maxWait))
+		if errors.Is(err, nats.ErrTimeout) || errors.Is(err, jetstream.ErrNoMessages) {
+			continue // Nothing arrived in time; check ctx and fetch again.
+		}
+		if err != nil {
+			return queuebridge.Message{}, err
+		}
+
+		return queuebridge.Message{
+			Data: msg.Data(),
+			Tags: msg.Headers().Values(TagHeader),
+			Commit: func(ctx context.Context) error {
+				return msg.Ack()
+			},
+		}, nil
+	}
+}
@@ -0,0 +1,73 @@
+package queuenats
+
+import (
+	"context"
+	"testing"
+
+	"github.com/elum-utils/queue"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// fakeStream records published messages and serves them to the consumer.
+type fakeStream struct {
+	published []*nats.Msg
+	timeouts  int // Fetches that time out before a message is served.
+	acked     int
+}
+
+func (s *fakeStream) PublishMsg(ctx context.Context, msg *nats.Msg, opts ...jetstream.PublishOpt) (*jetstream.PubAck, error) {
+	s.published = append(s.published, msg)
+	return &jetstream.PubAck{Stream: "QUEUE", Sequence: uint64(len(s.published))}, nil
+}
+
+func (s *fakeStream) Next(opts ...jetstream.FetchOpt) (jetstream.Msg, error) {
+	if s.timeouts > 0 {
+		s.timeouts--
+		return nil, nats.ErrTimeout
+	}
+	msg := s.published[0]
+	s.published = s.published[1:]
+	return fakeMsg{msg: msg, stream: s}, nil
+}
+
+// fakeMsg implements the jetstream.Msg methods used by Source.
+type fakeMsg struct {
+	jetstream.Msg
+	msg    *nats.Msg
+	stream *fakeStream
+}
+
+func (m fakeMsg) Data() []byte         { return m.msg.Data }
+func (m fakeMsg) Headers() nats.Header { return m.msg.Header }
+func (m fakeMsg) Ack() error           { m.stream.acked++; return nil }
+
+var (
+	_ Publisher = (jetstream.JetStream)(nil)
+	_ Consumer  = (jetstream.Consumer)(nil)
+)
+
+func TestRoundTrip(t *testing.T) {
+	stream := &fakeStream{timeouts: 2}
+
+	sink := NewSink(stream, Config{Subject: "jobs", MsgIDPrefix: "edge-1/"})
+	item := queue.Item{ID: 7, Data: []byte("hello"), Tags: []string{"email", "urgent"}}
+	if err := sink.Publish(context.Background(), item); err != nil {
+		t.Fatalf("failed to publish: %v", err)
+	}
+	if stream.published[0].Subject != "jobs" {
+		t.Fatalf("unexpected subject %q", stream.published[0].Subject)
+	}
+
+	msg, err := NewSource(stream).Receive(context.Background())
+	if err != nil {
+		t.Fatalf("failed to receive: %v", err)
+	}
+	if string(msg.Data) != "hello" || len(msg.Tags) != 2 || msg.Tags[1] != "urgent" {
+		t.Fatalf("unexpected message: %+v", msg)
+	}
+
+	if err := msg.Commit(context.Background()); err != nil || stream.acked != 1 {
+		t.Fatalf("expected the message to be acked, got %v", err)
+	}
+}
@@ -0,0 +1,117 @@
+// Package queueotel reports the metrics of a queue through the
+// OpenTelemetry metrics API.
+//
+//	meter := otel.GetMeterProvider().Meter("github.com/elum-utils/queue")
+//	q, err := queue.New(queue.Config{LocalFile: "jobs.db"}, queue.WithMetrics(queueotel.New(meter)))
+//
+// Instruments are created on first use, one per metric name. Labels become
+// attributes of the measurements. Tracer carries the span context of
+// producers to the consumers of their items.
+package queueotel
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/elum-utils/queue"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// Metrics is a queue.Metrics recording to an OpenTelemetry meter.
+type Metrics struct {
+	meter metric.Meter
+
+	mx         sync.Mutex
+	counters   map[string]metric.Float64Counter
+	gauges     map[string]metric.Float64Gauge
+	histograms map[string]metric.Float64Histogram
+}
+
+var _ queue.Metrics = (*Metrics)(nil)
+
+// New returns a Metrics creating its instruments with meter.
+func New(meter metric.Meter) *Metrics {
+	return &Metrics{
+		meter:      meter,
+		counters:   make(map[string]metric.Float64Counter),
+		gauges:     make(map[string]metric.Float64Gauge),
+		histograms: make(map[string]metric.Float64Histogram),
+	}
+}
+
+// Counter adds delta to a counter.
+func (m *Metrics) Counter(name string, delta float64, labels ...queue.Label) {
+	m.mx.Lock()
+	counter, ok := m.counters[name]
+	if !ok {
+		var err error
+		counter, err = m.meter.Float64Counter(name, metric.WithUnit(unit(name)))
+		handle(err)
+		m.counters[name] = counter
+	}
+	m.mx.Unlock()
+
+	counter.Add(context.Background(), delta, attributes(labels))
+}
+
+// Gauge sets a gauge.
+func (m *Metrics) Gauge(name string, value float64, labels ...queue.Label) {
+	m.mx.Lock()
+	gauge, ok := m.gauges[name]
+	if !ok {
+		var err error
+		gauge, err = m.meter.Float64Gauge(name, metric.WithUnit(unit(name)))
+		handle(err)
+		m.gauges[name] = gauge
+	}
+	m.mx.Unlock()
+
+	gauge.Record(context.Background(), value, attributes(labels))
+}
+
+// Histogram records an observation.
+func (m *Metrics) Histogram(name string, value float64, labels ...queue.Label) {
+	m.mx.Lock()
+	histogram, ok := m.histograms[name]
+	if !ok {
+		var err error
+		histogram, err = m.meter.Float64Histogram(name, metric.WithUnit(unit(name)))
+		handle(err)
+		m.histograms[name] = histogram
+	}
+	m.mx.Unlock()
+
+	histogram.Record(context.Background(), value, attributes(labels))
+}
+
+// handle passes an error creating an instrument to the OpenTelemetry error
+// handler. The instrument returned along with the error is still usable.
+func handle(err error) {
+	if err != nil {
+		otel.Handle(err)
+	}
+}
+
+// unit returns the UCUM unit of a metric, derived from its name.
+func unit(name string) string {
+	switch {
+	case strings.HasSuffix(name, "_seconds"):
+		return "s"
+	case strings.HasSuffix(name, "_bytes"), name == queue.MetricBytes:
+		return "By"
+	default:
+		return "{item}"
+	}
+}
+
+// attributes converts labels to a measurement option.
+func attributes(labels []queue.Label) metric.MeasurementOption {
+	kvs := make([]attribute.KeyValue, len(labels))
+	for i, l := range labels {
+		kvs[i] = attribute.String(l.Name, l.Value)
+	}
+	return metric.WithAttributes(kvs...)
+}
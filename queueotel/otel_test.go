@@ -0,0 +1,49 @@
+package queueotel
+
+import (
+	"context"
+	"testing"
+
+	"github.com/elum-utils/queue"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestMetrics(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	defer provider.Shutdown(context.Background())
+
+	metrics := New(provider.Meter("queue"))
+	label := queue.Label{Name: "queue", Value: "jobs"}
+	metrics.Counter(queue.MetricEnqueued, 2, label)
+	metrics.Counter(queue.MetricEnqueued, 1, label)
+	metrics.Gauge(queue.MetricPending, 5, label)
+	metrics.Histogram(queue.MetricProcessing, 0.2, label)
+
+	var data metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &data); err != nil {
+		t.Fatalf("failed to collect metrics: %v", err)
+	}
+
+	byName := make(map[string]metricdata.Metrics)
+	for _, m := range data.ScopeMetrics[0].Metrics {
+		byName[m.Name] = m
+	}
+
+	sum := byName[queue.MetricEnqueued].Data.(metricdata.Sum[float64]).DataPoints[0]
+	if sum.Value != 3 {
+		t.Fatalf("expected the counter to be 3, got %v", sum.Value)
+	}
+	if v, ok := sum.Attributes.Value(attribute.Key("queue")); !ok || v.AsString() != "jobs" {
+		t.Fatalf("expected the queue attribute, got %v", sum.Attributes)
+	}
+	if gauge := byName[queue.MetricPending].Data.(metricdata.Gauge[float64]).DataPoints[0]; gauge.Value != 5 {
+		t.Fatalf("expected the gauge to be 5, got %v", gauge.Value)
+	}
+	histogram := byName[queue.MetricProcessing]
+	if histogram.Unit != "s" || histogram.Data.(metricdata.Histogram[float64]).DataPoints[0].Count != 1 {
+		t.Fatalf("unexpected histogram: %+v", histogram)
+	}
+}
@@ -0,0 +1,34 @@
+package queueotel
+
+import (
+	"context"
+
+	"github.com/elum-utils/queue"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// traceparent is the W3C Trace Context field carrying the span context.
+const traceparent = "traceparent"
+
+// Tracer is a queue.Tracer carrying the OpenTelemetry span context of the
+// producer to the consumer as a W3C traceparent, so the spans a handler
+// starts from Item.Context join the trace of the request that added the item:
+//
+//	q, err := queue.New(queue.Config{LocalFile: "jobs.db", Tracer: queueotel.Tracer{}})
+type Tracer struct{}
+
+var _ queue.Tracer = Tracer{}
+
+// TraceID returns the traceparent of the span in ctx, or an empty string if
+// ctx carries no valid span context.
+func (Tracer) TraceID(ctx context.Context) string {
+	carrier := propagation.MapCarrier{}
+	propagation.TraceContext{}.Inject(ctx, carrier)
+	return carrier.Get(traceparent)
+}
+
+// ContextWithTraceID returns a copy of ctx carrying the remote span context
+// described by the traceparent id.
+func (Tracer) ContextWithTraceID(ctx context.Context, id string) context.Context {
+	return propagation.TraceContext{}.Extract(ctx, propagation.MapCarrier{traceparent: id})
+}
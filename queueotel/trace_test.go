@@ -0,0 +1,40 @@
+package queueotel
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/elum-utils/queue"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTracer(t *testing.T) {
+	q, err := queue.New(queue.Config{Tracer: Tracer{}})
+	if err != nil {
+		t.Fatalf("failed to initialize queue: %v", err)
+	}
+	defer q.Close()
+
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36},
+		SpanID:     trace.SpanID{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7},
+		TraceFlags: trace.FlagsSampled,
+	})
+	ctx := trace.ContextWithSpanContext(context.Background(), sc)
+	if _, err := q.AddContext(ctx, []byte("test data")); err != nil {
+		t.Fatalf("failed to add item to queue: %v", err)
+	}
+
+	items, err := q.ClaimWait(context.Background(), 1, time.Second)
+	if err != nil || len(items) != 1 {
+		t.Fatalf("expected to claim the item, got %+v, %v", items, err)
+	}
+	if got := items[0].Headers[queue.TraceHeader]; got != "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01" {
+		t.Fatalf("expected the traceparent in the headers, got %q", got)
+	}
+	restored := trace.SpanContextFromContext(items[0].Context())
+	if restored.TraceID() != sc.TraceID() || restored.SpanID() != sc.SpanID() || !restored.IsRemote() {
+		t.Fatalf("expected the remote span context of the producer, got %+v", restored)
+	}
+}
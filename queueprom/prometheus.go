@@ -0,0 +1,136 @@
+// Package queueprom reports the metrics of a queue to Prometheus.
+//
+//	metrics := queueprom.New(prometheus.DefaultRegisterer)
+//	q, err := queue.New(queue.Config{LocalFile: "jobs.db"}, queue.WithMetrics(metrics))
+//
+// Collectors are created and registered on first use, one per metric name,
+// with the label names of the first measurement.
+package queueprom
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/elum-utils/queue"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// help describes the metrics reported by the queue.
+var help = map[string]string{
+	queue.MetricEnqueued:     "Items added to the queue.",
+	queue.MetricClaimed:      "Items claimed by listeners or Claim.",
+	queue.MetricAcked:        "Items acknowledged after processing.",
+	queue.MetricRetried:      "Deliveries a listener asked to retry.",
+	queue.MetricDeadLettered: "Items moved to the dead letters.",
+	queue.MetricProcessing:   "Time listeners took to process an item.",
+	queue.MetricPending:      "Items waiting to be delivered.",
+	queue.MetricInFlight:     "Items being processed.",
+	queue.MetricDead:         "Dead-lettered items.",
+	queue.MetricBytes:        "Total size of the payloads in the queue.",
+}
+
+// Metrics is a queue.Metrics registering its collectors with a Prometheus
+// registerer.
+type Metrics struct {
+	registerer prometheus.Registerer
+
+	mx         sync.Mutex
+	counters   map[string]*prometheus.CounterVec
+	gauges     map[string]*prometheus.GaugeVec
+	histograms map[string]*prometheus.HistogramVec
+}
+
+var _ queue.Metrics = (*Metrics)(nil)
+
+// New returns a Metrics registering its collectors with registerer, e.g.
+// prometheus.DefaultRegisterer.
+func New(registerer prometheus.Registerer) *Metrics {
+	return &Metrics{
+		registerer: registerer,
+		counters:   make(map[string]*prometheus.CounterVec),
+		gauges:     make(map[string]*prometheus.GaugeVec),
+		histograms: make(map[string]*prometheus.HistogramVec),
+	}
+}
+
+// Counter adds delta to a counter.
+func (m *Metrics) Counter(name string, delta float64, labels ...queue.Label) {
+	m.mx.Lock()
+	vec, ok := m.counters[name]
+	if !ok {
+		vec = prometheus.NewCounterVec(prometheus.CounterOpts{Name: name, Help: describe(name)}, labelNames(labels))
+		vec = register(m.registerer, vec)
+		m.counters[name] = vec
+	}
+	m.mx.Unlock()
+
+	vec.With(labelValues(labels)).Add(delta)
+}
+
+// Gauge sets a gauge.
+func (m *Metrics) Gauge(name string, value float64, labels ...queue.Label) {
+	m.mx.Lock()
+	vec, ok := m.gauges[name]
+	if !ok {
+		vec = prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: name, Help: describe(name)}, labelNames(labels))
+		vec = register(m.registerer, vec)
+		m.gauges[name] = vec
+	}
+	m.mx.Unlock()
+
+	vec.With(labelValues(labels)).Set(value)
+}
+
+// Histogram records an observation with the default Prometheus buckets,
+// which suit durations in seconds.
+func (m *Metrics) Histogram(name string, value float64, labels ...queue.Label) {
+	m.mx.Lock()
+	vec, ok := m.histograms[name]
+	if !ok {
+		vec = prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: name, Help: describe(name)}, labelNames(labels))
+		vec = register(m.registerer, vec)
+		m.histograms[name] = vec
+	}
+	m.mx.Unlock()
+
+	vec.With(labelValues(labels)).Observe(value)
+}
+
+// register registers a collector, or returns the equal collector registered
+// before, e.g. by another Metrics sharing the registerer.
+func register[C prometheus.Collector](registerer prometheus.Registerer, collector C) C {
+	err := registerer.Register(collector)
+	var registered prometheus.AlreadyRegisteredError
+	if errors.As(err, &registered) {
+		if existing, ok := registered.ExistingCollector.(C); ok {
+			return existing
+		}
+	}
+	return collector // Unregistered on other errors, so the measurements are dropped.
+}
+
+// describe returns the help text of a metric.
+func describe(name string) string {
+	if h, ok := help[name]; ok {
+		return h
+	}
+	return name
+}
+
+// labelNames returns the names of labels.
+func labelNames(labels []queue.Label) []string {
+	names := make([]string, len(labels))
+	for i, l := range labels {
+		names[i] = l.Name
+	}
+	return names
+}
+
+// labelValues returns labels as a prometheus.Labels map.
+func labelValues(labels []queue.Label) prometheus.Labels {
+	values := make(prometheus.Labels, len(labels))
+	for _, l := range labels {
+		values[l.Name] = l.Value
+	}
+	return values
+}
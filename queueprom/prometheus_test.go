@@ -0,0 +1,72 @@
+package queueprom
+
+import (
+	"testing"
+
+	"github.com/elum-utils/queue"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// gather returns the metric families of a registry by name.
+func gather(t *testing.T, registry *prometheus.Registry) map[string]*dto.MetricFamily {
+	t.Helper()
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("failed to gather metrics: %v", err)
+	}
+	byName := make(map[string]*dto.MetricFamily)
+	for _, f := range families {
+		byName[f.GetName()] = f
+	}
+	return byName
+}
+
+func TestMetrics(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	label := queue.Label{Name: "queue", Value: "jobs"}
+
+	// Two queues sharing a registry share the collectors.
+	first, second := New(registry), New(registry)
+	first.Counter(queue.MetricEnqueued, 2, label)
+	second.Counter(queue.MetricEnqueued, 1, label)
+	first.Gauge(queue.MetricPending, 5, label)
+	first.Histogram(queue.MetricProcessing, 0.2, label)
+
+	families := gather(t, registry)
+	if c := families[queue.MetricEnqueued].GetMetric()[0]; c.GetCounter().GetValue() != 3 || c.GetLabel()[0].GetValue() != "jobs" {
+		t.Fatalf("unexpected counter: %v", c)
+	}
+	if g := families[queue.MetricPending].GetMetric()[0]; g.GetGauge().GetValue() != 5 {
+		t.Fatalf("unexpected gauge: %v", g)
+	}
+	if h := families[queue.MetricProcessing].GetMetric()[0]; h.GetHistogram().GetSampleCount() != 1 {
+		t.Fatalf("unexpected histogram: %v", h)
+	}
+	if help := families[queue.MetricPending].GetHelp(); help != "Items waiting to be delivered." {
+		t.Fatalf("unexpected help: %s", help)
+	}
+}
+
+func TestQueue(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	q, err := queue.New(queue.Config{Table: "jobs"}, queue.WithMetrics(New(registry)))
+	if err != nil {
+		t.Fatalf("failed to initialize queue: %v", err)
+	}
+	defer q.Close()
+
+	if err := q.Add([]byte("data")); err != nil {
+		t.Fatalf("failed to add item: %v", err)
+	}
+	if _, err := q.Claim(1); err != nil {
+		t.Fatalf("failed to claim item: %v", err)
+	}
+
+	families := gather(t, registry)
+	for _, name := range []string{queue.MetricEnqueued, queue.MetricClaimed} {
+		if f := families[name]; f == nil || f.GetMetric()[0].GetCounter().GetValue() != 1 {
+			t.Errorf("expected %s to be 1, got %v", name, f)
+		}
+	}
+}
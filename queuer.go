@@ -0,0 +1,52 @@
+package queue
+
+import (
+	"context"
+	"time"
+)
+
+// Queuer is the part of the queue API offered both by a local *Queue and by
+// queueclient.Client talking to a remote queue node, so application code can
+// switch between the two without changes.
+type Queuer interface {
+	// Add inserts a new item into the queue.
+	Add(data []byte) error
+	// AddTagged inserts a new item with the given tags into the queue.
+	AddTagged(data []byte, tags ...string) error
+	// Claim marks up to 'limit' pending items as in-flight and returns them.
+	Claim(limit int) ([]Item, error)
+	// ClaimWait claims up to 'limit' items, waiting up to maxWait for one.
+	ClaimWait(ctx context.Context, limit int, maxWait time.Duration) ([]Item, error)
+	// AckReceipt removes a claimed item once it has been processed, unless
+	// the delivery the receipt was issued for was superseded.
+	AckReceipt(receipt string) error
+	// NackReceipt hands a claimed item back to the queue, hidden for delay,
+	// unless the delivery the receipt was issued for was superseded.
+	NackReceipt(receipt string, delay time.Duration) error
+	// Ack removes a claimed item once it has been processed.
+	//
+	// Deprecated: use AckReceipt.
+	Ack(id int) error
+	// Release hands a claimed item back to the queue.
+	//
+	// Deprecated: use NackReceipt.
+	Release(id int) error
+	// Stats returns the number of items in each state.
+	Stats() (Stats, error)
+	// Close releases the resources held by the queue or client.
+	Close() error
+}
+
+var _ Queuer = (*Queue)(nil)
+
+// Consumer is a Queuer that also pushes its items to a listener, like a local
+// *Queue. Handlers written against it can be unit-tested without SQLite with
+// queuetest.Fake.
+type Consumer interface {
+	Queuer
+	// Listener registers the callback invoked for every item. The item is
+	// removed once the callback returns without requesting a delay.
+	Listener(clb func(item Item, delay func(sec time.Duration)))
+}
+
+var _ Consumer = (*Queue)(nil)
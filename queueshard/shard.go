@@ -0,0 +1,310 @@
+// Package queueshard spreads one logical queue across several SQLite files
+// for write-heavy workloads bottlenecked on the single writer of one file.
+// Items are placed round-robin, or by the hash of a key so items sharing a
+// key stay in the same shard and in order, and consumers claim from the
+// shards in turn so none of them is starved.
+//
+// Item IDs and receipts encode the shard they belong to, so AckReceipt and
+// NackReceipt route to the right file without a lookup. Run dedicates one worker to every shard, so
+// the items of a shard, and hence of a key, are handled strictly in order
+// while throughput grows with the number of shards.
+package queueshard
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elum-utils/queue"
+)
+
+// Config represents configuration options for a sharded queue.
+type Config struct {
+	Files        []string      // Database file of every shard; their order must not change between runs.
+	Queue        queue.Config  // Settings applied to every shard; LocalFile is taken from Files.
+	PollInterval time.Duration // How often ClaimWait looks for items while every shard is empty.
+	RetryDelay   time.Duration // How long a Run worker waits before retrying an item its handler failed.
+	Logger       queue.Logger  // Receives the errors of Run workers; nil uses Queue.Logger.
+}
+
+// configDefault fills in the settings left empty in the provided configuration.
+func configDefault(config ...Config) Config {
+	cfg := Config{}
+	if len(config) > 0 {
+		cfg = config[0]
+	}
+
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = 100 * time.Millisecond
+	}
+	if cfg.RetryDelay <= 0 {
+		cfg.RetryDelay = time.Second
+	}
+	return cfg
+}
+
+// Queue is a queue.Queuer spreading its items across several SQLite files.
+type Queue struct {
+	shards []*queue.Queue
+	cfg    Config
+
+	next  int        // Shard receiving the next round-robin item.
+	start int        // Shard Claim asks first, rotated on every call.
+	mx    sync.Mutex // Guards next and start.
+}
+
+var _ queue.Queuer = (*Queue)(nil)
+
+// New opens or creates one queue per file in Config.Files. Close closes them.
+func New(config ...Config) (*Queue, error) {
+	cfg := configDefault(config...)
+	if len(cfg.Files) == 0 {
+		return nil, errors.New("queueshard: no shard files configured")
+	}
+
+	q := &Queue{cfg: cfg}
+	for _, file := range cfg.Files {
+		shardCfg := cfg.Queue
+		shardCfg.LocalFile = file
+
+		shard, err := queue.New(shardCfg)
+		if err != nil {
+			q.Close()
+			return nil, fmt.Errorf("queueshard: opening %s: %w", file, err)
+		}
+		q.shards = append(q.shards, shard)
+	}
+	if q.cfg.Logger == nil {
+		q.cfg.Logger = q.shards[0].Logger() // The shards share the settings of Config.Queue.
+	}
+	return q, nil
+}
+
+// Shards returns the queue of every shard, e.g. to inspect or administer them.
+func (q *Queue) Shards() []*queue.Queue {
+	return q.shards
+}
+
+// Add inserts a new item into the next shard in round-robin order.
+func (q *Queue) Add(data []byte) error {
+	return q.AddTagged(data)
+}
+
+// AddTagged inserts a new item with the given tags into the next shard in
+// round-robin order.
+func (q *Queue) AddTagged(data []byte, tags ...string) error {
+	q.mx.Lock()
+	shard := q.next
+	q.next = (q.next + 1) % len(q.shards)
+	q.mx.Unlock()
+
+	return q.shards[shard].AddTagged(data, tags...)
+}
+
+// AddKey inserts a new item into the shard chosen by the hash of key, so
+// items with the same key are claimed in the order they were added.
+func (q *Queue) AddKey(key string, data []byte, tags ...string) error {
+	return q.shards[q.shardOf(key)].AddTagged(data, tags...)
+}
+
+// shardOf returns the shard responsible for a key.
+func (q *Queue) shardOf(key string) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(len(q.shards)))
+}
+
+// Claim marks up to 'limit' pending items as in-flight and returns them,
+// taking an equal share from every shard that has items and starting with a
+// different shard on every call.
+func (q *Queue) Claim(limit int) ([]queue.Item, error) {
+	q.mx.Lock()
+	start := q.start
+	q.start = (q.start + 1) % len(q.shards)
+	q.mx.Unlock()
+
+	active := make([]int, len(q.shards))
+	for i := range active {
+		active[i] = (start + i) % len(q.shards)
+	}
+
+	var items []queue.Item
+	for len(items) < limit && len(active) > 0 {
+		share := max((limit-len(items))/len(active), 1)
+
+		var still []int
+		for _, shard := range active {
+			if len(items) == limit {
+				break
+			}
+			claimed, err := q.shards[shard].Claim(min(share, limit-len(items)))
+			if err != nil {
+				return items, err
+			}
+			for _, item := range claimed {
+				items = append(items, q.global(shard, item))
+			}
+			if len(claimed) > 0 {
+				still = append(still, shard) // The shard may have more.
+			}
+		}
+		active = still
+	}
+	return items, nil
+}
+
+// ClaimWait claims up to 'limit' items like Claim, blocking until at least one
+// item is claimed or maxWait elapses. It returns no items and no error if the
+// wait times out, and the context error if ctx is done first.
+func (q *Queue) ClaimWait(ctx context.Context, limit int, maxWait time.Duration) ([]queue.Item, error) {
+	timer := time.NewTimer(maxWait)
+	defer timer.Stop()
+
+	ticker := time.NewTicker(q.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		items, err := q.Claim(limit)
+		if err != nil || len(items) > 0 {
+			return items, err
+		}
+
+		select {
+		case <-ticker.C:
+		case <-timer.C:
+			return q.Claim(limit)
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// AckReceipt removes a claimed item once it has been processed, unless the
+// delivery the receipt was issued for was superseded.
+func (q *Queue) AckReceipt(receipt string) error {
+	shard, local, err := q.localReceipt(receipt)
+	if err != nil {
+		return err
+	}
+	return q.shards[shard].AckReceipt(local)
+}
+
+// NackReceipt hands a claimed item back to its shard, hidden until delay has
+// passed, unless the delivery the receipt was issued for was superseded.
+func (q *Queue) NackReceipt(receipt string, delay time.Duration) error {
+	shard, local, err := q.localReceipt(receipt)
+	if err != nil {
+		return err
+	}
+	return q.shards[shard].NackReceipt(local, delay)
+}
+
+// Ack removes a claimed item once it has been processed.
+//
+// Deprecated: use AckReceipt.
+func (q *Queue) Ack(id int) error {
+	shard, local, err := q.local(id)
+	if err != nil {
+		return err
+	}
+	return q.shards[shard].Ack(local)
+}
+
+// Release hands a claimed item back to its shard.
+//
+// Deprecated: use NackReceipt.
+func (q *Queue) Release(id int) error {
+	shard, local, err := q.local(id)
+	if err != nil {
+		return err
+	}
+	return q.shards[shard].Release(local)
+}
+
+// Stats returns the number of items in each state across all shards. The
+// latency combines the listeners of every shard; the percentiles of a window
+// are those of the slowest shard, as histograms are not exposed to merge.
+func (q *Queue) Stats() (queue.Stats, error) {
+	var total queue.Stats
+	var weighted time.Duration
+	for _, shard := range q.shards {
+		stats, err := shard.Stats()
+		if err != nil {
+			return queue.Stats{}, err
+		}
+		total.Pending += stats.Pending
+		total.InFlight += stats.InFlight
+		total.Dead += stats.Dead
+		total.Bytes += stats.Bytes
+		total.Latency.Count += stats.Latency.Count
+		total.Latency.Max = max(total.Latency.Max, stats.Latency.Max)
+		weighted += stats.Latency.Mean * time.Duration(stats.Latency.Count)
+
+		if total.Latency.Windows == nil {
+			total.Latency.Windows = make([]queue.LatencyWindow, len(stats.Latency.Windows))
+		}
+		for i, w := range stats.Latency.Windows {
+			t := &total.Latency.Windows[i]
+			t.Window = w.Window
+			t.Count += w.Count
+			t.P50 = max(t.P50, w.P50)
+			t.P95 = max(t.P95, w.P95)
+			t.P99 = max(t.P99, w.P99)
+			t.Max = max(t.Max, w.Max)
+		}
+	}
+	if total.Latency.Count > 0 {
+		total.Latency.Mean = weighted / time.Duration(total.Latency.Count)
+	}
+	return total, nil
+}
+
+// Close closes every shard.
+func (q *Queue) Close() error {
+	var firstErr error
+	for _, shard := range q.shards {
+		if err := shard.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// global turns the item of a shard into an item of the sharded queue. The
+// receipt names the global ID in place of the ID within the shard.
+func (q *Queue) global(shard int, item queue.Item) queue.Item {
+	item.ID = item.ID*len(q.shards) + shard
+	if _, nonce, ok := strings.Cut(item.Receipt, "."); ok {
+		item.Receipt = strconv.Itoa(item.ID) + "." + nonce
+	}
+	return item
+}
+
+// localReceipt turns the receipt of an item of the sharded queue back into
+// its shard and the receipt within that shard.
+func (q *Queue) localReceipt(receipt string) (shard int, local string, err error) {
+	id, nonce, ok := strings.Cut(receipt, ".")
+	n, err := strconv.Atoi(id)
+	if !ok || err != nil {
+		return 0, "", queue.ErrInvalidReceipt
+	}
+	shard, l, err := q.local(n)
+	if err != nil {
+		return 0, "", queue.ErrInvalidReceipt
+	}
+	return shard, strconv.Itoa(l) + "." + nonce, nil
+}
+
+// local splits the ID of an item of the sharded queue into its shard and the
+// ID within that shard.
+func (q *Queue) local(id int) (shard, local int, err error) {
+	if id < 0 {
+		return 0, 0, queue.ErrItemNotFound
+	}
+	return id % len(q.shards), id / len(q.shards), nil
+}
@@ -0,0 +1,142 @@
+package queueshard
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/elum-utils/queue"
+)
+
+// setupQueue opens a sharded queue in temporary files and closes it when the test ends.
+func setupQueue(t *testing.T, shards int) *Queue {
+	t.Helper()
+	dir := t.TempDir()
+
+	var files []string
+	for i := 0; i < shards; i++ {
+		files = append(files, filepath.Join(dir, fmt.Sprintf("shard-%d.db", i)))
+	}
+
+	q, err := New(Config{Files: files})
+	if err != nil {
+		t.Fatalf("failed to initialize queue: %v", err)
+	}
+	t.Cleanup(func() { q.Close() })
+	return q
+}
+
+func TestShardedClaimAck(t *testing.T) {
+	q := setupQueue(t, 3)
+
+	for i := 0; i < 6; i++ {
+		if err := q.Add([]byte(fmt.Sprint(i))); err != nil {
+			t.Fatalf("failed to add item: %v", err)
+		}
+	}
+
+	// Round-robin placement puts two items in every shard.
+	for i, shard := range q.Shards() {
+		stats, err := shard.Stats()
+		if err != nil || stats.Pending != 2 {
+			t.Fatalf("expected two items in shard %d, got %+v, %v", i, stats, err)
+		}
+	}
+
+	// A claim takes an equal share from every shard.
+	items, err := q.Claim(3)
+	if err != nil || len(items) != 3 {
+		t.Fatalf("failed to claim items: %+v, %v", items, err)
+	}
+	seen := make(map[int]bool)
+	for _, item := range items {
+		seen[item.ID%3] = true
+	}
+	if len(seen) != 3 {
+		t.Fatalf("expected one item from every shard, got %+v", items)
+	}
+
+	for _, item := range items {
+		if err := q.Ack(item.ID); err != nil {
+			t.Fatalf("failed to ack item %d: %v", item.ID, err)
+		}
+	}
+	if err := q.Release(items[0].ID); !errors.Is(err, queue.ErrItemNotFound) {
+		t.Fatalf("expected ErrItemNotFound for an acked item, got %v", err)
+	}
+
+	stats, err := q.Stats()
+	if err != nil || stats.Pending != 3 || stats.InFlight != 0 {
+		t.Fatalf("unexpected stats: %+v, %v", stats, err)
+	}
+}
+
+func TestShardedReceipts(t *testing.T) {
+	q := setupQueue(t, 3)
+
+	for i := 0; i < 3; i++ {
+		if err := q.Add([]byte(fmt.Sprint(i))); err != nil {
+			t.Fatalf("failed to add item: %v", err)
+		}
+	}
+	items, err := q.Claim(3)
+	if err != nil || len(items) != 3 {
+		t.Fatalf("failed to claim items: %+v, %v", items, err)
+	}
+
+	// Receipts name the global ID and route to the shard of the item.
+	if err := q.NackReceipt(items[0].Receipt, 0); err != nil {
+		t.Fatalf("failed to release item %d: %v", items[0].ID, err)
+	}
+	for _, item := range items[1:] {
+		if err := q.AckReceipt(item.Receipt); err != nil {
+			t.Fatalf("failed to ack item %d: %v", item.ID, err)
+		}
+	}
+	if err := q.AckReceipt(items[1].Receipt); !errors.Is(err, queue.ErrInvalidReceipt) {
+		t.Fatalf("expected the receipt to be used up, got %v", err)
+	}
+
+	stats, err := q.Stats()
+	if err != nil || stats.Pending != 1 || stats.InFlight != 0 {
+		t.Fatalf("unexpected stats: %+v, %v", stats, err)
+	}
+}
+
+func TestShardedAddKey(t *testing.T) {
+	q := setupQueue(t, 4)
+
+	for i := 0; i < 5; i++ {
+		if err := q.AddKey("customer-42", []byte(fmt.Sprint(i))); err != nil {
+			t.Fatalf("failed to add item: %v", err)
+		}
+	}
+
+	// Every item with the key lands in one shard and keeps its order.
+	items, err := q.Claim(10)
+	if err != nil || len(items) != 5 {
+		t.Fatalf("failed to claim items: %+v, %v", items, err)
+	}
+	for i, item := range items {
+		if item.ID%4 != items[0].ID%4 || string(item.Data) != fmt.Sprint(i) {
+			t.Fatalf("expected ordered items from one shard, got %+v", items)
+		}
+	}
+}
+
+func TestShardedClaimWait(t *testing.T) {
+	q := setupQueue(t, 2)
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		q.Add([]byte("late"))
+	}()
+
+	items, err := q.ClaimWait(context.Background(), 1, 3*time.Second)
+	if err != nil || len(items) != 1 || string(items[0].Data) != "late" {
+		t.Fatalf("unexpected claim: %+v, %v", items, err)
+	}
+}
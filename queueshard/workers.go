@@ -0,0 +1,79 @@
+package queueshard
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/elum-utils/queue"
+)
+
+// workerWait is how long a worker blocks in ClaimWait before checking again.
+const workerWait = time.Minute
+
+// Handler processes an item claimed from a shard. Returning an error hands
+// the item back and retries it after Config.RetryDelay, before any later item
+// of the shard.
+type Handler func(shard int, item queue.Item) error
+
+// Run starts one worker per shard and hands every item to h until ctx is
+// done. Each worker handles the items of its shard one at a time in the
+// order they were added, so items added with the same AddKey key are never
+// processed concurrently or out of order. Items are acknowledged once h
+// returns nil. Run returns once every worker has stopped.
+func (q *Queue) Run(ctx context.Context, h Handler) error {
+	var wg sync.WaitGroup
+	for i := range q.shards {
+		wg.Add(1)
+		go func(shard int) {
+			defer wg.Done()
+			q.work(ctx, shard, h)
+		}(i)
+	}
+	wg.Wait()
+	return ctx.Err()
+}
+
+// work handles the items of one shard until ctx is done.
+func (q *Queue) work(ctx context.Context, shard int, h Handler) {
+	s := q.shards[shard]
+	for ctx.Err() == nil {
+		items, err := s.ClaimWait(ctx, 1, workerWait)
+		if err != nil {
+			if ctx.Err() == nil {
+				q.cfg.Logger.Println("Error claiming from shard", shard, ":", err)
+				sleep(ctx, q.cfg.RetryDelay)
+			}
+			continue
+		}
+
+		for _, item := range items {
+			global := q.global(shard, item)
+			if err := h(shard, global); err != nil {
+				q.cfg.Logger.Println("Handler failed on shard", shard, ", retrying:", err)
+
+				// Wait before releasing, so no other consumer picks the item up
+				// ahead of this worker in the meantime.
+				sleep(ctx, q.cfg.RetryDelay)
+				if err := s.NackReceipt(item.Receipt, 0); err != nil {
+					q.cfg.Logger.Println("Error releasing item:", err)
+				}
+				continue
+			}
+			if err := s.AckReceipt(item.Receipt); err != nil {
+				q.cfg.Logger.Println("Error acknowledging item:", err)
+			}
+		}
+	}
+}
+
+// sleep waits for d or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
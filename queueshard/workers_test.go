@@ -0,0 +1,90 @@
+package queueshard
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/elum-utils/queue"
+)
+
+func TestRunPreservesShardOrder(t *testing.T) {
+	q := setupQueue(t, 2)
+	q.cfg.RetryDelay = 10 * time.Millisecond
+
+	// Pick two keys living in different shards.
+	keys := []string{"key-0"}
+	for i := 1; len(keys) < 2; i++ {
+		if key := fmt.Sprint("key-", i); q.shardOf(key) != q.shardOf(keys[0]) {
+			keys = append(keys, key)
+		}
+	}
+	for i := 0; i < 5; i++ {
+		for _, key := range keys {
+			if err := q.AddKey(key, []byte(fmt.Sprint(key, "/", i))); err != nil {
+				t.Fatalf("failed to add item: %v", err)
+			}
+		}
+	}
+
+	var mx sync.Mutex
+	got := make(map[int][]string)
+	busy := make(map[int]bool)
+	failed := false
+	done := make(chan struct{})
+	handler := func(shard int, item queue.Item) error {
+		mx.Lock()
+		if busy[shard] {
+			mx.Unlock()
+			t.Errorf("shard %d handled two items at once", shard)
+			return nil
+		}
+		busy[shard] = true
+		mx.Unlock()
+
+		time.Sleep(time.Millisecond)
+
+		mx.Lock()
+		defer mx.Unlock()
+		busy[shard] = false
+
+		// Fail the second item once; it must be retried before the third.
+		if string(item.Data) == keys[0]+"/1" && !failed {
+			failed = true
+			return errors.New("temporary failure")
+		}
+		got[shard] = append(got[shard], string(item.Data))
+		if len(got[0])+len(got[1]) == 10 {
+			close(done)
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	result := make(chan error, 1)
+	go func() { result <- q.Run(ctx, handler) }()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for items, got %v", got)
+	}
+	cancel()
+	if err := <-result; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected Run to return the context error, got %v", err)
+	}
+
+	mx.Lock()
+	defer mx.Unlock()
+	for _, key := range keys {
+		items := got[q.shardOf(key)]
+		for i, data := range items {
+			if data != fmt.Sprint(key, "/", i) {
+				t.Fatalf("expected items of %s in order, got %v", key, items)
+			}
+		}
+	}
+}
@@ -0,0 +1,353 @@
+// Package queuetest provides an in-memory fake of queue.Consumer for unit
+// tests of code built on the queue. The fake needs neither SQLite nor CGO,
+// runs no background goroutines and tells time with a queue.FakeClock, so
+// tests are deterministic: items reach the listener only when Deliver is
+// called, and delays and leases expire only when the clock is advanced.
+//
+//	fake := queuetest.New()
+//	app := NewApp(fake) // Registers its handler with fake.Listener.
+//	fake.Add([]byte("hello"))
+//	fake.Deliver()
+//	if len(fake.Acked()) != 1 { ... }
+package queuetest
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elum-utils/queue"
+)
+
+// Config represents configuration options for a fake queue.
+type Config struct {
+	LeaseTimeout time.Duration    // How long a claimed item stays reserved before it may be claimed again.
+	MaxAttempts  int              // Deliveries before an item moves to the dead letters; 0 means unlimited.
+	Clock        *queue.FakeClock // Clock telling the time of the fake; nil starts a new one at 2000-01-01 UTC.
+}
+
+// configDefault fills in the settings left empty in the provided configuration.
+func configDefault(config ...Config) Config {
+	cfg := Config{}
+	if len(config) > 0 {
+		cfg = config[0]
+	}
+
+	if cfg.LeaseTimeout <= 0 {
+		cfg.LeaseTimeout = 5 * time.Minute
+	}
+	if cfg.Clock == nil {
+		cfg.Clock = queue.NewFakeClock(time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC))
+	}
+	return cfg
+}
+
+// entry is an item held by the fake.
+type entry struct {
+	item       queue.Item
+	visibleAt  time.Time // When a pending item may be claimed; delayed items are hidden until then.
+	leaseUntil time.Time // When the lease of an in-flight item expires.
+}
+
+// Fake is an in-memory queue.Consumer. It is safe for concurrent use, but
+// only delivers items to the listener from Deliver.
+type Fake struct {
+	Clock *queue.FakeClock // Advance it to expire delays and leases.
+
+	mx      sync.Mutex
+	cfg     Config
+	entries []*entry // Items in the queue, in FIFO order.
+	acked   []queue.Item
+	nextID  int
+	clb     func(item queue.Item, delay func(sec time.Duration))
+	closed  bool
+}
+
+var _ queue.Consumer = (*Fake)(nil)
+
+// New creates an empty fake queue.
+func New(config ...Config) *Fake {
+	cfg := configDefault(config...)
+	return &Fake{Clock: cfg.Clock, cfg: cfg}
+}
+
+// Add inserts a new item into the queue.
+func (f *Fake) Add(data []byte) error {
+	return f.AddTagged(data)
+}
+
+// AddTagged inserts a new item with the given tags into the queue.
+func (f *Fake) AddTagged(data []byte, tags ...string) error {
+	f.mx.Lock()
+	defer f.mx.Unlock()
+
+	if f.closed {
+		return queue.ErrClosed
+	}
+	f.nextID++
+	f.entries = append(f.entries, &entry{
+		item: queue.Item{ID: f.nextID, Data: data, Tags: tags, State: queue.StatePending},
+	})
+	return nil
+}
+
+// Claim marks up to 'limit' pending items as in-flight and returns them in
+// FIFO order. Items whose lease expired are claimed again; items that used up
+// MaxAttempts move to the dead letters.
+func (f *Fake) Claim(limit int) ([]queue.Item, error) {
+	f.mx.Lock()
+	defer f.mx.Unlock()
+
+	if f.closed {
+		return nil, queue.ErrClosed
+	}
+
+	now := f.Clock.Now()
+	var items []queue.Item
+	for _, e := range f.entries {
+		if len(items) >= limit {
+			break
+		}
+
+		switch {
+		case e.item.State == queue.StatePending && !e.visibleAt.After(now):
+		case e.item.State == queue.StateInFlight && e.leaseUntil.Before(now):
+		default:
+			continue
+		}
+
+		if f.cfg.MaxAttempts > 0 && e.item.Attempts >= f.cfg.MaxAttempts {
+			e.item.State = queue.StateDead
+			continue
+		}
+
+		e.item.State = queue.StateInFlight
+		e.item.Attempts++
+		e.item.Receipt = strconv.Itoa(e.item.ID) + "." + strconv.Itoa(e.item.Attempts)
+		e.leaseUntil = now.Add(f.cfg.LeaseTimeout)
+		items = append(items, e.item)
+	}
+	return items, nil
+}
+
+// ClaimWait claims up to 'limit' items like Claim. It never waits, as nothing
+// changes in the fake until the test acts, so it returns no items and no
+// error if none can be claimed, and the context error if ctx is done.
+func (f *Fake) ClaimWait(ctx context.Context, limit int, maxWait time.Duration) ([]queue.Item, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return f.Claim(limit)
+}
+
+// AckReceipt removes a claimed item once it has been processed and records
+// it for Acked. It returns queue.ErrInvalidReceipt unless the receipt belongs
+// to the current delivery of the item.
+func (f *Fake) AckReceipt(receipt string) error {
+	f.mx.Lock()
+	defer f.mx.Unlock()
+
+	i, e := f.delivery(receipt)
+	if e == nil {
+		return queue.ErrInvalidReceipt
+	}
+	f.ack(i, e)
+	return nil
+}
+
+// NackReceipt hands a claimed item back to the queue, hidden until delay has
+// passed. It returns queue.ErrInvalidReceipt unless the receipt belongs to
+// the current delivery of the item.
+func (f *Fake) NackReceipt(receipt string, delay time.Duration) error {
+	f.mx.Lock()
+	defer f.mx.Unlock()
+
+	_, e := f.delivery(receipt)
+	if e == nil {
+		return queue.ErrInvalidReceipt
+	}
+	f.retry(e, delay)
+	return nil
+}
+
+// Ack removes a claimed item once it has been processed and records it for
+// Acked. It returns queue.ErrItemNotFound if the item is not in flight.
+//
+// Deprecated: use AckReceipt.
+func (f *Fake) Ack(id int) error {
+	f.mx.Lock()
+	defer f.mx.Unlock()
+
+	i, e := f.find(id)
+	if e == nil || e.item.State != queue.StateInFlight {
+		return queue.ErrItemNotFound
+	}
+	f.ack(i, e)
+	return nil
+}
+
+// Release hands a claimed item back to the queue. It returns
+// queue.ErrItemNotFound if the item is not in flight.
+//
+// Deprecated: use NackReceipt.
+func (f *Fake) Release(id int) error {
+	f.mx.Lock()
+	defer f.mx.Unlock()
+
+	_, e := f.find(id)
+	if e == nil || e.item.State != queue.StateInFlight {
+		return queue.ErrItemNotFound
+	}
+	f.retry(e, 0)
+	return nil
+}
+
+// Stats returns the number of items in each state and the total payload size.
+func (f *Fake) Stats() (queue.Stats, error) {
+	f.mx.Lock()
+	defer f.mx.Unlock()
+
+	var stats queue.Stats
+	for _, e := range f.entries {
+		switch e.item.State {
+		case queue.StatePending:
+			stats.Pending++
+		case queue.StateInFlight:
+			stats.InFlight++
+		case queue.StateDead:
+			stats.Dead++
+		}
+		stats.Bytes += int64(len(e.item.Data))
+	}
+	return stats, nil
+}
+
+// Close makes further calls return queue.ErrClosed.
+func (f *Fake) Close() error {
+	f.mx.Lock()
+	defer f.mx.Unlock()
+
+	f.closed = true
+	return nil
+}
+
+// Listener registers the callback Deliver hands the items to. The item is
+// removed once the callback returns without requesting a delay.
+func (f *Fake) Listener(clb func(item queue.Item, delay func(sec time.Duration))) {
+	f.mx.Lock()
+	defer f.mx.Unlock()
+
+	f.clb = clb
+}
+
+// Deliver hands the claimable items to the listener one at a time, in the
+// calling goroutine, until none is left, and returns the number of callback
+// invocations. Items the listener adds are delivered by the same call; items
+// it delays stay hidden until Clock has advanced past the delay. Deliver does
+// nothing without a listener.
+func (f *Fake) Deliver() int {
+	f.mx.Lock()
+	clb := f.clb
+	f.mx.Unlock()
+	if clb == nil {
+		return 0
+	}
+
+	calls := 0
+	for {
+		items, err := f.Claim(1)
+		if err != nil || len(items) == 0 {
+			return calls
+		}
+
+		var delayed time.Duration
+		clb(items[0], func(sec time.Duration) { delayed = sec })
+		calls++
+
+		if delayed > 0 {
+			f.NackReceipt(items[0].Receipt, delayed)
+		} else {
+			f.AckReceipt(items[0].Receipt)
+		}
+	}
+}
+
+// Items returns the items in the queue in FIFO order, only those in one of
+// the given states if any are given. Acknowledged items are not included;
+// see Acked.
+func (f *Fake) Items(states ...queue.State) []queue.Item {
+	f.mx.Lock()
+	defer f.mx.Unlock()
+
+	var items []queue.Item
+	for _, e := range f.entries {
+		if len(states) == 0 || contains(states, e.item.State) {
+			items = append(items, e.item)
+		}
+	}
+	return items
+}
+
+// Acked returns the acknowledged items in the order they were acknowledged.
+func (f *Fake) Acked() []queue.Item {
+	f.mx.Lock()
+	defer f.mx.Unlock()
+
+	return append([]queue.Item(nil), f.acked...)
+}
+
+// ack removes the in-flight entry at index i and records it for Acked. It
+// must be called with the fake locked.
+func (f *Fake) ack(i int, e *entry) {
+	f.entries = append(f.entries[:i], f.entries[i+1:]...)
+	f.acked = append(f.acked, e.item)
+}
+
+// retry makes an in-flight item pending again once delay has passed. It must
+// be called with the fake locked.
+func (f *Fake) retry(e *entry, delay time.Duration) {
+	e.item.State = queue.StatePending
+	e.item.Receipt = ""
+	e.visibleAt = f.Clock.Now().Add(delay)
+	e.leaseUntil = time.Time{}
+}
+
+// delivery returns the index and entry of the item the receipt was issued
+// for, or a nil entry unless the receipt belongs to its current delivery.
+// Receipts name the item and the attempt they were issued for. It must be
+// called with the fake locked.
+func (f *Fake) delivery(receipt string) (int, *entry) {
+	id, attempt, ok := strings.Cut(receipt, ".")
+	n, err := strconv.Atoi(id)
+	if !ok || err != nil {
+		return -1, nil
+	}
+	i, e := f.find(n)
+	if e == nil || e.item.State != queue.StateInFlight || strconv.Itoa(e.item.Attempts) != attempt {
+		return -1, nil
+	}
+	return i, e
+}
+
+// find returns the index and entry of an item, or a nil entry if there is no
+// such item. It must be called with the fake locked.
+func (f *Fake) find(id int) (int, *entry) {
+	for i, e := range f.entries {
+		if e.item.ID == id {
+			return i, e
+		}
+	}
+	return -1, nil
+}
+
+// contains reports whether state is one of states.
+func contains(states []queue.State, state queue.State) bool {
+	for _, s := range states {
+		if s == state {
+			return true
+		}
+	}
+	return false
+}
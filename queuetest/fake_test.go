@@ -0,0 +1,100 @@
+package queuetest
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/elum-utils/queue"
+)
+
+func TestDeliver(t *testing.T) {
+	fake := New()
+
+	var seen []string
+	fake.Listener(func(item queue.Item, delay func(sec time.Duration)) {
+		seen = append(seen, string(item.Data))
+		if string(item.Data) == "a" {
+			fake.Add([]byte("c")) // Added from the handler and delivered by the same call.
+		}
+	})
+
+	fake.Add([]byte("a"))
+	fake.AddTagged([]byte("b"), "email")
+
+	if calls := fake.Deliver(); calls != 3 {
+		t.Fatalf("expected 3 calls, got %d", calls)
+	}
+	if len(seen) != 3 || seen[0] != "a" || seen[1] != "b" || seen[2] != "c" {
+		t.Fatalf("expected FIFO delivery, got %v", seen)
+	}
+	if acked := fake.Acked(); len(acked) != 3 || acked[1].Tags[0] != "email" {
+		t.Fatalf("unexpected acknowledged items: %+v", acked)
+	}
+	if items := fake.Items(); len(items) != 0 {
+		t.Fatalf("expected an empty queue, got %+v", items)
+	}
+}
+
+func TestDeliverDelay(t *testing.T) {
+	fake := New(Config{MaxAttempts: 2})
+	fake.Listener(func(item queue.Item, delay func(sec time.Duration)) {
+		delay(time.Minute)
+	})
+	fake.Add([]byte("a"))
+
+	if calls := fake.Deliver(); calls != 1 {
+		t.Fatalf("expected 1 call, got %d", calls)
+	}
+	if calls := fake.Deliver(); calls != 0 {
+		t.Fatalf("expected the delayed item to be hidden, got %d calls", calls)
+	}
+
+	fake.Clock.Advance(time.Minute)
+	if calls := fake.Deliver(); calls != 1 {
+		t.Fatalf("expected the item to be retried, got %d calls", calls)
+	}
+
+	// Both attempts are used up.
+	fake.Clock.Advance(time.Minute)
+	fake.Deliver()
+	if dead := fake.Items(queue.StateDead); len(dead) != 1 || dead[0].Attempts != 2 {
+		t.Fatalf("expected the item to be dead-lettered, got %+v", dead)
+	}
+}
+
+func TestClaimLease(t *testing.T) {
+	fake := New(Config{LeaseTimeout: time.Minute})
+	fake.Add([]byte("a"))
+
+	items, err := fake.Claim(10)
+	if err != nil || len(items) != 1 {
+		t.Fatalf("failed to claim item: %+v, %v", items, err)
+	}
+	if items, _ := fake.Claim(10); len(items) != 0 {
+		t.Fatalf("expected the lease to hold, got %+v", items)
+	}
+
+	fake.Clock.Advance(2 * time.Minute)
+	again, err := fake.Claim(10)
+	if err != nil || len(again) != 1 || again[0].Attempts != 2 {
+		t.Fatalf("expected the expired lease to be reclaimed, got %+v, %v", again, err)
+	}
+
+	stats, _ := fake.Stats()
+	if stats.InFlight != 1 || stats.Bytes != 1 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+
+	if err := fake.Ack(again[0].ID); err != nil {
+		t.Fatalf("failed to ack item: %v", err)
+	}
+	if err := fake.Ack(again[0].ID); !errors.Is(err, queue.ErrItemNotFound) {
+		t.Fatalf("expected ErrItemNotFound, got %v", err)
+	}
+
+	fake.Close()
+	if err := fake.Add([]byte("b")); !errors.Is(err, queue.ErrClosed) {
+		t.Fatalf("expected ErrClosed, got %v", err)
+	}
+}
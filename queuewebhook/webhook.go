@@ -0,0 +1,246 @@
+// Package queuewebhook posts queue events to HTTP endpoints, for teams that
+// want alerts without running a metrics stack. A Notifier reports items that
+// moved to the dead letters and backlogs above a threshold as JSON, retries
+// failed deliveries with exponential backoff and signs every request with
+// HMAC-SHA256 so receivers can verify the sender.
+//
+// Wire the notifier into a queue through its hooks and run it alongside:
+//
+//	n := queuewebhook.New(queuewebhook.Config{URLs: urls, Secret: secret, BacklogThreshold: 1000})
+//	q, err := queue.New(queue.Config{Hooks: n.Hooks(queue.Hooks{})})
+//	...
+//	go n.Run(ctx, q)
+package queuewebhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/elum-utils/queue"
+)
+
+// Event types posted by a Notifier.
+const (
+	EventDeadLetter = "dead_letter" // An item used up its attempts.
+	EventBacklog    = "backlog"     // Pending items reached Config.BacklogThreshold.
+)
+
+// SignatureHeader carries the hex-encoded HMAC-SHA256 of the request body,
+// prefixed with "sha256=", when Config.Secret is set.
+const SignatureHeader = "X-Queue-Signature"
+
+// Event is the JSON body of a webhook request.
+type Event struct {
+	Type  string       `json:"type"`            // EventDeadLetter or EventBacklog.
+	Time  time.Time    `json:"time"`            // When the event happened.
+	Item  *queue.Item  `json:"item,omitempty"`  // The dead-lettered item.
+	Stats *queue.Stats `json:"stats,omitempty"` // Queue statistics when the backlog was detected.
+}
+
+// Config represents configuration options for a Notifier.
+type Config struct {
+	URLs   []string // Endpoints receiving every event.
+	Secret []byte   // Key signing the requests; nil sends them unsigned.
+
+	BacklogThreshold int           // Pending items that trigger EventBacklog; 0 disables backlog alerts.
+	CheckInterval    time.Duration // How often Run checks the backlog.
+
+	MaxRetries int           // Additional attempts after a failed delivery; 3 by default, negative disables retries.
+	RetryDelay time.Duration // Pause before the first retry; doubled after every failure.
+	BufferSize int           // Events waiting for delivery before new ones are dropped.
+
+	HTTPClient *http.Client // Client sending the requests; a client with a 10 second timeout by default.
+	Logger     queue.Logger // Receives delivery errors and dropped events; nil uses the logger of the queue passed to Run.
+}
+
+// configDefault fills in the settings left empty in the provided configuration.
+func configDefault(config ...Config) Config {
+	cfg := Config{}
+	if len(config) > 0 {
+		cfg = config[0]
+	}
+
+	if cfg.CheckInterval <= 0 {
+		cfg.CheckInterval = 30 * time.Second
+	}
+	if cfg.MaxRetries < 0 {
+		cfg.MaxRetries = 0
+	} else if cfg.MaxRetries == 0 {
+		cfg.MaxRetries = 3
+	}
+	if cfg.RetryDelay <= 0 {
+		cfg.RetryDelay = time.Second
+	}
+	if cfg.BufferSize <= 0 {
+		cfg.BufferSize = 100
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	return cfg
+}
+
+// Notifier delivers queue events to the configured webhooks.
+type Notifier struct {
+	cfg    Config
+	events chan Event                   // Events waiting for Run to deliver them.
+	logger atomic.Pointer[queue.Logger] // Config.Logger, or the logger of the queue passed to Run.
+}
+
+// New returns a Notifier with the given configuration.
+func New(config ...Config) *Notifier {
+	cfg := configDefault(config...)
+	n := &Notifier{cfg: cfg, events: make(chan Event, cfg.BufferSize)}
+	logger := cfg.Logger
+	if logger == nil {
+		logger = queue.LoggerOf(nil) // Until Run knows the queue.
+	}
+	n.logger.Store(&logger)
+	return n
+}
+
+// Hooks returns base with OnDeadLetter extended to report dead letters. The
+// hook only buffers the event, so the queue is never held up by slow
+// endpoints; events arriving while the buffer is full are dropped.
+func (n *Notifier) Hooks(base queue.Hooks) queue.Hooks {
+	next := base.OnDeadLetter
+	base.OnDeadLetter = func(item queue.Item) {
+		n.enqueue(Event{Type: EventDeadLetter, Time: time.Now(), Item: &item})
+		if next != nil {
+			next(item)
+		}
+	}
+	return base
+}
+
+// enqueue buffers an event for delivery without blocking.
+func (n *Notifier) enqueue(e Event) {
+	select {
+	case n.events <- e:
+	default:
+		n.log("Dropping webhook event, buffer full:", e.Type)
+	}
+}
+
+// log prints to the logger of the notifier.
+func (n *Notifier) log(v ...any) {
+	(*n.logger.Load()).Println(v...)
+}
+
+// Run delivers buffered events and checks the backlog of q every
+// Config.CheckInterval until ctx is done. A backlog event is sent when the
+// number of pending items reaches the threshold, and again only after it
+// dropped below. q may be nil if backlog alerts are not needed.
+func (n *Notifier) Run(ctx context.Context, q queue.Queuer) error {
+	if n.cfg.Logger == nil && q != nil {
+		logger := queue.LoggerOf(q)
+		n.logger.Store(&logger)
+	}
+
+	ticker := time.NewTicker(n.cfg.CheckInterval)
+	defer ticker.Stop()
+
+	alerted := false
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case e := <-n.events:
+			if err := n.Notify(ctx, e); err != nil && ctx.Err() == nil {
+				n.log("Error delivering webhook:", err)
+			}
+		case <-ticker.C:
+			if q == nil || n.cfg.BacklogThreshold <= 0 {
+				continue
+			}
+
+			stats, err := q.Stats()
+			if err != nil {
+				n.log("Error reading queue stats:", err)
+				continue
+			}
+			if stats.Pending < n.cfg.BacklogThreshold {
+				alerted = false
+				continue
+			}
+			if !alerted {
+				alerted = true
+				n.enqueue(Event{Type: EventBacklog, Time: time.Now(), Stats: &stats})
+			}
+		}
+	}
+}
+
+// Notify posts the event to every configured URL, retrying each with
+// exponential backoff, and returns the first delivery that failed for good.
+func (n *Notifier) Notify(ctx context.Context, e Event) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	var firstErr error
+	for _, url := range n.cfg.URLs {
+		if err := n.deliver(ctx, url, body); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// deliver posts the body to url until it succeeds or the retries are used up.
+func (n *Notifier) deliver(ctx context.Context, url string, body []byte) error {
+	delay := n.cfg.RetryDelay
+	for attempt := 0; ; attempt++ {
+		err := n.post(ctx, url, body)
+		if err == nil || attempt == n.cfg.MaxRetries {
+			return err
+		}
+
+		select {
+		case <-time.After(delay):
+			delay *= 2
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// post sends a single signed request.
+func (n *Notifier) post(ctx context.Context, url string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if n.cfg.Secret != nil {
+		req.Header.Set(SignatureHeader, Sign(n.cfg.Secret, body))
+	}
+
+	resp, err := n.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("queuewebhook: %s responded with %s", url, resp.Status)
+	}
+	return nil
+}
+
+// Sign returns the value of SignatureHeader for the body. Receivers compare
+// it with hmac.Equal against the header of incoming requests.
+func Sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
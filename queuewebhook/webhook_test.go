@@ -0,0 +1,130 @@
+package queuewebhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/elum-utils/queue"
+)
+
+// setupServer returns a webhook endpoint failing the first 'failures'
+// requests and passing the verified events of the others to the channel.
+func setupServer(t *testing.T, secret []byte, failures int32) (*httptest.Server, chan Event) {
+	t.Helper()
+	events := make(chan Event, 10)
+	var calls atomic.Int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) <= failures {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+
+		body, _ := io.ReadAll(r.Body)
+		if !hmac.Equal([]byte(r.Header.Get(SignatureHeader)), []byte(Sign(secret, body))) {
+			http.Error(w, "bad signature", http.StatusUnauthorized)
+			return
+		}
+
+		var e Event
+		if err := json.Unmarshal(body, &e); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		events <- e
+	}))
+	t.Cleanup(server.Close)
+	return server, events
+}
+
+func TestDeadLetterWebhook(t *testing.T) {
+	secret := []byte("secret")
+	server, events := setupServer(t, secret, 1)
+
+	n := New(Config{URLs: []string{server.URL}, Secret: secret, RetryDelay: time.Millisecond})
+	q, err := queue.New(queue.Config{MaxAttempts: 1, LeaseTimeout: time.Millisecond, Hooks: n.Hooks(queue.Hooks{})})
+	if err != nil {
+		t.Fatalf("failed to initialize queue: %v", err)
+	}
+	defer q.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go n.Run(ctx, q)
+
+	if err := q.Add([]byte("poison")); err != nil {
+		t.Fatalf("failed to add item: %v", err)
+	}
+
+	// Claim the item, let the lease expire and claim again to dead-letter it.
+	if _, err := q.Claim(1); err != nil {
+		t.Fatalf("failed to claim item: %v", err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if _, err := q.Claim(1); err != nil {
+		t.Fatalf("failed to claim item: %v", err)
+	}
+
+	select {
+	case e := <-events:
+		if e.Type != EventDeadLetter || e.Item == nil || string(e.Item.Data) != "poison" {
+			t.Fatalf("unexpected event: %+v", e)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no webhook received")
+	}
+}
+
+func TestBacklogWebhook(t *testing.T) {
+	secret := []byte("secret")
+	server, events := setupServer(t, secret, 0)
+
+	q, err := queue.New()
+	if err != nil {
+		t.Fatalf("failed to initialize queue: %v", err)
+	}
+	defer q.Close()
+
+	for i := 0; i < 3; i++ {
+		if err := q.Add([]byte("test data")); err != nil {
+			t.Fatalf("failed to add item: %v", err)
+		}
+	}
+
+	n := New(Config{URLs: []string{server.URL}, Secret: secret, BacklogThreshold: 3, CheckInterval: 5 * time.Millisecond})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go n.Run(ctx, q)
+
+	select {
+	case e := <-events:
+		if e.Type != EventBacklog || e.Stats == nil || e.Stats.Pending != 3 {
+			t.Fatalf("unexpected event: %+v", e)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no webhook received")
+	}
+
+	// The alert is not repeated while the backlog persists.
+	select {
+	case e := <-events:
+		t.Fatalf("unexpected repeated event: %+v", e)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestNotifyGivesUp(t *testing.T) {
+	server, _ := setupServer(t, nil, 100)
+
+	n := New(Config{URLs: []string{server.URL}, MaxRetries: 2, RetryDelay: time.Millisecond})
+	if err := n.Notify(context.Background(), Event{Type: EventBacklog}); err == nil {
+		t.Fatal("expected an error after the retries were used up")
+	}
+}
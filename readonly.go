@@ -0,0 +1,140 @@
+package queue
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Follower inspects a queue owned by another process, for dashboards and
+// reports. It opens the file read-only and takes no part in processing: no
+// workers, maintenance or migrations run, and any write is refused by
+// SQLite. In WAL mode its reads never block the owner of the queue; outside
+// WAL mode a read holds a shared lock that delays the commits of the owner
+// until it is done, or up to its busy timeout. It is safe for concurrent use.
+type Follower struct {
+	c *Queue // Holds the configuration and tables; its connection is read-only.
+}
+
+// OpenReadOnly opens the queue in Config.LocalFile as a Follower. The
+// database must already be migrated to the schema of this package by the
+// owner of the queue, as a follower cannot migrate it. The settings of the
+// configuration that write to the database, such as Reset, JournalMode and
+// AutoVacuum, are ignored; see Config.Immutable for files nobody writes to.
+func OpenReadOnly(options ...Option) (*Follower, error) {
+	cfg, err := newConfig(options) // Retrieve the configuration with defaults.
+	if err != nil {
+		return nil, err
+	}
+	if !validTableName.MatchString(cfg.Table) {
+		return nil, &ConfigError{Field: "Table", Value: cfg.Table, Reason: "want letters, digits and underscores"}
+	}
+
+	db, err := sql.Open("sqlite3", readOnlyDSN(cfg))
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	if cfg.MaxIdleConns != 0 {
+		db.SetMaxIdleConns(cfg.MaxIdleConns)
+	}
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+
+	t := newTables(cfg.Table)
+	if err := checkSchema(db, t); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	c := &Queue{db: db, ownsDB: true, tables: t, cfg: cfg, ctx: ctx, cancelFunc: cancelFunc}
+	return &Follower{c: c}, nil
+}
+
+// readOnlyDSN builds the driver DSN opening the database of the
+// configuration read-only. query_only also covers in-memory databases,
+// whose mode cannot be changed.
+func readOnlyDSN(cfg Config) string {
+	name := cfg.LocalFile
+	if !strings.HasPrefix(name, "file:") {
+		name = "file:" + name // mode and immutable are only honored in URIs.
+	}
+
+	params := url.Values{}
+	params.Set("_query_only", "1")
+	if !strings.Contains(name, "mode=") {
+		params.Set("mode", "ro")
+	}
+	if cfg.Immutable {
+		params.Set("immutable", "1")
+	}
+	if cfg.BusyTimeout > 0 {
+		params.Set("_busy_timeout", strconv.FormatInt(cfg.BusyTimeout.Milliseconds(), 10))
+	}
+
+	separator := "?"
+	if strings.Contains(name, "?") {
+		separator = "&"
+	}
+	return name + separator + params.Encode()
+}
+
+// checkSchema returns an error unless the queue exists in db at the latest
+// schema version, without writing to db.
+func checkSchema(db *sql.DB, t tables) error {
+	version, err := storedSchemaVersion(db, t)
+	if err != nil {
+		return err
+	}
+
+	latest := migrations[len(migrations)-1].version
+	switch {
+	case version == 0:
+		return fmt.Errorf("queue: no queue %q in the database", t.items)
+	case version > latest:
+		return &SchemaVersionError{Found: version, Supported: latest}
+	case version < latest:
+		return ErrSchemaOutdated
+	}
+	return nil
+}
+
+// Stats returns the number of items in each state and the total payload
+// size, read in a single transaction; see Queue.Stats. Latency is zero, as
+// no listener runs in a follower.
+func (f *Follower) Stats() (Stats, error) {
+	tx, err := f.c.db.BeginTx(f.c.ctx, nil)
+	if err != nil {
+		return Stats{}, err
+	}
+	defer tx.Rollback() // The transaction is read-only.
+
+	return f.c.stats(f.c.ctx, tx)
+}
+
+// Browse returns up to 'limit' items in the given state, oldest first,
+// starting after 'cursor', along with the cursor of the next page, 0 after
+// the last one; see View.Browse.
+func (f *Follower) Browse(state State, limit, cursor int) ([]Item, int, error) {
+	items, err := f.c.listItems(f.c.ctx, f.c.db, state, limit, cursor, f.c.cfg.Clock.Now())
+	if err != nil || len(items) < limit {
+		return items, 0, err
+	}
+	return items, items[len(items)-1].ID, nil
+}
+
+// Export streams every item in the queue to w in the given format; see
+// Queue.Export.
+func (f *Follower) Export(ctx context.Context, w io.Writer, format Format) error {
+	return f.c.Export(ctx, w, format)
+}
+
+// Close closes the read-only connection.
+func (f *Follower) Close() error {
+	f.c.cancelFunc()
+	return f.c.db.Close()
+}
@@ -0,0 +1,76 @@
+package queue
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOpenReadOnly(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "queue.db")
+	queue := setupQueue(t, Config{LocalFile: file, JournalMode: "WAL", ManualStart: true})
+	defer queue.Close()
+
+	for _, data := range []string{"first", "second", "third"} {
+		if err := queue.Add([]byte(data)); err != nil {
+			t.Fatalf("failed to add item to queue: %v", err)
+		}
+	}
+
+	follower, err := OpenReadOnly(WithFile(file))
+	if err != nil {
+		t.Fatalf("failed to open queue read-only: %v", err)
+	}
+	defer follower.Close()
+
+	stats, err := follower.Stats()
+	if err != nil || stats.Pending != 3 {
+		t.Fatalf("expected 3 pending items, got %+v, %v", stats, err)
+	}
+	items, cursor, err := follower.Browse(StatePending, 2, 0)
+	if err != nil || len(items) != 2 || string(items[0].Data) != "first" || cursor != items[1].ID {
+		t.Fatalf("expected the first page, got %+v, %d, %v", items, cursor, err)
+	}
+	var buf bytes.Buffer
+	if err := follower.Export(queue.ctx, &buf, FormatJSONLines); err != nil || strings.Count(buf.String(), "\n") != 3 {
+		t.Fatalf("expected 3 exported records, got %q, %v", buf.String(), err)
+	}
+
+	// The owner keeps writing while the follower reads.
+	if err := queue.Add([]byte("fourth")); err != nil {
+		t.Fatalf("failed to add item to queue: %v", err)
+	}
+	if stats, err := follower.Stats(); err != nil || stats.Pending != 4 {
+		t.Fatalf("expected the follower to see the new item, got %+v, %v", stats, err)
+	}
+
+	// Writes through the read-only connection are refused.
+	if _, err := follower.c.db.Exec("DELETE FROM " + follower.c.tables.items); err == nil {
+		t.Fatalf("expected the follower not to write")
+	}
+}
+
+func TestOpenReadOnlySchema(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "queue.db")
+	queue := setupQueue(t, Config{LocalFile: file})
+	queue.Close()
+
+	if _, err := OpenReadOnly(WithFile(file), WithTable("missing")); err == nil {
+		t.Fatalf("expected an error for a missing queue")
+	}
+
+	db, err := open(Config{LocalFile: file, MaxOpenConns: 1})
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	if _, err := db.Exec("UPDATE " + versionTable + " SET version = version - 1"); err != nil {
+		t.Fatalf("failed to change the schema version: %v", err)
+	}
+	db.Close()
+
+	if _, err := OpenReadOnly(WithFile(file)); !errors.Is(err, ErrSchemaOutdated) {
+		t.Fatalf("expected ErrSchemaOutdated, got %v", err)
+	}
+}
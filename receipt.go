@@ -0,0 +1,135 @@
+package queue
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// newReceiptNonce returns the random part of the receipts handed out by a
+// claim. Every claim stores a new one on the items it claims, so the receipts
+// of earlier deliveries stop matching.
+func newReceiptNonce() string {
+	var nonce [8]byte
+	rand.Read(nonce[:])
+	return hex.EncodeToString(nonce[:])
+}
+
+// formatReceipt returns the receipt of a delivery of an item.
+func formatReceipt(id int, nonce string) string {
+	return strconv.Itoa(id) + "." + nonce
+}
+
+// parseReceipt splits a receipt into the item ID and the nonce of the delivery.
+func parseReceipt(receipt string) (int, string, error) {
+	id, nonce, ok := strings.Cut(receipt, ".")
+	if !ok || nonce == "" {
+		return 0, "", ErrInvalidReceipt
+	}
+	n, err := strconv.Atoi(id)
+	if err != nil {
+		return 0, "", ErrInvalidReceipt
+	}
+	return n, nonce, nil
+}
+
+// deliveryNonce returns the nonce of the receipt of a claimed item, for the
+// statements that only act on that delivery, or nil for an item without a
+// receipt, which matches any delivery to this instance.
+func deliveryNonce(item Item) any {
+	if _, nonce, err := parseReceipt(item.Receipt); err == nil {
+		return nonce
+	}
+	return nil
+}
+
+// AckReceipt removes a claimed item once it has been processed, like Ack,
+// but only for the delivery the receipt was issued for. Once the lease of a
+// slow consumer expired and the item was claimed again, even by the same
+// queue instance, the old receipt no longer matches, so the consumer cannot
+// acknowledge the newer delivery by mistake. A receipt is used up by
+// AckReceipt and NackReceipt; afterwards, or once superseded, they return
+// ErrInvalidReceipt.
+func (c *Queue) AckReceipt(receipt string) error {
+	id, nonce, err := parseReceipt(receipt)
+	if err != nil {
+		return err
+	}
+	err = c.ackWith(id, completion{receipt: nonce})
+	if errors.Is(err, ErrItemNotFound) {
+		return ErrInvalidReceipt
+	}
+	return err
+}
+
+// NackReceipt hands a claimed item back to the queue like Release, but only
+// for the delivery the receipt was issued for; see AckReceipt. With a
+// positive delay the item stays hidden until the delay elapsed.
+func (c *Queue) NackReceipt(receipt string, delay time.Duration) error {
+	id, nonce, err := parseReceipt(receipt)
+	if err != nil {
+		return err
+	}
+
+	c.mx.Lock() // Lock for exclusive access to the queue.
+	defer c.mx.Unlock()
+
+	var released bool
+	if delay > 0 {
+		at := c.cfg.Clock.Now().Add(delay)
+		released, err = c.transition(id, TransitionReleased, "", c.stmts.retry, id, c.owner, at.UnixNano(), nonce)
+		if released {
+			c.retries = append(c.retries, at)
+		}
+	} else {
+		released, err = c.transition(id, TransitionReleased, "", c.stmts.release, id, c.owner, nonce)
+	}
+	if err != nil {
+		return err
+	}
+	if !released {
+		return ErrInvalidReceipt
+	}
+
+	c.signalAdded()
+	return nil
+}
+
+// Touch extends the lease of a claimed item to 'extend' from now, so a
+// consumer taking longer than Config.LeaseTimeout keeps the item. It returns
+// ErrInvalidReceipt unless the receipt belongs to the current delivery of the
+// item; a lease that ran out can be extended until another consumer claims
+// the item.
+func (c *Queue) Touch(receipt string, extend time.Duration) error {
+	id, nonce, err := parseReceipt(receipt)
+	if err != nil {
+		return err
+	}
+	if extend <= 0 {
+		return fmt.Errorf("queue: lease extension must be longer than 0, got %v", extend)
+	}
+
+	c.mx.Lock() // Lock for exclusive access to the queue.
+	defer c.mx.Unlock()
+
+	res, err := c.db.ExecContext(
+		c.ctx,
+		"UPDATE "+c.tables.items+" SET lease_until = ? WHERE id = ? AND owner = ? AND state = 'in-flight' AND receipt = ?",
+		c.cfg.Clock.Now().Add(extend).UnixNano(), id, c.owner, nonce,
+	)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrInvalidReceipt
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package queue
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAckReceipt(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1700000000, 0))
+	queue := setupQueue(t, Config{Clock: clock, LeaseTimeout: time.Minute})
+	defer queue.Close()
+
+	if err := queue.Add([]byte("test data")); err != nil {
+		t.Fatalf("failed to add item to queue: %v", err)
+	}
+	first, err := queue.Claim(1)
+	if err != nil || len(first) != 1 || first[0].Receipt == "" {
+		t.Fatalf("expected a claimed item with a receipt, got %+v, %v", first, err)
+	}
+
+	// The lease runs out and the item is delivered again.
+	clock.Advance(2 * time.Minute)
+	second, err := queue.Claim(1)
+	if err != nil || len(second) != 1 || second[0].Receipt == first[0].Receipt {
+		t.Fatalf("expected the item to be redelivered with a new receipt, got %+v, %v", second, err)
+	}
+
+	if err := queue.AckReceipt(first[0].Receipt); !errors.Is(err, ErrInvalidReceipt) {
+		t.Fatalf("expected the stale receipt to be rejected, got %v", err)
+	}
+	if err := queue.AckReceipt(second[0].Receipt); err != nil {
+		t.Fatalf("failed to acknowledge item: %v", err)
+	}
+	if err := queue.AckReceipt(second[0].Receipt); !errors.Is(err, ErrInvalidReceipt) {
+		t.Fatalf("expected the receipt to be used up, got %v", err)
+	}
+	if err := queue.AckReceipt("garbage"); !errors.Is(err, ErrInvalidReceipt) {
+		t.Fatalf("expected a malformed receipt to be rejected, got %v", err)
+	}
+}
+
+func TestNackAndTouchReceipt(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1700000000, 0))
+	queue := setupQueue(t, Config{Clock: clock, LeaseTimeout: time.Minute})
+	defer queue.Close()
+
+	if err := queue.Add([]byte("test data")); err != nil {
+		t.Fatalf("failed to add item to queue: %v", err)
+	}
+	items, err := queue.Claim(1)
+	if err != nil || len(items) != 1 {
+		t.Fatalf("failed to claim item: %v", err)
+	}
+	receipt := items[0].Receipt
+
+	// An extended lease keeps the item from being claimed again.
+	if err := queue.Touch(receipt, time.Hour); err != nil {
+		t.Fatalf("failed to extend lease: %v", err)
+	}
+	clock.Advance(2 * time.Minute)
+	if items, err := queue.Claim(1); err != nil || len(items) != 0 {
+		t.Fatalf("expected the touched item to stay claimed, got %+v, %v", items, err)
+	}
+
+	if err := queue.NackReceipt(receipt, 0); err != nil {
+		t.Fatalf("failed to release item: %v", err)
+	}
+	if err := queue.Touch(receipt, time.Hour); !errors.Is(err, ErrInvalidReceipt) {
+		t.Fatalf("expected the receipt to be used up, got %v", err)
+	}
+	if items, err := queue.Claim(1); err != nil || len(items) != 1 || items[0].Attempts != 2 {
+		t.Fatalf("expected the released item to be claimed again, got %+v, %v", items, err)
+	}
+}
+
+func TestListenerAcksOnlyItsDelivery(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1700000000, 0))
+	logger := &recordingLogger{}
+	queue := setupQueue(t, Config{Clock: clock, LeaseTimeout: time.Minute, Logger: logger})
+	defer queue.Close()
+
+	if err := queue.Add([]byte("test data")); err != nil {
+		t.Fatalf("failed to add item to queue: %v", err)
+	}
+	started, release := make(chan struct{}), make(chan struct{})
+	queue.Listener(func(item Item, delay func(sec time.Duration)) {
+		close(started)
+		<-release
+	})
+	<-started
+
+	// The listener outlasts its lease and the item is claimed again by this
+	// same instance, so only the receipt tells the deliveries apart.
+	clock.Advance(2 * time.Minute)
+	items, err := queue.Claim(1)
+	if err != nil || len(items) != 1 {
+		t.Fatalf("expected the item to be claimed again, got %+v, %v", items, err)
+	}
+	close(release)
+
+	deadline := time.Now().Add(3 * time.Second)
+	for !logged(logger, "Lease expired before the item was acknowledged") {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the listener to finish")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := queue.AckReceipt(items[0].Receipt); err != nil {
+		t.Fatalf("expected the newer delivery to survive the listener, got %v", err)
+	}
+}
+
+// logged reports whether the logger recorded a line containing s.
+func logged(l *recordingLogger, s string) bool {
+	l.mx.Lock()
+	defer l.mx.Unlock()
+
+	for _, line := range l.lines {
+		if strings.Contains(line, s) {
+			return true
+		}
+	}
+	return false
+}
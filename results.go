@@ -0,0 +1,98 @@
+package queue
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// createResultsTable creates the table holding the results of completed items.
+func createResultsTable(tx *sql.Tx, t tables) error {
+	_, err := tx.Exec(`
+        CREATE TABLE IF NOT EXISTS ` + t.results + ` (
+            item_id INTEGER PRIMARY KEY,
+            data BLOB,
+            expires_at INTEGER NOT NULL
+        );
+    `)
+	return err
+}
+
+// SetResult records the result of an item from within a listener callback.
+// It is stored in the same transaction that acknowledges the item once the
+// callback returns, and discarded if the callback asks for a retry.
+// Producers read it with Result for Config.ResultTTL.
+func (c *Queue) SetResult(id int, result []byte) {
+	c.record(id, func(done *completion) {
+		done.result, done.hasResult = result, true
+	})
+}
+
+// AckResult acknowledges an item claimed by this queue instance and stores
+// its result in the same transaction. It returns ErrItemNotFound if the item
+// is not held by this instance.
+func (c *Queue) AckResult(id int, result []byte) error {
+	return c.ackWith(id, completion{result: result, hasResult: true})
+}
+
+// SetError records that an item failed for good from within a listener
+// callback. Unlike asking for a retry, the item is acknowledged once the
+// callback returns, and Result and Do report err to the producer.
+func (c *Queue) SetError(id int, err error) {
+	c.record(id, func(done *completion) {
+		done.result, done.errMsg, done.hasResult = nil, err.Error(), true
+	})
+}
+
+// HandlerError is returned by Result and Do for items whose handler reported
+// a failure with SetError.
+type HandlerError struct {
+	ID      int    // Identifier of the failed item.
+	Message string // Error message reported by the handler.
+}
+
+func (e *HandlerError) Error() string {
+	return fmt.Sprintf("queue: item %d failed: %s", e.ID, e.Message)
+}
+
+// Result returns the result stored for a completed item, or a *HandlerError
+// if its handler reported a failure. It returns ErrNoResult if the item has
+// not completed yet, completed without a result, or its result expired.
+func (c *Queue) Result(id int) ([]byte, error) {
+	var result []byte
+	var errMsg sql.NullString
+	err := c.db.QueryRowContext(
+		c.ctx,
+		"SELECT `data`, `error` FROM "+c.tables.results+" WHERE item_id = ? AND expires_at > ?",
+		id, c.cfg.Clock.Now().UnixNano(),
+	).Scan(&result, &errMsg)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil, ErrNoResult
+	case err != nil:
+		return nil, err
+	case errMsg.Valid:
+		return nil, &HandlerError{ID: id, Message: errMsg.String}
+	}
+	return result, nil
+}
+
+// storeResult writes the result or error message of an item and prunes
+// expired results.
+func (c *Queue) storeResult(tx *sql.Tx, id int, result []byte, errMsg string) error {
+	now := c.cfg.Clock.Now()
+	if _, err := tx.Exec("DELETE FROM "+c.tables.results+" WHERE expires_at <= ?", now.UnixNano()); err != nil {
+		return err
+	}
+
+	var message any
+	if errMsg != "" {
+		message = errMsg
+	}
+
+	_, err := tx.Exec(
+		"INSERT OR REPLACE INTO "+c.tables.results+"(`item_id`, `data`, `error`, `expires_at`) VALUES (?, ?, ?, ?)",
+		id, result, message, now.Add(c.cfg.ResultTTL).UnixNano(),
+	)
+	return err
+}
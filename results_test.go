@@ -0,0 +1,85 @@
+package queue
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestResults(t *testing.T) {
+	queue := setupQueue(t, Config{})
+	defer queue.Close()
+
+	if err := queue.Add([]byte("2+2")); err != nil {
+		t.Fatalf("failed to add item to queue: %v", err)
+	}
+	items, err := queue.Claim(1)
+	if err != nil || len(items) != 1 {
+		t.Fatalf("failed to claim item: %v", err)
+	}
+
+	if _, err := queue.Result(items[0].ID); !errors.Is(err, ErrNoResult) {
+		t.Fatalf("expected ErrNoResult before completion, got %v", err)
+	}
+
+	if err := queue.AckResult(items[0].ID, []byte("4")); err != nil {
+		t.Fatalf("failed to ack item: %v", err)
+	}
+	result, err := queue.Result(items[0].ID)
+	if err != nil || string(result) != "4" {
+		t.Fatalf("unexpected result %q, %v", result, err)
+	}
+}
+
+func TestResultsExpire(t *testing.T) {
+	queue := setupQueue(t, Config{ResultTTL: time.Millisecond})
+	defer queue.Close()
+
+	if err := queue.Add([]byte("test data")); err != nil {
+		t.Fatalf("failed to add item to queue: %v", err)
+	}
+	items, _ := queue.Claim(1)
+	if err := queue.AckResult(items[0].ID, []byte("done")); err != nil {
+		t.Fatalf("failed to ack item: %v", err)
+	}
+
+	time.Sleep(5 * time.Millisecond)
+	if _, err := queue.Result(items[0].ID); !errors.Is(err, ErrNoResult) {
+		t.Fatalf("expected the result to expire, got %v", err)
+	}
+}
+
+func TestSetResult(t *testing.T) {
+	queue := setupQueue(t, Config{})
+	defer queue.Close()
+
+	if err := queue.Add([]byte("test data")); err != nil {
+		t.Fatalf("failed to add item to queue: %v", err)
+	}
+
+	done := make(chan int, 1)
+	queue.Listener(func(item Item, delay func(sec time.Duration)) {
+		queue.SetResult(item.ID, []byte("processed"))
+		done <- item.ID
+	})
+
+	var id int
+	select {
+	case id = <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the listener was not called")
+	}
+
+	// The result is committed with the acknowledgement after the callback returns.
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		result, err := queue.Result(id)
+		if errors.Is(err, ErrNoResult) {
+			continue
+		}
+		if err != nil || string(result) != "processed" {
+			t.Fatalf("unexpected result %q, %v", result, err)
+		}
+		return
+	}
+	t.Fatal("no result was stored")
+}
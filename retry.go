@@ -0,0 +1,115 @@
+package queue
+
+import (
+	"math"
+	"math/rand/v2"
+	"time"
+)
+
+// RetryPolicy decides when a failed delivery is retried: items a listener
+// called Retry for, the failed items of a BatchListener, and messages a
+// subscriber or group consumer returned an error for. attempt counts the
+// deliveries so far, starting at 1, and err is the failure. Returning
+// giveUp moves an item to the dead letters, and skips a message.
+type RetryPolicy interface {
+	NextDelay(attempt int, err error) (delay time.Duration, giveUp bool)
+}
+
+// RetryPolicyFunc adapts a function to a RetryPolicy.
+type RetryPolicyFunc func(attempt int, err error) (time.Duration, bool)
+
+// NextDelay calls f.
+func (f RetryPolicyFunc) NextDelay(attempt int, err error) (time.Duration, bool) {
+	return f(attempt, err)
+}
+
+// ExponentialBackoff is the built-in RetryPolicy: the delay starts at
+// Initial and grows by Multiplier with every attempt, up to Max.
+type ExponentialBackoff struct {
+	Initial     time.Duration // Delay after the first failure; 0 means one second.
+	Max         time.Duration // Longest delay; 0 means five minutes.
+	Multiplier  float64       // Growth of the delay per attempt; 0 means 2.
+	Jitter      float64       // Random fraction, from 0 to 1, taken off each delay so consumers failing together spread out.
+	MaxAttempts int           // Attempts after which the policy gives up; 0 retries forever, leaving it to Config.MaxAttempts.
+}
+
+// DefaultRetryPolicy is used when Config.RetryPolicy is nil.
+var DefaultRetryPolicy RetryPolicy = ExponentialBackoff{}
+
+// NextDelay returns Initial * Multiplier^(attempt-1), capped at Max, less
+// the jitter, or gives up after MaxAttempts.
+func (b ExponentialBackoff) NextDelay(attempt int, err error) (time.Duration, bool) {
+	if b.MaxAttempts > 0 && attempt >= b.MaxAttempts {
+		return 0, true
+	}
+
+	initial, limit, multiplier := b.Initial, b.Max, b.Multiplier
+	if initial <= 0 {
+		initial = time.Second
+	}
+	if limit <= 0 {
+		limit = 5 * time.Minute
+	}
+	if multiplier <= 0 {
+		multiplier = 2
+	}
+
+	delay := float64(initial) * math.Pow(multiplier, float64(max(attempt-1, 0)))
+	delay = min(delay, float64(limit))
+	if b.Jitter > 0 {
+		delay -= delay * min(b.Jitter, 1) * rand.Float64()
+	}
+	return time.Duration(delay), false
+}
+
+// Retry records from within a listener callback that processing an item
+// failed with err. Once the callback returns, the item is retried after the
+// delay Config.RetryPolicy picks for its attempt and err, or moved to the
+// dead letters if the policy gives up. A delay the callback asks for itself
+// takes precedence.
+func (c *Queue) Retry(id int, err error) {
+	c.record(id, func(done *completion) {
+		done.retry = err
+	})
+}
+
+// retryPolicy returns Config.RetryPolicy, or DefaultRetryPolicy.
+func (c *Queue) retryPolicy() RetryPolicy {
+	if c.cfg.RetryPolicy != nil {
+		return c.cfg.RetryPolicy
+	}
+	return DefaultRetryPolicy
+}
+
+// giveUp moves an item claimed by this instance to the dead letters because
+// the RetryPolicy gave up on it.
+func (c *Queue) giveUp(item Item) {
+	c.mx.Lock() // Lock for exclusive access to the queue.
+	moved, err := c.transition(item.ID, TransitionDeadLettered, "", c.stmts.giveUp, item.ID, c.owner, c.cfg.Clock.Now().UnixNano(), deliveryNonce(item))
+	c.mx.Unlock()
+
+	switch {
+	case err != nil:
+		c.cfg.Logger.Println("Error dead-lettering item:", err)
+	case moved:
+		item.State = StateDead
+		c.cfg.Hooks.deadLetter(item)
+		c.count(MetricDeadLettered, 1)
+	}
+}
+
+// attempts counts the consecutive failed deliveries of a message to a
+// subscriber or group consumer, which have no attempts column.
+type attempts struct {
+	seq int64
+	n   int
+}
+
+// next records a failed delivery of message seq and returns the attempt it was.
+func (a *attempts) next(seq int64) int {
+	if a.seq != seq {
+		a.seq, a.n = seq, 0
+	}
+	a.n++
+	return a.n
+}
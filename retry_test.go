@@ -0,0 +1,121 @@
+package queue
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestExponentialBackoff(t *testing.T) {
+	policy := ExponentialBackoff{Initial: time.Second, Max: 10 * time.Second, MaxAttempts: 6}
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second}
+	for i, want := range expected {
+		delay, giveUp := policy.NextDelay(i+1, nil)
+		if giveUp || delay != want {
+			t.Fatalf("expected attempt %d to wait %v, got %v, %v", i+1, want, delay, giveUp)
+		}
+	}
+	if _, giveUp := policy.NextDelay(6, nil); !giveUp {
+		t.Fatalf("expected the policy to give up after %d attempts", policy.MaxAttempts)
+	}
+
+	policy = ExponentialBackoff{Initial: time.Second, Jitter: 0.5}
+	for i := 0; i < 100; i++ {
+		if delay, _ := policy.NextDelay(1, nil); delay < time.Second/2 || delay > time.Second {
+			t.Fatalf("expected a jittered delay between 500ms and 1s, got %v", delay)
+		}
+	}
+}
+
+func TestRetryPolicy(t *testing.T) {
+	errBroken := errors.New("broken")
+	var attempts []int
+	policy := RetryPolicyFunc(func(attempt int, err error) (time.Duration, bool) {
+		if !errors.Is(err, errBroken) {
+			t.Errorf("expected the error passed to Retry, got %v", err)
+		}
+		attempts = append(attempts, attempt)
+		return 0, attempt >= 3
+	})
+
+	dead := make(chan Item, 1)
+	hooks := Hooks{OnDeadLetter: func(item Item) { dead <- item }}
+	queue := setupQueue(t, Config{RetryPolicy: policy, Hooks: hooks})
+	defer queue.Close()
+
+	if err := queue.Add([]byte("test data")); err != nil {
+		t.Fatalf("failed to add item to queue: %v", err)
+	}
+
+	queue.Listener(func(item Item, delay func(sec time.Duration)) {
+		queue.Retry(item.ID, errBroken)
+	})
+
+	select {
+	case item := <-dead:
+		if item.Attempts != 3 {
+			t.Fatalf("expected the item to be dead-lettered after 3 attempts, got %d", item.Attempts)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected the policy to give up on the item")
+	}
+
+	if len(attempts) != 3 || attempts[0] != 1 || attempts[2] != 3 {
+		t.Fatalf("expected the policy to be asked for attempts 1 to 3, got %v", attempts)
+	}
+	items, err := queue.DeadLetters(10)
+	if err != nil || len(items) != 1 {
+		t.Fatalf("expected one dead letter, got %+v, %v", items, err)
+	}
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1700000000, 0))
+	queue := setupQueue(t, Config{Clock: clock, RetryPolicy: ExponentialBackoff{Initial: time.Minute}})
+	defer queue.Close()
+
+	if err := queue.Add([]byte("test data")); err != nil {
+		t.Fatalf("failed to add item to queue: %v", err)
+	}
+
+	delivered := make(chan int, 2)
+	queue.Listener(func(item Item, delay func(sec time.Duration)) {
+		if item.Attempts == 1 {
+			queue.Retry(item.ID, errors.New("broken"))
+		}
+		delivered <- item.Attempts
+	})
+
+	if attempt := <-delivered; attempt != 1 {
+		t.Fatalf("expected the first attempt, got %d", attempt)
+	}
+
+	// The retry is due a minute later.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		jobs, err := queue.ScheduledJobs(10)
+		if err != nil {
+			t.Fatalf("failed to list scheduled jobs: %v", err)
+		}
+		if len(jobs) == 1 {
+			if want := clock.Now().Add(time.Minute); !jobs[0].RunAt.Equal(want) {
+				t.Fatalf("expected the retry at %v, got %v", want, jobs[0].RunAt)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the item to be scheduled for a retry")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	clock.Advance(time.Minute)
+	select {
+	case attempt := <-delivered:
+		if attempt != 2 {
+			t.Fatalf("expected the second attempt, got %d", attempt)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected the item to be retried after the delay")
+	}
+}
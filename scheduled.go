@@ -0,0 +1,108 @@
+package queue
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// addOptionsKey is the context key carrying *addOptions from AddAt, Do and others
+// through the Add middleware to add.
+type addOptionsKey struct{}
+
+// addOptions are settings of a single add that have no parameter in AddFunc.
+type addOptions struct {
+	visibleAt int64  // Unix nanoseconds before which consumers do not see the item; 0 for now.
+	awaited   bool   // Whether Do waits for the result of the item.
+	tenant    string // Tenant the item is added for; see AddForTenant.
+	expiresAt int64  // Unix nanoseconds after which the item expires instead of being delivered; 0 for never.
+	id        int    // Set by add to the ID of the inserted item.
+
+	// Set by the options of AddWithOptions.
+	delay    time.Duration     // Converted to visibleAt when the item is added.
+	priority int               // Priority of the item.
+	headers  map[string]string // Metadata returned in Item.Headers.
+	dedupKey string            // Key the item is deduplicated by; empty for none.
+	tags     []string          // Tags of the item, passed to the middleware as such.
+	jobType  string            // Job type selecting the handler registered with Handle.
+}
+
+// ScheduledJob is a pending item that becomes visible to consumers in the future.
+type ScheduledJob struct {
+	ID    int       // Identifier of the item.
+	Data  []byte    // Payload of the item.
+	Tags  []string  // Tags attached to the item.
+	RunAt time.Time // When the item becomes visible to consumers.
+}
+
+// AddAt inserts a new item with the given tags that stays hidden from
+// listeners and Claim until 'at', and returns its ID. Until then it can be
+// listed with ScheduledJobs, moved with Reschedule and withdrawn with Cancel.
+// The Add middleware and the overflow policy apply as for AddTagged; the ID
+// is 0 if the policy discarded the item.
+func (c *Queue) AddAt(at time.Time, data []byte, tags ...string) (int, error) {
+	opts := &addOptions{visibleAt: at.UnixNano()}
+	ctx := context.WithValue(c.ctx, addOptionsKey{}, opts)
+	if err := c.enqueue(ctx, data, tags, c.cfg.Overflow); err != nil {
+		return 0, err
+	}
+	return opts.id, nil
+}
+
+// ScheduledJobs returns up to 'limit' items that are not visible yet, the
+// soonest first.
+func (c *Queue) ScheduledJobs(limit int) ([]ScheduledJob, error) {
+	c.mx.Lock() // Lock for exclusive access to the queue.
+	defer c.mx.Unlock()
+
+	rows, err := c.db.QueryContext(
+		c.ctx,
+		"SELECT `id`, `data`, `tags`, `visible_at`, `chunks`, `blob`, `checksum` FROM "+c.tables.items+" WHERE state = 'pending' AND visible_at > ? ORDER BY visible_at, id LIMIT ?",
+		c.cfg.Clock.Now().UnixNano(), limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close() // Ensure rows are closed after processing.
+
+	var jobs []ScheduledJob
+	var items []Item // Payloads of the jobs, joined with their chunks below.
+	for rows.Next() {
+		var item Item
+		var tags, blob sql.NullString
+		var visibleAt int64
+		if err := rows.Scan(&item.ID, &item.Data, &tags, &visibleAt, &item.chunks, &blob, &item.checksum); err != nil {
+			return nil, err
+		}
+		item.blob = blob.String
+		job := ScheduledJob{ID: item.ID, RunAt: time.Unix(0, visibleAt)}
+		if job.Tags, err = decodeTags(tags.String); err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close() // Release the connection before loading the payloads.
+
+	if err := c.loadPayloads(c.db, items); err != nil {
+		return nil, err
+	}
+	for i := range jobs {
+		jobs[i].Data = items[i].Data
+	}
+	return jobs, nil
+}
+
+// Reschedule moves an item that is not visible yet to a new time; a time in
+// the past makes it visible right away. It returns ErrItemNotFound if there
+// is no such scheduled item, e.g. because it has already become visible.
+func (c *Queue) Reschedule(id int, at time.Time) error {
+	return c.updateItem(
+		id, c.actor(), TransitionRescheduled,
+		"UPDATE "+c.tables.items+" SET visible_at = ? WHERE id = ? AND state = 'pending' AND visible_at > ?",
+		at.UnixNano(), id, c.cfg.Clock.Now().UnixNano(),
+	)
+}
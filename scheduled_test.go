@@ -0,0 +1,64 @@
+package queue
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestAddAt(t *testing.T) {
+	queue := setupQueue(t, Config{})
+	defer queue.Close()
+
+	later, err := queue.AddAt(time.Now().Add(time.Hour), []byte("later"), "reminders")
+	if err != nil {
+		t.Fatalf("failed to schedule item: %v", err)
+	}
+	soon, err := queue.AddAt(time.Now().Add(time.Minute), []byte("soon"))
+	if err != nil {
+		t.Fatalf("failed to schedule item: %v", err)
+	}
+	if err := queue.Add([]byte("now")); err != nil {
+		t.Fatalf("failed to add item to queue: %v", err)
+	}
+
+	// Only the unscheduled item can be claimed.
+	items, err := queue.Claim(10)
+	if err != nil {
+		t.Fatalf("failed to claim items: %v", err)
+	}
+	if len(items) != 1 || string(items[0].Data) != "now" {
+		t.Fatalf("unexpected items: %+v", items)
+	}
+
+	jobs, err := queue.ScheduledJobs(10)
+	if err != nil {
+		t.Fatalf("failed to list scheduled jobs: %v", err)
+	}
+	if len(jobs) != 2 || jobs[0].ID != soon || jobs[1].ID != later || jobs[1].Tags[0] != "reminders" {
+		t.Fatalf("unexpected scheduled jobs: %+v", jobs)
+	}
+
+	// Moving a job into the past makes it visible right away.
+	if err := queue.Reschedule(later, time.Now().Add(-time.Second)); err != nil {
+		t.Fatalf("failed to reschedule item: %v", err)
+	}
+	if err := queue.Reschedule(later, time.Now().Add(time.Hour)); !errors.Is(err, ErrItemNotFound) {
+		t.Fatalf("expected ErrItemNotFound for a visible item, got %v", err)
+	}
+
+	items, err = queue.Claim(10)
+	if err != nil {
+		t.Fatalf("failed to claim items: %v", err)
+	}
+	if len(items) != 1 || items[0].ID != later {
+		t.Fatalf("unexpected items: %+v", items)
+	}
+
+	if err := queue.Cancel(soon, "not needed", "test"); err != nil {
+		t.Fatalf("failed to cancel scheduled item: %v", err)
+	}
+	if jobs, _ := queue.ScheduledJobs(10); len(jobs) != 0 {
+		t.Fatalf("expected no scheduled jobs, got %+v", jobs)
+	}
+}
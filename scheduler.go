@@ -0,0 +1,239 @@
+package queue
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// schedulerPollInterval is how often idle workers look for items that arrived
+// without a signal, such as expired leases or items added by other processes.
+const schedulerPollInterval = 2 * time.Second
+
+// topic is a queue served by the shared workers of a Manager.
+type topic struct {
+	name    string
+	queue   *Queue
+	handler Handler
+	weight  int // Share of the worker capacity while other topics are busy.
+	current int // Credit of the smooth weighted round-robin.
+}
+
+// scheduler shares the workers of a Manager between its topics with a smooth
+// weighted round-robin: every pick adds each topic's weight to its credit,
+// the topic with the most credit is served and pays back the total weight.
+type scheduler struct {
+	topics []*topic            // Served topics, ordered by name.
+	limits map[string]*limiter // Throttling of the topics, by name; see SetLimits.
+	wake   chan struct{}       // Closed and replaced whenever an item enters a topic or a capped one frees a slot.
+
+	mx sync.Mutex // Guards topics, limits and wake.
+}
+
+// Serve registers h as the handler of the named queue, processed by the
+// shared workers started with Run. While several queues have items waiting,
+// each gets a share of the workers proportional to its weight, so one busy
+// queue cannot starve the others; a weight of 0 or less counts as 1.
+// Registering a name again replaces its handler and weight. Served queues
+// should not have a Listener of their own.
+func (m *Manager) Serve(name string, weight int, h Handler) error {
+	q, err := m.Queue(name)
+	if err != nil {
+		return err
+	}
+
+	s := &m.sched
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	if s.wake == nil {
+		s.wake = make(chan struct{})
+	}
+	for _, t := range s.topics {
+		if t.name == name {
+			t.queue, t.handler, t.weight = q, h, max(weight, 1)
+			return nil
+		}
+	}
+
+	s.topics = append(s.topics, &topic{name: name, queue: q, handler: h, weight: max(weight, 1)})
+	sort.Slice(s.topics, func(i, j int) bool { return s.topics[i].name < s.topics[j].name })
+	go m.watch(q)
+	return nil
+}
+
+// Run processes the queues registered with Serve with 'workers' goroutines
+// until ctx is done or the manager is closed. It returns once every worker
+// has finished the item it was handling.
+func (m *Manager) Run(ctx context.Context, workers int) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-m.ctx.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < max(workers, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m.work(ctx)
+		}()
+	}
+	wg.Wait()
+
+	if m.ctx.Err() != nil {
+		return ErrClosed
+	}
+	return ctx.Err()
+}
+
+// work handles items of the served topics until ctx is done.
+func (m *Manager) work(ctx context.Context) {
+	for ctx.Err() == nil {
+		s := &m.sched
+		s.mx.Lock()
+		wake := s.wake
+		s.mx.Unlock()
+
+		if m.serveNext() {
+			continue
+		}
+
+		// Every topic is empty or throttled; wait for that to change.
+		select {
+		case <-wake:
+		case <-m.cfg.Clock.After(m.sched.nextToken(m.cfg.Clock.Now())):
+		case <-ctx.Done():
+		}
+	}
+}
+
+// serveNext claims an item from the topic whose turn it is and handles it.
+// Throttled topics are skipped. Topics found empty are skipped too and lose
+// their credit, so they do not catch up with a burst once items arrive.
+// It reports whether an item was handled.
+func (m *Manager) serveNext() bool {
+	for _, t := range m.sched.order() {
+		if t.queue.ctx.Err() != nil {
+			continue // The queue was closed.
+		}
+		if t.queue.dispatchWait() > 0 {
+			continue // The topic is in a pause window.
+		}
+		if !m.sched.reserve(t, m.cfg.Clock.Now()) {
+			continue // The topic is at its limits.
+		}
+		// Take the slot before claiming, so the lease does not run out while
+		// waiting for other callbacks to finish.
+		if !t.queue.tryAcquireSlot() {
+			m.sched.unreserve(t)
+			continue // Config.MaxInFlight callbacks are running.
+		}
+
+		items, err := t.queue.claim(1, nil)
+		if err != nil || len(items) == 0 {
+			t.queue.releaseSlot()
+			m.sched.unreserve(t)
+			if err != nil {
+				m.cfg.Logger.Println("Error retrieving item:", err)
+			} else {
+				m.sched.reset(t)
+			}
+			continue
+		}
+
+		m.sched.charge(t)
+		m.serve(t, items[0])
+		return true
+	}
+	return false
+}
+
+// serve hands an item claimed from a topic to its handler, then gives back
+// the slot and the share of the topic even if the handler panics. As in the
+// listener loop of a queue, a panic is logged and the item delivered again.
+func (m *Manager) serve(t *topic, item Item) {
+	defer func() {
+		full := t.queue.slots != nil && len(t.queue.slots) == cap(t.queue.slots)
+		t.queue.releaseSlot()
+		if full {
+			m.sched.signal() // Wake the workers skipping topics for want of a slot.
+		}
+		m.sched.finish(t)
+
+		if r := recover(); r != nil {
+			t.queue.cfg.Logger.Println("Recovered from panic:", r)
+		}
+	}()
+
+	t.queue.handle(item, t.handler)
+}
+
+// order credits every topic with its weight and returns the topics by
+// descending credit, the order in which they are offered a worker.
+func (s *scheduler) order() []*topic {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	topics := make([]*topic, len(s.topics))
+	copy(topics, s.topics)
+	for _, t := range topics {
+		t.current += t.weight
+	}
+	sort.SliceStable(topics, func(i, j int) bool { return topics[i].current > topics[j].current })
+	return topics
+}
+
+// charge makes a topic pay for the worker it was given.
+func (s *scheduler) charge(served *topic) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	total := 0
+	for _, t := range s.topics {
+		total += t.weight
+	}
+	served.current -= total
+}
+
+// reset drops the credit of a topic that had no items.
+func (s *scheduler) reset(t *topic) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	t.current = 0
+}
+
+// signal wakes the idle workers.
+func (s *scheduler) signal() {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	close(s.wake)
+	s.wake = make(chan struct{})
+}
+
+// watch wakes the idle workers whenever an item enters q, until q or the
+// manager is closed.
+func (m *Manager) watch(q *Queue) {
+	for {
+		q.mx.Lock()
+		added := q.added
+		q.mx.Unlock()
+
+		select {
+		case <-added:
+			m.sched.signal()
+		case <-q.ctx.Done():
+			return
+		case <-m.ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package queue
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestManagerWeightedScheduling(t *testing.T) {
+	manager, err := NewManager(Config{})
+	if err != nil {
+		t.Fatalf("failed to initialize manager: %v", err)
+	}
+	defer manager.Close()
+
+	// Fill both queues before serving them so the order only depends on the weights.
+	for name, count := range map[string]int{"busy": 30, "quiet": 10} {
+		q, err := manager.Queue(name)
+		if err != nil {
+			t.Fatalf("failed to open queue: %v", err)
+		}
+		for i := 0; i < count; i++ {
+			if err := q.Add([]byte(name)); err != nil {
+				t.Fatalf("failed to add item to queue: %v", err)
+			}
+		}
+	}
+
+	served := make(chan string, 40)
+	handler := func(item Item, delay func(sec time.Duration)) {
+		served <- string(item.Data)
+	}
+	if err := manager.Serve("busy", 2, handler); err != nil {
+		t.Fatalf("failed to serve queue: %v", err)
+	}
+	if err := manager.Serve("quiet", 1, handler); err != nil {
+		t.Fatalf("failed to serve queue: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- manager.Run(ctx, 1) }()
+
+	counts := make(map[string]int)
+	for i := 0; i < 9; i++ {
+		select {
+		case name := <-served:
+			counts[name]++
+		case <-time.After(3 * time.Second):
+			t.Fatalf("timed out waiting for item %d", i+1)
+		}
+	}
+	if counts["busy"] != 6 || counts["quiet"] != 3 {
+		t.Fatalf("expected a 2:1 split, got %v", counts)
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != context.Canceled {
+			t.Fatalf("expected Run to return the context error, got %v", err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatalf("timed out waiting for Run to return")
+	}
+}
+
+func TestManagerServeWakesOnAdd(t *testing.T) {
+	manager, err := NewManager(Config{})
+	if err != nil {
+		t.Fatalf("failed to initialize manager: %v", err)
+	}
+	defer manager.Close()
+
+	served := make(chan string, 1)
+	err = manager.Serve("emails", 0, func(item Item, delay func(sec time.Duration)) {
+		served <- string(item.Data)
+	})
+	if err != nil {
+		t.Fatalf("failed to serve queue: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go manager.Run(ctx, 2)
+
+	time.Sleep(50 * time.Millisecond) // Let the workers go idle.
+	q, _ := manager.Queue("emails")
+	if err := q.Add([]byte("hello")); err != nil {
+		t.Fatalf("failed to add item to queue: %v", err)
+	}
+
+	select {
+	case data := <-served:
+		if data != "hello" {
+			t.Fatalf("unexpected item %q", data)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expected an idle worker to pick up the item promptly")
+	}
+}
+
+func TestManagerMaxInFlight(t *testing.T) {
+	manager, err := NewManager(Config{MaxInFlight: 1})
+	if err != nil {
+		t.Fatalf("failed to initialize manager: %v", err)
+	}
+	defer manager.Close()
+
+	for _, name := range []string{"emails", "reports"} {
+		q, err := manager.Queue(name)
+		if err != nil {
+			t.Fatalf("failed to open queue: %v", err)
+		}
+		for i := 0; i < 3; i++ {
+			if err := q.Add([]byte(name)); err != nil {
+				t.Fatalf("failed to add item to queue: %v", err)
+			}
+		}
+	}
+
+	var mx sync.Mutex
+	running, peak := 0, 0
+	finished := make(chan struct{}, 6)
+	handler := func(item Item, delay func(sec time.Duration)) {
+		mx.Lock()
+		running++
+		peak = max(peak, running)
+		mx.Unlock()
+
+		time.Sleep(5 * time.Millisecond)
+
+		mx.Lock()
+		running--
+		mx.Unlock()
+		finished <- struct{}{}
+	}
+	for _, name := range []string{"emails", "reports"} {
+		if err := manager.Serve(name, 1, handler); err != nil {
+			t.Fatalf("failed to serve queue: %v", err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go manager.Run(ctx, 4)
+
+	for i := 0; i < 6; i++ {
+		select {
+		case <-finished:
+		case <-time.After(3 * time.Second):
+			t.Fatalf("timed out waiting for item %d", i+1)
+		}
+	}
+
+	mx.Lock()
+	defer mx.Unlock()
+	if peak != 1 {
+		t.Fatalf("expected one callback at a time across the queues, got %d", peak)
+	}
+}
+
+func TestManagerHandlerPanic(t *testing.T) {
+	manager, err := NewManager(Config{MaxInFlight: 1, Logger: &recordingLogger{}})
+	if err != nil {
+		t.Fatalf("failed to initialize manager: %v", err)
+	}
+	defer manager.Close()
+
+	q, err := manager.Queue("emails")
+	if err != nil {
+		t.Fatalf("failed to open queue: %v", err)
+	}
+	if err := q.Add([]byte("boom")); err != nil {
+		t.Fatalf("failed to add item to queue: %v", err)
+	}
+
+	var calls atomic.Int32
+	handled := make(chan struct{})
+	err = manager.Serve("emails", 1, func(item Item, delay func(sec time.Duration)) {
+		if calls.Add(1) == 1 {
+			panic("boom")
+		}
+		close(handled)
+	})
+	if err != nil {
+		t.Fatalf("failed to serve queue: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go manager.Run(ctx, 1)
+
+	// The item comes back, through the only slot, to the only worker.
+	select {
+	case <-handled:
+	case <-time.After(3 * time.Second):
+		t.Fatal("timed out waiting for the item to be delivered again")
+	}
+}
@@ -0,0 +1,363 @@
+package queue
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+// tables holds the names of the tables backing a queue. The auxiliary tables
+// are named after the items table, so several queues can share one database.
+type tables struct {
+	items         string // Queued items.
+	debug         string // Transition snapshots recorded in debug mode.
+	cancellations string // Log of cancelled items.
+	mirror        string // Outbox of items not yet copied to the mirror queue.
+	events        string // Change feed of item transitions.
+	cron          string // Recurring jobs registered with AddCron.
+	results       string // Results stored when items are acknowledged.
+	messages      string // Log of messages published to the subscribers.
+	subscribers   string // Cursors of the durable subscribers and consumer groups.
+	deliveries    string // Messages claimed or handled by consumer groups.
+	chunks        string // Tails of payloads split by Config.ChunkSize.
+	blobs         string // Offloaded payloads of removed items, still to be deleted from Config.Offload.
+	audit         string // Append-only log of the operations performed on items.
+	subjects      string // Index of items by the data subject named in their tags.
+	windows       string // Recurring pause windows registered with AddPauseWindow.
+	processed     string // Keys of the items processed with ExactlyOnce.
+	history       string // Copies of the processed items kept for Replay.
+}
+
+// newTables derives the table names from the name of the items table.
+func newTables(name string) tables {
+	return tables{
+		items:         name,
+		debug:         name + "_debug",
+		cancellations: name + "_cancellations",
+		mirror:        name + "_mirror",
+		events:        name + "_events",
+		cron:          name + "_cron",
+		results:       name + "_results",
+		messages:      name + "_messages",
+		subscribers:   name + "_subscribers",
+		deliveries:    name + "_deliveries",
+		chunks:        name + "_chunks",
+		blobs:         name + "_blobs",
+		audit:         name + "_audit",
+		subjects:      name + "_subjects",
+		windows:       name + "_windows",
+		processed:     name + "_processed",
+		history:       name + "_history",
+	}
+}
+
+// validTableName matches names that are safe to splice into SQL statements.
+var validTableName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// versionTable stores the schema version of every queue in the database.
+const versionTable = "queue_schema"
+
+// migration upgrades the schema by one version.
+type migration struct {
+	version     int                              // Schema version after the migration is applied.
+	description string                           // Short summary of the change.
+	up          func(tx *sql.Tx, t tables) error // Applies the change.
+}
+
+// migrations lists every schema change in the order it must be applied.
+// Databases created before versioning was introduced report version 0 but may
+// already contain some of these changes, so migrations must be idempotent.
+// Append new migrations at the end and never modify released ones.
+var migrations = []migration{
+	{version: 1, description: "create queue table", up: func(tx *sql.Tx, t tables) error {
+		_, err := tx.Exec(`
+            CREATE TABLE IF NOT EXISTS ` + t.items + ` (
+                id INTEGER PRIMARY KEY AUTOINCREMENT,
+                data BLOB NOT NULL
+            );
+        `)
+		return err
+	}},
+	{version: 2, description: "add tags column", up: func(tx *sql.Tx, t tables) error {
+		return addColumn(tx, t.items, "tags", "TEXT")
+	}},
+	{version: 3, description: "create debug snapshot table", up: createDebugTable},
+	{version: 4, description: "create cancellation log table", up: createCancelTable},
+	{version: 5, description: "add claim state columns", up: func(tx *sql.Tx, t tables) error {
+		if err := addColumn(tx, t.items, "state", "TEXT NOT NULL DEFAULT 'pending'"); err != nil {
+			return err
+		}
+		if err := addColumn(tx, t.items, "owner", "TEXT"); err != nil {
+			return err
+		}
+		return addColumn(tx, t.items, "lease_until", "INTEGER")
+	}},
+	{version: 6, description: "add attempts column", up: func(tx *sql.Tx, t tables) error {
+		return addColumn(tx, t.items, "attempts", "INTEGER NOT NULL DEFAULT 0")
+	}},
+	{version: 7, description: "add priority column", up: func(tx *sql.Tx, t tables) error {
+		return addColumn(tx, t.items, "priority", "INTEGER NOT NULL DEFAULT 0")
+	}},
+	{version: 8, description: "create mirror outbox table", up: createMirrorTable},
+	{version: 9, description: "add dead_at column", up: func(tx *sql.Tx, t tables) error {
+		return addColumn(tx, t.items, "dead_at", "INTEGER")
+	}},
+	{version: 10, description: "create change feed table", up: createEventsTable},
+	{version: 11, description: "create cron table", up: createCronTable},
+	{version: 12, description: "add visible_at column", up: func(tx *sql.Tx, t tables) error {
+		return addColumn(tx, t.items, "visible_at", "INTEGER")
+	}},
+	{version: 13, description: "create results table", up: createResultsTable},
+	{version: 14, description: "add result error column", up: func(tx *sql.Tx, t tables) error {
+		return addColumn(tx, t.results, "error", "TEXT")
+	}},
+	{version: 15, description: "add progress columns", up: func(tx *sql.Tx, t tables) error {
+		if err := addColumn(tx, t.items, "progress", "INTEGER"); err != nil {
+			return err
+		}
+		if err := addColumn(tx, t.items, "progress_message", "TEXT"); err != nil {
+			return err
+		}
+		return addColumn(tx, t.items, "progress_at", "INTEGER")
+	}},
+	{version: 16, description: "create pub-sub tables", up: createPubSubTables},
+	{version: 17, description: "create consumer group deliveries table", up: createDeliveriesTable},
+	{version: 18, description: "add crash columns", up: func(tx *sql.Tx, t tables) error {
+		if err := addColumn(tx, t.items, "crashes", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+			return err
+		}
+		return addColumn(tx, t.items, "failure", "TEXT")
+	}},
+	{version: 19, description: "create payload chunks table", up: createChunksTable},
+	{version: 20, description: "create offloaded payloads table", up: createBlobsTable},
+	{version: 21, description: "add streamed column", up: func(tx *sql.Tx, t tables) error {
+		return addColumn(tx, t.items, "streamed", "INTEGER NOT NULL DEFAULT 0")
+	}},
+	{version: 22, description: "add checksum column", up: func(tx *sql.Tx, t tables) error {
+		return addColumn(tx, t.items, "checksum", "INTEGER")
+	}},
+	{version: 23, description: "create audit log", up: createAuditTable},
+	{version: 24, description: "create data subject index", up: createSubjectsTable},
+	{version: 25, description: "add tenant column", up: func(tx *sql.Tx, t tables) error {
+		return addColumn(tx, t.items, "tenant", "TEXT")
+	}},
+	{version: 26, description: "create pause windows table", up: createWindowsTable},
+	{version: 27, description: "add version column", up: createVersionTrigger},
+	{version: 28, description: "add receipt column", up: func(tx *sql.Tx, t tables) error {
+		return addColumn(tx, t.items, "receipt", "TEXT")
+	}},
+	{version: 29, description: "create processed keys table", up: createProcessedTable},
+	{version: 30, description: "add expires_at column", up: func(tx *sql.Tx, t tables) error {
+		return addColumn(tx, t.items, "expires_at", "INTEGER")
+	}},
+	{version: 31, description: "add headers and dedup_key columns", up: addHeaderColumns},
+	{version: 32, description: "add key_id column", up: addKeyIDColumn},
+	{version: 33, description: "add job_type column", up: addJobTypeColumn},
+	{version: 34, description: "create processing history table", up: createHistoryTable},
+	{version: 35, description: "add add-option columns to the mirror outbox", up: addMirrorOptionColumns},
+	{version: 36, description: "add key_id column to the mirror outbox", up: addMirrorKeyIDColumn},
+	{version: 37, description: "index data subjects named in headers", up: indexSubjectHeaders},
+	{version: 38, description: "add key_id column to the cancellations", up: addCancelKeyIDColumn},
+}
+
+// SchemaVersionError is returned when a database was written by a newer
+// version of the package than the one opening it.
+type SchemaVersionError struct {
+	Found     int // Schema version stored in the database.
+	Supported int // Latest schema version this package knows.
+}
+
+func (e *SchemaVersionError) Error() string {
+	return fmt.Sprintf("queue: database schema version %d is newer than the supported version %d", e.Found, e.Supported)
+}
+
+// initSchema applies pending migrations and creates the secondary indexes.
+func initSchema(db *sql.DB, cfg Config) error {
+	t := newTables(cfg.Table)
+
+	if err := migrate(db, t); err != nil {
+		return err
+	}
+
+	// Create or migrate the secondary indexes unless disabled.
+	if !cfg.DisableAutoIndex {
+		if err := createIndexes(db, t); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// migrate brings the schema of the queue to the latest version, applying each
+// pending migration in its own transaction together with the version bump.
+// It refuses to touch databases whose version is newer than the latest migration.
+func migrate(db *sql.DB, t tables) error {
+	current, err := schemaVersion(db, t)
+	if err != nil {
+		return err
+	}
+
+	latest := migrations[len(migrations)-1].version
+	if current > latest {
+		return &SchemaVersionError{Found: current, Supported: latest}
+	}
+
+	for _, m := range migrations {
+		if m.version <= current {
+			continue // Already applied.
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		if err := m.up(tx, t); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("queue: migration %d (%s): %w", m.version, m.description, err)
+		}
+		_, err = tx.Exec(
+			"INSERT INTO "+versionTable+"(`name`, `version`) VALUES (?, ?) ON CONFLICT(`name`) DO UPDATE SET `version` = excluded.`version`",
+			t.items, m.version,
+		)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// schemaVersion returns the schema version of the queue, creating the version
+// table on first use. Queues named "queue" fall back to PRAGMA user_version,
+// where versions were kept before table names became configurable.
+func schemaVersion(db *sql.DB, t tables) (int, error) {
+	_, err := db.Exec(`
+        CREATE TABLE IF NOT EXISTS ` + versionTable + ` (
+            name TEXT PRIMARY KEY,
+            version INTEGER NOT NULL
+        );
+    `)
+	if err != nil {
+		return 0, err
+	}
+
+	return storedSchemaVersion(db, t)
+}
+
+// storedSchemaVersion returns the schema version recorded for the queue,
+// 0 if there is none, without writing to db.
+func storedSchemaVersion(db *sql.DB, t tables) (int, error) {
+	var tables int
+	err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?", versionTable).Scan(&tables)
+	if err != nil {
+		return 0, err
+	}
+
+	var version int
+	err = sql.ErrNoRows
+	if tables > 0 {
+		err = db.QueryRow("SELECT `version` FROM "+versionTable+" WHERE name = ?", t.items).Scan(&version)
+	}
+	switch {
+	case errors.Is(err, sql.ErrNoRows) && t.items == "queue":
+		err = db.QueryRow("PRAGMA user_version").Scan(&version)
+	case errors.Is(err, sql.ErrNoRows):
+		err = nil
+	}
+	return version, err
+}
+
+// addColumn adds a column to an existing table unless it is already present.
+func addColumn(tx *sql.Tx, table, column, definition string) error {
+	exists, err := columnExists(tx, table, column)
+	if err != nil || exists {
+		return err
+	}
+
+	_, err = tx.Exec("ALTER TABLE " + table + " ADD COLUMN " + column + " " + definition)
+	return err
+}
+
+// columnExists reports whether the table has a column with the given name.
+func columnExists(tx *sql.Tx, table, column string) (bool, error) {
+	rows, err := tx.Query("SELECT `name` FROM pragma_table_info(?)", table)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close() // Ensure rows are closed after processing.
+
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return false, err
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
+}
+
+// index describes a secondary index maintained by the queue.
+type index struct {
+	name    string // Name of the index.
+	table   string // Table the index belongs to.
+	columns string // Comma-separated indexed columns, in order.
+}
+
+// indexes lists the secondary indexes the queries rely on. Columns used to
+// select and order items for claiming belong here as they are introduced.
+func indexes(t tables) []index {
+	return []index{
+		{name: t.items + "_state_id", table: t.items, columns: "state, priority DESC, id, visible_at"},
+		{name: t.items + "_state_lease_until", table: t.items, columns: "state, lease_until"},
+		{name: t.debug + "_item_id", table: t.debug, columns: "item_id"},
+		{name: t.items + "_tenant_state", table: t.items, columns: "tenant, state"},
+		{name: t.items + "_expires_at", table: t.items, columns: "expires_at"},
+	}
+}
+
+// definition returns the statement creating the index.
+func (i index) definition() string {
+	return "CREATE INDEX " + i.name + " ON " + i.table + "(" + i.columns + ")"
+}
+
+// createIndexes creates missing indexes and rebuilds those whose definition changed.
+func createIndexes(db *sql.DB, t tables) error {
+	for _, i := range indexes(t) {
+		var existing string
+		err := db.QueryRow("SELECT `sql` FROM sqlite_master WHERE type = 'index' AND name = ?", i.name).Scan(&existing)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+		case err != nil:
+			return err
+		case existing == i.definition():
+			continue // The index is up to date.
+		default:
+			// The definition changed, rebuild the index.
+			if _, err := db.Exec("DROP INDEX " + i.name); err != nil {
+				return err
+			}
+		}
+
+		if _, err := db.Exec(i.definition()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CreateIndexes creates or migrates the secondary indexes used by the queue.
+// New calls it automatically unless Config.DisableAutoIndex is set, in which
+// case operators can run it at a convenient time, e.g. during a maintenance window.
+func (c *Queue) CreateIndexes() error {
+	c.mx.Lock() // Lock for exclusive access to the queue.
+	defer c.mx.Unlock()
+
+	return createIndexes(c.db, c.tables)
+}
@@ -0,0 +1,138 @@
+package queue
+
+import (
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCreateIndexes(t *testing.T) {
+	queue := setupQueue(t, Config{DisableAutoIndex: true})
+	defer queue.Close()
+
+	countIndexes := func() int {
+		var count int
+		err := queue.db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'index' AND name = ?", indexes(queue.tables)[0].name).Scan(&count)
+		if err != nil {
+			t.Fatalf("failed to count indexes: %v", err)
+		}
+		return count
+	}
+
+	if countIndexes() != 0 {
+		t.Fatalf("expected no index with DisableAutoIndex")
+	}
+
+	// Creating indexes is idempotent.
+	for i := 0; i < 2; i++ {
+		if err := queue.CreateIndexes(); err != nil {
+			t.Fatalf("failed to create indexes: %v", err)
+		}
+	}
+	if countIndexes() != 1 {
+		t.Fatalf("expected index to be created")
+	}
+}
+
+func TestCreateIndexesRebuildsChangedIndexes(t *testing.T) {
+	queue := setupQueue(t, Config{DisableAutoIndex: true})
+	defer queue.Close()
+
+	// Simulate the claim index of an older release, without visible_at.
+	claim := indexes(queue.tables)[0]
+	if _, err := queue.db.Exec("CREATE INDEX " + claim.name + " ON " + claim.table + "(state, priority DESC, id)"); err != nil {
+		t.Fatalf("failed to create the old index: %v", err)
+	}
+	if err := queue.CreateIndexes(); err != nil {
+		t.Fatalf("failed to create indexes: %v", err)
+	}
+
+	for _, i := range indexes(queue.tables) {
+		var definition string
+		if err := queue.db.QueryRow("SELECT `sql` FROM sqlite_master WHERE type = 'index' AND name = ?", i.name).Scan(&definition); err != nil {
+			t.Fatalf("failed to read index %s: %v", i.name, err)
+		}
+		if definition != i.definition() {
+			t.Fatalf("expected index %s to be rebuilt as %q, got %q", i.name, i.definition(), definition)
+		}
+	}
+
+	var id, parent, unused int
+	var plan string
+	query := "EXPLAIN QUERY PLAN SELECT id FROM " + queue.tables.items + " WHERE state = 'in-flight' AND lease_until < ?"
+	if err := queue.db.QueryRow(query, 0).Scan(&id, &parent, &unused, &plan); err != nil {
+		t.Fatalf("failed to explain the lease query: %v", err)
+	}
+	if !strings.Contains(plan, queue.tables.items+"_state_lease_until") {
+		t.Fatalf("expected expired leases to be found through the lease index, got %q", plan)
+	}
+}
+
+func TestMigrations(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.db")
+
+	// Simulate a database written before tags and versioning existed.
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	if _, err := db.Exec("CREATE TABLE queue (id INTEGER PRIMARY KEY AUTOINCREMENT, data BLOB NOT NULL); INSERT INTO queue(data) VALUES ('legacy')"); err != nil {
+		t.Fatalf("failed to create legacy schema: %v", err)
+	}
+	db.Close()
+
+	queue := setupQueue(t, Config{LocalFile: path})
+	if err := queue.AddTagged([]byte("new"), "tag"); err != nil {
+		t.Fatalf("failed to add item to upgraded queue: %v", err)
+	}
+
+	var version int
+	if err := queue.db.QueryRow("SELECT version FROM queue_schema WHERE name = 'queue'").Scan(&version); err != nil {
+		t.Fatalf("failed to read schema version: %v", err)
+	}
+	if latest := migrations[len(migrations)-1].version; version != latest {
+		t.Fatalf("expected schema version %d, got %d", latest, version)
+	}
+
+	// Pretend a newer release wrote the file.
+	if _, err := queue.db.Exec("UPDATE queue_schema SET version = 1000 WHERE name = 'queue'"); err != nil {
+		t.Fatalf("failed to bump schema version: %v", err)
+	}
+	queue.Close()
+
+	var versionErr *SchemaVersionError
+	if _, err := New(Config{LocalFile: path}); !errors.As(err, &versionErr) || versionErr.Found != 1000 {
+		t.Fatalf("expected SchemaVersionError, got %v", err)
+	}
+}
+
+func TestSharedDatabaseTables(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.db")
+
+	emails := setupQueue(t, Config{LocalFile: path, Table: "emails"})
+	defer emails.Close()
+	reports := setupQueue(t, Config{LocalFile: path, Table: "reports"})
+	defer reports.Close()
+
+	if err := emails.Add([]byte("email")); err != nil {
+		t.Fatalf("failed to add item to queue: %v", err)
+	}
+	if err := reports.Add([]byte("report")); err != nil {
+		t.Fatalf("failed to add item to queue: %v", err)
+	}
+
+	items, err := emails.Get(10)
+	if err != nil || len(items) != 1 || string(items[0].Data) != "email" {
+		t.Fatalf("unexpected emails items: %+v, %v", items, err)
+	}
+	items, err = reports.Get(10)
+	if err != nil || len(items) != 1 || string(items[0].Data) != "report" {
+		t.Fatalf("unexpected reports items: %+v, %v", items, err)
+	}
+
+	if _, err := New(Config{Table: "bad name; DROP TABLE emails"}); err == nil {
+		t.Fatalf("expected an error for an invalid table name")
+	}
+}
@@ -0,0 +1,91 @@
+package queue
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"strings"
+	"time"
+)
+
+// View is a read-only, point-in-time view of the queue taken by Snapshot.
+// Its reads all see the queue as it was when the view was taken, while
+// producers and consumers keep changing the live queue, so for example the
+// counts of Stats add up with the items listed by Browse. A View holds a
+// database connection and keeps the WAL file from being checkpointed past it, so it
+// must be released with Close as soon as possible. It is not safe for
+// concurrent use.
+type View struct {
+	c       *Queue
+	ctx     context.Context
+	tx      *sql.Tx
+	at      time.Time // When the view was taken, for telling pending and scheduled items apart.
+	latency Latency   // Latency of the listeners when the view was taken.
+}
+
+// Snapshot takes a point-in-time view of the queue, valid until Close is
+// called or ctx is done. Only WAL mode lets readers and writers work at the
+// same time, so Snapshot returns ErrNoSnapshots unless
+// Config.JournalMode is "WAL" and Config.MaxOpenConns allows more than one
+// connection.
+func (c *Queue) Snapshot(ctx context.Context) (*View, error) {
+	if !strings.EqualFold(c.cfg.JournalMode, "WAL") || c.cfg.MaxOpenConns == 1 {
+		return nil, ErrNoSnapshots
+	}
+
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite only fixes the view of a transaction at its first read.
+	var tables int
+	if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM sqlite_master").Scan(&tables); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	now := c.cfg.Clock.Now()
+	return &View{c: c, ctx: ctx, tx: tx, at: now, latency: c.latency.summary(now)}, nil
+}
+
+// At returns when the view was taken.
+func (s *View) At() time.Time {
+	return s.at
+}
+
+// Stats returns the number of items in each state and the total payload size
+// as of the view; see Queue.Stats.
+func (s *View) Stats() (Stats, error) {
+	stats, err := s.c.stats(s.ctx, s.tx)
+	if err != nil {
+		return Stats{}, err
+	}
+	stats.Latency = s.latency
+	return stats, nil
+}
+
+// Browse returns up to 'limit' items in the given state as of the view,
+// oldest first, starting after 'cursor'; see Admin.ListByState. Paging
+// through a view neither skips nor repeats items, however the live queue
+// changes meanwhile.
+func (s *View) Browse(state State, limit, cursor int) ([]Item, int, error) {
+	items, err := s.c.listItems(s.ctx, s.tx, state, limit, cursor, s.at)
+	if err != nil || len(items) < limit {
+		return items, 0, err
+	}
+	return items, items[len(items)-1].ID, nil
+}
+
+// Export streams every item of the view to w in the given format; see
+// Queue.Export.
+func (s *View) Export(w io.Writer, format Format) error {
+	return s.c.export(s.ctx, s.tx, w, format)
+}
+
+// Close releases the view. It is safe to call more than once.
+func (s *View) Close() error {
+	if err := s.tx.Rollback(); err != nil && err != sql.ErrTxDone {
+		return err
+	}
+	return nil
+}
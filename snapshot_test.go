@@ -0,0 +1,80 @@
+package queue
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestSnapshot(t *testing.T) {
+	queue := setupQueue(t, Config{LocalFile: t.TempDir() + "/queue.db", JournalMode: "WAL"})
+	defer queue.Close()
+
+	for i := 0; i < 3; i++ {
+		if err := queue.Add([]byte("test data")); err != nil {
+			t.Fatalf("failed to add item to queue: %v", err)
+		}
+	}
+
+	view, err := queue.Snapshot(context.Background())
+	if err != nil {
+		t.Fatalf("failed to take snapshot: %v", err)
+	}
+	defer view.Close()
+
+	// The live queue keeps changing after the snapshot.
+	if err := queue.Add([]byte("later")); err != nil {
+		t.Fatalf("failed to add item to queue: %v", err)
+	}
+	if _, err := queue.Claim(2); err != nil {
+		t.Fatalf("failed to claim items: %v", err)
+	}
+
+	stats, err := view.Stats()
+	if err != nil {
+		t.Fatalf("failed to get snapshot stats: %v", err)
+	}
+	if stats.Pending != 3 || stats.InFlight != 0 {
+		t.Fatalf("expected 3 pending items in the snapshot, got %+v", stats)
+	}
+
+	items, cursor, err := view.Browse(StatePending, 2, 0)
+	if err != nil || len(items) != 2 || cursor == 0 {
+		t.Fatalf("expected a first page of 2 items, got %d items, cursor %d, %v", len(items), cursor, err)
+	}
+	items, cursor, err = view.Browse(StatePending, 2, cursor)
+	if err != nil || len(items) != 1 || cursor != 0 || string(items[0].Data) != "test data" {
+		t.Fatalf("expected a last page of 1 item, got %+v, cursor %d, %v", items, cursor, err)
+	}
+
+	var buf bytes.Buffer
+	if err := view.Export(&buf, FormatJSONLines); err != nil {
+		t.Fatalf("failed to export snapshot: %v", err)
+	}
+	if lines := strings.Count(buf.String(), "\n"); lines != 3 {
+		t.Fatalf("expected 3 exported items, got %d", lines)
+	}
+
+	live, err := queue.Stats()
+	if err != nil || live.Pending != 2 || live.InFlight != 2 {
+		t.Fatalf("expected the live queue to have moved on, got %+v, %v", live, err)
+	}
+
+	if err := view.Close(); err != nil {
+		t.Fatalf("failed to close snapshot: %v", err)
+	}
+	if err := view.Close(); err != nil {
+		t.Fatalf("expected closing twice to succeed, got %v", err)
+	}
+}
+
+func TestSnapshotUnsupported(t *testing.T) {
+	queue := setupQueue(t, Config{})
+	defer queue.Close()
+
+	if _, err := queue.Snapshot(context.Background()); !errors.Is(err, ErrNoSnapshots) {
+		t.Fatalf("expected ErrNoSnapshots, got %v", err)
+	}
+}
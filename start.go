@@ -0,0 +1,62 @@
+package queue
+
+// Start starts the workers delivering items to the listeners, Config.Workers
+// of them. New calls it unless Config.ManualStart is set, in which case
+// registering every listener before calling Start guarantees that no item is
+// claimed before the listener meant for it is in place, e.g. while tag
+// listeners are registered one by one. Calling Start again has no effect.
+func (c *Queue) Start() {
+	if !c.started.CompareAndSwap(false, true) {
+		return
+	}
+	for i := 0; i < c.cfg.Workers; i++ {
+		go c.process()
+	}
+}
+
+// signalRegistered wakes up the workers waiting for a listener. It must be
+// called with the queue locked.
+func (c *Queue) signalRegistered() {
+	close(c.registered)
+	c.registered = make(chan struct{})
+}
+
+// listening reports whether a listener the workers deliver to is registered.
+// It must be called with the queue locked.
+func (c *Queue) listening() bool {
+	return c.clb != nil || len(c.tagged) > 0 || len(c.handlers) > 0 || c.batch != nil
+}
+
+// StopProcessing halts the workers without closing the queue, e.g. while a
+// bulk import or a migration runs: Add, Get, Claim and the Admin operations
+// keep working, but no item is handed to the listeners until
+// StartProcessing. It returns once the items already handed out are
+// processed, and releases the items claimed ahead by Config.ClaimBatchSize.
+// Subscribers and group consumers are not affected. It must not be called
+// from a listener, as it would wait for that listener to return.
+func (c *Queue) StopProcessing() {
+	c.stopped.Store(true)
+
+	// Wait for the workers to finish the items they claimed.
+	c.running.Lock()
+	c.running.Unlock()
+	c.releasePrefetched()
+}
+
+// StartProcessing resumes the workers halted by StopProcessing. Unlike
+// Start, it does not start workers that never ran.
+func (c *Queue) StartProcessing() {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	if c.stopped.CompareAndSwap(true, false) {
+		close(c.resumed)
+		c.resumed = make(chan struct{})
+	}
+}
+
+// Processing reports whether the workers hand items to the listeners, that
+// is StopProcessing was not called or StartProcessing resumed them.
+func (c *Queue) Processing() bool {
+	return !c.stopped.Load()
+}
@@ -0,0 +1,127 @@
+package queue
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestManualStart(t *testing.T) {
+	queue := setupQueue(t, Config{ManualStart: true})
+	defer queue.Close()
+
+	if err := queue.Add([]byte("test data")); err != nil {
+		t.Fatalf("failed to add item to queue: %v", err)
+	}
+
+	delivered := make(chan Item, 1)
+	queue.Listener(func(item Item, delay func(sec time.Duration)) {
+		delivered <- item
+	})
+
+	select {
+	case item := <-delivered:
+		t.Fatalf("expected no delivery before Start, got %+v", item)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	queue.Start()
+	queue.Start() // Starting again has no effect.
+	select {
+	case item := <-delivered:
+		if string(item.Data) != "test data" {
+			t.Fatalf("expected the added item, got %+v", item)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected the item to be delivered after Start")
+	}
+}
+
+func TestListenerAfterNew(t *testing.T) {
+	queue := setupQueue(t, Config{Workers: 4})
+	defer queue.Close()
+
+	if err := queue.Add([]byte("test data")); err != nil {
+		t.Fatalf("failed to add item to queue: %v", err)
+	}
+
+	// The workers already wait for a listener; registering one wakes them up.
+	delivered := make(chan Item, 1)
+	queue.Listener(func(item Item, delay func(sec time.Duration)) {
+		delivered <- item
+	})
+
+	select {
+	case <-delivered:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected the item to be delivered once a listener was registered")
+	}
+	if err := queue.Health(context.Background()); err != nil {
+		t.Fatalf("expected a healthy queue, got %v", err)
+	}
+}
+
+func TestStopProcessing(t *testing.T) {
+	queue := setupQueue(t, Config{})
+	defer queue.Close()
+
+	started := make(chan struct{})
+	unblock := make(chan struct{})
+	delivered := make(chan Item, 2)
+	queue.Listener(func(item Item, delay func(sec time.Duration)) {
+		if string(item.Data) == "slow" {
+			close(started)
+			<-unblock
+		}
+		delivered <- item
+	})
+
+	if err := queue.Add([]byte("slow")); err != nil {
+		t.Fatalf("failed to add item to queue: %v", err)
+	}
+	<-started
+
+	// StopProcessing waits for the item being processed.
+	stopped := make(chan struct{})
+	go func() {
+		queue.StopProcessing()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		t.Fatalf("expected StopProcessing to wait for the running listener")
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(unblock)
+	<-stopped
+	<-delivered
+
+	if queue.Processing() {
+		t.Fatalf("expected processing to be stopped")
+	}
+	if err := queue.Add([]byte("test data")); err != nil {
+		t.Fatalf("failed to add item while stopped: %v", err)
+	}
+	select {
+	case item := <-delivered:
+		t.Fatalf("expected no delivery while stopped, got %+v", item)
+	case <-time.After(200 * time.Millisecond):
+	}
+	items, err := queue.Get(10)
+	if err != nil || len(items) != 1 {
+		t.Fatalf("expected the item to wait in the queue, got %+v, %v", items, err)
+	}
+	if err := queue.Health(context.Background()); err != nil {
+		t.Fatalf("expected a stopped queue to be healthy, got %v", err)
+	}
+
+	queue.StartProcessing()
+	select {
+	case item := <-delivered:
+		if string(item.Data) != "test data" {
+			t.Fatalf("expected the added item, got %+v", item)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected the item to be delivered after StartProcessing")
+	}
+}
@@ -0,0 +1,253 @@
+package queue
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+)
+
+// State describes where an item is in its lifecycle.
+//
+// An item is added pending, or scheduled if it is hidden until a later time,
+// and scheduled items become pending once their time comes. A listener or
+// Claim moves a pending item in flight, from where it is acknowledged and
+// done, handed back to pending or scheduled for another attempt, moved to
+// the dead letters once it used up its attempts, or quarantined. Dead and
+// quarantined items stay until they are requeued to pending or removed.
+// Items removed without being processed, e.g. cancelled, expired or
+// deleted, have failed. Done and failed are terminal: the item leaves the
+// queue, so no item is ever stored or listed in them. The operations moving
+// items between states are the Transition constants; see CanTransition.
+type State string
+
+const (
+	StatePending   State = "pending"   // Waiting to be handed to a listener.
+	StateScheduled State = "scheduled" // Pending, but hidden until a later time; stored as pending with a future visible_at.
+	StateInFlight  State = "in-flight" // Currently being processed by a listener.
+	StateDead      State = "dead"      // Used up its attempts; kept until requeued or deleted.
+	StateDone      State = "done"      // Acknowledged or consumed; terminal, the item left the queue.
+	StateFailed    State = "failed"    // Removed without being processed; terminal, the item left the queue.
+
+	StateQuarantined State = "quarantined" // Crashed or timed out its listener too often, or its payload is corrupted; kept until released or deleted.
+)
+
+// Terminal reports whether s is StateDone or StateFailed, which no
+// transition leaves.
+func (s State) Terminal() bool {
+	return s == StateDone || s == StateFailed
+}
+
+// stateAbsent stands for the absence of an item in lifecycle, for the
+// transition that adds it.
+const stateAbsent State = ""
+
+// anyState lists the states stored for items.
+var anyState = []State{StatePending, StateInFlight, StateDead, StateQuarantined}
+
+// lifecycle lists the states each transition applies to and the state it
+// leaves the item in, or whether it keeps the state.
+var lifecycle = map[string]struct {
+	from []State
+	to   State
+	keep bool
+}{
+	TransitionEnqueued:      {from: []State{stateAbsent}, to: StatePending},
+	TransitionClaimed:       {from: []State{StatePending, StateInFlight}, to: StateInFlight}, // From in flight once the lease expired.
+	TransitionReleased:      {from: []State{StateInFlight}, to: StatePending},
+	TransitionDeadLettered:  {from: []State{StatePending, StateInFlight}, to: StateDead},
+	TransitionQuarantined:   {from: []State{StatePending, StateInFlight}, to: StateQuarantined},
+	TransitionRequeued:      {from: []State{StateDead}, to: StatePending},
+	TransitionUnquarantined: {from: []State{StateQuarantined}, to: StatePending},
+	TransitionRescheduled:   {from: []State{StatePending}, to: StatePending},
+	TransitionReset:         {from: anyState, keep: true},
+	TransitionReprioritized: {from: anyState, keep: true},
+	TransitionRedacted:      {from: anyState, keep: true},
+	TransitionUpdated:       {from: []State{StatePending, StateDead, StateQuarantined}, keep: true}, // Not while a consumer holds the item.
+	TransitionAcked:         {from: []State{StateInFlight}, to: StateDone},
+	TransitionConsumed:      {from: []State{StateInFlight}, to: StateDone},
+	TransitionExpired:       {from: []State{StatePending, StateInFlight}, to: StateFailed}, // From in flight once the lease expired.
+	TransitionCancelled:     {from: []State{StatePending, StateInFlight}, to: StateFailed}, // From in flight once the lease expired.
+	TransitionEvicted:       {from: []State{StatePending}, to: StateFailed},
+	TransitionArchived:      {from: []State{StateDead}, to: StateFailed},
+	TransitionDeleted:       {from: anyState, to: StateFailed},
+	TransitionErased:        {from: anyState, to: StateFailed},
+}
+
+// CanTransition reports whether the lifecycle allows the transition, one of
+// the Transition constants, for an item in state from. Scheduled items count
+// as pending.
+func CanTransition(from State, transition string) bool {
+	if from == StateScheduled {
+		from = StatePending
+	}
+	rule, ok := lifecycle[transition]
+	return ok && slices.Contains(rule.from, from)
+}
+
+// TransitionError reports an operation that would have moved an item
+// between states the lifecycle does not connect. The operation is rolled
+// back.
+type TransitionError struct {
+	ID         int    // Identifier of the item.
+	Transition string // Attempted transition, e.g. TransitionRequeued.
+	From       State  // State of the item before the operation; empty for bulk operations, which select items by the states the transition applies to.
+	To         State  // State the operation left the item in.
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("queue: illegal transition %s of item %d from %s to %s", e.Transition, e.ID, e.From, e.To)
+}
+
+// Is reports whether target is ErrIllegalTransition.
+func (e *TransitionError) Is(target error) bool {
+	return target == ErrIllegalTransition
+}
+
+// checkTransition returns a *TransitionError unless the lifecycle allows the
+// transition to move an item from one state to the other.
+func checkTransition(id int, transition string, from, to State) error {
+	rule, ok := lifecycle[transition]
+	want := rule.to
+	if rule.keep {
+		want = from
+	}
+	if !ok || !slices.Contains(rule.from, from) || to != want {
+		return &TransitionError{ID: id, Transition: transition, From: from, To: to}
+	}
+	return nil
+}
+
+// enforceTransition checks, within the transaction that performed it, that
+// a transition left an item in a state the lifecycle allows, so a faulty
+// statement fails and is rolled back instead of corrupting the item.
+func (c *Queue) enforceTransition(tx *sql.Tx, id int, transition string, from State) error {
+	to, err := c.stateAfter(tx, id, transition)
+	if err != nil {
+		return err
+	}
+	return checkTransition(id, transition, from, to)
+}
+
+// enforceOutcome checks, within the transaction of a bulk statement, that
+// the transition left each of the items it returned in the state the
+// lifecycle leads to. The statements select the items by the states the
+// transition applies to, so only the outcome is checked.
+func (c *Queue) enforceOutcome(tx *sql.Tx, transition string, items []Item) error {
+	for _, item := range items {
+		to, err := c.stateAfter(tx, item.ID, transition)
+		if err != nil {
+			return err
+		}
+		if rule := lifecycle[transition]; rule.keep || to != rule.to {
+			return &TransitionError{ID: item.ID, Transition: transition, To: to}
+		}
+	}
+	return nil
+}
+
+// stateAfter reads the state a transition left an item in. An item no
+// longer stored is in the terminal state the transition leads to, if any.
+func (c *Queue) stateAfter(tx *sql.Tx, id int, transition string) (State, error) {
+	to, err := c.itemState(tx, id)
+	if rule := lifecycle[transition]; err == nil && to == stateAbsent && rule.to.Terminal() {
+		to = rule.to
+	}
+	return to, err
+}
+
+// execTransition runs a statement moving an item in tx and checks that the
+// lifecycle allows the transition; see enforceTransition. It reports
+// whether the statement changed the item.
+func (c *Queue) execTransition(tx *sql.Tx, id int, transition string, stmt *sql.Stmt, args ...any) (bool, error) {
+	from, err := c.itemState(tx, id)
+	if err != nil {
+		return false, err
+	}
+
+	res, err := tx.Stmt(stmt).Exec(args...)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil || n == 0 {
+		return false, err
+	}
+	return true, c.enforceTransition(tx, id, transition, from)
+}
+
+// itemState reads the stored state of an item, or stateAbsent if it does
+// not exist.
+func (c *Queue) itemState(tx *sql.Tx, id int) (State, error) {
+	var state State
+	err := tx.QueryRow("SELECT state FROM "+c.tables.items+" WHERE id = ?", id).Scan(&state)
+	if errors.Is(err, sql.ErrNoRows) {
+		return stateAbsent, nil
+	}
+	return state, err
+}
+
+// newOwnerID returns an identifier unique to a queue instance, recorded on
+// claimed items so processes sharing a database file can tell their items apart.
+func newOwnerID() string {
+	var suffix [8]byte
+	rand.Read(suffix[:])
+
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%s/%d/%s", host, os.Getpid(), hex.EncodeToString(suffix[:]))
+}
+
+// listByState returns up to 'limit' items in the given state with IDs above
+// 'after', oldest first. Pending and scheduled items are told apart by their
+// visibility at the time of the call.
+func (c *Queue) listByState(state State, limit, after int) ([]Item, error) {
+	c.mx.Lock() // Lock for exclusive access to the queue.
+	defer c.mx.Unlock()
+
+	return c.listItems(c.ctx, c.db, state, limit, after, c.cfg.Clock.Now())
+}
+
+// listItems lists the items visible to q for listByState, telling pending
+// and scheduled items apart by their visibility at 'now'. The rows are
+// closed before the payloads are loaded, so q may be a single connection.
+func (c *Queue) listItems(ctx context.Context, q queryer, state State, limit, after int, now time.Time) ([]Item, error) {
+	query := "SELECT " + itemColumns + " FROM " + c.tables.items + " WHERE state = ?1 AND id > ?2"
+	switch state {
+	case StatePending:
+		query += " AND COALESCE(visible_at, 0) <= ?3"
+	case StateScheduled:
+		query += " AND visible_at > ?3"
+	}
+	query += " ORDER BY id LIMIT ?4"
+
+	stored := state
+	if state == StateScheduled {
+		stored = StatePending
+	}
+
+	rows, err := q.QueryContext(ctx, query, stored, after, now.UnixNano(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close() // Ensure rows are closed after processing.
+
+	var items []Item
+	for rows.Next() {
+		item, err := scanItem(rows)
+		if err != nil {
+			return nil, err
+		}
+		item.State = state
+		items = append(items, item) // Collect items into a slice.
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close() // Release the connection before loading the payloads.
+	return items, c.loadPayloads(q, items)
+}
@@ -0,0 +1,235 @@
+package queue
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestListByState(t *testing.T) {
+	queue := setupQueue(t, Config{})
+	defer queue.Close()
+
+	for i := 0; i < 3; i++ {
+		if err := queue.Add([]byte("test data")); err != nil {
+			t.Fatalf("failed to add item to queue: %v", err)
+		}
+	}
+	if _, err := queue.Claim(1); err != nil {
+		t.Fatalf("failed to claim item: %v", err)
+	}
+
+	inFlight, _, err := queue.Admin().ListByState(StateInFlight, 10, 0)
+	if err != nil {
+		t.Fatalf("failed to list in-flight items: %v", err)
+	}
+	if len(inFlight) != 1 || inFlight[0].ID != 1 {
+		t.Fatalf("expected item 1 in flight, got %+v", inFlight)
+	}
+
+	pending, _, err := queue.Admin().ListByState(StatePending, 10, 0)
+	if err != nil {
+		t.Fatalf("failed to list pending items: %v", err)
+	}
+	if len(pending) != 2 || pending[0].ID != 2 {
+		t.Fatalf("expected items 2 and 3 pending, got %+v", pending)
+	}
+}
+
+func TestListByStateCursor(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1700000000, 0))
+	queue := setupQueue(t, Config{Clock: clock})
+	defer queue.Close()
+
+	for i := 0; i < 5; i++ {
+		if err := queue.Add([]byte("test data")); err != nil {
+			t.Fatalf("failed to add item to queue: %v", err)
+		}
+	}
+	if _, err := queue.AddAt(clock.Now().Add(time.Hour), []byte("later")); err != nil {
+		t.Fatalf("failed to add item to queue: %v", err)
+	}
+
+	var ids []int
+	for cursor, pages := 0, 0; ; pages++ {
+		items, next, err := queue.Admin().ListByState(StatePending, 2, cursor)
+		if err != nil {
+			t.Fatalf("failed to list pending items: %v", err)
+		}
+		for _, item := range items {
+			ids = append(ids, item.ID)
+		}
+		if next == 0 {
+			break
+		}
+		if pages > 5 {
+			t.Fatalf("expected the cursor to reach the end")
+		}
+		cursor = next
+	}
+	if len(ids) != 5 || ids[0] != 1 || ids[4] != 5 {
+		t.Fatalf("expected items 1 to 5 pending, got %v", ids)
+	}
+
+	scheduled, _, err := queue.Admin().ListByState(StateScheduled, 10, 0)
+	if err != nil || len(scheduled) != 1 || scheduled[0].ID != 6 || scheduled[0].State != StateScheduled {
+		t.Fatalf("expected item 6 scheduled, got %+v, %v", scheduled, err)
+	}
+
+	// Once due, the scheduled item is pending.
+	clock.Advance(time.Hour)
+	if scheduled, _, err := queue.Admin().ListByState(StateScheduled, 10, 0); err != nil || len(scheduled) != 0 {
+		t.Fatalf("expected no scheduled items, got %+v, %v", scheduled, err)
+	}
+	if pending, _, err := queue.Admin().ListByState(StatePending, 10, 5); err != nil || len(pending) != 1 {
+		t.Fatalf("expected item 6 pending, got %+v, %v", pending, err)
+	}
+}
+
+func TestLifecycle(t *testing.T) {
+	if !CanTransition(StateDead, TransitionRequeued) || CanTransition(StatePending, TransitionRequeued) {
+		t.Fatalf("expected only dead letters to be requeued")
+	}
+	if !CanTransition(StateScheduled, TransitionRescheduled) || CanTransition(StateInFlight, TransitionRescheduled) {
+		t.Fatalf("expected only scheduled items to be rescheduled")
+	}
+
+	queue := setupQueue(t, Config{})
+	defer queue.Close()
+
+	if err := queue.Add([]byte("test data")); err != nil {
+		t.Fatalf("failed to add item to queue: %v", err)
+	}
+
+	// A statement moving a pending item to the dead letters under the name
+	// of a requeue is rejected and rolled back.
+	err := queue.updateItem(1, "", TransitionRequeued, "UPDATE "+queue.tables.items+" SET state = 'dead' WHERE id = ?", 1)
+	var terr *TransitionError
+	if !errors.As(err, &terr) || !errors.Is(err, ErrIllegalTransition) || terr.From != StatePending || terr.To != StateDead {
+		t.Fatalf("expected an illegal transition, got %v", err)
+	}
+	stats, err := queue.Stats()
+	if err != nil || stats.Pending != 1 || stats.Dead != 0 {
+		t.Fatalf("expected the item to stay pending, got %+v, %v", stats, err)
+	}
+}
+
+func TestTerminalStates(t *testing.T) {
+	for _, state := range []State{StateDone, StateFailed} {
+		if !state.Terminal() || CanTransition(state, TransitionRequeued) || CanTransition(state, TransitionDeleted) {
+			t.Fatalf("expected %s to be terminal", state)
+		}
+	}
+	if StateDead.Terminal() {
+		t.Fatalf("expected dead letters to be requeueable")
+	}
+
+	queue := setupQueue(t, Config{})
+	defer queue.Close()
+
+	for i := 0; i < 2; i++ {
+		if err := queue.Add([]byte("test data")); err != nil {
+			t.Fatalf("failed to add item to queue: %v", err)
+		}
+	}
+	items, err := queue.Claim(2)
+	if err != nil || len(items) != 2 {
+		t.Fatalf("failed to claim items: %+v, %v", items, err)
+	}
+
+	// Acknowledging leaves the item done.
+	if err := queue.AckReceipt(items[0].Receipt); err != nil {
+		t.Fatalf("failed to acknowledge item: %v", err)
+	}
+
+	// A statement removing an item under the name of a release is rejected
+	// and rolled back.
+	err = queue.withTx(func(tx *sql.Tx) error {
+		_, err := queue.execTransition(tx, items[1].ID, TransitionReleased, queue.stmts.delete, items[1].ID)
+		return err
+	})
+	var terr *TransitionError
+	if !errors.As(err, &terr) || terr.From != StateInFlight || terr.To != stateAbsent {
+		t.Fatalf("expected an illegal transition, got %v", err)
+	}
+	if inFlight, _, err := queue.Admin().ListByState(StateInFlight, 10, 0); err != nil || len(inFlight) != 1 {
+		t.Fatalf("expected the item to stay in flight, got %+v, %v", inFlight, err)
+	}
+	if done, _, err := queue.Admin().ListByState(StateDone, 10, 0); err != nil || len(done) != 0 {
+		t.Fatalf("expected no item stored as done, got %+v, %v", done, err)
+	}
+}
+
+func TestStatsLatency(t *testing.T) {
+	queue := setupQueue(t, Config{})
+	defer queue.Close()
+
+	done := make(chan struct{})
+	queue.Listener(func(item Item, delay func(sec time.Duration)) {
+		time.Sleep(10 * time.Millisecond)
+		close(done)
+	})
+	if err := queue.Add([]byte("test data")); err != nil {
+		t.Fatalf("failed to add item to queue: %v", err)
+	}
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for the listener")
+	}
+
+	// The latency is recorded right after the callback returns.
+	deadline := time.Now().Add(time.Second)
+	for {
+		stats, err := queue.Stats()
+		if err != nil {
+			t.Fatalf("failed to read stats: %v", err)
+		}
+		if stats.Latency.Count == 1 {
+			if stats.Latency.Max < 10*time.Millisecond {
+				t.Fatalf("expected at least 10ms max latency, got %v", stats.Latency.Max)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected 1 processed item, got %+v", stats.Latency)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestStatsLatencyWindows(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1700000000, 0))
+	queue := setupQueue(t, Config{Clock: clock})
+	defer queue.Close()
+
+	// 100 items took 1ms to 100ms, ten minutes ago; one took 2s just now.
+	for i := 1; i <= 100; i++ {
+		queue.latency.observe(clock.Now(), time.Duration(i)*time.Millisecond)
+	}
+	clock.Advance(10 * time.Minute)
+	queue.latency.observe(clock.Now(), 2*time.Second)
+
+	stats, err := queue.Stats()
+	if err != nil {
+		t.Fatalf("failed to read stats: %v", err)
+	}
+	windows := stats.Latency.Windows
+	if stats.Latency.Count != 101 || len(windows) != 3 {
+		t.Fatalf("unexpected latency: %+v", stats.Latency)
+	}
+	if windows[0].Window != time.Minute || windows[0].Count != 1 || windows[0].P50 != 2*time.Second {
+		t.Fatalf("expected only the last item in the last minute, got %+v", windows[0])
+	}
+	if windows[1].Count != 1 {
+		t.Fatalf("expected only the last item in the last five minutes, got %+v", windows[1])
+	}
+
+	w := windows[2]
+	near := func(got, want time.Duration) bool { return got >= want && float64(got) <= 1.19*float64(want) }
+	if w.Count != 101 || !near(w.P50, 51*time.Millisecond) || !near(w.P95, 96*time.Millisecond) || !near(w.P99, 100*time.Millisecond) || w.Max != 2*time.Second {
+		t.Fatalf("unexpected percentiles over fifteen minutes: %+v", w)
+	}
+}
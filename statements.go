@@ -0,0 +1,78 @@
+package queue
+
+import "database/sql"
+
+// statements holds the hot-path SQL prepared once when the queue is opened.
+type statements struct {
+	insert        *sql.Stmt // Inserts a new item.
+	get           *sql.Stmt // Selects up to N items.
+	claim         *sql.Stmt // Selects a page of claimable items in claim order.
+	claimOne      *sql.Stmt // Marks an item as in-flight unless another consumer holds it.
+	claimAll      *sql.Stmt // Marks the next claimable items as in-flight and returns them.
+	release       *sql.Stmt // Returns an item claimed by this instance to pending.
+	retry         *sql.Stmt // Returns an item claimed by this instance to pending, hidden until a given time.
+	ack           *sql.Stmt // Deletes an item claimed by this instance.
+	deadLetter    *sql.Stmt // Moves a claimable item to the dead letters.
+	deadLetterAll *sql.Stmt // Moves the claimable items that used up their attempts to the dead letters and returns them.
+	giveUp        *sql.Stmt // Moves an item claimed by this instance to the dead letters.
+	requeue       *sql.Stmt // Moves a dead letter back to pending.
+	delete        *sql.Stmt // Deletes an item by ID.
+	expire        *sql.Stmt // Expires a claimable item whose deadline passed.
+	expireAll     *sql.Stmt // Expires the claimable items whose deadline passed and returns them.
+}
+
+// prepareStatements prepares the hot-path statements against the database.
+// Expired items are deleted, or dead-lettered if deadLetterExpired is set.
+func prepareStatements(db *sql.DB, t tables, deadLetterExpired bool) (*statements, error) {
+	s := &statements{}
+
+	expire := "DELETE FROM " + t.items
+	if deadLetterExpired {
+		expire = "UPDATE " + t.items + " SET state = 'dead', owner = NULL, lease_until = NULL, dead_at = ?1, failure = 'expired', version = version + 1"
+	}
+
+	queries := []struct {
+		stmt  **sql.Stmt
+		query string
+	}{
+		{&s.insert, "INSERT INTO " + t.items + "(`data`, `tags`, `priority`, `visible_at`, `checksum`, `tenant`, `expires_at`, `headers`, `dedup_key`, `key_id`, `job_type`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"},
+		{&s.get, "SELECT " + itemColumns + " FROM " + t.items + " LIMIT ?"},
+		{&s.claim, "SELECT " + itemColumns + " FROM " + t.items + " WHERE (state = 'pending' OR (state = 'in-flight' AND lease_until < ?1)) AND COALESCE(visible_at, 0) <= ?1 AND (priority < ?2 OR (priority = ?2 AND id > ?3)) ORDER BY priority DESC, id LIMIT ?4"},
+		{&s.claimOne, "UPDATE " + t.items + " SET state = 'in-flight', owner = ?1, lease_until = ?2, attempts = attempts + 1, version = version + 1, receipt = ?5, progress = NULL, progress_message = NULL, progress_at = NULL WHERE id = ?3 AND (state = 'pending' OR (state = 'in-flight' AND lease_until < ?4))"},
+		{&s.release, "UPDATE " + t.items + " SET state = 'pending', owner = NULL, lease_until = NULL WHERE id = ?1 AND owner = ?2 AND (?3 IS NULL OR receipt = ?3)"},
+		{&s.retry, "UPDATE " + t.items + " SET state = 'pending', owner = NULL, lease_until = NULL, visible_at = ?3 WHERE id = ?1 AND owner = ?2 AND (?4 IS NULL OR receipt = ?4)"},
+		{&s.ack, "DELETE FROM " + t.items + " WHERE id = ?1 AND owner = ?2 AND state = 'in-flight' AND (?3 IS NULL OR receipt = ?3)"},
+		{&s.claimAll, "UPDATE " + t.items + " SET state = 'in-flight', owner = ?1, lease_until = ?2, attempts = attempts + 1, version = version + 1, receipt = ?6, progress = NULL, progress_message = NULL, progress_at = NULL WHERE id IN (SELECT id FROM " + t.items + " WHERE (state = 'pending' OR (state = 'in-flight' AND lease_until < ?3)) AND COALESCE(visible_at, 0) <= ?3 AND attempts < ?4 ORDER BY priority DESC, id LIMIT ?5) RETURNING " + itemColumns},
+		{&s.deadLetterAll, "UPDATE " + t.items + " SET state = 'dead', owner = NULL, lease_until = NULL, dead_at = ?1, version = version + 1 WHERE (state = 'pending' OR (state = 'in-flight' AND lease_until < ?1)) AND COALESCE(visible_at, 0) <= ?1 AND attempts >= ?2 RETURNING " + itemColumns},
+		{&s.deadLetter, "UPDATE " + t.items + " SET state = 'dead', owner = NULL, lease_until = NULL, dead_at = ?2 WHERE id = ?1 AND (state = 'pending' OR (state = 'in-flight' AND lease_until < ?2))"},
+		{&s.giveUp, "UPDATE " + t.items + " SET state = 'dead', owner = NULL, lease_until = NULL, dead_at = ?3 WHERE id = ?1 AND owner = ?2 AND (?4 IS NULL OR receipt = ?4)"},
+		{&s.requeue, "UPDATE " + t.items + " SET state = 'pending', attempts = 0, dead_at = NULL WHERE id = ?1 AND state = 'dead'"},
+		{&s.delete, "DELETE FROM " + t.items + " WHERE id = ?"},
+		{&s.expire, expire + " WHERE id = ?2 AND (state = 'pending' OR (state = 'in-flight' AND lease_until < ?1)) AND expires_at <= ?1"},
+		{&s.expireAll, expire + " WHERE (state = 'pending' OR (state = 'in-flight' AND lease_until < ?1)) AND COALESCE(visible_at, 0) <= ?1 AND expires_at <= ?1 RETURNING " + itemColumns},
+	}
+
+	for _, q := range queries {
+		stmt, err := db.Prepare(q.query)
+		if err != nil {
+			s.close()
+			return nil, err
+		}
+		*q.stmt = stmt
+	}
+	return s, nil
+}
+
+// close releases every prepared statement.
+func (s *statements) close() error {
+	var firstErr error
+	for _, stmt := range []*sql.Stmt{s.insert, s.get, s.claim, s.claimOne, s.claimAll, s.release, s.retry, s.ack, s.deadLetter, s.deadLetterAll, s.giveUp, s.requeue, s.delete, s.expire, s.expireAll} {
+		if stmt == nil {
+			continue
+		}
+		if err := stmt.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,123 @@
+package queue
+
+import (
+	"context"
+	"database/sql"
+)
+
+// Stats summarizes the contents of the queue.
+type Stats struct {
+	Pending     int   `json:"pending"`     // Items waiting to be handed to a listener.
+	InFlight    int   `json:"in_flight"`   // Items currently being processed.
+	Dead        int   `json:"dead"`        // Items that used up their attempts.
+	Quarantined int   `json:"quarantined"` // Items set aside for crashing or timing out their listener.
+	Bytes       int64 `json:"bytes"`       // Total size of all payloads.
+
+	// Tenants breaks the items added with AddForTenant down by tenant ID.
+	Tenants map[string]TenantStats `json:"tenants,omitempty"`
+
+	// Latency covers the items processed by the listeners of this instance.
+	Latency Latency `json:"latency"`
+}
+
+// Stats returns the number of items in each state, the total payload size
+// and the processing latency of the listeners, overall and per tenant.
+func (c *Queue) Stats() (Stats, error) {
+	c.mx.Lock() // Lock for exclusive access to the queue.
+	defer c.mx.Unlock()
+
+	stats, err := c.stats(c.ctx, c.db)
+	if err != nil {
+		return Stats{}, err
+	}
+	stats.Latency = c.latency.summary(c.cfg.Clock.Now())
+	return stats, nil
+}
+
+// stats counts the items and payload bytes visible to q. The rows are read
+// one query after the other, so only a transaction gives a consistent view.
+func (c *Queue) stats(ctx context.Context, q queryer) (Stats, error) {
+	rows, err := q.QueryContext(
+		ctx,
+		"SELECT `tenant`, `state`, COUNT(*), COALESCE(SUM(LENGTH(data)), 0) FROM "+c.tables.items+" GROUP BY `tenant`, `state`",
+	)
+	if err != nil {
+		return Stats{}, err
+	}
+	defer rows.Close() // Ensure rows are closed after processing.
+
+	var stats Stats
+	tenants := make(map[string]*TenantStats)
+	for rows.Next() {
+		var tenant sql.NullString
+		var state State
+		var count int
+		var bytes int64
+		if err := rows.Scan(&tenant, &state, &count, &bytes); err != nil {
+			return Stats{}, err
+		}
+
+		countState(state, count, &stats.Pending, &stats.InFlight, &stats.Dead, &stats.Quarantined)
+		stats.Bytes += bytes
+		if !tenant.Valid {
+			continue
+		}
+
+		t := tenants[tenant.String]
+		if t == nil {
+			t = &TenantStats{}
+			tenants[tenant.String] = t
+		}
+		countState(state, count, &t.Pending, &t.InFlight, &t.Dead, &t.Quarantined)
+		t.Bytes += bytes
+	}
+	if err := rows.Err(); err != nil {
+		return Stats{}, err
+	}
+	rows.Close() // Release the connection before summing up the chunks.
+
+	// Chunked payloads are only partly stored in the item rows.
+	rows, err = q.QueryContext(
+		ctx,
+		"SELECT i.tenant, SUM(LENGTH(c.data)) FROM "+c.tables.chunks+" c JOIN "+c.tables.items+" i ON i.id = c.item_id GROUP BY i.tenant",
+	)
+	if err != nil {
+		return Stats{}, err
+	}
+	for rows.Next() {
+		var tenant sql.NullString
+		var bytes int64
+		if err := rows.Scan(&tenant, &bytes); err != nil {
+			return Stats{}, err
+		}
+		stats.Bytes += bytes
+		if t := tenants[tenant.String]; tenant.Valid && t != nil {
+			t.Bytes += bytes
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return Stats{}, err
+	}
+
+	if len(tenants) > 0 {
+		stats.Tenants = make(map[string]TenantStats, len(tenants))
+		for name, t := range tenants {
+			stats.Tenants[name] = *t
+		}
+	}
+	return stats, nil
+}
+
+// countState adds count to the counter of the given state.
+func countState(state State, count int, pending, inFlight, dead, quarantined *int) {
+	switch state {
+	case StatePending:
+		*pending += count
+	case StateInFlight:
+		*inFlight += count
+	case StateDead:
+		*dead += count
+	case StateQuarantined:
+		*quarantined += count
+	}
+}
@@ -0,0 +1,358 @@
+package queue
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"hash/crc32"
+	"io"
+)
+
+// defaultStreamChunkSize is the size of the chunks AddFrom writes when
+// Config.ChunkSize is not set.
+const defaultStreamChunkSize = 1 << 20
+
+// streamBufferSize is the most AddFrom and OpenPayload hold in memory at
+// once while copying a payload to or from its blobs.
+const streamBufferSize = 64 << 10
+
+// blobIO reads and writes an open blob; see withBlob.
+type blobIO interface {
+	io.ReaderAt
+	io.WriterAt
+}
+
+// AddFrom inserts a new item whose payload is read from r until io.EOF and
+// returns its ID. The payload is written in chunks of Config.ChunkSize, or
+// 1 MiB if unset, so it never has to fit in memory at once; built with the
+// sqlite_blob_io tag, the chunks are written through SQLite's incremental
+// blob I/O and at most 64 KiB of the payload is held at once. Listeners and readers of the queue receive
+// the item with Streamed set and empty Data, and read the payload with
+// OpenPayload.
+//
+// The queue is locked while r is read, so r should be quick to drain, such as
+// a file. The Add middleware and Config.Offload do not apply, and the
+// overflow policy is always OverflowReject: AddFrom returns ErrQueueFull
+// without adding the item if it would exceed MaxItems or MaxBytes. As the
+// payload is never whole in memory, AddFrom returns ErrStreamValidation if
+// the queue has a validator.
+func (c *Queue) AddFrom(r io.Reader, tags ...string) (int, error) {
+	if v := c.validator.Load(); v != nil && *v != nil {
+		return 0, ErrStreamValidation
+	}
+	encoded, err := encodeTags(tags)
+	if err != nil {
+		return 0, err
+	}
+
+	c.mx.Lock() // Lock for exclusive access to the queue.
+	defer c.mx.Unlock()
+
+	var id int64
+	err = c.withConnTx(func(conn *sql.Conn, tx *sql.Tx) error {
+		if c.draining.Load() {
+			return ErrDraining
+		}
+		// Check the item limit up front; the size is only known at the end.
+		if err := c.checkCapacity(tx, 0); err != nil {
+			return err
+		}
+
+		res, err := tx.StmtContext(c.ctx, c.stmts.insert).ExecContext(c.ctx, []byte{}, encoded, 0, nil, nil, nil, nil, nil, nil, nil, nil)
+		if err != nil {
+			return err
+		}
+		if id, err = res.LastInsertId(); err != nil {
+			return err
+		}
+
+		// Keep a copy of the payload only if the mirror needs one.
+		var mirrored *bytes.Buffer
+		if c.cfg.Mirror != nil {
+			mirrored = new(bytes.Buffer)
+			r = io.TeeReader(r, mirrored)
+		}
+		if err := c.streamChunks(conn, tx, id, r); err != nil {
+			return err
+		}
+
+		_, used, err := c.usage(tx)
+		if err != nil {
+			return err
+		}
+		if c.cfg.MaxBytes > 0 && used > c.cfg.MaxBytes {
+			return ErrQueueFull
+		}
+
+		if mirrored != nil {
+			if err := c.queueMirror(tx, mirrored.Bytes(), encoded, addOptions{}); err != nil {
+				return err
+			}
+		}
+		if err := c.enforceTransition(tx, int(id), TransitionEnqueued, stateAbsent); err != nil {
+			return err
+		}
+		if err := c.snapshot(tx, int(id), TransitionEnqueued, nil); err != nil {
+			return err
+		}
+		return c.audit(tx, c.actor(), TransitionEnqueued, int(id))
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	c.signalAdded()
+	c.cfg.Hooks.enqueued(Item{ID: int(id), Tags: tags, State: StatePending, Streamed: true})
+	c.count(MetricEnqueued, 1)
+	return int(id), nil
+}
+
+// streamChunks writes the payload read from r to the chunks table and marks
+// the item as streamed along with the checksum of the payload. It returns a
+// *PayloadTooLargeError as soon as the payload exceeds Config.MaxPayloadSize.
+func (c *Queue) streamChunks(conn *sql.Conn, tx *sql.Tx, id int64, r io.Reader) error {
+	size := c.cfg.ChunkSize
+	if size <= 0 {
+		size = defaultStreamChunkSize
+	}
+
+	src := &payloadSource{c: c, r: r}
+	var seq int
+	var err error
+	if blobIOSupported {
+		seq, err = c.writeChunkBlobs(conn, tx, id, src, size)
+	} else {
+		seq, err = c.writeChunks(tx, id, src, size)
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE "+c.tables.items+" SET chunks = ?, streamed = 1, checksum = ? WHERE id = ?", seq, int64(src.sum), id)
+	return err
+}
+
+// writeChunks writes the payload read from src in chunks of 'size' bytes,
+// each bound to an INSERT, and returns the number of chunks.
+func (c *Queue) writeChunks(tx *sql.Tx, id int64, src io.Reader, size int) (int, error) {
+	buf := make([]byte, size)
+	for seq := 0; ; seq++ {
+		n, err := readPiece(src, buf)
+		if err != nil || n == 0 {
+			return seq, err
+		}
+		if _, err := tx.Exec("INSERT INTO "+c.tables.chunks+"(`item_id`, `seq`, `data`) VALUES (?, ?, ?)", id, seq, buf[:n]); err != nil {
+			return seq, err
+		}
+		if n < size {
+			return seq + 1, nil
+		}
+	}
+}
+
+// writeChunkBlobs writes the payload read from src in chunks of 'size'
+// bytes through blobs opened on conn, the connection of tx, and returns the
+// number of chunks.
+func (c *Queue) writeChunkBlobs(conn *sql.Conn, tx *sql.Tx, id int64, src io.Reader, size int) (int, error) {
+	buf := make([]byte, min(size, streamBufferSize))
+	seq := 0
+	for more := true; more; {
+		// Read the start of the chunk first, so no chunk is left empty.
+		n, err := readPiece(src, buf)
+		if err != nil {
+			return seq, err
+		}
+		if n == 0 {
+			break
+		}
+
+		// A blob cannot grow, so the chunk starts at its full size.
+		res, err := tx.Exec("INSERT INTO "+c.tables.chunks+"(`item_id`, `seq`, `data`) VALUES (?, ?, zeroblob(?))", id, seq, size)
+		if err != nil {
+			return seq, err
+		}
+		rowid, err := res.LastInsertId()
+		if err != nil {
+			return seq, err
+		}
+		seq++
+
+		written := 0
+		err = withBlob(conn, c.tables.chunks, "data", rowid, true, func(b blobIO) error {
+			for n > 0 {
+				if _, err := b.WriteAt(buf[:n], int64(written)); err != nil {
+					return err
+				}
+				written += n
+				if written == size {
+					return nil
+				}
+				var err error
+				if n, err = readPiece(src, buf[:min(len(buf), size-written)]); err != nil {
+					return err
+				}
+			}
+			more = false
+			return nil
+		})
+		if err != nil {
+			return seq, err
+		}
+		if written < size {
+			// The payload ended inside the chunk; drop the zeroes after it.
+			if _, err := tx.Exec("UPDATE "+c.tables.chunks+" SET data = substr(data, 1, ?) WHERE rowid = ?", written, rowid); err != nil {
+				return seq, err
+			}
+		}
+	}
+	return seq, nil
+}
+
+// readPiece fills buf from r, short only at the end of r.
+func readPiece(r io.Reader, buf []byte) (int, error) {
+	n, err := io.ReadFull(r, buf)
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		err = nil
+	}
+	return n, err
+}
+
+// payloadSource reads a payload for AddFrom, keeping its checksum and
+// enforcing Config.MaxPayloadSize along the way.
+type payloadSource struct {
+	c     *Queue
+	r     io.Reader
+	total int    // Bytes read so far.
+	sum   uint32 // Checksum of the bytes read so far.
+}
+
+func (s *payloadSource) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	s.total += n
+	s.sum = crc32.Update(s.sum, crcTable, p[:n])
+	if err := s.c.checkPayload(s.total); err != nil {
+		return n, err
+	}
+	return n, err
+}
+
+// OpenPayload returns a reader streaming the payload of an item, e.g. one
+// added with AddFrom, without loading it into memory at once. Every Read
+// copies at most 64 KiB from one blob of the payload, through SQLite's
+// incremental blob I/O when built with the sqlite_blob_io tag. The final Read
+// returns a *CorruptedPayloadError instead of io.EOF if the payload does not
+// match its checksum. It returns ErrItemNotFound if there is no item with the
+// given ID; reads fail with ErrItemNotFound if the item is removed before its
+// payload is read to the end.
+func (c *Queue) OpenPayload(id int) (io.Reader, error) {
+	r := &payloadReader{c: c, id: id, table: c.tables.items, rowid: int64(id)}
+	var blob sql.NullString
+	err := c.db.QueryRowContext(
+		c.ctx,
+		"SELECT LENGTH(data), `chunks`, `blob`, `checksum` FROM "+c.tables.items+" WHERE id = ?",
+		id,
+	).Scan(&r.size, &r.chunks, &blob, &r.checksum)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrItemNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if blob.Valid {
+		item := Item{ID: id, blob: blob.String, checksum: r.checksum}
+		if err := c.loadPayload(c.db, &item); err != nil {
+			return nil, err
+		}
+		return bytes.NewReader(item.Data), nil
+	}
+	return r, nil
+}
+
+// payloadReader reads the payload of an item from the blob of its row and
+// then from the blobs of its chunks.
+type payloadReader struct {
+	c      *Queue
+	id     int
+	chunks int // Number of chunks of the item.
+	seq    int // Next chunk to read.
+
+	table  string // Table of the blob being read.
+	rowid  int64  // Row of the blob being read.
+	size   int64  // Length of the blob being read.
+	offset int64  // Bytes of the blob read so far.
+
+	checksum sql.NullInt64 // Checksum stored for the payload.
+	sum      uint32        // Checksum of the payload read so far.
+}
+
+func (r *payloadReader) Read(p []byte) (int, error) {
+	for r.offset == r.size {
+		if r.seq == r.chunks {
+			if r.checksum.Valid && r.sum != uint32(r.checksum.Int64) {
+				return 0, &CorruptedPayloadError{ItemID: r.id, Expected: uint32(r.checksum.Int64), Actual: r.sum}
+			}
+			return 0, io.EOF
+		}
+		err := r.c.db.QueryRowContext(
+			r.c.ctx,
+			"SELECT rowid, LENGTH(data) FROM "+r.c.tables.chunks+" WHERE item_id = ? AND seq = ?",
+			r.id, r.seq,
+		).Scan(&r.rowid, &r.size)
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrItemNotFound
+		}
+		if err != nil {
+			return 0, err
+		}
+		r.table, r.offset = r.c.tables.chunks, 0
+		r.seq++
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	p = p[:min(int64(len(p)), r.size-r.offset, streamBufferSize)]
+	if err := r.readAt(p); err != nil {
+		return 0, err
+	}
+	r.offset += int64(len(p))
+	r.sum = crc32.Update(r.sum, crcTable, p)
+	return len(p), nil
+}
+
+// readAt fills p from the blob being read, starting at the offset read so
+// far, through a blob handle or else with substr.
+func (r *payloadReader) readAt(p []byte) error {
+	if !blobIOSupported {
+		// SQLite counts substr offsets of BLOBs in bytes, starting at 1.
+		var data []byte
+		err := r.c.db.QueryRowContext(
+			r.c.ctx,
+			"SELECT substr(data, ?, ?) FROM "+r.table+" WHERE rowid = ?",
+			r.offset+1, len(p), r.rowid,
+		).Scan(&data)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrItemNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if len(data) < len(p) {
+			return io.ErrUnexpectedEOF // The payload was replaced while it was read.
+		}
+		copy(p, data)
+		return nil
+	}
+
+	conn, err := r.c.db.Conn(r.c.ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close() // Return the connection to the pool.
+
+	return withBlob(conn, r.table, "data", r.rowid, false, func(b blobIO) error {
+		_, err := b.ReadAt(p, r.offset)
+		return err
+	})
+}
@@ -0,0 +1,109 @@
+package queue
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestAddFromAndOpenPayload(t *testing.T) {
+	queue := setupQueue(t, Config{ChunkSize: 4})
+	defer queue.Close()
+
+	payload := strings.Repeat("0123456789", 3)
+	id, err := queue.AddFrom(strings.NewReader(payload), "upload")
+	if err != nil {
+		t.Fatalf("failed to add item from reader: %v", err)
+	}
+
+	items, err := queue.Claim(1)
+	if err != nil || len(items) != 1 {
+		t.Fatalf("failed to claim item: %+v, %v", items, err)
+	}
+	if item := items[0]; item.ID != id || !item.Streamed || len(item.Data) != 0 || item.Tags[0] != "upload" {
+		t.Fatalf("expected a streamed item without data, got %+v", item)
+	}
+
+	r, err := queue.OpenPayload(id)
+	if err != nil {
+		t.Fatalf("failed to open payload: %v", err)
+	}
+	if data, err := io.ReadAll(r); err != nil || string(data) != payload {
+		t.Fatalf("expected %q, got %q, %v", payload, data, err)
+	}
+
+	if stats, _ := queue.Stats(); stats.Bytes != int64(len(payload)) {
+		t.Fatalf("expected %d bytes, got %+v", len(payload), stats)
+	}
+}
+
+func TestOpenPayloadOfPlainItem(t *testing.T) {
+	queue := setupQueue(t, Config{})
+	defer queue.Close()
+
+	payload := bytes.Repeat([]byte("x"), 100)
+	if err := queue.Add(payload); err != nil {
+		t.Fatalf("failed to add item to queue: %v", err)
+	}
+	items, _ := queue.Get(1)
+
+	r, err := queue.OpenPayload(items[0].ID)
+	if err != nil {
+		t.Fatalf("failed to open payload: %v", err)
+	}
+	if data, err := io.ReadAll(r); err != nil || !bytes.Equal(data, payload) {
+		t.Fatalf("expected the payload, got %q, %v", data, err)
+	}
+	if _, err := queue.OpenPayload(items[0].ID + 1); !errors.Is(err, ErrItemNotFound) {
+		t.Fatalf("expected ErrItemNotFound, got %v", err)
+	}
+}
+
+func TestAddFromLimits(t *testing.T) {
+	queue := setupQueue(t, Config{MaxPayloadSize: 8, ChunkSize: 4})
+	defer queue.Close()
+
+	if _, err := queue.AddFrom(strings.NewReader("0123456789")); !errors.Is(err, ErrPayloadTooLarge) {
+		t.Fatalf("expected ErrPayloadTooLarge, got %v", err)
+	}
+	if stats, _ := queue.Stats(); stats.Pending != 0 || stats.Bytes != 0 {
+		t.Fatalf("expected the rejected item to be rolled back, got %+v", stats)
+	}
+}
+
+func TestAddFromChunkBoundaries(t *testing.T) {
+	// Chunks larger than the copy buffer, and a payload ending on a chunk.
+	queue := setupQueue(t, Config{ChunkSize: 100 << 10})
+	defer queue.Close()
+
+	payload := bytes.Repeat([]byte("0123456789abcdef"), 25<<10)
+	id, err := queue.AddFrom(bytes.NewReader(payload))
+	if err != nil {
+		t.Fatalf("failed to add item from reader: %v", err)
+	}
+
+	r, err := queue.OpenPayload(id)
+	if err != nil {
+		t.Fatalf("failed to open payload: %v", err)
+	}
+	if data, err := io.ReadAll(r); err != nil || !bytes.Equal(data, payload) {
+		t.Fatalf("expected the payload of %d bytes, got %d bytes, %v", len(payload), len(data), err)
+	}
+	if stats, _ := queue.Stats(); stats.Bytes != int64(len(payload)) {
+		t.Fatalf("expected %d bytes, got %+v", len(payload), stats)
+	}
+}
+
+func TestAddFromValidator(t *testing.T) {
+	queue := setupQueue(t, Config{Validator: ValidatorFunc(func(data []byte) error { return nil })})
+	defer queue.Close()
+
+	if _, err := queue.AddFrom(strings.NewReader("payload")); !errors.Is(err, ErrStreamValidation) {
+		t.Fatalf("expected ErrStreamValidation, got %v", err)
+	}
+	if stats, _ := queue.Stats(); stats.Pending != 0 {
+		t.Fatalf("expected no item, got %+v", stats)
+	}
+}
@@ -0,0 +1,92 @@
+package queue
+
+import (
+	"encoding/json"
+	"slices"
+	"time"
+)
+
+// TagPredicate decides whether an item with the given tags is accepted by a listener.
+type TagPredicate func(tags []string) bool
+
+// listener pairs a callback with the predicate selecting the items it receives.
+type listener struct {
+	match TagPredicate
+	clb   func(item Item, delay func(sec time.Duration))
+}
+
+// HasTag returns a predicate accepting items carrying the given tag.
+func HasTag(tag string) TagPredicate {
+	return func(tags []string) bool {
+		return slices.Contains(tags, tag)
+	}
+}
+
+// HasAnyTag returns a predicate accepting items carrying at least one of the given tags.
+func HasAnyTag(want ...string) TagPredicate {
+	return func(tags []string) bool {
+		for _, tag := range want {
+			if slices.Contains(tags, tag) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// AddTagged inserts a new item with the specified data and tags into the queue.
+func (c *Queue) AddTagged(data []byte, tags ...string) error {
+	return c.enqueue(c.ctx, data, tags, c.cfg.Overflow)
+}
+
+// TagListener registers a callback that only receives items matching the predicate.
+// Tag listeners are consulted in registration order before the catch-all Listener;
+// items no listener accepts stay in the queue until one is registered.
+func (c *Queue) TagListener(match TagPredicate, clb func(item Item, delay func(sec time.Duration))) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	c.tagged = append(c.tagged, listener{match: match, clb: clb})
+	c.signalRegistered()
+}
+
+// route returns the callback responsible for the item, or nil if none accepts
+// it or it goes to the batch listener.
+func (c *Queue) route(item Item) func(item Item, delay func(sec time.Duration)) {
+	if h, ok := c.handlers[item.Type]; ok && item.Type != "" {
+		return h
+	}
+	for _, l := range c.tagged {
+		if l.match(item.Tags) {
+			return l.clb
+		}
+	}
+	if c.batch != nil {
+		return nil // The batch listener takes the place of the catch-all one.
+	}
+	return c.clb
+}
+
+// encodeTags serializes tags for storage, returning nil for an untagged item.
+func encodeTags(tags []string) (any, error) {
+	if len(tags) == 0 {
+		return nil, nil
+	}
+
+	encoded, err := json.Marshal(tags)
+	if err != nil {
+		return nil, err
+	}
+	return string(encoded), nil
+}
+
+// decodeTags parses tags stored by encodeTags.
+func decodeTags(encoded string) ([]string, error) {
+	if encoded == "" {
+		return nil, nil
+	}
+
+	var tags []string
+	err := json.Unmarshal([]byte(encoded), &tags)
+	return tags, err
+}
@@ -0,0 +1,47 @@
+package queue
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTagListener(t *testing.T) {
+	queue := setupQueue(t, Config{})
+	defer queue.Close()
+
+	if err := queue.AddTagged([]byte("sms data"), "sms"); err != nil {
+		t.Fatalf("failed to add item to queue: %v", err)
+	}
+	if err := queue.AddTagged([]byte("email data"), "email", "urgent"); err != nil {
+		t.Fatalf("failed to add item to queue: %v", err)
+	}
+
+	received := make(chan Item, 2)
+	queue.TagListener(HasTag("email"), func(item Item, delay func(sec time.Duration)) {
+		received <- item
+	})
+
+	select {
+	case item := <-received:
+		if string(item.Data) != "email data" || len(item.Tags) != 2 {
+			t.Fatalf("unexpected item: %+v", item)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("tag listener was not invoked")
+	}
+
+	// The sms item has no matching listener and must stay queued once the email item is acked.
+	var items []Item
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		var err error
+		if items, err = queue.Get(10); err != nil {
+			t.Fatalf("failed to get items from queue: %v", err)
+		}
+		if len(items) == 1 {
+			break
+		}
+	}
+	if len(items) != 1 || items[0].Tags[0] != "sms" {
+		t.Fatalf("unexpected items: %+v", items)
+	}
+}
@@ -0,0 +1,113 @@
+package queue
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// TenantLimits bounds the share of the queue a tenant can take, so one noisy
+// customer cannot starve the others sharing the queue; see Config.Tenants.
+type TenantLimits struct {
+	MaxItems int     // Pending and in-flight items of the tenant; 0 means only Config.MaxItems caps them.
+	Rate     float64 // Items of the tenant claimed per second; 0 means unlimited.
+	Burst    int     // Items of the tenant claimed back to back after a quiet period; 0 means 1.
+}
+
+// TenantStats summarizes the items of a tenant.
+type TenantStats struct {
+	Pending     int   `json:"pending"`     // Items waiting to be handed to a listener.
+	InFlight    int   `json:"in_flight"`   // Items currently being processed.
+	Dead        int   `json:"dead"`        // Items that used up their attempts.
+	Quarantined int   `json:"quarantined"` // Items set aside for crashing or timing out their listener.
+	Bytes       int64 `json:"bytes"`       // Total size of the payloads of the tenant.
+}
+
+// tenantBucket is the token bucket enforcing TenantLimits.Rate of a tenant.
+type tenantBucket struct {
+	tokens float64   // Claims allowed right now.
+	last   time.Time // When tokens was last refilled.
+}
+
+// AddForTenant inserts a new item with the given tags on behalf of a tenant,
+// e.g. a customer ID, so a single queue can serve many customers. The limits
+// configured for the tenant in Config.Tenants, or Config.TenantDefaults,
+// apply to it: AddForTenant returns ErrTenantFull if the tenant already has
+// TenantLimits.MaxItems pending or in-flight items, whatever the overflow
+// policy, and listeners and Claim skip its items while it exceeds
+// TenantLimits.Rate. The Add middleware and the overflow policy apply as for
+// AddTagged.
+func (c *Queue) AddForTenant(tenant string, data []byte, tags ...string) error {
+	opts := &addOptions{tenant: tenant}
+	ctx := context.WithValue(c.ctx, addOptionsKey{}, opts)
+	return c.enqueue(ctx, data, tags, c.cfg.Overflow)
+}
+
+// tenantLimits returns the limits applying to a tenant.
+func (c *Queue) tenantLimits(tenant string) TenantLimits {
+	if limits, ok := c.cfg.Tenants[tenant]; ok {
+		return limits
+	}
+	return c.cfg.TenantDefaults
+}
+
+// checkTenant returns ErrTenantFull if adding an item for the tenant would
+// exceed its TenantLimits.MaxItems. Unscoped items have no tenant limits.
+func (c *Queue) checkTenant(tx *sql.Tx, tenant string) error {
+	limits := c.tenantLimits(tenant)
+	if tenant == "" || limits.MaxItems <= 0 {
+		return nil
+	}
+
+	var count int
+	err := tx.QueryRow(
+		"SELECT COUNT(*) FROM "+c.tables.items+" WHERE tenant = ? AND state IN ('pending', 'in-flight')",
+		tenant,
+	).Scan(&count)
+	if err != nil {
+		return err
+	}
+	if count >= limits.MaxItems {
+		return ErrTenantFull
+	}
+	return nil
+}
+
+// tenantAllowed reports whether an item of the tenant may be claimed without
+// exceeding its TenantLimits.Rate. It must be called with the queue locked.
+func (c *Queue) tenantAllowed(tenant string, now time.Time) bool {
+	limits := c.tenantLimits(tenant)
+	if tenant == "" || limits.Rate <= 0 {
+		return true
+	}
+
+	burst := float64(max(limits.Burst, 1))
+	b := c.buckets[tenant]
+	if b == nil {
+		b = &tenantBucket{tokens: burst, last: now} // Start with a full bucket.
+		if c.buckets == nil {
+			c.buckets = make(map[string]*tenantBucket)
+		}
+		c.buckets[tenant] = b
+	}
+
+	b.tokens = min(b.tokens+now.Sub(b.last).Seconds()*limits.Rate, burst)
+	b.last = now
+	return b.tokens >= 1
+}
+
+// tenantClaimed takes a token from the bucket of the tenant of a claimed
+// item. It must be called with the queue locked.
+func (c *Queue) tenantClaimed(tenant string) {
+	if b := c.buckets[tenant]; b != nil {
+		b.tokens--
+	}
+}
+
+// nullString returns s, or nil to store NULL for an empty string.
+func nullString(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
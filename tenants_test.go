@@ -0,0 +1,64 @@
+package queue
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestTenantBacklog(t *testing.T) {
+	queue := setupQueue(t, Config{
+		Tenants:        map[string]TenantLimits{"acme": {MaxItems: 1}},
+		TenantDefaults: TenantLimits{MaxItems: 2},
+	})
+	defer queue.Close()
+
+	if err := queue.AddForTenant("acme", []byte("a")); err != nil {
+		t.Fatalf("failed to add item for tenant: %v", err)
+	}
+	if err := queue.AddForTenant("acme", []byte("b")); !errors.Is(err, ErrTenantFull) {
+		t.Fatalf("expected ErrTenantFull, got %v", err)
+	}
+
+	// Other tenants and unscoped items are not held back by acme.
+	for i := 0; i < 2; i++ {
+		if err := queue.AddForTenant("globex", []byte("c")); err != nil {
+			t.Fatalf("failed to add item for tenant: %v", err)
+		}
+	}
+	if err := queue.Add([]byte("d")); err != nil {
+		t.Fatalf("failed to add item to queue: %v", err)
+	}
+
+	stats, err := queue.Stats()
+	if err != nil {
+		t.Fatalf("failed to read stats: %v", err)
+	}
+	if stats.Pending != 4 || len(stats.Tenants) != 2 || stats.Tenants["acme"].Pending != 1 || stats.Tenants["globex"].Bytes != 2 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+
+	items, err := queue.Get(1)
+	if err != nil || len(items) != 1 || items[0].Tenant != "acme" {
+		t.Fatalf("expected the item to carry its tenant, got %+v, %v", items, err)
+	}
+}
+
+func TestTenantRate(t *testing.T) {
+	queue := setupQueue(t, Config{Tenants: map[string]TenantLimits{"acme": {Rate: 0.001, Burst: 2}}})
+	defer queue.Close()
+
+	for i := 0; i < 3; i++ {
+		if err := queue.AddForTenant("acme", []byte("a")); err != nil {
+			t.Fatalf("failed to add item for tenant: %v", err)
+		}
+	}
+	if err := queue.AddForTenant("globex", []byte("b")); err != nil {
+		t.Fatalf("failed to add item for tenant: %v", err)
+	}
+
+	// The burst of acme is used up after two items, so globex comes next.
+	items, err := queue.Claim(10)
+	if err != nil || len(items) != 3 || items[2].Tenant != "globex" {
+		t.Fatalf("expected two items of acme and one of globex, got %+v, %v", items, err)
+	}
+}
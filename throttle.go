@@ -0,0 +1,133 @@
+package queue
+
+import (
+	"time"
+)
+
+// TopicLimits throttles a queue served by the workers of a Manager,
+// independently of the other queues.
+type TopicLimits struct {
+	MaxInFlight int     // Items of the queue handled at once; 0 means only the worker count caps it.
+	Rate        float64 // Items dispatched per second; 0 means unlimited.
+	Burst       int     // Items dispatched back to back after a quiet period; 0 means 1.
+}
+
+// limiter enforces the TopicLimits of a topic with a token bucket and an
+// in-flight counter.
+type limiter struct {
+	limits   TopicLimits
+	inFlight int       // Items being handled or about to be claimed.
+	tokens   float64   // Dispatches allowed right now.
+	last     time.Time // When tokens was last refilled.
+}
+
+// SetLimits caps how many items of the named queue the workers started with
+// Run handle at once and how fast they dispatch them, e.g. to throttle a bulk
+// export while password reset emails stay fast. It may be called before or
+// after Serve and replaces earlier limits; a zero TopicLimits removes them.
+func (m *Manager) SetLimits(name string, limits TopicLimits) {
+	s := &m.sched
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	if s.limits == nil {
+		s.limits = make(map[string]*limiter)
+	}
+	l := s.limits[name]
+	if l == nil {
+		l = &limiter{last: m.cfg.Clock.Now()}
+		s.limits[name] = l
+	}
+	l.limits = limits
+	l.tokens = float64(l.burst()) // Start with a full bucket.
+}
+
+// burst returns the capacity of the token bucket.
+func (l *limiter) burst() int {
+	return max(l.limits.Burst, 1)
+}
+
+// refill adds the tokens accrued since the last refill.
+func (l *limiter) refill(now time.Time) {
+	if l.limits.Rate <= 0 {
+		return
+	}
+	l.tokens = min(l.tokens+now.Sub(l.last).Seconds()*l.limits.Rate, float64(l.burst()))
+	l.last = now
+}
+
+// reserve takes an in-flight slot and a token of a topic before an item is
+// claimed from it. It reports false if the topic is throttled.
+func (s *scheduler) reserve(t *topic, now time.Time) bool {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	l := s.limits[t.name]
+	if l == nil {
+		return true
+	}
+
+	l.refill(now)
+	if l.limits.MaxInFlight > 0 && l.inFlight >= l.limits.MaxInFlight {
+		return false
+	}
+	if l.limits.Rate > 0 && l.tokens < 1 {
+		return false
+	}
+
+	l.inFlight++
+	if l.limits.Rate > 0 {
+		l.tokens--
+	}
+	return true
+}
+
+// unreserve gives back what reserve took when no item was claimed.
+func (s *scheduler) unreserve(t *topic) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	if l := s.limits[t.name]; l != nil {
+		l.inFlight--
+		if l.limits.Rate > 0 {
+			l.tokens = min(l.tokens+1, float64(l.burst()))
+		}
+	}
+}
+
+// finish frees the in-flight slot of a handled item and wakes the idle
+// workers if the topic was at its cap.
+func (s *scheduler) finish(t *topic) {
+	s.mx.Lock()
+	l := s.limits[t.name]
+	capped := l != nil && l.limits.MaxInFlight > 0 && l.inFlight >= l.limits.MaxInFlight
+	if l != nil {
+		l.inFlight--
+	}
+	s.mx.Unlock()
+
+	if capped {
+		s.signal()
+	}
+}
+
+// nextToken returns how long idle workers may sleep before a rate limited
+// topic can dispatch again, at most schedulerPollInterval.
+func (s *scheduler) nextToken(now time.Time) time.Duration {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	wait := schedulerPollInterval
+	for _, l := range s.limits {
+		if l.limits.Rate <= 0 {
+			continue
+		}
+		l.refill(now)
+		if l.tokens >= 1 {
+			continue
+		}
+		missing := time.Duration((1 - l.tokens) / l.limits.Rate * float64(time.Second))
+		wait = min(wait, missing)
+	}
+	return wait
+}
@@ -0,0 +1,93 @@
+package queue
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestManagerTopicLimits(t *testing.T) {
+	manager, err := NewManager(Config{})
+	if err != nil {
+		t.Fatalf("failed to initialize manager: %v", err)
+	}
+	defer manager.Close()
+
+	for name, count := range map[string]int{"bulk": 5, "emails": 5} {
+		q, err := manager.Queue(name)
+		if err != nil {
+			t.Fatalf("failed to open queue: %v", err)
+		}
+		for i := 0; i < count; i++ {
+			if err := q.Add([]byte(name)); err != nil {
+				t.Fatalf("failed to add item to queue: %v", err)
+			}
+		}
+	}
+
+	// Throttle the bulk queue to one item at a time and 20 items per second.
+	manager.SetLimits("bulk", TopicLimits{MaxInFlight: 1, Rate: 20})
+
+	var mx sync.Mutex
+	running, peak := 0, 0
+	finished := make(chan string, 10)
+	handler := func(item Item, delay func(sec time.Duration)) {
+		mx.Lock()
+		if string(item.Data) == "bulk" {
+			running++
+			peak = max(peak, running)
+		}
+		mx.Unlock()
+
+		time.Sleep(5 * time.Millisecond)
+
+		mx.Lock()
+		if string(item.Data) == "bulk" {
+			running--
+		}
+		mx.Unlock()
+		finished <- string(item.Data)
+	}
+	for _, name := range []string{"bulk", "emails"} {
+		if err := manager.Serve(name, 1, handler); err != nil {
+			t.Fatalf("failed to serve queue: %v", err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	start := time.Now()
+	go manager.Run(ctx, 4)
+
+	var emailsDone, bulkDone time.Duration
+	counts := make(map[string]int)
+	for i := 0; i < 10; i++ {
+		select {
+		case name := <-finished:
+			counts[name]++
+			if counts[name] == 5 {
+				if name == "emails" {
+					emailsDone = time.Since(start)
+				} else {
+					bulkDone = time.Since(start)
+				}
+			}
+		case <-time.After(3 * time.Second):
+			t.Fatalf("timed out waiting for items, got %v", counts)
+		}
+	}
+
+	if bulkDone < 150*time.Millisecond {
+		t.Fatalf("expected the bulk queue to be rate limited, finished after %v", bulkDone)
+	}
+	if emailsDone >= bulkDone {
+		t.Fatalf("expected the unthrottled queue to finish first, got %v and %v", emailsDone, bulkDone)
+	}
+
+	mx.Lock()
+	defer mx.Unlock()
+	if peak != 1 {
+		t.Fatalf("expected at most one bulk item in flight, got %d", peak)
+	}
+}
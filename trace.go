@@ -0,0 +1,92 @@
+package queue
+
+import (
+	"context"
+	"maps"
+)
+
+// TraceHeader is the header holding the trace or correlation ID of the
+// producer of an item.
+const TraceHeader = "trace-id"
+
+// Tracer carries trace or correlation IDs across the queue. The ID found in
+// the context of a producer is stored in the TraceHeader of the item, and the
+// consumer finds it again in Item.Context, so the logs and traces on both
+// sides of the queue join up. queueotel provides one for OpenTelemetry.
+type Tracer interface {
+	// TraceID returns the ID found in the context of a producer, or an empty
+	// string if there is none.
+	TraceID(ctx context.Context) string
+
+	// ContextWithTraceID returns a copy of ctx carrying the ID, as handed to
+	// the consumer of the item.
+	ContextWithTraceID(ctx context.Context, id string) context.Context
+}
+
+// traceIDKey is the context key of the ID set with ContextWithTraceID.
+type traceIDKey struct{}
+
+// ContextWithTraceID returns a copy of ctx carrying a trace or correlation
+// ID. Items added with the context, e.g. with AddContext, AddWait or Do,
+// carry it to their consumers, which find it with TraceIDFromContext on
+// Item.Context.
+func ContextWithTraceID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, traceIDKey{}, id)
+}
+
+// TraceIDFromContext returns the ID set with ContextWithTraceID, or an empty
+// string if there is none.
+func TraceIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(traceIDKey{}).(string)
+	return id
+}
+
+// contextTracer is the default Tracer, carrying the ID set with
+// ContextWithTraceID.
+type contextTracer struct{}
+
+func (contextTracer) TraceID(ctx context.Context) string {
+	return TraceIDFromContext(ctx)
+}
+
+func (contextTracer) ContextWithTraceID(ctx context.Context, id string) context.Context {
+	return ContextWithTraceID(ctx, id)
+}
+
+// Context returns the context of the consumer of an item claimed by a
+// listener or Claim: it carries the trace ID of the producer, see Tracer,
+// and is done once the queue is closed. Items read otherwise, e.g. with Get,
+// return context.Background().
+func (i Item) Context() context.Context {
+	if i.ctx == nil {
+		return context.Background()
+	}
+	return i.ctx
+}
+
+// captureTrace stores the trace ID of the producer's context in the headers
+// of the item, unless they already hold one.
+func (c *Queue) captureTrace(ctx context.Context, opts *addOptions) {
+	if _, ok := opts.headers[TraceHeader]; ok {
+		return
+	}
+	id := c.cfg.Tracer.TraceID(ctx)
+	if id == "" {
+		return
+	}
+	// Copy the headers, as the map passed to WithHeaders belongs to the caller.
+	headers := maps.Clone(opts.headers)
+	if headers == nil {
+		headers = make(map[string]string, 1)
+	}
+	headers[TraceHeader] = id
+	opts.headers = headers
+}
+
+// itemContext returns the context handed to the consumer of the item.
+func (c *Queue) itemContext(item Item) context.Context {
+	if id := item.Headers[TraceHeader]; id != "" {
+		return c.cfg.Tracer.ContextWithTraceID(c.ctx, id)
+	}
+	return c.ctx
+}
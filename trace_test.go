@@ -0,0 +1,42 @@
+package queue
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTraceID(t *testing.T) {
+	queue := setupQueue(t, Config{})
+	defer queue.Close()
+
+	ctx := ContextWithTraceID(context.Background(), "req-42")
+	if _, err := queue.AddContext(ctx, []byte("traced")); err != nil {
+		t.Fatalf("failed to add item to queue: %v", err)
+	}
+	// Headers set explicitly win over the context.
+	headers := map[string]string{TraceHeader: "explicit"}
+	if _, err := queue.AddContext(ctx, []byte("explicit"), WithHeaders(headers)); err != nil {
+		t.Fatalf("failed to add item to queue: %v", err)
+	}
+	if err := queue.Add([]byte("untraced")); err != nil {
+		t.Fatalf("failed to add item to queue: %v", err)
+	}
+
+	traces := make(chan string, 3)
+	queue.Listener(func(item Item, delay func(sec time.Duration)) {
+		traces <- string(item.Data) + "=" + TraceIDFromContext(item.Context())
+	})
+
+	expected := []string{"traced=req-42", "explicit=explicit", "untraced="}
+	for _, want := range expected {
+		select {
+		case got := <-traces:
+			if got != want {
+				t.Fatalf("expected %q, got %q", want, got)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expected the item to be delivered")
+		}
+	}
+}
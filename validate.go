@@ -0,0 +1,181 @@
+package queue
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ErrInvalidConfig is matched by errors.Is for a *ConfigError.
+var ErrInvalidConfig = errors.New("queue: invalid configuration")
+
+// ConfigError describes a setting New, NewWithDB or NewManager rejected. When
+// several settings are wrong, the errors are joined with errors.Join, and
+// errors.As yields the first.
+type ConfigError struct {
+	Field  string // Name of the Config field, e.g. "LeaseTimeout".
+	Value  any    // Rejected value.
+	Reason string // Why the value was rejected.
+}
+
+func (e *ConfigError) Error() string {
+	return fmt.Sprintf("queue: invalid Config.%s %v: %s", e.Field, e.Value, e.Reason)
+}
+
+// Is reports whether target is ErrInvalidConfig.
+func (e *ConfigError) Is(target error) bool {
+	return target == ErrInvalidConfig
+}
+
+// journalModes, synchronousLevels and autoVacuumModes list the values SQLite
+// accepts for the corresponding PRAGMAs, in upper case.
+var (
+	journalModes      = []string{"DELETE", "TRUNCATE", "PERSIST", "MEMORY", "WAL", "OFF"}
+	synchronousLevels = []string{"OFF", "NORMAL", "FULL", "EXTRA", "0", "1", "2", "3"}
+	autoVacuumModes   = []string{"NONE", "FULL", "INCREMENTAL", "0", "1", "2"}
+)
+
+// validateConfig checks the settings as given by the caller, before the
+// defaults are filled in, so a negative value is not silently replaced by its
+// default. Zero values are left to configDefault.
+func validateConfig(cfg Config) error {
+	var errs []error
+	reject := func(field string, value any, reason string) {
+		errs = append(errs, &ConfigError{Field: field, Value: value, Reason: reason})
+	}
+
+	durations := []struct {
+		field string
+		value time.Duration
+	}{
+		{"LeaseTimeout", cfg.LeaseTimeout},
+		{"ResultTTL", cfg.ResultTTL},
+		{"BatchRetryDelay", cfg.BatchRetryDelay},
+		{"BusyTimeout", cfg.BusyTimeout},
+		{"ConnMaxLifetime", cfg.ConnMaxLifetime},
+		{"MaintenanceInterval", cfg.MaintenanceInterval},
+		{"StallTimeout", cfg.StallTimeout},
+		{"GroupCommitInterval", cfg.GroupCommitInterval},
+		{"HistoryRetention", cfg.HistoryRetention},
+	}
+	for _, d := range durations {
+		if d.value < 0 {
+			reject(d.field, d.value, "must not be negative")
+		}
+	}
+
+	sizes := []struct {
+		field string
+		value int64
+	}{
+		{"DebugRetention", int64(cfg.DebugRetention)},
+		{"MaxItems", int64(cfg.MaxItems)},
+		{"MaxBytes", cfg.MaxBytes},
+		{"MaxPayloadSize", int64(cfg.MaxPayloadSize)},
+		{"ChunkSize", int64(cfg.ChunkSize)},
+		{"OffloadThreshold", int64(cfg.OffloadThreshold)},
+		{"MaxAttempts", int64(cfg.MaxAttempts)},
+		{"PoisonThreshold", int64(cfg.PoisonThreshold)},
+		{"CompactFreePages", cfg.CompactFreePages},
+		{"MaxBacklog", int64(cfg.MaxBacklog)},
+		{"MaxInFlight", int64(cfg.MaxInFlight)},
+		{"ClaimBatchSize", int64(cfg.ClaimBatchSize)},
+		{"GroupCommitSize", int64(cfg.GroupCommitSize)},
+		{"HistoryMaxItems", int64(cfg.HistoryMaxItems)},
+	}
+	for _, s := range sizes {
+		if s.value < 0 {
+			reject(s.field, s.value, "must not be negative")
+		}
+	}
+	if cfg.Workers < 0 {
+		reject("Workers", cfg.Workers, "must be at least 1, or 0 for the default")
+	}
+	for tenant, limits := range cfg.Tenants {
+		if limits.MaxItems < 0 || limits.Rate < 0 || limits.Burst < 0 {
+			reject("Tenants", tenant, "limits must not be negative")
+			break // One error is enough, and map order would make the rest vary.
+		}
+	}
+	if limits := cfg.TenantDefaults; limits.MaxItems < 0 || limits.Rate < 0 || limits.Burst < 0 {
+		reject("TenantDefaults", limits, "limits must not be negative")
+	}
+
+	if cfg.Overflow < OverflowReject || cfg.Overflow > OverflowBlock {
+		reject("Overflow", cfg.Overflow, "unknown overflow policy")
+	}
+	if cfg.IntegrityCheck < IntegrityCheckOff || cfg.IntegrityCheck > IntegrityCheckFull {
+		reject("IntegrityCheck", cfg.IntegrityCheck, "unknown integrity check")
+	}
+	if !oneOf(cfg.JournalMode, journalModes) {
+		reject("JournalMode", cfg.JournalMode, "unknown SQLite journal mode")
+	}
+	if !oneOf(cfg.Synchronous, synchronousLevels) {
+		reject("Synchronous", cfg.Synchronous, "unknown SQLite synchronous level")
+	}
+	if !oneOf(cfg.AutoVacuum, autoVacuumModes) {
+		reject("AutoVacuum", cfg.AutoVacuum, "unknown SQLite auto_vacuum mode")
+	}
+
+	// Settings that only make sense together.
+	if cfg.OffloadThreshold > 0 && cfg.Offload == nil {
+		reject("OffloadThreshold", cfg.OffloadThreshold, "set without Offload")
+	}
+	if cfg.Salvage && cfg.IntegrityCheck == IntegrityCheckOff {
+		reject("Salvage", cfg.Salvage, "set without IntegrityCheck, so nothing triggers it")
+	}
+	if cfg.MaxPayloadSize > 0 && cfg.MaxBytes > 0 && int64(cfg.MaxPayloadSize) > cfg.MaxBytes {
+		reject("MaxPayloadSize", cfg.MaxPayloadSize, "exceeds MaxBytes, so payloads this large never fit")
+	}
+
+	if err := validateLocalFile(cfg); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// validateLocalFile checks that LocalFile is a well-formed URI, or a path
+// whose directory exists. An empty LocalFile selects an in-memory database.
+func validateLocalFile(cfg Config) error {
+	path := cfg.LocalFile
+	switch {
+	case path == "" || path == ":memory:":
+		return nil
+	case strings.HasPrefix(path, "file:"):
+		if _, err := url.Parse(path); err != nil {
+			return &ConfigError{Field: "LocalFile", Value: path, Reason: "malformed URI: " + err.Error()}
+		}
+		if cfg.Salvage {
+			return &ConfigError{Field: "LocalFile", Value: path, Reason: "Salvage needs a plain file path"}
+		}
+		return nil
+	case strings.Contains(path, "?"):
+		return &ConfigError{Field: "LocalFile", Value: path, Reason: `connection parameters need a "file:" URI`}
+	}
+
+	info, err := os.Stat(filepath.Dir(path))
+	if err != nil {
+		return &ConfigError{Field: "LocalFile", Value: path, Reason: "directory not accessible: " + err.Error()}
+	}
+	if !info.IsDir() {
+		return &ConfigError{Field: "LocalFile", Value: path, Reason: filepath.Dir(path) + " is not a directory"}
+	}
+	return nil
+}
+
+// oneOf reports whether value is empty or, ignoring case, one of allowed.
+func oneOf(value string, allowed []string) bool {
+	if value == "" {
+		return true
+	}
+	for _, a := range allowed {
+		if strings.EqualFold(value, a) {
+			return true
+		}
+	}
+	return false
+}
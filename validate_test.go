@@ -0,0 +1,56 @@
+package queue
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestConfigValidation(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "missing", "queue.db")
+	cases := []struct {
+		name  string
+		cfg   Config
+		field string
+	}{
+		{"negative duration", Config{LeaseTimeout: -time.Second}, "LeaseTimeout"},
+		{"negative limit", Config{MaxItems: -1}, "MaxItems"},
+		{"negative workers", Config{Workers: -2}, "Workers"},
+		{"unknown journal mode", Config{JournalMode: "fast"}, "JournalMode"},
+		{"threshold without store", Config{OffloadThreshold: 10}, "OffloadThreshold"},
+		{"salvage without check", Config{Salvage: true}, "Salvage"},
+		{"missing directory", Config{LocalFile: missing}, "LocalFile"},
+		{"parameters without URI", Config{LocalFile: "queue.db?mode=ro"}, "LocalFile"},
+		{"invalid table", Config{Table: "items; DROP TABLE x"}, "Table"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			queue, err := New(tc.cfg)
+			if err == nil {
+				queue.Close()
+				t.Fatalf("expected the configuration to be rejected")
+			}
+			if !errors.Is(err, ErrInvalidConfig) {
+				t.Fatalf("expected ErrInvalidConfig, got %v", err)
+			}
+			var configErr *ConfigError
+			if !errors.As(err, &configErr) || configErr.Field != tc.field {
+				t.Fatalf("expected an error about %s, got %v", tc.field, err)
+			}
+		})
+	}
+}
+
+func TestConfigValidationJoinsErrors(t *testing.T) {
+	_, err := NewManager(Config{ResultTTL: -1, ChunkSize: -1})
+	if err == nil {
+		t.Fatalf("expected the configuration to be rejected")
+	}
+
+	joined, ok := err.(interface{ Unwrap() []error })
+	if !ok || len(joined.Unwrap()) != 2 {
+		t.Fatalf("expected both settings to be reported, got %v", err)
+	}
+}
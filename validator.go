@@ -0,0 +1,68 @@
+package queue
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Validator checks payloads before they enter the queue, so malformed ones
+// are rejected by Add with a descriptive error rather than failing in a
+// consumer later. It applies to every way of adding items, Publish and
+// Import; AddFrom, whose payload is streamed, fails with
+// ErrStreamValidation instead. See JSONSchema.
+type Validator interface {
+	Validate(data []byte) error
+}
+
+// ValidatorFunc adapts a function to the Validator interface.
+type ValidatorFunc func(data []byte) error
+
+// Validate calls f(data).
+func (f ValidatorFunc) Validate(data []byte) error {
+	return f(data)
+}
+
+// ValidationError is returned when Config.Validator rejects a payload. It
+// matches ErrInvalidPayload.
+type ValidationError struct {
+	Path string // JSON Pointer to the offending value, e.g. "/items/0/price"; empty for the whole payload.
+	Err  error  // Why the value is invalid.
+}
+
+func (e *ValidationError) Error() string {
+	if e.Path == "" {
+		return fmt.Sprintf("queue: invalid payload: %v", e.Err)
+	}
+	return fmt.Sprintf("queue: invalid payload at %s: %v", e.Path, e.Err)
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrInvalidPayload
+}
+
+// SetValidator replaces the validator of the queue, e.g. to give each queue
+// of a Manager its own schema. nil accepts every payload.
+func (c *Queue) SetValidator(v Validator) {
+	c.validator.Store(&v)
+}
+
+// validate checks a payload with the validator of the queue, if any.
+func (c *Queue) validate(data []byte) error {
+	v := c.validator.Load()
+	if v == nil || *v == nil {
+		return nil
+	}
+	err := (*v).Validate(data)
+	if err == nil {
+		return nil
+	}
+	var invalid *ValidationError
+	if errors.As(err, &invalid) {
+		return err
+	}
+	return &ValidationError{Err: err}
+}
@@ -0,0 +1,64 @@
+package queue
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidator(t *testing.T) {
+	validator, err := JSONSchema([]byte(`{"type": "object", "required": ["email"]}`))
+	if err != nil {
+		t.Fatalf("failed to compile schema: %v", err)
+	}
+	queue := setupQueue(t, Config{Validator: validator})
+	defer queue.Close()
+
+	if err := queue.Add([]byte(`{"email": "a@example.com"}`)); err != nil {
+		t.Fatalf("failed to add valid item: %v", err)
+	}
+	err = queue.Add([]byte(`{"name": "a"}`))
+	if !errors.Is(err, ErrInvalidPayload) || !strings.Contains(err.Error(), `missing required property "email"`) {
+		t.Fatalf("expected a descriptive ErrInvalidPayload, got %v", err)
+	}
+	if _, err := queue.Publish([]byte(`[]`)); !errors.Is(err, ErrInvalidPayload) {
+		t.Fatalf("expected Publish to validate the message, got %v", err)
+	}
+
+	items, err := queue.Get(10)
+	if err != nil || len(items) != 1 {
+		t.Fatalf("expected only the valid item in the queue, got %+v, %v", items, err)
+	}
+}
+
+func TestSetValidator(t *testing.T) {
+	manager, err := NewManager()
+	if err != nil {
+		t.Fatalf("failed to create manager: %v", err)
+	}
+	defer manager.Close()
+
+	orders, err := manager.Queue("orders")
+	if err != nil {
+		t.Fatalf("failed to open queue: %v", err)
+	}
+	logs, err := manager.Queue("logs")
+	if err != nil {
+		t.Fatalf("failed to open queue: %v", err)
+	}
+
+	errEmpty := errors.New("empty order")
+	orders.SetValidator(ValidatorFunc(func(data []byte) error {
+		if len(data) == 0 {
+			return errEmpty
+		}
+		return nil
+	}))
+
+	if err := orders.Add([]byte{}); !errors.Is(err, ErrInvalidPayload) || !errors.Is(err, errEmpty) {
+		t.Fatalf("expected the validator of the queue to reject the item, got %v", err)
+	}
+	if err := logs.Add([]byte{}); err != nil {
+		t.Fatalf("expected other queues to accept any payload, got %v", err)
+	}
+}
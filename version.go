@@ -0,0 +1,139 @@
+package queue
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// AnyVersion makes Update and DeleteVersion skip the version check.
+const AnyVersion int64 = 0
+
+// createVersionTrigger adds the version column and the trigger bumping it on
+// every update of an item. Statements returning the updated rows bump it
+// themselves, as RETURNING does not see changes made by triggers.
+func createVersionTrigger(tx *sql.Tx, t tables) error {
+	if err := addColumn(tx, t.items, "version", "INTEGER NOT NULL DEFAULT 1"); err != nil {
+		return err
+	}
+
+	_, err := tx.Exec(`
+        CREATE TRIGGER IF NOT EXISTS ` + t.items + `_version AFTER UPDATE ON ` + t.items + ` WHEN NEW.version = OLD.version BEGIN
+            UPDATE ` + t.items + ` SET version = OLD.version + 1 WHERE id = NEW.id;
+        END;
+    `)
+	return err
+}
+
+// VersionConflictError is returned by Update and DeleteVersion when the item
+// changed since the expected version was read, e.g. because a listener or
+// another operator got to it first. It matches ErrVersionConflict.
+type VersionConflictError struct {
+	ID       int   // Identifier of the item.
+	Expected int64 // Version the caller expected.
+	Actual   int64 // Version the item is at.
+}
+
+func (e *VersionConflictError) Error() string {
+	return fmt.Sprintf("queue: item %d is at version %d, not %d", e.ID, e.Actual, e.Expected)
+}
+
+// Is makes errors.Is(err, ErrVersionConflict) match.
+func (e *VersionConflictError) Is(target error) bool {
+	return target == ErrVersionConflict
+}
+
+// checkVersion returns ErrItemNotFound if the item does not exist and a
+// *VersionConflictError unless it is at the given version, if any. Writers
+// are serialized, so the check holds for the rest of the transaction.
+func (c *Queue) checkVersion(tx *sql.Tx, id int, version int64) error {
+	if version == AnyVersion {
+		return nil
+	}
+	var actual int64
+	err := tx.QueryRow("SELECT version FROM "+c.tables.items+" WHERE id = ?", id).Scan(&actual)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrItemNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if actual != version {
+		return &VersionConflictError{ID: id, Expected: version, Actual: actual}
+	}
+	return nil
+}
+
+// Update replaces the payload of an item, keeping its place in the queue,
+// tags and attempts. Unless version is AnyVersion, the item must still be at
+// the version read along with it, or Update returns a *VersionConflictError
+// instead of overwriting a concurrent change. Items held by a consumer cannot
+// be updated; see CanTransition. It returns ErrItemNotFound if the item does
+// not exist.
+func (c *Queue) Update(id int, data []byte, version int64) error {
+	p, err := c.preparePayload(data)
+	if err != nil {
+		return err
+	}
+
+	c.mx.Lock() // Lock for exclusive access to the queue.
+	defer c.mx.Unlock()
+
+	err = c.withTx(func(tx *sql.Tx) error {
+		if err := c.checkVersion(tx, id, version); err != nil {
+			return err
+		}
+		before, err := c.rowSnapshot(tx, id)
+		if err != nil {
+			return err
+		}
+		from, err := c.itemState(tx, id)
+		if err != nil {
+			return err
+		}
+
+		n, err := c.replacePayload(tx, id, p)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return ErrItemNotFound
+		}
+		if err := c.enforceTransition(tx, id, TransitionUpdated, from); err != nil {
+			return err
+		}
+		if err := c.snapshot(tx, id, TransitionUpdated, before); err != nil {
+			return err
+		}
+		return c.audit(tx, c.actor(), TransitionUpdated, id)
+	})
+	if err != nil {
+		c.discardPayload(p)
+	}
+	return err
+}
+
+// DeleteVersion removes an item like Delete, provided it is still at the
+// given version; see Update.
+func (c *Queue) DeleteVersion(id int, version int64) error {
+	return c.remove(id, version, TransitionDeleted, c.actor())
+}
+
+// replacePayload stores a new payload for an item, releasing its chunks and
+// offloaded payload. It returns 0 if the item does not exist.
+func (c *Queue) replacePayload(tx *sql.Tx, id int, p storedPayload) (int, error) {
+	if _, err := tx.Exec("INSERT OR IGNORE INTO "+c.tables.blobs+"(`key`) SELECT `blob` FROM "+c.tables.items+" WHERE id = ? AND blob IS NOT NULL", id); err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec("DELETE FROM "+c.tables.chunks+" WHERE item_id = ?", id); err != nil {
+		return 0, err
+	}
+	n, err := execCount(tx,
+		"UPDATE "+c.tables.items+" SET data = ?, chunks = 0, blob = NULL, streamed = 0, checksum = ?, key_id = ? WHERE id = ?",
+		p.head, p.checksum, nullString(p.key), id,
+	)
+	if err != nil || n == 0 {
+		return n, err
+	}
+	return n, c.storePayload(tx, int64(id), p)
+}
@@ -0,0 +1,75 @@
+package queue
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestUpdateVersion(t *testing.T) {
+	queue := setupQueue(t, Config{ChunkSize: 4})
+	defer queue.Close()
+
+	if err := queue.Add([]byte("test data")); err != nil {
+		t.Fatalf("failed to add item to queue: %v", err)
+	}
+	items, err := queue.Get(1)
+	if err != nil || len(items) != 1 {
+		t.Fatalf("failed to get item: %v", err)
+	}
+	item := items[0]
+
+	if err := queue.Update(item.ID, []byte("updated payload"), item.Version); err != nil {
+		t.Fatalf("failed to update item: %v", err)
+	}
+	items, err = queue.Get(1)
+	if err != nil || len(items) != 1 || string(items[0].Data) != "updated payload" {
+		t.Fatalf("expected the updated payload, got %+v, %v", items, err)
+	}
+	if items[0].Version == item.Version {
+		t.Fatalf("expected the version to change, still %d", item.Version)
+	}
+
+	// The version read before the update is stale now.
+	var conflict *VersionConflictError
+	err = queue.Update(item.ID, []byte("lost update"), item.Version)
+	if !errors.Is(err, ErrVersionConflict) || !errors.As(err, &conflict) || conflict.Actual != items[0].Version {
+		t.Fatalf("expected a version conflict, got %v", err)
+	}
+
+	// Any change to the item bumps the version.
+	current := items[0].Version
+	if err := queue.Admin().Reprioritize(item.ID, 5); err != nil {
+		t.Fatalf("failed to reprioritize item: %v", err)
+	}
+	if err := queue.DeleteVersion(item.ID, current); !errors.Is(err, ErrVersionConflict) {
+		t.Fatalf("expected a version conflict, got %v", err)
+	}
+
+	items, err = queue.Get(1)
+	if err != nil || len(items) != 1 {
+		t.Fatalf("failed to get item: %v", err)
+	}
+	if err := queue.DeleteVersion(item.ID, items[0].Version); err != nil {
+		t.Fatalf("failed to delete item: %v", err)
+	}
+	if err := queue.Update(item.ID, []byte("gone"), AnyVersion); !errors.Is(err, ErrItemNotFound) {
+		t.Fatalf("expected ErrItemNotFound, got %v", err)
+	}
+}
+
+func TestUpdateInFlight(t *testing.T) {
+	queue := setupQueue(t, Config{})
+	defer queue.Close()
+
+	if err := queue.Add([]byte("test data")); err != nil {
+		t.Fatalf("failed to add item to queue: %v", err)
+	}
+	items, err := queue.Claim(1)
+	if err != nil || len(items) != 1 {
+		t.Fatalf("failed to claim item: %v", err)
+	}
+
+	if err := queue.Update(items[0].ID, []byte("updated"), items[0].Version); !errors.Is(err, ErrIllegalTransition) {
+		t.Fatalf("expected claimed items not to be updatable, got %v", err)
+	}
+}
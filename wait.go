@@ -0,0 +1,39 @@
+package queue
+
+import (
+	"context"
+	"time"
+)
+
+// GetWait retrieves up to 'limit' items from the queue, blocking until at least
+// one item is available or maxWait elapses. It returns no items and no error if
+// the wait times out, and the context error if ctx is done first.
+func (c *Queue) GetWait(ctx context.Context, limit int, maxWait time.Duration) ([]Item, error) {
+	timeout := c.cfg.Clock.After(maxWait)
+
+	for {
+		c.mx.Lock() // Lock for exclusive access to the queue.
+		added := c.added
+		items, err := c.get(limit)
+		c.mx.Unlock()
+
+		if err != nil || len(items) > 0 {
+			return items, err
+		}
+
+		// Wait for a producer to add an item before looking again.
+		select {
+		case <-added:
+		case <-timeout:
+			return nil, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// signalAdded wakes consumers waiting for items. It must be called with the queue locked.
+func (c *Queue) signalAdded() {
+	close(c.added)
+	c.added = make(chan struct{})
+}
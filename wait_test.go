@@ -0,0 +1,31 @@
+package queue
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestGetWait(t *testing.T) {
+	queue := setupQueue(t, Config{})
+	defer queue.Close()
+
+	// An empty queue times out without an error.
+	items, err := queue.GetWait(context.Background(), 1, 50*time.Millisecond)
+	if err != nil || len(items) != 0 {
+		t.Fatalf("expected empty result, got %+v, %v", items, err)
+	}
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		queue.Add([]byte("test data"))
+	}()
+
+	items, err = queue.GetWait(context.Background(), 1, 5*time.Second)
+	if err != nil {
+		t.Fatalf("failed to get items from queue: %v", err)
+	}
+	if len(items) != 1 || string(items[0].Data) != "test data" {
+		t.Fatalf("unexpected items: %+v", items)
+	}
+}
@@ -0,0 +1,210 @@
+package queue
+
+import (
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// windowRefreshInterval is how often the listener loops reload the pause
+// windows, so windows added or removed by other processes take effect.
+const windowRefreshInterval = 10 * time.Second
+
+// PauseWindow is a recurring period during which the listeners of the queue
+// and the workers of a Manager pause or throttle dispatching, e.g. while a
+// downstream system is under maintenance. Items keep being added, and Claim
+// is not affected.
+type PauseWindow struct {
+	Name     string        // Unique name of the window.
+	Spec     string        // Cron expression of the start of the window, e.g. "0 2 * * *" for 02:00 every night; see AddCron.
+	Duration time.Duration // How long each window lasts.
+	Rate     float64       // Items, or batches of a BatchListener, dispatched per second during the window; 0 pauses dispatching.
+}
+
+// ActiveAt reports whether t falls within the window. The spec must be valid.
+func (w PauseWindow) ActiveAt(t time.Time) bool {
+	schedule, err := cron.ParseStandard(w.Spec)
+	if err != nil {
+		return false
+	}
+	_, active := windowEnd(schedule, w.Duration, t)
+	return active
+}
+
+// windowEnd reports whether t falls within a window of the given length
+// starting at a firing of schedule, and if so when that window ends.
+func windowEnd(schedule cron.Schedule, duration time.Duration, t time.Time) (time.Time, bool) {
+	// The first start after t-duration is the only one whose window can cover t.
+	start := schedule.Next(t.Add(-duration))
+	end := start.Add(duration)
+	return end, !start.After(t) && t.Before(end)
+}
+
+// createWindowsTable creates the table holding the pause windows.
+func createWindowsTable(tx *sql.Tx, t tables) error {
+	_, err := tx.Exec(`
+        CREATE TABLE IF NOT EXISTS ` + t.windows + ` (
+            name TEXT PRIMARY KEY,
+            spec TEXT NOT NULL,
+            duration INTEGER NOT NULL,
+            rate REAL NOT NULL
+        );
+    `)
+	return err
+}
+
+// AddPauseWindow registers a recurring pause window, replacing any window
+// with the same name. Windows are stored in the database, so they survive
+// restarts and apply to every process sharing the file, within ten seconds.
+func (c *Queue) AddPauseWindow(w PauseWindow) error {
+	if _, err := cron.ParseStandard(w.Spec); err != nil {
+		return fmt.Errorf("queue: invalid cron expression %q: %w", w.Spec, err)
+	}
+	if w.Duration <= 0 {
+		return fmt.Errorf("queue: pause window %q must last longer than 0", w.Name)
+	}
+	if w.Rate < 0 {
+		return fmt.Errorf("queue: pause window %q must not have a negative rate", w.Name)
+	}
+
+	_, err := c.db.ExecContext(
+		c.ctx,
+		"INSERT INTO "+c.tables.windows+"(`name`, `spec`, `duration`, `rate`) VALUES (?, ?, ?, ?)"+
+			" ON CONFLICT(`name`) DO UPDATE SET `spec` = excluded.`spec`, `duration` = excluded.`duration`, `rate` = excluded.`rate`",
+		w.Name, w.Spec, w.Duration.Nanoseconds(), w.Rate,
+	)
+	if err == nil {
+		c.windows.invalidate()
+	}
+	return err
+}
+
+// RemovePauseWindow unregisters a pause window. It returns ErrWindowNotFound
+// if no window has the given name.
+func (c *Queue) RemovePauseWindow(name string) error {
+	res, err := c.db.ExecContext(c.ctx, "DELETE FROM "+c.tables.windows+" WHERE name = ?", name)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrWindowNotFound
+	}
+	c.windows.invalidate()
+	return nil
+}
+
+// PauseWindows returns the registered pause windows ordered by name.
+func (c *Queue) PauseWindows() ([]PauseWindow, error) {
+	rows, err := c.db.QueryContext(c.ctx, "SELECT `name`, `spec`, `duration`, `rate` FROM "+c.tables.windows+" ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close() // Ensure rows are closed after processing.
+
+	var windows []PauseWindow
+	for rows.Next() {
+		var w PauseWindow
+		var duration int64
+		if err := rows.Scan(&w.Name, &w.Spec, &duration, &w.Rate); err != nil {
+			return nil, err
+		}
+		w.Duration = time.Duration(duration)
+		windows = append(windows, w)
+	}
+	return windows, rows.Err()
+}
+
+// pauseWindow is a registered window with its schedule parsed.
+type pauseWindow struct {
+	PauseWindow
+	schedule cron.Schedule
+}
+
+// windowState caches the pause windows of a queue and throttles dispatching
+// while one with a rate is active.
+type windowState struct {
+	mx       sync.Mutex
+	windows  []pauseWindow
+	loadedAt time.Time // Zero when the windows must be reloaded.
+	tokens   float64   // Dispatches allowed right now during a throttling window.
+	last     time.Time // When tokens was last refilled.
+}
+
+// invalidate makes the next dispatch reload the windows.
+func (w *windowState) invalidate() {
+	w.mx.Lock()
+	w.loadedAt = time.Time{}
+	w.mx.Unlock()
+}
+
+// dispatchWait reports how long dispatching must wait because of a pause
+// window, or 0 if an item may be dispatched now, in which case the item is
+// charged to the rate of an active throttling window.
+func (c *Queue) dispatchWait() time.Duration {
+	now := c.cfg.Clock.Now()
+	w := &c.windows
+	w.mx.Lock()
+	defer w.mx.Unlock()
+
+	if w.loadedAt.IsZero() || now.Sub(w.loadedAt) >= windowRefreshInterval {
+		windows, err := c.PauseWindows()
+		if err != nil {
+			if c.ctx.Err() == nil {
+				c.cfg.Logger.Println("Error loading pause windows:", err)
+			}
+		} else {
+			w.windows = w.windows[:0]
+			for _, window := range windows {
+				schedule, err := cron.ParseStandard(window.Spec)
+				if err != nil {
+					continue // Only valid specs are stored.
+				}
+				w.windows = append(w.windows, pauseWindow{PauseWindow: window, schedule: schedule})
+			}
+		}
+		w.loadedAt = now
+	}
+
+	// A pause wins over throttling, and the slowest throttle over the others.
+	var rate float64
+	var paused time.Duration
+	active := false
+	for _, window := range w.windows {
+		end, ok := windowEnd(window.schedule, window.Duration, now)
+		if !ok {
+			continue
+		}
+		if window.Rate == 0 {
+			// Look again by the refresh at the latest, as the window may be removed.
+			paused = max(paused, min(end.Sub(now), windowRefreshInterval))
+			continue
+		}
+		if !active || window.Rate < rate {
+			rate = window.Rate
+		}
+		active = true
+	}
+
+	if paused > 0 {
+		return paused
+	}
+	if !active {
+		w.tokens, w.last = 1, now // Start the next throttling window with a token.
+		return 0
+	}
+
+	w.tokens = min(w.tokens+now.Sub(w.last).Seconds()*rate, 1)
+	w.last = now
+	if w.tokens < 1 {
+		return time.Duration((1 - w.tokens) / rate * float64(time.Second))
+	}
+	w.tokens--
+	return 0
+}
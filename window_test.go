@@ -0,0 +1,106 @@
+package queue
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPauseWindowActiveAt(t *testing.T) {
+	w := PauseWindow{Spec: "CRON_TZ=UTC 0 2 * * *", Duration: time.Hour}
+	day := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	for _, c := range []struct {
+		at     time.Duration
+		active bool
+	}{
+		{time.Hour + 59*time.Minute, false},
+		{2 * time.Hour, true},
+		{2*time.Hour + 59*time.Minute, true},
+		{3 * time.Hour, false},
+		{26*time.Hour + 30*time.Minute, true}, // The next night.
+	} {
+		if active := w.ActiveAt(day.Add(c.at)); active != c.active {
+			t.Errorf("expected the window active %v at %v, got %v", c.active, c.at, active)
+		}
+	}
+}
+
+func TestPauseWindows(t *testing.T) {
+	clock := NewFakeClock(time.Date(2024, 5, 1, 2, 30, 0, 0, time.UTC))
+	queue := setupQueue(t, Config{Clock: clock})
+	defer queue.Close()
+
+	if err := queue.AddPauseWindow(PauseWindow{Name: "nightly", Spec: "not a schedule", Duration: time.Hour}); err == nil {
+		t.Fatal("expected an invalid expression to be rejected")
+	}
+	if err := queue.AddPauseWindow(PauseWindow{Name: "nightly", Spec: "@daily", Duration: 0}); err == nil {
+		t.Fatal("expected an empty window to be rejected")
+	}
+	if err := queue.AddPauseWindow(PauseWindow{Name: "nightly", Spec: "CRON_TZ=UTC 0 2 * * *", Duration: time.Hour}); err != nil {
+		t.Fatalf("failed to add pause window: %v", err)
+	}
+	windows, err := queue.PauseWindows()
+	if err != nil || len(windows) != 1 || windows[0].Duration != time.Hour || windows[0].Rate != 0 {
+		t.Fatalf("unexpected pause windows: %+v, %v", windows, err)
+	}
+
+	if err := queue.Add([]byte("test data")); err != nil {
+		t.Fatalf("failed to add item to queue: %v", err)
+	}
+	delivered := make(chan struct{}, 1)
+	queue.Listener(func(item Item, delay func(sec time.Duration)) {
+		delivered <- struct{}{}
+	})
+
+	select {
+	case <-delivered:
+		t.Fatal("expected no delivery during the pause window")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// Dispatching resumes once the window ends.
+	clock.Advance(30 * time.Minute)
+	select {
+	case <-delivered:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the item to be delivered after the pause window")
+	}
+
+	if err := queue.RemovePauseWindow("nightly"); err != nil {
+		t.Fatalf("failed to remove pause window: %v", err)
+	}
+	if err := queue.RemovePauseWindow("nightly"); !errors.Is(err, ErrWindowNotFound) {
+		t.Fatalf("expected ErrWindowNotFound, got %v", err)
+	}
+}
+
+func TestThrottleWindow(t *testing.T) {
+	clock := NewFakeClock(time.Date(2024, 5, 1, 2, 30, 0, 0, time.UTC))
+	queue := setupQueue(t, Config{Clock: clock})
+	defer queue.Close()
+
+	if err := queue.AddPauseWindow(PauseWindow{Name: "slow", Spec: "CRON_TZ=UTC 0 2 * * *", Duration: time.Hour, Rate: 2}); err != nil {
+		t.Fatalf("failed to add pause window: %v", err)
+	}
+
+	// Two items per second: one right away, the next half a second later.
+	if wait := queue.dispatchWait(); wait != 0 {
+		t.Fatalf("expected the first dispatch right away, got %v", wait)
+	}
+	if wait := queue.dispatchWait(); wait != 500*time.Millisecond {
+		t.Fatalf("expected to wait 500ms, got %v", wait)
+	}
+	clock.Advance(500 * time.Millisecond)
+	if wait := queue.dispatchWait(); wait != 0 {
+		t.Fatalf("expected a dispatch after 500ms, got %v", wait)
+	}
+
+	// Outside the window, dispatching is not throttled.
+	clock.Advance(time.Hour)
+	for i := 0; i < 3; i++ {
+		if wait := queue.dispatchWait(); wait != 0 {
+			t.Fatalf("expected no throttling after the window, got %v", wait)
+		}
+	}
+}